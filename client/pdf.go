@@ -0,0 +1,231 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strconv"
+	"strings"
+)
+
+/*
+
+PDF puzzle booklets
+
+Booklets are plain PDF 1.4 files written without any
+dependencies.  Each page is a content stream of line-drawing and
+text operators, and the text is in the standard Helvetica fonts,
+which every PDF reader has built in.  Pages are US letter size,
+with the puzzles two to a page, followed by an appendix of their
+solutions six to a page.
+
+*/
+
+// A BookPuzzle is a puzzle in a booklet.  Its solution is shown
+// in the appendix, with the puzzle's own values in bold.
+type BookPuzzle struct {
+	Title    string `json:"title"`
+	Geometry string `json:"geometry"`
+	Values   []int  `json:"values"`
+	Solution []int  `json:"solution"`
+}
+
+// page layout, in points
+const (
+	pdfPageWidth    = 612
+	pdfPageHeight   = 792
+	pdfPuzzleSize   = 300
+	pdfSolutionSize = 180
+	pdfTitleSize    = 14
+	pdfCaptionSize  = 11
+)
+
+// PuzzleBookPDF returns a PDF booklet of the puzzles with the
+// given title.
+func PuzzleBookPDF(title string, puzzles []BookPuzzle) ([]byte, error) {
+	var pages []string
+	var page bytes.Buffer
+	newPage := func() {
+		if page.Len() > 0 {
+			pages = append(pages, page.String())
+			page.Reset()
+		}
+		pdfText(&page, "F1", 9, pdfPageWidth/2, 24, fmt.Sprintf("%s - page %d", title, len(pages)+1), true)
+	}
+
+	// the puzzles, two to a page
+	x := float64(pdfPageWidth-pdfPuzzleSize) / 2
+	for i, bp := range puzzles {
+		if i%2 == 0 {
+			newPage()
+		}
+		y := 430.0 - float64(i%2)*370
+		tp, err := bookTemplatePuzzle(bp.Geometry, bp.Values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", bp.Title, err)
+		}
+		pdfText(&page, "F2", pdfTitleSize, pdfPageWidth/2, y+pdfPuzzleSize+12, bp.Title, true)
+		pdfGrid(&page, tp, bp.Values, nil, x, y, pdfPuzzleSize)
+	}
+
+	// the solutions, six to a page
+	gap := float64(pdfPageWidth-2*pdfSolutionSize) / 3
+	for i, bp := range puzzles {
+		if i%6 == 0 {
+			newPage()
+			if i == 0 {
+				pdfText(&page, "F2", pdfTitleSize, pdfPageWidth/2, 756, "Solutions", true)
+			}
+		}
+		if len(bp.Solution) != len(bp.Values) {
+			return nil, fmt.Errorf("%s: solution has %d values, puzzle has %d",
+				bp.Title, len(bp.Solution), len(bp.Values))
+		}
+		x := gap + float64(i%2)*(pdfSolutionSize+gap)
+		y := 520.0 - float64((i%6)/2)*240
+		tp, _ := bookTemplatePuzzle(bp.Geometry, bp.Values)
+		pdfText(&page, "F1", pdfCaptionSize, x+pdfSolutionSize/2, y+pdfSolutionSize+8, bp.Title, true)
+		pdfGrid(&page, tp, bp.Solution, bp.Values, x, y, pdfSolutionSize)
+	}
+	newPage()
+	return pdfDocument(pages), nil
+}
+
+// bookTemplatePuzzle lays out a puzzle of the given geometry.
+func bookTemplatePuzzle(geometry string, values []int) (templatePuzzle, error) {
+	switch geometry {
+	case puzzle.StandardGeometryName:
+		return standardTemplatePuzzle(values)
+	case puzzle.RectangularGeometryName:
+		return rectangularTemplatePuzzle(values)
+	}
+	return nil, fmt.Errorf("Can't print puzzles with geometry %q", geometry)
+}
+
+// pdfGrid draws a puzzle grid with its lower left corner at x,
+// y.  If bold is given, the values that are also in bold are
+// drawn in bold, and the others in gray; otherwise all the
+// values are drawn in bold.
+func pdfGrid(buf *bytes.Buffer, tp templatePuzzle, values, bold []int, x, y, size float64) {
+	slen := len(tp)
+	cell := size / float64(slen)
+	fontSize := cell * 0.6
+	for i, row := range tp {
+		for j, c := range row {
+			v := values[c.Index-1]
+			if v <= 0 {
+				continue
+			}
+			cx, cy := x+(float64(j)+0.5)*cell, y+size-(float64(i)+0.7)*cell
+			if bold == nil || bold[c.Index-1] != 0 {
+				pdfText(buf, "F2", fontSize, cx, cy, strconv.Itoa(v), true)
+			} else {
+				buf.WriteString("0.45 g\n")
+				pdfText(buf, "F1", fontSize, cx, cy, strconv.Itoa(v), true)
+				buf.WriteString("0 g\n")
+			}
+		}
+	}
+	// grid lines, heavier at tile boundaries
+	for k := 0; k <= slen; k++ {
+		pos := float64(k) * cell
+		width := 0.5
+		if k == 0 || k == slen || tp[k%slen][0].HBorder == "top" {
+			width = 2
+		}
+		fmt.Fprintf(buf, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x, y+size-pos, x+size, y+size-pos)
+		width = 0.5
+		if k == 0 || k == slen || tp[0][k%slen].VBorder == "left" {
+			width = 2
+		}
+		fmt.Fprintf(buf, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x+pos, y, x+pos, y+size)
+	}
+}
+
+// pdfText draws a line of text starting at x, y (or centered on
+// x, if center is set).  Widths are estimated from the average
+// width of Helvetica characters, which is good enough to center
+// short captions and digits (which are all the same width).
+func pdfText(buf *bytes.Buffer, font string, size, x, y float64, text string, center bool) {
+	if center {
+		x -= 0.556 * size * float64(len(text)) / 2
+	}
+	fmt.Fprintf(buf, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(text))
+}
+
+// pdfEscape makes a string safe to use as a PDF string literal.
+// Characters outside printable ASCII are replaced with '?', since
+// the fonts don't have them.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > '~':
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// pdfDocument assembles a PDF file from page content streams.
+// The objects are the catalog (1), the page tree (2), the two
+// fonts (3 and 4), and then a content stream and a page for each
+// page.
+func pdfDocument(pages []string) []byte {
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	for i, content := range pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 5+2*i))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,87 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPuzzleBookPDF(t *testing.T) {
+	solution := make([]int, len(rotation4Puzzle1PartialValues))
+	for i, v := range rotation4Puzzle1PartialValues {
+		if solution[i] = v; v == 0 {
+			solution[i] = 1
+		}
+	}
+	var puzzles []BookPuzzle
+	for i := 1; i <= 3; i++ {
+		puzzles = append(puzzles, BookPuzzle{
+			Title:    fmt.Sprintf("Puzzle %d", i),
+			Geometry: puzzle.StandardGeometryName,
+			Values:   rotation4Puzzle1PartialValues,
+			Solution: solution,
+		})
+	}
+	pdf, err := PuzzleBookPDF("Test (book)", puzzles)
+	if err != nil {
+		t.Fatalf("Failed to make booklet: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Errorf("Booklet isn't framed as a PDF file")
+	}
+	// two puzzle pages and one solution page
+	if !bytes.Contains(pdf, []byte("/Count 3 ")) {
+		t.Errorf("Booklet doesn't have 3 pages")
+	}
+	if !bytes.Contains(pdf, []byte(`(Test \(book\) - page 3)`)) {
+		t.Errorf("Booklet doesn't have an escaped footer on page 3")
+	}
+
+	// every cross-reference must point at its object
+	text := string(pdf)
+	start := strings.LastIndex(text, "startxref\n")
+	xref, err := strconv.Atoi(strings.Fields(text[start+len("startxref\n"):])[0])
+	if err != nil || !strings.HasPrefix(text[xref:], "xref\n") {
+		t.Fatalf("Bad startxref offset %d (%v)", xref, err)
+	}
+	lines := strings.Split(text[xref:], "\n")
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for n := 1; n < count; n++ {
+		offset, _ := strconv.Atoi(strings.Fields(lines[2+n])[0])
+		if want := fmt.Sprintf("%d 0 obj\n", n); !strings.HasPrefix(text[offset:], want) {
+			t.Errorf("Cross-reference for object %d points to %q", n, text[offset:offset+10])
+		}
+	}
+
+	bad := puzzles[0]
+	bad.Geometry = "no-such-geometry"
+	if _, err := PuzzleBookPDF("Bad", []BookPuzzle{bad}); err == nil {
+		t.Errorf("Made a booklet with an unknown geometry")
+	}
+	bad = puzzles[0]
+	bad.Solution = solution[1:]
+	if _, err := PuzzleBookPDF("Bad", []BookPuzzle{bad}); err == nil {
+		t.Errorf("Made a booklet with a short solution")
+	}
+}
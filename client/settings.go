@@ -20,11 +20,13 @@ package client
 
 import (
 	"fmt"
+	"github.com/ancientHacker/susen.go/static"
 	"html/template"
-	"io/ioutil"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 )
 
@@ -49,27 +51,47 @@ var (
 	brandName                = "Sūsen"
 	iconPath                 = "/favicon.ico"
 	reportBugPath            = "/bugreport.html"
-	defaultStaticDirectory   = "static"
-	defaultTemplateDirectory = filepath.Join(defaultStaticDirectory, "tmpl")
+	templateSubdirectory     = "tmpl"
+	defaultStaticDirectory   = "" // empty means use the embedded resources
+	defaultTemplateDirectory = "" // empty means use the embedded resources
 	staticResourcePaths      = map[string]string{
-		iconPath:      filepath.Join("special", "susen.ico"),
-		"/robots.txt": filepath.Join("special", "robots.txt"),
-		reportBugPath: filepath.Join("special", "report_bug.html"),
+		iconPath:      path.Join("special", "susen.ico"),
+		"/robots.txt": path.Join("special", "robots.txt"),
+		reportBugPath: path.Join("special", "report_bug.html"),
 	}
 )
 
+// UseResourceDirectory - serve static resources and templates
+// from the given directory on disk rather than from the copies
+// embedded in the binary.  The templates are expected in its
+// "tmpl" subdirectory.  This is meant for client development,
+// where changes should show up without a rebuild.  An empty
+// directory restores use of the embedded resources.
+func UseResourceDirectory(dir string) {
+	if dir == "" {
+		defaultStaticDirectory, defaultTemplateDirectory = "", ""
+		return
+	}
+	defaultStaticDirectory = dir
+	defaultTemplateDirectory = filepath.Join(dir, templateSubdirectory)
+}
+
 // VerifyResources - check that resources can be found, return
 // error if not.
 func VerifyResources() error {
-	if fi, err := os.Stat(findStaticDirectory()); err != nil {
-		return err
-	} else if !fi.IsDir() {
-		return fmt.Errorf("Static resource location %q not a directory.", findStaticDirectory())
+	if dir := findStaticDirectory(); dir != "" {
+		if fi, err := os.Stat(dir); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("Static resource location %q not a directory.", dir)
+		}
 	}
-	if fi, err := os.Stat(findTemplateDirectory()); err != nil {
-		return err
-	} else if !fi.IsDir() {
-		return fmt.Errorf("Template resource location %q not a directory.", findTemplateDirectory())
+	if dir := findTemplateDirectory(); dir != "" {
+		if fi, err := os.Stat(dir); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("Template resource location %q not a directory.", dir)
+		}
 	}
 	return nil
 }
@@ -87,12 +109,21 @@ func findStaticDirectory() string {
 	return defaultStaticDirectory
 }
 
+// staticFiles returns the file system that static resources are
+// served from: the static directory if one has been specified,
+// the embedded resources otherwise.
+func staticFiles() fs.FS {
+	if dir := findStaticDirectory(); dir != "" {
+		return os.DirFS(dir)
+	}
+	return static.Files
+}
+
 func StaticHandler(w http.ResponseWriter, r *http.Request) bool {
-	path, ok := staticResourcePaths[r.URL.Path]
+	fp, ok := staticResourcePaths[r.URL.Path]
 	if ok {
-		log.Printf("Serving static resource for %q", r.URL.Path)
-		fp := filepath.Join(findStaticDirectory(), path)
-		http.ServeFile(w, r, fp)
+		slog.Debug("Serving static resource", "path", r.URL.Path)
+		http.ServeFileFS(w, r, staticFiles(), fp)
 	}
 	return ok
 }
@@ -110,13 +141,26 @@ func findTemplateDirectory() string {
 	return defaultTemplateDirectory
 }
 
+// templateFiles returns the file system that templates are read
+// from: the template directory if one has been specified, the
+// embedded templates otherwise.
+func templateFiles() fs.FS {
+	if dir := findTemplateDirectory(); dir != "" {
+		return os.DirFS(dir)
+	}
+	sub, err := fs.Sub(static.Files, templateSubdirectory)
+	if err != nil {
+		panic(fmt.Errorf("Embedded templates unavailable: %v", err))
+	}
+	return sub
+}
+
 // parsePageTemplate takes an empty template, finds the template
 // Page file associated with the teamplate's name, and parses
 // that file's content into the template.
 func parsePageTemplate(tmpl *template.Template) (*template.Template, error) {
 	name := tmpl.Name()
-	fp := filepath.Join(findTemplateDirectory(), name+templatePageSuffix)
-	text, err := ioutil.ReadFile(fp)
+	text, err := fs.ReadFile(templateFiles(), name+templatePageSuffix)
 	if err != nil {
 		return nil, err
 	}
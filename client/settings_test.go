@@ -219,6 +219,60 @@ func TestStaticEnvVarOverride(t *testing.T) {
 	CoreStaticLookup(t, true)
 }
 
+func TestEmbeddedResources(t *testing.T) {
+	defer func(td, sd string) {
+		defaultTemplateDirectory = td
+		defaultStaticDirectory = sd
+	}(defaultTemplateDirectory, defaultStaticDirectory)
+	diskDirectory := defaultStaticDirectory
+	UseResourceDirectory("")
+
+	if err := VerifyResources(); err != nil {
+		t.Errorf("Couldn't verify embedded resources: %v", err)
+	}
+	for _, name := range []string{"error", "solver", "home"} {
+		if _, err := parsePageTemplate(template.New(name)); err != nil {
+			t.Errorf("Failed to load embedded %s template: %v", name, err)
+		}
+	}
+
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		if StaticHandler(w, r) {
+			return
+		}
+		http.Error(w, "No such static resource", http.StatusNotFound)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handlerFunc))
+	defer ts.Close()
+	for k, v := range staticResourcePaths {
+		r, e := http.Get(ts.URL + k)
+		if e != nil {
+			t.Fatalf("Request failure on existing key %q", k)
+		}
+		b, e := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if e != nil {
+			t.Fatalf("Couldn't read body: %v", e)
+		}
+		if r.StatusCode != http.StatusOK {
+			t.Errorf("Bad status on %q: %v %v", k, r.StatusCode, r.Status)
+		}
+		disk, e := ioutil.ReadFile(filepath.Join(diskDirectory, v))
+		if e != nil {
+			t.Fatalf("Couldn't read disk copy of %q: %v", v, e)
+		}
+		if string(b) != string(disk) {
+			t.Errorf("Embedded %q differs from disk copy", k)
+		}
+	}
+
+	UseResourceDirectory(diskDirectory)
+	if findTemplateDirectory() != filepath.Join(diskDirectory, "tmpl") {
+		t.Errorf("Template directory is %q, expected the tmpl subdirectory of %q",
+			findTemplateDirectory(), diskDirectory)
+	}
+}
+
 /*
 
 helpers
@@ -0,0 +1,210 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+)
+
+/*
+
+SVG puzzle images
+
+*/
+
+// PuzzleSVG returns an SVG image of a puzzle with the given
+// geometry and values, drawn as a square of the given size in
+// pixels.  Tiles are shaded and outlined as on the solver page.
+func PuzzleSVG(geometry string, values []int, size int) (string, error) {
+	theme, _ := LookupTheme(DefaultThemeName)
+	return ThemedPuzzleSVG(geometry, values, size, theme, nil)
+}
+
+// ThemedPuzzleSVG is like PuzzleSVG, but draws the image in the
+// given theme with the given squares (if any) highlighted.
+func ThemedPuzzleSVG(geometry string, values []int, size int, theme Theme, marks *Highlights) (string, error) {
+	return ConstrainedPuzzleSVG(geometry, values, nil, size, theme, marks)
+}
+
+// ConstrainedPuzzleSVG is like ThemedPuzzleSVG, but also draws
+// the given constraints stacked on the puzzle's geometry:
+// diagonals as dashed lines, and killer cages as dashed outlines
+// with their sums in their first squares.  The anti-knight rule
+// has nothing to draw.
+func ConstrainedPuzzleSVG(geometry string, values []int, constraints []puzzle.Constraint,
+	size int, theme Theme, marks *Highlights) (string, error) {
+	var tp templatePuzzle
+	var err error
+	if geometry == puzzle.StandardGeometryName {
+		tp, err = standardTemplatePuzzle(values)
+	} else if geometry == puzzle.RectangularGeometryName {
+		tp, err = rectangularTemplatePuzzle(values)
+	} else {
+		err = fmt.Errorf("Can't generate puzzle image for geometry %q", geometry)
+	}
+	if err != nil {
+		return "", err
+	}
+	if marks != nil {
+		for _, indices := range [][]int{marks.Errors, marks.Bindings, marks.Hints} {
+			for _, i := range indices {
+				if i < 1 || i > len(values) {
+					return "", fmt.Errorf("Can't highlight square %d of %d", i, len(values))
+				}
+			}
+		}
+	}
+
+	slen := len(tp)
+	cell := float64(size) / float64(slen)
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		size, size, size, size)
+	// cell backgrounds and values
+	fmt.Fprintf(buf, `<g font-family="sans-serif" font-size="%.1f" fill="%s" text-anchor="middle">`,
+		cell*0.6, theme.TextColor)
+	for i, row := range tp {
+		for j, c := range row {
+			fill := theme.LighterFill
+			if c.Shade == "darker" {
+				fill = theme.DarkerFill
+			}
+			if hs := marks.style(&theme, c.Index); hs != nil && hs.Fill != "" {
+				fill = hs.Fill
+			}
+			x, y := float64(j)*cell, float64(i)*cell
+			fmt.Fprintf(buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+				x, y, cell, cell, fill)
+			if v := values[c.Index-1]; v > 0 {
+				fmt.Fprintf(buf, `<text x="%.1f" y="%.1f">%d</text>`, x+cell/2, y+cell*0.75, v)
+			}
+		}
+	}
+	buf.WriteString(`</g>`)
+	// grid lines, heavier at tile boundaries
+	fmt.Fprintf(buf, `<g stroke="%s">`, theme.LineColor)
+	for k := 0; k <= slen; k++ {
+		width := theme.ThinStroke
+		if k == 0 || k == slen || tp[k%slen][0].HBorder == "top" {
+			width = theme.ThickStroke
+		}
+		pos := float64(k) * cell
+		fmt.Fprintf(buf, `<line x1="0" y1="%.1f" x2="%d" y2="%.1f" stroke-width="%g"/>`,
+			pos, size, pos, width)
+		width = theme.ThinStroke
+		if k == 0 || k == slen || tp[0][k%slen].VBorder == "left" {
+			width = theme.ThickStroke
+		}
+		fmt.Fprintf(buf, `<line x1="%.1f" y1="0" x2="%.1f" y2="%d" stroke-width="%g"/>`,
+			pos, pos, size, width)
+	}
+	buf.WriteString(`</g>`)
+	// constraints go on top of the grid
+	for _, c := range constraints {
+		if err := writeConstraintSVG(buf, c, slen, cell, &theme); err != nil {
+			return "", err
+		}
+	}
+	// highlight outlines go on top of the grid, inset so they
+	// don't cover it
+	for i, row := range tp {
+		for j, c := range row {
+			hs := marks.style(&theme, c.Index)
+			if hs == nil {
+				continue
+			}
+			inset := theme.ThickStroke/2 + hs.Width/2
+			x, y := float64(j)*cell+inset, float64(i)*cell+inset
+			fmt.Fprintf(buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="%s" stroke-width="%g"`,
+				x, y, cell-2*inset, cell-2*inset, hs.Stroke, hs.Width)
+			if hs.Dash != "" {
+				fmt.Fprintf(buf, ` stroke-dasharray="%s"`, hs.Dash)
+			}
+			buf.WriteString(`/>`)
+		}
+	}
+	buf.WriteString(`</svg>`)
+	return buf.String(), nil
+}
+
+// writeConstraintSVG draws one constraint set of a puzzle with
+// the given side length and cell size.
+func writeConstraintSVG(buf *bytes.Buffer, c puzzle.Constraint, slen int, cell float64, theme *Theme) error {
+	size := float64(slen) * cell
+	switch c.Kind {
+	case puzzle.DiagonalConstraint:
+		fmt.Fprintf(buf, `<g stroke="%s" stroke-width="%g" stroke-dasharray="4,4">`, theme.LineColor, theme.ThinStroke)
+		fmt.Fprintf(buf, `<line x1="0" y1="0" x2="%.1f" y2="%.1f"/>`, size, size)
+		fmt.Fprintf(buf, `<line x1="0" y1="%.1f" x2="%.1f" y2="0"/>`, size, size)
+		buf.WriteString(`</g>`)
+	case puzzle.AntiKnightConstraint:
+	case puzzle.KillerConstraint:
+		inset := cell * 0.08
+		fmt.Fprintf(buf, `<g stroke="%s" stroke-width="%g" stroke-dasharray="3,2">`, theme.TextColor, theme.ThinStroke)
+		for _, cage := range c.Cages {
+			in := make(map[int]bool, len(cage.Indices))
+			for _, i := range cage.Indices {
+				if i < 1 || i > slen*slen {
+					return fmt.Errorf("Can't draw cage square %d of %d", i, slen*slen)
+				}
+				in[i] = true
+			}
+			for _, i := range cage.Indices {
+				row, col := (i-1)/slen, (i-1)%slen
+				x0, y0 := float64(col)*cell+inset, float64(row)*cell+inset
+				x1, y1 := float64(col+1)*cell-inset, float64(row+1)*cell-inset
+				// an edge is drawn unless the square across it is in the cage
+				if row == 0 || !in[i-slen] {
+					fmt.Fprintf(buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, x0, y0, x1, y0)
+				}
+				if row == slen-1 || !in[i+slen] {
+					fmt.Fprintf(buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, x0, y1, x1, y1)
+				}
+				if col == 0 || !in[i-1] {
+					fmt.Fprintf(buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, x0, y0, x0, y1)
+				}
+				if col == slen-1 || !in[i+1] {
+					fmt.Fprintf(buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, x1, y0, x1, y1)
+				}
+			}
+		}
+		buf.WriteString(`</g>`)
+		fmt.Fprintf(buf, `<g font-family="sans-serif" font-size="%.1f" fill="%s">`, cell*0.2, theme.TextColor)
+		for _, cage := range c.Cages {
+			if len(cage.Indices) == 0 {
+				continue
+			}
+			first := cage.Indices[0]
+			for _, i := range cage.Indices {
+				if i < first {
+					first = i
+				}
+			}
+			row, col := (first-1)/slen, (first-1)%slen
+			fmt.Fprintf(buf, `<text x="%.1f" y="%.1f">%d</text>`,
+				float64(col)*cell+inset*1.5, float64(row)*cell+inset+cell*0.2, cage.Sum)
+		}
+		buf.WriteString(`</g>`)
+	default:
+		return fmt.Errorf("Can't draw constraint %q", c.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package client
+
+import (
+	"encoding/xml"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"testing"
+)
+
+func TestPuzzleSVG(t *testing.T) {
+	svg, err := PuzzleSVG(puzzle.StandardGeometryName, rotation4Puzzle1PartialValues, 100)
+	if err != nil {
+		t.Fatalf("Failed to draw puzzle: %v", err)
+	}
+	if err := xml.Unmarshal([]byte(svg), new(interface{})); err != nil {
+		t.Errorf("Image is not well-formed XML: %v", err)
+	}
+	if count := strings.Count(svg, "<rect "); count != 16 {
+		t.Errorf("Image has %d cells, expected 16", count)
+	}
+	if count := strings.Count(svg, "<text "); count != 8 {
+		t.Errorf("Image has %d values, expected 8", count)
+	}
+	if count := strings.Count(svg, `stroke-width="2"`); count != 6 {
+		t.Errorf("Image has %d heavy lines, expected 6", count)
+	}
+
+	if _, err := PuzzleSVG(puzzle.RectangularGeometryName, Su6Difficult1Values, 120); err != nil {
+		t.Errorf("Failed to draw rectangular puzzle: %v", err)
+	}
+	if _, err := PuzzleSVG("no-such-geometry", Su6Difficult1Values, 120); err == nil {
+		t.Errorf("Drew a puzzle with an unknown geometry")
+	}
+	if _, err := PuzzleSVG(puzzle.StandardGeometryName, Su6Difficult1Values, 120); err == nil {
+		t.Errorf("Drew a standard puzzle with a non-square side length")
+	}
+}
+
+func TestConstrainedPuzzleSVG(t *testing.T) {
+	theme, _ := LookupTheme(DefaultThemeName)
+	constraints := []puzzle.Constraint{
+		{Kind: puzzle.DiagonalConstraint},
+		{Kind: puzzle.AntiKnightConstraint},
+		{Kind: puzzle.KillerConstraint, Cages: []puzzle.Cage{{Sum: 5, Indices: []int{2, 6}}}},
+	}
+	svg, err := ConstrainedPuzzleSVG(puzzle.StandardGeometryName, rotation4Puzzle1PartialValues, constraints, 100, theme, nil)
+	if err != nil {
+		t.Fatalf("Failed to draw puzzle: %v", err)
+	}
+	if err := xml.Unmarshal([]byte(svg), new(interface{})); err != nil {
+		t.Errorf("Image is not well-formed XML: %v", err)
+	}
+	// grid lines, plus two diagonals, plus three sides of each caged square
+	if count := strings.Count(svg, "<line "); count != 10+2+6 {
+		t.Errorf("Image has %d lines, expected 18", count)
+	}
+	// values, plus the cage sum
+	if count := strings.Count(svg, "<text "); count != 8+1 {
+		t.Errorf("Image has %d texts, expected 9", count)
+	}
+
+	bad := []puzzle.Constraint{{Kind: "sandwich"}}
+	if _, err := ConstrainedPuzzleSVG(puzzle.StandardGeometryName, rotation4Puzzle1PartialValues, bad, 100, theme, nil); err == nil {
+		t.Errorf("Drew a puzzle with an unknown constraint")
+	}
+	bad = []puzzle.Constraint{{Kind: puzzle.KillerConstraint, Cages: []puzzle.Cage{{Sum: 5, Indices: []int{2, 17}}}}}
+	if _, err := ConstrainedPuzzleSVG(puzzle.StandardGeometryName, rotation4Puzzle1PartialValues, bad, 100, theme, nil); err == nil {
+		t.Errorf("Drew a cage outside the puzzle")
+	}
+}
@@ -25,7 +25,7 @@ import (
 	"github.com/ancientHacker/susen.go/storage"
 	"html/template"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 )
 
@@ -66,8 +66,8 @@ type templatePuzzleCell struct {
 
 // add solver statics to the static list
 func init() {
-	staticResourcePaths["/solver.js"] = filepath.Join("solver", "puzzle.js")
-	staticResourcePaths["/solver.css"] = filepath.Join("solver", "puzzle.css")
+	staticResourcePaths["/solver.js"] = path.Join("solver", "puzzle.js")
+	staticResourcePaths["/solver.css"] = path.Join("solver", "puzzle.css")
 }
 
 // SolverPage executes the solver page template over the passed
@@ -321,8 +321,8 @@ type templateHomePage struct {
 
 // add home statics to the static list
 func init() {
-	staticResourcePaths["/home.js"] = filepath.Join("home", "home.js")
-	staticResourcePaths["/home.css"] = filepath.Join("home", "home.css")
+	staticResourcePaths["/home.js"] = path.Join("home", "home.js")
+	staticResourcePaths["/home.css"] = path.Join("home", "home.css")
 }
 
 // HomePage executes the home page template over the passed
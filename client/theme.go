@@ -0,0 +1,173 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package client
+
+import (
+	"sort"
+)
+
+/*
+
+Image themes
+
+A theme is the palette and line weights used to draw a puzzle
+image, plus the styles used to highlight squares that are in
+error, bound by the puzzle's structure, or the subject of a hint.
+Each highlight style has its own outline dash pattern as well as
+its own colors, so highlights can be told apart without relying
+on color at all.  Besides the default theme, which matches the
+solver page, there are presets whose colors are drawn from
+palettes designed to be distinguishable with common forms of
+color blindness.
+
+*/
+
+// A Theme controls the look of a puzzle image.
+type Theme struct {
+	Name        string         `json:"name"`
+	DarkerFill  string         `json:"darkerFill"`
+	LighterFill string         `json:"lighterFill"`
+	LineColor   string         `json:"lineColor"`
+	TextColor   string         `json:"textColor"`
+	ThinStroke  float64        `json:"thinStroke"`
+	ThickStroke float64        `json:"thickStroke"`
+	Error       HighlightStyle `json:"error"`
+	Binding     HighlightStyle `json:"binding"`
+	Hint        HighlightStyle `json:"hint"`
+}
+
+// A HighlightStyle is how a highlighted square is drawn: an
+// optional fill replacing the square's shading, and an outline
+// inset within the square, with an optional SVG dash pattern.
+type HighlightStyle struct {
+	Fill   string  `json:"fill,omitempty"`
+	Stroke string  `json:"stroke"`
+	Width  float64 `json:"width"`
+	Dash   string  `json:"dash,omitempty"`
+}
+
+// Highlights are the squares (by 1-based index) to highlight in
+// a puzzle image.  A square in more than one list is drawn with
+// the first of the error, hint, and binding styles that applies.
+type Highlights struct {
+	Errors   []int `json:"errors,omitempty"`
+	Bindings []int `json:"bindings,omitempty"`
+	Hints    []int `json:"hints,omitempty"`
+}
+
+// DefaultThemeName is the name of the theme matching the
+// solver page's style sheet.
+const DefaultThemeName = "default"
+
+// the dash patterns shared by all the presets
+const (
+	errorDash   = ""
+	bindingDash = "2,2"
+	hintDash    = "6,3"
+)
+
+var themes = map[string]Theme{
+	DefaultThemeName: {
+		DarkerFill:  "#b8d1f3",
+		LighterFill: "#dce8f9",
+		LineColor:   "#4e95f4",
+		TextColor:   "#000000",
+		ThinStroke:  1,
+		ThickStroke: 2,
+		Error:       HighlightStyle{Fill: "#f4c7c3", Stroke: "#d9534f", Width: 2, Dash: errorDash},
+		Binding:     HighlightStyle{Stroke: "#5cb85c", Width: 1.5, Dash: bindingDash},
+		Hint:        HighlightStyle{Fill: "#fbe3b9", Stroke: "#f0ad4e", Width: 2, Dash: hintDash},
+	},
+	// Okabe & Ito, "Color Universal Design"
+	"okabe-ito": {
+		DarkerFill:  "#c6dbef",
+		LighterFill: "#ffffff",
+		LineColor:   "#0072b2",
+		TextColor:   "#000000",
+		ThinStroke:  1,
+		ThickStroke: 2,
+		Error:       HighlightStyle{Fill: "#f5cba7", Stroke: "#d55e00", Width: 2.5, Dash: errorDash},
+		Binding:     HighlightStyle{Stroke: "#009e73", Width: 1.5, Dash: bindingDash},
+		Hint:        HighlightStyle{Fill: "#fbe8a6", Stroke: "#e69f00", Width: 2.5, Dash: hintDash},
+	},
+	// Paul Tol's "bright" qualitative scheme
+	"tol-bright": {
+		DarkerFill:  "#d9e4f0",
+		LighterFill: "#ffffff",
+		LineColor:   "#4477aa",
+		TextColor:   "#000000",
+		ThinStroke:  1,
+		ThickStroke: 2,
+		Error:       HighlightStyle{Fill: "#f8d0d6", Stroke: "#aa3377", Width: 2.5, Dash: errorDash},
+		Binding:     HighlightStyle{Stroke: "#228833", Width: 1.5, Dash: bindingDash},
+		Hint:        HighlightStyle{Fill: "#f0ebc8", Stroke: "#ccbb44", Width: 2.5, Dash: hintDash},
+	},
+	// black and white only, for low vision and monochrome printing
+	"high-contrast": {
+		DarkerFill:  "#d9d9d9",
+		LighterFill: "#ffffff",
+		LineColor:   "#000000",
+		TextColor:   "#000000",
+		ThinStroke:  1,
+		ThickStroke: 3,
+		Error:       HighlightStyle{Fill: "#999999", Stroke: "#000000", Width: 3, Dash: errorDash},
+		Binding:     HighlightStyle{Stroke: "#000000", Width: 1.5, Dash: bindingDash},
+		Hint:        HighlightStyle{Stroke: "#000000", Width: 3, Dash: hintDash},
+	},
+}
+
+// ThemeNames returns the names of the built-in themes, sorted.
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTheme returns the built-in theme with the given name.
+// The empty name is the default theme.
+func LookupTheme(name string) (Theme, bool) {
+	if name == "" {
+		name = DefaultThemeName
+	}
+	t, ok := themes[name]
+	t.Name = name
+	return t, ok
+}
+
+// style returns the highlight style, if any, for the square with
+// the given index.
+func (h *Highlights) style(t *Theme, index int) *HighlightStyle {
+	if h == nil {
+		return nil
+	}
+	for _, styled := range []struct {
+		indices []int
+		style   *HighlightStyle
+	}{{h.Errors, &t.Error}, {h.Hints, &t.Hint}, {h.Bindings, &t.Binding}} {
+		for _, i := range styled.indices {
+			if i == index {
+				return styled.style
+			}
+		}
+	}
+	return nil
+}
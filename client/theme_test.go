@@ -0,0 +1,90 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package client
+
+import (
+	"encoding/xml"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestThemes(t *testing.T) {
+	names := ThemeNames()
+	if len(names) < 3 || names[0] > names[len(names)-1] {
+		t.Errorf("Unexpected theme names: %v", names)
+	}
+	for _, name := range names {
+		theme, ok := LookupTheme(name)
+		if !ok || theme.Name != name {
+			t.Errorf("Lookup of theme %q gave %+v, %v", name, theme, ok)
+		}
+		// the highlights must be distinguishable without color
+		styles := []HighlightStyle{theme.Error, theme.Binding, theme.Hint}
+		for i := range styles {
+			for j := i + 1; j < len(styles); j++ {
+				if styles[i].Dash == styles[j].Dash {
+					t.Errorf("Theme %q has highlights %d and %d with the same dash pattern", name, i, j)
+				}
+			}
+		}
+	}
+	if theme, ok := LookupTheme(""); !ok || theme.Name != DefaultThemeName {
+		t.Errorf("Lookup of empty theme name gave %+v, %v", theme, ok)
+	}
+	if _, ok := LookupTheme("no-such-theme"); ok {
+		t.Errorf("Found a theme that doesn't exist")
+	}
+}
+
+func TestThemedPuzzleSVG(t *testing.T) {
+	theme, _ := LookupTheme("high-contrast")
+	marks := &Highlights{Errors: []int{1}, Bindings: []int{1, 6}, Hints: []int{16}}
+	svg, err := ThemedPuzzleSVG(puzzle.StandardGeometryName, rotation4Puzzle1PartialValues, 100, theme, marks)
+	if err != nil {
+		t.Fatalf("Failed to draw puzzle: %v", err)
+	}
+	if err := xml.Unmarshal([]byte(svg), new(interface{})); err != nil {
+		t.Errorf("Image is not well-formed XML: %v", err)
+	}
+	// one rect per cell, plus one outline per highlighted square
+	if count := strings.Count(svg, "<rect "); count != 16+3 {
+		t.Errorf("Image has %d rects, expected 19", count)
+	}
+	if count := strings.Count(svg, `stroke-width="3"`); count != 6+2 {
+		t.Errorf("Image has %d heavy strokes, expected 8", count)
+	}
+	if count := strings.Count(svg, `stroke-dasharray="2,2"`); count != 1 {
+		t.Errorf("Image has %d binding outlines, expected 1", count)
+	}
+	if count := strings.Count(svg, `stroke-dasharray="6,3"`); count != 1 {
+		t.Errorf("Image has %d hint outlines, expected 1", count)
+	}
+	// the first square is an error, so it takes the error fill
+	first := regexp.MustCompile(`<rect x="0.0" y="0.0" [^>]*fill="([^"]*)"`).FindStringSubmatch(svg)
+	if first == nil || first[1] != theme.Error.Fill {
+		t.Errorf("First square is drawn as %v, expected fill %q", first, theme.Error.Fill)
+	}
+
+	marks = &Highlights{Hints: []int{17}}
+	if _, err := ThemedPuzzleSVG(puzzle.StandardGeometryName, rotation4Puzzle1PartialValues, 100, theme, marks); err == nil {
+		t.Errorf("Highlighted a square outside the puzzle")
+	}
+}
@@ -16,19 +16,26 @@
 // 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
 // Licensed under the LGPL v3.  See the LICENSE file for details
 
-// Clear and re-initialize the susen storage system
+// Clear and re-initialize the susen storage system, back it up
+// and restore it, or upgrade the puzzle summaries it caches
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ancientHacker/susen.go/dbprep"
+	"github.com/ancientHacker/susen.go/storage"
 	"log"
+	"os"
 )
 
 var (
 	clear      = flag.Bool("clear", false, "Clear but don't reload the data")
 	initialize = flag.Bool("initialize", false, "Initialize but don't clear the data")
+	backup     = flag.String("backup", "", "Write a backup of all the data to this file, and change nothing")
+	restore    = flag.String("restore", "", "Initialize, then replace all the data with the backup in this file")
+	upgrade    = flag.Bool("upgrade", false, "Upgrade cached puzzle summaries to the current schema, and change nothing else")
 )
 
 func main() {
@@ -43,6 +50,15 @@ func main() {
 }
 
 func doit() error {
+	if *backup != "" {
+		return doBackup(*backup)
+	}
+	if *restore != "" {
+		return doRestore(*restore)
+	}
+	if *upgrade {
+		return doUpgrade()
+	}
 	log.Printf("Removing existing data storage and cache...")
 	if err := dbprep.ClearCache(); err != nil {
 		return fmt.Errorf("Couldn't clear cache: %v", err)
@@ -61,3 +77,65 @@ func doit() error {
 	log.Printf("Done.")
 	return nil
 }
+
+// doBackup writes a backup of the stored data to the named file.
+func doBackup(name string) error {
+	if _, _, err := storage.Connect(); err != nil {
+		return fmt.Errorf("Couldn't connect to storage: %v", err)
+	}
+	defer storage.Close()
+	log.Printf("Backing up data storage to %s...", name)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(storage.MakeBackup()); err != nil {
+		f.Close()
+		return fmt.Errorf("Couldn't write backup: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Done.")
+	return nil
+}
+
+// doRestore replaces the stored data with the backup in the named
+// file.  The schema is brought up to date first, so the backup
+// must be from a server with the same migrations.
+func doRestore(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var b storage.Backup
+	if err := json.NewDecoder(f).Decode(&b); err != nil {
+		return fmt.Errorf("Couldn't read backup: %v", err)
+	}
+	if _, _, err := storage.Connect(); err != nil {
+		return fmt.Errorf("Couldn't connect to storage: %v", err)
+	}
+	defer storage.Close()
+	log.Printf("Restoring data storage from %s...", name)
+	count, err := storage.RestoreBackup(&b)
+	if err != nil {
+		return fmt.Errorf("Couldn't restore backup: %v", err)
+	}
+	log.Printf("Restored %d rows.  Done.", count)
+	return nil
+}
+
+// doUpgrade rewrites the cached puzzle summaries from older
+// releases at the current schema.
+func doUpgrade() error {
+	if _, _, err := storage.Connect(); err != nil {
+		return fmt.Errorf("Couldn't connect to storage: %v", err)
+	}
+	defer storage.Close()
+	log.Printf("Upgrading cached puzzle summaries...")
+	r := storage.UpgradeSummaries()
+	log.Printf("Upgraded %d of %d summaries in %d step lists (%d dropped, %d busy).  Done.",
+		r.Upgraded, r.Steps, r.Lists, r.Dropped, r.Busy)
+	return nil
+}
@@ -19,6 +19,7 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -39,3 +40,28 @@ func TestDoit(t *testing.T) {
 		t.Errorf("Failed to initialize after clear: %v", err)
 	}
 }
+
+func TestBackupRestore(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "..", "dbprep"))
+	dir, err := ioutil.TempDir("", "susen-backup")
+	if err != nil {
+		t.Fatalf("Couldn't make a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "backup.json")
+	if err := doBackup(name); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if err := doRestore(name); err != nil {
+		t.Errorf("Failed to restore: %v", err)
+	}
+	if err := doRestore(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Restored from a missing file")
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	if err := doUpgrade(); err != nil {
+		t.Errorf("Failed to upgrade: %v", err)
+	}
+}
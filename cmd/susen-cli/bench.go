@@ -0,0 +1,212 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+	"io"
+	"math/rand"
+	"regexp"
+	"runtime"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+
+benchmarks
+
+The bench subcommand runs a fixed set of workloads against the
+puzzle engine and reports how long each operation takes and how
+much it allocates, so results from different releases (or
+machines) can be compared.  The workloads use fixed puzzles and
+random seeds, so they do the same work every time.
+
+*/
+
+// benchPuzzles are well-known hard puzzles, each with a unique
+// solution.
+var benchPuzzles = []struct{ name, values string }{
+	{"escargot", "1....7.9..3..2...8..96..5....53..9...1..8...26....4...3......1..4......7..7...3.."},
+	{"inkala", "8..........36......7..9.2...5...7.......457.....1...3...1....68..85...1..9....4.."},
+	{"norvig", "4.....8.5.3..........7......2.....6.....8.4......1.......6.3.7.5..2.....1.4......"},
+}
+
+// A workload is a benchmark.  Its setup returns the operation to
+// time, which is run repeatedly.
+type workload struct {
+	name  string
+	setup func() (func() error, error)
+}
+
+// benchWorkloads returns the standard workloads.
+func benchWorkloads() []workload {
+	sample, _ := parseValues(benchSample)
+	workloads := []workload{
+		{"create", func() (func() error, error) {
+			return func() error {
+				_, err := puzzle.New(sample)
+				return err
+			}, nil
+		}},
+		{"assign", func() (func() error, error) {
+			// fill the sample puzzle from its solution, then roll back
+			p, err := puzzle.New(sample)
+			if err != nil {
+				return nil, err
+			}
+			solutions, err := p.Solutions()
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				token, err := p.Checkpoint()
+				if err != nil {
+					return err
+				}
+				for i, v := range sample.Values {
+					if v == 0 {
+						if _, err := p.Assign(puzzle.Choice{Index: i + 1, Value: solutions[0].Values[i]}); err != nil {
+							return err
+						}
+					}
+				}
+				_, err = p.Rollback(token)
+				return err
+			}, nil
+		}},
+	}
+	for _, bp := range benchPuzzles {
+		summary, err := parseValues(bp.values)
+		workloads = append(workloads, workload{"solve/" + bp.name, func() (func() error, error) {
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				p, err := puzzle.New(summary)
+				if err != nil {
+					return err
+				}
+				_, err = p.Solutions()
+				return err
+			}, nil
+		}})
+	}
+	workloads = append(workloads, workload{"generate", func() (func() error, error) {
+		rng := rand.New(rand.NewSource(1))
+		return func() error {
+			_, err := generate(puzzle.StandardGeometryName, 9, generator.Options{}, rng.Int63())
+			return err
+		}, nil
+	}})
+	return workloads
+}
+
+// benchSample is the puzzle the create and assign workloads use.
+const benchSample = "......5..4..2.7..1...1..26.38...........32.1...7..54..7564..13...9.....6.......9."
+
+// A benchResult reports the cost of a workload's operation.
+type benchResult struct {
+	Name        string  `json:"name"`
+	Ops         int     `json:"ops"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+}
+
+// A benchReport is the JSON form of a bench run, including
+// where it ran.
+type benchReport struct {
+	Go      string         `json:"go"`
+	OS      string         `json:"os"`
+	Arch    string         `json:"arch"`
+	CPUs    int            `json:"cpus"`
+	Results []*benchResult `json:"results"`
+}
+
+// runWorkload runs the workload's operation for at least the
+// given duration (and at least once).
+func runWorkload(w workload, duration time.Duration) (*benchResult, error) {
+	op, err := w.setup()
+	if err != nil {
+		return nil, err
+	}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	ops := 0
+	for ops == 0 || time.Since(start) < duration {
+		if err := op(); err != nil {
+			return nil, err
+		}
+		ops++
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return &benchResult{
+		Name:        w.name,
+		Ops:         ops,
+		NsPerOp:     float64(elapsed.Nanoseconds()) / float64(ops),
+		AllocsPerOp: float64(after.Mallocs-before.Mallocs) / float64(ops),
+		BytesPerOp:  float64(after.TotalAlloc-before.TotalAlloc) / float64(ops),
+	}, nil
+}
+
+func benchCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("bench", "")
+	duration := fs.Duration("time", time.Second, "how long to run each workload")
+	run := fs.String("run", "", "regular expression selecting the workloads to run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("bench takes no arguments")
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return err
+	}
+	report := benchReport{runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), []*benchResult{}}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	if !jsonOutput {
+		fmt.Fprintf(out, "%s %s/%s, %d CPUs\n", report.Go, report.OS, report.Arch, report.CPUs)
+		fmt.Fprintf(tw, "workload\tops\tns/op\tallocs/op\tbytes/op\t\n")
+	}
+	for _, w := range benchWorkloads() {
+		if !filter.MatchString(w.name) {
+			continue
+		}
+		r, err := runWorkload(w, *duration)
+		if err != nil {
+			return fmt.Errorf("%s: %v", w.name, err)
+		}
+		report.Results = append(report.Results, r)
+		if !jsonOutput {
+			fmt.Fprintf(tw, "%s\t%d\t%.0f\t%.1f\t%.0f\t\n", r.Name, r.Ops, r.NsPerOp, r.AllocsPerOp, r.BytesPerOp)
+		}
+	}
+	if jsonOutput {
+		return writeJSONLine(out, report)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,60 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBenchPuzzles(t *testing.T) {
+	for _, bp := range benchPuzzles {
+		s, err := parseValues(bp.values)
+		if err != nil {
+			t.Fatalf("%s: %v", bp.name, err)
+		}
+		if unique, err := hasUniqueSolution(s); err != nil || !unique {
+			t.Errorf("%s doesn't have a unique solution (%v)", bp.name, err)
+		}
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	out, err := runSubcommand(t, "", "bench", "-time", "1ms", "-run", "create|assign|norvig")
+	if err != nil {
+		t.Fatalf("Bench failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[1], "workload") || !strings.HasPrefix(lines[4], "solve/norvig") {
+		t.Errorf("Got %q", out)
+	}
+
+	out, err = runSubcommand(t, "", "bench", "-json", "-time", "1ms", "-run", "^create$")
+	var report benchReport
+	if err != nil || json.Unmarshal([]byte(out), &report) != nil || len(report.Results) != 1 {
+		t.Fatalf("Got %q, %v", out, err)
+	}
+	if r := report.Results[0]; r.Name != "create" || r.Ops < 1 || r.NsPerOp <= 0 || r.AllocsPerOp <= 0 {
+		t.Errorf("Got result %+v", r)
+	}
+	if _, err := runSubcommand(t, "", "bench", "-run", "("); err == nil {
+		t.Errorf("No error for a bad workload pattern")
+	}
+}
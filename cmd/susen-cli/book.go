@@ -0,0 +1,151 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/client"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+printable booklets
+
+The book subcommand generates puzzles in a range of difficulty
+and prints them to a PDF booklet, with a solutions appendix.
+Difficulties are given by name or by number on the solver's
+1-5 rating scale, either singly (hard) or as a range
+(easy..hard).
+
+*/
+
+// difficultyNames are the names of the ratings, from 1 up.
+var difficultyNames = []string{"easy", "medium", "hard", "expert", "extreme"}
+
+// parseDifficulty parses a difficulty or range of difficulties
+// into the lowest and highest acceptable ratings.
+func parseDifficulty(s string) (int, int, error) {
+	parse := func(name string) (int, error) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for i, dn := range difficultyNames {
+			if name == dn {
+				return i + 1, nil
+			}
+		}
+		if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(difficultyNames) {
+			return n, nil
+		}
+		return 0, fmt.Errorf("unknown difficulty %q (use 1-%d or one of %s)",
+			name, len(difficultyNames), strings.Join(difficultyNames, ", "))
+	}
+	lo, hi, isRange := strings.Cut(s, "..")
+	min, err := parse(lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	max := min
+	if isRange {
+		if max, err = parse(hi); err != nil {
+			return 0, 0, err
+		}
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("difficulty range %q is backwards", s)
+	}
+	return min, max, nil
+}
+
+// A bookReport is the JSON form of what went into a booklet.
+type bookReport struct {
+	Out     string              `json:"out"`
+	Puzzles []client.BookPuzzle `json:"puzzles"`
+}
+
+func bookCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("book", "")
+	count := fs.Int("count", 50, "number of puzzles")
+	difficulty := fs.String("difficulty", "easy..hard", "difficulty or range of difficulties (e.g., easy..hard or 1..3)")
+	geometry := fs.String("geometry", "", "puzzle geometry (square or rectangular; default by size)")
+	side := fs.Int("size", 9, "puzzle side length")
+	seed := fs.Int64("seed", 0, "random seed (0 for a seed based on the time)")
+	title := fs.String("title", "Susen Puzzles", "booklet title")
+	outName := fs.String("out", "book.pdf", "output file (- for the standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("book takes no arguments")
+	}
+	min, max, err := parseDifficulty(*difficulty)
+	if err != nil {
+		return err
+	}
+	if jsonOutput && *outName == "-" {
+		return fmt.Errorf("the booklet can't go to the standard output with JSON output")
+	}
+	if *count < 1 {
+		return fmt.Errorf("count must be positive")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+
+	opts := generator.Options{Easiest: generator.Level(min), Hardest: generator.Level(max)}
+	puzzles := make([]client.BookPuzzle, 0, *count)
+	for i := 1; i <= *count; i++ {
+		summary, err := generate(*geometry, *side, opts, rng.Int63())
+		if err != nil {
+			return err
+		}
+		solution, err := firstSolution(summary)
+		if err != nil {
+			return err
+		}
+		puzzles = append(puzzles, client.BookPuzzle{
+			Title:    fmt.Sprintf("Puzzle %d (%s)", i, difficultyNames[solution.Rating-1]),
+			Geometry: summary.Geometry,
+			Values:   summary.Values,
+			Solution: solution.Values,
+		})
+	}
+	pdf, err := client.PuzzleBookPDF(*title, puzzles)
+	if err != nil {
+		return err
+	}
+	if *outName == "-" {
+		_, err = out.Write(pdf)
+		return err
+	}
+	if err := os.WriteFile(*outName, pdf, 0644); err != nil {
+		return err
+	}
+	if jsonOutput {
+		return writeJSONLine(out, bookReport{*outName, puzzles})
+	}
+	return nil
+}
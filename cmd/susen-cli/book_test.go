@@ -0,0 +1,71 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDifficulty(t *testing.T) {
+	testcases := []struct {
+		in       string
+		min, max int
+	}{
+		{"easy", 1, 1},
+		{"easy..hard", 1, 3},
+		{"Medium..5", 2, 5},
+		{"4", 4, 4},
+	}
+	for _, tc := range testcases {
+		if min, max, err := parseDifficulty(tc.in); err != nil || min != tc.min || max != tc.max {
+			t.Errorf("%q: got %d, %d, %v; expected %d, %d", tc.in, min, max, err, tc.min, tc.max)
+		}
+	}
+	for _, bad := range []string{"", "trivial", "0", "6", "hard..easy", "easy.."} {
+		if _, _, err := parseDifficulty(bad); err == nil {
+			t.Errorf("%q: parsed a bad difficulty", bad)
+		}
+	}
+}
+
+func TestBookCommand(t *testing.T) {
+	out, err := runSubcommand(t, "", "book", "-count", "3", "-size", "4", "-difficulty", "easy", "-seed", "1", "-out", "-")
+	if err != nil {
+		t.Fatalf("Failed to make booklet: %v", err)
+	}
+	if !strings.HasPrefix(out, "%PDF-") {
+		t.Errorf("Booklet isn't a PDF file")
+	}
+	// two pages of puzzles and one of solutions
+	if !strings.Contains(out, "/Count 3 ") {
+		t.Errorf("Booklet doesn't have 3 pages")
+	}
+	for _, title := range []string{"(Puzzle 1 (easy))", "(Puzzle 3 (easy))", "(Solutions)"} {
+		if !strings.Contains(out, strings.NewReplacer(" (", ` \(`, "))", `\))`).Replace(title)) {
+			t.Errorf("Booklet doesn't have %s", title)
+		}
+	}
+	if _, err := runSubcommand(t, "", "book", "-difficulty", "trivial", "-out", "-"); err == nil {
+		t.Errorf("Made a booklet with a bad difficulty")
+	}
+	if _, err := runSubcommand(t, "", "book", "-count", "0", "-out", "-"); err == nil {
+		t.Errorf("Made a booklet with no puzzles")
+	}
+}
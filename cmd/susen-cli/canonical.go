@@ -0,0 +1,274 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"slices"
+)
+
+/*
+
+canonical forms
+
+Two puzzles are isomorphic if one can be turned into the other
+by changes that don't affect how it's solved: relabeling the
+values, permuting the bands of tiles (or the rows within a band),
+permuting the stacks of tiles (or the columns within a stack),
+and, if the tiles are square, transposing the grid.
+
+The canonical form of a puzzle is the smallest of its isomorphs
+(compared square by square, with empty squares smallest), with
+values relabeled in the order they first appear.  Isomorphic
+puzzles have the same canonical form.  It's found by trying
+every arrangement of the columns, and for each one searching the
+arrangements of the rows, abandoning any that start out larger
+than the smallest found so far.  Puzzles with too many column
+arrangements to try are only canonicalized by relabeling.
+
+Rearranging rows and columns moves squares on and off diagonals,
+knight's moves, and cages, so puzzles with constraints are only
+canonicalized by relabeling, and puzzles with killer cages (whose
+sums depend on the values) aren't canonicalized at all.
+
+*/
+
+// maxColumnArrangements limits the column arrangements tried in
+// finding a canonical form.  It allows 9x9 puzzles (with 1296).
+var maxColumnArrangements = 10000
+
+// tileShape returns the height and width of a puzzle's tiles.
+func tileShape(summary *puzzle.Summary) (int, int, error) {
+	side := summary.SideLength
+	switch summary.Geometry {
+	case puzzle.StandardGeometryName:
+		if t := isqrt(side); t*t == side {
+			return t, t, nil
+		}
+	case puzzle.RectangularGeometryName:
+		for h := 1; h*(h+1) <= side; h++ {
+			if h*(h+1) == side {
+				return h, h + 1, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("no tiles for %s puzzles of side %d", summary.Geometry, side)
+}
+
+// canonicalValues returns the canonical form of a puzzle's values.
+func canonicalValues(summary *puzzle.Summary) ([]int, error) {
+	height, width, err := tileShape(summary)
+	if err != nil {
+		return nil, err
+	}
+	side := summary.SideLength
+	if len(summary.Values) != side*side {
+		return nil, fmt.Errorf("%d values don't fill a puzzle of side %d", len(summary.Values), side)
+	}
+	for _, v := range summary.Values {
+		if v < 0 || v > side {
+			return nil, fmt.Errorf("%d is not a value in a puzzle of side %d", v, side)
+		}
+	}
+	for _, c := range summary.Constraints {
+		if len(c.Cages) > 0 {
+			return slices.Clone(summary.Values), nil
+		}
+	}
+	if len(summary.Constraints) > 0 {
+		return relabel(summary.Values, side), nil
+	}
+	grid := make([][]int, side)
+	for r := range grid {
+		grid[r] = summary.Values[r*side : (r+1)*side]
+	}
+	columns := arrangements(side/width, width, maxColumnArrangements)
+	if columns == nil {
+		return relabel(summary.Values, side), nil
+	}
+	c := &canonicalizer{side: side, height: height, best: make([][]int, side),
+		rowUsed: make([]bool, side), bandUsed: make([]bool, side/height)}
+	for r := range c.best {
+		c.best[r] = make([]int, side)
+	}
+	grids := [][][]int{grid}
+	if height == width {
+		transposed := make([][]int, side)
+		for r := range transposed {
+			transposed[r] = make([]int, side)
+			for col := range transposed[r] {
+				transposed[r][col] = grid[col][r]
+			}
+		}
+		grids = append(grids, transposed)
+	}
+	for _, g := range grids {
+		c.grid = g
+		for _, c.columns = range columns {
+			c.search(0, 0, make([]int, side+1), 0)
+		}
+	}
+	values := make([]int, 0, side*side)
+	for _, row := range c.best {
+		values = append(values, row...)
+	}
+	return values, nil
+}
+
+// relabel returns the values of a puzzle with the given side
+// length, relabeled in order of first appearance.
+func relabel(values []int, side int) []int {
+	labels := make([]int, side+1)
+	next := 0
+	result := make([]int, len(values))
+	for i, v := range values {
+		if v != 0 && labels[v] == 0 {
+			next++
+			labels[v] = next
+		}
+		result[i] = labels[v]
+	}
+	return result
+}
+
+// arrangements returns every order of count groups of size
+// items, where the groups can be permuted and the items in each
+// group permuted.  Each order lists the items by their original
+// position.  If there are more than limit orders, it returns nil.
+func arrangements(count, size, limit int) [][]int {
+	total := factorial(count)
+	for i := 0; i < count; i++ {
+		if total *= factorial(size); total > limit {
+			return nil
+		}
+	}
+	var result [][]int
+	var build func(order []int, groups []int)
+	build = func(order []int, groups []int) {
+		if len(order) == count*size {
+			result = append(result, append([]int(nil), order...))
+			return
+		}
+		if len(order)%size == 0 {
+			// start the next group with any item of an unused group
+			for _, g := range groups {
+				rest := make([]int, 0, len(groups)-1)
+				for _, other := range groups {
+					if other != g {
+						rest = append(rest, other)
+					}
+				}
+				for i := 0; i < size; i++ {
+					build(append(order, g*size+i), rest)
+				}
+			}
+			return
+		}
+		// continue the group with an item not yet in the order
+		start := order[len(order)-1] / size * size
+		for item := start; item < start+size; item++ {
+			if !slices.Contains(order[len(order)-len(order)%size:], item) {
+				build(append(order, item), groups)
+			}
+		}
+	}
+	groups := make([]int, count)
+	for i := range groups {
+		groups[i] = i
+	}
+	build(make([]int, 0, count*size), groups)
+	return result
+}
+
+// factorial returns n!.
+func factorial(n int) int {
+	f := 1
+	for i := 2; i <= n; i++ {
+		f *= i
+	}
+	return f
+}
+
+// A canonicalizer searches for the smallest arrangement of the
+// rows of a grid with its columns in a given order.  Rows of the
+// best arrangement past the known ones aren't filled in yet, and
+// count as larger than any row.  Whenever the search finds a row
+// that's smaller than the best one, it replaces it, so the rows
+// it has arranged are always the same as the best ones.
+type canonicalizer struct {
+	side, height int
+	grid         [][]int // the grid being arranged
+	columns      []int   // the order of its columns
+	rowUsed      []bool  // which rows have been arranged
+	bandUsed     []bool  // which bands have been started
+	best         [][]int // the smallest arrangement found
+	known        int     // how many rows of best are filled in
+}
+
+// search tries each row that can come next in the arrangement,
+// given the band of the row before and the labels assigned so
+// far (and the count of them).  The first row of a band can come
+// from any band that hasn't been started, and the others from the
+// same band.
+func (c *canonicalizer) search(depth, band int, labels []int, next int) {
+	if depth == c.side {
+		return
+	}
+	start, end := band, band+c.height
+	if depth%c.height == 0 {
+		start, end = 0, c.side
+	}
+	row := make([]int, c.side)
+	rowLabels := make([]int, len(labels))
+	for r := start; r < end; r++ {
+		if c.rowUsed[r] || (depth%c.height == 0 && c.bandUsed[r/c.height]) {
+			continue
+		}
+		copy(rowLabels, labels)
+		rowNext, smaller, larger := next, depth >= c.known, false
+		for i, col := range c.columns {
+			v := c.grid[r][col]
+			if v != 0 && rowLabels[v] == 0 {
+				rowNext++
+				rowLabels[v] = rowNext
+			}
+			row[i] = rowLabels[v]
+			if !smaller {
+				if row[i] < c.best[depth][i] {
+					smaller = true
+				} else if row[i] > c.best[depth][i] {
+					larger = true
+					break
+				}
+			}
+		}
+		if larger {
+			continue
+		}
+		if smaller {
+			copy(c.best[depth], row)
+			c.known = depth + 1
+		}
+		started := c.bandUsed[r/c.height]
+		c.rowUsed[r], c.bandUsed[r/c.height] = true, true
+		c.search(depth+1, r-r%c.height, rowLabels, rowNext)
+		c.rowUsed[r], c.bandUsed[r/c.height] = false, started
+	}
+}
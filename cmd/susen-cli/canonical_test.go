@@ -0,0 +1,186 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// transform applies an isomorphism to a puzzle's values: the
+// relabeling, then the row order and column order, then
+// (optionally) transposition.
+func transform(values []int, side int, labels, rows, cols []int, transpose bool) []int {
+	result := make([]int, len(values))
+	for r := 0; r < side; r++ {
+		for c := 0; c < side; c++ {
+			v := values[rows[r]*side+cols[c]]
+			if v != 0 {
+				v = labels[v]
+			}
+			if transpose {
+				result[c*side+r] = v
+			} else {
+				result[r*side+c] = v
+			}
+		}
+	}
+	return result
+}
+
+func TestArrangements(t *testing.T) {
+	orders := arrangements(3, 3, 10000)
+	if len(orders) != 1296 {
+		t.Fatalf("Got %d arrangements of 9, expected 1296", len(orders))
+	}
+	seen := make(map[string]bool)
+	for _, o := range orders {
+		key, _ := formatValues(o)
+		seen[key] = true
+		for i := 0; i < 9; i += 3 {
+			if o[i]/3 != o[i+1]/3 || o[i]/3 != o[i+2]/3 {
+				t.Fatalf("Arrangement %v breaks up a group", o)
+			}
+		}
+	}
+	if len(seen) != 1296 {
+		t.Errorf("Got %d distinct arrangements, expected 1296", len(seen))
+	}
+	if orders := arrangements(4, 4, 10000); orders != nil {
+		t.Errorf("Got %d arrangements of 16 with a limit of 10000", len(orders))
+	}
+}
+
+func TestCanonicalValues(t *testing.T) {
+	s, err := parseValues(testPuzzleSDM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canon, err := canonicalValues(s)
+	if err != nil {
+		t.Fatalf("Canonicalization failed: %v", err)
+	}
+	labels := []int{0, 3, 1, 2, 9, 8, 7, 4, 5, 6}
+	rows := []int{7, 6, 8, 1, 0, 2, 3, 5, 4}
+	cols := []int{5, 3, 4, 0, 2, 1, 8, 6, 7}
+	for _, transpose := range []bool{false, true} {
+		iso := &puzzle.Summary{Geometry: s.Geometry, SideLength: 9,
+			Values: transform(s.Values, 9, labels, rows, cols, transpose)}
+		if slices.Equal(iso.Values, s.Values) {
+			t.Fatalf("Transformation didn't change the puzzle")
+		}
+		if got, err := canonicalValues(iso); err != nil || !slices.Equal(got, canon) {
+			t.Errorf("Isomorph (transposed %v) has canonical form %v, expected %v", transpose, got, canon)
+		}
+	}
+	again, err := canonicalValues(&puzzle.Summary{Geometry: s.Geometry, SideLength: 9, Values: canon})
+	if err != nil || !slices.Equal(again, canon) {
+		t.Errorf("Canonical form isn't canonical: %v", again)
+	}
+	other, _ := parseValues(testSolutionSDM)
+	if got, _ := canonicalValues(other); slices.Equal(got, canon) {
+		t.Errorf("Different puzzles have the same canonical form")
+	}
+
+	// rectangular puzzles can't be transposed
+	rect, _ := parseValues("1.....23...." + "...4..56...." + "..........1.")
+	if got, err := canonicalValues(rect); err != nil || len(got) != 36 {
+		t.Errorf("Rectangular canonicalization gave %v, %v", got, err)
+	}
+
+	// constrained puzzles are only relabeled, and caged ones not at all
+	diag := []puzzle.Constraint{{Kind: puzzle.DiagonalConstraint}}
+	iso := &puzzle.Summary{Geometry: s.Geometry, SideLength: 9, Constraints: diag,
+		Values: transform(s.Values, 9, labels, rows, cols, false)}
+	if got, err := canonicalValues(iso); err != nil || !slices.Equal(got, relabel(iso.Values, 9)) {
+		t.Errorf("Diagonal canonicalization gave %v, %v", got, err)
+	}
+	killer := []puzzle.Constraint{{Kind: puzzle.KillerConstraint, Cages: []puzzle.Cage{{Sum: 3, Indices: []int{1, 2}}}}}
+	iso.Constraints = killer
+	if got, err := canonicalValues(iso); err != nil || !slices.Equal(got, iso.Values) {
+		t.Errorf("Killer canonicalization gave %v, %v", got, err)
+	}
+	for _, bad := range []*puzzle.Summary{
+		{Geometry: puzzle.StandardGeometryName, SideLength: 4, Values: make([]int, 15)},
+		{Geometry: puzzle.StandardGeometryName, SideLength: 4, Values: append(make([]int, 15), 5)},
+		{Geometry: "other", SideLength: 4, Values: make([]int, 16)},
+	} {
+		if _, err := canonicalValues(bad); err == nil {
+			t.Errorf("Canonicalized bad puzzle %+v", bad)
+		}
+	}
+}
+
+// bruteCanonical finds the canonical form by trying every
+// arrangement of rows and columns.
+func bruteCanonical(s *puzzle.Summary, height, width int) []int {
+	side := s.SideLength
+	identity := make([]int, side+1)
+	for i := range identity {
+		identity[i] = i
+	}
+	var best []int
+	for _, transpose := range []bool{false, true} {
+		if transpose && height != width {
+			continue
+		}
+		for _, rows := range arrangements(side/height, height, 1e6) {
+			for _, cols := range arrangements(side/width, width, 1e6) {
+				values := transform(s.Values, side, identity, rows, cols, false)
+				if transpose {
+					values = transform(s.Values, side, identity, cols, rows, true)
+				}
+				values = relabel(values, side)
+				if best == nil || slices.Compare(values, best) < 0 {
+					best = values
+				}
+			}
+		}
+	}
+	return best
+}
+
+func TestCanonicalValuesExhaustively(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, side := range []int{4, 6} {
+		height, width, _ := tileShape(&puzzle.Summary{Geometry: geometryFor(side), SideLength: side})
+		for i := 0; i < 20; i++ {
+			values := make([]int, side*side)
+			for j := range values {
+				if rng.Intn(3) == 0 {
+					values[j] = 1 + rng.Intn(side)
+				}
+			}
+			s := &puzzle.Summary{Geometry: geometryFor(side), SideLength: side, Values: values}
+			got, err := canonicalValues(s)
+			if expect := bruteCanonical(s, height, width); err != nil || !slices.Equal(got, expect) {
+				t.Fatalf("Side %d case %d: got %v, %v; expected %v", side, i, got, err, expect)
+			}
+		}
+	}
+}
+
+func BenchmarkCanonicalValues(b *testing.B) {
+	s, _ := parseValues(testPuzzleSDM)
+	for i := 0; i < b.N; i++ {
+		canonicalValues(s)
+	}
+}
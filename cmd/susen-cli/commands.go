@@ -0,0 +1,288 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+/*
+
+subcommands
+
+Given a subcommand, the CLI works on puzzles in files (or the
+standard input) without connecting to storage:
+
+	solve     solve puzzles
+	generate  generate puzzles with unique solutions
+	rate      rate the difficulty of puzzles
+	convert   convert puzzles between formats
+	dedupe    find duplicate puzzles
+	minimize  remove the clues puzzles don't need
+	verify    check puzzles against their claimed solutions
+	hint      walk through the next logical steps
+	bench     time the puzzle engine on standard workloads
+	play      play a puzzle in the terminal
+	book      print generated puzzles to a PDF booklet
+
+Without one, it runs an interactive session on stored puzzles.
+
+*/
+
+// subcommand dispatching
+type subcommandInfo struct {
+	name        string
+	description string
+	run         func(args []string, in io.Reader, out io.Writer) error
+}
+
+var subcommands []subcommandInfo
+
+func init() {
+	subcommands = []subcommandInfo{
+		{"solve", "solve puzzles", solveCommand},
+		{"generate", "generate puzzles with unique solutions", generateCommand},
+		{"rate", "rate the difficulty of puzzles", rateCommand},
+		{"convert", "convert puzzles between formats", convertCommand},
+		{"dedupe", "find duplicate puzzles", dedupeCommand},
+		{"minimize", "remove the clues puzzles don't need", minimizeCommand},
+		{"verify", "check puzzles against their claimed solutions", verifyCommand},
+		{"hint", "walk through the next logical steps", hintCommand},
+		{"bench", "time the puzzle engine on standard workloads", benchCommand},
+		{"play", "play a puzzle in the terminal", playCommand},
+		{"book", "print generated puzzles to a PDF booklet", bookCommand},
+	}
+}
+
+// findSubcommand returns the named subcommand, or nil if there's
+// no such subcommand.
+func findSubcommand(name string) *subcommandInfo {
+	for i := range subcommands {
+		if subcommands[i].name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// subcommandUsage describes the subcommands.
+func subcommandUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: susen-cli [-json] [subcommand [flags] [file ...]]\nSubcommands:\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(w, "    %-10s%s\n", sc.name, sc.description)
+	}
+	fmt.Fprintf(w, "With no subcommand, runs an interactive session.\n")
+}
+
+// newFlagSet makes the flag set for a subcommand, including the
+// global -json flag.  Flag errors are returned rather than
+// exiting, so subcommands can be tested.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&jsonOutput, "json", jsonOutput, "write JSON output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: susen-cli %s [flags] %s\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// readInputs reads the puzzles in the named files, or in the
+// input if there are no names (or the name is -).  It's an error
+// if any puzzle can't be read.
+func readInputs(names []string, in io.Reader, format string) ([]entry, error) {
+	entries, err := readCollections(names, in, format)
+	if err != nil {
+		return nil, err
+	}
+	return entries, firstError(entries)
+}
+
+// readCollections is like readInputs, but entries that can't be
+// read are returned along with the others.
+func readCollections(names []string, in io.Reader, format string) ([]entry, error) {
+	if len(names) == 0 {
+		return readCollection(in, "stdin", format)
+	}
+	var entries []entry
+	for _, name := range names {
+		var es []entry
+		var err error
+		if name == "-" {
+			es, err = readCollection(in, "stdin", format)
+		} else if f, ferr := os.Open(name); ferr != nil {
+			err = ferr
+		} else {
+			es, err = readCollection(f, name, format)
+			f.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, es...)
+	}
+	return entries, nil
+}
+
+// failures counts the puzzles a subcommand couldn't handle, so
+// it can report them all and then fail.
+type failures int
+
+// note reports a failure on a puzzle.
+func (f *failures) note(e entry, err error) {
+	if jsonOutput {
+		code := failedErrorCode
+		if e.err != nil && err == e.err {
+			code = readErrorCode
+		}
+		writeJSONLine(os.Stderr, newErrorReport(e.name, err, code))
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", e.name, err)
+	}
+	*f++
+}
+
+// err returns an error if there were any failures.
+func (f failures) err() error {
+	if f > 0 {
+		return fmt.Errorf("%d puzzle(s) failed", int(f))
+	}
+	return nil
+}
+
+func solveCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("solve", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	to := fs.String("to", gridFormat, "output format (json, sdm, sdk, or grid)")
+	all := fs.Bool("all", false, "output every solution, not just the first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if jsonOutput {
+		*to = jsonFormat
+	}
+	entries, err := readInputs(fs.Args(), in, *from)
+	if err != nil {
+		return err
+	}
+	var failed failures
+	for _, e := range entries {
+		p, err := puzzle.New(e.summary)
+		if err != nil {
+			failed.note(e, err)
+			continue
+		}
+		solutions, err := p.Solutions()
+		if err != nil {
+			failed.note(e, err)
+			continue
+		}
+		if len(solutions) == 0 {
+			failed.note(e, fmt.Errorf("no solution"))
+			continue
+		}
+		if len(solutions) > 1 && !*all {
+			notice(e.name, "%d solutions, showing the first", len(solutions))
+			solutions = solutions[:1]
+		}
+		for _, s := range solutions {
+			solved := &puzzle.Summary{
+				Geometry:   e.summary.Geometry,
+				SideLength: e.summary.SideLength,
+				Values:     s.Values,
+			}
+			if err := writePuzzle(out, solved, *to); err != nil {
+				return err
+			}
+		}
+	}
+	return failed.err()
+}
+
+func generateCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("generate", "")
+	geometry := fs.String("geometry", "", "puzzle geometry (square or rectangular; default by size)")
+	side := fs.Int("size", 9, "puzzle side length")
+	clues := fs.Int("clues", 0, "number of clues to leave, if possible (0 for as few as possible)")
+	count := fs.Int("count", 1, "number of puzzles to generate")
+	seed := fs.Int64("seed", 0, "random seed (0 for a seed based on the time)")
+	to := fs.String("to", sdmFormat, "output format (json, sdm, sdk, or grid)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if jsonOutput {
+		*to = jsonFormat
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("generate takes no arguments")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	for i := 0; i < *count; i++ {
+		summary, err := generate(*geometry, *side, generator.Options{Clues: *clues}, rng.Int63())
+		if err != nil {
+			return err
+		}
+		if err := writePuzzle(out, summary, *to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("convert", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	to := fs.String("to", jsonFormat, "output format (json, sdm, sdk, or grid)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if jsonOutput {
+		*to = jsonFormat
+	}
+	if !writableFormat(*to) {
+		return fmt.Errorf("%q is not a writable format", *to)
+	}
+	entries, err := readCollections(fs.Args(), in, *from)
+	if err != nil {
+		return err
+	}
+	var failed failures
+	for _, e := range entries {
+		if e.err != nil {
+			failed.note(e, e.err)
+		} else if err := writePuzzle(out, e.summary, *to); err != nil {
+			failed.note(e, err)
+		}
+	}
+	if failed > 0 {
+		notice("", "Converted %d of %d puzzles.", len(entries)-int(failed), len(entries))
+	}
+	return failed.err()
+}
@@ -0,0 +1,90 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runSubcommand runs a subcommand on the given input, returning
+// its output.  A -json flag only applies to this run.
+func runSubcommand(t *testing.T, in string, args ...string) (string, error) {
+	defer func(saved bool) { jsonOutput = saved }(jsonOutput)
+	sc := findSubcommand(args[0])
+	if sc == nil {
+		t.Fatalf("No subcommand %q", args[0])
+	}
+	var out bytes.Buffer
+	err := sc.run(args[1:], strings.NewReader(in), &out)
+	return out.String(), err
+}
+
+func TestSolveCommand(t *testing.T) {
+	out, err := runSubcommand(t, testPuzzleSDM+"\n", "solve", "-to", "sdm")
+	if err != nil || out != testSolutionSDM+"\n" {
+		t.Errorf("Got %q, %v; expected %q", out, err, testSolutionSDM)
+	}
+	// a 4x4 puzzle with two solutions
+	out, err = runSubcommand(t, "..343412..434321\n", "solve", "-to", "sdm", "-all")
+	if lines := strings.Fields(out); err != nil || len(lines) != 2 {
+		t.Errorf("Got %q, %v; expected two solutions", out, err)
+	}
+	if _, err = runSubcommand(t, "11..............\n", "solve"); err == nil {
+		t.Errorf("No error solving an unsolvable puzzle")
+	}
+}
+
+func TestGenerateCommand(t *testing.T) {
+	out, err := runSubcommand(t, "", "generate", "-seed", "7", "-count", "2", "-size", "4")
+	if lines := strings.Fields(out); err != nil || len(lines) != 2 || len(lines[0]) != 16 {
+		t.Errorf("Got %q, %v; expected two 4x4 puzzles", out, err)
+	}
+	again, _ := runSubcommand(t, "", "generate", "-seed", "7", "-count", "2", "-size", "4")
+	if again != out {
+		t.Errorf("Same seed gave %q, then %q", out, again)
+	}
+	if _, err := runSubcommand(t, "", "generate", "extra"); err == nil {
+		t.Errorf("No error for generate argument")
+	}
+}
+
+func TestConvertCommand(t *testing.T) {
+	json, err := runSubcommand(t, testPuzzleSDM+"\n", "convert", "-to", "json")
+	if err != nil || !strings.HasPrefix(json, `{"geometry":"square","sidelen":9,`) {
+		t.Fatalf("Got %q, %v", json, err)
+	}
+	sdm, err := runSubcommand(t, json, "convert", "-to", "sdm")
+	if err != nil || sdm != testPuzzleSDM+"\n" {
+		t.Errorf("Got %q, %v; expected %q", sdm, err, testPuzzleSDM)
+	}
+	if _, err := runSubcommand(t, json, "convert", "-to", "bogus"); err == nil {
+		t.Errorf("No error converting to a bogus format")
+	}
+	sdk, err := runSubcommand(t, sdm, "convert", "-to", "sdk")
+	if err != nil || !strings.HasPrefix(sdk, testPuzzleSDM[:9]+"\n"+testPuzzleSDM[9:18]+"\n") {
+		t.Errorf("Got %q, %v", sdk, err)
+	}
+	// bad entries are reported, and the good ones converted
+	out, err := runSubcommand(t, "bad\n"+sdm, "convert", "-to", "sdm")
+	if err == nil || err.Error() != "1 puzzle(s) failed" || out != sdm {
+		t.Errorf("Got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,137 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+
+duplicate detection
+
+The dedupe subcommand finds puzzles in collections that are the
+same as an earlier one, either exactly or (unless asked for
+exact matches only) up to isomorphism.  It reports each
+duplicate and what it duplicates, and can write the
+collection, with the duplicates removed, to a file.
+
+*/
+
+// A duplicateReport is the JSON form of a duplicate.
+type duplicateReport struct {
+	Puzzle      string `json:"puzzle"`
+	DuplicateOf string `json:"duplicate_of"`
+	Isomorphic  bool   `json:"isomorphic"`
+}
+
+// reportDuplicate reports that a puzzle duplicates an earlier one.
+func reportDuplicate(out io.Writer, name, first string, isomorphic bool) {
+	switch {
+	case jsonOutput:
+		writeJSONLine(out, duplicateReport{name, first, isomorphic})
+	case isomorphic:
+		fmt.Fprintf(out, "%s: isomorphic to %s\n", name, first)
+	default:
+		fmt.Fprintf(out, "%s: duplicate of %s\n", name, first)
+	}
+}
+
+// puzzleKey returns a string that's the same for puzzles of the
+// same geometry, size, and constraints with the same values.
+func puzzleKey(summary *puzzle.Summary, values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return fmt.Sprintf("%s/%d/%v/%s", summary.Geometry, summary.SideLength, summary.Constraints, strings.Join(parts, ","))
+}
+
+func dedupeCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("dedupe", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	exact := fs.Bool("exact", false, "only find exact duplicates, not isomorphic ones")
+	outName := fs.String("out", "", "file for the puzzles without duplicates (none if empty)")
+	to := fs.String("to", jsonFormat, "format of the output file (json, sdm, sdk, or grid)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !writableFormat(*to) {
+		return fmt.Errorf("%q is not a writable format", *to)
+	}
+	entries, err := readCollections(fs.Args(), in, *from)
+	if err != nil {
+		return err
+	}
+
+	var failed failures
+	var unique []entry
+	exacts := make(map[string]string)
+	canonicals := make(map[string]string)
+	for _, e := range entries {
+		if e.err != nil {
+			failed.note(e, e.err)
+			continue
+		}
+		s := e.summary
+		key := puzzleKey(s, s.Values)
+		if first, ok := exacts[key]; ok {
+			reportDuplicate(out, e.name, first, false)
+			continue
+		}
+		exacts[key] = e.name
+		if !*exact {
+			values, err := canonicalValues(s)
+			if err != nil {
+				failed.note(e, err)
+				continue
+			}
+			ckey := puzzleKey(s, values)
+			if first, ok := canonicals[ckey]; ok {
+				reportDuplicate(out, e.name, first, true)
+				continue
+			}
+			canonicals[ckey] = e.name
+		}
+		unique = append(unique, e)
+	}
+	notice("", "%d puzzles, %d unique.", len(entries)-int(failed), len(unique))
+
+	if *outName != "" {
+		f, err := os.Create(*outName)
+		if err != nil {
+			return err
+		}
+		for _, e := range unique {
+			if err := writePuzzle(f, e.summary, *to); err != nil {
+				f.Close()
+				return fmt.Errorf("%s: %v", e.name, err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return failed.err()
+}
@@ -0,0 +1,54 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeCommand(t *testing.T) {
+	s, _ := parseValues(testPuzzleSDM)
+	labels := []int{0, 9, 8, 7, 6, 5, 4, 3, 2, 1}
+	identity := []int{0, 1, 2, 3, 4, 5, 6, 7, 8}
+	iso, _ := formatValues(transform(s.Values, 9, labels, identity, identity, true))
+	in := testPuzzleSDM + "\n" + testSolutionSDM + "\n" + iso + "\n" + testPuzzleSDM + "\nbad\n"
+
+	out, err := runSubcommand(t, in, "dedupe")
+	expect := "stdin:3: isomorphic to stdin:1\nstdin:4: duplicate of stdin:1\n"
+	if err == nil || out != expect {
+		t.Errorf("Got %q, %v; expected %q and a failure", out, err, expect)
+	}
+	out, err = runSubcommand(t, in, "dedupe", "-exact")
+	if expect := "stdin:4: duplicate of stdin:1\n"; err == nil || out != expect {
+		t.Errorf("Got %q, %v; expected %q and a failure", out, err, expect)
+	}
+
+	path := filepath.Join(t.TempDir(), "unique.sdm")
+	if _, err := runSubcommand(t, in[:len(in)-4], "dedupe", "-out", path, "-to", "sdm"); err != nil {
+		t.Fatalf("Dedupe failed: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != testPuzzleSDM+"\n"+testSolutionSDM+"\n" {
+		t.Errorf("Wrote %q, %v", data, err)
+	}
+	if _, err := runSubcommand(t, in, "dedupe", "-to", "bogus"); err == nil {
+		t.Errorf("No error deduping to a bogus format")
+	}
+}
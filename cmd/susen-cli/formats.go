@@ -0,0 +1,385 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"strings"
+)
+
+/*
+
+puzzle formats
+
+The subcommands read and write collections of puzzles in these
+formats:
+
+	json  Summary objects, one after another or in an array
+	sdm   one puzzle per line, as a row-by-row string of values
+	      (1-9, then A-Z) with . or 0 for empty squares
+	sdk   each puzzle laid out as rows of values, one row per
+	      line, with blank lines between puzzles
+	grid  the puzzle laid out as a grid (output only)
+
+Lines in sdm and sdk files that are blank or start with # are
+skipped, and anything after the first word of an sdm puzzle line
+is ignored.  In sdk files, the header lines #A, #D, and #S
+before a puzzle give its author, name, and source.
+
+A collection can have entries that can't be read, which are
+kept (with the reason) so they can be reported.  Only a
+collection that can't be read at all is an error.
+
+*/
+
+const (
+	autoFormat = "auto"
+	jsonFormat = "json"
+	sdmFormat  = "sdm"
+	sdkFormat  = "sdk"
+	gridFormat = "grid"
+)
+
+// An entry is a puzzle in a collection.  Its name says where it
+// came from, for reports.  If the puzzle couldn't be read, the
+// summary is nil and err says why.
+type entry struct {
+	name    string
+	summary *puzzle.Summary
+	err     error
+}
+
+// readPuzzles reads a collection of puzzles in the given format
+// (or, if the format is auto, whatever format it looks like).
+// The entries are named after the source and their position in
+// it.  It's an error if any entry can't be read.
+func readPuzzles(in io.Reader, source, format string) ([]entry, error) {
+	entries, err := readCollection(in, source, format)
+	if err != nil {
+		return nil, err
+	}
+	return entries, firstError(entries)
+}
+
+// readCollection is like readPuzzles, but entries that can't be
+// read are returned along with the others.
+func readCollection(in io.Reader, source, format string) ([]entry, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if format == autoFormat {
+		format = detectFormat(data)
+	}
+	switch format {
+	case jsonFormat:
+		return readJSON(data, source)
+	case sdmFormat:
+		return readSDM(data, source)
+	case sdkFormat:
+		return readSDK(data, source)
+	default:
+		return nil, fmt.Errorf("%q is not a readable format", format)
+	}
+}
+
+// A readError is the error for an entry that couldn't be read.
+type readError struct {
+	name string
+	err  error
+}
+
+func (re readError) Error() string {
+	return fmt.Sprintf("%s: %v", re.name, re.err)
+}
+
+func (re readError) Unwrap() error {
+	return re.err
+}
+
+// firstError returns the error for the first entry that couldn't
+// be read, if any.
+func firstError(entries []entry) error {
+	for _, e := range entries {
+		if e.err != nil {
+			return readError{e.name, e.err}
+		}
+	}
+	return nil
+}
+
+// detectFormat guesses the format of a collection.  JSON starts
+// with an object or array.  Otherwise, if the first puzzle line
+// starts a block of lines as long as there are lines in the
+// block, it's sdk, and if not it's sdm.
+func detectFormat(data []byte) string {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return jsonFormat
+	}
+	width, rows := 0, 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if rows == 0 && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+		if line == "" || (width > 0 && len(line) != width) {
+			break
+		}
+		width = len(line)
+		rows++
+	}
+	if rows > 1 && rows == width {
+		return sdkFormat
+	}
+	return sdmFormat
+}
+
+// readJSON reads Summaries, either one after another or in an
+// array.  Once a stream of Summaries has a syntax error, the rest
+// of it can't be read.
+func readJSON(data []byte, source string) ([]entry, error) {
+	var raws []json.RawMessage
+	var streamErr error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err == io.EOF {
+				break
+			} else if err != nil {
+				streamErr = err
+				break
+			}
+			raws = append(raws, raw)
+		}
+	}
+	entries := make([]entry, len(raws))
+	for i, raw := range raws {
+		entries[i].name = fmt.Sprintf("%s:%d", source, i+1)
+		summary := new(puzzle.Summary)
+		if err := json.Unmarshal(raw, summary); err != nil {
+			entries[i].err = err
+		} else {
+			entries[i].summary = summary
+		}
+	}
+	if streamErr != nil {
+		entries = append(entries, entry{name: fmt.Sprintf("%s:%d", source, len(raws)+1), err: streamErr})
+	}
+	return entries, nil
+}
+
+// readSDM reads puzzles one per line.
+func readSDM(data []byte, source string) ([]entry, error) {
+	var entries []entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		summary, err := parseValues(fields[0])
+		entries = append(entries, entry{fmt.Sprintf("%s:%d", source, line), summary, err})
+	}
+	return entries, scanner.Err()
+}
+
+// readSDK reads puzzles laid out in rows.  Each entry is named
+// for the line of its first row.
+func readSDK(data []byte, source string) ([]entry, error) {
+	var entries []entry
+	var rows []string
+	var info puzzle.Info
+	first := 0
+	finish := func() {
+		if len(rows) == 0 {
+			return
+		}
+		e := entry{name: fmt.Sprintf("%s:%d", source, first)}
+		for _, row := range rows {
+			if len(row) != len(rows) {
+				e.err = fmt.Errorf("%d rows must each have %d values", len(rows), len(rows))
+			}
+		}
+		if e.err == nil {
+			e.summary, e.err = parseValues(strings.Join(rows, ""))
+		}
+		if e.summary != nil && info.Author+info.Name+info.Source != "" {
+			i := info
+			e.summary.Info = &i
+		}
+		entries = append(entries, e)
+		rows, info = nil, puzzle.Info{}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			finish()
+		case strings.HasPrefix(text, "#"):
+			finish()
+			if len(text) >= 2 {
+				value := strings.TrimSpace(text[2:])
+				switch text[1] {
+				case 'A':
+					info.Author = value
+				case 'D':
+					info.Name = value
+				case 'S':
+					info.Source = value
+				}
+			}
+		default:
+			if len(rows) == 0 {
+				first = line
+			}
+			rows = append(rows, text)
+		}
+	}
+	finish()
+	return entries, scanner.Err()
+}
+
+// parseValues makes a summary from a string of values, with the
+// geometry that goes with its side length.
+func parseValues(s string) (*puzzle.Summary, error) {
+	side := isqrt(len(s))
+	if side*side != len(s) {
+		return nil, fmt.Errorf("%d values can't fill a square grid", len(s))
+	}
+	values := make([]int, len(s))
+	for i, c := range s {
+		switch {
+		case c == '.' || c == '0':
+			values[i] = 0
+		case c >= '1' && c <= '9':
+			values[i] = int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			values[i] = int(c-'A') + 10
+		case c >= 'a' && c <= 'z':
+			values[i] = int(c-'a') + 10
+		default:
+			return nil, fmt.Errorf("%q is not a square value", c)
+		}
+	}
+	return &puzzle.Summary{Geometry: geometryFor(side), SideLength: side, Values: values}, nil
+}
+
+// geometryFor returns the geometry for puzzles with the given
+// side length: square if the side length is a square, and
+// rectangular otherwise.
+func geometryFor(side int) string {
+	if tile := isqrt(side); tile*tile == side {
+		return puzzle.StandardGeometryName
+	}
+	return puzzle.RectangularGeometryName
+}
+
+// isqrt returns the integer square root of n.
+func isqrt(n int) int {
+	r := 0
+	for (r+1)*(r+1) <= n {
+		r++
+	}
+	return r
+}
+
+// formatValues is the inverse of parseValues.
+func formatValues(values []int) (string, error) {
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case v == 0:
+			b.WriteByte('.')
+		case v >= 1 && v <= 9:
+			b.WriteByte(byte('0' + v))
+		case v >= 10 && v <= 35:
+			b.WriteByte(byte('A' + v - 10))
+		default:
+			return "", fmt.Errorf("%d can't be written as a square value", v)
+		}
+	}
+	return b.String(), nil
+}
+
+// writableFormat reports whether puzzles can be written in the
+// format.
+func writableFormat(format string) bool {
+	switch format {
+	case jsonFormat, sdmFormat, sdkFormat, gridFormat:
+		return true
+	}
+	return false
+}
+
+// writePuzzle writes a puzzle in the given format.
+func writePuzzle(out io.Writer, summary *puzzle.Summary, format string) error {
+	switch format {
+	case jsonFormat:
+		bytes, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", bytes)
+		return err
+	case sdmFormat:
+		s, err := formatValues(summary.Values)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, s)
+		return err
+	case sdkFormat:
+		s, err := formatValues(summary.Values)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if info := summary.Info; info != nil {
+			for _, h := range []struct{ tag, value string }{
+				{"A", info.Author}, {"D", info.Name}, {"S", info.Source},
+			} {
+				if h.value != "" {
+					fmt.Fprintf(&b, "#%s %s\n", h.tag, h.value)
+				}
+			}
+		}
+		for side := summary.SideLength; len(s) >= side && side > 0; s = s[side:] {
+			fmt.Fprintln(&b, s[:side])
+		}
+		b.WriteString("\n")
+		_, err = io.WriteString(out, b.String())
+		return err
+	case gridFormat:
+		_, err := fmt.Fprintf(out, "%s\n", summary)
+		return err
+	default:
+		return fmt.Errorf("%q is not a writable format", format)
+	}
+}
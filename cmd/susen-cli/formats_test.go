@@ -0,0 +1,194 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a 9x9 puzzle with a unique solution, and that solution
+const (
+	testPuzzleSDM   = "......5..4..2.7..1...1..26.38...........32.1...7..54..7564..13...9.....6.......9."
+	testSolutionSDM = "621843579495267381873159264382914657564732918917685423756498132239571846148326795"
+)
+
+func TestParseValues(t *testing.T) {
+	testcases := []struct {
+		in       string
+		geometry string
+		side     int
+		values   []int
+	}{
+		{"12.0340000000000", puzzle.StandardGeometryName, 4, []int{1, 2, 0, 0, 3, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{strings.Repeat(".", 35) + "6", puzzle.RectangularGeometryName, 6, append(make([]int, 35), 6)},
+		{"G" + strings.Repeat("a", 255), puzzle.StandardGeometryName, 16, nil},
+	}
+	for i, tc := range testcases {
+		s, err := parseValues(tc.in)
+		if err != nil {
+			t.Fatalf("Case %d: parse failed: %v", i, err)
+		}
+		if s.Geometry != tc.geometry || s.SideLength != tc.side {
+			t.Errorf("Case %d: got %s %d, expected %s %d", i, s.Geometry, s.SideLength, tc.geometry, tc.side)
+		}
+		if tc.values != nil && !reflect.DeepEqual(s.Values, tc.values) {
+			t.Errorf("Case %d: got values %v, expected %v", i, s.Values, tc.values)
+		}
+		if tc.values == nil && (s.Values[0] != 16 || s.Values[1] != 10) {
+			t.Errorf("Case %d: got values %v", i, s.Values[:2])
+		}
+	}
+	for _, bad := range []string{"123", "1.2?"} {
+		if _, err := parseValues(bad); err == nil {
+			t.Errorf("No error parsing %q", bad)
+		}
+	}
+}
+
+func TestFormatValues(t *testing.T) {
+	s, err := parseValues(testPuzzleSDM)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if out, err := formatValues(s.Values); err != nil || out != testPuzzleSDM {
+		t.Errorf("Got %q, %v; expected %q", out, err, testPuzzleSDM)
+	}
+	if out, err := formatValues([]int{10, 35, 0}); err != nil || out != "AZ." {
+		t.Errorf("Got %q, %v; expected %q", out, err, "AZ.")
+	}
+	if _, err := formatValues([]int{36}); err == nil {
+		t.Errorf("No error formatting 36")
+	}
+}
+
+func TestReadPuzzles(t *testing.T) {
+	sdm := "# a comment\n\n" + testPuzzleSDM + " trailing words\n" + testSolutionSDM + "\n"
+	entries, err := readPuzzles(strings.NewReader(sdm), "test", autoFormat)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Read of sdm gave %v, %v", entries, err)
+	}
+	if entries[0].name != "test:3" || entries[1].name != "test:4" {
+		t.Errorf("Entries are named %q and %q", entries[0].name, entries[1].name)
+	}
+
+	// what's written as json reads back the same, streamed or in an array
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if err := writePuzzle(&buf, e.summary, jsonFormat); err != nil {
+			t.Fatalf("Write of json failed: %v", err)
+		}
+	}
+	array := "[" + strings.Replace(strings.TrimSpace(buf.String()), "\n", ",", -1) + "]"
+	for _, in := range []string{buf.String(), array} {
+		jentries, err := readPuzzles(strings.NewReader(in), "test", autoFormat)
+		if err != nil || len(jentries) != 2 {
+			t.Fatalf("Read of json gave %v, %v", jentries, err)
+		}
+		for i := range jentries {
+			if !reflect.DeepEqual(jentries[i].summary, entries[i].summary) {
+				t.Errorf("Entry %d: read %+v, expected %+v", i, jentries[i].summary, entries[i].summary)
+			}
+		}
+	}
+
+	// the grid format is write-only
+	buf.Reset()
+	if err := writePuzzle(&buf, entries[0].summary, gridFormat); err != nil || buf.String() != entries[0].summary.String()+"\n" {
+		t.Errorf("Write of grid gave %q, %v", buf.String(), err)
+	}
+	if _, err := readPuzzles(strings.NewReader(buf.String()), "test", gridFormat); err == nil {
+		t.Errorf("No error reading grid format")
+	}
+	if _, err := readPuzzles(strings.NewReader("{"), "test", autoFormat); err == nil {
+		t.Errorf("No error reading bad json")
+	}
+}
+
+func TestSDKFormat(t *testing.T) {
+	s, err := parseValues(testPuzzleSDM)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	s.Info = &puzzle.Info{Name: "Test", Author: "Dan"}
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if err := writePuzzle(&buf, s, sdkFormat); err != nil {
+			t.Fatalf("Write of sdk failed: %v", err)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "#A Dan\n#D Test\n......5..\n4..2.7..1\n") {
+		t.Errorf("Wrote sdk as %q", buf.String())
+	}
+	if format := detectFormat(buf.Bytes()); format != sdkFormat {
+		t.Errorf("Detected sdk as %s", format)
+	}
+	entries, err := readPuzzles(&buf, "test", autoFormat)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Read of sdk gave %v, %v", entries, err)
+	}
+	if entries[0].name != "test:3" || entries[1].name != "test:15" {
+		t.Errorf("Entries are named %q and %q", entries[0].name, entries[1].name)
+	}
+	for i, e := range entries {
+		if !reflect.DeepEqual(e.summary, s) {
+			t.Errorf("Entry %d: read %+v, expected %+v", i, e.summary, s)
+		}
+	}
+	if format := detectFormat([]byte(testPuzzleSDM + "\n" + testSolutionSDM + "\n")); format != sdmFormat {
+		t.Errorf("Detected sdm as %s", format)
+	}
+}
+
+func TestReadCollection(t *testing.T) {
+	testcases := []struct {
+		format, in string
+		bad        []string
+	}{
+		{sdmFormat, testPuzzleSDM + "\n123\n" + testSolutionSDM + "\n", []string{"test:2"}},
+		{sdkFormat, "12..\n..34\n....\n....\n\n12.\n3..\n\n1234\n3412\n2143\n4321\n", []string{"test:6"}},
+		{sdkFormat, "12..\n..3\n..34\n....\n", []string{"test:1"}},
+		{jsonFormat, `[{"sidelen": 4}, {"sidelen": "four"}]`, []string{"test:2"}},
+		{jsonFormat, `{"sidelen": "four"} {"sidelen": 4} {"side`, []string{"test:1", "test:3"}},
+	}
+	for i, tc := range testcases {
+		entries, err := readCollection(strings.NewReader(tc.in), "test", tc.format)
+		if err != nil {
+			t.Fatalf("Case %d: read failed: %v", i, err)
+		}
+		var bad []string
+		for _, e := range entries {
+			if e.err != nil {
+				bad = append(bad, e.name)
+			} else if e.summary == nil {
+				t.Errorf("Case %d: %s has neither puzzle nor error", i, e.name)
+			}
+		}
+		if !reflect.DeepEqual(bad, tc.bad) {
+			t.Errorf("Case %d: bad entries %v, expected %v", i, bad, tc.bad)
+		}
+		if _, err := readPuzzles(strings.NewReader(tc.in), "test", tc.format); err == nil ||
+			!strings.HasPrefix(err.Error(), tc.bad[0]+": ") {
+			t.Errorf("Case %d: strict read gave error %v", i, err)
+		}
+	}
+}
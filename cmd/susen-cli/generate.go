@@ -0,0 +1,63 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+)
+
+/*
+
+puzzle generation
+
+Puzzles are made by the generator package; the subcommands that
+generate puzzles share this front end to it, which picks a
+geometry by the side length when none is given.
+
+*/
+
+// generate makes a random puzzle with a unique solution, using
+// the given options and seed.  With no geometry, the geometry is
+// chosen by the side length.
+func generate(geometry string, side int, opts generator.Options, seed int64) (*puzzle.Summary, error) {
+	if geometry == "" {
+		geometry = geometryFor(side)
+	}
+	return generator.GenerateOptions(context.Background(), geometry, side, opts, seed)
+}
+
+// firstSolution solves a puzzle, returning its first solution.
+// It's an error if the puzzle has no solution.
+func firstSolution(summary *puzzle.Summary) (*puzzle.Solution, error) {
+	p, err := puzzle.New(summary)
+	if err != nil {
+		return nil, err
+	}
+	solutions, err := p.SolveContext(context.Background(), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(solutions) == 0 {
+		return nil, fmt.Errorf("puzzle has no solution")
+	}
+	return &solutions[0], nil
+}
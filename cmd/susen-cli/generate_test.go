@@ -0,0 +1,90 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"context"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+	"testing"
+)
+
+// hasUniqueSolution reports whether a puzzle has exactly one
+// solution.
+func hasUniqueSolution(summary *puzzle.Summary) (bool, error) {
+	p, err := puzzle.New(summary)
+	if err != nil {
+		return false, err
+	}
+	solutions, err := p.SolveContext(context.Background(), 2)
+	return len(solutions) == 1, err
+}
+
+func TestGenerate(t *testing.T) {
+	testcases := []struct {
+		geometry    string
+		side, clues int
+	}{
+		{"", 4, 0},
+		{"", 6, 0},
+		{puzzle.StandardGeometryName, 9, 0},
+		{puzzle.StandardGeometryName, 9, 40},
+	}
+	for i, tc := range testcases {
+		s, err := generate(tc.geometry, tc.side, generator.Options{Clues: tc.clues}, int64(i+1))
+		if err != nil {
+			t.Fatalf("Case %d: generate failed: %v", i, err)
+		}
+		if s.SideLength != tc.side || s.Geometry != geometryFor(tc.side) {
+			t.Errorf("Case %d: generated %s %d", i, s.Geometry, s.SideLength)
+		}
+		clues := 0
+		for _, v := range s.Values {
+			if v != 0 {
+				clues++
+			}
+		}
+		if tc.clues != 0 && clues != tc.clues {
+			t.Errorf("Case %d: generated %d clues, expected %d", i, clues, tc.clues)
+		}
+		if unique, err := hasUniqueSolution(s); err != nil || !unique {
+			t.Errorf("Case %d: generated puzzle doesn't have a unique solution (%v)", i, err)
+		}
+	}
+	if _, err := generate("bogus", 9, generator.Options{}, 1); err == nil {
+		t.Errorf("No error generating bogus geometry")
+	}
+}
+
+func TestGenerateRange(t *testing.T) {
+	for i, r := range [][2]generator.Level{{1, 1}, {1, 2}, {3, 5}} {
+		s, err := generate("", 9, generator.Options{Easiest: r[0], Hardest: r[1]}, int64(i+1))
+		if err != nil {
+			t.Errorf("Rated %d-%d: %v", r[0], r[1], err)
+			continue
+		}
+		solution, err := firstSolution(s)
+		if err != nil {
+			t.Fatalf("Rated %d-%d: %v", r[0], r[1], err)
+		}
+		if l := generator.Level(solution.Rating); l < r[0] || l > r[1] {
+			t.Errorf("Rated %d-%d: got a puzzle rated %d", r[0], r[1], solution.Rating)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"strings"
+)
+
+/*
+
+guided hints
+
+The hint subcommand walks through the next logical steps of
+solving a puzzle, explaining each one and showing the grid
+after it.  A step is either a single (a square with only one
+value left) or a binding (a value with only one place left in
+some group), easiest first.  When neither is left, solving needs
+a choice, and the walkthrough stops there.
+
+*/
+
+// A deduction is a logical step: a value for a square, and why.
+type deduction struct {
+	puzzle.Choice
+	bound  bool             // a binding, rather than a single
+	groups []puzzle.GroupID // the groups doing the binding
+	pvals  []int            // the square's possible values, if not a single
+}
+
+// nextDeduction returns the easiest deduction that can be made
+// in a puzzle with the given state, or nil if there isn't one.
+// Singles come before bindings, and squares are taken in order.
+func nextDeduction(state *puzzle.Content) *deduction {
+	var bound *deduction
+	for _, s := range state.Squares {
+		switch {
+		case s.Aval != 0:
+		case len(s.Pvals) == 1 && s.Bval == 0:
+			return &deduction{Choice: puzzle.Choice{Index: s.Index, Value: s.Pvals[0]}}
+		case s.Bval != 0 && bound == nil:
+			bound = &deduction{puzzle.Choice{Index: s.Index, Value: s.Bval}, true, s.Bsrc, s.Pvals}
+		}
+	}
+	return bound
+}
+
+// squareName names a square by its row letter and column number,
+// as in the play subcommand.
+func squareName(index, side int) string {
+	return fmt.Sprintf("%c%d", 'a'+(index-1)/side, (index-1)%side+1)
+}
+
+// explain says why a deduction is right.
+func (d *deduction) explain(side int) string {
+	where := squareName(d.Index, side)
+	if !d.bound {
+		return fmt.Sprintf("%s is %d: it's the only value left for %s, "+
+			"because its row, column, and tile have all the others", where, d.Value, where)
+	}
+	groups := make([]string, len(d.groups))
+	for i, g := range d.groups {
+		groups[i] = g.String()
+	}
+	why := fmt.Sprintf("%s is %d: it's the only place left for %d in %s",
+		where, d.Value, d.Value, strings.Join(groups, " and "))
+	if len(d.pvals) > 1 {
+		why += fmt.Sprintf(", even though %s could also be %s", where, joinInts(d.pvals, d.Value))
+	}
+	return why
+}
+
+// joinInts lists the ints other than skip, separated by "or".
+func joinInts(ints []int, skip int) string {
+	var parts []string
+	for _, i := range ints {
+		if i != skip {
+			parts = append(parts, fmt.Sprint(i))
+		}
+	}
+	return strings.Join(parts, " or ")
+}
+
+// solved reports whether every square in the state is assigned.
+func solved(state *puzzle.Content) bool {
+	for _, s := range state.Squares {
+		if s.Aval == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// A hintStep is the JSON form of a step in a walkthrough.
+type hintStep struct {
+	Square      string           `json:"square"`
+	Index       int              `json:"index"`
+	Value       int              `json:"value"`
+	Rule        string           `json:"rule"` // single or binding
+	Groups      []puzzle.GroupID `json:"groups,omitempty"`
+	Explanation string           `json:"explanation"`
+	Summary     *puzzle.Summary  `json:"summary,omitempty"` // the puzzle after the step
+}
+
+// A hintReport is the JSON form of a walkthrough.  If the
+// walkthrough stopped before taking all its steps, Stop says why.
+type hintReport struct {
+	Puzzle string     `json:"puzzle"`
+	Steps  []hintStep `json:"steps"`
+	Stop   string     `json:"stop,omitempty"`
+}
+
+// the reasons a walkthrough stops early
+var stopMessages = map[string]string{
+	"errors": "The puzzle has errors, so no more steps can be taken.",
+	"solved": "The puzzle is solved.",
+	"choice": "No square can be deduced: a choice is needed to go on.",
+}
+
+// walkthrough makes up to steps deductions in the named puzzle,
+// describing each one and (if grids is set) showing the puzzle
+// after it.
+func walkthrough(out io.Writer, name string, p *puzzle.Puzzle, steps int, grids bool) error {
+	report := hintReport{Puzzle: name, Steps: []hintStep{}}
+	for step := 1; step <= steps; step++ {
+		state, err := p.State()
+		if err != nil {
+			return err
+		}
+		if len(state.Errors) > 0 {
+			report.Stop = "errors"
+			break
+		}
+		d := nextDeduction(state)
+		if d == nil {
+			if report.Stop = "choice"; solved(state) {
+				report.Stop = "solved"
+			}
+			break
+		}
+		side := isqrt(len(state.Squares))
+		hs := hintStep{Square: squareName(d.Index, side), Index: d.Index, Value: d.Value,
+			Rule: "single", Groups: d.groups, Explanation: d.explain(side)}
+		if d.bound {
+			hs.Rule = "binding"
+		}
+		if !jsonOutput {
+			fmt.Fprintf(out, "Step %d: %s.\n", step, hs.Explanation)
+		}
+		if _, err := p.Assign(d.Choice); err != nil {
+			return err
+		}
+		if grids && jsonOutput {
+			full, err := p.Summary()
+			if err != nil {
+				return err
+			}
+			hs.Summary = &puzzle.Summary{Geometry: full.Geometry, SideLength: full.SideLength, Values: full.Values}
+		} else if grids {
+			fmt.Fprintf(out, "%s\n", p.ValuesString(false))
+		}
+		report.Steps = append(report.Steps, hs)
+	}
+	if jsonOutput {
+		return writeJSONLine(out, report)
+	}
+	if report.Stop != "" {
+		fmt.Fprintln(out, stopMessages[report.Stop])
+	}
+	return nil
+}
+
+func hintCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("hint", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	steps := fs.Int("steps", 1, "number of steps to show")
+	grids := fs.Bool("grids", true, "show the grid after each step")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entries, err := readInputs(fs.Args(), in, *from)
+	if err != nil {
+		return err
+	}
+	var failed failures
+	for i, e := range entries {
+		if len(entries) > 1 && !jsonOutput {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "%s:\n", e.name)
+		}
+		p, err := puzzle.New(e.summary)
+		if err == nil {
+			err = walkthrough(out, e.name, p, *steps, *grids)
+		}
+		if err != nil {
+			failed.note(e, err)
+		}
+	}
+	return failed.err()
+}
@@ -0,0 +1,69 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"testing"
+)
+
+func TestNextDeduction(t *testing.T) {
+	s, _ := parseValues(testPuzzleSDM)
+	p, err := puzzle.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, _ := p.State()
+	d := nextDeduction(state)
+	if d == nil || d.bound || d.Index != 17 || d.Value != 8 {
+		t.Fatalf("Got deduction %+v, expected b8 is 8", d)
+	}
+	if why := d.explain(9); !strings.HasPrefix(why, "b8 is 8: it's the only value left") {
+		t.Errorf("Explanation is %q", why)
+	}
+	bound := &deduction{puzzle.Choice{Index: 16, Value: 3}, true,
+		[]puzzle.GroupID{{Gtype: puzzle.GtypeCol, Index: 7}}, []int{3, 9}}
+	if why := bound.explain(9); why != "b7 is 3: it's the only place left for 3 in column 7, even though b7 could also be 9" {
+		t.Errorf("Explanation is %q", why)
+	}
+}
+
+func TestHintCommand(t *testing.T) {
+	out, err := runSubcommand(t, testPuzzleSDM+"\n", "hint", "-steps", "3", "-grids=false")
+	if err != nil {
+		t.Fatalf("Hint failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "Step 1: b8 is 8") || !strings.HasPrefix(lines[2], "Step 3: ") {
+		t.Errorf("Got %q", out)
+	}
+	out, err = runSubcommand(t, testSolutionSDM+"\n", "hint")
+	if err != nil || out != "The puzzle is solved.\n" {
+		t.Errorf("Got %q, %v for a solved puzzle", out, err)
+	}
+	out, err = runSubcommand(t, "..343412..434321\n", "hint", "-steps", "5")
+	if err != nil || !strings.HasSuffix(out, "a choice is needed to go on.\n") {
+		t.Errorf("Got %q, %v for an ambiguous puzzle", out, err)
+	}
+	out, err = runSubcommand(t, testPuzzleSDM+"\n"+testSolutionSDM+"\n", "hint")
+	if err != nil || !strings.HasPrefix(out, "stdin:1:\nStep 1:") || !strings.Contains(out, "\n\nstdin:2:\n") {
+		t.Errorf("Got %q, %v for two puzzles", out, err)
+	}
+}
@@ -21,6 +21,7 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"github.com/ancientHacker/susen.go/puzzle"
 	"github.com/ancientHacker/susen.go/storage"
@@ -36,6 +37,33 @@ import (
 func main() {
 	// log initialization
 	log.SetOutput(os.Stderr)
+	// subcommands work on files, without storage
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "-json" || args[0] == "--json") {
+		jsonOutput = true
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		sc := findSubcommand(args[0])
+		if sc == nil {
+			subcommandUsage(os.Stderr)
+			os.Exit(2)
+		}
+		if err := sc.run(args[1:], os.Stdin, os.Stdout); err != nil {
+			if err != flag.ErrHelp {
+				if jsonOutput {
+					writeJSONLine(os.Stderr, newErrorReport("", fmt.Errorf("%s failed: %w", sc.name, err), failedErrorCode))
+				} else {
+					log.Printf("%s failed: %v", sc.name, err)
+				}
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+	} else if jsonOutput {
+		log.Printf("The interactive session has no JSON output.")
+		os.Exit(2)
+	}
 	// storage initialization
 	cacheId, databaseId, err := storage.Connect()
 	if err != nil {
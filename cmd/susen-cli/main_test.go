@@ -86,7 +86,7 @@ func TestMarkdown(t *testing.T) {
 
 func TestSmallBuffer(t *testing.T) {
 	oldsize := bufsize
-	bufsize := 10
+	bufsize = 10
 	defer func() { bufsize = oldsize }()
 
 	testSetup(t)
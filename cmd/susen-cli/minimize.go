@@ -0,0 +1,151 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+/*
+
+puzzle minimization
+
+The minimize subcommand removes every clue it can from a puzzle
+without giving it more than one solution, leaving a minimal
+puzzle: one where removing any clue would make it ambiguous.
+It reports the clues it removed and how the removals changed
+the puzzle's rating, which helps authors clean up hand-made
+grids.  The clues are removed by the generator package, the same
+way it removes them from the puzzles it generates.
+
+*/
+
+// A minimization describes the clues removed from a puzzle.
+type minimization struct {
+	removed       []int // indexes of the squares whose clues were removed
+	before, after int   // the ratings before and after
+}
+
+// minimize removes the clues that aren't needed for a puzzle to
+// have a unique solution, trying the squares in the given order
+// (or in order, if nil).  The summary's values are changed in
+// place.  It's an error if the puzzle doesn't have a unique
+// solution to start with.
+func minimize(summary *puzzle.Summary, order []int) (*minimization, error) {
+	if order == nil {
+		order = make([]int, len(summary.Values))
+		for i := range order {
+			order[i] = i
+		}
+	}
+	before, err := firstSolution(summary)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := generator.Minimize(context.Background(), summary, order, 0)
+	if err != nil {
+		return nil, err
+	}
+	after, err := firstSolution(summary)
+	if err != nil {
+		return nil, err
+	}
+	return &minimization{removed, before.Rating, after.Rating}, nil
+}
+
+// describe says what a minimization removed, given the values
+// the puzzle had before.
+func (m *minimization) describe(values []int, side int) string {
+	if len(m.removed) == 0 {
+		return fmt.Sprintf("already minimal, rating %d", m.before)
+	}
+	clues := make([]string, len(m.removed))
+	for i, idx := range m.removed {
+		clues[i] = fmt.Sprintf("r%dc%d=%d", idx/side+1, idx%side+1, values[idx])
+	}
+	return fmt.Sprintf("removed %d clue(s) (%s), rating %d -> %d",
+		len(m.removed), strings.Join(clues, " "), m.before, m.after)
+}
+
+// A minimizationReport is the JSON form of a minimization.
+type minimizationReport struct {
+	Puzzle  string          `json:"puzzle"`
+	Summary *puzzle.Summary `json:"summary"`
+	Removed []int           `json:"removed"` // 1-based square indexes
+	Before  int             `json:"rating_before"`
+	After   int             `json:"rating_after"`
+}
+
+func minimizeCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("minimize", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	to := fs.String("to", sdmFormat, "output format (json, sdm, sdk, or grid)")
+	seed := fs.Int64("seed", 0, "random seed for the order clues are tried (0 tries them in order)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !writableFormat(*to) {
+		return fmt.Errorf("%q is not a writable format", *to)
+	}
+	entries, err := readCollections(fs.Args(), in, *from)
+	if err != nil {
+		return err
+	}
+	var rng *rand.Rand
+	if *seed != 0 {
+		rng = rand.New(rand.NewSource(*seed))
+	}
+	var failed failures
+	for _, e := range entries {
+		if e.err != nil {
+			failed.note(e, e.err)
+			continue
+		}
+		var order []int
+		if rng != nil {
+			order = rng.Perm(len(e.summary.Values))
+		}
+		original := append([]int(nil), e.summary.Values...)
+		m, err := minimize(e.summary, order)
+		if err != nil {
+			failed.note(e, err)
+			continue
+		}
+		if jsonOutput {
+			r := minimizationReport{e.name, e.summary, make([]int, len(m.removed)), m.before, m.after}
+			for i, idx := range m.removed {
+				r.Removed[i] = idx + 1
+			}
+			err = writeJSONLine(out, r)
+		} else {
+			notice(e.name, "%s", m.describe(original, e.summary.SideLength))
+			err = writePuzzle(out, e.summary, *to)
+		}
+		if err != nil {
+			failed.note(e, err)
+		}
+	}
+	return failed.err()
+}
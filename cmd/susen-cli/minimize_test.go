@@ -0,0 +1,81 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinimize(t *testing.T) {
+	// the test puzzle with extra clues from its solution
+	padded := []byte(testPuzzleSDM)
+	for _, i := range []int{0, 1, 2, 40, 80} {
+		padded[i] = testSolutionSDM[i]
+	}
+	s, _ := parseValues(string(padded))
+	original := append([]int(nil), s.Values...)
+	m, err := minimize(s, nil)
+	if err != nil {
+		t.Fatalf("Minimize failed: %v", err)
+	}
+	if len(m.removed) < 5 || m.before > m.after {
+		t.Errorf("Removed %d clues, rating %d -> %d", len(m.removed), m.before, m.after)
+	}
+	for _, i := range m.removed {
+		if original[i] == 0 || s.Values[i] != 0 {
+			t.Errorf("Square %d was %d and is now %d", i, original[i], s.Values[i])
+		}
+	}
+	// removing any remaining clue makes the puzzle ambiguous
+	for i, v := range s.Values {
+		if v == 0 {
+			continue
+		}
+		s.Values[i] = 0
+		if unique, _ := hasUniqueSolution(s); unique {
+			t.Errorf("Clue %d could still be removed", i)
+		}
+		s.Values[i] = v
+	}
+	if !strings.HasPrefix(m.describe(original, 9), "removed ") || !strings.Contains(m.describe(original, 9), "r1c1=6") {
+		t.Errorf("Description is %q", m.describe(original, 9))
+	}
+	if m, err := minimize(s, nil); err != nil || len(m.removed) != 0 {
+		t.Errorf("Minimal puzzle gave %+v, %v", m, err)
+	} else if d := m.describe(s.Values, 9); !strings.HasPrefix(d, "already minimal") {
+		t.Errorf("Description is %q", d)
+	}
+
+	ambiguous, _ := parseValues("..343412..434321")
+	if _, err := minimize(ambiguous, nil); err == nil {
+		t.Errorf("Minimized a puzzle with two solutions")
+	}
+}
+
+func TestMinimizeCommand(t *testing.T) {
+	out, err := runSubcommand(t, testPuzzleSDM+"\n"+"..343412..434321\n", "minimize", "-seed", "3")
+	if err == nil || err.Error() != "1 puzzle(s) failed" {
+		t.Errorf("Got error %v, expected one failure", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 || len(lines[0]) != 81 {
+		t.Errorf("Got output %q", out)
+	}
+}
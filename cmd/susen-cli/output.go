@@ -0,0 +1,104 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"os"
+)
+
+/*
+
+JSON output
+
+With the global -json flag (given before the subcommand, or as
+a flag of any subcommand), the subcommands write JSON instead of
+text: puzzles are written as Summaries, reports as objects, one
+per line, and errors and notices on the standard error as
+objects with a puzzle name and a message.  Errors also have a
+code: read for puzzles that couldn't be read, puzzle for
+puzzles the engine rejected (with the engine's error as the
+detail), and failed for everything else.
+
+*/
+
+// jsonOutput is set by the -json flag.
+var jsonOutput bool
+
+// error codes
+const (
+	readErrorCode   = "read"
+	puzzleErrorCode = "puzzle"
+	failedErrorCode = "failed"
+)
+
+// An errorReport is the JSON form of an error.
+type errorReport struct {
+	Puzzle  string        `json:"puzzle,omitempty"`
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Detail  *puzzle.Error `json:"detail,omitempty"`
+}
+
+// newErrorReport describes an error with a puzzle (if there's a
+// name) or a subcommand.
+func newErrorReport(name string, err error, code string) errorReport {
+	r := errorReport{Puzzle: name, Code: code, Message: err.Error()}
+	var pe puzzle.Error
+	var re readError
+	if errors.As(err, &pe) {
+		r.Code, r.Detail = puzzleErrorCode, &pe
+	} else if errors.As(err, &re) {
+		r.Code, r.Puzzle, r.Message = readErrorCode, re.name, re.err.Error()
+	}
+	return r
+}
+
+// A noticeReport is the JSON form of a notice.
+type noticeReport struct {
+	Puzzle string `json:"puzzle,omitempty"`
+	Notice string `json:"notice"`
+}
+
+// notice tells the user something on the standard error,
+// about a puzzle if there's a name.
+func notice(name, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if jsonOutput {
+		writeJSONLine(os.Stderr, noticeReport{name, message})
+	} else if name != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, message)
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+}
+
+// writeJSONLine writes a value as a line of JSON.
+func writeJSONLine(out io.Writer, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", bytes)
+	return err
+}
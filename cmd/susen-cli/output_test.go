@@ -0,0 +1,123 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"testing"
+)
+
+// decodeLines decodes each line of JSON output as a T.
+func decodeLines[T any](t *testing.T, out string) []T {
+	var result []T
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var v T
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("Output line %q isn't JSON: %v", line, err)
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+func TestNewErrorReport(t *testing.T) {
+	_, err := puzzle.New(&puzzle.Summary{Geometry: "bogus", SideLength: 4, Values: make([]int, 16)})
+	if err == nil {
+		t.Fatalf("No error for a bogus geometry")
+	}
+	r := newErrorReport("test:1", fmt.Errorf("solve failed: %w", err), failedErrorCode)
+	if r.Code != puzzleErrorCode || r.Detail == nil || r.Detail.Condition != puzzle.UnknownGeometryCondition {
+		t.Errorf("Puzzle error reported as %+v", r)
+	}
+	_, err = readPuzzles(strings.NewReader("\nbad\n"), "test", sdmFormat)
+	r = newErrorReport("", fmt.Errorf("solve failed: %w", err), failedErrorCode)
+	if r.Code != readErrorCode || r.Puzzle != "test:2" || r.Message != "3 values can't fill a square grid" {
+		t.Errorf("Read error reported as %+v", r)
+	}
+	r = newErrorReport("", fmt.Errorf("oops"), readErrorCode)
+	if r.Code != readErrorCode || r.Detail != nil || r.Message != "oops" {
+		t.Errorf("Plain error reported as %+v", r)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	// puzzles are summaries, whatever format is asked for
+	for _, args := range [][]string{
+		{"solve", "-json", "-to", "grid"},
+		{"convert", "-json", "-to", "sdm"},
+		{"generate", "-json", "-size", "4", "-seed", "1"},
+	} {
+		out, err := runSubcommand(t, testPuzzleSDM+"\n", args...)
+		if err != nil {
+			t.Fatalf("%s failed: %v", args[0], err)
+		}
+		for _, s := range decodeLines[puzzle.Summary](t, out) {
+			if s.SideLength == 0 || len(s.Values) != s.SideLength*s.SideLength {
+				t.Errorf("%s wrote summary %+v", args[0], s)
+			}
+		}
+	}
+	if jsonOutput {
+		t.Errorf("A -json flag stayed on after its run")
+	}
+
+	out, err := runSubcommand(t, testPuzzleSDM+"\n", "rate", "-json")
+	var ratings []puzzleRating
+	if err != nil || json.Unmarshal([]byte(out), &ratings) != nil || len(ratings) != 1 || ratings[0].Rating != 5 {
+		t.Errorf("Rate wrote %q, %v", out, err)
+	}
+
+	out, err = runSubcommand(t, testPuzzleSDM+"\n"+testPuzzleSDM+"\n", "dedupe", "-json")
+	dups := decodeLines[duplicateReport](t, out)
+	if err != nil || len(dups) != 1 || dups[0] != (duplicateReport{"stdin:2", "stdin:1", false}) {
+		t.Errorf("Dedupe wrote %q, %v", out, err)
+	}
+
+	padded := []byte(testPuzzleSDM)
+	padded[0] = testSolutionSDM[0]
+	out, err = runSubcommand(t, string(padded)+"\n", "minimize", "-json")
+	mins := decodeLines[minimizationReport](t, out)
+	if err != nil || len(mins) != 1 || len(mins[0].Removed) == 0 || mins[0].Removed[0] != 1 || mins[0].Summary == nil {
+		t.Errorf("Minimize wrote %q, %v", out, err)
+	}
+
+	out, err = runSubcommand(t, testPuzzleSDM+"\n", "hint", "-json", "-steps", "2")
+	hints := decodeLines[hintReport](t, out)
+	if err != nil || len(hints) != 1 || len(hints[0].Steps) != 2 || hints[0].Stop != "" {
+		t.Fatalf("Hint wrote %q, %v", out, err)
+	}
+	if step := hints[0].Steps[0]; step.Square != "b8" || step.Rule != "single" || step.Summary == nil ||
+		step.Summary.Values[step.Index-1] != 8 {
+		t.Errorf("First hint step is %+v", step)
+	}
+	out, _ = runSubcommand(t, testSolutionSDM+"\n", "hint", "-json")
+	if hints := decodeLines[hintReport](t, out); hints[0].Stop != "solved" || len(hints[0].Steps) != 0 {
+		t.Errorf("Hint on a solved puzzle wrote %q", out)
+	}
+
+	if _, err := runSubcommand(t, "", "play", "-json"); err == nil {
+		t.Errorf("Play accepted JSON output")
+	}
+	if _, err := runSubcommand(t, "", "book", "-json", "-out", "-"); err == nil {
+		t.Errorf("Book wrote both PDF and JSON to the output")
+	}
+}
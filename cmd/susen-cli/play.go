@@ -0,0 +1,364 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/puzzle/generator"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/*
+
+terminal play
+
+The play subcommand is an interactive game in the terminal,
+drawn with the puzzle's text grid.  It reads single keys:
+
+	arrows, hjkl  move the cursor
+	1-9, A-Z      enter a value (or toggle a pencil mark)
+	0, x, space   clear an entered value
+	m             switch between entering values and marks
+	u, r          undo and redo
+	?             show a hint
+	q             quit
+
+*/
+
+// play key help, shown under the grid
+const playHelp = "arrows/hjkl move, 1-9/A-Z enter, x clear, m marks, u undo, r redo, ? hint, q quit"
+
+// A game is the state of terminal play.
+type game struct {
+	p        *puzzle.Puzzle
+	side     int
+	row, col int    // 0-based cursor position
+	marking  bool   // whether values are pencil marks
+	message  string // the result of the last key
+	solution []int  // the puzzle's first solution, for hints
+}
+
+// newGame starts a game on a puzzle.
+func newGame(summary *puzzle.Summary) (*game, error) {
+	p, err := puzzle.New(summary)
+	if err != nil {
+		return nil, err
+	}
+	g := &game{p: p, side: summary.SideLength}
+	if solutions, err := p.Solutions(); err == nil && len(solutions) > 0 {
+		g.solution = solutions[0].Values
+	}
+	return g, nil
+}
+
+// index is the 1-based index of the square under the cursor.
+func (g *game) index() int {
+	return g.row*g.side + g.col + 1
+}
+
+// position names the square under the cursor the way the
+// interactive session does, as row letter and column number.
+func (g *game) position() string {
+	return fmt.Sprintf("%c%d", 'a'+g.row, g.col+1)
+}
+
+// square returns the square under the cursor.
+func (g *game) square() puzzle.Square {
+	state, _ := g.p.State()
+	return state.Squares[g.index()-1]
+}
+
+// handleKey updates the game for a key, and reports whether the
+// game is over.
+func (g *game) handleKey(key string) bool {
+	g.message = ""
+	switch key {
+	case "q", "\x03", "\x04": // q, control-C, control-D
+		return true
+	case "up", "k":
+		g.row = (g.row + g.side - 1) % g.side
+	case "down", "j":
+		g.row = (g.row + 1) % g.side
+	case "left", "h":
+		g.col = (g.col + g.side - 1) % g.side
+	case "right", "l":
+		g.col = (g.col + 1) % g.side
+	case "m":
+		g.marking = !g.marking
+	case "0", "x", " ", "\x7f":
+		g.clear()
+	case "u":
+		g.report(g.p.Undo())
+	case "r":
+		g.report(g.p.Redo())
+	case "?":
+		g.hint()
+	default:
+		if v := keyValue(key); v > 0 && v <= g.side {
+			g.enter(v)
+		} else {
+			g.message = fmt.Sprintf("Unknown key %q (%s)", key, playHelp)
+		}
+	}
+	return false
+}
+
+// keyValue returns the value typed by a key, or 0 if the key
+// isn't a value.
+func keyValue(key string) int {
+	if len(key) != 1 {
+		return 0
+	}
+	switch c := key[0]; {
+	case c >= '1' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 0
+}
+
+// enter assigns a value to the square under the cursor, or
+// toggles it as a pencil mark.
+func (g *game) enter(v int) {
+	s := g.square()
+	if !g.marking {
+		if s.Aval != 0 {
+			g.message = fmt.Sprintf("%s already has a value", g.position())
+			return
+		}
+		g.report(g.p.Assign(puzzle.Choice{Index: s.Index, Value: v}))
+		return
+	}
+	for _, m := range s.Marks {
+		if m == v {
+			g.report(g.p.RemoveMark(s.Index, v))
+			return
+		}
+	}
+	g.report(g.p.AddMark(s.Index, v))
+}
+
+// clear unassigns the square under the cursor.
+func (g *game) clear() {
+	if s := g.square(); !s.Entered {
+		g.message = fmt.Sprintf("%s has no entered value", g.position())
+		return
+	}
+	g.report(g.p.Unassign(g.index()))
+}
+
+// hint suggests a value for the square under the cursor (or, if
+// it's filled, for a square whose value is forced).
+func (g *game) hint() {
+	state, _ := g.p.State()
+	if len(state.Errors) > 0 {
+		g.message = "The puzzle can't be solved from here; try undo"
+		return
+	}
+	if s := g.square(); s.Aval == 0 && g.solution != nil {
+		g.message = fmt.Sprintf("Hint: %s is %d", g.position(), g.solution[s.Index-1])
+		return
+	}
+	for _, s := range state.Squares {
+		if s.Aval == 0 && (s.Bval != 0 || len(s.Pvals) == 1) {
+			g.message = fmt.Sprintf("Hint: look at %c%d", 'a'+(s.Index-1)/g.side, (s.Index-1)%g.side+1)
+			return
+		}
+	}
+	g.message = "No hint available"
+}
+
+// report sets the message for the result of an operation.
+func (g *game) report(update *puzzle.Content, err error) {
+	switch {
+	case err != nil:
+		g.message = err.Error()
+	case len(update.Errors) > 0:
+		g.message = update.Errors[0].Error()
+	}
+}
+
+// solved reports whether every square is filled without errors.
+func (g *game) solved() bool {
+	state, _ := g.p.State()
+	if len(state.Errors) > 0 {
+		return false
+	}
+	for _, s := range state.Squares {
+		if s.Aval == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// render draws the game: the puzzle's text grid with the cursor
+// square highlighted, followed by a status line and a message.
+func (g *game) render() string {
+	var b strings.Builder
+	row := 0
+	for _, line := range strings.SplitAfter(g.p.ValuesString(true), "\n") {
+		if len(line) > 0 && line[0] >= 'a' && line[0] <= 'z' {
+			if row == g.row {
+				// cells are 4 characters wide, after the row letter,
+				// and each starts with a separator
+				start := 2 + 4*g.col
+				line = line[:start] + "\x1b[7m" + line[start:start+3] + "\x1b[0m" + line[start+3:]
+			}
+			row++
+		}
+		b.WriteString(line)
+	}
+	s := g.square()
+	mode := "values"
+	if g.marking {
+		mode = "marks"
+	}
+	fmt.Fprintf(&b, "%s  mode: %s  marks: %v\n", g.position(), mode, s.Marks)
+	if g.solved() {
+		b.WriteString("Solved!\n")
+	} else if g.message != "" {
+		b.WriteString(g.message + "\n")
+	}
+	return b.String()
+}
+
+// readKey reads a key, translating arrow key escape sequences
+// into the names up, down, left, and right.
+func readKey(in *bufio.Reader) (string, error) {
+	c, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if c != '\x1b' {
+		return string(c), nil
+	}
+	seq := make([]byte, 0, 2)
+	for len(seq) < 2 && in.Buffered() > 0 {
+		b, _ := in.ReadByte()
+		seq = append(seq, b)
+	}
+	switch string(seq) {
+	case "[A", "OA":
+		return "up", nil
+	case "[B", "OB":
+		return "down", nil
+	case "[C", "OC":
+		return "right", nil
+	case "[D", "OD":
+		return "left", nil
+	}
+	return "\x1b" + string(seq), nil
+}
+
+// runGame plays the game with keys from the input, drawing it
+// on the output after each key, until the player quits or the
+// input runs out.
+func runGame(g *game, in io.Reader, out io.Writer) error {
+	keys := bufio.NewReader(in)
+	for {
+		// home the cursor and clear the screen, then draw; in
+		// raw mode, lines need explicit carriage returns
+		screen := strings.Replace(g.render(), "\n", "\r\n", -1)
+		fmt.Fprintf(out, "\x1b[H\x1b[2J%s%s\r\n", screen, playHelp)
+		key, err := readKey(keys)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if g.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+// rawTerminal puts the terminal into raw mode (if the input is
+// a terminal), so keys are read as they're typed, and returns a
+// function that restores it.
+func rawTerminal(in io.Reader) func() {
+	f, ok := in.(*os.File)
+	if !ok {
+		return func() {}
+	}
+	if stat, err := f.Stat(); err != nil || (stat.Mode()&os.ModeCharDevice) == 0 {
+		return func() {}
+	}
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = f
+		return cmd.Run()
+	}
+	if err := stty("raw", "-echo"); err != nil {
+		return func() {}
+	}
+	return func() { stty("sane") }
+}
+
+func playCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("play", "[file]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	number := fs.Int("n", 1, "which puzzle in the file to play")
+	size := fs.Int("size", 9, "side length of the puzzle to generate, with no file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if jsonOutput {
+		return fmt.Errorf("play is interactive, so it has no JSON output")
+	}
+	var summary *puzzle.Summary
+	switch fs.NArg() {
+	case 0:
+		var err error
+		if summary, err = generate("", *size, generator.Options{}, time.Now().UnixNano()); err != nil {
+			return err
+		}
+	case 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		entries, err := readPuzzles(f, fs.Arg(0), *from)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if *number < 1 || *number > len(entries) {
+			return fmt.Errorf("%s has %d puzzle(s), so there's no puzzle %d", fs.Arg(0), len(entries), *number)
+		}
+		summary = entries[*number-1].summary
+	default:
+		fs.Usage()
+		return fmt.Errorf("play takes at most one file")
+	}
+	g, err := newGame(summary)
+	if err != nil {
+		return err
+	}
+	restore := rawTerminal(in)
+	defer restore()
+	return runGame(g, in, out)
+}
@@ -0,0 +1,146 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"testing"
+)
+
+// testGame starts a game on the test puzzle.
+func testGame(t *testing.T) *game {
+	s, _ := parseValues(testPuzzleSDM)
+	g, err := newGame(s)
+	if err != nil {
+		t.Fatalf("Failed to start game: %v", err)
+	}
+	return g
+}
+
+func TestReadKey(t *testing.T) {
+	keys := bufio.NewReader(strings.NewReader("a\x1b[A\x1b[B\x1bOC\x1b[D\x1b[Z5"))
+	expected := []string{"a", "up", "down", "right", "left", "\x1b[Z", "5"}
+	for i, e := range expected {
+		if key, err := readKey(keys); err != nil || key != e {
+			t.Errorf("Key %d: got %q, %v; expected %q", i, key, err, e)
+		}
+	}
+	if _, err := readKey(keys); err == nil {
+		t.Errorf("No error reading past the end")
+	}
+}
+
+func TestGameMoves(t *testing.T) {
+	g := testGame(t)
+	for _, key := range []string{"up", "left", "j", "l", "l"} {
+		g.handleKey(key)
+	}
+	if g.row != 0 || g.col != 1 || g.position() != "a2" {
+		t.Errorf("Cursor is at %d, %d (%s), expected a2", g.row, g.col, g.position())
+	}
+
+	// values, clears, undo and redo
+	solution, _ := parseValues(testSolutionSDM)
+	v := solution.Values[g.index()-1]
+	g.handleKey(string(rune('0' + v)))
+	if s := g.square(); s.Aval != v || !s.Entered {
+		t.Errorf("Entering %d gave square %+v", v, s)
+	}
+	g.handleKey("3")
+	if g.message == "" {
+		t.Errorf("No message entering a value over a value")
+	}
+	g.handleKey("u")
+	if s := g.square(); s.Aval != 0 {
+		t.Errorf("Undo left square %+v", s)
+	}
+	g.handleKey("r")
+	g.handleKey("x")
+	if s := g.square(); s.Aval != 0 {
+		t.Errorf("Clear left square %+v", s)
+	}
+	g.handleKey("x")
+	if g.message == "" {
+		t.Errorf("No message clearing an empty square")
+	}
+
+	// marks toggle
+	g.handleKey("m")
+	g.handleKey("4")
+	g.handleKey("7")
+	g.handleKey("4")
+	if s := g.square(); len(s.Marks) != 1 || s.Marks[0] != 7 {
+		t.Errorf("Marks are %v, expected [7]", s.Marks)
+	}
+
+	// hints give the solution value
+	g.handleKey("?")
+	if expected := "Hint: a2 is " + string(rune('0'+v)); g.message != expected {
+		t.Errorf("Hint was %q, expected %q", g.message, expected)
+	}
+	if g.handleKey("Z"); g.message == "" {
+		t.Errorf("No message for an out-of-range value")
+	}
+	if !g.handleKey("q") {
+		t.Errorf("Quit didn't end the game")
+	}
+}
+
+func TestGameRender(t *testing.T) {
+	g := testGame(t)
+	g.handleKey("j")
+	g.handleKey("l")
+	screen := g.render()
+	lines := strings.Split(screen, "\n")
+	if !strings.HasPrefix(lines[3], "b| 4  \x1b[7m _ \x1b[0m  _ |") {
+		t.Errorf("Cursor isn't highlighted at b2: %q", lines[3])
+	}
+	if !strings.Contains(screen, "b2  mode: values  marks: []") {
+		t.Errorf("No status line in %q", screen)
+	}
+
+	// solving the puzzle is announced
+	solution, _ := parseValues(testSolutionSDM)
+	for i, v := range solution.Values {
+		g.p.Assign(puzzle.Choice{Index: i + 1, Value: v}) // fails on the givens
+	}
+	if !g.solved() || !strings.Contains(g.render(), "Solved!") {
+		t.Errorf("Solved puzzle isn't announced")
+	}
+}
+
+func TestRunGame(t *testing.T) {
+	g := testGame(t)
+	var out bytes.Buffer
+	if err := runGame(g, strings.NewReader("\x1b[Bl9q6"), &out); err != nil {
+		t.Fatalf("Game failed: %v", err)
+	}
+	if s := g.square(); g.position() != "b2" || s.Aval != 9 {
+		t.Errorf("Game ended at %s with square %+v", g.position(), s)
+	}
+	if screens := strings.Count(out.String(), "\x1b[2J"); screens != 4 {
+		t.Errorf("Game drew %d screens, expected 4", screens)
+	}
+	if strings.Contains(out.String(), "\n") && !strings.Contains(out.String(), "\r\n") {
+		t.Errorf("Game output lacks carriage returns")
+	}
+}
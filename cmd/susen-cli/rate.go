@@ -0,0 +1,198 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+
+batch rating
+
+The rate subcommand rates every puzzle in a collection, using a
+pool of workers since each puzzle is rated independently.  For
+each puzzle it reports the solver's rating, how many solutions
+and choices the solver found, a histogram of how the empty
+squares can be placed (see puzzle.Difficulties), and how long
+the solve took.  The results are in the order of the input.
+
+*/
+
+// A puzzleRating is the rating of one puzzle.  Tiers counts the
+// empty squares in each difficulty tier.
+type puzzleRating struct {
+	Puzzle    string         `json:"puzzle"`
+	Rating    int            `json:"rating,omitempty"`
+	Solutions int            `json:"solutions"`
+	Choices   int            `json:"choices"`
+	Empty     int            `json:"empty"`
+	Tiers     map[string]int `json:"tiers,omitempty"`
+	Millis    float64        `json:"millis"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// the tiers in the histogram, in order
+var ratingTiers = []puzzle.DifficultyTier{
+	puzzle.SingleTier, puzzle.BoundTier, puzzle.DeducedTier, puzzle.ChoiceTier,
+}
+
+// ratePuzzle rates a puzzle.  Problems with the puzzle are
+// recorded in the rating.
+func ratePuzzle(e entry) *puzzleRating {
+	r := &puzzleRating{Puzzle: e.name}
+	p, err := puzzle.New(e.summary)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	start := time.Now()
+	solutions, err := p.Solutions()
+	r.Millis = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Solutions = len(solutions)
+	if len(solutions) == 0 {
+		r.Error = "no solution"
+		return r
+	}
+	r.Rating, r.Choices = solutions[0].Rating, len(solutions[0].Choices)
+	difficulties, err := p.Difficulties()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Empty = len(difficulties)
+	r.Tiers = make(map[string]int, len(ratingTiers))
+	for _, d := range difficulties {
+		r.Tiers[d.Tier.String()]++
+	}
+	return r
+}
+
+// rateAll rates the puzzles with the given number of workers.
+func rateAll(entries []entry, workers int) []*puzzleRating {
+	if workers < 1 {
+		workers = 1
+	}
+	ratings := make([]*puzzleRating, len(entries))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				ratings[i] = ratePuzzle(entries[i])
+			}
+		}()
+	}
+	for i := range entries {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return ratings
+}
+
+// writeRatingsCSV writes ratings as CSV, with a header.
+func writeRatingsCSV(out io.Writer, ratings []*puzzleRating) error {
+	w := csv.NewWriter(out)
+	header := []string{"puzzle", "rating", "solutions", "choices", "empty"}
+	for _, t := range ratingTiers {
+		header = append(header, t.String())
+	}
+	w.Write(append(header, "millis", "error"))
+	for _, r := range ratings {
+		record := []string{
+			r.Puzzle,
+			strconv.Itoa(r.Rating),
+			strconv.Itoa(r.Solutions),
+			strconv.Itoa(r.Choices),
+			strconv.Itoa(r.Empty),
+		}
+		for _, t := range ratingTiers {
+			record = append(record, strconv.Itoa(r.Tiers[t.String()]))
+		}
+		w.Write(append(record, strconv.FormatFloat(r.Millis, 'f', 3, 64), r.Error))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeRatingsJSON writes ratings as a JSON array.
+func writeRatingsJSON(out io.Writer, ratings []*puzzleRating) error {
+	bytes, err := json.MarshalIndent(ratings, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", bytes)
+	return err
+}
+
+func rateCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("rate", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	input := fs.String("in", "", "file of puzzles to rate (as well as any listed)")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "number of puzzles to rate at once")
+	format := fs.String("format", "csv", "output format (csv or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if jsonOutput {
+		*format = jsonFormat
+	}
+	if *format != "csv" && *format != jsonFormat {
+		return fmt.Errorf("%q is not a rating format", *format)
+	}
+	names := fs.Args()
+	if *input != "" {
+		names = append([]string{*input}, names...)
+	}
+	entries, err := readInputs(names, in, *from)
+	if err != nil {
+		return err
+	}
+	ratings := rateAll(entries, *workers)
+	var failed failures
+	for i, r := range ratings {
+		if r.Error != "" {
+			failed.note(entries[i], fmt.Errorf("%s", r.Error))
+		}
+	}
+	if *format == jsonFormat {
+		err = writeRatingsJSON(out, ratings)
+	} else {
+		err = writeRatingsCSV(out, ratings)
+	}
+	if err != nil {
+		return err
+	}
+	return failed.err()
+}
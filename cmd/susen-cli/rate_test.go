@@ -0,0 +1,96 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRatePuzzle(t *testing.T) {
+	s, _ := parseValues(testPuzzleSDM)
+	r := ratePuzzle(entry{name: "test", summary: s})
+	if r.Error != "" || r.Rating != 5 || r.Solutions != 1 || r.Choices != 3 {
+		t.Errorf("Got rating %+v", *r)
+	}
+	total := 0
+	for _, count := range r.Tiers {
+		total += count
+	}
+	if r.Empty != 56 || total != r.Empty {
+		t.Errorf("Got %d empty squares, with tiers %v", r.Empty, r.Tiers)
+	}
+	bad, _ := parseValues("11" + strings.Repeat(".", 14))
+	if r := ratePuzzle(entry{name: "bad", summary: bad}); r.Error == "" {
+		t.Errorf("No error rating an unsolvable puzzle")
+	}
+}
+
+func TestRateAll(t *testing.T) {
+	var entries []entry
+	for _, sdm := range []string{testPuzzleSDM, testSolutionSDM, "..343412..434321"} {
+		s, _ := parseValues(sdm)
+		entries = append(entries, entry{name: sdm, summary: s})
+	}
+	serial := rateAll(entries, 1)
+	parallel := rateAll(entries, 4)
+	for i := range entries {
+		serial[i].Millis, parallel[i].Millis = 0, 0
+		if !reflect.DeepEqual(serial[i], parallel[i]) {
+			t.Errorf("Puzzle %d: serial %+v, parallel %+v", i, *serial[i], *parallel[i])
+		}
+	}
+	if serial[1].Empty != 0 || serial[2].Solutions != 2 {
+		t.Errorf("Got ratings %+v and %+v", *serial[1], *serial[2])
+	}
+}
+
+func TestRateCommand(t *testing.T) {
+	in := testPuzzleSDM + "\n" + testSolutionSDM + "\n"
+	out, err := runSubcommand(t, in, "rate", "-workers", "2")
+	if err != nil {
+		t.Fatalf("Rate failed: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Got %q, %v", out, err)
+	}
+	header := "puzzle,rating,solutions,choices,empty,single,bound,deduced,choice,millis,error"
+	if strings.Join(records[0], ",") != header {
+		t.Errorf("Header is %v", records[0])
+	}
+	if got := strings.Join(records[1][:5], ","); got != "stdin:1,5,1,3,56" {
+		t.Errorf("First row starts %v", got)
+	}
+
+	out, err = runSubcommand(t, in, "rate", "-format", "json")
+	var ratings []puzzleRating
+	if err != nil || json.Unmarshal([]byte(out), &ratings) != nil || len(ratings) != 2 {
+		t.Fatalf("Got %q, %v", out, err)
+	}
+	if ratings[1].Puzzle != "stdin:2" || ratings[1].Rating == 0 {
+		t.Errorf("Second rating is %+v", ratings[1])
+	}
+	if _, err := runSubcommand(t, in, "rate", "-format", "xml"); err == nil {
+		t.Errorf("No error for a bogus format")
+	}
+}
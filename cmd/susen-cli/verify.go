@@ -0,0 +1,163 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"strings"
+)
+
+/*
+
+solution verification
+
+Third-party puzzle books come with solutions, and they aren't
+always right: a misprinted square, a solution to some other
+puzzle, or a puzzle that doesn't have a unique solution at all.
+The verify subcommand reads a collection of puzzles, each
+followed by its claimed solution, and checks that each solution
+is complete, agrees with its puzzle's clues, has no value twice
+in any group, and is the only solution the puzzle has.
+
+*/
+
+// A verification describes how a claimed solution checked out.
+type verification struct {
+	wrong     []int // the squares where the solution is wrong
+	solutions int   // how many solutions the puzzle has, up to 2
+}
+
+// verify checks a claimed solution against its puzzle.
+func verify(summary, solution *puzzle.Summary) (*verification, error) {
+	if solution.SideLength != summary.SideLength {
+		return nil, fmt.Errorf("solution is %dx%d but puzzle is %dx%d",
+			solution.SideLength, solution.SideLength, summary.SideLength, summary.SideLength)
+	}
+	for _, v := range solution.Values {
+		if v == 0 {
+			return nil, fmt.Errorf("solution isn't complete")
+		}
+	}
+	p, err := puzzle.New(summary)
+	if err != nil {
+		return nil, err
+	}
+	v := &verification{}
+	if v.wrong, err = p.VerifySolution(solution.Values); err != nil {
+		return nil, err
+	}
+	solutions, err := p.SolveContext(context.Background(), 2)
+	if err != nil {
+		return nil, err
+	}
+	v.solutions = len(solutions)
+	return v, nil
+}
+
+// ok reports whether the claimed solution is the puzzle's only
+// solution.
+func (v *verification) ok() bool {
+	return len(v.wrong) == 0 && v.solutions == 1
+}
+
+// describe says what's wrong with the solution or the puzzle.
+func (v *verification) describe(side int) string {
+	if v.ok() {
+		return "ok"
+	}
+	var problems []string
+	if len(v.wrong) > 0 {
+		problems = append(problems, "solution is wrong at "+strings.Join(v.squareNames(side), " "))
+	}
+	switch v.solutions {
+	case 0:
+		problems = append(problems, "puzzle has no solution")
+	case 1:
+	default:
+		problems = append(problems, "puzzle has more than one solution")
+	}
+	return strings.Join(problems, "; ")
+}
+
+// squareNames names the squares where the solution is wrong.
+func (v *verification) squareNames(side int) []string {
+	names := make([]string, len(v.wrong))
+	for i, idx := range v.wrong {
+		names[i] = squareName(idx, side)
+	}
+	return names
+}
+
+// A verificationReport is the JSON form of a verification.
+type verificationReport struct {
+	Puzzle    string   `json:"puzzle"`
+	Solution  string   `json:"solution"`
+	OK        bool     `json:"ok"`
+	Wrong     []string `json:"wrong,omitempty"`
+	Solutions int      `json:"solutions"` // 2 means 2 or more
+}
+
+func verifyCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("verify", "[file ...]")
+	from := fs.String("from", autoFormat, "input format (auto, json, sdm, or sdk)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entries, err := readCollections(fs.Args(), in, *from)
+	if err != nil {
+		return err
+	}
+	var failed failures
+	for i := 0; i < len(entries); i += 2 {
+		e := entries[i]
+		if i+1 == len(entries) {
+			failed.note(e, fmt.Errorf("puzzle has no solution after it"))
+			break
+		}
+		s := entries[i+1]
+		if e.err != nil {
+			failed.note(e, e.err)
+			continue
+		}
+		if s.err != nil {
+			failed.note(s, s.err)
+			continue
+		}
+		v, err := verify(e.summary, s.summary)
+		if err != nil {
+			failed.note(e, err)
+			continue
+		}
+		if jsonOutput {
+			err = writeJSONLine(out, verificationReport{e.name, s.name, v.ok(),
+				v.squareNames(e.summary.SideLength), v.solutions})
+		} else {
+			_, err = fmt.Fprintf(out, "%s: %s\n", e.name, v.describe(e.summary.SideLength))
+		}
+		if err != nil {
+			failed.note(e, err)
+		} else if !v.ok() {
+			failed++
+		}
+	}
+	return failed.err()
+}
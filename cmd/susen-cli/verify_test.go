@@ -0,0 +1,87 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	s, _ := parseValues(testPuzzleSDM)
+	solution, _ := parseValues(testSolutionSDM)
+	if v, err := verify(s, solution); err != nil || !v.ok() || v.describe(9) != "ok" {
+		t.Errorf("Verifying the solution gave %+v, %v", v, err)
+	}
+
+	// swapping the first two squares breaks their column and tile
+	// and contradicts no clues
+	swapped := append([]int(nil), solution.Values...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	v, err := verify(s, &puzzle.Summary{Geometry: s.Geometry, SideLength: 9, Values: swapped})
+	if err != nil || v.ok() || v.solutions != 1 {
+		t.Fatalf("Verifying a swapped solution gave %+v, %v", v, err)
+	}
+	if d := v.describe(9); !strings.HasPrefix(d, "solution is wrong at a1 a2 ") {
+		t.Errorf("Description is %q", d)
+	}
+
+	ambiguous, _ := parseValues("..343412..434321")
+	first, _ := parseValues("1234341221434321")
+	if v, err := verify(ambiguous, first); err != nil || v.solutions != 2 || len(v.wrong) != 0 {
+		t.Errorf("Verifying an ambiguous puzzle gave %+v, %v", v, err)
+	} else if d := v.describe(4); d != "puzzle has more than one solution" {
+		t.Errorf("Description is %q", d)
+	}
+
+	if _, err := verify(s, first); err == nil {
+		t.Errorf("Verified a solution of the wrong size")
+	}
+	if _, err := verify(s, s); err == nil {
+		t.Errorf("Verified an incomplete solution")
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	in := strings.Join([]string{testPuzzleSDM, testSolutionSDM, "..343412..434321", "1234341221434321"}, "\n")
+	out, err := runSubcommand(t, in+"\n", "verify")
+	if err == nil || err.Error() != "1 puzzle(s) failed" {
+		t.Errorf("Got error %v, expected one failure", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], ": ok") ||
+		!strings.HasSuffix(lines[1], ": puzzle has more than one solution") {
+		t.Errorf("Got output %q", out)
+	}
+
+	out, err = runSubcommand(t, testPuzzleSDM+"\n", "verify")
+	if err == nil || out != "" {
+		t.Errorf("Verified a puzzle without a solution: %q, %v", out, err)
+	}
+	out, err = runSubcommand(t, in+"\n", "verify", "-json")
+	reports := decodeLines[verificationReport](t, out)
+	if len(reports) != 2 || !reports[0].OK || reports[1].OK || reports[1].Solutions != 2 {
+		t.Errorf("Got reports %+v, %v", reports, err)
+	}
+	if !reflect.DeepEqual(reports[0].Wrong, []string(nil)) {
+		t.Errorf("Got wrong squares %v", reports[0].Wrong)
+	}
+}
@@ -0,0 +1,537 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+admin endpoints
+
+The admin API lives under /admin/ and requires the configured
+admin token as a bearer token.  With no token configured, the
+admin API doesn't exist.
+
+	GET    /admin/sessions[?limit=n]  list sessions, latest first
+	DELETE /admin/sessions/<id>       evict a session from the cache
+	GET    /admin/validate/<id>       validate a session's active puzzle
+	GET    /admin/memory/<id>         estimate a session's active puzzle's memory use
+	GET    /admin/badges/<id>         list a session's earned and available badges
+	GET    /admin/stats/<id>          gather a session's play statistics
+	GET    /admin/mistakes/<puzzle>   analyze the mistakes made on a puzzle
+	GET    /admin/calibration         compare the rating bands with observed difficulty
+	POST   /admin/calibration         apply the proposed rating bands (or RatingBands body)
+	GET    /admin/storage             storage usage counts
+	GET    /admin/backup              download a backup of all stored data
+	POST   /admin/restore             replace all stored data with a backup (Backup body)
+	POST   /admin/upgrade             upgrade cached puzzle summaries to the current schema
+	GET    /admin/library             list library puzzles
+	POST   /admin/library/<name>      add a library puzzle (Summary body)
+	DELETE /admin/library/<name>      remove a library puzzle
+	GET    /admin/daily               list queued daily puzzles
+	POST   /admin/daily/<date>        queue a library puzzle for a day (?puzzle=name)
+	DELETE /admin/daily/<date>        unqueue a day's puzzle (?rating=n)
+	GET    /admin/tournaments         list tournaments, with all their puzzles
+	POST   /admin/tournaments/<name>  create a tournament (RoundSpec array body)
+	DELETE /admin/tournaments/<name>  remove a tournament
+	DELETE /admin/replays/<id>        remove a replay from the replay library
+	GET    /admin/lessons             list lessons
+	POST   /admin/lessons/<name>      add a lesson (Lesson body)
+	DELETE /admin/lessons/<name>      remove a lesson
+	POST   /admin/teachers/<name>     add a teacher, returning their token
+	POST   /admin/refill              run the registered pool refills
+	GET    /admin/features            list feature flags
+	PUT    /admin/features/<name>     set a feature flag ({"enabled": bool} body)
+	GET    /admin/audit[?query]       list audit log entries, latest first (see auditQuery)
+	GET    /admin/config              list settings, with their values and sources
+	POST   /admin/config              reload the config file's live settings
+	PUT    /admin/config/<name>       change a live setting ({"value": string} body)
+
+Every request that changes something is recorded in the audit
+log, as are requests rejected for a wrong token.  Admin requests
+are rate limited like any others, so guessing at the token is
+slow.
+
+*/
+
+// admin flags
+var (
+	adminToken = flagString("admin-token", "ADMIN_TOKEN", "",
+		"bearer token required for the admin API (no token disables it)")
+)
+
+// admin endpoint pattern: the resource and an optional name
+var adminEndpointRegexp = regexp.MustCompile("^/+admin/+([a-z]+)(?:/+([^/]+))?/*$")
+
+// requireAdmin wraps a handler so it's only reachable with the
+// admin token.  Without a configured token, everything is a 404.
+func requireAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *adminToken == "" {
+			puzzle.SendError(puzzle.RequestError(puzzle.UnknownEndpointCondition, r.URL.Path), w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="susen-admin"`)
+			puzzle.SendError(puzzle.RequestError(puzzle.NotAuthorizedCondition, r.URL.Path), w, r)
+			slog.Warn("Rejected admin request", "path", r.URL.Path, "address", clientAddress(r))
+			auditRejection(r, "admin.reject", token)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminHandler dispatches admin requests.
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("Error in admin request", "path", r.URL.Path, "error", err)
+			recordFor(r).noteError(puzzle.SendError(puzzle.InternalError("adminHandler", err), w, r))
+		}
+	}()
+
+	notFound := func() {
+		puzzle.SendError(puzzle.RequestError(puzzle.UnknownEndpointCondition, r.URL.Path), w, r)
+	}
+	matches := adminEndpointRegexp.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		notFound()
+		return
+	}
+	resource, name := matches[1], matches[2]
+	route := r.Method + " " + resource
+	if name != "" {
+		route += "/"
+	}
+	switch route {
+	case "GET sessions":
+		limit := 100
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+			limit = n
+		}
+		writeJSON(w, r, http.StatusOK, storage.ListSessions(limit))
+	case "DELETE sessions/":
+		count := storage.EvictSession(name)
+		slog.Info("Evicted session", "session", name, "keys", count)
+		audit(r, adminActor, "session.evict", name, map[string]interface{}{"keys": count})
+		writeJSON(w, r, http.StatusOK, map[string]int{"evicted": count})
+	case "GET validate/":
+		errs, ok := storage.ValidateSession(name)
+		if !ok {
+			notFound()
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"valid": errs == nil, "errors": errs})
+	case "GET memory/":
+		ms, ok := storage.SessionMemStats(name)
+		if !ok {
+			notFound()
+			return
+		}
+		writeJSON(w, r, http.StatusOK, ms)
+	case "GET badges/":
+		earned, available := storage.EvaluateBadges(storage.Completions(name))
+		writeJSON(w, r, http.StatusOK, badgeInfo{earned, available})
+	case "GET stats/":
+		writeJSON(w, r, http.StatusOK, storage.SessionStatistics(name))
+	case "GET mistakes/":
+		writeJSON(w, r, http.StatusOK, storage.PuzzleMistakes(strings.ToUpper(name)))
+	case "GET calibration":
+		writeJSON(w, r, http.StatusOK, storage.CurrentCalibration())
+	case "POST calibration":
+		c := storage.CurrentCalibration()
+		bands := c.Proposed
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&bands); err != nil {
+				puzzle.SendError(puzzle.DecodeError(err), w, r)
+				return
+			}
+		}
+		if err := storage.ApplyRatingBands(bands, c.Puzzles); err != nil {
+			if perr, ok := err.(puzzle.Error); ok {
+				puzzle.SendError(perr, w, r)
+			} else {
+				puzzle.SendError(puzzle.InternalError("applyRatingBands", err), w, r)
+			}
+			return
+		}
+		slog.Info("Applied rating bands", "bands", bands, "puzzles", c.Puzzles)
+		audit(r, adminActor, "calibration.apply", "", map[string]interface{}{"bands": bands})
+		writeJSON(w, r, http.StatusOK, bands)
+	case "GET storage":
+		writeJSON(w, r, http.StatusOK, storage.Usage())
+	case "GET backup":
+		b := storage.MakeBackup()
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="susen-backup-%s.json"`, b.Created.Format("2006-01-02")))
+		slog.Info("Made backup", "schema", b.Schema, "tables", len(b.Tables))
+		audit(r, adminActor, "backup.make", "", map[string]interface{}{"schema": b.Schema})
+		writeJSON(w, r, http.StatusOK, b)
+	case "POST restore":
+		var b storage.Backup
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		count, err := storage.RestoreBackup(&b)
+		if err != nil {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, err.Error()), w, r)
+			return
+		}
+		slog.Info("Restored backup", "created", b.Created, "schema", b.Schema, "rows", count)
+		audit(r, adminActor, "backup.restore", "",
+			map[string]interface{}{"created": b.Created, "schema": b.Schema, "rows": count})
+		writeJSON(w, r, http.StatusOK, map[string]int{"restored": count})
+	case "POST upgrade":
+		report := storage.UpgradeSummaries()
+		slog.Info("Upgraded summaries", "schema", puzzle.SummarySchema,
+			"upgraded", report.Upgraded, "dropped", report.Dropped)
+		audit(r, adminActor, "summaries.upgrade", "",
+			map[string]interface{}{"upgraded": report.Upgraded, "dropped": report.Dropped})
+		writeJSON(w, r, http.StatusOK, report)
+	case "GET library":
+		infos := storage.LibraryPuzzles()
+		sort.Sort(storage.ByName(infos))
+		writeJSON(w, r, http.StatusOK, infos)
+	case "POST library/":
+		var summary puzzle.Summary
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		info := storage.AddLibraryPuzzle(name, &summary)
+		slog.Info("Added library puzzle", "puzzle", info.Name, "id", info.PuzzleId)
+		audit(r, adminActor, "library.add", info.Name, map[string]interface{}{"puzzleId": info.PuzzleId})
+		writeJSON(w, r, http.StatusCreated, info)
+	case "DELETE library/":
+		if !storage.RemoveLibraryPuzzle(name) {
+			notFound()
+			return
+		}
+		slog.Info("Removed library puzzle", "puzzle", name)
+		audit(r, adminActor, "library.remove", name, nil)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET daily":
+		writeJSON(w, r, http.StatusOK, dailyListings(storage.QueuedDailies()))
+	case "POST daily/":
+		date, ok := parseDailyDate(name, time.Now())
+		if !ok {
+			notFound()
+			return
+		}
+		d, err := storage.QueueDaily(date, r.URL.Query().Get("puzzle"))
+		if err != nil {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, err.Error()), w, r)
+			return
+		}
+		slog.Info("Queued daily puzzle", "date", name, "rating", d.Rating, "puzzle", d.Info.Name)
+		audit(r, adminActor, "daily.queue", name,
+			map[string]interface{}{"rating": d.Rating, "puzzle": d.Info.Name})
+		writeJSON(w, r, http.StatusCreated, dailyListings([]*storage.DailyPuzzle{d})[0])
+	case "DELETE daily/":
+		date, ok := parseDailyDate(name, time.Now())
+		rating, err := strconv.Atoi(r.URL.Query().Get("rating"))
+		if !ok || err != nil || !storage.UnqueueDaily(date, rating) {
+			notFound()
+			return
+		}
+		slog.Info("Unqueued daily puzzle", "date", name, "rating", rating)
+		audit(r, adminActor, "daily.unqueue", name, map[string]interface{}{"rating": rating})
+		w.WriteHeader(http.StatusNoContent)
+	case "GET tournaments":
+		// as of the far future, so every round's puzzle is shown
+		future := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+		writeJSON(w, r, http.StatusOK, tournamentListings(storage.Tournaments(future)))
+	case "POST tournaments/":
+		var specs []storage.RoundSpec
+		if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		t, err := storage.CreateTournament(name, specs)
+		if err != nil {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, err.Error()), w, r)
+			return
+		}
+		slog.Info("Created tournament", "tournament", t.Name, "rounds", len(t.Rounds))
+		audit(r, adminActor, "tournament.create", t.Name, map[string]interface{}{"rounds": len(t.Rounds)})
+		writeJSON(w, r, http.StatusCreated, tournamentListings([]*storage.Tournament{t})[0])
+	case "DELETE tournaments/":
+		if !storage.DeleteTournament(name) {
+			notFound()
+			return
+		}
+		slog.Info("Removed tournament", "tournament", name)
+		audit(r, adminActor, "tournament.remove", name, nil)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE replays/":
+		id, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || !storage.DeleteReplay(id) {
+			notFound()
+			return
+		}
+		slog.Info("Removed replay", "replay", id)
+		audit(r, adminActor, "replay.remove", name, nil)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET lessons":
+		writeJSON(w, r, http.StatusOK, storage.Lessons())
+	case "POST lessons/":
+		var lesson storage.Lesson
+		if err := json.NewDecoder(r.Body).Decode(&lesson); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		lesson.Name = name
+		added := storage.AddLesson(&lesson)
+		slog.Info("Added lesson", "lesson", added.Name, "examples", len(added.Examples))
+		audit(r, adminActor, "lesson.add", added.Name, map[string]interface{}{"examples": len(added.Examples)})
+		writeJSON(w, r, http.StatusCreated, added)
+	case "DELETE lessons/":
+		if !storage.RemoveLesson(name) {
+			notFound()
+			return
+		}
+		slog.Info("Removed lesson", "lesson", name)
+		audit(r, adminActor, "lesson.remove", name, nil)
+		w.WriteHeader(http.StatusNoContent)
+	case "POST teachers/":
+		if !storage.ValidLessonName(name) {
+			notFound()
+			return
+		}
+		token := storage.AddTeacher(name)
+		if token == "" {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, name), w, r)
+			return
+		}
+		slog.Info("Added teacher", "teacher", name)
+		audit(r, adminActor, "teacher.add", name, nil)
+		writeJSON(w, r, http.StatusCreated, map[string]string{"teacher": name, "token": token})
+	case "POST refill":
+		results := runRefills()
+		audit(r, adminActor, "pools.refill", "", results)
+		writeJSON(w, r, http.StatusOK, results)
+	case "GET features":
+		writeJSON(w, r, http.StatusOK, features.all())
+	case "PUT features/":
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err == nil && body.Enabled == nil {
+			err = fmt.Errorf("Missing enabled value")
+		}
+		if err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		features.set(name, *body.Enabled)
+		slog.Info("Set feature flag", "feature", name, "enabled", *body.Enabled)
+		audit(r, adminActor, "feature.set", name, map[string]interface{}{"enabled": *body.Enabled})
+		writeJSON(w, r, http.StatusOK, features.all())
+	case "GET config":
+		writeJSON(w, r, http.StatusOK, settings())
+	case "POST config":
+		changed, err := reloadConfig()
+		if changed != nil {
+			audit(r, adminActor, "config.reload", "", map[string]interface{}{"changed": changed})
+		}
+		if err != nil {
+			puzzle.SendError(puzzle.InternalError("reloadConfig", err), w, r)
+			return
+		}
+		slog.Info("Reloaded config file", "file", *configFile, "changed", changed)
+		writeJSON(w, r, http.StatusOK, map[string][]string{"changed": changed})
+	case "PUT config/":
+		var body struct {
+			Value *string `json:"value"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err == nil && body.Value == nil {
+			err = fmt.Errorf("Missing value")
+		}
+		if err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		if flag.Lookup(name) == nil {
+			notFound()
+			return
+		}
+		if err := setSetting(name, *body.Value); err != nil {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, err.Error()), w, r)
+			return
+		}
+		slog.Info("Changed setting", "setting", name, "value", *body.Value)
+		audit(r, adminActor, "config.set", name, map[string]interface{}{"value": *body.Value})
+		writeJSON(w, r, http.StatusOK, settings())
+	case "GET audit":
+		q, bad := auditQuery(r)
+		if bad != "" {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, bad), w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, storage.AuditLog(q))
+	default:
+		notFound()
+	}
+}
+
+/*
+
+pool refills
+
+Subsystems that keep pools of prepared puzzles register a refill
+function, which the admin API can trigger on demand.
+
+*/
+
+var (
+	refillMutex sync.Mutex
+	refills     = make(map[string]func() (int, error))
+)
+
+// registerRefill makes a named pool refill available to admins.
+// The function returns how many items it added.
+func registerRefill(name string, refill func() (int, error)) {
+	refillMutex.Lock()
+	defer refillMutex.Unlock()
+	refills[name] = refill
+}
+
+// runRefills runs every registered refill, reporting for each
+// pool either the count added or the error.
+func runRefills() map[string]interface{} {
+	refillMutex.Lock()
+	defer refillMutex.Unlock()
+	results := make(map[string]interface{}, len(refills))
+	for name, refill := range refills {
+		if count, err := refill(); err != nil {
+			slog.Warn("Pool refill failed", "pool", name, "error", err)
+			results[name] = map[string]string{"error": err.Error()}
+		} else {
+			slog.Info("Refilled pool", "pool", name, "added", count)
+			results[name] = map[string]int{"added": count}
+		}
+	}
+	return results
+}
+
+/*
+
+feature flags
+
+Feature flags are named booleans that can be flipped at runtime
+by admins.  They start off unless listed in the features setting,
+and changing that setting (it's live) resets them all to match.
+The flags the server knows:
+
+	hints     the hint endpoint
+	variants  camera intake of puzzles with non-square geometries
+
+*/
+
+var featureList = flagString("features", "FEATURES", "",
+	"comma-separated feature flags to turn on at startup")
+
+// A featureSet is a concurrency-safe set of named flags.
+type featureSet struct {
+	once  sync.Once
+	mutex sync.RWMutex
+	flags map[string]bool
+}
+
+var features featureSet
+
+// init loads the startup flags on first use.
+func (fs *featureSet) init() {
+	fs.once.Do(func() { fs.flags = parseFeatures(*featureList) })
+}
+
+// load replaces all the flags with those in a list.
+func (fs *featureSet) load(list string) {
+	fs.init()
+	flags := parseFeatures(list)
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.flags = flags
+}
+
+// parseFeatures returns the flags turned on by a comma-separated
+// list of names.
+func parseFeatures(list string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			flags[name] = true
+		}
+	}
+	return flags
+}
+
+// applyFeatures resets the feature flags to the features setting.
+func applyFeatures() error {
+	features.load(*featureList)
+	return nil
+}
+
+// enabled reports whether the named feature is on.
+func (fs *featureSet) enabled(name string) bool {
+	fs.init()
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	return fs.flags[name]
+}
+
+// set turns the named feature on or off.
+func (fs *featureSet) set(name string, on bool) {
+	fs.init()
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.flags[name] = on
+}
+
+// all returns a copy of every known flag.
+func (fs *featureSet) all() map[string]bool {
+	fs.init()
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	result := make(map[string]bool, len(fs.flags))
+	for k, v := range fs.flags {
+		result[k] = v
+	}
+	return result
+}
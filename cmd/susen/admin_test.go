@@ -0,0 +1,274 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	defer func(token string) { *adminToken = token }(*adminToken)
+	h := requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(auth string) int {
+		r := httptest.NewRequest("GET", "/admin/storage", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	*adminToken = ""
+	if code := send("Bearer "); code != http.StatusNotFound {
+		t.Errorf("Admin API without a token gave status %d", code)
+	}
+	*adminToken = "secret"
+	if code := send(""); code != http.StatusUnauthorized {
+		t.Errorf("Request without credentials gave status %d", code)
+	}
+	if code := send("Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Request with wrong token gave status %d", code)
+	}
+	if code := send("Bearer secret"); code != http.StatusOK {
+		t.Errorf("Request with token gave status %d", code)
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	r := httptest.NewRequest("GET",
+		"/admin/audit?actor=admin&action=library.&since=2026-01-02&until=2026-01-03T12:00:00Z&count=5&offset=10", nil)
+	q, bad := auditQuery(r)
+	if bad != "" {
+		t.Fatalf("Valid query has bad parameter %q", bad)
+	}
+	expect := storage.AuditQuery{
+		Actor:  "admin",
+		Action: "library.",
+		Since:  time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+		Until:  time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC),
+		Count:  5,
+		Offset: 10,
+	}
+	if !q.Since.Equal(expect.Since) || !q.Until.Equal(expect.Until) {
+		t.Errorf("Query times are %v and %v", q.Since, q.Until)
+	}
+	q.Since, q.Until, expect.Since, expect.Until = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	if q != expect {
+		t.Errorf("Query is %+v, expected %+v", q, expect)
+	}
+	for query, param := range map[string]string{
+		"since=yesterday":  "since",
+		"until=2026-13-01": "until",
+		"count=many":       "count",
+		"offset=-1":        "offset",
+	} {
+		if _, bad := auditQuery(httptest.NewRequest("GET", "/admin/audit?"+query, nil)); bad != param {
+			t.Errorf("Query %q has bad parameter %q, expected %q", query, bad, param)
+		}
+	}
+}
+
+func TestAdminFeatures(t *testing.T) {
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		adminHandler(w, r)
+		return w
+	}
+	if w := send("PUT", "/admin/features/hints", `{"enabled": true}`); w.Code != http.StatusOK {
+		t.Fatalf("Setting feature gave status %d", w.Code)
+	}
+	if !features.enabled("hints") {
+		t.Errorf("Feature wasn't turned on")
+	}
+	if w := send("PUT", "/admin/features/hints", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Setting feature without a value gave status %d", w.Code)
+	}
+	w := send("GET", "/admin/features", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"hints":true`) {
+		t.Errorf("Listing features gave %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("GET", "/admin/nosuch", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown admin resource gave status %d", w.Code)
+	}
+	if w := send("PATCH", "/admin/features/hints", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown admin method gave status %d", w.Code)
+	}
+}
+
+func TestAdminRefill(t *testing.T) {
+	registerRefill("good", func() (int, error) { return 3, nil })
+	registerRefill("bad", func() (int, error) { return 0, errors.New("empty") })
+	defer func() {
+		delete(refills, "good")
+		delete(refills, "bad")
+	}()
+	r := httptest.NewRequest("POST", "/admin/refill", nil)
+	w := httptest.NewRecorder()
+	adminHandler(w, r)
+	body := w.Body.String()
+	if w.Code != http.StatusOK ||
+		!strings.Contains(body, `"good":{"added":3}`) || !strings.Contains(body, `"bad":{"error":"empty"}`) {
+		t.Errorf("Refill gave %d: %s", w.Code, body)
+	}
+}
+
+func TestCalibrationEndpoint(t *testing.T) {
+	storageConnect(t, "TestCalibrationEndpoint")
+	defer storage.Close()
+	defer storage.ApplyRatingBands(puzzle.DefaultRatingBands, 0)
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/admin/calibration", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		adminHandler(w, r)
+		return w
+	}
+	w := send("GET", "")
+	var c storage.Calibration
+	if err := json.Unmarshal(w.Body.Bytes(), &c); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Calibration gave %d (%v): %s", w.Code, err, w.Body.String())
+	}
+	if c.Current != puzzle.CurrentRatingBands() {
+		t.Errorf("Calibration current bands are %+v", c.Current)
+	}
+	if w := send("POST", `{"boundFraction": 1, "wideChoice": 3, "fiveStarChoices": 4}`); w.Code != http.StatusOK {
+		t.Errorf("Applying bands gave %d: %s", w.Code, w.Body.String())
+	}
+	expect := puzzle.RatingBands{BoundFraction: 1, WideChoice: 3, FiveStarChoices: 4}
+	if b := puzzle.CurrentRatingBands(); b != expect {
+		t.Errorf("Applied bands are %+v, expected %+v", b, expect)
+	}
+	if w := send("POST", `{"boundFraction": 1, "wideChoice": 0, "fiveStarChoices": 4}`); w.Code == http.StatusOK {
+		t.Errorf("Applying invalid bands succeeded: %s", w.Body.String())
+	}
+	if w := send("POST", ""); w.Code != http.StatusOK {
+		t.Errorf("Applying proposed bands gave %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDailyQueueEndpoint(t *testing.T) {
+	storageConnect(t, "TestDailyQueueEndpoint")
+	defer storage.Close()
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		adminHandler(w, r)
+		return w
+	}
+	date := time.Now().AddDate(0, 0, 1000).Format(dailyDateFormat)
+	w := send("POST", "/admin/daily/"+date+"?puzzle="+sampleDefaultName)
+	var queued dailyListing
+	if err := json.Unmarshal(w.Body.Bytes(), &queued); w.Code != http.StatusCreated || err != nil {
+		t.Fatalf("Queueing gave %d (%v): %s", w.Code, err, w.Body.String())
+	}
+	defer storage.UnqueueDaily(time.Now().AddDate(0, 0, 1000), queued.Rating)
+	if queued.Date != date || queued.Name != sampleDefaultName {
+		t.Errorf("Queued %+v", queued)
+	}
+	if w := send("GET", "/admin/daily"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), date) {
+		t.Errorf("Queue listing gave %d: %s", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/admin/daily/yesterday?puzzle=" + sampleDefaultName, "/admin/daily/" + date + "?puzzle=no-such-puzzle"} {
+		if w := send("POST", path); w.Code == http.StatusCreated {
+			t.Errorf("Queueing with %q succeeded: %s", path, w.Body.String())
+		}
+	}
+	path := fmt.Sprintf("/admin/daily/%s?rating=%d", date, queued.Rating)
+	if w := send("DELETE", path); w.Code != http.StatusNoContent {
+		t.Errorf("Unqueueing gave %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("DELETE", path); w.Code != http.StatusNotFound {
+		t.Errorf("Unqueueing twice gave %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBackupEndpoint(t *testing.T) {
+	storageConnect(t, "TestBackupEndpoint")
+	defer storage.Close()
+
+	r := httptest.NewRequest("GET", "/admin/backup", nil)
+	w := httptest.NewRecorder()
+	adminHandler(w, r)
+	var b storage.Backup
+	if err := json.Unmarshal(w.Body.Bytes(), &b); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Backup gave %d (%v): %.200s", w.Code, err, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") || b.Format != storage.BackupFormat {
+		t.Errorf("Backup has format %d, disposition %q", b.Format, w.Header().Get("Content-Disposition"))
+	}
+	r = httptest.NewRequest("POST", "/admin/restore", strings.NewReader(w.Body.String()))
+	w = httptest.NewRecorder()
+	adminHandler(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"restored":`) {
+		t.Errorf("Restore gave %d: %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{"not json", `{"format": 0}`} {
+		r = httptest.NewRequest("POST", "/admin/restore", strings.NewReader(body))
+		w = httptest.NewRecorder()
+		adminHandler(w, r)
+		if w.Code == http.StatusOK {
+			t.Errorf("Restore of %q succeeded: %s", body, w.Body.String())
+		}
+	}
+}
+
+func TestAuditEndpoint(t *testing.T) {
+	storageConnect(t, "TestAuditEndpoint")
+	defer storage.Close()
+
+	name := fmt.Sprintf("audit-%d", time.Now().UnixNano())
+	r := httptest.NewRequest("DELETE", "/admin/sessions/"+name, nil)
+	r.RemoteAddr = "192.0.2.7:1234"
+	adminHandler(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("GET", "/admin/audit?action=session.&target="+name, nil)
+	w := httptest.NewRecorder()
+	adminHandler(w, r)
+	var entries []storage.AuditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Audit query gave %d (%v): %s", w.Code, err, w.Body.String())
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Audit log for %s is %+v", name, entries)
+	}
+	if e := entries[0]; e.Actor != adminActor || e.Action != "session.evict" || e.Address != "192.0.2.7" {
+		t.Errorf("Eviction audit entry is %+v", e)
+	}
+
+	r = httptest.NewRequest("GET", "/admin/audit?count=none", nil)
+	w = httptest.NewRecorder()
+	adminHandler(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Bad audit query gave %d: %s", w.Code, w.Body.String())
+	}
+}
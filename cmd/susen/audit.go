@@ -0,0 +1,111 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+
+audit logging
+
+Admin actions that change things, and requests turned away for
+bad credentials, go in the audit log along with the client
+address they came from.  Requests turned away for having no
+credentials at all aren't audited: they're mostly crawlers and
+scanners, and would fill the log with noise.  The action has already happened (or been
+refused) by the time it's audited, so a storage failure while
+auditing loses the entry, loudly, but doesn't fail the request.
+
+*/
+
+// Audit actors, other than teachers (see teacherActor).
+const (
+	adminActor   = "admin"
+	unknownActor = "unknown" // a request with bad credentials
+)
+
+// teacherActor is the audit actor for a teacher.  The prefix keeps
+// teachers from being mistaken for the other actors.
+func teacherActor(name string) string {
+	return "teacher:" + name
+}
+
+// audit records an action in the audit log.
+func audit(r *http.Request, actor, action, target string, details map[string]interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("Lost audit entry", "actor", actor, "action", action,
+				"target", target, "error", err)
+		}
+	}()
+	storage.RecordAudit(actor, action, target, clientAddress(r), details)
+}
+
+// auditRejection records a request turned away because its
+// bearer token was wrong, unless it had no token at all.
+func auditRejection(r *http.Request, action, token string) {
+	if token == "" {
+		return
+	}
+	audit(r, unknownActor, action, r.URL.Path, map[string]interface{}{"method": r.Method})
+}
+
+// auditQuery reads an audit log query from a request's parameters:
+// actor, action (or a prefix ending in "."), target, since and
+// until (RFC 3339 times or dates), count and offset.  If one of
+// them doesn't make sense, its name comes back with the query.
+func auditQuery(r *http.Request) (storage.AuditQuery, string) {
+	v := r.URL.Query()
+	q := storage.AuditQuery{Actor: v.Get("actor"), Action: v.Get("action"), Target: v.Get("target")}
+	for _, t := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		s := v.Get(t.name)
+		if s == "" {
+			continue
+		}
+		var err error
+		if *t.dest, err = time.Parse(time.RFC3339, s); err != nil {
+			if *t.dest, err = time.Parse("2006-01-02", s); err != nil {
+				return q, t.name
+			}
+		}
+	}
+	for _, n := range []struct {
+		name string
+		dest *int
+	}{{"count", &q.Count}, {"offset", &q.Offset}} {
+		s := v.Get(n.name)
+		if s == "" {
+			continue
+		}
+		var err error
+		if *n.dest, err = strconv.Atoi(s); err != nil || *n.dest < 0 {
+			return q, n.name
+		}
+	}
+	return q, ""
+}
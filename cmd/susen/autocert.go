@@ -0,0 +1,69 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+//go:build autocert
+
+package main
+
+import (
+	"context"
+	"github.com/ancientHacker/susen.go/storage"
+	"golang.org/x/crypto/acme/autocert"
+	"log/slog"
+	"net/http"
+)
+
+// listenAutocert serves HTTPS using certificates obtained for the
+// given domains, cached either in the given directory or (if
+// that's empty) in the database.  It also listens on the
+// challenge address, to answer ACME challenges and redirect
+// other requests to HTTPS.
+func listenAutocert(srv *http.Server, domains []string, cacheDir, challengeAddr string) error {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+	}
+	if cacheDir != "" {
+		m.Cache = autocert.DirCache(cacheDir)
+	} else {
+		m.Cache = certCache{}
+	}
+	srv.TLSConfig = m.TLSConfig()
+	go func() {
+		err := http.ListenAndServe(challengeAddr, m.HTTPHandler(nil))
+		slog.Error("ACME challenge listener failure", "error", err)
+	}()
+	slog.Info("Serving HTTPS", "domains", domains)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// certCache adapts the storage certificate cache to autocert,
+// which expects its own error value for cache misses.
+type certCache struct {
+	storage.CertCache
+}
+
+var _ autocert.Cache = certCache{}
+
+func (c certCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.CertCache.Get(ctx, key)
+	if err == storage.ErrCertMiss {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, err
+}
@@ -0,0 +1,97 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+/*
+
+bookmarks
+
+Sessions bookmark library puzzles and positions in progress to
+come back to later.  Opening a bookmark makes its puzzle active
+and returns the puzzle's state, like restoring a save slot.
+
+	GET    /api/bookmarks              the session's bookmarks
+	POST   /api/bookmarks?puzzle=p[&label=l]
+	                                   bookmark a library puzzle
+	POST   /api/bookmarks[?label=l]    bookmark the active puzzle's position
+	POST   /api/bookmark?id=n          open a bookmark
+	DELETE /api/bookmark?id=n          remove a bookmark
+
+*/
+
+// bookmarkHandler serves the bookmark API endpoints.
+func (s *session) bookmarkHandler(endpoint string, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	invalid := func(arg string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+		slog.Debug("Invalid bookmark argument", "path", r.URL.Path, "argument", arg)
+	}
+	switch endpoint + " " + r.Method {
+	case "bookmarks GET":
+		writeJSON(w, r, http.StatusOK, s.ss.Bookmarks())
+	case "bookmarks POST":
+		label := q.Get("label")
+		if !storage.ValidBookmarkLabel(label) {
+			invalid(label)
+			return
+		}
+		var b *storage.Bookmark
+		if name := q.Get("puzzle"); name != "" {
+			if b = s.ss.BookmarkPuzzle(name, label); b == nil {
+				invalid(name)
+				return
+			}
+		} else {
+			b = s.ss.BookmarkPosition(label)
+		}
+		slog.Info("Added bookmark", s.attrs(), "bookmark", b.Id, "label", b.Label)
+		writeJSON(w, r, http.StatusCreated, b)
+	case "bookmark POST", "bookmark DELETE":
+		id, err := strconv.Atoi(q.Get("id"))
+		if err != nil {
+			invalid(q.Get("id"))
+			return
+		}
+		if r.Method == "DELETE" {
+			if !s.ss.RemoveBookmark(id) {
+				invalid(q.Get("id"))
+				return
+			}
+			slog.Info("Removed bookmark", s.attrs(), "bookmark", id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !s.ss.OpenBookmark(id) {
+			invalid(q.Get("id"))
+			return
+		}
+		slog.Info("Opened bookmark", s.attrs(), "bookmark", id)
+		recordFor(r).noteError(s.puzzle().StateHandler(w, r))
+	default:
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+	}
+}
@@ -0,0 +1,269 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+teacher endpoints
+
+Teachers are added by the admin API, which gives them a token.
+With it as a bearer token, a teacher can manage their classes
+and watch their students under /teach/.  Students join a class
+from their session with the /api/join endpoint.
+
+	GET  /teach/classes                   list the teacher's classes
+	POST /teach/classes/<name>            add a class ({"title": string} body)
+	GET  /teach/classes/<name>            the progress of each student in a class
+	GET  /teach/classes/<name>/<student>  the live state of a student's puzzle
+	GET  /teach/playback/<class>/<student>
+	                                      play back the moves of a student's puzzle
+	GET  /teach/assignments/<class>       list a class's assignments
+	POST /teach/assignments/<class>       add an assignment (assignmentRequest body)
+	GET  /teach/assignments/<class>/<name>[?format=csv]
+	                                      export the results of an assignment
+	     /teach/notes/<class>/<student>   a student's puzzle's notes (see serveNotes)
+
+*/
+
+// teacher endpoint pattern: the resource, an optional class name,
+// and an optional item (student or assignment) name
+var teachEndpointRegexp = regexp.MustCompile("^/+teach/+([a-z]+)(?:/+([^/]+))?(?:/+([^/]+))?/*$")
+
+// teachHandler dispatches teacher requests, once it knows who the
+// teacher is.
+func teachHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("Error in teacher request", "path", r.URL.Path, "error", err)
+			recordFor(r).noteError(puzzle.SendError(puzzle.InternalError("teachHandler", err), w, r))
+		}
+	}()
+
+	notFound := func() {
+		puzzle.SendError(puzzle.RequestError(puzzle.UnknownEndpointCondition, r.URL.Path), w, r)
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	teacher := ""
+	if token != "" {
+		teacher = storage.FindTeacher(token)
+	}
+	if teacher == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="susen-teach"`)
+		puzzle.SendError(puzzle.RequestError(puzzle.NotAuthorizedCondition, r.URL.Path), w, r)
+		slog.Warn("Rejected teacher request", "path", r.URL.Path, "address", clientAddress(r))
+		auditRejection(r, "teacher.reject", token)
+		return
+	}
+	matches := teachEndpointRegexp.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		notFound()
+		return
+	}
+	resource, name, item := matches[1], matches[2], matches[3]
+	// teacherClass returns the named class if it's the teacher's.
+	teacherClass := func() *storage.Class {
+		if class := storage.FindClass(name); class != nil && class.Teacher == teacher {
+			return class
+		}
+		notFound()
+		return nil
+	}
+
+	switch resource {
+	case "classes":
+		teachClasses(w, r, teacher, name, item, teacherClass, notFound)
+	case "playback":
+		if r.Method != "GET" {
+			puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+		} else if name == "" || item == "" {
+			notFound()
+		} else if class := teacherClass(); class != nil {
+			if ss := storage.StudentSession(class.Name, item); ss != nil {
+				writeJSON(w, r, http.StatusOK, ss.Playback())
+			} else {
+				notFound()
+			}
+		}
+	case "assignments":
+		if name == "" {
+			notFound()
+		} else if class := teacherClass(); class != nil {
+			teachAssignments(w, r, class, item, notFound)
+		}
+	case "notes":
+		if name == "" || item == "" {
+			notFound()
+		} else if class := teacherClass(); class != nil {
+			if ss := storage.StudentSession(class.Name, item); ss != nil {
+				serveNotes(ss, teacher, w, r)
+			} else {
+				notFound()
+			}
+		}
+	default:
+		notFound()
+	}
+}
+
+// teachClasses handles the teacher's requests about classes.
+func teachClasses(w http.ResponseWriter, r *http.Request, teacher, name, student string,
+	teacherClass func() *storage.Class, notFound func()) {
+	switch {
+	case r.Method == "GET" && name == "":
+		writeJSON(w, r, http.StatusOK, storage.TeacherClasses(teacher))
+	case r.Method == "POST" && name != "" && student == "":
+		var body struct {
+			Title string `json:"title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		if !storage.ValidLessonName(name) || !storage.AddClass(teacher, name, body.Title) {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, name), w, r)
+			return
+		}
+		slog.Info("Added class", "teacher", teacher, "class", name)
+		audit(r, teacherActor(teacher), "class.add", name, nil)
+		writeJSON(w, r, http.StatusCreated, storage.FindClass(name))
+	case r.Method == "GET" && student == "":
+		if class := teacherClass(); class != nil {
+			writeJSON(w, r, http.StatusOK, storage.ClassProgress(class))
+		}
+	case r.Method == "GET":
+		if class := teacherClass(); class != nil {
+			ss := storage.StudentSession(class.Name, student)
+			if ss == nil {
+				notFound()
+				return
+			}
+			state, err := ss.Puzzle.State()
+			if err != nil {
+				panic(err)
+			}
+			writeJSON(w, r, http.StatusOK, state)
+		}
+	default:
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+	}
+}
+
+// An assignmentRequest describes a new assignment.  Its puzzles
+// are library puzzles, by name.
+type assignmentRequest struct {
+	Name    string    `json:"name"`
+	Title   string    `json:"title"`
+	Due     time.Time `json:"due"`
+	Puzzles []string  `json:"puzzles"`
+}
+
+// teachAssignments handles the teacher's requests about the
+// assignments of one of their classes.
+func teachAssignments(w http.ResponseWriter, r *http.Request, class *storage.Class, name string, notFound func()) {
+	switch {
+	case r.Method == "GET" && name == "":
+		writeJSON(w, r, http.StatusOK, storage.ClassAssignments(class.Name))
+	case r.Method == "POST" && name == "":
+		var body assignmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		a, ok := body.assignment(class.Name)
+		if !ok || !storage.AddAssignment(a) {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, body.Name), w, r)
+			return
+		}
+		slog.Info("Added assignment", "class", class.Name, "assignment", a.Name, "puzzles", len(a.Puzzles))
+		audit(r, teacherActor(class.Teacher), "assignment.add", class.Name+"/"+a.Name,
+			map[string]interface{}{"puzzles": len(a.Puzzles)})
+		writeJSON(w, r, http.StatusCreated, a)
+	case r.Method == "GET":
+		a := storage.FindAssignment(class.Name, name)
+		if a == nil {
+			notFound()
+			return
+		}
+		results := storage.AssignmentResults(a)
+		if r.URL.Query().Get("format") == "csv" {
+			writeResultsCSV(w, a, results)
+		} else {
+			writeJSON(w, r, http.StatusOK, results)
+		}
+	default:
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+	}
+}
+
+// assignment makes the requested assignment for a class, looking
+// up its puzzles in the library.  It's not ok if the name is
+// invalid, there are no puzzles, or a puzzle isn't in the library.
+func (ar *assignmentRequest) assignment(class string) (*storage.Assignment, bool) {
+	if !storage.ValidLessonName(ar.Name) || len(ar.Puzzles) == 0 || ar.Due.IsZero() {
+		return nil, false
+	}
+	library := make(map[string]string)
+	for _, info := range storage.LibraryPuzzles() {
+		library[info.Name] = info.PuzzleId
+	}
+	a := &storage.Assignment{Class: class, Name: ar.Name, Title: ar.Title, Due: ar.Due}
+	for _, name := range ar.Puzzles {
+		pid, ok := library[strings.ToLower(name)]
+		if !ok {
+			return nil, false
+		}
+		a.Puzzles = append(a.Puzzles, pid)
+	}
+	return a, true
+}
+
+// writeResultsCSV exports assignment results as CSV, one row per
+// student and puzzle.
+func writeResultsCSV(w http.ResponseWriter, a *storage.Assignment, results []*storage.AssignmentResult) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.csv"`, a.Class, a.Name))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"student", "position", "puzzle", "completed", "onTime", "score"})
+	for _, r := range results {
+		completed, score := "", ""
+		if r.Completed != nil {
+			completed = r.Completed.UTC().Format(time.RFC3339)
+		}
+		if r.Score != nil {
+			score = strconv.Itoa(*r.Score)
+		}
+		cw.Write([]string{r.Student, strconv.Itoa(r.Position), r.PuzzleId, completed,
+			strconv.FormatBool(r.OnTime), score})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,171 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeachRequiresToken(t *testing.T) {
+	for _, auth := range []string{"", "Bearer "} {
+		r := httptest.NewRequest("GET", "/teach/classes", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		teachHandler(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Teacher request with auth %q gave status %d", auth, w.Code)
+		}
+	}
+}
+
+func TestAssignmentRequest(t *testing.T) {
+	due := time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, ar := range []assignmentRequest{
+		{Name: "Bad Name", Due: due, Puzzles: []string{"sample-1"}},
+		{Name: "no-puzzles", Due: due},
+		{Name: "no-due-date", Puzzles: []string{"sample-1"}},
+	} {
+		if _, ok := ar.assignment("class"); ok {
+			t.Errorf("Invalid request %+v was accepted", ar)
+		}
+	}
+}
+
+func TestWriteResultsCSV(t *testing.T) {
+	due := time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+	completed, score := due.Add(-time.Hour), 1500
+	a := &storage.Assignment{Class: "c", Name: "a", Due: due, Puzzles: []string{"P1", "P2"}}
+	results := []*storage.AssignmentResult{
+		{Student: "ann", Position: 1, PuzzleId: "P1", Completed: &completed, OnTime: true, Score: &score},
+		{Student: "ann", Position: 2, PuzzleId: "P2"},
+	}
+	w := httptest.NewRecorder()
+	writeResultsCSV(w, a, results)
+	expect := "student,position,puzzle,completed,onTime,score\n" +
+		"ann,1,P1,2016-02-29T23:00:00Z,true,1500\n" +
+		"ann,2,P2,,false,\n"
+	if body := w.Body.String(); body != expect {
+		t.Errorf("CSV was %q, expected %q", body, expect)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Content type was %q", ct)
+	}
+}
+
+func TestClassroom(t *testing.T) {
+	storageConnect(t, "TestClassroom")
+	defer storage.Close()
+
+	token := storage.AddTeacher("test-classroom-teacher")
+	if token == "" {
+		t.Fatalf("Failed to add teacher")
+	}
+	teach := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		teachHandler(w, r)
+		return w
+	}
+	if w := teach("POST", "/teach/classes/test-class", `{"title": "Test Class"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Adding a class gave status %d: %s", w.Code, w.Body)
+	}
+	if w := teach("POST", "/teach/classes/test-class", `{"title": "Again"}`); w.Code == http.StatusCreated {
+		t.Errorf("Added the same class twice")
+	}
+
+	// a student joins from their session
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Post(srv.URL+"/api/join?class=test-class&student=ann", "application/json", nil)
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Join request error: %v, %v", r, e)
+	}
+	r.Body.Close()
+	r, e = c.Post(srv.URL+"/api/join?class=no-such-class&student=ann", "application/json", nil)
+	if e != nil || r.StatusCode == http.StatusOK {
+		t.Errorf("Joining an unknown class gave %v, %v", r, e)
+	}
+	r.Body.Close()
+
+	var progress []*storage.StudentProgress
+	w := teach("GET", "/teach/classes/test-class", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Class progress gave status %d", w.Code)
+	}
+	if e := json.NewDecoder(w.Body).Decode(&progress); e != nil {
+		t.Fatalf("Failed to decode class progress: %v", e)
+	}
+	if len(progress) != 1 || progress[0].Student != "ann" || len(progress[0].Values) == 0 {
+		t.Errorf("Class progress is %+v", progress)
+	}
+	var state puzzle.Content
+	w = teach("GET", "/teach/classes/test-class/ann", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Student state gave status %d", w.Code)
+	}
+	if e := json.NewDecoder(w.Body).Decode(&state); e != nil || len(state.Squares) == 0 {
+		t.Errorf("Student state is %+v (%v)", state, e)
+	}
+	if w := teach("GET", "/teach/classes/test-class/bob", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown student gave status %d", w.Code)
+	}
+	var pb storage.Playback
+	w = teach("GET", "/teach/playback/test-class/ann", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Student playback gave status %d", w.Code)
+	}
+	if e := json.NewDecoder(w.Body).Decode(&pb); e != nil || pb.Start == nil {
+		t.Errorf("Student playback is %+v (%v)", pb, e)
+	}
+
+	// an assignment, its status for the student, and its results
+	body := `{"name": "week-1", "due": "2030-01-01T00:00:00Z", "puzzles": ["sample-1"]}`
+	if w := teach("POST", "/teach/assignments/test-class", body); w.Code != http.StatusCreated {
+		t.Fatalf("Adding an assignment gave status %d: %s", w.Code, w.Body)
+	}
+	r, e = c.Post(srv.URL+"/api/assignments?class=test-class&name=week-1&puzzle=1", "application/json", nil)
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Errorf("Starting an assignment puzzle gave %v, %v", r, e)
+	}
+	r.Body.Close()
+	if w := teach("GET", "/teach/assignments/test-class/week-1?format=csv", ""); w.Code != http.StatusOK ||
+		!strings.HasPrefix(w.Body.String(), "student,") {
+		t.Errorf("Exporting results gave status %d: %s", w.Code, w.Body)
+	}
+}
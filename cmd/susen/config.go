@@ -0,0 +1,392 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+/*
+
+server configuration
+
+The server is started with `susen serve [flags]` (or, as it
+always has been, just `susen [flags]`); the commands that work
+on puzzle files (solve, generate, rate, convert, and the rest)
+are subcommands of susen-cli.  Every setting is a flag,
+and each flag (other than -config itself) can also be set by an
+environment variable or in a config file.  The command line
+wins over the environment, and the environment wins over the
+config file.  An environment variable whose value doesn't parse
+is an error, just like a bad flag or config file setting.
+
+A config file has one setting per line, in the form `name =
+value`, where the name is the flag name.  Blank lines and lines
+starting with # are ignored, and values may be quoted:
+
+	# production settings
+	port = 8000
+	database-url = "postgres://db.example.com/susen"
+	burst-expensive = 10
+	features = hints,daily
+
+Some settings are live (see liveSettings): they can be changed
+while the server runs, either through the admin API or by
+editing the config file and sending the server a SIGHUP (or
+POST /admin/config).  A reload only changes live settings that
+came from the config file or their defaults; ones set on the
+command line, in the environment, or through the admin API stay
+as they are.  Other settings need a restart to change.
+
+*/
+
+// configuration flags
+var (
+	configFile = flag.String("config", os.Getenv("SUSEN_CONFIG"),
+		"file of flag settings, one `name = value` per line (env SUSEN_CONFIG)")
+	port = flagString("port", "PORT", "",
+		"port to listen on (default is 443 when serving HTTPS, localhost:8080 otherwise)")
+	cacheURL = flagString("cache-url", "REDISTOGO_URL", "",
+		"Redis URL for the session cache (default redis://localhost:6379/)")
+	databaseURL = flagString("database-url", "DATABASE_URL", "",
+		"Postgres URL for the database (default postgres://localhost/susen)")
+)
+
+// flagEnvVars maps flag names to the environment variables that
+// can set them.
+var flagEnvVars = make(map[string]string)
+
+// envErrors are the problems with environment variables found
+// while defining the flags.
+var envErrors []error
+
+// parseConfiguration checks the environment variables, and then
+// parses the command line arguments (without the program name),
+// and then the config file, if there is one.  A leading "serve"
+// argument is skipped.
+func parseConfiguration(fs *flag.FlagSet, args []string) error {
+	if err := errors.Join(envErrors...); err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) { settingSources[f.Name] = commandLineSource })
+	if fs.NArg() > 0 {
+		return fmt.Errorf("Unexpected arguments: %v (the only command is serve; see susen-cli for the others)", fs.Args())
+	}
+	name := fs.Lookup("config").Value.String()
+	if name == "" {
+		return nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return loadConfig(fs, f, name)
+}
+
+// loadConfig applies the settings in a config file to the flags
+// that weren't set on the command line or in the environment.
+func loadConfig(fs *flag.FlagSet, r io.Reader, source string) error {
+	settings, err := readConfig(fs, r, source)
+	if err != nil {
+		return err
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = settingSources[f.Name] != fileSource })
+	for _, cs := range settings {
+		if explicit[cs.name] || (flagEnvVars[cs.name] != "" && os.Getenv(flagEnvVars[cs.name]) != "") {
+			continue
+		}
+		if err := fs.Set(cs.name, cs.value); err != nil {
+			return fmt.Errorf("%s:%d: %v", source, cs.line, err)
+		}
+		settingSources[cs.name] = fileSource
+	}
+	return nil
+}
+
+// A configSetting is one setting from a config file.
+type configSetting struct {
+	name, value string
+	line        int
+}
+
+// readConfig reads the settings in a config file, checking that
+// they are well-formed and that each names a flag.
+func readConfig(fs *flag.FlagSet, r io.Reader, source string) ([]configSetting, error) {
+	var settings []configSetting
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: setting must be `name = value`", source, line)
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if fs.Lookup(name) == nil || name == "config" {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q", source, line, name)
+		}
+		settings = append(settings, configSetting{name, value, line})
+	}
+	return settings, scanner.Err()
+}
+
+// listenAddress returns the address to serve on.
+func listenAddress() string {
+	switch {
+	case *port == "" && len(tlsDomainList()) > 0:
+		// serving HTTPS directly
+		return ":443"
+	case *port == "":
+		// running locally in dev mode
+		return "localhost:8080"
+	case strings.Contains(*port, ":"):
+		return *port
+	default:
+		// running as a true server
+		return ":" + *port
+	}
+}
+
+// exportStorageURLs passes the configured storage URLs to the
+// storage packages, which find them in the environment.
+func exportStorageURLs() {
+	if *cacheURL != "" {
+		os.Setenv("REDISTOGO_URL", *cacheURL)
+	}
+	if *databaseURL != "" {
+		os.Setenv("DATABASE_URL", *databaseURL)
+	}
+}
+
+/*
+
+live settings
+
+*/
+
+// live setting flags
+var defaultAssist = flagString("default-assist", "DEFAULT_ASSIST", "full",
+	"assist level for puzzles that haven't chosen one (full, candidates, none)")
+
+// liveSettings are the settings that can change while the server
+// runs, with the functions that put their values into effect.
+var liveSettings = map[string]func() error{
+	"log-level":           initLogging,
+	"features":            applyFeatures,
+	"default-assist":      applyDefaults,
+	"max-side-length":     applyLimits,
+	"max-journal-length":  applyLimits,
+	"max-session-puzzles": applyLimits,
+}
+
+// secretSettings are the settings whose values aren't shown to
+// admins: they are credentials, or URLs that may hold them.
+var secretSettings = map[string]bool{
+	"admin-token":    true,
+	"webhook-secret": true,
+	"webhooks":       true,
+	"smtp-password":  true,
+	"push-gateway":   true,
+	"cache-url":      true,
+	"database-url":   true,
+}
+
+// Where a setting's value came from.
+const (
+	defaultSource     = "default"
+	fileSource        = "file"
+	environmentSource = "environment"
+	commandLineSource = "command line"
+	adminSource       = "admin"
+)
+
+var (
+	settingsMutex  sync.Mutex
+	settingSources = make(map[string]string) // all but defaults and the environment
+)
+
+// settingSource returns where a setting's value came from.
+func settingSource(name string) string {
+	if source := settingSources[name]; source != "" {
+		return source
+	}
+	if env := flagEnvVars[name]; env != "" && os.Getenv(env) != "" {
+		return environmentSource
+	}
+	return defaultSource
+}
+
+// applyDefaults hands the configured defaults to the puzzle
+// engine.
+func applyDefaults() error {
+	assist, ok := puzzle.ParseAssistLevel(*defaultAssist)
+	if !ok {
+		return fmt.Errorf("Unknown assist level %q", *defaultAssist)
+	}
+	return puzzle.SetDefaults(puzzle.Defaults{Assist: assist})
+}
+
+// A settingInfo describes a setting for admins.
+type settingInfo struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"`
+	Live    bool   `json:"live"`
+	Usage   string `json:"usage"`
+}
+
+// settings describes all the settings, in name order.  The values
+// of secret settings are hidden.
+func settings() []settingInfo {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	var infos []settingInfo
+	flag.VisitAll(func(f *flag.Flag) {
+		info := settingInfo{
+			Name:    f.Name,
+			Value:   f.Value.String(),
+			Default: f.DefValue,
+			Source:  settingSource(f.Name),
+			Live:    liveSettings[f.Name] != nil,
+			Usage:   f.Usage,
+		}
+		if secretSettings[f.Name] {
+			info.Value, info.Default = "(hidden)", "(hidden)"
+		}
+		infos = append(infos, info)
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// changeSetting gives a live setting a new value and puts it into
+// effect.  If the value isn't valid, or can't be put into effect,
+// the setting keeps its old value.  Callers hold settingsMutex.
+func changeSetting(name, value string) error {
+	apply := liveSettings[name]
+	if apply == nil {
+		return fmt.Errorf("Setting %q can't be changed while the server runs", name)
+	}
+	old := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		flag.Set(name, old)
+		apply()
+		return err
+	}
+	return nil
+}
+
+// setSetting changes a live setting at an admin's request.  The
+// new value stands until the server restarts.
+func setSetting(name, value string) error {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	if err := changeSetting(name, value); err != nil {
+		return err
+	}
+	settingSources[name] = adminSource
+	return nil
+}
+
+// reloadConfig rereads the config file and puts its values for
+// live settings into effect (see the config file description).
+// Changes it finds to other settings are only logged.  It returns
+// the names of the settings it changed; if one can't be changed,
+// the reload stops there.
+func reloadConfig() ([]string, error) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	name := *configFile
+	if name == "" {
+		return nil, fmt.Errorf("There is no config file to reload")
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	configured, err := readConfig(flag.CommandLine, f, name)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, cs := range configured {
+		if source := settingSource(cs.name); source != defaultSource && source != fileSource {
+			continue
+		}
+		if flag.Lookup(cs.name).Value.String() == cs.value {
+			continue
+		}
+		if liveSettings[cs.name] == nil {
+			slog.Warn("Config file setting needs a restart", "setting", cs.name)
+			continue
+		}
+		if err := changeSetting(cs.name, cs.value); err != nil {
+			return changed, fmt.Errorf("%s:%d: %v", name, cs.line, err)
+		}
+		settingSources[cs.name] = fileSource
+		changed = append(changed, cs.name)
+	}
+	return changed, nil
+}
+
+// reloadOnSignal reloads the config file whenever the server gets
+// a SIGHUP.
+func reloadOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			if changed, err := reloadConfig(); err != nil {
+				slog.Error("Config reload failed", "changed", changed, "error", err)
+			} else {
+				slog.Info("Reloaded config file", "file", *configFile, "changed", changed)
+			}
+		}
+	}()
+}
@@ -0,0 +1,205 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlagSet makes a flag set like the server's, with flags
+// settable from the environment.
+func testFlagSet(t *testing.T) (*flag.FlagSet, *string, *int, *string) {
+	fs := flag.NewFlagSet("susen", flag.ContinueOnError)
+	fs.String("config", "", "config file")
+	name := fs.String("test-name", "default", "a name")
+	count := fs.Int("test-count", 1, "a count")
+	other := fs.String("test-other", "", "another name")
+	flagEnvVars["test-name"] = "SUSEN_TEST_NAME"
+	t.Cleanup(func() { delete(flagEnvVars, "test-name") })
+	return fs, name, count, other
+}
+
+func TestLoadConfig(t *testing.T) {
+	config := `
+# comment
+test-name = "from file"
+  test-count=3
+
+test-other = x
+`
+	// the file sets what the command line doesn't
+	fs, name, count, other := testFlagSet(t)
+	if err := fs.Parse([]string{"-test-other", "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(fs, strings.NewReader(config), "test.conf"); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if *name != "from file" || *count != 3 || *other != "y" {
+		t.Errorf("Got %q, %d, %q; expected file values except for test-other", *name, *count, *other)
+	}
+
+	// the environment wins over the file
+	t.Setenv("SUSEN_TEST_NAME", "from env")
+	fs, name, _, _ = testFlagSet(t)
+	*name = "from env" // as the flag helpers would have defaulted it
+	if err := loadConfig(fs, strings.NewReader(config), "test.conf"); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if *name != "from env" {
+		t.Errorf("Got %q, expected the environment value", *name)
+	}
+
+	for _, bad := range []string{"no-equals", "= 3", "unknown = 3", "test-count = three", "config = other"} {
+		fs, _, _, _ := testFlagSet(t)
+		if err := loadConfig(fs, strings.NewReader(bad), "bad.conf"); err == nil {
+			t.Errorf("Loaded bad config %q", bad)
+		} else if !strings.HasPrefix(err.Error(), "bad.conf:1: ") {
+			t.Errorf("Error %q doesn't give the line", err)
+		}
+	}
+}
+
+func TestParseConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "susen.conf")
+	if err := os.WriteFile(path, []byte("test-count = 7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs, _, count, _ := testFlagSet(t)
+	if err := parseConfiguration(fs, []string{"serve", "-config", path}); err != nil || *count != 7 {
+		t.Errorf("Got %d, %v; expected the config file's count", *count, err)
+	}
+	fs, _, count, _ = testFlagSet(t)
+	if err := parseConfiguration(fs, []string{"-test-count", "2"}); err != nil || *count != 2 {
+		t.Errorf("Got %d, %v; expected the command line count without serve", *count, err)
+	}
+	for _, args := range [][]string{{"serve", "extra"}, {"solve"}} {
+		fs, _, _, _ = testFlagSet(t)
+		if err := parseConfiguration(fs, args); err == nil {
+			t.Errorf("Accepted arguments %v", args)
+		}
+	}
+	fs, _, _, _ = testFlagSet(t)
+	if err := parseConfiguration(fs, []string{"-config", path + ".missing"}); err == nil {
+		t.Errorf("Accepted a missing config file")
+	}
+	saved := envErrors
+	defer func() { envErrors = saved }()
+	badEnv("SUSEN_TEST_COUNT", "seven", fmt.Errorf("not a number"))
+	fs, _, count, _ = testFlagSet(t)
+	if err := parseConfiguration(fs, []string{"-config", path}); err == nil || !strings.Contains(err.Error(), "SUSEN_TEST_COUNT") {
+		t.Errorf("Got %v, expected an error for the bad environment variable", err)
+	} else if *count != 1 {
+		t.Errorf("Got count %d after an environment error, expected the default", *count)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	savedPort, savedDomains := *port, *tlsDomains
+	defer func() { *port, *tlsDomains = savedPort, savedDomains }()
+
+	testcases := []struct{ port, domains, expect string }{
+		{"", "", "localhost:8080"},
+		{"", "example.com", ":443"},
+		{"8000", "", ":8000"},
+		{"127.0.0.1:9000", "", "127.0.0.1:9000"},
+	}
+	for _, tc := range testcases {
+		*port, *tlsDomains = tc.port, tc.domains
+		if addr := listenAddress(); addr != tc.expect {
+			t.Errorf("Port %q, domains %q: got %q, expected %q", tc.port, tc.domains, addr, tc.expect)
+		}
+	}
+}
+
+func TestLiveSettings(t *testing.T) {
+	saved := make(map[string]string)
+	for _, name := range []string{"default-assist", "features", "max-side-length", "port"} {
+		saved[name] = flag.Lookup(name).Value.String()
+	}
+	savedConfig, savedLimits := *configFile, puzzle.CurrentLimits()
+	defer func() {
+		for name, value := range saved {
+			flag.Set(name, value)
+			delete(settingSources, name)
+		}
+		*configFile = savedConfig
+		puzzle.SetLimits(savedLimits)
+		applyDefaults()
+		applyFeatures()
+	}()
+
+	if err := setSetting("default-assist", "none"); err != nil {
+		t.Fatalf("Failed to set default-assist: %v", err)
+	}
+	if puzzle.CurrentDefaults().Assist != puzzle.AssistNone || settingSource("default-assist") != adminSource {
+		t.Errorf("Default assist is %v, from %s", puzzle.CurrentDefaults().Assist, settingSource("default-assist"))
+	}
+	if err := setSetting("default-assist", "some"); err == nil {
+		t.Errorf("Set default-assist to an unknown level")
+	} else if *defaultAssist != "none" || puzzle.CurrentDefaults().Assist != puzzle.AssistNone {
+		t.Errorf("Failed setting changed default-assist to %q", *defaultAssist)
+	}
+	if err := setSetting("port", "9000"); err == nil {
+		t.Errorf("Changed a setting that isn't live")
+	}
+	if err := setSetting("features", "variants"); err != nil {
+		t.Fatalf("Failed to set features: %v", err)
+	}
+	if !features.enabled("variants") || features.enabled("hints") {
+		t.Errorf("Feature flags are %v after setting features", features.all())
+	}
+	for _, info := range settings() {
+		if info.Name == "admin-token" && info.Value != "(hidden)" {
+			t.Errorf("Secret setting is shown as %q", info.Value)
+		}
+		if info.Name == "default-assist" && (info.Value != "none" || !info.Live || info.Source != adminSource) {
+			t.Errorf("Setting info is %+v", info)
+		}
+	}
+
+	// only the live settings from the file or defaults change
+	*configFile = filepath.Join(t.TempDir(), "susen.conf")
+	config := "default-assist = candidates\nmax-side-length = 16\nport = 9999\n"
+	if err := os.WriteFile(*configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := reloadConfig()
+	if err != nil || len(changed) != 1 || changed[0] != "max-side-length" {
+		t.Errorf("Reload changed %v (%v), expected max-side-length", changed, err)
+	}
+	if puzzle.CurrentLimits().MaxSideLength != 16 || *defaultAssist != "none" || *port == "9999" {
+		t.Errorf("After reload, limits are %+v, default-assist %q, port %q",
+			puzzle.CurrentLimits(), *defaultAssist, *port)
+	}
+	if err := os.WriteFile(*configFile, []byte("max-side-length = -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadConfig(); err == nil {
+		t.Errorf("Reloaded a bad setting")
+	} else if puzzle.CurrentLimits().MaxSideLength != 16 || *maxSideLength != 16 {
+		t.Errorf("Failed reload changed max-side-length to %d", *maxSideLength)
+	}
+}
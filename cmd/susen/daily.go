@@ -0,0 +1,198 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+
+daily puzzles
+
+The server publishes each day's puzzles as soon as it starts and
+again just after each UTC midnight, notifying webhooks of each
+puzzle it publishes, and subscribers (see notify.go) of them all.
+(Other instances may get there first, in which case there's
+nothing left to publish.)  Admins can publish on demand by
+running the "daily" pool refill.
+
+	GET /api/daily[?date=yyyy-mm-dd]            the puzzles of the day (default today)
+	GET /api/archive[?before=yyyy-mm-dd&days=n] published puzzles of earlier days
+	GET /api/leaderboard?rating=n[&date=...]    the leaderboard for a puzzle of the day
+
+*/
+
+// daily flags
+var (
+	archiveDays = flagInt("archive-days", "ARCHIVE_DAYS", 7,
+		"default number of days in a daily puzzle archive page")
+)
+
+// leaderboardSize is how many entries a leaderboard shows.
+const leaderboardSize = 20
+
+// dailyDateFormat is the form of dates in daily requests.
+const dailyDateFormat = "2006-01-02"
+
+// A dailyListing is a puzzle of the day as the API shows it.
+// The link selects the puzzle into the session.
+type dailyListing struct {
+	Date       string `json:"date"`
+	Rating     int    `json:"rating"`
+	Name       string `json:"name"`
+	Geometry   string `json:"geometry"`
+	SideLength int    `json:"sidelen"`
+	Values     []int  `json:"values"`
+	Link       string `json:"link"`
+}
+
+// dailyListings converts daily puzzles for the API.
+func dailyListings(dailies []*storage.DailyPuzzle) []dailyListing {
+	listings := make([]dailyListing, len(dailies))
+	for i, d := range dailies {
+		listings[i] = dailyListing{
+			Date:       d.Date.Format(dailyDateFormat),
+			Rating:     d.Rating,
+			Name:       d.Info.Name,
+			Geometry:   d.Info.Geometry,
+			SideLength: d.Info.SideLength,
+			Values:     d.Values,
+			Link:       "/select/" + d.Info.Name,
+		}
+	}
+	return listings
+}
+
+// parseDailyDate parses a date argument, which defaults to the
+// given time's day if it's empty.
+func parseDailyDate(arg string, def time.Time) (time.Time, bool) {
+	if arg == "" {
+		return storage.DailyDate(def), true
+	}
+	date, err := time.Parse(dailyDateFormat, arg)
+	return date, err == nil
+}
+
+// startDailies publishes the current day's puzzles, schedules
+// publication of each following day's, and registers the refill.
+func startDailies() {
+	registerRefill("daily", func() (int, error) { return publishDailies(time.Now()) })
+	if _, err := publishDailies(time.Now()); err != nil {
+		slog.Warn("Failed to publish daily puzzles", "error", err)
+	}
+	done := make(chan struct{})
+	atShutdown(func() { close(done) })
+	go func() {
+		for {
+			now := time.Now()
+			next := storage.DailyDate(now).AddDate(0, 0, 1)
+			timer := time.NewTimer(next.Sub(now) + time.Second)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if _, err := publishDailies(time.Now()); err != nil {
+				slog.Warn("Failed to publish daily puzzles", "error", err)
+			}
+		}
+	}()
+}
+
+// publishDailies publishes the puzzles for the day containing the
+// given time, notifying webhooks and subscribers, and returns how
+// many it published.
+func publishDailies(now time.Time) (count int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	listings := dailyListings(storage.PublishDailies(now))
+	for _, l := range listings {
+		slog.Info("Published daily puzzle", "date", l.Date, "rating", l.Rating, "puzzle", l.Name)
+		notifyWebhooks(dailyPublishedEvent, l)
+		count++
+	}
+	if count > 0 && notifications != nil {
+		notifySubscribers(storage.Subscribers(storage.DailyTopic), dailyNotification(listings))
+	}
+	return count, nil
+}
+
+// dailyHandler serves the daily puzzle API endpoints, which are
+// the same for every session except for the marking of the
+// session's own leaderboard entry.
+func (s *session) dailyHandler(endpoint string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+		return
+	}
+	q := r.URL.Query()
+	invalid := func(arg string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+		slog.Debug("Invalid daily puzzle argument", "path", r.URL.Path, "argument", arg)
+	}
+	now := time.Now()
+	switch endpoint {
+	case "daily":
+		date, ok := parseDailyDate(q.Get("date"), now)
+		if !ok || date.After(storage.DailyDate(now)) {
+			invalid(q.Get("date"))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, dailyListings(storage.DailyPuzzles(date, 1)))
+	case "archive":
+		before, ok := parseDailyDate(q.Get("before"), now)
+		if !ok {
+			invalid(q.Get("before"))
+			return
+		}
+		days := *archiveDays
+		if arg := q.Get("days"); arg != "" {
+			if n, err := strconv.Atoi(arg); err == nil && n > 0 && n <= 100 {
+				days = n
+			} else {
+				invalid(arg)
+				return
+			}
+		}
+		writeJSON(w, r, http.StatusOK, dailyListings(storage.DailyArchive(before, days)))
+	case "leaderboard":
+		date, ok := parseDailyDate(q.Get("date"), now)
+		if !ok {
+			invalid(q.Get("date"))
+			return
+		}
+		rating, err := strconv.Atoi(q.Get("rating"))
+		if err != nil || rating < 1 || rating > 5 {
+			invalid(q.Get("rating"))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, storage.DailyLeaderboard(date, rating, s.sid, leaderboardSize))
+	}
+}
@@ -0,0 +1,218 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"github.com/ancientHacker/susen.go/client"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+Atom feed of daily puzzles
+
+*/
+
+// feed flags
+var (
+	feedDays = flagInt("feed-days", "FEED_DAYS", 14,
+		"number of daily puzzles in the Atom feed")
+)
+
+// feedThumbnailSize is the pixel size of the puzzle images
+// embedded in feed entries.
+const feedThumbnailSize = 180
+
+// The Atom document structure, as much of it as we use.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+}
+
+// dailyFeed builds the feed document for the given daily
+// puzzles, with one entry for each day's puzzles.  The base URL
+// is the scheme and host that links should point to.
+func dailyFeed(base string, dailies []*storage.DailyPuzzle) *atomFeed {
+	host := strings.TrimPrefix(strings.TrimPrefix(base, "https://"), "http://")
+	feed := &atomFeed{
+		ID:     "tag:" + host + ",2016:daily",
+		Title:  "Sūsen daily puzzle",
+		Links:  []atomLink{{Href: base + "/daily.atom", Rel: "self", Type: "application/atom+xml"}},
+		Author: atomAuthor{Name: "Sūsen"},
+	}
+	for len(dailies) > 0 {
+		day := dailies[:1]
+		for len(day) < len(dailies) && dailies[len(day)].Date.Equal(day[0].Date) {
+			day = dailies[:len(day)+1]
+		}
+		dailies = dailies[len(day):]
+		feed.Entries = append(feed.Entries, dailyEntry(base, host, day))
+		if stamp := feed.Entries[len(feed.Entries)-1].Updated; stamp > feed.Updated {
+			feed.Updated = stamp
+		}
+	}
+	return feed
+}
+
+// dailyEntry builds the feed entry for one day's puzzles.  It
+// links to the first (easiest) of them.
+func dailyEntry(base, host string, day []*storage.DailyPuzzle) atomEntry {
+	date := day[0].Date.Format("2006-01-02")
+	stamp := day[0].Date.Format(time.RFC3339)
+	link := base + "/select/" + day[0].Info.Name
+	var names, summaries []string
+	content := ""
+	for _, d := range day {
+		dlink := base + "/select/" + d.Info.Name
+		stars := d.Rating
+		if stars == 0 {
+			stars = puzzleRating(d.Info, d.Values)
+		}
+		summary := fmt.Sprintf("%dx%d %s puzzle, difficulty %s",
+			d.Info.SideLength, d.Info.SideLength, d.Info.Geometry, ratingStars(stars))
+		names, summaries = append(names, d.Info.Name), append(summaries, summary)
+		content += "<p>" + html.EscapeString(summary) + "</p>"
+		if svg, err := client.PuzzleSVG(d.Info.Geometry, d.Values, feedThumbnailSize); err == nil {
+			content += fmt.Sprintf(`<p><a href="%s"><img alt="%s" src="data:image/svg+xml;base64,%s"/></a></p>`,
+				html.EscapeString(dlink), html.EscapeString(d.Info.Name),
+				base64.StdEncoding.EncodeToString([]byte(svg)))
+		} else {
+			slog.Warn("No thumbnail for daily puzzle", "puzzle", d.Info.Name, "error", err)
+		}
+	}
+	title := fmt.Sprintf("Puzzle of the day for %s: %s", date, names[0])
+	if len(day) > 1 {
+		title = fmt.Sprintf("Puzzles of the day for %s: %s", date, strings.Join(names, ", "))
+	}
+	return atomEntry{
+		ID:        "tag:" + host + "," + date + ":daily",
+		Title:     title,
+		Updated:   stamp,
+		Published: stamp,
+		Links:     []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+		Summary:   atomText{Type: "text", Body: strings.Join(summaries, "; ")},
+		Content:   atomText{Type: "html", Body: content},
+	}
+}
+
+// puzzle ratings don't change, so we remember them.
+var (
+	ratingMutex sync.Mutex
+	ratings     = make(map[string]int)
+)
+
+// puzzleRating returns the difficulty rating (1-5) of a puzzle,
+// or 0 if it can't be solved.
+func puzzleRating(info *storage.PuzzleInfo, values []int) int {
+	ratingMutex.Lock()
+	defer ratingMutex.Unlock()
+	if rating, ok := ratings[info.PuzzleId]; ok {
+		return rating
+	}
+	rating := 0
+	summary := &puzzle.Summary{Geometry: info.Geometry, SideLength: info.SideLength, Values: values}
+	if p, err := puzzle.New(summary); err == nil {
+		if solutions, err := p.Solutions(); err == nil && len(solutions) > 0 {
+			rating = solutions[0].Rating
+		}
+	}
+	ratings[info.PuzzleId] = rating
+	return rating
+}
+
+// ratingStars renders a rating as stars.
+func ratingStars(rating int) string {
+	if rating < 1 {
+		return "unrated"
+	}
+	return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+}
+
+// requestBase returns the scheme and host a request was sent to.
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || requestProtocol(r) == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedHandler serves the Atom feed of daily puzzles.
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("Error building daily feed", "error", err)
+			errorHandler(err, w, r)
+		}
+	}()
+	if r.Method != "GET" && r.Method != "HEAD" {
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+		return
+	}
+	feed := dailyFeed(requestBase(r), storage.DailyPuzzles(time.Now(), *feedDays))
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		panic(fmt.Errorf("Failed to encode daily feed: %v", err))
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+	slog.Debug("Returned daily feed", "entries", len(feed.Entries))
+}
@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/xml"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDailyFeed(t *testing.T) {
+	day := time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC)
+	values := []int{
+		1, 0, 3, 0,
+		0, 3, 0, 1,
+		3, 0, 1, 0,
+		0, 1, 0, 3,
+	}
+	dailies := []*storage.DailyPuzzle{
+		{Date: day, Values: values, Info: &storage.PuzzleInfo{
+			PuzzleId: "TESTFEED1", Name: "sample-2",
+			Geometry: puzzle.StandardGeometryName, SideLength: 4}},
+		{Date: day.AddDate(0, 0, -1), Values: values, Info: &storage.PuzzleInfo{
+			PuzzleId: "TESTFEED1", Name: "sample-1",
+			Geometry: puzzle.StandardGeometryName, SideLength: 4}},
+	}
+	feed := dailyFeed("https://example.com", dailies)
+	if len(feed.Entries) != 2 {
+		t.Fatalf("Feed has %d entries, expected 2", len(feed.Entries))
+	}
+	if feed.Updated != "2016-03-14T00:00:00Z" {
+		t.Errorf("Feed updated at %q", feed.Updated)
+	}
+	e := feed.Entries[0]
+	if e.ID != "tag:example.com,2016-03-14:daily" {
+		t.Errorf("Entry ID is %q", e.ID)
+	}
+	if e.Links[0].Href != "https://example.com/select/sample-2" {
+		t.Errorf("Entry link is %q", e.Links[0].Href)
+	}
+	if !strings.Contains(e.Summary.Body, "★") {
+		t.Errorf("Entry summary has no rating: %q", e.Summary.Body)
+	}
+	if !strings.Contains(e.Content.Body, "data:image/svg+xml;base64,") {
+		t.Errorf("Entry content has no thumbnail: %q", e.Content.Body)
+	}
+	if _, err := xml.Marshal(feed); err != nil {
+		t.Errorf("Couldn't encode feed: %v", err)
+	}
+}
+
+func TestDailyFeedDays(t *testing.T) {
+	day := time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC)
+	daily := func(date time.Time, rating int, name string) *storage.DailyPuzzle {
+		return &storage.DailyPuzzle{Date: date, Rating: rating, Values: make([]int, 16), Info: &storage.PuzzleInfo{
+			PuzzleId: "TESTFEED-" + name, Name: name,
+			Geometry: puzzle.StandardGeometryName, SideLength: 4}}
+	}
+	dailies := []*storage.DailyPuzzle{
+		daily(day, 1, "easy"),
+		daily(day, 3, "hard"),
+		daily(day.AddDate(0, 0, -1), 2, "medium"),
+	}
+	feed := dailyFeed("https://example.com", dailies)
+	if len(feed.Entries) != 2 {
+		t.Fatalf("Feed has %d entries, expected one per day", len(feed.Entries))
+	}
+	e := feed.Entries[0]
+	if e.Title != "Puzzles of the day for 2016-03-14: easy, hard" {
+		t.Errorf("Entry title is %q", e.Title)
+	}
+	if e.Links[0].Href != "https://example.com/select/easy" {
+		t.Errorf("Entry link is %q", e.Links[0].Href)
+	}
+	if !strings.Contains(e.Summary.Body, "★☆☆☆☆") || !strings.Contains(e.Summary.Body, "★★★☆☆") {
+		t.Errorf("Entry summary doesn't have both ratings: %q", e.Summary.Body)
+	}
+	if count := strings.Count(e.Content.Body, "data:image/svg+xml"); count != 2 {
+		t.Errorf("Entry content has %d thumbnails, expected 2", count)
+	}
+	if e := feed.Entries[1]; e.ID != "tag:example.com,2016-03-13:daily" {
+		t.Errorf("Second entry ID is %q", e.ID)
+	}
+}
+
+func TestRatingStars(t *testing.T) {
+	if s := ratingStars(3); s != "★★★☆☆" {
+		t.Errorf("Rating 3 rendered as %q", s)
+	}
+	if s := ratingStars(0); s != "unrated" {
+		t.Errorf("Rating 0 rendered as %q", s)
+	}
+}
@@ -0,0 +1,65 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Health check gave status %d", w.Code)
+	}
+}
+
+func TestReadyHandlerUnavailable(t *testing.T) {
+	// storage isn't connected, so we aren't ready
+	w := httptest.NewRecorder()
+	readyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness check without storage gave status %d", w.Code)
+	}
+
+	// draining servers are never ready
+	draining.Store(true)
+	defer draining.Store(false)
+	w = httptest.NewRecorder()
+	readyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness check while draining gave status %d", w.Code)
+	}
+}
+
+func TestShutdownHooks(t *testing.T) {
+	var order []int
+	atShutdown(func() { order = append(order, 1) })
+	atShutdown(func() { order = append(order, 2) })
+	runShutdownHooks()
+	if len(order) != 2 || order[0] != 2 || order[1] != 1 {
+		t.Errorf("Hooks ran in order %v, expected [2 1]", order)
+	}
+	runShutdownHooks()
+	if len(order) != 2 {
+		t.Errorf("Hooks ran twice: %v", order)
+	}
+}
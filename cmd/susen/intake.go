@@ -0,0 +1,85 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"log/slog"
+	"net/http"
+)
+
+/*
+
+camera intake
+
+Clients that scan printed puzzles send the grid their OCR tool
+recognized (a puzzle.RecognizedGrid) to be reviewed.  If any
+cells need the user's attention, or the grid can't be solved,
+the review comes back for the client to show, and the client
+resubmits the corrected grid, with any unsure cells the user
+confirmed.  Once the grid passes review, the puzzle is added to
+the session and made active.  Grids of non-square geometries are
+only taken when the variants feature is on.
+
+	POST /api/intake      review a recognized grid, adding it once it passes
+
+*/
+
+// An intakeResult is the review of a recognized grid, with the
+// name of the puzzle made from it, if it passed.
+type intakeResult struct {
+	*puzzle.GridReview
+	Name string `json:"name,omitempty"`
+}
+
+// intakeHandler serves the camera intake endpoint.
+func (s *session) intakeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+		return
+	}
+	var grid puzzle.RecognizedGrid
+	if err := json.NewDecoder(r.Body).Decode(&grid); err != nil {
+		puzzle.SendError(puzzle.DecodeError(err), w, r)
+		return
+	}
+	if grid.Geometry == puzzle.RectangularGeometryName && !features.enabled("variants") {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, grid.Geometry), w, r)
+		return
+	}
+	review, err := puzzle.ReviewGrid(&grid)
+	if err != nil {
+		if perr, ok := err.(puzzle.Error); ok {
+			puzzle.SendError(perr, w, r)
+		} else {
+			puzzle.SendError(puzzle.InternalError("reviewGrid", err), w, r)
+		}
+		return
+	}
+	if !review.Ready {
+		slog.Info("Recognized grid needs review", s.attrs(), "flags", len(review.Flags),
+			"solutions", review.Solutions)
+		writeJSON(w, r, http.StatusOK, intakeResult{GridReview: review})
+		return
+	}
+	s.ss.AddScannedPuzzle(review.Summary)
+	slog.Info("Added scanned puzzle", s.attrs(), "puzzle", s.ss.Info.Name, "unique", review.Unique)
+	writeJSON(w, r, http.StatusCreated, intakeResult{review, s.ss.Info.Name})
+}
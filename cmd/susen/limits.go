@@ -0,0 +1,146 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+)
+
+/*
+
+resource limits
+
+Hard limits keep any one client from taking more than its share
+of the server.  The puzzle package enforces the limits on
+puzzles (side length and history length) and storage enforces
+the limit on session puzzles; the server enforces the limits on
+request bodies and on how many expensive requests (see
+expensiveEndpoints) run at once.  Going past any limit gets a
+quota-exceeded Error naming the limit.  A limit of 0 turns it
+off.
+
+*/
+
+// limit flags
+var (
+	maxSideLength = flagInt("max-side-length", "MAX_SIDE_LENGTH", 25,
+		"largest side length a puzzle can have")
+	maxJournalLength = flagInt("max-journal-length", "MAX_JOURNAL_LENGTH", 10000,
+		"most moves a puzzle's history can have")
+	maxSessionPuzzles = flagInt("max-session-puzzles", "MAX_SESSION_PUZZLES", 500,
+		"most puzzles a session can be given")
+	maxJobs = flagInt("max-jobs", "MAX_JOBS", 8,
+		"most expensive requests (solving, scoring, analysis) that can run at once")
+	maxBodySize = flagInt("max-body-size", "MAX_BODY_SIZE", 1<<20,
+		"largest request body, in bytes, for the game and teacher APIs")
+	maxAdminBodySize = flagInt("max-admin-body-size", "MAX_ADMIN_BODY_SIZE", 256<<20,
+		"largest request body, in bytes, for the admin API (restores are big)")
+)
+
+// applyLimits hands the configured limits to the puzzle and
+// storage layers.
+func applyLimits() error {
+	limits := puzzle.Limits{MaxSideLength: *maxSideLength, MaxJournalLength: *maxJournalLength}
+	if err := puzzle.SetLimits(limits); err != nil {
+		return err
+	}
+	if *maxSessionPuzzles < 0 {
+		return fmt.Errorf("max-session-puzzles can't be negative (%d)", *maxSessionPuzzles)
+	}
+	storage.SetSessionPuzzleLimit(*maxSessionPuzzles)
+	return nil
+}
+
+// limitBodies wraps a handler so that request bodies can't be
+// bigger than max bytes.  Requests that say they're bigger are
+// turned away at once; others are cut off when they go past max,
+// and decoding them gets the quota-exceeded Error (see
+// puzzle.DecodeError).
+func limitBodies(max int, h http.Handler) http.Handler {
+	if max <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > int64(max) {
+			puzzle.SendError(puzzle.QuotaError(puzzle.RequestBodyLimit, max), w, r)
+			slog.Debug("Request body too large", "path", r.URL.Path, "length", r.ContentLength)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, int64(max))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// A jobLimiter has a slot for each expensive request that can
+// run at once.  A nil jobLimiter has unlimited slots.
+type jobLimiter chan struct{}
+
+// newJobLimiter makes a limiter with max slots, or no limit if
+// max isn't positive.
+func newJobLimiter(max int) jobLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return make(jobLimiter, max)
+}
+
+// acquire takes a slot, if one is free, and reports whether it
+// did.
+func (jl jobLimiter) acquire() bool {
+	if jl == nil {
+		return true
+	}
+	select {
+	case jl <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot taken by acquire.
+func (jl jobLimiter) release() {
+	if jl != nil {
+		<-jl
+	}
+}
+
+// limitJobs wraps a handler so that expensive requests only run
+// when the limiter has a free slot.  Others get a 503 response
+// with a Retry-After header, since slots free up quickly.
+func limitJobs(jl jobLimiter, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if classifyRequest(r) != expensiveEndpoint {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !jl.acquire() {
+			w.Header().Set("Retry-After", "1")
+			puzzle.SendError(puzzle.QuotaError(puzzle.ConcurrentJobsLimit, cap(jl)), w, r)
+			slog.Warn("Too many concurrent jobs", "path", r.URL.Path, "limit", cap(jl))
+			return
+		}
+		defer jl.release()
+		h.ServeHTTP(w, r)
+	})
+}
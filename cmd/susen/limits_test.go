@@ -0,0 +1,129 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBodies(t *testing.T) {
+	h := limitBodies(16, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		if e := json.NewDecoder(r.Body).Decode(&v); e != nil {
+			puzzle.SendError(puzzle.DecodeError(e), w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest("POST", "/api/assign", strings.NewReader(`"short"`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Small body got status %d", w.Code)
+	}
+
+	body := `"` + strings.Repeat("x", 32) + `"`
+	r = httptest.NewRequest("POST", "/api/assign", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Declared large body got status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"request.limit.quota-exceeded"`) {
+		t.Errorf("Declared large body response is %s", w.Body.String())
+	}
+
+	// no Content-Length, so the body is cut off while decoding
+	r = httptest.NewRequest("POST", "/api/assign", io.MultiReader(strings.NewReader(body)))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Undeclared large body got status %d", w.Code)
+	}
+
+	unlimited := limitBodies(0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, e := io.ReadAll(r.Body); e != nil {
+			t.Errorf("Read with no limit failed: %v", e)
+		}
+	}))
+	r = httptest.NewRequest("POST", "/api/assign", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	unlimited.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Large body with no limit got status %d", w.Code)
+	}
+}
+
+func TestJobLimiter(t *testing.T) {
+	jl := newJobLimiter(2)
+	if !jl.acquire() || !jl.acquire() {
+		t.Fatalf("Couldn't acquire free slots")
+	}
+	if jl.acquire() {
+		t.Fatalf("Acquired a slot when all were taken")
+	}
+	jl.release()
+	if !jl.acquire() {
+		t.Errorf("Couldn't acquire a released slot")
+	}
+
+	jl = newJobLimiter(0)
+	for i := 0; i < 10; i++ {
+		if !jl.acquire() {
+			t.Fatalf("Unlimited limiter refused slot %d", i+1)
+		}
+	}
+}
+
+func TestLimitJobs(t *testing.T) {
+	jl := newJobLimiter(1)
+	h := limitJobs(jl, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	if w := send("/api/explain"); w.Code != http.StatusOK {
+		t.Fatalf("Expensive request with a free slot got status %d", w.Code)
+	}
+
+	// hold the only slot, as a running job would
+	jl.acquire()
+	defer jl.release()
+	w := send("/api/explain")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expensive request with no free slot got status %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After is %q, expected %q", w.Header().Get("Retry-After"), "1")
+	}
+	if w := send("/api/state"); w.Code != http.StatusOK {
+		t.Errorf("Cheap request with no free slot got status %d", w.Code)
+	}
+}
@@ -0,0 +1,202 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+
+logger configuration
+
+*/
+
+// logging flags
+var (
+	logLevel = flagString("log-level", "LOG_LEVEL", "info",
+		"minimum log level (debug, info, warn, error)")
+	logJSON = flagBool("log-json", "LOG_JSON", false,
+		"write log entries as JSON objects")
+)
+
+// parseLogLevel maps a level name to an slog level.
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("Unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// newLogger builds the server's logger, writing to out with the
+// given level and format.
+func newLogger(out io.Writer, level slog.Level, asJSON bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if asJSON {
+		return slog.New(slog.NewJSONHandler(out, opts))
+	}
+	return slog.New(slog.NewTextHandler(out, opts))
+}
+
+// initLogging installs the configured logger as the default, so
+// that both slog and legacy log output go through it.
+func initLogging() error {
+	level, err := parseLogLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	if *debugLog {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(newLogger(os.Stderr, level, *logJSON))
+	return nil
+}
+
+/*
+
+request logging middleware
+
+*/
+
+// A requestRecord accumulates the facts about a request that
+// handlers learn along the way, so they can be logged when the
+// request completes.
+type requestRecord struct {
+	session   string
+	puzzle    string
+	condition puzzle.ErrorCondition
+	err       error
+}
+
+// recordKey is the context key for a request's requestRecord.
+type recordKey struct{}
+
+// recordFor returns the requestRecord for a request.  If the
+// request isn't being logged, the returned record is a fresh
+// one, so callers never have to check.
+func recordFor(r *http.Request) *requestRecord {
+	if rec, ok := r.Context().Value(recordKey{}).(*requestRecord); ok {
+		return rec
+	}
+	return &requestRecord{}
+}
+
+// noteError records an error encountered while handling a
+// request.  Puzzle errors also have their condition recorded.
+func (rec *requestRecord) noteError(err error) {
+	if err == nil {
+		return
+	}
+	rec.err = err
+	if perr, ok := err.(puzzle.Error); ok {
+		rec.condition = perr.Condition
+	}
+}
+
+// A statusRecorder remembers the status written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through, so streaming handlers work
+// behind the recorder.  Flushing writes the headers, so the
+// status is OK if it hasn't been written.
+func (sr *statusRecorder) Flush() {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for
+// http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// logRequests wraps a handler so that each request it serves
+// produces one log entry when it completes.  Server errors are
+// logged at error level, client errors at warning level, and
+// everything else at info level.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &requestRecord{}
+		sr := &statusRecorder{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), recordKey{}, rec))
+		defer func() {
+			if sr.status == 0 {
+				sr.status = http.StatusOK
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sr.status),
+				slog.Duration("latency", time.Since(start)),
+			}
+			if rec.session != "" {
+				attrs = append(attrs, slog.String("session", rec.session))
+			}
+			if rec.puzzle != "" {
+				attrs = append(attrs, slog.String("puzzle", rec.puzzle))
+			}
+			if rec.condition != puzzle.UnknownCondition {
+				attrs = append(attrs, slog.String("condition", rec.condition.String()))
+			}
+			if rec.err != nil {
+				attrs = append(attrs, slog.String("error", rec.err.Error()))
+			}
+			level := slog.LevelInfo
+			switch {
+			case sr.status >= 500:
+				level = slog.LevelError
+			case sr.status >= 400:
+				level = slog.LevelWarn
+			}
+			slog.LogAttrs(r.Context(), level, "request", attrs...)
+		}()
+		h.ServeHTTP(sr, r)
+	})
+}
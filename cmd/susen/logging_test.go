@@ -0,0 +1,116 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		" warn": slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for name, expect := range cases {
+		level, err := parseLogLevel(name)
+		if err != nil {
+			t.Errorf("Level %q: unexpected error: %v", name, err)
+		} else if level != expect {
+			t.Errorf("Level %q: got %v, expected %v", name, level, expect)
+		}
+	}
+	if _, err := parseLogLevel("chatty"); err == nil {
+		t.Errorf("Level %q: no error", "chatty")
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(newLogger(&buf, slog.LevelDebug, true))
+	defer slog.SetDefault(old)
+
+	h := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordFor(r)
+		rec.session, rec.puzzle = "sid", "pid"
+		rec.noteError(puzzle.Error{Condition: puzzle.NotInSetCondition})
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/assign", nil))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Log entry %q isn't JSON: %v", buf.String(), err)
+	}
+	expect := map[string]interface{}{
+		"level":     "WARN",
+		"msg":       "request",
+		"method":    "POST",
+		"path":      "/api/assign",
+		"status":    float64(http.StatusBadRequest),
+		"session":   "sid",
+		"puzzle":    "pid",
+		"condition": "not-in-set",
+	}
+	for k, v := range expect {
+		if entry[k] != v {
+			t.Errorf("Log entry %q: got %v, expected %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Errorf("Log entry has no latency: %v", entry)
+	}
+}
+
+func TestLogRequestsFlush(t *testing.T) {
+	old := slog.Default()
+	slog.SetDefault(newLogger(io.Discard, slog.LevelDebug, true))
+	defer slog.SetDefault(old)
+
+	w := httptest.NewRecorder()
+	h := logRequests(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if u, ok := rw.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != w {
+			t.Errorf("Logged response writer doesn't unwrap to the server's")
+		}
+		rw.Write([]byte("data: x\n\n"))
+		if err := http.NewResponseController(rw).Flush(); err != nil {
+			t.Errorf("Flush through the response controller failed: %v", err)
+		}
+	}))
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/roundstream", nil))
+	if !w.Flushed {
+		t.Errorf("Response wasn't flushed")
+	}
+}
+
+func TestRecordForUnloggedRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if rec := recordFor(r); rec == nil {
+		t.Errorf("Got nil record for unlogged request")
+	}
+}
@@ -19,12 +19,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ancientHacker/susen.go/client"
 	"github.com/ancientHacker/susen.go/puzzle"
 	"github.com/ancientHacker/susen.go/storage"
-	"log"
+	"io"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
@@ -32,63 +36,175 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 // flags
 var (
-	debugLog = flag.Bool("d", false, "debugging info in log")
+	debugLog     = flagBool("d", "DEBUG", false, "debugging info in log")
+	drainTimeout = flagDuration("drain-timeout", "DRAIN_TIMEOUT", 25*time.Second,
+		"how long to wait for in-flight requests at shutdown")
+	clientDir = flagString("client-dir", "CLIENT_DIRECTORY", "",
+		"serve client resources from this directory instead of the embedded copies")
 )
 
+/*
+
+flag helpers
+
+*/
+
+// badEnv records an environment variable whose value doesn't
+// parse, for parseConfiguration to report.  The flag keeps its
+// default.
+func badEnv(envVar, env string, err error) {
+	envErrors = append(envErrors, fmt.Errorf("%s=%q: %v", envVar, env, err))
+}
+
+// flagString defines a string flag whose default can be
+// overridden by an environment variable.
+func flagString(name, envVar, value, usage string) *string {
+	if env := os.Getenv(envVar); env != "" {
+		value = env
+	}
+	flagEnvVars[name] = envVar
+	return flag.String(name, value, usage+" (env "+envVar+")")
+}
+
+// flagInt defines an integer flag whose default can be
+// overridden by an environment variable.
+func flagInt(name, envVar string, value int, usage string) *int {
+	if env := os.Getenv(envVar); env != "" {
+		if v, err := strconv.Atoi(env); err != nil {
+			badEnv(envVar, env, err)
+		} else {
+			value = v
+		}
+	}
+	flagEnvVars[name] = envVar
+	return flag.Int(name, value, usage+" (env "+envVar+")")
+}
+
+// flagFloat defines a floating-point flag whose default can be
+// overridden by an environment variable.
+func flagFloat(name, envVar string, value float64, usage string) *float64 {
+	if env := os.Getenv(envVar); env != "" {
+		if v, err := strconv.ParseFloat(env, 64); err != nil {
+			badEnv(envVar, env, err)
+		} else {
+			value = v
+		}
+	}
+	flagEnvVars[name] = envVar
+	return flag.Float64(name, value, usage+" (env "+envVar+")")
+}
+
+// flagDuration defines a duration flag whose default can be
+// overridden by an environment variable.
+func flagDuration(name, envVar string, value time.Duration, usage string) *time.Duration {
+	if env := os.Getenv(envVar); env != "" {
+		if v, err := time.ParseDuration(env); err != nil {
+			badEnv(envVar, env, err)
+		} else {
+			value = v
+		}
+	}
+	flagEnvVars[name] = envVar
+	return flag.Duration(name, value, usage+" (env "+envVar+")")
+}
+
+// flagBool defines a boolean flag whose default can be
+// overridden by an environment variable.  The variable can be
+// "true", "1", "on", or "yes" to turn the flag on, and "false",
+// "0", "off", or "no" to turn it off.
+func flagBool(name, envVar string, value bool, usage string) *bool {
+	switch env := os.Getenv(envVar); strings.ToLower(env) {
+	case "":
+	case "true", "1", "on", "yes":
+		value = true
+	case "false", "0", "off", "no":
+		value = false
+	default:
+		badEnv(envVar, env, fmt.Errorf("not a boolean"))
+	}
+	flagEnvVars[name] = envVar
+	return flag.Bool(name, value, usage+" (env "+envVar+")")
+}
+
 func main() {
-	// parse flags, if anything left over it's a usage problem
-	flag.Parse()
-	if flag.NArg() > 0 {
+	// parse flags and config file, any problem is a usage problem
+	if err := parseConfiguration(flag.CommandLine, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error during configuration: %v\n", err)
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
-	if len(os.Getenv("DEBUG")) > 0 {
-		*debugLog = true
+	if err := initLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error during log initialization: %v\n", err)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	slog.Debug("Debug log messages turned on.")
+	if err := applyLimits(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in resource limits: %v\n", err)
+		flag.PrintDefaults()
+		os.Exit(2)
 	}
-	if *debugLog {
-		log.Printf("Debug log messages turned on.")
+	if err := applyDefaults(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in puzzle defaults: %v\n", err)
+		flag.PrintDefaults()
+		os.Exit(2)
 	}
 
 	// client initialization
+	if *clientDir != "" {
+		client.UseResourceDirectory(*clientDir)
+		slog.Info("Serving client resources from disk", "directory", *clientDir)
+	}
 	if err := client.VerifyResources(); err != nil {
-		log.Printf("Error during client initialization: %v", err)
+		slog.Error("Error during client initialization", "error", err)
 		shutdown(startupFailureShutdown)
 	}
 	// storage initialization
+	exportStorageURLs()
 	if cacheId, databaseId, err := storage.Connect(); err != nil {
-		log.Printf("Error during storage initialization: %v", err)
+		slog.Error("Error during storage initialization", "error", err)
 		shutdown(startupFailureShutdown)
 	} else {
-		log.Printf("Connected to cache at %q", cacheId)
-		log.Printf("Connected to database at %q", databaseId)
+		slog.Info("Connected to cache", "cache", cacheId)
+		slog.Info("Connected to database", "database", databaseId)
+		slog.Info("Rating with bands", "bands", storage.RestoreRatingBands())
 	}
+	startWebhooks()
+	startNotifications()
+	startDailies()
+	startTournaments()
 
-	// port sensing
-	port := os.Getenv("PORT")
-	if port == "" {
-		// running locally in dev mode
-		port = "localhost:8080"
-	} else {
-		// running as a true server
-		port = ":" + port
-	}
+	// serve
+	addr := listenAddress()
+	srv := &http.Server{Addr: addr}
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", readyHandler)
+	jobs := newJobLimiter(*maxJobs)
+	http.Handle("/admin/", logRequests(limitRequests(requireAdmin(limitBodies(*maxAdminBodySize, http.HandlerFunc(adminHandler))))))
+	http.Handle("/teach/", logRequests(limitRequests(limitBodies(*maxBodySize, http.HandlerFunc(teachHandler)))))
+	http.Handle("/daily.atom", logRequests(limitRequests(http.HandlerFunc(feedHandler))))
+	http.Handle("/", logRequests(limitRequests(limitJobs(jobs, limitBodies(*maxBodySize, http.HandlerFunc(serveHttp))))))
 
 	// catch signals
-	shutdownOnSignal()
+	drained := shutdownOnSignal(srv)
+	reloadOnSignal()
 
-	// serve
-	log.Printf("Listening on %s...", port)
-	http.HandleFunc("/", serveHttp)
-	err := http.ListenAndServe(port, nil)
-	if err != nil {
-		log.Printf("Listener failure: %v", err)
+	slog.Info("Listening...", "address", addr)
+	err := listen(srv)
+	if err != http.ErrServerClosed {
+		slog.Error("Listener failure", "error", err)
 		shutdown(listenerFailureShutdown)
 	}
+	<-drained
+	shutdown(caughtSignalShutdown)
 }
 
 /*
@@ -122,6 +238,25 @@ func (s *session) step() int {
 	return len(s.ss.Info.Choices) + 1
 }
 
+// completion describes a completed puzzle, and its score, for
+// webhooks
+func (s *session) completion(score *storage.Score) map[string]interface{} {
+	return map[string]interface{}{
+		"session":  s.sid,
+		"puzzle":   s.pid(),
+		"name":     s.name(),
+		"geometry": s.ss.Info.Geometry,
+		"choices":  len(s.ss.Info.Choices),
+		"score":    score,
+	}
+}
+
+// log attributes describing the working puzzle
+func (s *session) attrs() slog.Attr {
+	return slog.Group("session",
+		slog.String("id", s.sid), slog.String("puzzle", s.name()), slog.Int("step", s.step()))
+}
+
 /*
 
 request handlers
@@ -134,8 +269,10 @@ var (
 	solverEndpointPattern = "^/+solver/?"
 	homeEndpointPattern   = "^/+home/?"
 	selectEndpointPattern = "^/+(reset|select)/?"
+	lessonEndpointPattern = "^/+lesson/?"
 	apiEndpointRegexp     = regexp.MustCompile("^/+api/+([a-z]+)/*$")
 	selectEndpointRegexp  = regexp.MustCompile("^/+(reset|select)/+([a-zA-Z0-9-]+)/*$")
+	lessonEndpointRegexp  = regexp.MustCompile("^/+lesson/+([a-zA-Z0-9-]+)(?:/+([0-9]+))?/*$")
 )
 
 func serveHttp(w http.ResponseWriter, r *http.Request) {
@@ -146,21 +283,24 @@ func serveHttp(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		if err := recover(); err != nil {
 			if s == nil || s.sid == "" {
-				log.Printf("Error getting session cookie: %v", err)
+				slog.Error("Error getting session cookie", "error", err)
 			} else if s.ss != nil {
-				log.Printf("Error in session %s:%q step %d: %v", s.sid, s.name(), s.step(), err)
+				slog.Error("Error in session", s.attrs(), "error", err)
 			} else {
-				log.Printf("Error in session %s: %v", s.sid, err)
+				slog.Error("Error in session", "session", s.sid, "error", err)
 			}
 			errorHandler(err, w, r)
 		}
 	}()
 
 	s = &session{sid: getCookie(w, r)}
+	rec := recordFor(r)
+	rec.session = s.sid
 	if client.StaticHandler(w, r) {
 		return
 	}
 	s.load(w, r)
+	rec.puzzle = s.pid()
 	s.rootHandler(w, r)
 }
 
@@ -173,30 +313,71 @@ func (s *session) rootHandler(w http.ResponseWriter, r *http.Request) {
 		s.homeHandler(w, r)
 	} else if test, _ = regexp.MatchString(selectEndpointPattern, r.URL.Path); test {
 		http.Redirect(w, r, "/solver/", http.StatusFound)
-		log.Printf("Redirected to home page on request for %q", r.URL.Path)
+		slog.Debug("Redirected to solver page", "path", r.URL.Path)
+	} else if test, _ = regexp.MatchString(lessonEndpointPattern, r.URL.Path); test {
+		http.Redirect(w, r, "/solver/", http.StatusFound)
+		slog.Debug("Redirected to solver page", "path", r.URL.Path)
 	} else {
 		http.Redirect(w, r, "/home/", http.StatusFound)
-		log.Printf("Redirected to home page on request for %q", r.URL.Path)
+		slog.Debug("Redirected to home page", "path", r.URL.Path)
 	}
 }
 
 func (s *session) apiHandler(w http.ResponseWriter, r *http.Request) {
+	rec := recordFor(r)
 	sendState := func() {
-		s.puzzle().StateHandler(w, r)
-		log.Printf("Returned current state for %s:%q step %d", s.sid, s.name(), s.step())
+		rec.noteError(s.puzzle().StateHandler(w, r))
+		slog.Debug("Returned current state", s.attrs())
 	}
 	sendSummary := func() {
-		s.puzzle().SummaryHandler(w, r)
-		log.Printf("Returned current summary for %s:%q step %d", s.sid, s.name(), s.step())
+		rec.noteError(s.puzzle().SummaryHandler(w, r))
+		slog.Debug("Returned current summary", s.attrs())
 	}
 	sendNotAllowed := func() {
-		http.Error(w, apiEndpointUnknown(r.URL.Path), http.StatusMethodNotAllowed)
-		log.Printf("Endpoint %q cannot accept %s: returned a MethodNotAllowed error.",
-			r.URL.Path, r.Method)
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+		slog.Debug("Endpoint cannot accept method", "path", r.URL.Path, "method", r.Method)
 	}
 	sendNotFound := func() {
-		http.Error(w, apiEndpointUnknown(r.URL.Path), http.StatusNotFound)
-		log.Printf("Uknown endpoint %q: returned a NotFound error.", r.URL.Path)
+		puzzle.SendError(puzzle.RequestError(puzzle.UnknownEndpointCondition, r.URL.Path), w, r)
+		slog.Debug("Unknown endpoint", "path", r.URL.Path)
+	}
+
+	sendBadSlot := func(name string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, name), w, r)
+		slog.Debug("Invalid save slot", "path", r.URL.Path, "slot", name)
+	}
+	sendBadLesson := func(name, example string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, name+" "+example), w, r)
+		slog.Debug("Invalid lesson example", "path", r.URL.Path, "lesson", name, "example", example)
+	}
+	// lessonExample returns the lesson and example named in the
+	// request (the first example if none is given), or sends an
+	// error if there's no such lesson example.
+	lessonExample := func() (*storage.Lesson, int, bool) {
+		name, example := r.URL.Query().Get("name"), r.URL.Query().Get("example")
+		position := 1
+		if example != "" {
+			position, _ = strconv.Atoi(example)
+		}
+		var l *storage.Lesson
+		if storage.ValidLessonName(name) {
+			l = storage.FindLesson(name)
+		}
+		if l == nil || position < 1 || position > len(l.Examples) {
+			sendBadLesson(name, example)
+			return nil, 0, false
+		}
+		return l, position, true
+	}
+	// slotName returns the save slot named in the request, or
+	// sends an error if the name is missing or invalid.
+	slotName := func() (string, bool) {
+		name := r.URL.Query().Get("name")
+		if !storage.ValidSlotName(name) {
+			sendBadSlot(name)
+			return "", false
+		}
+		return name, true
 	}
 
 	matches := apiEndpointRegexp.FindStringSubmatch(r.URL.Path)
@@ -216,12 +397,256 @@ func (s *session) apiHandler(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
 			if s.step() > 1 {
 				s.ss.RemoveStep()
-				log.Printf("Reverted session %s:%q to step %d.", s.sid, s.name(), s.step()-1)
+				slog.Info("Reverted to prior step", s.attrs())
 			}
 			sendState()
 		} else {
 			sendNotAllowed()
 		}
+	case "slots":
+		switch r.Method {
+		case "GET":
+			writeJSON(w, r, http.StatusOK, s.ss.SaveSlots())
+		case "DELETE":
+			if name, ok := slotName(); ok {
+				if !s.ss.DeleteSlot(name) {
+					sendBadSlot(name)
+				} else {
+					slog.Info("Deleted save slot", s.attrs(), "slot", name)
+					writeJSON(w, r, http.StatusOK, s.ss.SaveSlots())
+				}
+			}
+		default:
+			sendNotAllowed()
+		}
+	case "save":
+		if r.Method == "POST" {
+			if name, ok := slotName(); ok {
+				s.ss.SaveAs(name)
+				slog.Info("Saved to slot", s.attrs(), "slot", name)
+				writeJSON(w, r, http.StatusOK, s.ss.SaveSlots())
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "restore":
+		if r.Method == "POST" {
+			if name, ok := slotName(); ok {
+				if !s.ss.RestoreFrom(name) {
+					sendBadSlot(name)
+				} else {
+					slog.Info("Restored from slot", s.attrs(), "slot", name)
+					sendState()
+				}
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "lessons":
+		if r.Method == "GET" {
+			writeJSON(w, r, http.StatusOK, storage.Lessons())
+		} else {
+			sendNotAllowed()
+		}
+	case "lesson":
+		switch r.Method {
+		case "GET":
+			if l, example, ok := lessonExample(); ok {
+				le := l.Examples[example-1]
+				active := le.PuzzleId == s.pid()
+				writeJSON(w, r, http.StatusOK, lessonProgress{
+					Lesson:  l.Name,
+					Example: example,
+					Active:  active,
+					Passed:  active && le.Accepts(s.puzzle()),
+				})
+			}
+		case "POST":
+			if l, example, ok := lessonExample(); ok {
+				s.ss.StartLesson(l, example)
+				slog.Info("Started lesson", s.attrs(), "lesson", l.Name, "example", example)
+				sendState()
+			}
+		default:
+			sendNotAllowed()
+		}
+	case "practice":
+		switch r.Method {
+		case "GET":
+			writeJSON(w, r, http.StatusOK, practiceInfo{
+				Techniques: storage.PracticeTechniques(),
+				Active:     s.ss.Practice(),
+			})
+		case "POST":
+			technique := r.URL.Query().Get("technique")
+			if !storage.ValidTechnique(technique) || !s.ss.StartPractice(technique, practiceRand()) {
+				puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, technique), w, r)
+				slog.Debug("Invalid practice technique", "path", r.URL.Path, "technique", technique)
+			} else {
+				slog.Info("Started practice", s.attrs(), "technique", technique)
+				sendState()
+			}
+		default:
+			sendNotAllowed()
+		}
+	case "hint":
+		if !features.enabled("hints") {
+			sendNotFound()
+		} else if r.Method == "POST" {
+			hint := s.ss.Hint()
+			slog.Info("Gave hint", s.attrs(), "hint", hint)
+			writeJSON(w, r, http.StatusOK, hint)
+		} else {
+			sendNotAllowed()
+		}
+	case "score":
+		if r.Method == "GET" {
+			info := scoreInfo{Current: s.ss.Score()}
+			if best, ok := s.ss.BestScore(); ok {
+				info.Best = &best
+			}
+			writeJSON(w, r, http.StatusOK, info)
+		} else {
+			sendNotAllowed()
+		}
+	case "badges":
+		if r.Method == "GET" {
+			earned, available := s.ss.Badges()
+			writeJSON(w, r, http.StatusOK, badgeInfo{earned, available})
+		} else {
+			sendNotAllowed()
+		}
+	case "stats":
+		if r.Method == "GET" {
+			writeJSON(w, r, http.StatusOK, s.ss.Statistics())
+		} else {
+			sendNotAllowed()
+		}
+	case "mistakes":
+		if r.Method == "GET" {
+			writeJSON(w, r, http.StatusOK, storage.SessionMistakes(s.sid))
+		} else {
+			sendNotAllowed()
+		}
+	case "timer":
+		switch r.Method {
+		case "GET":
+			writeJSON(w, r, http.StatusOK, s.ss.Timer())
+		case "POST":
+			var timer *storage.Timer
+			action := r.URL.Query().Get("action")
+			switch action {
+			case "pause":
+				timer = s.ss.PauseTimer()
+			case "resume":
+				timer = s.ss.ResumeTimer()
+			default:
+				puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, action), w, r)
+				slog.Debug("Invalid timer action", "path", r.URL.Path, "action", action)
+				return
+			}
+			slog.Info("Changed timer", s.attrs(), "action", action)
+			writeJSON(w, r, http.StatusOK, timer)
+		default:
+			sendNotAllowed()
+		}
+	case "join":
+		if r.Method == "POST" {
+			class, student := r.URL.Query().Get("class"), r.URL.Query().Get("student")
+			if !storage.ValidStudentName(student) || !s.ss.JoinClass(class, student) {
+				puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, class, student), w, r)
+				slog.Debug("Invalid class or student", "path", r.URL.Path, "class", class, "student", student)
+			} else {
+				slog.Info("Joined class", s.attrs(), "class", class, "student", student)
+				writeJSON(w, r, http.StatusOK, map[string]string{"class": class, "student": student})
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "assignments":
+		switch r.Method {
+		case "GET":
+			writeJSON(w, r, http.StatusOK, s.ss.Assignments())
+		case "POST":
+			q := r.URL.Query()
+			position, _ := strconv.Atoi(q.Get("puzzle"))
+			started := false
+			for _, as := range s.ss.Assignments() {
+				if as.Class == q.Get("class") && as.Name == q.Get("name") {
+					started = s.ss.StartAssignment(as.Assignment, position)
+				}
+			}
+			if !started {
+				puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path,
+					q.Get("class"), q.Get("name"), q.Get("puzzle")), w, r)
+				slog.Debug("Invalid assignment puzzle", "path", r.URL.Path, "query", r.URL.RawQuery)
+			} else {
+				slog.Info("Started assignment puzzle", s.attrs(), "class", q.Get("class"), "assignment", q.Get("name"))
+				sendState()
+			}
+		default:
+			sendNotAllowed()
+		}
+	case "explain":
+		if r.Method == "GET" {
+			writeJSON(w, r, http.StatusOK, s.ss.ExplainError())
+		} else {
+			sendNotAllowed()
+		}
+	case "playback":
+		if r.Method == "GET" {
+			writeJSON(w, r, http.StatusOK, s.ss.Playback())
+		} else {
+			sendNotAllowed()
+		}
+	case "describe":
+		if r.Method == "GET" {
+			q := r.URL.Query()
+			index := 0
+			if square := q.Get("square"); square != "" {
+				index, _ = strconv.Atoi(square)
+			}
+			braille, _ := strconv.ParseBool(q.Get("braille"))
+			d, err := s.puzzle().Describe(index, braille)
+			if err != nil || (index == 0 && q.Get("square") != "") {
+				puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, q.Get("square")), w, r)
+				slog.Debug("Invalid square to describe", "path", r.URL.Path, "square", q.Get("square"))
+			} else if q.Get("format") == "text" {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+				io.WriteString(w, d.Text())
+			} else {
+				writeJSON(w, r, http.StatusOK, d)
+			}
+		} else {
+			sendNotAllowed()
+		}
+	case "image":
+		if r.Method == "GET" {
+			s.sendImage(w, r)
+		} else {
+			sendNotAllowed()
+		}
+	case "daily", "archive", "leaderboard":
+		s.dailyHandler(strings.ToLower(matches[1]), w, r)
+	case "tournaments", "tournament", "standings", "bracket", "results", "roundstream":
+		s.tournamentHandler(strings.ToLower(matches[1]), w, r)
+	case "replays", "replay":
+		s.replayHandler(strings.ToLower(matches[1]), w, r)
+	case "bookmarks", "bookmark":
+		s.bookmarkHandler(strings.ToLower(matches[1]), w, r)
+	case "subscriptions":
+		s.subscriptionHandler(w, r)
+	case "intake":
+		s.intakeHandler(w, r)
+	case "notes":
+		serveNotes(s.ss, "", w, r)
+	case "glossary":
+		if r.Method == "GET" {
+			writeJSON(w, r, http.StatusOK, glossary(s.puzzle()))
+		} else {
+			sendNotAllowed()
+		}
 	case "state":
 		if r.Method == "GET" {
 			sendState()
@@ -237,21 +662,23 @@ func (s *session) apiHandler(w http.ResponseWriter, r *http.Request) {
 	case "assign":
 		if r.Method == "POST" {
 			choice, update, err := s.puzzle().AssignHandler(w, r)
+			rec.noteError(err)
 			if update == nil {
-				log.Printf("Assign of %+v at %s:%q step %d failed: %v",
-					*choice, s.sid, s.name(), s.step(), err)
+				slog.Info("Assign failed", s.attrs(), "choice", choice, "error", err)
 			} else {
 				if len(update.Errors) > 0 {
-					log.Printf("Assign of %+v at %s:%q step %d made puzzle unsolvable.",
-						choice, s.sid, s.name(), s.step())
+					slog.Info("Assign made puzzle unsolvable", s.attrs(), "choice", *choice)
 				} else {
-					log.Printf("Assign of %+v at %v:%q step %d left puzzle solvable",
-						choice, s.sid, s.name(), s.step())
+					slog.Info("Assign left puzzle solvable", s.attrs(), "choice", *choice)
 				}
 				s.ss.AddStep(*choice)
+				if len(update.Errors) == 0 && s.ss.Info.Remaining == 0 {
+					score := s.ss.RecordScore()
+					slog.Info("Puzzle completed", s.attrs(), "score", score.Total)
+					notifyWebhooks(puzzleCompletedEvent, s.completion(score))
+				}
 				if err != nil {
-					log.Printf("WARNING: Result of assign at %v:%q step %d failed to encode!",
-						s.sid, s.name(), s.step())
+					slog.Warn("Result of assign failed to encode", s.attrs())
 				}
 			}
 		} else {
@@ -262,6 +689,62 @@ func (s *session) apiHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// A lessonProgress says whether a lesson example is the active
+// puzzle, and whether its goals have been reached.
+type lessonProgress struct {
+	Lesson  string `json:"lesson"`
+	Example int    `json:"example"`
+	Active  bool   `json:"active"`
+	Passed  bool   `json:"passed"`
+}
+
+// A practiceInfo lists the techniques that can be practiced,
+// and the status of the active puzzle if it's a practice puzzle.
+type practiceInfo struct {
+	Techniques []string                `json:"techniques"`
+	Active     *storage.PracticeStatus `json:"active"`
+}
+
+// A scoreInfo gives the score of the session's puzzle so far,
+// and the best score recorded for completing it, if any.
+type scoreInfo struct {
+	Current *storage.Score `json:"current"`
+	Best    *int           `json:"best"`
+}
+
+// A badgeInfo lists the badges earned and still available.
+type badgeInfo struct {
+	Earned    []storage.EarnedBadge `json:"earned"`
+	Available []storage.Badge       `json:"available"`
+}
+
+// A glossaryEntry describes a technique, with an example of it
+// from the session's puzzle if there is one.
+type glossaryEntry struct {
+	puzzle.GlossaryEntry
+	Example *puzzle.TechniqueInstance `json:"example"`
+}
+
+// glossary returns the technique glossary, with examples from
+// the given puzzle.
+func glossary(p *puzzle.Puzzle) []glossaryEntry {
+	var entries []glossaryEntry
+	for _, ge := range puzzle.Glossary() {
+		ti, err := p.FindTechnique(ge.Name)
+		if err != nil {
+			slog.Warn("Technique search failed", "technique", ge.Name, "error", err)
+		}
+		entries = append(entries, glossaryEntry{ge, ti})
+	}
+	return entries
+}
+
+// practiceRand returns a random source for choosing practice
+// puzzles.
+func practiceRand() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
 func (s *session) solverHandler(w http.ResponseWriter, r *http.Request) {
 	summary, err := s.puzzle().Summary()
 	if err != nil {
@@ -272,7 +755,7 @@ func (s *session) solverHandler(w http.ResponseWriter, r *http.Request) {
 	hs.Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(body))
-	log.Printf("Returned solver page for %s:%q step %d.", s.sid, s.name(), s.step())
+	slog.Debug("Returned solver page", s.attrs())
 }
 
 func (s *session) homeHandler(w http.ResponseWriter, r *http.Request) {
@@ -283,23 +766,42 @@ func (s *session) homeHandler(w http.ResponseWriter, r *http.Request) {
 	hs.Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(body))
-	log.Printf("Returned home page for %s:%q step %d.",
-		s.sid, s.name(), s.step())
+	slog.Debug("Returned home page", s.attrs())
 }
 
 func errorHandler(err interface{}, w http.ResponseWriter, r *http.Request) {
+	// storage panics with quota-exceeded Errors, which go back to
+	// the client like any other Error
+	if perr, ok := err.(puzzle.Error); ok && perr.Condition == puzzle.QuotaExceededCondition {
+		recordFor(r).noteError(puzzle.SendError(perr, w, r))
+		return
+	}
 	var body string
 	switch err.(type) {
 	case error:
+		recordFor(r).noteError(err.(error))
 		body = client.ErrorPage(err.(error))
 	default:
+		recordFor(r).noteError(fmt.Errorf("%v", err))
 		body = client.ErrorPage(fmt.Errorf("%v", err))
 	}
 	hs := w.Header()
 	hs.Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusInternalServerError)
 	w.Write([]byte(body))
-	log.Printf("Returned server error page for %s of %q.", r.Method, r.URL.Path)
+	slog.Debug("Returned server error page", "method", r.Method, "path", r.URL.Path)
+}
+
+// writeJSON sends obj as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, obj interface{}) {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		puzzle.SendError(puzzle.InternalError("writeJSON", err), w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes)
 }
 
 /*
@@ -323,6 +825,22 @@ var (
 	startTime = time.Now() // instance start-up time
 )
 
+// requestProtocol returns the protocol a request arrived on.
+func requestProtocol(r *http.Request) string {
+	// Issue #1: Heroku-transported protocols are specified in a header
+	proto := "httpx" // absent other indicators, protocol is unknown
+	if herokuProtocol := r.Header.Get("X-Forwarded-Proto"); herokuProtocol != "" {
+		proto = herokuProtocol
+	}
+	return proto
+}
+
+// sessionCookieName returns the name of the session cookie for
+// the protocol a request arrived on.
+func sessionCookieName(r *http.Request) string {
+	return cookieNameBase + "-" + requestProtocol(r)
+}
+
 // getCookie gets the session cookie, or sets a new one.  It
 // returns the session ID associated with the cookie.
 //
@@ -333,15 +851,11 @@ var (
 // instance serving both protocols, with the protocol termination
 // done at a load-balancer.
 func getCookie(w http.ResponseWriter, r *http.Request) string {
-	// Issue #1: Heroku-transported protocols are specified in a header
-	proto := "httpx" // absent other indicators, protocol is unknown
-	if herokuProtocol := r.Header.Get("X-Forwarded-Proto"); herokuProtocol != "" {
-		proto = herokuProtocol
-	}
+	proto := requestProtocol(r)
 
 	// helpers for getting and setting cookies
 	getCookies := func() (id string, age bool) {
-		idName, ageName := cookieNameBase+"-"+proto, cookieAgeBase+"-"+proto
+		idName, ageName := sessionCookieName(r), cookieAgeBase+"-"+proto
 		if sc, e := r.Cookie(idName); e == nil && sc.Value != "" {
 			id = sc.Value
 		}
@@ -351,7 +865,7 @@ func getCookie(w http.ResponseWriter, r *http.Request) string {
 		return
 	}
 	setCookies := func(id string) {
-		idName, ageName := cookieNameBase+"-"+proto, cookieAgeBase+"-"+proto
+		idName, ageName := sessionCookieName(r), cookieAgeBase+"-"+proto
 		http.SetCookie(w, &http.Cookie{
 			Name: idName, Value: id, Path: cookiePath, MaxAge: cookieMaxAge})
 		now := time.Now().Format(time.RFC822)
@@ -376,7 +890,7 @@ func getCookie(w http.ResponseWriter, r *http.Request) string {
 	if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
 		sid = requestID
 	}
-	log.Printf("No session cookie found, created new session ID %q", sid)
+	slog.Info("No session cookie found, created new session", "session", sid)
 	setCookies(sid)
 	return sid
 }
@@ -388,19 +902,30 @@ func (s *session) load(w http.ResponseWriter, r *http.Request) {
 
 	// reset the session if requested
 	matches := selectEndpointRegexp.FindStringSubmatch(r.URL.Path)
-	if *debugLog {
-		log.Printf("Session Load: URI %q matches: %v", r.URL.Path, matches)
-	}
+	slog.Debug("Session load", "path", r.URL.Path, "matches", matches)
 	if matches != nil {
 		if len(matches[2]) > 0 {
 			s.ss.SelectPuzzle(matches[2])
-			log.Printf("Selected session %v puzzle %q at step %d.", s.sid, s.name(), s.step())
+			slog.Info("Selected puzzle", s.attrs())
 		}
 		if matches[1] == "reset" {
 			s.ss.RemoveAllSteps()
-			log.Printf("Reset session %v puzzle %q to step %d", s.sid, s.name(), s.step())
+			slog.Info("Reset puzzle", s.attrs())
 		}
 	}
+
+	// start a lesson example if requested
+	if matches := lessonEndpointRegexp.FindStringSubmatch(r.URL.Path); matches != nil {
+		example := 1
+		if matches[2] != "" {
+			example, _ = strconv.Atoi(matches[2])
+		}
+		l := storage.FindLesson(matches[1])
+		if l == nil || !s.ss.StartLesson(l, example) {
+			panic(fmt.Errorf("No such lesson example: %s %d", matches[1], example))
+		}
+		slog.Info("Started lesson", s.attrs(), "lesson", l.Name, "example", example)
+	}
 }
 
 /*
@@ -422,9 +947,37 @@ const (
 // for testing, allow alternate forms of shutdown
 var alternateShutdown func(reason shutdownCause)
 
+// shutdownHooks are run (in reverse order of registration)
+// before the storage connections are closed, so background
+// workers can stop cleanly.
+var (
+	shutdownHooks []func()
+	shutdownMutex sync.Mutex
+)
+
+// atShutdown registers a function to be run during shutdown.
+func atShutdown(hook func()) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	shutdownHooks = append(shutdownHooks, hook)
+}
+
+// runShutdownHooks runs and clears the registered hooks.
+func runShutdownHooks() {
+	shutdownMutex.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownMutex.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
 // shutdown: process exit with logging.
 func shutdown(reason shutdownCause) {
-	// close down the storage connections
+	// stop background work, then flush and close down the
+	// storage connections
+	runShutdownHooks()
 	storage.Close()
 
 	// for testing: run alternateShutdown instead, if defined
@@ -433,45 +986,154 @@ func shutdown(reason shutdownCause) {
 		panic(reason) // shouldn't get here
 	}
 
-	// log reason for shutdown and exit
+	// log reason for shutdown and exit; the graceful cases
+	// exit with success status
 	switch reason {
 	case unknownShutdown:
-		log.Fatal("Exiting: normal shutdown.")
+		slog.Info("Exiting: normal shutdown.")
+		os.Exit(0)
 	case startupFailureShutdown:
-		log.Fatal("Exiting: initialization failure.")
+		slog.Error("Exiting: initialization failure.")
 	case runtimeFailureShutdown:
-		log.Fatal("Exiting: runtime failure.")
+		slog.Error("Exiting: runtime failure.")
 	case caughtSignalShutdown:
-		log.Fatal("Exiting: caught signal.")
+		slog.Info("Exiting: caught signal.")
+		os.Exit(0)
 	case listenerFailureShutdown:
-		log.Fatal("Exiting: web server failed.")
+		slog.Error("Exiting: web server failed.")
 	default:
-		log.Fatal("Exiting: unknown cause.")
+		slog.Error("Exiting: unknown cause.")
 	}
+	os.Exit(1)
 }
 
-// shutdownOnSignal: catch signals and exit.
-func shutdownOnSignal() {
+// shutdownOnSignal: catch termination signals and drain the
+// server.  The returned channel is closed once in-flight
+// requests have completed (or the drain timeout has passed).
+func shutdownOnSignal(srv *http.Server) <-chan struct{} {
 	// based on example in os.signal godoc
 	c := make(chan os.Signal, 1)
-	signal.Notify(c) // die on all signals
+	signal.Notify(c, syscall.SIGTERM, os.Interrupt)
 
+	drained := make(chan struct{})
 	go func() {
 		s := <-c
-		log.Printf("Received OS-level signal: %v", s)
-		shutdown(caughtSignalShutdown)
+		slog.Info("Received OS-level signal, draining requests",
+			"signal", s, "timeout", *drainTimeout)
+		draining.Store(true)
+		ctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Warn("Requests did not drain", "error", err)
+		}
+		close(drained)
 	}()
+	return drained
 }
 
 /*
 
-various low-level utilities
+health and readiness
 
 */
 
-// apiEndpointUnknown: a pre-serialized JSON Error used when
-// someone calls a non-existent API endpoint.
-func apiEndpointUnknown(endpoint string) string {
-	return `{"scope": "1", "structure": "1", "condition": "1", "values": ["No such endpoint"], ` +
-		`"message": "No such endpoint: ` + endpoint + `"}`
+// draining is set once the server has started shutting down, at
+// which point it is no longer ready for new requests.
+var draining atomic.Bool
+
+// healthHandler reports that the server process is alive.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ok\n")
+}
+
+// readyHandler reports whether the server can take requests:
+// it must not be draining, and its storage must be reachable.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if err := storage.Ping(); err != nil {
+		slog.Warn("Readiness check failed", "error", err)
+		http.Error(w, "storage unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ready\n")
+}
+
+// image export sizes, in pixels
+const (
+	defaultImageSize = 300
+	minImageSize     = 50
+	maxImageSize     = 2000
+)
+
+// sendImage sends an SVG image of the session's puzzle, in the
+// theme and at the size given by the request's query (if any).
+// Squares in error and bound squares are always highlighted, and
+// the squares named by any hint arguments are highlighted as
+// hints.
+func (s *session) sendImage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	invalid := func(arg string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+		slog.Debug("Invalid image argument", "path", r.URL.Path, "argument", arg)
+	}
+	theme, ok := client.LookupTheme(q.Get("theme"))
+	if !ok {
+		invalid(q.Get("theme"))
+		return
+	}
+	size := defaultImageSize
+	if arg := q.Get("size"); arg != "" {
+		var err error
+		if size, err = strconv.Atoi(arg); err != nil || size < minImageSize || size > maxImageSize {
+			invalid(arg)
+			return
+		}
+	}
+	summary, err := s.puzzle().Summary()
+	if err != nil {
+		puzzle.SendError(puzzle.InternalError("sendImage", err), w, r)
+		return
+	}
+	state, err := s.puzzle().State()
+	if err != nil {
+		puzzle.SendError(puzzle.InternalError("sendImage", err), w, r)
+		return
+	}
+	marks := &client.Highlights{}
+	for _, sq := range state.Squares {
+		if sq.Bval != 0 {
+			marks.Bindings = append(marks.Bindings, sq.Index)
+		}
+	}
+	for _, e := range state.Errors {
+		if e.Scope != puzzle.SquareScope || len(e.Values) == 0 {
+			continue
+		}
+		if i, ok := e.Values[0].(int); ok {
+			marks.Errors = append(marks.Errors, i)
+		}
+	}
+	for _, arg := range q["hint"] {
+		i, err := strconv.Atoi(arg)
+		if err != nil || i < 1 || i > len(summary.Values) {
+			invalid(arg)
+			return
+		}
+		marks.Hints = append(marks.Hints, i)
+	}
+	svg, err := client.ConstrainedPuzzleSVG(summary.Geometry, summary.Values, summary.Constraints, size, theme, marks)
+	if err != nil {
+		puzzle.SendError(puzzle.InternalError("sendImage", err), w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, svg)
 }
@@ -22,8 +22,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/ancientHacker/susen.go/client"
 	"github.com/ancientHacker/susen.go/puzzle"
 	"github.com/ancientHacker/susen.go/storage"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -33,6 +35,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 /*
@@ -321,3 +324,996 @@ func TestIssue11(t *testing.T) {
 		}
 	}
 }
+
+func TestLessonEndpoints(t *testing.T) {
+	storageConnect(t, "TestLessonEndpoints")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	progress := func(query string) lessonProgress {
+		var lp lessonProgress
+		r, e := c.Get(srv.URL + "/api/lesson?" + query)
+		if e != nil || r.StatusCode != http.StatusOK {
+			t.Fatalf("Progress request error: %v, %v", r, e)
+		}
+		defer r.Body.Close()
+		if e := json.NewDecoder(r.Body).Decode(&lp); e != nil {
+			t.Fatalf("Failed to decode progress: %v", e)
+		}
+		return lp
+	}
+
+	// list the lessons
+	r, e := c.Get(srv.URL + "/api/lessons")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Lessons request error: %v, %v", r, e)
+	}
+	var lessons []*storage.Lesson
+	e = json.NewDecoder(r.Body).Decode(&lessons)
+	r.Body.Close()
+	if e != nil || len(lessons) == 0 {
+		t.Fatalf("Lessons are %v (error %v)", lessons, e)
+	}
+
+	// start a lesson through the API, and meet its goals
+	r, e = c.Post(srv.URL+"/api/lesson?name=naked-singles", "application/json", nil)
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Start lesson request error: %v, %v", r, e)
+	}
+	r.Body.Close()
+	if lp := progress("name=naked-singles"); !lp.Active || lp.Passed {
+		t.Errorf("Progress at start is %+v", lp)
+	}
+	for _, goal := range lessons[len(lessons)-1].Examples[0].Goals {
+		b, _ := json.Marshal(goal)
+		r, e = c.Post(srv.URL+"/api/assign", "application/json", bytes.NewReader(b))
+		if e != nil || r.StatusCode != http.StatusOK {
+			t.Fatalf("Assign request error: %v, %v", r, e)
+		}
+		r.Body.Close()
+	}
+	if lp := progress("name=naked-singles&example=1"); !lp.Active || !lp.Passed {
+		t.Errorf("Progress after goals is %+v", lp)
+	}
+
+	// start a lesson through the web page, which starts over
+	r, e = c.Get(srv.URL + "/lesson/naked-singles/1")
+	if e != nil || r.StatusCode != http.StatusOK || r.Request.URL.Path != "/solver/" {
+		t.Fatalf("Lesson page request error: %v, %v", r, e)
+	}
+	r.Body.Close()
+	if lp := progress("name=naked-singles"); !lp.Active || lp.Passed {
+		t.Errorf("Progress after restart is %+v", lp)
+	}
+
+	// bad lesson requests
+	for _, query := range []string{"name=nonesuch", "name=naked-singles&example=2", "name=Bad%20Name"} {
+		r, e = c.Get(srv.URL + "/api/lesson?" + query)
+		if e != nil || r.StatusCode != http.StatusNotFound {
+			t.Errorf("Bad lesson request %q gave %v, %v", query, r, e)
+		}
+		r.Body.Close()
+	}
+}
+
+func TestPracticeEndpoints(t *testing.T) {
+	storageConnect(t, "TestPracticeEndpoints")
+	defer storage.Close()
+	defer func(on bool) { features.set("hints", on) }(features.enabled("hints"))
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	info := func() practiceInfo {
+		var pi practiceInfo
+		r, e := c.Get(srv.URL + "/api/practice")
+		if e != nil || r.StatusCode != http.StatusOK {
+			t.Fatalf("Practice request error: %v, %v", r, e)
+		}
+		defer r.Body.Close()
+		if e := json.NewDecoder(r.Body).Decode(&pi); e != nil {
+			t.Fatalf("Failed to decode practice info: %v", e)
+		}
+		return pi
+	}
+	hint := func() (int, *storage.Hint) {
+		var h *storage.Hint
+		r, e := c.Post(srv.URL+"/api/hint", "application/json", nil)
+		if e != nil {
+			t.Fatalf("Hint request error: %v", e)
+		}
+		defer r.Body.Close()
+		if r.StatusCode == http.StatusOK {
+			if e := json.NewDecoder(r.Body).Decode(&h); e != nil {
+				t.Fatalf("Failed to decode hint: %v", e)
+			}
+		}
+		return r.StatusCode, h
+	}
+
+	if pi := info(); len(pi.Techniques) == 0 || pi.Active != nil {
+		t.Fatalf("Practice info before practice is %+v", pi)
+	}
+	r, e := c.Post(srv.URL+"/api/practice?technique=hidden-single", "application/json", nil)
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Start practice request error: %v, %v", r, e)
+	}
+	r.Body.Close()
+	if pi := info(); pi.Active == nil || pi.Active.Technique != "hidden-single" || pi.Active.Hinted {
+		t.Errorf("Practice info at start is %+v", pi)
+	}
+
+	// hints are a feature
+	features.set("hints", false)
+	if code, _ := hint(); code != http.StatusNotFound {
+		t.Errorf("Hint with hints off gave status %d", code)
+	}
+	features.set("hints", true)
+	if code, h := hint(); code != http.StatusOK || h == nil || h.Technique != "hidden-single" {
+		t.Errorf("Hint gave %d, %+v", code, h)
+	}
+	if pi := info(); pi.Active == nil || !pi.Active.Hinted || pi.Active.Found {
+		t.Errorf("Practice info after hint is %+v", pi)
+	}
+
+	r, e = c.Post(srv.URL+"/api/practice?technique=x-wing", "application/json", nil)
+	if e != nil || r.StatusCode != http.StatusNotFound {
+		t.Errorf("Practicing an unknown technique gave %v, %v", r, e)
+	}
+	r.Body.Close()
+}
+
+func TestScoreEndpoint(t *testing.T) {
+	storageConnect(t, "TestScoreEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	score := func() scoreInfo {
+		var si scoreInfo
+		r, e := c.Get(srv.URL + "/api/score")
+		if e != nil || r.StatusCode != http.StatusOK {
+			t.Fatalf("Score request error: %v, %v", r, e)
+		}
+		defer r.Body.Close()
+		if e := json.NewDecoder(r.Body).Decode(&si); e != nil {
+			t.Fatalf("Failed to decode score: %v", e)
+		}
+		return si
+	}
+
+	si := score()
+	if si.Current == nil || si.Current.Rating == 0 || si.Current.Undos != 0 || si.Best != nil {
+		t.Errorf("Score at start is %+v", si)
+	}
+	r, e := c.Get(srv.URL + "/api/back")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Back request error: %v, %v", r, e)
+	}
+	r.Body.Close()
+	r, e = c.Post(srv.URL+"/api/score", "application/json", nil)
+	if e != nil || r.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Posting a score gave %v, %v", r, e)
+	}
+	r.Body.Close()
+}
+
+func TestBadgesEndpoint(t *testing.T) {
+	storageConnect(t, "TestBadgesEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Get(srv.URL + "/api/badges")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Badges request error: %v, %v", r, e)
+	}
+	defer r.Body.Close()
+	var bi badgeInfo
+	if e := json.NewDecoder(r.Body).Decode(&bi); e != nil {
+		t.Fatalf("Failed to decode badges: %v", e)
+	}
+	if len(bi.Earned) != 0 || len(bi.Available) == 0 {
+		t.Errorf("New session has badges %+v", bi)
+	}
+}
+
+func TestMistakesEndpoint(t *testing.T) {
+	storageConnect(t, "TestMistakesEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Get(srv.URL + "/api/mistakes")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Mistakes request error: %v, %v", r, e)
+	}
+	defer r.Body.Close()
+	var ma storage.MistakeAnalytics
+	if e := json.NewDecoder(r.Body).Decode(&ma); e != nil {
+		t.Fatalf("Failed to decode mistakes: %v", e)
+	}
+	if ma.Assigns != 0 || ma.Mistakes != 0 || len(ma.Missed) == 0 {
+		t.Errorf("New session has mistake analytics %+v", ma)
+	}
+}
+
+func TestExplainEndpoint(t *testing.T) {
+	storageConnect(t, "TestExplainEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Get(srv.URL + "/api/explain")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Explain request error: %v, %v", r, e)
+	}
+	defer r.Body.Close()
+	var x *puzzle.ErrorExplanation
+	if e := json.NewDecoder(r.Body).Decode(&x); e != nil {
+		t.Fatalf("Failed to decode explanation: %v", e)
+	}
+	if x != nil {
+		t.Errorf("New session has explanation %+v", x)
+	}
+}
+
+func TestTimerEndpoint(t *testing.T) {
+	storageConnect(t, "TestTimerEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	timer := func(method, query string) (int, *storage.Timer) {
+		req, e := http.NewRequest(method, srv.URL+"/api/timer"+query, nil)
+		if e != nil {
+			t.Fatalf("Failed to create request: %v", e)
+		}
+		r, e := c.Do(req)
+		if e != nil {
+			t.Fatalf("Timer request error: %v", e)
+		}
+		defer r.Body.Close()
+		var tm *storage.Timer
+		if r.StatusCode == http.StatusOK {
+			if e := json.NewDecoder(r.Body).Decode(&tm); e != nil {
+				t.Fatalf("Failed to decode timer: %v", e)
+			}
+		}
+		return r.StatusCode, tm
+	}
+	if code, tm := timer("GET", ""); code != http.StatusOK || tm != nil {
+		t.Errorf("New session timer is %d, %+v", code, tm)
+	}
+	if code, tm := timer("POST", "?action=pause"); code != http.StatusOK || tm != nil {
+		t.Errorf("Pausing new session timer gave %d, %+v", code, tm)
+	}
+	if code, _ := timer("POST", "?action=stop"); code != http.StatusNotFound {
+		t.Errorf("Unknown timer action gave status %d", code)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	storageConnect(t, "TestStatsEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Get(srv.URL + "/api/stats")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Stats request error: %v, %v", r, e)
+	}
+	defer r.Body.Close()
+	var st storage.Statistics
+	if e := json.NewDecoder(r.Body).Decode(&st); e != nil {
+		t.Fatalf("Failed to decode statistics: %v", e)
+	}
+	if st.Started != 0 || st.Completed != 0 || len(st.Techniques) == 0 {
+		t.Errorf("New session has statistics %+v", st)
+	}
+}
+
+func TestDescribeEndpoint(t *testing.T) {
+	storageConnect(t, "TestDescribeEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Get(srv.URL + "/api/describe?square=1&braille=true")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Describe request error: %v, %v", r, e)
+	}
+	var d puzzle.Description
+	e = json.NewDecoder(r.Body).Decode(&d)
+	r.Body.Close()
+	if e != nil {
+		t.Fatalf("Failed to decode description: %v", e)
+	}
+	if len(d.Grid) == 0 || len(d.Braille) != len(d.Grid) || !strings.HasPrefix(d.Square, "Row 1, column 1") {
+		t.Errorf("Description is %+v", d)
+	}
+	r, e = c.Get(srv.URL + "/api/describe?format=text")
+	if e != nil || r.StatusCode != http.StatusOK || !strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("Text describe request error: %v, %v", r, e)
+	}
+	r.Body.Close()
+	for _, square := range []string{"0", "x", "1000"} {
+		r, e = c.Get(srv.URL + "/api/describe?square=" + square)
+		if e != nil || r.StatusCode != http.StatusNotFound {
+			t.Errorf("Describing square %q: %v, %v", square, r, e)
+		}
+		r.Body.Close()
+	}
+}
+
+func TestImageEndpoint(t *testing.T) {
+	storageConnect(t, "TestImageEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	r, e := c.Get(srv.URL + "/api/image")
+	if e != nil || r.StatusCode != http.StatusOK || r.Header.Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("Image request error: %v, %v", r, e)
+	}
+	body, e := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if e != nil || !strings.Contains(string(body), `width="300"`) {
+		t.Errorf("Default image is %q (%v)", body, e)
+	}
+	r, e = c.Get(srv.URL + "/api/image?theme=okabe-ito&size=120&hint=1")
+	if e != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("Themed image request error: %v, %v", r, e)
+	}
+	body, e = ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	theme, _ := client.LookupTheme("okabe-ito")
+	if e != nil || !strings.Contains(string(body), `width="120"`) || !strings.Contains(string(body), theme.Hint.Stroke) {
+		t.Errorf("Themed image is %q (%v)", body, e)
+	}
+	for _, query := range []string{"theme=no-such-theme", "size=10", "size=x", "hint=0", "hint=1000"} {
+		r, e = c.Get(srv.URL + "/api/image?" + query)
+		if e != nil || r.StatusCode != http.StatusNotFound {
+			t.Errorf("Image with %q: %v, %v", query, r, e)
+		}
+		r.Body.Close()
+	}
+}
+
+func TestDailyEndpoints(t *testing.T) {
+	storageConnect(t, "TestDailyEndpoints")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	get := func(path string, obj interface{}) int {
+		r, e := c.Get(srv.URL + path)
+		if e != nil {
+			t.Fatalf("Request for %q failed: %v", path, e)
+		}
+		defer r.Body.Close()
+		if r.StatusCode == http.StatusOK && obj != nil {
+			if e := json.NewDecoder(r.Body).Decode(obj); e != nil {
+				t.Errorf("Failed to decode %q: %v", path, e)
+			}
+		}
+		return r.StatusCode
+	}
+	var today []dailyListing
+	if code := get("/api/daily", &today); code != http.StatusOK || len(today) == 0 {
+		t.Fatalf("Daily request gave %d: %+v", code, today)
+	}
+	if today[0].Date != time.Now().UTC().Format(dailyDateFormat) || today[0].Link != "/select/"+today[0].Name {
+		t.Errorf("Puzzle of the day is %+v", today[0])
+	}
+	var archive []dailyListing
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(dailyDateFormat)
+	if code := get("/api/archive?days=1&before="+tomorrow, &archive); code != http.StatusOK || len(archive) != len(today) {
+		t.Errorf("Archive request gave %d: %+v", code, archive)
+	}
+	var board []storage.LeaderboardEntry
+	if code := get(fmt.Sprintf("/api/leaderboard?rating=%d", today[0].Rating), &board); code != http.StatusOK {
+		t.Errorf("Leaderboard request gave %d", code)
+	}
+	for _, path := range []string{
+		"/api/daily?date=" + tomorrow, "/api/daily?date=today",
+		"/api/archive?days=0", "/api/leaderboard", "/api/leaderboard?rating=6",
+	} {
+		if code := get(path, nil); code != http.StatusNotFound {
+			t.Errorf("Request for %q gave %d", path, code)
+		}
+	}
+}
+
+func TestTournamentEndpoints(t *testing.T) {
+	storageConnect(t, "TestTournamentEndpoints")
+	defer storage.Close()
+
+	// admins create the tournament
+	name := "test-endpoint-tournament"
+	storage.DeleteTournament(name)
+	defer storage.DeleteTournament(name)
+	now := time.Now().UTC()
+	body, _ := json.Marshal([]storage.RoundSpec{
+		{Puzzle: sampleDefaultName, Starts: now.Add(-time.Hour), Ends: now.Add(time.Hour)},
+		{Puzzle: sampleDefaultName, Starts: now.Add(2 * time.Hour), Ends: now.Add(3 * time.Hour)},
+	})
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		adminHandler(w, r)
+		return w
+	}
+	if w := admin("POST", "/admin/tournaments/"+name, string(body)); w.Code != http.StatusCreated {
+		t.Fatalf("Creating tournament gave %d: %s", w.Code, w.Body.String())
+	}
+	if w := admin("POST", "/admin/tournaments/"+name, string(body)); w.Code == http.StatusCreated {
+		t.Errorf("Creating tournament twice succeeded")
+	}
+	var all []tournamentListing
+	w := admin("GET", "/admin/tournaments", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil || len(all) == 0 || all[0].Rounds[1].Link == "" {
+		t.Errorf("Admin tournament listing gave %d (%v): %s", w.Code, err, w.Body.String())
+	}
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	send := func(method, path string, obj interface{}) int {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		r, e := c.Do(req)
+		if e != nil {
+			t.Fatalf("Request for %q failed: %v", path, e)
+		}
+		defer r.Body.Close()
+		if r.StatusCode == http.StatusOK && obj != nil {
+			if e := json.NewDecoder(r.Body).Decode(obj); e != nil {
+				t.Errorf("Failed to decode %q: %v", path, e)
+			}
+		}
+		return r.StatusCode
+	}
+	var listing tournamentListing
+	if code := send("POST", "/api/tournament?name="+name, &listing); code != http.StatusOK || listing.Entrants != 1 {
+		t.Fatalf("Entering gave %d: %+v", code, listing)
+	}
+	if len(listing.Rounds) != 2 || listing.Rounds[0].Link != "/select/"+sampleDefaultName || listing.Rounds[1].Link != "" {
+		t.Errorf("Tournament rounds are %+v", listing.Rounds)
+	}
+	var listings []tournamentListing
+	if code := send("GET", "/api/tournaments", &listings); code != http.StatusOK || len(listings) == 0 {
+		t.Errorf("Tournament listing gave %d: %+v", code, listings)
+	}
+	var standings []storage.Standing
+	if code := send("GET", "/api/standings?name="+name, &standings); code != http.StatusOK ||
+		len(standings) != 1 || !standings[0].Self {
+		t.Errorf("Standings gave %d: %+v", code, standings)
+	}
+	var results []storage.RoundResult
+	if code := send("GET", "/api/results?round=1&name="+name, &results); code != http.StatusOK || len(results) != 0 {
+		t.Errorf("Results gave %d: %+v", code, results)
+	}
+	for _, path := range []string{
+		"/api/tournament?name=no-such-tournament", "/api/tournament?name=Bad%20Name",
+		"/api/standings?name=no-such-tournament", "/api/results?name=" + name,
+		"/api/results?round=9&name=" + name,
+	} {
+		if code := send("GET", path, nil); code != http.StatusNotFound {
+			t.Errorf("Request for %q gave %d", path, code)
+		}
+	}
+	if code := send("DELETE", "/api/tournament?name="+name, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Delete request gave %d", code)
+	}
+	if w := admin("DELETE", "/admin/tournaments/"+name, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Removing tournament gave %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestReplayEndpoints(t *testing.T) {
+	storageConnect(t, "TestReplayEndpoints")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	send := func(method, path string, body, obj interface{}) int {
+		var rd io.Reader
+		if body != nil {
+			b, _ := json.Marshal(body)
+			rd = bytes.NewReader(b)
+		}
+		req, _ := http.NewRequest(method, srv.URL+path, rd)
+		r, e := c.Do(req)
+		if e != nil {
+			t.Fatalf("Request for %q failed: %v", path, e)
+		}
+		defer r.Body.Close()
+		if (r.StatusCode == http.StatusOK || r.StatusCode == http.StatusCreated) && obj != nil {
+			if e := json.NewDecoder(r.Body).Decode(obj); e != nil {
+				t.Errorf("Failed to decode %q: %v", path, e)
+			}
+		}
+		return r.StatusCode
+	}
+
+	// only completed puzzles can be published
+	if code := send("GET", "/reset/"+sampleDefaultName, nil, nil); code != http.StatusOK {
+		t.Fatalf("Reset gave %d", code)
+	}
+	if code := send("POST", "/api/replays?title=early", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Publishing an incomplete puzzle gave %d", code)
+	}
+	var summary puzzle.Summary
+	if code := send("GET", "/api/summary", nil, &summary); code != http.StatusOK {
+		t.Fatalf("Summary gave %d", code)
+	}
+	p, err := puzzle.New(&summary)
+	if err != nil {
+		t.Fatalf("Failed to make puzzle: %v", err)
+	}
+	sols, err := p.Solutions()
+	if err != nil || len(sols) == 0 {
+		t.Fatalf("Failed to solve puzzle: %v", err)
+	}
+	for i, v := range sols[0].Values {
+		if summary.Values[i] == 0 {
+			choice := puzzle.Choice{Index: i + 1, Value: v}
+			if code := send("POST", "/api/assign", choice, nil); code != http.StatusOK {
+				t.Fatalf("Assigning %v gave %d", choice, code)
+			}
+		}
+	}
+	var rp storage.Replay
+	if code := send("POST", "/api/replays?title=Endpoint+solve", nil, &rp); code != http.StatusCreated ||
+		rp.Id == 0 || !rp.Self || rp.Puzzle != sampleDefaultName {
+		t.Fatalf("Publishing gave %d: %+v", code, rp)
+	}
+
+	// browse and play back
+	var replays []storage.Replay
+	if code := send("GET", "/api/replays?puzzle="+sampleDefaultName+"&order=best&count=100", nil, &replays); code != http.StatusOK {
+		t.Errorf("Browsing gave %d", code)
+	}
+	listed := false
+	for _, r := range replays {
+		listed = listed || r.Id == rp.Id
+	}
+	if !listed {
+		t.Errorf("Published replay %d isn't listed in %+v", rp.Id, replays)
+	}
+	for _, bad := range []string{"rating=x", "count=-1", "order=worst"} {
+		if code := send("GET", "/api/replays?"+bad, nil, nil); code != http.StatusNotFound {
+			t.Errorf("Browsing with %q gave %d", bad, code)
+		}
+	}
+	path := fmt.Sprintf("/api/replay?id=%d", rp.Id)
+	var played replayPlayback
+	if code := send("GET", path, nil, &played); code != http.StatusOK ||
+		played.Replay == nil || played.Playback == nil || len(played.Playback.Frames) != played.Moves {
+		t.Errorf("Playback gave %d: %+v", code, played)
+	}
+	if code := send("GET", "/api/replay?id=x", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Playing back a bad id gave %d", code)
+	}
+	if code := send("PUT", path, nil, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Putting a replay gave %d", code)
+	}
+
+	// unpublish, then have an admin remove a republished replay
+	if code := send("DELETE", path, nil, nil); code != http.StatusNoContent {
+		t.Errorf("Unpublishing gave %d", code)
+	}
+	if code := send("GET", path, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Unpublished replay gave %d", code)
+	}
+	if code := send("POST", "/api/replays?title=Again", nil, &rp); code != http.StatusCreated {
+		t.Fatalf("Republishing gave %d", code)
+	}
+	admin := func(path string) int {
+		w := httptest.NewRecorder()
+		adminHandler(w, httptest.NewRequest("DELETE", path, nil))
+		return w.Code
+	}
+	if code := admin(fmt.Sprintf("/admin/replays/%d", rp.Id)); code != http.StatusNoContent {
+		t.Errorf("Admin removal gave %d", code)
+	}
+	if code := admin(fmt.Sprintf("/admin/replays/%d", rp.Id)); code != http.StatusNotFound {
+		t.Errorf("Second admin removal gave %d", code)
+	}
+}
+
+func TestIntakeEndpoint(t *testing.T) {
+	storageConnect(t, "TestIntakeEndpoint")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	send := func(method string, body interface{}, result *intakeResult) int {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, srv.URL+"/api/intake", bytes.NewReader(b))
+		r, e := c.Do(req)
+		if e != nil {
+			t.Fatalf("Intake request failed: %v", e)
+		}
+		defer r.Body.Close()
+		if result != nil && (r.StatusCode == http.StatusOK || r.StatusCode == http.StatusCreated) {
+			if e := json.NewDecoder(r.Body).Decode(result); e != nil {
+				t.Errorf("Failed to decode intake result: %v", e)
+			}
+		}
+		return r.StatusCode
+	}
+
+	// recognize a grid with one unsure cell
+	var summary puzzle.Summary
+	r, e := c.Get(srv.URL + "/api/summary")
+	if e != nil {
+		t.Fatalf("Summary request failed: %v", e)
+	}
+	e = json.NewDecoder(r.Body).Decode(&summary)
+	r.Body.Close()
+	if e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	grid := &puzzle.RecognizedGrid{Geometry: summary.Geometry, SideLength: summary.SideLength}
+	for _, v := range summary.Values {
+		grid.Cells = append(grid.Cells, puzzle.RecognizedCell{Value: v, Confidence: 0.99})
+	}
+	grid.Cells[0].Confidence = 0.1
+	var result intakeResult
+	if code := send("POST", grid, &result); code != http.StatusOK || result.Ready || len(result.Flags) != 1 ||
+		result.Name != "" {
+		t.Errorf("Unsure grid gave %d: %+v", code, result)
+	}
+
+	// confirming it adds the puzzle, which is already in the
+	// session, so it just becomes active
+	grid.Confirmed = []int{1}
+	result = intakeResult{}
+	if code := send("POST", grid, &result); code != http.StatusCreated || !result.Ready || result.Name == "" {
+		t.Errorf("Confirmed grid gave %d: %+v", code, result)
+	}
+
+	// bad requests
+	if code := send("GET", grid, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Getting intake gave %d", code)
+	}
+	grid.Cells = grid.Cells[1:]
+	if code := send("POST", grid, nil); code == http.StatusOK || code == http.StatusCreated {
+		t.Errorf("Wrong-size grid gave %d", code)
+	}
+	if code := send("POST", "not a grid", nil); code == http.StatusOK || code == http.StatusCreated {
+		t.Errorf("Undecodable grid gave %d", code)
+	}
+	grid.Geometry = puzzle.RectangularGeometryName
+	if code := send("POST", grid, nil); code != http.StatusNotFound || features.enabled("variants") {
+		t.Errorf("Rectangular grid without variants gave %d", code)
+	}
+}
+
+func TestNotesEndpoints(t *testing.T) {
+	storageConnect(t, "TestNotesEndpoints")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	send := func(method, query string, body interface{}, result interface{}) int {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, srv.URL+"/api/notes"+query, bytes.NewReader(b))
+		r, e := c.Do(req)
+		if e != nil {
+			t.Fatalf("Notes request failed: %v", e)
+		}
+		defer r.Body.Close()
+		if result != nil && (r.StatusCode == http.StatusOK || r.StatusCode == http.StatusCreated) {
+			if e := json.NewDecoder(r.Body).Decode(result); e != nil {
+				t.Errorf("Failed to decode notes result: %v", e)
+			}
+		}
+		return r.StatusCode
+	}
+
+	var notes []puzzle.Annotation
+	if code := send("GET", "", nil, &notes); code != http.StatusOK || len(notes) != 0 {
+		t.Fatalf("New session notes gave %d: %+v", code, notes)
+	}
+	var note puzzle.Annotation
+	if code := send("POST", "", puzzle.Annotation{Square: 2, Text: "try a 3"}, &note); code != http.StatusCreated ||
+		note.Id == 0 || note.Author == "" {
+		t.Fatalf("Adding a note gave %d: %+v", code, note)
+	}
+	if code := send("POST", "", puzzle.Annotation{Square: 2}, nil); code != http.StatusBadRequest {
+		t.Errorf("Adding an empty note gave %d", code)
+	}
+	if code := send("GET", "", nil, &notes); code != http.StatusOK || len(notes) != 1 || notes[0].Text != "try a 3" {
+		t.Errorf("Notes are %d: %+v", code, notes)
+	}
+	if code := send("PUT", "", nil, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Putting notes gave %d", code)
+	}
+	if code := send("DELETE", fmt.Sprintf("?id=%d", note.Id), nil, nil); code != http.StatusNoContent {
+		t.Errorf("Removing a note gave %d", code)
+	}
+	if code := send("DELETE", fmt.Sprintf("?id=%d", note.Id), nil, nil); code != http.StatusNotFound {
+		t.Errorf("Removing a note twice gave %d", code)
+	}
+}
+
+func TestBookmarkEndpoints(t *testing.T) {
+	storageConnect(t, "TestBookmarkEndpoints")
+	defer storage.Close()
+
+	// server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &session{sid: getCookie(w, r)}
+		s.load(w, r)
+		s.rootHandler(w, r)
+	}))
+	defer srv.Close()
+
+	// client
+	jar, e := cookiejar.New(nil)
+	if e != nil {
+		t.Fatalf("Failed to create cookie jar: %v", e)
+	}
+	c := http.Client{Jar: jar}
+	send := func(method, path string, result interface{}) int {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		r, e := c.Do(req)
+		if e != nil {
+			t.Fatalf("Bookmark request failed: %v", e)
+		}
+		defer r.Body.Close()
+		if result != nil && (r.StatusCode == http.StatusOK || r.StatusCode == http.StatusCreated) {
+			if e := json.NewDecoder(r.Body).Decode(result); e != nil {
+				t.Errorf("Failed to decode bookmark result: %v", e)
+			}
+		}
+		return r.StatusCode
+	}
+
+	var bookmarks []storage.Bookmark
+	if code := send("GET", "/api/bookmarks", &bookmarks); code != http.StatusOK || len(bookmarks) != 0 {
+		t.Fatalf("New session bookmarks gave %d: %+v", code, bookmarks)
+	}
+	var lib, pos storage.Bookmark
+	if code := send("POST", "/api/bookmarks?puzzle=sample-2&label=later", &lib); code != http.StatusCreated ||
+		lib.Label != "later" || lib.Name != "sample-2" {
+		t.Fatalf("Bookmarking a library puzzle gave %d: %+v", code, lib)
+	}
+	if code := send("POST", "/api/bookmarks?puzzle=no-such-puzzle", nil); code != http.StatusNotFound {
+		t.Errorf("Bookmarking an unknown puzzle gave %d", code)
+	}
+	if code := send("POST", "/api/bookmarks", &pos); code != http.StatusCreated || pos.Choices == nil {
+		t.Fatalf("Bookmarking a position gave %d: %+v", code, pos)
+	}
+	var state json.RawMessage
+	if code := send("POST", fmt.Sprintf("/api/bookmark?id=%d", lib.Id), &state); code != http.StatusOK {
+		t.Errorf("Opening a bookmark gave %d", code)
+	}
+	if code := send("POST", "/api/bookmark?id=x", nil); code != http.StatusNotFound {
+		t.Errorf("Opening a bad bookmark gave %d", code)
+	}
+	if code := send("DELETE", fmt.Sprintf("/api/bookmark?id=%d", pos.Id), nil); code != http.StatusNoContent {
+		t.Errorf("Removing a bookmark gave %d", code)
+	}
+	if code := send("PUT", "/api/bookmarks", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Putting bookmarks gave %d", code)
+	}
+	if code := send("GET", "/api/bookmarks", &bookmarks); code != http.StatusOK || len(bookmarks) != 1 ||
+		bookmarks[0].Id != lib.Id {
+		t.Errorf("Bookmarks are %d: %+v", code, bookmarks)
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	p, e := puzzle.New(&puzzle.Summary{
+		Geometry:   puzzle.StandardGeometryName,
+		SideLength: 4,
+		Values: []int{
+			1, 0, 3, 0,
+			0, 3, 0, 1,
+			3, 0, 1, 0,
+			2, 1, 0, 3,
+		},
+	})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	entries := glossary(p)
+	if len(entries) != len(puzzle.Glossary()) {
+		t.Fatalf("Glossary has %d entries, expected %d", len(entries), len(puzzle.Glossary()))
+	}
+	for _, ge := range entries {
+		if ge.Example == nil || ge.Example.Technique != ge.Name {
+			t.Errorf("Glossary entry %q has example %+v", ge.Name, ge.Example)
+		}
+	}
+	if _, e := p.Assign(puzzle.Choice{Index: 2, Value: 4}); e != nil {
+		t.Fatalf("Failed to make puzzle unsolvable: %v", e)
+	}
+	for _, ge := range glossary(p) {
+		if ge.Example != nil {
+			t.Errorf("Unsolvable puzzle has example %+v of %q", ge.Example, ge.Name)
+		}
+	}
+}
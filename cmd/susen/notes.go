@@ -0,0 +1,85 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+/*
+
+annotations
+
+Players can leave notes on the squares and groups of their
+active puzzle, and so can their teachers, who use the class and
+student names from the teacher API.  Notes come back in the
+puzzle's summary, too.  Each side can only remove its own notes.
+
+	GET    /api/notes                         the active puzzle's notes
+	POST   /api/notes                         add a note (puzzle.Annotation body)
+	DELETE /api/notes?id=n                    remove one of the player's notes
+	GET    /teach/notes/<class>/<student>     a student's active puzzle's notes
+	POST   /teach/notes/<class>/<student>     add a note (puzzle.Annotation body)
+	DELETE /teach/notes/<class>/<student>?id=n
+	                                          remove one of the teacher's notes
+
+*/
+
+// serveNotes serves the annotation endpoints for a session's
+// active puzzle, on behalf of the given teacher or, if there
+// isn't one, the session's player.
+func serveNotes(ss *storage.Session, teacher string, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		notes := ss.Puzzle.Annotations()
+		if notes == nil {
+			notes = []puzzle.Annotation{}
+		}
+		writeJSON(w, r, http.StatusOK, notes)
+	case "POST":
+		var a puzzle.Annotation
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			puzzle.SendError(puzzle.DecodeError(err), w, r)
+			return
+		}
+		added, err := ss.Annotate(a, teacher)
+		if err != nil {
+			puzzle.SendError(err.(puzzle.Error), w, r)
+			return
+		}
+		slog.Info("Added annotation", "puzzle", ss.Info.PuzzleId, "annotation", added.Id, "author", added.Author)
+		writeJSON(w, r, http.StatusCreated, added)
+	case "DELETE":
+		arg := r.URL.Query().Get("id")
+		id, err := strconv.Atoi(arg)
+		if err != nil || !ss.RemoveAnnotation(id, teacher) {
+			puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+			return
+		}
+		slog.Info("Removed annotation", "puzzle", ss.Info.PuzzleId, "annotation", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+	}
+}
@@ -0,0 +1,543 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+notifications
+
+Sessions subscribe to hear about the puzzles of the day,
+assignments coming due, and the rounds of tournaments they've
+entered starting, over any channel the server has a notifier for.
+Notifiers are adapters, one per channel: email goes out over
+SMTP, webhooks are POSTed to the subscriber's URL (signed like
+the server's own webhooks), and push notifications are handed to
+a push gateway.  A channel whose notifier isn't configured can't
+be subscribed to.
+
+Sending happens on a background worker, so neither the daily
+publisher nor the reminder checks wait on it.  Failed sends are
+logged, not retried.  The server checks for assignment reminders
+and round starts every so often; other instances may get to
+them first, in which case there's nothing left to send.  Admins
+can check on demand by running the "reminders" pool refill.
+
+	GET    /api/subscriptions          the channels and the session's subscriptions
+	POST   /api/subscriptions?topic=t&channel=c&address=a
+	                                   subscribe, or change the address
+	DELETE /api/subscriptions?topic=t&channel=c
+	                                   unsubscribe
+
+*/
+
+// notification flags: each channel is off unless configured.
+var (
+	smtpServer = flagString("smtp-server", "SMTP_SERVER", "",
+		"host:port of the SMTP server for email notifications")
+	smtpFrom = flagString("smtp-from", "SMTP_FROM", "",
+		"sender address of email notifications")
+	smtpUser = flagString("smtp-user", "SMTP_USER", "",
+		"user name for the SMTP server, if it needs one")
+	smtpPassword = flagString("smtp-password", "SMTP_PASSWORD", "",
+		"password for the SMTP server")
+	pushGateway = flagString("push-gateway", "PUSH_GATEWAY", "",
+		"URL of the gateway that delivers push notifications")
+	subscriberWebhooks = flagBool("subscriber-webhooks", "SUBSCRIBER_WEBHOOKS", false,
+		"whether sessions can subscribe their own webhooks")
+	notifyCheck = flagDuration("notify-check", "NOTIFY_CHECK", time.Minute,
+		"how often to check for assignment reminders and round starts")
+	reminderLead = flagDuration("reminder-lead", "REMINDER_LEAD", 24*time.Hour,
+		"how long before an assignment is due to remind its class")
+)
+
+// Notification channels.
+const (
+	emailChannel   = "email"
+	webhookChannel = "webhook"
+	pushChannel    = "push"
+)
+
+// more webhook events, for notifications
+const (
+	assignmentDueEvent webhookEvent = "assignment.due"
+	roundStartedEvent  webhookEvent = "tournament.round.started"
+)
+
+// A notification is one message for the subscribers to a topic.
+// Each notifier shows it in its own way: the subject and text are
+// for people, the event and data for programs.
+type notification struct {
+	Topic   string       `json:"topic"`
+	Event   webhookEvent `json:"event"`
+	Subject string       `json:"subject"`
+	Text    string       `json:"text"`
+	Link    string       `json:"link,omitempty"`
+	Data    interface{}  `json:"data,omitempty"`
+}
+
+// A notifier sends notifications over one channel.
+type notifier interface {
+	// valid says whether an address can be sent to.
+	valid(address string) bool
+	// send sends a notification to an address.
+	send(address string, n *notification) error
+}
+
+/*
+
+notifiers
+
+*/
+
+// An emailNotifier sends notifications as plain text email.
+type emailNotifier struct {
+	server   string
+	from     string
+	auth     smtp.Auth
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// newEmailNotifier creates an email notifier for an SMTP server,
+// which is sent the user and password if there is a user.
+func newEmailNotifier(server, from, user, password string) *emailNotifier {
+	en := &emailNotifier{server: server, from: from, sendMail: smtp.SendMail}
+	if user != "" {
+		host := server
+		if i := strings.LastIndex(server, ":"); i >= 0 {
+			host = server[:i]
+		}
+		en.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return en
+}
+
+func (en *emailNotifier) valid(address string) bool {
+	a, err := mail.ParseAddress(address)
+	return err == nil && a.Address == address
+}
+
+func (en *emailNotifier) send(address string, n *notification) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", en.from, address, mime.QEncoding.Encode("utf-8", n.Subject))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	if n.Link != "" {
+		msg.WriteString("\r\n\r\n" + n.Link)
+	}
+	msg.WriteString("\r\n")
+	return en.sendMail(en.server, en.auth, en.from, []string{address}, msg.Bytes())
+}
+
+// A subscriberWebhookNotifier POSTs notifications to the URLs
+// subscribers give, in the same form as the server's webhooks.
+type subscriberWebhookNotifier struct {
+	secret []byte
+	client *http.Client
+	serial atomic.Int64
+}
+
+func (wn *subscriberWebhookNotifier) valid(address string) bool {
+	u, err := url.Parse(address)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (wn *subscriberWebhookNotifier) send(address string, n *notification) error {
+	now := time.Now()
+	id := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatInt(wn.serial.Add(1), 36)
+	body, err := json.Marshal(webhookPayload{ID: id, Event: n.Event, Time: now, Data: n})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Susen-Event", string(n.Event))
+	req.Header.Set("X-Susen-Delivery", id)
+	signRequest(req, wn.secret, body)
+	return postNotification(wn.client, req)
+}
+
+// A pushNotifier hands notifications to a push gateway, which
+// knows how to reach the devices that subscribers' tokens name.
+type pushNotifier struct {
+	gateway string
+	client  *http.Client
+}
+
+// A pushMessage is what a push notifier sends its gateway.
+type pushMessage struct {
+	Token string       `json:"token"`
+	Title string       `json:"title"`
+	Body  string       `json:"body"`
+	Link  string       `json:"link,omitempty"`
+	Event webhookEvent `json:"event"`
+}
+
+func (pn *pushNotifier) valid(address string) bool {
+	return address != "" && !strings.ContainsAny(address, " \t\r\n")
+}
+
+func (pn *pushNotifier) send(address string, n *notification) error {
+	body, err := json.Marshal(pushMessage{address, n.Subject, n.Text, n.Link, n.Event})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", pn.gateway, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postNotification(pn.client, req)
+}
+
+// postNotification makes a notification request, which fails
+// unless it gets a success status.
+func postNotification(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &webhookStatusError{resp.StatusCode}
+	}
+	return nil
+}
+
+/*
+
+notification dispatch
+
+*/
+
+// A notice is one notification bound for one recipient.
+type notice struct {
+	to storage.Recipient
+	n  *notification
+}
+
+// A notificationDispatcher sends notifications with its notifiers.
+type notificationDispatcher struct {
+	notifiers map[string]notifier
+	queue     chan notice
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// notificationQueueSize bounds the notices waiting for the
+// worker; notices beyond that are dropped rather than blocking.
+const notificationQueueSize = 1024
+
+// newNotificationDispatcher creates a dispatcher for the given
+// notifiers, by channel, and starts its worker.
+func newNotificationDispatcher(notifiers map[string]notifier) *notificationDispatcher {
+	nd := &notificationDispatcher{
+		notifiers: notifiers,
+		queue:     make(chan notice, notificationQueueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go nd.run()
+	return nd
+}
+
+// channels lists the channels the dispatcher can send on.
+func (nd *notificationDispatcher) channels() []string {
+	channels := []string{}
+	if nd != nil {
+		for c := range nd.notifiers {
+			channels = append(channels, c)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// notifier returns the dispatcher's notifier for a channel, if any.
+func (nd *notificationDispatcher) notifier(channel string) notifier {
+	if nd == nil {
+		return nil
+	}
+	return nd.notifiers[channel]
+}
+
+// notify queues a notification for each of the recipients.
+func (nd *notificationDispatcher) notify(recipients []storage.Recipient, n *notification) {
+	if nd == nil {
+		return
+	}
+	for _, to := range recipients {
+		select {
+		case nd.queue <- notice{to, n}:
+		default:
+			slog.Warn("Notification queue full, dropping notice", "topic", n.Topic, "channel", to.Channel)
+		}
+	}
+}
+
+// run is the worker loop: it sends queued notices until the queue
+// is closed, or the dispatcher is stopped.
+func (nd *notificationDispatcher) run() {
+	defer close(nd.done)
+	for nc := range nd.queue {
+		select {
+		case <-nd.stop:
+			slog.Warn("Abandoned notifications at shutdown")
+			return
+		default:
+		}
+		nf := nd.notifiers[nc.to.Channel]
+		if nf == nil {
+			slog.Debug("No notifier for channel", "channel", nc.to.Channel, "session", nc.to.SessionId)
+			continue
+		}
+		if err := nf.send(nc.to.Address, nc.n); err != nil {
+			slog.Warn("Notification failed", "topic", nc.n.Topic, "channel", nc.to.Channel,
+				"session", nc.to.SessionId, "error", err)
+		} else {
+			slog.Debug("Sent notification", "topic", nc.n.Topic, "channel", nc.to.Channel,
+				"session", nc.to.SessionId)
+		}
+	}
+}
+
+// close stops the dispatcher, giving queued notices up to the
+// given time to be sent.
+func (nd *notificationDispatcher) close(timeout time.Duration) {
+	close(nd.queue)
+	select {
+	case <-nd.done:
+	case <-time.After(timeout):
+		close(nd.stop)
+		<-nd.done
+	}
+}
+
+/*
+
+server notifications
+
+*/
+
+// The server's dispatcher, if any channels are configured.
+var (
+	notificationsOnce sync.Once
+	notifications     *notificationDispatcher
+)
+
+// configuredNotifiers returns the notifiers the flags configure,
+// by channel.
+func configuredNotifiers() map[string]notifier {
+	notifiers := map[string]notifier{}
+	if *smtpServer != "" && *smtpFrom != "" {
+		notifiers[emailChannel] = newEmailNotifier(*smtpServer, *smtpFrom, *smtpUser, *smtpPassword)
+	}
+	if *subscriberWebhooks {
+		notifiers[webhookChannel] = &subscriberWebhookNotifier{
+			secret: []byte(*webhookSecret),
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	if *pushGateway != "" {
+		notifiers[pushChannel] = &pushNotifier{*pushGateway, &http.Client{Timeout: 10 * time.Second}}
+	}
+	return notifiers
+}
+
+// startNotifications creates the server's dispatcher from the
+// flags, schedules regular reminder checks, and registers the
+// refill.  It has to run before the dailies start, so their first
+// publication is announced.
+func startNotifications() {
+	notificationsOnce.Do(func() {
+		notifiers := configuredNotifiers()
+		if len(notifiers) == 0 {
+			return
+		}
+		notifications = newNotificationDispatcher(notifiers)
+		atShutdown(func() { notifications.close(5 * time.Second) })
+		slog.Info("Notifications enabled", "channels", notifications.channels())
+
+		registerRefill("reminders", func() (int, error) { return sendReminders(time.Now()) })
+		done := make(chan struct{})
+		atShutdown(func() { close(done) })
+		go func() {
+			ticker := time.NewTicker(*notifyCheck)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case now := <-ticker.C:
+					if _, err := sendReminders(now); err != nil {
+						slog.Warn("Failed to send reminders", "error", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// notifySubscribers sends a notification to the recipients, if
+// any channels are configured.
+func notifySubscribers(recipients []storage.Recipient, n *notification) {
+	notifications.notify(recipients, n)
+}
+
+// sendReminders notifies the classes of assignments coming due and
+// the entrants of rounds that have started, and returns how many
+// assignments and rounds it notified about.
+func sendReminders(now time.Time) (count int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	for _, a := range storage.RemindAssignments(now, *reminderLead) {
+		slog.Info("Reminding class of assignment", "class", a.Class, "assignment", a.Name, "due", a.Due)
+		notifySubscribers(storage.ClassSubscribers(a.Class), assignmentNotification(a))
+		count++
+	}
+	for _, sr := range storage.StartRounds(now) {
+		slog.Info("Started tournament round", "tournament", sr.Tournament, "round", sr.Round.Round)
+		notifySubscribers(storage.TournamentSubscribers(sr.Tournament), roundNotification(sr))
+		count++
+	}
+	return count, nil
+}
+
+// dailyNotification announces the day's newly published puzzles.
+func dailyNotification(listings []dailyListing) *notification {
+	var text strings.Builder
+	for _, l := range listings {
+		fmt.Fprintf(&text, "%s (rating %d)\n", l.Name, l.Rating)
+	}
+	return &notification{
+		Topic:   storage.DailyTopic,
+		Event:   dailyPublishedEvent,
+		Subject: "New puzzles of the day for " + listings[0].Date,
+		Text:    strings.TrimSuffix(text.String(), "\n"),
+		Link:    listings[0].Link,
+		Data:    listings,
+	}
+}
+
+// assignmentNotification reminds a class of an assignment.
+func assignmentNotification(a *storage.Assignment) *notification {
+	return &notification{
+		Topic:   storage.AssignmentTopic,
+		Event:   assignmentDueEvent,
+		Subject: "Assignment due soon: " + a.Title,
+		Text: fmt.Sprintf("%q for class %s (%d puzzles) is due %s.",
+			a.Title, a.Class, len(a.Puzzles), a.Due.UTC().Format(time.RFC1123)),
+		Data: a,
+	}
+}
+
+// roundNotification announces the start of a tournament round.
+func roundNotification(sr *storage.StartedRound) *notification {
+	l := makeRoundListing(sr.Round)
+	return &notification{
+		Topic:   storage.TournamentTopic,
+		Event:   roundStartedEvent,
+		Subject: fmt.Sprintf("Round %d of %s has started", l.Round, sr.Tournament),
+		Text:    fmt.Sprintf("The round ends %s.", l.Ends.UTC().Format(time.RFC1123)),
+		Link:    l.Link,
+		Data:    roundStarted{sr.Tournament, l},
+	}
+}
+
+// A roundStarted is the data of a round start notification.
+type roundStarted struct {
+	Tournament string       `json:"tournament"`
+	Round      roundListing `json:"round"`
+}
+
+/*
+
+subscription endpoints
+
+*/
+
+// A subscriptionListing is what the API shows of subscriptions:
+// the channels that can be subscribed to, and the session's.
+type subscriptionListing struct {
+	Channels      []string                `json:"channels"`
+	Subscriptions []*storage.Subscription `json:"subscriptions"`
+}
+
+// subscriptionHandler serves the subscription API endpoints.
+func (s *session) subscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	invalid := func(arg string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+		slog.Debug("Invalid subscription argument", "path", r.URL.Path, "argument", arg)
+	}
+	topic, channel := q.Get("topic"), q.Get("channel")
+	switch r.Method {
+	case "GET":
+		writeJSON(w, r, http.StatusOK, subscriptionListing{notifications.channels(), s.ss.Subscriptions()})
+	case "POST":
+		address := q.Get("address")
+		nf := notifications.notifier(channel)
+		switch {
+		case !storage.ValidTopic(topic):
+			invalid(topic)
+		case nf == nil:
+			invalid(channel)
+		case !storage.ValidSubscriptionAddress(address) || !nf.valid(address):
+			invalid(address)
+		default:
+			sub := s.ss.Subscribe(topic, channel, address)
+			slog.Info("Subscribed", s.attrs(), "topic", topic, "channel", channel)
+			writeJSON(w, r, http.StatusCreated, sub)
+		}
+	case "DELETE":
+		if !s.ss.Unsubscribe(topic, channel) {
+			invalid(topic + " " + channel)
+			return
+		}
+		slog.Info("Unsubscribed", s.attrs(), "topic", topic, "channel", channel)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+	}
+}
@@ -0,0 +1,178 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/ancientHacker/susen.go/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A testNotifier records what it's asked to send.
+type testNotifier struct {
+	mutex sync.Mutex
+	sent  []string
+}
+
+func (tn *testNotifier) valid(address string) bool { return address != "" }
+
+func (tn *testNotifier) send(address string, n *notification) error {
+	tn.mutex.Lock()
+	defer tn.mutex.Unlock()
+	tn.sent = append(tn.sent, address+" "+n.Subject)
+	return nil
+}
+
+func TestNotificationDispatch(t *testing.T) {
+	tn := &testNotifier{}
+	nd := newNotificationDispatcher(map[string]notifier{"test": tn})
+	if cs := nd.channels(); len(cs) != 1 || cs[0] != "test" || nd.notifier("other") != nil {
+		t.Errorf("Dispatcher channels are %v", cs)
+	}
+	nd.notify([]storage.Recipient{
+		{SessionId: "a", Channel: "test", Address: "ann"},
+		{SessionId: "b", Channel: "other", Address: "bob"},
+		{SessionId: "c", Channel: "test", Address: "carl"},
+	}, &notification{Topic: storage.DailyTopic, Subject: "hello"})
+	nd.close(time.Second)
+	if len(tn.sent) != 2 || tn.sent[0] != "ann hello" || tn.sent[1] != "carl hello" {
+		t.Errorf("Sent %v", tn.sent)
+	}
+
+	// no dispatcher, no channels, nothing sent
+	var none *notificationDispatcher
+	none.notify([]storage.Recipient{{Channel: "test", Address: "ann"}}, &notification{})
+	if cs := none.channels(); len(cs) != 0 || none.notifier("test") != nil {
+		t.Errorf("Missing dispatcher has channels %v", cs)
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	en := newEmailNotifier("mail.example.com:587", "susen@example.com", "user", "secret")
+	if en.auth == nil {
+		t.Errorf("Notifier with a user has no auth")
+	}
+	for address, valid := range map[string]bool{
+		"ann@example.com": true, "Ann <ann@example.com>": false, "ann": false, "": false,
+	} {
+		if en.valid(address) != valid {
+			t.Errorf("Address %q valid is %v", address, !valid)
+		}
+	}
+	var server, msg string
+	var to []string
+	en.sendMail = func(addr string, a smtp.Auth, from string, rcpt []string, m []byte) error {
+		server, to, msg = addr, rcpt, string(m)
+		return nil
+	}
+	n := &notification{Subject: "New puzzles of the day", Text: "one\ntwo", Link: "/select/sample-1"}
+	if err := en.send("ann@example.com", n); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if server != "mail.example.com:587" || len(to) != 1 || to[0] != "ann@example.com" {
+		t.Errorf("Sent to %v at %q", to, server)
+	}
+	for _, part := range []string{"To: ann@example.com\r\n", "Subject: New puzzles of the day\r\n",
+		"\r\n\r\none\r\ntwo\r\n\r\n/select/sample-1\r\n"} {
+		if !strings.Contains(msg, part) {
+			t.Errorf("Message doesn't contain %q: %q", part, msg)
+		}
+	}
+}
+
+func TestHTTPNotifiers(t *testing.T) {
+	var mutex sync.Mutex
+	var bodies [][]byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get("X-Susen-Signature"); sig != "" && sig != "sha256="+signPayload([]byte("key"), r.Header.Get("X-Susen-Timestamp"), body) {
+			t.Errorf("Bad signature %q", sig)
+		}
+		mutex.Lock()
+		bodies = append(bodies, body)
+		mutex.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	n := &notification{Topic: storage.TournamentTopic, Event: roundStartedEvent, Subject: "Round 1", Text: "Go"}
+
+	wn := &subscriberWebhookNotifier{secret: []byte("key"), client: srv.Client()}
+	if !wn.valid(srv.URL) || wn.valid("ftp://example.com/") || wn.valid("example.com") {
+		t.Errorf("Webhook address validation is wrong")
+	}
+	if err := wn.send(srv.URL, n); err != nil {
+		t.Fatalf("Webhook send failed: %v", err)
+	}
+	var payload struct {
+		Event webhookEvent
+		Data  notification
+	}
+	if err := json.Unmarshal(bodies[0], &payload); err != nil || payload.Event != roundStartedEvent ||
+		payload.Data.Subject != "Round 1" {
+		t.Errorf("Webhook payload is %+v (%v)", payload, err)
+	}
+
+	pn := &pushNotifier{srv.URL, srv.Client()}
+	if !pn.valid("device-token") || pn.valid("two words") || pn.valid("") {
+		t.Errorf("Push address validation is wrong")
+	}
+	if err := pn.send("device-token", n); err != nil {
+		t.Fatalf("Push send failed: %v", err)
+	}
+	var pm pushMessage
+	if err := json.Unmarshal(bodies[1], &pm); err != nil || pm.Token != "device-token" || pm.Title != "Round 1" ||
+		pm.Body != "Go" || pm.Event != roundStartedEvent {
+		t.Errorf("Push message is %+v (%v)", pm, err)
+	}
+	status = http.StatusBadGateway
+	if err := pn.send("device-token", n); err == nil {
+		t.Errorf("Push send to a failing gateway succeeded")
+	}
+}
+
+func TestNotificationMessages(t *testing.T) {
+	d := dailyNotification([]dailyListing{
+		{Date: "2026-10-16", Rating: 1, Name: "sample-1", Link: "/select/sample-1"},
+		{Date: "2026-10-16", Rating: 3, Name: "sample-4", Link: "/select/sample-4"},
+	})
+	if d.Topic != storage.DailyTopic || !strings.HasSuffix(d.Subject, "2026-10-16") ||
+		d.Text != "sample-1 (rating 1)\nsample-4 (rating 3)" || d.Link != "/select/sample-1" {
+		t.Errorf("Daily notification is %+v", d)
+	}
+	due := time.Date(2026, 10, 17, 15, 0, 0, 0, time.UTC)
+	a := assignmentNotification(&storage.Assignment{Class: "c", Name: "a", Title: "Warmups", Due: due,
+		Puzzles: []string{"p1", "p2"}})
+	if a.Topic != storage.AssignmentTopic || a.Event != assignmentDueEvent || !strings.Contains(a.Subject, "Warmups") ||
+		!strings.Contains(a.Text, "2 puzzles") || !strings.Contains(a.Text, "17 Oct 2026") {
+		t.Errorf("Assignment notification is %+v", a)
+	}
+	r := roundNotification(&storage.StartedRound{Tournament: "fall", Round: &storage.TournamentRound{
+		Round: 2, Starts: due, Ends: due.Add(time.Hour), Info: &storage.PuzzleInfo{Name: "sample-2"}}})
+	if r.Topic != storage.TournamentTopic || r.Subject != "Round 2 of fall has started" || r.Link != "/select/sample-2" {
+		t.Errorf("Round notification is %+v", r)
+	}
+}
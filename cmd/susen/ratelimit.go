@@ -0,0 +1,257 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+rate limit configuration
+
+*/
+
+// rate limiting flags: a rate of 0 turns off limiting for that
+// class of endpoint.
+var (
+	cheapRate = flagFloat("rate-cheap", "RATE_CHEAP", 10,
+		"sustained requests per second allowed for cheap endpoints")
+	cheapBurst = flagInt("burst-cheap", "BURST_CHEAP", 40,
+		"burst of requests allowed for cheap endpoints")
+	expensiveRate = flagFloat("rate-expensive", "RATE_EXPENSIVE", 1,
+		"sustained requests per second allowed for expensive endpoints")
+	expensiveBurst = flagInt("burst-expensive", "BURST_EXPENSIVE", 5,
+		"burst of requests allowed for expensive endpoints")
+	proxyHops = flagInt("proxy-hops", "PROXY_HOPS", defaultProxyHops(),
+		"number of trusted proxies that append to X-Forwarded-For")
+)
+
+// defaultProxyHops is 1 on a Heroku dyno, which is always behind
+// the Heroku router, and 0 elsewhere.
+func defaultProxyHops() int {
+	if os.Getenv("DYNO") != "" {
+		return 1
+	}
+	return 0
+}
+
+// An endpointClass groups endpoints that share rate limits.
+type endpointClass int
+
+const (
+	cheapEndpoint endpointClass = iota
+	expensiveEndpoint
+)
+
+// expensiveEndpoints are the API endpoints that have to do real
+// work (solving, generating, or scoring many players) to produce
+// a response.
+var expensiveEndpoints = map[string]bool{
+	"practice":  true,
+	"score":     true,
+	"mistakes":  true,
+	"playback":  true,
+	"explain":   true,
+	"stats":     true,
+	"standings": true,
+	"bracket":   true,
+	"results":   true,
+}
+
+// classifyRequest returns the endpoint class of a request.
+func classifyRequest(r *http.Request) endpointClass {
+	if matches := apiEndpointRegexp.FindStringSubmatch(r.URL.Path); matches != nil {
+		if expensiveEndpoints[strings.ToLower(matches[1])] {
+			return expensiveEndpoint
+		}
+	}
+	return cheapEndpoint
+}
+
+/*
+
+token buckets
+
+*/
+
+// A tokenBucket holds up to burst tokens, refilled at rate
+// tokens per second.  Each request takes one token.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// A rateLimiter keeps one tokenBucket per key, all with the same
+// rate and burst.  Buckets that have been idle long enough to
+// refill completely are discarded periodically, since they are
+// indistinguishable from new ones.
+type rateLimiter struct {
+	rate    float64
+	burst   int
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// newRateLimiter creates a limiter with the given rate and burst.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the key's bucket at time now.  If no
+// token is available, it returns false and how long the caller
+// has to wait until one will be.  A limiter with a zero rate
+// allows everything.
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	return rl.allowAll([]string{key}, now)
+}
+
+// allowAll is allow for several keys at once: a token is taken
+// from every key's bucket only if all of them have one, so a
+// request refused on one key doesn't use up the others.  The
+// wait returned is the longest of the refusing buckets' waits.
+func (rl *rateLimiter) allowAll(keys []string, now time.Time) (bool, time.Duration) {
+	if rl == nil || rl.rate <= 0 {
+		return true, 0
+	}
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.sweep(now)
+	var wait time.Duration
+	buckets := make([]*tokenBucket, len(keys))
+	for i, key := range keys {
+		b, ok := rl.buckets[key]
+		if !ok {
+			b = &tokenBucket{tokens: float64(rl.burst), last: now}
+			rl.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(rl.burst), b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+		b.last = now
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration((1-b.tokens)/rl.rate*float64(time.Second)))
+		}
+		buckets[i] = b
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// sweep discards full buckets, at most once per refill period.
+func (rl *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(rl.burst) / rl.rate * float64(time.Second))
+	if now.Sub(rl.swept) < refill {
+		return
+	}
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.swept = now
+}
+
+/*
+
+rate limiting middleware
+
+*/
+
+// The limiters for each endpoint class.  They are created on
+// first use, so the flags have been parsed.
+var (
+	limitersOnce sync.Once
+	limiters     map[endpointClass]*rateLimiter
+)
+
+func classLimiter(class endpointClass) *rateLimiter {
+	limitersOnce.Do(func() {
+		limiters = map[endpointClass]*rateLimiter{
+			cheapEndpoint:     newRateLimiter(*cheapRate, *cheapBurst),
+			expensiveEndpoint: newRateLimiter(*expensiveRate, *expensiveBurst),
+		}
+	})
+	return limiters[class]
+}
+
+// clientAddress finds the address of the client making a request.
+// Each trusted proxy in front of the server (such as the Heroku
+// router) appends the address it got the request from to the
+// forwarding header, so the client's address is that many entries
+// from the right.  Entries further left were sent by the client
+// and can't be trusted.  With no trusted proxies, or a header too
+// short to have come through them, it's the connection's address.
+func clientAddress(r *http.Request) string {
+	if hops := *proxyHops; hops > 0 {
+		var addrs []string
+		for _, fwd := range r.Header.Values("X-Forwarded-For") {
+			addrs = append(addrs, strings.Split(fwd, ",")...)
+		}
+		if len(addrs) >= hops {
+			if addr := strings.TrimSpace(addrs[len(addrs)-hops]); addr != "" {
+				return addr
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// limitRequests wraps a handler so that requests are limited
+// both per client address and per session (if the request has a
+// session cookie).  A request is let through only if both limits
+// allow it, and counts against both; a client that drops its
+// cookie is still limited by its address.  Requests over the
+// limit get a 429 response with a Retry-After header.
+func limitRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rl := classLimiter(classifyRequest(r))
+		keys := []string{"ip:" + clientAddress(r)}
+		if sc, e := r.Cookie(sessionCookieName(r)); e == nil && sc.Value != "" {
+			keys = append(keys, "session:"+sc.Value)
+		}
+		if ok, wait := rl.allowAll(keys, time.Now()); !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			puzzle.SendError(puzzle.RequestError(puzzle.TooManyRequestsCondition, r.URL.Path, secs), w, r)
+			slog.Debug("Rate limit exceeded", "keys", keys, "retry", secs)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,235 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	rl := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := rl.allow("k", now); !ok {
+			t.Fatalf("Request %d within burst was refused", i+1)
+		}
+	}
+	ok, wait := rl.allow("k", now)
+	if ok {
+		t.Fatalf("Request over burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second/2 {
+		t.Errorf("Wait for refill is %v, expected (0, 500ms]", wait)
+	}
+	if ok, _ := rl.allow("other", now); !ok {
+		t.Errorf("Request on a different key was refused")
+	}
+	if ok, _ := rl.allow("k", now.Add(wait)); !ok {
+		t.Errorf("Request after waiting %v was refused", wait)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rl := newRateLimiter(0, 1)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		if ok, _ := rl.allow("k", now); !ok {
+			t.Fatalf("Disabled limiter refused request %d", i+1)
+		}
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	rl := newRateLimiter(1, 2)
+	now := time.Now()
+	rl.allow("a", now)
+	rl.allow("b", now)
+	rl.allow("c", now.Add(3*time.Second))
+	if _, ok := rl.buckets["a"]; ok {
+		t.Errorf("Idle bucket was not swept")
+	}
+	if _, ok := rl.buckets["c"]; !ok {
+		t.Errorf("Active bucket was swept")
+	}
+}
+
+func TestClassifyRequest(t *testing.T) {
+	cases := map[string]endpointClass{
+		"/api/state":       cheapEndpoint,
+		"/api/summary/":    cheapEndpoint,
+		"/home/":           cheapEndpoint,
+		"/api/practice":    expensiveEndpoint,
+		"/api/score":       expensiveEndpoint,
+		"/api/mistakes":    expensiveEndpoint,
+		"/api/playback":    expensiveEndpoint,
+		"/api/explain":     expensiveEndpoint,
+		"/api/stats":       expensiveEndpoint,
+		"/api/standings":   expensiveEndpoint,
+		"/api/bracket":     expensiveEndpoint,
+		"/api/results":     expensiveEndpoint,
+		"/api/roundstream": cheapEndpoint,
+	}
+	for path, expect := range cases {
+		r := httptest.NewRequest("GET", path, nil)
+		if class := classifyRequest(r); class != expect {
+			t.Errorf("Path %q: got class %v, expected %v", path, class, expect)
+		}
+	}
+	routes := apiRoutes(t)
+	for name := range expensiveEndpoints {
+		if !routes[name] {
+			t.Errorf("Expensive endpoint %q isn't an API route", name)
+		}
+		r := httptest.NewRequest("GET", "/api/"+name, nil)
+		if class := classifyRequest(r); class != expensiveEndpoint {
+			t.Errorf("Route %q: got class %v, expected expensive", name, class)
+		}
+	}
+}
+
+// apiRoutes returns the endpoint names that the API handler's
+// switch dispatches on, read from its source.
+func apiRoutes(t *testing.T) map[string]bool {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Can't parse the API handler: %v", err)
+	}
+	routes := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sw, ok := n.(*ast.SwitchStmt)
+		if !ok {
+			return true
+		}
+		if call, ok := sw.Tag.(*ast.CallExpr); !ok || len(call.Args) != 1 ||
+			!strings.HasPrefix(types.ExprString(call.Args[0]), "matches[1]") {
+			return true
+		}
+		for _, stmt := range sw.Body.List {
+			for _, e := range stmt.(*ast.CaseClause).List {
+				if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					name, _ := strconv.Unquote(lit.Value)
+					routes[name] = true
+				}
+			}
+		}
+		return false
+	})
+	if len(routes) == 0 {
+		t.Fatalf("Found no API routes")
+	}
+	return routes
+}
+
+func TestLimitRequests(t *testing.T) {
+	limitersOnce.Do(func() {})
+	saved := limiters
+	limiters = map[endpointClass]*rateLimiter{
+		cheapEndpoint:     newRateLimiter(1, 1),
+		expensiveEndpoint: newRateLimiter(1, 1),
+	}
+	defer func() { limiters = saved }()
+
+	h := limitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(addr, sid string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/state", nil)
+		r.RemoteAddr = addr + ":1234"
+		if sid != "" {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName(r), Value: sid})
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	if w := send("10.0.0.1", "s1"); w.Code != http.StatusOK {
+		t.Fatalf("First request got status %d", w.Code)
+	}
+	w := send("10.0.0.1", "s2")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Second request from same address got status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"request.url.too-many-requests"`) {
+		t.Errorf("Rate-limited response body is %s", w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After is %q, expected %q", w.Header().Get("Retry-After"), "1")
+	}
+	if w := send("10.0.0.2", "s1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Second request in same session got status %d", w.Code)
+	}
+	if w := send("10.0.0.2", ""); w.Code != http.StatusOK {
+		t.Errorf("Address refused only by session limit was debited: status %d", w.Code)
+	}
+	if w := send("10.0.0.3", ""); w.Code != http.StatusOK {
+		t.Errorf("Request from new address got status %d", w.Code)
+	}
+}
+
+func TestRateLimiterAllowAll(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	now := time.Now()
+	rl.allow("full", now)
+	if ok, _ := rl.allowAll([]string{"fresh", "full"}, now); ok {
+		t.Fatalf("Request allowed with one empty bucket")
+	}
+	if ok, _ := rl.allow("fresh", now); !ok {
+		t.Errorf("Refused request took a token from the other bucket")
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	saved := *proxyHops
+	defer func() { *proxyHops = saved }()
+	cases := []struct {
+		hops   int
+		fwd    []string
+		expect string
+	}{
+		{0, nil, "10.0.0.1"},
+		{0, []string{"1.1.1.1"}, "10.0.0.1"},
+		{1, nil, "10.0.0.1"},
+		{1, []string{"1.1.1.1"}, "1.1.1.1"},
+		{1, []string{"6.6.6.6, 1.1.1.1"}, "1.1.1.1"},
+		{1, []string{"6.6.6.6", "1.1.1.1"}, "1.1.1.1"},
+		{2, []string{"6.6.6.6, 1.1.1.1, 2.2.2.2"}, "1.1.1.1"},
+		{2, []string{"1.1.1.1"}, "10.0.0.1"},
+	}
+	for i, c := range cases {
+		*proxyHops = c.hops
+		r := httptest.NewRequest("GET", "/api/state", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		for _, fwd := range c.fwd {
+			r.Header.Add("X-Forwarded-For", fwd)
+		}
+		if addr := clientAddress(r); addr != c.expect {
+			t.Errorf("Case %d: got address %q, expected %q", i, addr, c.expect)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+/*
+
+replay library
+
+Sessions publish their completed solves to the replay library,
+and anyone can browse, search, and play them back.
+
+	GET    /api/replays[?puzzle=p&q=text&rating=n&order=recent|best&count=n&offset=n]
+	                                   library replays matching the query
+	POST   /api/replays?title=t        publish the active puzzle's completed solve
+	GET    /api/replay?id=n            a replay and its playback
+	DELETE /api/replay?id=n            unpublish one of the session's replays
+
+*/
+
+// A replayPlayback is a replay as the API plays it back.
+type replayPlayback struct {
+	*storage.Replay
+	Playback *storage.Playback `json:"playback"`
+}
+
+// replayHandler serves the replay library API endpoints.
+func (s *session) replayHandler(endpoint string, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	invalid := func(arg string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+		slog.Debug("Invalid replay argument", "path", r.URL.Path, "argument", arg)
+	}
+	switch endpoint + " " + r.Method {
+	case "replays GET":
+		query := storage.ReplayQuery{Puzzle: q.Get("puzzle"), Text: q.Get("q"), Order: q.Get("order")}
+		for _, arg := range []struct {
+			name string
+			val  *int
+		}{{"rating", &query.MinRating}, {"count", &query.Count}, {"offset", &query.Offset}} {
+			if v := q.Get(arg.name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					invalid(v)
+					return
+				}
+				*arg.val = n
+			}
+		}
+		if query.Order != "" && query.Order != storage.RecentReplays && query.Order != storage.BestReplays {
+			invalid(query.Order)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, storage.Replays(query, s.sid))
+	case "replays POST":
+		rp, err := s.ss.PublishReplay(q.Get("title"))
+		if err != nil {
+			invalid(err.Error())
+			return
+		}
+		slog.Info("Published replay", s.attrs(), "replay", rp.Id, "title", rp.Title)
+		writeJSON(w, r, http.StatusCreated, rp)
+	case "replay GET", "replay DELETE":
+		id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+		if err != nil {
+			invalid(q.Get("id"))
+			return
+		}
+		if r.Method == "DELETE" {
+			if !s.ss.UnpublishReplay(id) {
+				invalid(q.Get("id"))
+				return
+			}
+			slog.Info("Unpublished replay", s.attrs(), "replay", id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		rp, pb := storage.FindReplay(id, s.sid)
+		if rp == nil {
+			invalid(q.Get("id"))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, replayPlayback{rp, pb})
+	default:
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+	}
+}
@@ -0,0 +1,75 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+/*
+
+HTTPS with ACME certificates
+
+For simple self-hosted deployments, the server can terminate
+HTTPS itself, using certificates obtained automatically from an
+ACME provider (such as Let's Encrypt) for an allowlist of
+domains.  Certificates are cached in the database by default, so
+all instances share them and they survive restarts; a cache
+directory can be given instead.
+
+The ACME client lives in golang.org/x/crypto/acme/autocert, which
+is vendored into Godeps and enabled by building with
+`-tags autocert` (as the Travis build does, to keep it working).
+Without the tag, asking for HTTPS is a startup error.
+
+*/
+
+// TLS flags
+var (
+	tlsDomains = flagString("tls-domains", "TLS_DOMAINS", "",
+		"comma-separated domains to serve over HTTPS with ACME certificates")
+	tlsCacheDir = flagString("tls-cache", "TLS_CACHE", "",
+		"directory for cached ACME certificates (default is the database)")
+	tlsChallengeAddr = flagString("tls-http-addr", "TLS_HTTP_ADDR", ":80",
+		"address for ACME challenges and HTTPS redirects")
+)
+
+// tlsDomainList returns the domains allowed to get certificates.
+// If it's empty, the server doesn't do HTTPS.
+func tlsDomainList() []string {
+	var domains []string
+	for _, d := range strings.Split(*tlsDomains, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// listen runs the server, over HTTPS if any TLS domains are
+// configured and over HTTP otherwise.  Like the http.Server
+// methods, it always returns a non-nil error.
+func listen(srv *http.Server) error {
+	domains := tlsDomainList()
+	if len(domains) == 0 {
+		return srv.ListenAndServe()
+	}
+	return listenAutocert(srv, domains, *tlsCacheDir, *tlsChallengeAddr)
+}
@@ -0,0 +1,390 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"github.com/ancientHacker/susen.go/storage"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+
+tournaments
+
+Sessions enter tournaments, then play each round's puzzle (by
+selecting it, like a puzzle of the day) while the round is on.
+The server checks for finished rounds every so often and
+notifies webhooks of their results; other instances may get to a
+round first, in which case there's nothing left to announce.
+Admins can announce on demand by running the "tournaments" pool
+refill.
+
+	GET  /api/tournaments              tournaments, newest first
+	GET  /api/tournament?name=t        a tournament and its rounds
+	POST /api/tournament?name=t        enter the session in a tournament
+	GET  /api/standings?name=t         a tournament's standings
+	GET  /api/bracket?name=t           a tournament's knockout bracket
+	GET  /api/results?name=t&round=n   the results of a round so far
+	GET  /api/roundstream?name=t&round=n
+	                                   stream the results of a round as it's played
+
+Standings, brackets and results take real work to compute, so
+they're computed without reference to any session, shared by
+every request for a while, and then marked with the requesting
+session's entries.  The round stream is a server-sent event
+stream: a "results" event with the results whenever they change,
+then a "finished" event when the round ends.
+
+*/
+
+// tournament flags
+var (
+	roundCheck = flagDuration("round-check", "ROUND_CHECK", time.Minute,
+		"how often to check for finished tournament rounds")
+	rankingTTL = flagDuration("ranking-ttl", "RANKING_TTL", 10*time.Second,
+		"how long computed tournament standings, brackets and results are reused")
+)
+
+// A tournamentListing is a tournament as the API shows it.
+type tournamentListing struct {
+	Name     string         `json:"name"`
+	Created  time.Time      `json:"created"`
+	Entrants int            `json:"entrants"`
+	Rounds   []roundListing `json:"rounds"`
+}
+
+// A roundListing is a tournament round as the API shows it.  The
+// puzzle is only shown once the round has started, and the link
+// selects it into the session.
+type roundListing struct {
+	Round      int       `json:"round"`
+	Starts     time.Time `json:"starts"`
+	Ends       time.Time `json:"ends"`
+	Name       string    `json:"name,omitempty"`
+	Geometry   string    `json:"geometry,omitempty"`
+	SideLength int       `json:"sidelen,omitempty"`
+	Values     []int     `json:"values,omitempty"`
+	Link       string    `json:"link,omitempty"`
+}
+
+// A roundFinished is the webhook payload for a finished round.
+type roundFinished struct {
+	Tournament string                `json:"tournament"`
+	Round      roundListing          `json:"round"`
+	Results    []storage.RoundResult `json:"results"`
+}
+
+// makeRoundListing converts a tournament round for the API.
+func makeRoundListing(r *storage.TournamentRound) roundListing {
+	l := roundListing{Round: r.Round, Starts: r.Starts, Ends: r.Ends}
+	if r.Info != nil {
+		l.Name, l.Geometry, l.SideLength = r.Info.Name, r.Info.Geometry, r.Info.SideLength
+		l.Values, l.Link = r.Values, "/select/"+r.Info.Name
+	}
+	return l
+}
+
+// tournamentListings converts tournaments for the API.
+func tournamentListings(ts []*storage.Tournament) []tournamentListing {
+	listings := make([]tournamentListing, len(ts))
+	for i, t := range ts {
+		listings[i] = tournamentListing{Name: t.Name, Created: t.Created, Entrants: t.Entrants}
+		for _, r := range t.Rounds {
+			listings[i].Rounds = append(listings[i].Rounds, makeRoundListing(r))
+		}
+	}
+	return listings
+}
+
+// startTournaments announces the rounds that have finished,
+// schedules regular checks for more, and registers the refill.
+func startTournaments() {
+	registerRefill("tournaments", func() (int, error) { return finishRounds(time.Now()) })
+	if _, err := finishRounds(time.Now()); err != nil {
+		slog.Warn("Failed to announce tournament rounds", "error", err)
+	}
+	done := make(chan struct{})
+	atShutdown(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(*roundCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if _, err := finishRounds(now); err != nil {
+					slog.Warn("Failed to announce tournament rounds", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// finishRounds announces the rounds that finished by the given
+// time, notifying webhooks, and returns how many it announced.
+func finishRounds(now time.Time) (count int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	for _, f := range storage.FinishRounds(now) {
+		results := f.Results
+		if len(results) > leaderboardSize {
+			results = results[:leaderboardSize]
+		}
+		slog.Info("Finished tournament round", "tournament", f.Tournament, "round", f.Round.Round,
+			"finishers", len(f.Results))
+		notifyWebhooks(roundFinishedEvent, roundFinished{f.Tournament, makeRoundListing(f.Round), results})
+		count++
+	}
+	return count, nil
+}
+
+/*
+
+rankings
+
+*/
+
+// A rankingCache holds recently computed standings, brackets and
+// round results, so that players polling them, and the round
+// streams, share the work of computing them.
+type rankingCache struct {
+	mutex   sync.Mutex
+	entries map[string]rankingEntry
+}
+
+// A rankingEntry is a cached ranking, with whether it was found.
+type rankingEntry struct {
+	computed time.Time
+	value    interface{}
+	ok       bool
+}
+
+// The server's rankings.
+var rankings = &rankingCache{entries: make(map[string]rankingEntry)}
+
+// get returns the ranking cached under the key, computing it if
+// it's missing or older than the ranking TTL.  Rankings are
+// computed one at a time, so a burst of requests for the same
+// one computes it once.
+func (rc *rankingCache) get(key string, now time.Time, compute func() (interface{}, bool)) (interface{}, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if e, ok := rc.entries[key]; ok && now.Sub(e.computed) < *rankingTTL {
+		return e.value, e.ok
+	}
+	for k, e := range rc.entries {
+		if now.Sub(e.computed) >= *rankingTTL {
+			delete(rc.entries, k)
+		}
+	}
+	value, ok := compute()
+	rc.entries[key] = rankingEntry{now, value, ok}
+	return value, ok
+}
+
+// standings returns the named tournament's standings, marked for
+// the given session.
+func (rc *rankingCache) standings(name, sid string, now time.Time) ([]storage.Standing, bool) {
+	v, ok := rc.get("standings:"+name, now, func() (interface{}, bool) {
+		return storage.TournamentStandings(name, "", now)
+	})
+	if !ok {
+		return nil, false
+	}
+	tag := storage.PlayerTag(sid)
+	standings := slices.Clone(v.([]storage.Standing))
+	for i := range standings {
+		standings[i].Self = standings[i].Player == tag
+	}
+	return standings, true
+}
+
+// bracket returns the named tournament's bracket, marked for the
+// given session.
+func (rc *rankingCache) bracket(name, sid string, now time.Time) ([]storage.BracketRound, bool) {
+	v, ok := rc.get("bracket:"+name, now, func() (interface{}, bool) {
+		return storage.TournamentBracket(name, "", now)
+	})
+	if !ok {
+		return nil, false
+	}
+	tag := storage.PlayerTag(sid)
+	bracket := slices.Clone(v.([]storage.BracketRound))
+	for i := range bracket {
+		bracket[i].Matches = slices.Clone(bracket[i].Matches)
+		for j, m := range bracket[i].Matches {
+			bracket[i].Matches[j].Self = m.Players[0] == tag || m.Players[1] == tag
+		}
+	}
+	return bracket, true
+}
+
+// results returns the results of a round of the named
+// tournament, marked for the given session.
+func (rc *rankingCache) results(name string, round int, sid string, now time.Time) ([]storage.RoundResult, bool) {
+	v, ok := rc.get(fmt.Sprintf("results:%s:%d", name, round), now, func() (interface{}, bool) {
+		return storage.RoundResults(name, round, "")
+	})
+	if !ok {
+		return nil, false
+	}
+	tag := storage.PlayerTag(sid)
+	results := slices.Clone(v.([]storage.RoundResult))
+	for i := range results {
+		results[i].Self = results[i].Player == tag
+	}
+	return results, true
+}
+
+/*
+
+tournament endpoints
+
+*/
+
+// tournamentHandler serves the tournament API endpoints.
+func (s *session) tournamentHandler(endpoint string, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("name")
+	invalid := func(arg string) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, arg), w, r)
+		slog.Debug("Invalid tournament argument", "path", r.URL.Path, "argument", arg)
+	}
+	if r.Method != "GET" && !(endpoint == "tournament" && r.Method == "POST") {
+		puzzle.SendError(puzzle.RequestError(puzzle.MethodNotAllowedCondition, r.URL.Path, r.Method), w, r)
+		return
+	}
+	if endpoint != "tournaments" && !storage.ValidTournamentName(name) {
+		invalid(name)
+		return
+	}
+	now := time.Now()
+	switch endpoint {
+	case "tournaments":
+		writeJSON(w, r, http.StatusOK, tournamentListings(storage.Tournaments(now)))
+	case "tournament":
+		if r.Method == "POST" && !s.ss.EnterTournament(name) {
+			invalid(name)
+			return
+		}
+		t := storage.FindTournament(name, now)
+		if t == nil {
+			invalid(name)
+			return
+		}
+		if r.Method == "POST" {
+			slog.Info("Entered tournament", s.attrs(), "tournament", name)
+		}
+		writeJSON(w, r, http.StatusOK, tournamentListings([]*storage.Tournament{t})[0])
+	case "standings":
+		standings, ok := rankings.standings(name, s.sid, now)
+		if !ok {
+			invalid(name)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, standings)
+	case "bracket":
+		bracket, ok := rankings.bracket(name, s.sid, now)
+		if !ok {
+			invalid(name)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, bracket)
+	case "results", "roundstream":
+		round, err := strconv.Atoi(q.Get("round"))
+		if err != nil {
+			invalid(q.Get("round"))
+			return
+		}
+		if endpoint == "roundstream" {
+			s.streamResults(w, r, name, round)
+			return
+		}
+		results, ok := rankings.results(name, round, s.sid, now)
+		if !ok {
+			invalid(q.Get("round"))
+			return
+		}
+		writeJSON(w, r, http.StatusOK, results)
+	}
+}
+
+// streamResults streams the results of a round as server-sent
+// events, checking for changes every ranking TTL.  The stream
+// ends when the round does, or when the client goes away or the
+// server starts shutting down.
+func (s *session) streamResults(w http.ResponseWriter, r *http.Request, name string, round int) {
+	t := storage.FindTournament(name, time.Now())
+	if t == nil || round < 1 || round > len(t.Rounds) {
+		puzzle.SendError(puzzle.RequestError(puzzle.InvalidArgumentCondition, r.URL.Path, strconv.Itoa(round)), w, r)
+		return
+	}
+	ends := t.Rounds[round-1].Ends
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, data []byte) bool {
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		return rc.Flush() == nil
+	}
+	ticker := time.NewTicker(*rankingTTL)
+	defer ticker.Stop()
+	var last []byte
+	for {
+		now := time.Now()
+		results, _ := rankings.results(name, round, s.sid, now)
+		data, err := json.Marshal(results)
+		if err != nil {
+			slog.Error("Failed to encode round results", "tournament", name, "round", round, "error", err)
+			return
+		}
+		if !bytes.Equal(data, last) {
+			if !send("results", data) {
+				return
+			}
+			last = data
+		}
+		if !now.Before(ends) {
+			send("finished", []byte("{}"))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if draining.Load() {
+				return
+			}
+		}
+	}
+}
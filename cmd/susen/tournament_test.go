@@ -0,0 +1,63 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"github.com/ancientHacker/susen.go/storage"
+	"testing"
+	"time"
+)
+
+func TestRankingCache(t *testing.T) {
+	rc := &rankingCache{entries: make(map[string]rankingEntry)}
+	now := time.Now()
+	calls := 0
+	compute := func() (interface{}, bool) {
+		calls++
+		return calls, true
+	}
+	rc.get("k", now, compute)
+	if v, _ := rc.get("k", now.Add(*rankingTTL/2), compute); v != 1 || calls != 1 {
+		t.Errorf("Fresh ranking was recomputed: %v after %d calls", v, calls)
+	}
+	if v, _ := rc.get("k", now.Add(*rankingTTL), compute); v != 2 || calls != 2 {
+		t.Errorf("Stale ranking wasn't recomputed: %v after %d calls", v, calls)
+	}
+
+	cached := []storage.Standing{{Rank: 1, Player: storage.PlayerTag("a")}, {Rank: 2, Player: storage.PlayerTag("b")}}
+	rc.entries["standings:t"] = rankingEntry{now, cached, true}
+	standings, ok := rc.standings("t", "b", now)
+	if !ok || standings[0].Self || !standings[1].Self {
+		t.Errorf("Marked standings are %+v (%v)", standings, ok)
+	}
+	if cached[1].Self {
+		t.Errorf("Marking changed the cached standings")
+	}
+	bracket := []storage.BracketRound{{Round: 1, Matches: []storage.Match{
+		{Players: [2]string{storage.PlayerTag("a"), storage.PlayerTag("b")}},
+	}}}
+	rc.entries["bracket:t"] = rankingEntry{now, bracket, true}
+	if marked, _ := rc.bracket("t", "b", now); !marked[0].Matches[0].Self || bracket[0].Matches[0].Self {
+		t.Errorf("Marked bracket is %+v, cached is %+v", marked, bracket)
+	}
+	rc.entries["results:t:2"] = rankingEntry{now, []storage.RoundResult(nil), false}
+	if _, ok := rc.results("t", 2, "a", now); ok {
+		t.Errorf("Missing round has results")
+	}
+}
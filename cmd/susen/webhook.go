@@ -0,0 +1,319 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+webhook configuration
+
+Webhooks let other services (chat bots, leaderboards) hear about
+puzzle events.  Each event is POSTed as JSON to every configured
+URL.  If a secret is configured, each delivery attempt carries
+its Unix time in the X-Susen-Timestamp header, and the timestamp,
+a period, and the body are signed with HMAC-SHA256, with the hex
+signature sent in the X-Susen-Signature header.  Receivers can
+check the payload came from us, and reject old timestamps so a
+captured delivery can't be replayed.
+
+Each URL has its own background worker, so request handlers
+never wait on deliveries, and a slow or failing receiver only
+holds up its own events.  Failed deliveries (network errors,
+429s and 5xx responses) are retried with exponential backoff.
+
+*/
+
+// webhook flags: no URLs means no webhooks.
+var (
+	webhookURLs = flagString("webhooks", "WEBHOOK_URLS", "",
+		"comma-separated URLs to notify of puzzle events")
+	webhookSecret = flagString("webhook-secret", "WEBHOOK_SECRET", "",
+		"key used to sign webhook payloads")
+	webhookAttempts = flagInt("webhook-attempts", "WEBHOOK_ATTEMPTS", 5,
+		"delivery attempts for each webhook event")
+)
+
+// A webhookEvent names the kind of event being delivered.
+type webhookEvent string
+
+const (
+	puzzleCompletedEvent webhookEvent = "puzzle.completed"
+	dailyPublishedEvent  webhookEvent = "daily.published"
+	roundFinishedEvent   webhookEvent = "tournament.round.finished"
+)
+
+// A webhookPayload is the JSON body of a webhook delivery.  The
+// ID is unique per event, so receivers can discard duplicates
+// caused by retries.
+type webhookPayload struct {
+	ID    string       `json:"id"`
+	Event webhookEvent `json:"event"`
+	Time  time.Time    `json:"time"`
+	Data  interface{}  `json:"data,omitempty"`
+}
+
+/*
+
+webhook delivery
+
+*/
+
+// A webhookDelivery is one payload bound for one URL.
+type webhookDelivery struct {
+	url   string
+	id    string
+	event webhookEvent
+	body  []byte
+}
+
+// A webhookDispatcher delivers events to a fixed set of URLs,
+// with a queue and worker for each.  Once closed, it drops any
+// further events.
+type webhookDispatcher struct {
+	urls     []string
+	secret   []byte
+	attempts int
+	backoff  time.Duration // wait before the first retry; doubles each retry
+	client   *http.Client
+	queues   []chan webhookDelivery // one per URL
+	mutex    sync.Mutex             // guards closed and sends on the queues
+	closed   bool
+	stop     chan struct{}
+	workers  sync.WaitGroup
+	serial   atomic.Int64
+}
+
+// webhookQueueSize bounds the deliveries waiting for each URL's
+// worker; events beyond that are dropped rather than blocking
+// handlers.
+const webhookQueueSize = 256
+
+// newWebhookDispatcher creates a dispatcher and starts its workers.
+func newWebhookDispatcher(urls []string, secret string, attempts int) *webhookDispatcher {
+	if attempts < 1 {
+		attempts = 1
+	}
+	wd := &webhookDispatcher{
+		urls:     urls,
+		secret:   []byte(secret),
+		attempts: attempts,
+		backoff:  time.Second,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queues:   make([]chan webhookDelivery, len(urls)),
+		stop:     make(chan struct{}),
+	}
+	for i := range wd.queues {
+		wd.queues[i] = make(chan webhookDelivery, webhookQueueSize)
+		wd.workers.Add(1)
+		go wd.run(wd.queues[i])
+	}
+	return wd
+}
+
+// notify queues an event for delivery to every URL.
+func (wd *webhookDispatcher) notify(event webhookEvent, data interface{}) {
+	if wd == nil || len(wd.urls) == 0 {
+		return
+	}
+	now := time.Now()
+	id := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatInt(wd.serial.Add(1), 36)
+	body, err := json.Marshal(webhookPayload{ID: id, Event: event, Time: now, Data: data})
+	if err != nil {
+		slog.Error("Failed to encode webhook payload", "event", event, "error", err)
+		return
+	}
+	wd.mutex.Lock()
+	defer wd.mutex.Unlock()
+	if wd.closed {
+		slog.Warn("Webhooks closed, dropping event", "event", event)
+		return
+	}
+	for i, url := range wd.urls {
+		select {
+		case wd.queues[i] <- webhookDelivery{url: url, id: id, event: event, body: body}:
+		default:
+			slog.Warn("Webhook queue full, dropping event", "event", event, "url", url)
+		}
+	}
+}
+
+// run is a worker loop: it delivers events from one URL's queue
+// until the queue is closed.
+func (wd *webhookDispatcher) run(queue chan webhookDelivery) {
+	defer wd.workers.Done()
+	for d := range queue {
+		wd.deliver(d)
+	}
+}
+
+// deliver sends one delivery, retrying with backoff.  Retries
+// are abandoned once the dispatcher is stopping.
+func (wd *webhookDispatcher) deliver(d webhookDelivery) {
+	wait := wd.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := wd.post(d)
+		if err == nil {
+			slog.Debug("Delivered webhook", "event", d.event, "url", d.url, "attempt", attempt)
+			return
+		}
+		if !retry || attempt >= wd.attempts {
+			slog.Warn("Webhook delivery failed", "event", d.event, "url", d.url,
+				"attempts", attempt, "error", err)
+			return
+		}
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-wd.stop:
+			slog.Warn("Abandoned webhook delivery at shutdown", "event", d.event, "url", d.url)
+			return
+		}
+	}
+}
+
+// post makes one delivery attempt.  It returns an error if the
+// attempt failed, and whether the failure is worth retrying.
+func (wd *webhookDispatcher) post(d webhookDelivery) (bool, error) {
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Susen-Event", string(d.event))
+	req.Header.Set("X-Susen-Delivery", d.id)
+	signRequest(req, wd.secret, d.body)
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, &webhookStatusError{resp.StatusCode}
+	default:
+		return false, &webhookStatusError{resp.StatusCode}
+	}
+}
+
+// close stops the dispatcher, giving queued deliveries up to the
+// given time to be sent.  Events after the close are dropped.
+func (wd *webhookDispatcher) close(timeout time.Duration) {
+	wd.mutex.Lock()
+	if wd.closed {
+		wd.mutex.Unlock()
+		return
+	}
+	wd.closed = true
+	for _, q := range wd.queues {
+		close(q)
+	}
+	wd.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wd.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		close(wd.stop)
+		<-done
+	}
+}
+
+// signRequest adds the timestamp and signature headers to a
+// delivery request, if there's a secret to sign with.
+func signRequest(req *http.Request, secret, body []byte) {
+	if len(secret) == 0 {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Susen-Timestamp", timestamp)
+	req.Header.Set("X-Susen-Signature", "sha256="+signPayload(secret, timestamp, body))
+}
+
+// signPayload returns the hex HMAC-SHA256 under key of the
+// timestamp, a period, and the body.
+func signPayload(key []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// A webhookStatusError reports an unsuccessful response status.
+type webhookStatusError struct {
+	status int
+}
+
+func (e *webhookStatusError) Error() string {
+	return "webhook response status " + strconv.Itoa(e.status)
+}
+
+/*
+
+server webhooks
+
+*/
+
+// The server's dispatcher, if any webhooks are configured.
+var (
+	webhooksOnce sync.Once
+	webhooks     *webhookDispatcher
+)
+
+// startWebhooks creates the server's dispatcher from the flags,
+// and arranges for it to be flushed at shutdown.
+func startWebhooks() {
+	webhooksOnce.Do(func() {
+		var urls []string
+		for _, u := range strings.Split(*webhookURLs, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			return
+		}
+		webhooks = newWebhookDispatcher(urls, *webhookSecret, *webhookAttempts)
+		atShutdown(func() { webhooks.close(5 * time.Second) })
+		slog.Info("Webhooks enabled", "count", len(urls), "signed", *webhookSecret != "")
+	})
+}
+
+// notifyWebhooks sends an event to the server's webhooks, if any.
+func notifyWebhooks(event webhookEvent, data interface{}) {
+	webhooks.notify(event, data)
+}
@@ -0,0 +1,142 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	var mutex sync.Mutex
+	var got []webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ts := r.Header.Get("X-Susen-Timestamp")
+		if sent, err := strconv.ParseInt(ts, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+			t.Errorf("Bad timestamp %q", ts)
+		}
+		if sig := r.Header.Get("X-Susen-Signature"); sig != "sha256="+signPayload([]byte("key"), ts, body) {
+			t.Errorf("Bad signature %q", sig)
+		}
+		if ev := r.Header.Get("X-Susen-Event"); ev != string(puzzleCompletedEvent) {
+			t.Errorf("Event header is %q", ev)
+		}
+		var p webhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("Couldn't decode payload: %v", err)
+		}
+		mutex.Lock()
+		got = append(got, p)
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+
+	wd := newWebhookDispatcher([]string{srv.URL}, "key", 1)
+	wd.notify(puzzleCompletedEvent, map[string]string{"puzzle": "sample-1"})
+	wd.close(time.Second)
+	if len(got) != 1 {
+		t.Fatalf("Got %d deliveries, expected 1", len(got))
+	}
+	if got[0].Event != puzzleCompletedEvent || got[0].ID == "" {
+		t.Errorf("Unexpected payload: %+v", got[0])
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var mutex sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	wd := newWebhookDispatcher([]string{srv.URL}, "", 5)
+	wd.backoff = time.Millisecond
+	wd.notify(puzzleCompletedEvent, nil)
+	wd.close(time.Second)
+	if calls != 3 {
+		t.Errorf("Got %d attempts, expected 3", calls)
+	}
+}
+
+func TestWebhookNoRetryOnClientError(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	wd := newWebhookDispatcher([]string{srv.URL}, "", 5)
+	wd.backoff = time.Millisecond
+	wd.notify(dailyPublishedEvent, nil)
+	wd.close(time.Second)
+	if calls != 1 {
+		t.Errorf("Got %d attempts, expected 1", calls)
+	}
+}
+
+func TestWebhookSlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	delivered := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer fast.Close()
+
+	wd := newWebhookDispatcher([]string{slow.URL, fast.URL}, "", 1)
+	wd.notify(puzzleCompletedEvent, nil)
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Errorf("Slow endpoint held up delivery to the fast one")
+	}
+	close(release)
+	wd.close(time.Second)
+}
+
+func TestWebhookNotifyAfterClose(t *testing.T) {
+	wd := newWebhookDispatcher([]string{"http://127.0.0.1:1/"}, "", 1)
+	wd.close(time.Second)
+	wd.notify(puzzleCompletedEvent, nil)
+	wd.close(time.Second)
+}
+
+func TestSignPayloadTimestamp(t *testing.T) {
+	body := []byte(`{"id":"x"}`)
+	if signPayload([]byte("key"), "1", body) == signPayload([]byte("key"), "2", body) {
+		t.Errorf("Signature doesn't depend on the timestamp")
+	}
+}
@@ -0,0 +1,6 @@
+-- TLS certificates (and account keys) obtained via ACME
+create table certificates(
+  certKey text primary key,	   -- cache key assigned by the ACME client
+  certData bytea not null,	   -- PEM-encoded certificate or key data
+  updated timestamp with time zone -- when the data was last saved
+  );
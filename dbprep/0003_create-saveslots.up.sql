@@ -0,0 +1,12 @@
+-- named snapshots of the choices made in a session's puzzles
+create table saveSlots(
+  sessionId text,
+  puzzleId text,
+  slotName text,		       -- the user's name for the snapshot
+  choicePairs int array,	       -- flattened array of choices made when saved
+  saved timestamp with time zone,      -- when the snapshot was saved
+  primary key (sessionId, puzzleId, slotName),
+  foreign key (sessionId, puzzleId) references sessionEntries on delete cascade on update cascade
+  );
+-- look up snapshots by session puzzle
+create index on saveSlots (sessionId, puzzleId);
@@ -0,0 +1,17 @@
+-- lessons that teach a solving technique
+create table lessons(
+  lessonName text primary key,	   -- lowercase name used in URLs
+  technique text not null,	   -- the technique being taught
+  title text not null,		   -- user-facing title
+  explanation text,		   -- how the technique works
+  created timestamp with time zone -- when the lesson was added
+  );
+
+-- the example puzzles of each lesson, in order
+create table lessonExamples(
+  lessonName text references lessons on delete cascade on update cascade,
+  position int,			   -- 1-based order within the lesson
+  puzzleId text references puzzles on delete cascade on update cascade,
+  goalPairs int array,		   -- flattened <index, value> pairs the student must find
+  primary key (lessonName, position)
+  );
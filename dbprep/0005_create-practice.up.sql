@@ -0,0 +1,11 @@
+-- practice puzzles served to a session, and how each went
+create table practiceAttempts(
+  sessionId text,
+  puzzleId text,
+  technique text not null,	       -- the technique the puzzle requires
+  keyPairs int array,		       -- flattened <index, value> key deductions
+  hinted boolean not null default false, -- whether a hint came before a key deduction
+  started timestamp with time zone,    -- when the puzzle was served
+  primary key (sessionId, puzzleId),
+  foreign key (sessionId, puzzleId) references sessionEntries on delete cascade on update cascade
+  );
@@ -0,0 +1,2 @@
+drop table scores;
+drop table moveJournal;
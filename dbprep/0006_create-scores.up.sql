@@ -0,0 +1,28 @@
+-- the moves made on each session puzzle, in order, for scoring
+create table moveJournal(
+  moveId bigserial primary key,
+  sessionId text not null,
+  puzzleId text not null,
+  kind text not null,		       -- assign, undo, reset, or hint
+  squareIndex int,		       -- the square assigned, if any
+  squareValue int,		       -- the value assigned, if any
+  mistake boolean not null default false, -- whether an assign made the puzzle unsolvable
+  made timestamp with time zone not null,
+  foreign key (sessionId, puzzleId) references sessionEntries on delete cascade on update cascade
+  );
+-- look up moves by session puzzle
+create index on moveJournal (sessionId, puzzleId);
+
+-- the best score each session has made on each completed puzzle
+create table scores(
+  sessionId text,
+  puzzleId text,
+  rating int not null,
+  base int not null,
+  timeBonus int not null,
+  deductions int not null,
+  total int not null,
+  completed timestamp with time zone,
+  primary key (sessionId, puzzleId),
+  foreign key (sessionId, puzzleId) references sessionEntries on delete cascade on update cascade
+  );
@@ -0,0 +1,13 @@
+-- every completion of a session puzzle, for statistics and achievements
+create table completions(
+  completionId bigserial primary key,
+  sessionId text not null references sessions on delete cascade on update cascade,
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  sideLength int not null,	       -- the puzzle's side length
+  rating int not null,		       -- the puzzle's difficulty rating
+  hints int not null,		       -- hints given while solving
+  daily boolean not null,	       -- whether it was the puzzle of the day
+  completed timestamp with time zone not null
+  );
+-- look up completions by session
+create index on completions (sessionId);
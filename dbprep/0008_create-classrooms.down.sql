@@ -0,0 +1,4 @@
+-- drop the dependent tables first
+drop table classStudents;
+drop table classes;
+drop table teachers;
@@ -0,0 +1,24 @@
+-- teachers, who sign in with a bearer token
+create table teachers(
+  teacherName text primary key,
+  tokenHash text not null unique,  -- hex SHA-256 of the teacher's token
+  created timestamp with time zone
+  );
+
+-- each teacher's classes
+create table classes(
+  className text primary key,	   -- lowercase name students join with
+  teacherName text not null references teachers on delete cascade on update cascade,
+  title text not null,		   -- user-facing title
+  created timestamp with time zone
+  );
+
+-- the sessions that have joined each class
+create table classStudents(
+  className text references classes on delete cascade on update cascade,
+  sessionId text references sessions on delete cascade on update cascade,
+  studentName text not null,	   -- the name the teacher sees
+  joined timestamp with time zone,
+  primary key (className, sessionId),
+  unique (className, studentName)
+  );
@@ -0,0 +1,3 @@
+-- drop the dependent table first
+drop table assignmentPuzzles;
+drop table assignments;
@@ -0,0 +1,19 @@
+-- sets of puzzles assigned to a class
+create table assignments(
+  className text references classes on delete cascade on update cascade,
+  assignmentName text,		   -- lowercase name within the class
+  title text not null,		   -- user-facing title
+  due timestamp with time zone not null,
+  created timestamp with time zone,
+  primary key (className, assignmentName)
+  );
+
+-- the puzzles of each assignment, in order
+create table assignmentPuzzles(
+  className text,
+  assignmentName text,
+  position int,			   -- 1-based order within the assignment
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  primary key (className, assignmentName, position),
+  foreign key (className, assignmentName) references assignments on delete cascade on update cascade
+  );
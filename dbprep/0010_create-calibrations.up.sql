@@ -0,0 +1,9 @@
+-- the rating bands applied by each recalibration, latest in effect
+create table calibrations(
+  calibrationId bigserial primary key,
+  boundFraction double precision not null,
+  wideChoice int not null,
+  fiveStarChoices int not null,
+  puzzles int not null,		       -- the puzzles observed when applied
+  applied timestamp with time zone not null
+  );
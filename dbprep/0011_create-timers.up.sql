@@ -0,0 +1,10 @@
+-- the server-side clock on each session puzzle, for timed solving
+create table timers(
+  sessionId text,
+  puzzleId text,
+  started timestamp with time zone not null, -- when the first move was made
+  resumed timestamp with time zone,	      -- when the clock last started running, null if paused
+  accumulated bigint not null default 0,      -- milliseconds run before it was last resumed
+  primary key (sessionId, puzzleId),
+  foreign key (sessionId, puzzleId) references sessionEntries on delete cascade on update cascade
+  );
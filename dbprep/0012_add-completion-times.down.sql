@@ -0,0 +1 @@
+alter table completions drop column elapsed;
@@ -0,0 +1,2 @@
+-- how long each completion took, for statistics
+alter table completions add column elapsed bigint; -- milliseconds, null for older completions
@@ -0,0 +1,10 @@
+-- the puzzles of the day, one per difficulty rating: queued
+-- puzzles have no publication time until their day comes
+create table dailies(
+  day date not null,
+  rating int not null,		       -- the difficulty it's featured at
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  puzzleName text not null,	       -- the library name it was featured under
+  published timestamp with time zone,  -- null while queued
+  primary key (day, rating)
+  );
@@ -0,0 +1,3 @@
+drop table tournamentEntrants;
+drop table tournamentRounds;
+drop table tournaments;
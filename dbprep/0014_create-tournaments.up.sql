@@ -0,0 +1,22 @@
+-- tournaments: rounds in which every entrant plays the same
+-- library puzzle over the same period
+create table tournaments(
+  tournamentName text primary key,
+  created timestamp with time zone not null
+  );
+create table tournamentRounds(
+  tournamentName text not null references tournaments on delete cascade on update cascade,
+  round int not null,		       -- numbered from 1
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  puzzleName text not null,	       -- the library name it was played under
+  starts timestamp with time zone not null,
+  ends timestamp with time zone not null,
+  resultsSent timestamp with time zone, -- null until the results are announced
+  primary key (tournamentName, round)
+  );
+create table tournamentEntrants(
+  tournamentName text not null references tournaments on delete cascade on update cascade,
+  sessionId text not null references sessions on delete cascade on update cascade,
+  entered timestamp with time zone not null,
+  primary key (tournamentName, sessionId)
+  );
@@ -0,0 +1,17 @@
+-- the replay library: completed solves published for others to
+-- study, with a snapshot of their move journals
+create table replays(
+  replayId bigserial primary key,
+  sessionId text not null references sessions on delete cascade on update cascade,
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  puzzleName text not null,	       -- the name it was solved under
+  title text not null,
+  rating int not null,		       -- the puzzle's difficulty rating
+  total int not null,		       -- the solve's score
+  elapsed bigint not null,	       -- milliseconds
+  moves json not null,		       -- the move journal, as published
+  published timestamp with time zone not null,
+  unique (sessionId, puzzleId)	       -- republishing replaces
+  );
+-- browse replays by puzzle
+create index on replays (puzzleId);
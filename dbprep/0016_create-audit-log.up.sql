@@ -0,0 +1,17 @@
+-- the audit log: administrative and security-relevant actions,
+-- appended as they happen and never changed afterwards
+create table auditLog(
+  auditId bigserial primary key,
+  occurred timestamp with time zone not null default now(),
+  actor text not null,		       -- who acted: admin, a teacher, a session
+  action text not null,		       -- what they did, e.g. library.add
+  target text not null,		       -- what they did it to, or ''
+  address text not null,	       -- the client address of the request
+  details json not null		       -- anything else worth keeping
+  );
+-- query the log by action and target
+create index on auditLog (action, occurred);
+create index on auditLog (target, occurred);
+-- the log is append-only
+create rule auditLogNoUpdate as on update to auditLog do instead nothing;
+create rule auditLogNoDelete as on delete to auditLog do instead nothing;
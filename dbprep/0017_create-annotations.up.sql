@@ -0,0 +1,17 @@
+-- annotations: notes on the squares and groups of session
+-- puzzles, made by their players or the players' teachers
+create table annotations(
+  annotationId bigserial primary key,
+  sessionId text not null references sessions on delete cascade on update cascade,
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  square int,			       -- the square annotated, or
+  gtype text,			       -- the type and index of the
+  gindex int,			       -- group annotated
+  author text not null,		       -- who the note is shown as from
+  teacherName text references teachers on delete cascade on update cascade,
+				       -- the teacher who made it, if one did
+  body text not null,
+  created timestamp with time zone not null
+  );
+-- load a session puzzle's annotations
+create index on annotations (sessionId, puzzleId);
@@ -0,0 +1,13 @@
+-- bookmarks: puzzles and positions a session saved for later
+create table bookmarks(
+  bookmarkId bigserial primary key,
+  sessionId text not null references sessions on delete cascade on update cascade,
+  puzzleId text not null references puzzles on delete cascade on update cascade,
+  puzzleName text not null,	       -- the name to open it under
+  label text not null,
+  choicePairs int array,	       -- the position's choices, or null
+				       -- for the puzzle from scratch
+  created timestamp with time zone not null
+  );
+-- list a session's bookmarks
+create index on bookmarks (sessionId);
@@ -0,0 +1,3 @@
+alter table tournamentRounds drop column startSent;
+alter table assignments drop column reminderSent;
+drop table subscriptions;
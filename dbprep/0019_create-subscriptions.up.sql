@@ -0,0 +1,17 @@
+-- subscriptions: how each session wants to hear about each
+-- topic it's subscribed to
+create table subscriptions(
+  sessionId text references sessions on delete cascade on update cascade,
+  topic text,			       -- daily, assignments, or tournaments
+  channel text,			       -- email, webhook, or push
+  address text not null,	       -- where on the channel to send
+  created timestamp with time zone not null,
+  primary key (sessionId, topic, channel)
+  );
+-- find a topic's subscribers
+create index on subscriptions (topic);
+
+-- reminders and alerts are sent once, by whichever server gets
+-- to them first
+alter table assignments add column reminderSent timestamp with time zone; -- null until sent
+alter table tournamentRounds add column startSent timestamp with time zone; -- null until sent
@@ -37,8 +37,10 @@ type dataFunction func(*pgx.Tx) error
 var (
 	upFunctions = []dataFunction{
 		insertSamples,
+		insertLessons,
 	}
 	downFunctions = []dataFunction{
+		deleteLessons,
 		deleteSamples,
 	}
 )
@@ -355,3 +357,78 @@ func deleteSamples(tx *pgx.Tx) error {
 	}
 	return nil
 }
+
+/*
+
+insert the built-in lessons
+
+*/
+
+// A sampleLesson is a built-in lesson.  Its examples are sample
+// puzzles, given by their index, and its goals are flattened
+// <index, value> pairs, one list per example.
+type sampleLesson struct {
+	name, technique, title, explanation string
+	examples                            []int
+	goals                               [][]int32
+}
+
+var sampleLessons = []sampleLesson{
+	{
+		name:      "naked-singles",
+		technique: "naked single",
+		title:     "Only one value left",
+		explanation: "Look at a square's row, column, and tile.  If together they " +
+			"already have every value but one, that one value goes in the square.",
+		examples: []int{0},
+		goals:    [][]int32{{51, 1}},
+	},
+	{
+		name:      "hidden-singles",
+		technique: "hidden single",
+		title:     "Only one place left",
+		explanation: "Pick a value a row, column, or tile still needs.  If all but one " +
+			"of its empty squares can't take the value, the value goes in that square.",
+		examples: []int{0},
+		goals:    [][]int32{{8, 9, 10, 8, 41, 8}},
+	},
+}
+
+// Create and insert the built-in lessons.  Lessons already in
+// the database are left alone, so this can be rerun.
+func insertLessons(tx *pgx.Tx) error {
+	now := time.Now()
+	for _, l := range sampleLessons {
+		tag, err := tx.Exec(
+			"INSERT INTO lessons (lessonName, technique, title, explanation, created) "+
+				"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (lessonName) DO NOTHING",
+			l.name, l.technique, l.title, l.explanation, now)
+		if err != nil {
+			return fmt.Errorf("Database error saving lesson %q: %v", l.name, err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+		for i, sample := range l.examples {
+			_, err := tx.Exec(
+				"INSERT INTO lessonExamples (lessonName, position, puzzleId, goalPairs) "+
+					"VALUES ($1, $2, $3, $4)",
+				l.name, i+1, sampleHashes[sample], l.goals[i])
+			if err != nil {
+				return fmt.Errorf("Database error saving lesson %q example %d: %v", l.name, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete the built-in lessons (and, by cascade, their examples).
+func deleteLessons(tx *pgx.Tx) error {
+	for _, l := range sampleLessons {
+		_, err := tx.Exec("DELETE from lessons where lessonName = $1", l.name)
+		if err != nil {
+			return fmt.Errorf("Database error deleting lesson %q: %v", l.name, err)
+		}
+	}
+	return nil
+}
@@ -36,3 +36,28 @@ func TestSampleData(t *testing.T) {
 		}
 	}
 }
+
+// make sure the built-in lessons are well-formed
+func TestSampleLessons(t *testing.T) {
+	for _, l := range sampleLessons {
+		if l.name != strings.ToLower(l.name) {
+			t.Errorf("Lesson %q contains a non-lowercase letter.", l.name)
+		}
+		if len(l.examples) == 0 || len(l.goals) != len(l.examples) {
+			t.Errorf("Lesson %q has %d examples and %d goal lists.", l.name, len(l.examples), len(l.goals))
+		}
+		for i, sample := range l.examples {
+			values := samplePuzzles[sample].Values
+			goals := l.goals[i]
+			if len(goals) == 0 || len(goals)%2 != 0 {
+				t.Errorf("Lesson %q example %d has goals %v.", l.name, i+1, goals)
+				continue
+			}
+			for j := 0; j < len(goals); j += 2 {
+				if values[goals[j]-1] != 0 {
+					t.Errorf("Lesson %q example %d goal square %d isn't empty.", l.name, i+1, goals[j])
+				}
+			}
+		}
+	}
+}
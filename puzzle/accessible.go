@@ -0,0 +1,203 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"strconv"
+	"strings"
+)
+
+/*
+
+Accessible descriptions
+
+Blind players can't scan a grid, so a description reads the
+puzzle out line by line, each line labeled with what it is: the
+rows, the selected square (with its value, or the candidates
+the assist level shows, or the player's marks), and each group
+the selected square is in, with the values that group is still
+missing.  Screen readers speak the lines as they are, and the
+grid can also be given in Unicode Braille cells, for refreshable
+Braille displays.
+
+*/
+
+// A Description is a labeled, linearized text rendering of a
+// puzzle.  Grid has a line for each row.  Square and Groups
+// describe the selected square and the groups it's in, if a
+// square is selected.  Problems are the puzzle's errors.
+// Braille, if asked for, has each row in Braille cells.
+type Description struct {
+	Grid     []string `json:"grid"`
+	Square   string   `json:"square,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+	Braille  []string `json:"braille,omitempty"`
+}
+
+// Text returns the description as lines of text.
+func (d *Description) Text() string {
+	var lines []string
+	lines = append(lines, d.Grid...)
+	if d.Square != "" {
+		lines = append(lines, "Selected: "+d.Square)
+	}
+	lines = append(lines, d.Groups...)
+	for _, problem := range d.Problems {
+		lines = append(lines, "Problem: "+problem)
+	}
+	lines = append(lines, d.Braille...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Describe returns a description of the puzzle, with the square
+// at the given index selected (or none, if the index is 0), and
+// with the grid in Braille if asked.  It's an Error if the index
+// is out of range.
+func (p *Puzzle) Describe(index int, braille bool) (*Description, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 0 || index > p.mapping.scount {
+		return nil, rangeError(IndexAttribute, index, 0, p.mapping.scount)
+	}
+	d := &Description{}
+	n := p.mapping.sidelen
+	for r := 1; r <= n; r++ {
+		var vals, cells []string
+		for c := 1; c <= n; c++ {
+			v := p.squares[(r-1)*n+c].aval
+			vals = append(vals, spokenValue(v))
+			cells = append(cells, brailleValue(v))
+		}
+		d.Grid = append(d.Grid, "Row "+strconv.Itoa(r)+": "+strings.Join(vals, ", ")+".")
+		if braille {
+			d.Braille = append(d.Braille, strings.Join(cells, "⠀"))
+		}
+	}
+	if index > 0 {
+		d.Square = p.describeSquare(index)
+		for _, gi := range p.mapping.ixmap[index] {
+			d.Groups = append(d.Groups, p.describeGroup(gi))
+		}
+	}
+	for _, e := range p.allErrors(true) {
+		d.Problems = append(d.Problems, e.Message)
+	}
+	return d, nil
+}
+
+// describeSquare says where a square is and what's in it.
+func (p *Puzzle) describeSquare(index int) string {
+	var where []string
+	for _, gi := range p.mapping.ixmap[index] {
+		where = append(where, p.mapping.gdescs[gi].id.String())
+	}
+	label := capitalize(strings.Join(where, ", ")) + ": "
+	s := p.indexToSquare(index)
+	switch {
+	case s.Aval != 0 && s.Entered:
+		return label + strconv.Itoa(s.Aval) + ", entered."
+	case s.Aval != 0:
+		return label + strconv.Itoa(s.Aval) + ", given."
+	case s.Bval != 0:
+		return label + "blank, must be " + strconv.Itoa(s.Bval) +
+			" because of " + s.Bsrc[0].String() + "."
+	case len(s.Pvals) == 1:
+		return label + "blank, only candidate " + strconv.Itoa(s.Pvals[0]) + "."
+	case len(s.Pvals) > 0:
+		return label + "blank, candidates " + spokenList(s.Pvals) + "."
+	case len(s.Marks) > 0:
+		return label + "blank, marked " + spokenList(s.Marks) + "."
+	}
+	return label + "blank."
+}
+
+// describeGroup reads out a group's values and the values it's
+// missing.
+func (p *Puzzle) describeGroup(gi int) string {
+	gd := p.mapping.gdescs[gi]
+	var vals []string
+	present := make(map[int]bool)
+	for _, idx := range gd.indices {
+		v := p.squares[idx].aval
+		vals = append(vals, spokenValue(v))
+		present[v] = true
+	}
+	var missing []int
+	for v := 1; v <= p.mapping.sidelen; v++ {
+		if !present[v] {
+			missing = append(missing, v)
+		}
+	}
+	line := capitalize(gd.id.String()) + ": " + strings.Join(vals, ", ")
+	if len(missing) == 0 {
+		return line + "; complete."
+	}
+	return line + "; missing " + spokenList(missing) + "."
+}
+
+// spokenValue reads out a square's value.
+func spokenValue(v int) string {
+	if v == 0 {
+		return "blank"
+	}
+	return strconv.Itoa(v)
+}
+
+// spokenList reads out a list of values.
+func spokenList(vals []int) string {
+	words := make([]string, len(vals))
+	for i, v := range vals {
+		words[i] = strconv.Itoa(v)
+	}
+	return strings.Join(words, ", ")
+}
+
+// capitalize starts a label with a capital letter.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// brailleDigits are the Braille cells for the digits 0-9, which
+// are the cells for the letters a-j after a number sign.
+var brailleDigits = [...]rune{'⠚', '⠁', '⠃', '⠉', '⠙', '⠑', '⠋', '⠛', '⠓', '⠊'}
+
+// Braille cells for the number sign and for a blank square (the
+// hyphen cell, since an empty cell reads as a space).
+const (
+	brailleNumberSign = '⠼'
+	brailleBlank      = '⠤'
+)
+
+// brailleValue writes a square's value in Braille cells: the
+// number sign and the value's digits, or a blank.
+func brailleValue(v int) string {
+	if v == 0 {
+		return string(brailleBlank)
+	}
+	cells := []rune{brailleNumberSign}
+	for _, digit := range strconv.Itoa(v) {
+		cells = append(cells, brailleDigits[digit-'0'])
+	}
+	return string(cells)
+}
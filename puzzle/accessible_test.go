@@ -0,0 +1,95 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: solveSimpleStartValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if _, e := p.Assign(Choice{2, 2}); e != nil {
+		t.Fatalf("Failed to assign: %v", e)
+	}
+
+	d, e := p.Describe(4, true)
+	if e != nil {
+		t.Fatalf("Failed to describe puzzle: %v", e)
+	}
+	expect := &Description{
+		Grid: []string{
+			"Row 1: 1, 2, 3, blank.",
+			"Row 2: blank, 3, blank, 1.",
+			"Row 3: 3, blank, 1, blank.",
+			"Row 4: blank, 1, blank, 3.",
+		},
+		Square: "Row 1, column 4, tile 2: blank, only candidate 4.",
+		Groups: []string{
+			"Row 1: 1, 2, 3, blank; missing 4.",
+			"Column 4: blank, 1, blank, 3; missing 2, 4.",
+			"Tile 2: 3, blank, blank, 1; missing 2, 4.",
+		},
+		Braille: []string{
+			"⠼⠁⠀⠼⠃⠀⠼⠉⠀⠤",
+			"⠤⠀⠼⠉⠀⠤⠀⠼⠁",
+			"⠼⠉⠀⠤⠀⠼⠁⠀⠤",
+			"⠤⠀⠼⠁⠀⠤⠀⠼⠉",
+		},
+	}
+	if !reflect.DeepEqual(d, expect) {
+		t.Errorf("Description is %+v, expected %+v", d, expect)
+	}
+	text := d.Text()
+	if !strings.Contains(text, "\nSelected: Row 1, column 4") || strings.Count(text, "\n") != 12 {
+		t.Errorf("Description text is:\n%s", text)
+	}
+
+	// given and entered squares, and no selection
+	if d, _ := p.Describe(1, false); d.Square != "Row 1, column 1, tile 1: 1, given." || d.Braille != nil {
+		t.Errorf("Given square description is %+v", d)
+	}
+	if d, _ := p.Describe(2, false); d.Square != "Row 1, column 2, tile 1: 2, entered." {
+		t.Errorf("Entered square is %q", d.Square)
+	}
+	if d, _ := p.Describe(0, false); d.Square != "" || d.Groups != nil || len(d.Grid) != 4 {
+		t.Errorf("Unselected description is %+v", d)
+	}
+	if _, e := p.Describe(17, false); e == nil {
+		t.Errorf("Described an out-of-range square")
+	}
+
+	// errors are problems
+	p.Assign(Choice{4, 1})
+	if d, _ := p.Describe(0, false); len(d.Problems) == 0 || d.Problems[0] == "" {
+		t.Errorf("Puzzle with errors has problems %v", d.Problems)
+	}
+}
+
+func TestBrailleValue(t *testing.T) {
+	for v, expect := range map[int]string{0: "⠤", 1: "⠼⠁", 9: "⠼⠊", 10: "⠼⠁⠚", 16: "⠼⠁⠋"} {
+		if cells := brailleValue(v); cells != expect {
+			t.Errorf("Value %d is %q in Braille, expected %q", v, cells, expect)
+		}
+	}
+}
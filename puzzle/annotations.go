@@ -0,0 +1,173 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+
+Annotations
+
+Annotations are free-text notes attached to a square or a group
+of a puzzle, so that someone helping a player (a teacher, say)
+can point at a place in the puzzle: "look at column 5 here."
+Like pencil marks, they play no part in the puzzle's logic.  They
+are kept in the puzzle's Summary, so they travel with it, but
+since they don't change what any square shows, adding or
+removing one doesn't notify the puzzle's observers.
+
+Each annotation has an id, unique within its puzzle.  Annotate
+assigns the next one, but hosts that keep annotations elsewhere
+can give their own ids to SetAnnotations.
+
+*/
+
+// MaxAnnotationLength is the longest annotation text, in
+// characters.
+const MaxAnnotationLength = 500
+
+// An Annotation is a note on a square or a group of a puzzle.
+// Exactly one of Square and Group is given.
+type Annotation struct {
+	Id      int       `json:"id"`
+	Square  int       `json:"square,omitempty"`
+	Group   *GroupID  `json:"group,omitempty"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+	Text    string    `json:"text"`
+}
+
+// checkAnnotation validates an annotation's place and text.
+func (p *Puzzle) checkAnnotation(a *Annotation) error {
+	if (a.Square == 0) == (a.Group == nil) {
+		return argumentError(AnnotationAttribute, InvalidArgumentCondition, "square or group")
+	}
+	if a.Square != 0 && (a.Square < 1 || a.Square > p.mapping.scount) {
+		return rangeError(IndexAttribute, a.Square, 1, p.mapping.scount)
+	}
+	if a.Group != nil && p.findGroup(*a.Group) == 0 {
+		return argumentError(AnnotationAttribute, InvalidArgumentCondition, a.Group.String())
+	}
+	if strings.TrimSpace(a.Text) == "" {
+		return argumentError(AnnotationAttribute, InvalidArgumentCondition, "text")
+	}
+	if n := utf8.RuneCountInString(a.Text); n > MaxAnnotationLength {
+		return rangeError(AnnotationAttribute, n, 1, MaxAnnotationLength)
+	}
+	return nil
+}
+
+// copyAnnotations returns a copy of some annotations (or nil).
+func copyAnnotations(notes []Annotation) []Annotation {
+	if len(notes) == 0 {
+		return nil
+	}
+	result := make([]Annotation, len(notes))
+	copy(result, notes)
+	for i := range result {
+		if g := result[i].Group; g != nil {
+			gid := *g
+			result[i].Group = &gid
+		}
+	}
+	return result
+}
+
+// Annotations returns the puzzle's annotations, in the order
+// they were made.
+func (p *Puzzle) Annotations() []Annotation {
+	if !p.isValid() {
+		return nil
+	}
+	return copyAnnotations(p.notes)
+}
+
+// Annotate adds an annotation to the puzzle, and returns it with
+// its id (and, if it didn't have one, its time) filled in.  It's
+// an Error if the annotation isn't on exactly one square or group
+// of the puzzle, or its text is empty or too long.
+func (p *Puzzle) Annotate(a Annotation) (Annotation, error) {
+	if !p.isValid() {
+		return a, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if err := p.checkAnnotation(&a); err != nil {
+		return a, err
+	}
+	a.Id = 1
+	for _, n := range p.notes {
+		if n.Id >= a.Id {
+			a.Id = n.Id + 1
+		}
+	}
+	if a.Created.IsZero() {
+		a.Created = time.Now().UTC()
+	}
+	p.notes = append(p.notes, copyAnnotations([]Annotation{a})...)
+	p.changes++
+	return a, nil
+}
+
+// RemoveAnnotation removes the annotation with an id.  It's an
+// Error if there isn't one.
+func (p *Puzzle) RemoveAnnotation(id int) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	for i, n := range p.notes {
+		if n.Id == id {
+			p.notes = append(p.notes[:i:i], p.notes[i+1:]...)
+			p.changes++
+			return nil
+		}
+	}
+	return argumentError(AnnotationAttribute, InvalidArgumentCondition, id)
+}
+
+// SetAnnotations replaces the puzzle's annotations, validating
+// them first.  Their ids must be positive and distinct.
+func (p *Puzzle) SetAnnotations(notes []Annotation) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if err := p.setAnnotations(notes); err != nil {
+		return err
+	}
+	p.changes++
+	return nil
+}
+
+// setAnnotations is SetAnnotations for puzzles being made.
+func (p *Puzzle) setAnnotations(notes []Annotation) error {
+	seen := make(map[int]bool, len(notes))
+	for i := range notes {
+		if err := p.checkAnnotation(&notes[i]); err != nil {
+			return err
+		}
+		if id := notes[i].Id; id < 1 || seen[id] {
+			return argumentError(AnnotationAttribute, InvalidArgumentCondition, id)
+		}
+		seen[notes[i].Id] = true
+	}
+	p.notes = copyAnnotations(notes)
+	return nil
+}
@@ -0,0 +1,121 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnnotate(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	updates := 0
+	p.OnChange(func(Content) { updates++ })
+
+	a, e := p.Annotate(Annotation{Square: 3, Author: "teacher", Text: "look here"})
+	if e != nil {
+		t.Fatalf("Annotating a square failed: %v", e)
+	}
+	if a.Id != 1 || a.Created.IsZero() {
+		t.Errorf("First annotation is %+v", a)
+	}
+	col := GroupID{GtypeCol, 2}
+	b, e := p.Annotate(Annotation{Group: &col, Author: "teacher", Text: "look at column 2"})
+	if e != nil || b.Id != 2 {
+		t.Fatalf("Annotating a group gave %+v, %v", b, e)
+	}
+	col.Index = 3 // the puzzle has its own copy
+	if notes := p.Annotations(); len(notes) != 2 || notes[1].Group.Index != 2 {
+		t.Errorf("Annotations are %+v", notes)
+	}
+	if updates != 0 {
+		t.Errorf("Annotating notified observers %d times", updates)
+	}
+
+	bad := []Annotation{
+		{Author: "x", Text: "nowhere"},
+		{Square: 3, Group: &GroupID{GtypeRow, 1}, Author: "x", Text: "two places"},
+		{Square: 17, Author: "x", Text: "off the puzzle"},
+		{Group: &GroupID{GtypeRow, 5}, Author: "x", Text: "no such row"},
+		{Square: 1, Author: "x", Text: "  "},
+		{Square: 1, Author: "x", Text: strings.Repeat("x", MaxAnnotationLength+1)},
+	}
+	for _, a := range bad {
+		if _, e := p.Annotate(a); e == nil {
+			t.Errorf("Annotation %+v was accepted", a)
+		} else if err := e.(Error); err.Scope != ArgumentScope {
+			t.Errorf("Annotation %+v gave %v", a, err)
+		}
+	}
+
+	if e := p.RemoveAnnotation(1); e != nil {
+		t.Errorf("Removing annotation 1 failed: %v", e)
+	}
+	if e := p.RemoveAnnotation(1); e == nil {
+		t.Errorf("Removing annotation 1 twice succeeded")
+	}
+	if c, _ := p.Annotate(Annotation{Square: 4, Author: "x", Text: "again"}); c.Id != 3 {
+		t.Errorf("Annotation after removal has id %d", c.Id)
+	}
+}
+
+func TestAnnotationSummary(t *testing.T) {
+	p, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	p.Annotate(Annotation{Square: 5, Author: "teacher", Created: created, Text: "why not 3?"})
+	p.Annotate(Annotation{Group: &GroupID{GtypeTile, 4}, Author: "player", Created: created, Text: "stuck"})
+
+	summary, _ := p.Summary()
+	bytes, e := json.Marshal(summary)
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode summary %s: %v", bytes, e)
+	}
+	q, e := New(&decoded)
+	if e != nil {
+		t.Fatalf("Failed to make puzzle from summary: %v", e)
+	}
+	notes := q.Annotations()
+	if len(notes) != 2 || notes[0].Text != "why not 3?" || !notes[0].Created.Equal(created) ||
+		notes[1].Group == nil || *notes[1].Group != (GroupID{GtypeTile, 4}) {
+		t.Errorf("Round trip gave annotations %+v", notes)
+	}
+	if c, _ := q.Copy(); len(c.Annotations()) != 2 {
+		t.Errorf("Copy has annotations %+v", c.Annotations())
+	}
+
+	if e := q.SetAnnotations([]Annotation{{Id: 7, Square: 1, Text: "a"}, {Id: 7, Square: 2, Text: "b"}}); e == nil {
+		t.Errorf("Set annotations with duplicate ids")
+	}
+	if e := q.SetAnnotations(nil); e != nil || len(q.Annotations()) != 0 {
+		t.Errorf("Clearing annotations gave %v, %+v", e, q.Annotations())
+	}
+	decoded.Annotations[0].Square = 99
+	if _, e := New(&decoded); e == nil {
+		t.Errorf("Made a puzzle with an off-puzzle annotation")
+	}
+}
@@ -0,0 +1,139 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Assist levels
+
+By default a puzzle's squares show the engine's help: the values
+each empty square can still take, and the values forced on
+squares by their groups.  Competitive modes want to hide some or
+all of that, so a puzzle has an assist level that controls what
+its Squares carry, wherever they are returned: in its State, in
+the Content returned by operations, and from the group queries.
+
+The level is kept in the puzzle's metadata under the reserved
+AssistMetadataKey, so it survives a round trip through a
+Summary (and, since the key is reserved, web clients can't
+change it when they post a new puzzle).  A puzzle whose level
+was never set has the default level (see Defaults), which is
+AssistFull unless the server says otherwise.  The analysis queries
+meant for the host program, such as Heatmap and Solutions, are
+not affected.
+
+*/
+
+// An AssistLevel says how much of the engine's analysis is
+// included in a puzzle's Squares.
+type AssistLevel int
+
+// The assist levels.  Pencil marks are the client's own, so they
+// are always included.
+const (
+	AssistFull       AssistLevel = iota // candidates and bindings
+	AssistCandidates                    // candidates but no bindings
+	AssistNone                          // neither candidates nor bindings
+	MaxAssist
+)
+
+// AssistMetadataKey is the metadata key that holds a puzzle's
+// assist level, if it isn't AssistFull.  Use SetAssist rather
+// than setting it directly.
+const AssistMetadataKey = ReservedMetadataPrefix + "assist"
+
+var assistNames = [...]string{
+	AssistFull:       "full",
+	AssistCandidates: "candidates",
+	AssistNone:       "none",
+}
+
+// AssistLevels implement Stringer
+func (al AssistLevel) String() string {
+	if al >= 0 && al < MaxAssist {
+		return assistNames[al]
+	}
+	return "unknown"
+}
+
+// ParseAssistLevel returns the assist level with the given name,
+// and whether there is one.
+func ParseAssistLevel(name string) (AssistLevel, bool) {
+	for al := AssistFull; al < MaxAssist; al++ {
+		if assistNames[al] == name {
+			return al, true
+		}
+	}
+	return AssistFull, false
+}
+
+// parseAssist returns the assist level given in a puzzle's
+// metadata.  A missing level means the default level.
+func parseAssist(md map[string]string) (AssistLevel, error) {
+	name, ok := md[AssistMetadataKey]
+	if !ok {
+		return CurrentDefaults().Assist, nil
+	}
+	if al, ok := ParseAssistLevel(name); ok {
+		return al, nil
+	}
+	err := argumentError(MetadataAttribute, InvalidArgumentCondition, AssistMetadataKey+"="+name)
+	err.Message = err.Error()
+	return AssistFull, err
+}
+
+// Assist returns the puzzle's assist level.  An invalid puzzle
+// has the default level, AssistFull.
+func (p *Puzzle) Assist() AssistLevel {
+	if !p.isValid() {
+		return AssistFull
+	}
+	return p.assist
+}
+
+// SetAssist sets the puzzle's assist level, and records it in the
+// puzzle's metadata, so it no longer follows the default.  (As a
+// special case, AssistFull isn't recorded when it's also the
+// default.)  Since this changes what the puzzle's squares show,
+// all of them are passed to the puzzle's observers.
+func (p *Puzzle) SetAssist(level AssistLevel) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if level < AssistFull || level >= MaxAssist {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "Assist level", int(level))
+	}
+	_, recorded := p.Metadata[AssistMetadataKey]
+	implicit := level == AssistFull && CurrentDefaults().Assist == AssistFull
+	if level == p.assist && recorded != implicit {
+		return nil
+	}
+	p.assist = level
+	if implicit {
+		delete(p.Metadata, AssistMetadataKey)
+	} else {
+		if p.Metadata == nil {
+			p.Metadata = make(map[string]string)
+		}
+		p.Metadata[AssistMetadataKey] = level.String()
+	}
+	p.changes++
+	p.update(newIntsetRange(p.mapping.scount))
+	return nil
+}
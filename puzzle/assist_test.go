@@ -0,0 +1,108 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssist(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	if p.Assist() != AssistFull {
+		t.Errorf("New puzzle has assist level %v", p.Assist())
+	}
+	var updates int
+	p.OnChange(func(Content) { updates++ })
+
+	testcases := []struct {
+		level                  AssistLevel
+		pvals, bvals, metadata bool
+	}{
+		{AssistCandidates, true, false, true},
+		{AssistNone, false, false, true},
+		{AssistFull, true, true, false},
+	}
+	for _, tc := range testcases {
+		if e := p.SetAssist(tc.level); e != nil {
+			t.Fatalf("SetAssist(%v) failed: %v", tc.level, e)
+		}
+		if _, ok := p.Metadata[AssistMetadataKey]; ok != tc.metadata {
+			t.Errorf("At level %v, metadata is %v", tc.level, p.Metadata)
+		}
+		state, _ := p.State()
+		var pvals, bvals bool
+		for i, S := range state.Squares {
+			expect := rotation4Puzzle1PartialAssign1CapitalSquares[i]
+			if S.Aval != expect.Aval || !reflect.DeepEqual(S.Marks, expect.Marks) {
+				t.Errorf("At level %v, square %d is %+v, expected %+v", tc.level, i+1, S, expect)
+			}
+			pvals = pvals || len(S.Pvals) > 0
+			bvals = bvals || S.Bval != 0 || len(S.Bsrc) > 0
+		}
+		if pvals != tc.pvals || bvals != tc.bvals {
+			t.Errorf("At level %v, state has pvals %v and bvals %v", tc.level, pvals, bvals)
+		}
+	}
+	if updates != len(testcases) {
+		t.Errorf("Observers were called %d times, expected %d", updates, len(testcases))
+	}
+	if e := p.SetAssist(AssistFull); e != nil || updates != len(testcases) {
+		t.Errorf("Setting the same level gave %v and %d updates", e, updates)
+	}
+	state, _ := p.State()
+	if !reflect.DeepEqual(state.Squares, rotation4Puzzle1PartialAssign1CapitalSquares) {
+		t.Errorf("At full assist, state is %+v", state.Squares)
+	}
+	if e := p.SetAssist(MaxAssist); e == nil {
+		t.Errorf("SetAssist(MaxAssist) succeeded")
+	}
+}
+
+func TestAssistSummary(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	p.SetAssist(AssistNone)
+	q, e := New(p.summary())
+	if e != nil {
+		t.Fatalf("Creation from summary failed: %v", e)
+	}
+	if q.Assist() != AssistNone {
+		t.Errorf("Summary round trip gave assist level %v", q.Assist())
+	}
+	if c := q.copy(); c.Assist() != AssistNone {
+		t.Errorf("Copy has assist level %v", c.Assist())
+	}
+
+	bad := p.summary()
+	bad.Metadata[AssistMetadataKey] = "some"
+	if _, e := New(bad); e == nil {
+		t.Errorf("Creation with a bad assist level succeeded")
+	} else if err := e.(Error); err.Attribute != MetadataAttribute {
+		t.Errorf("Creation with a bad assist level gave %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"fmt"
+	"iter"
+	"math/bits"
+)
+
+/*
+
+Bit sets
+
+Possible values never exceed the side length, which is at most
+26, so a set of them fits in a single machine word.  A bitset
+holds such a set as a bitmask, which makes the set operations
+that Assign does on every square it touches (removing a value,
+subtracting or intersecting a group's needs) constant-time and
+free of allocation.  Squares keep their possible values, and
+groups their needed values, as bitsets; squares and errors
+expose them as intsets, so bitsets convert to them.  Their
+methods mirror the intset methods of the same names.
+
+*/
+
+// A bitset is a set of integers from 0 to maxBitsetValue,
+// represented as a bitmask in which bit v is set when v is in the
+// set.
+type bitset uint64
+
+// maxBitsetValue is the largest integer a bitset can hold.
+const maxBitsetValue = 63
+
+// newBitsetRange: Make a bitset from a range of values, 1 to max.
+func newBitsetRange(max int) bitset {
+	if max < 1 {
+		return 0
+	}
+	if max > maxBitsetValue {
+		panic(fmt.Errorf("Bitset range (%d) is too large", max))
+	}
+	return bitset(1<<uint(max+1)-1) &^ 1
+}
+
+// newBitset: Make a bitset with the given values.  All of them
+// must be in range.
+func newBitset(vals ...int) bitset {
+	var bs bitset
+	for _, v := range vals {
+		if v < 0 || v > maxBitsetValue {
+			panic(fmt.Errorf("Value (%d) is out of bitset range", v))
+		}
+		bs |= 1 << uint(v)
+	}
+	return bs
+}
+
+// intset: Make an intset with the values in a bitset.  The result
+// is never nil, just like the result of newIntsetRange.
+func (bs bitset) intset() intset {
+	out := make(intset, 0, bits.OnesCount64(uint64(bs)))
+	for rest := uint64(bs); rest != 0; rest &= rest - 1 {
+		out = append(out, bits.TrailingZeros64(rest))
+	}
+	return out
+}
+
+// Len: the number of values in the bitset.
+func (bs bitset) len() int {
+	return bits.OnesCount64(uint64(bs))
+}
+
+// Min: the smallest value in the bitset, or -1 if it's empty.
+func (bs bitset) min() int {
+	if bs == 0 {
+		return -1
+	}
+	return bits.TrailingZeros64(uint64(bs))
+}
+
+// Max: the largest value in the bitset, or -1 if it's empty.
+func (bs bitset) max() int {
+	return bits.Len64(uint64(bs)) - 1
+}
+
+// Values iterates over the values in the bitset, smallest first.
+func (bs bitset) values() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for rest := uint64(bs); rest != 0; rest &= rest - 1 {
+			if !yield(bits.TrailingZeros64(rest)) {
+				return
+			}
+		}
+	}
+}
+
+// String formats a bitset like the intset with its values.
+func (bs bitset) String() string {
+	return fmt.Sprint(bs.intset())
+}
+
+// Find value v, returning whether it's in the bitset.
+func (bs *bitset) find(v int) bool {
+	if v < 0 || v > maxBitsetValue {
+		return false
+	}
+	return *bs&(1<<uint(v)) != 0
+}
+
+// Insert value v, returning whether it was there already.  The
+// value must be in range.
+func (bs *bitset) insert(v int) bool {
+	if v < 0 || v > maxBitsetValue {
+		panic(fmt.Errorf("Value (%d) is out of bitset range", v))
+	}
+	found := bs.find(v)
+	*bs |= 1 << uint(v)
+	return found
+}
+
+// Remove value v, returning whether it was there.
+func (bs *bitset) remove(v int) bool {
+	if !bs.find(v) {
+		return false
+	}
+	*bs &^= 1 << uint(v)
+	return true
+}
+
+// Contains returns whether every value of the passed bitset is
+// in this one.
+func (bs bitset) contains(xs bitset) bool {
+	return xs&^bs == 0
+}
+
+// Subtract the passed bitset, returning whether anything was
+// removed.  Also takes a marker value and returns whether it was
+// removed.
+func (bs *bitset) subtract(xs bitset, marker int) (bool, bool) {
+	removed := *bs & xs
+	*bs &^= xs
+	return removed != 0, removed.find(marker)
+}
+
+// Intersect the passed bitset, returning whether anything was
+// removed.  Also takes a marker value and returns whether it was
+// removed.
+func (bs *bitset) intersect(xs bitset, marker int) (bool, bool) {
+	removed := *bs &^ xs
+	*bs &= xs
+	return removed != 0, removed.find(marker)
+}
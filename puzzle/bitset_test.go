@@ -0,0 +1,142 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+/*
+
+Bit sets are checked against intsets, which are known good.
+
+*/
+
+// randomIntset returns a random intset with values from 1 to max.
+func randomIntset(r *rand.Rand, max int) intset {
+	var is intset
+	for v := 1; v <= max; v++ {
+		if r.Intn(2) == 0 {
+			is = append(is, v)
+		}
+	}
+	return is
+}
+
+func TestBitsetConversion(t *testing.T) {
+	for _, max := range []int{0, 1, 4, 9, 26, maxBitsetValue} {
+		if is := newBitsetRange(max).intset(); !reflect.DeepEqual(is, newIntsetRange(max)) {
+			t.Errorf("Range %d bitset has values %v", max, is)
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		is := randomIntset(r, 26)
+		bs := newBitset(is...)
+		if bs.len() != len(is) {
+			t.Errorf("Bitset of %v has length %d", is, bs.len())
+		}
+		if out := bs.intset(); !is.equals(out) {
+			t.Errorf("Bitset of %v converts back to %v", is, out)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("No panic making a bitset with an out-of-range value")
+		}
+	}()
+	newBitset(1, maxBitsetValue+1)
+}
+
+func TestBitsetOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		is := randomIntset(r, 16)
+		v := r.Intn(18)
+		bs := newBitset(is...)
+
+		_, found := is.find(v)
+		if bs.find(v) != found {
+			t.Errorf("Find %d in %v: got %v, expected %v", v, is, bs.find(v), found)
+		}
+
+		var vals intset
+		for v := range bs.values() {
+			vals = append(vals, v)
+		}
+		if !is.equals(vals) {
+			t.Errorf("Values of %v are %v", is, vals)
+		}
+		if len(is) > 0 && (bs.min() != is[0] || bs.max() != is[len(is)-1]) {
+			t.Errorf("Bounds of %v are %d and %d", is, bs.min(), bs.max())
+		}
+		if sub := newBitset(is[len(is)/2:]...); !bs.contains(sub) {
+			t.Errorf("Bitset of %v doesn't contain %v", is, sub.intset())
+		}
+		if v <= maxBitsetValue && bs.contains(newBitset(v)) != found {
+			t.Errorf("Contains %d in %v: got %v, expected %v", v, is, !found, found)
+		}
+
+		ic, bc := newIntsetCopy(is), bs
+		if got, want := bc.insert(v), ic.insert(v); got != want || !ic.equals(bc.intset()) {
+			t.Errorf("Insert %d in %v: got %v %v, expected %v %v", v, is, got, bc.intset(), want, ic)
+		}
+
+		ic, bc = newIntsetCopy(is), bs
+		if got, want := bc.remove(v), ic.remove(v); got != want || !ic.equals(bc.intset()) {
+			t.Errorf("Remove %d from %v: got %v %v, expected %v %v", v, is, got, bc.intset(), want, ic)
+		}
+	}
+	bs := newBitsetRange(4)
+	if bs.find(-1) || bs.find(maxBitsetValue+1) || bs.remove(-1) {
+		t.Errorf("Out-of-range values found in %v", bs.intset())
+	}
+}
+
+/*
+
+Benchmarks, to compare with the intset benchmarks of the same
+names.
+
+*/
+
+func BenchmarkBitsetRemove(b *testing.B) {
+	testcases := []struct {
+		starter  bitset
+		toremove int
+	}{
+		{newBitsetRange(9), 12},
+		{newBitsetRange(9), 1},
+		{newBitsetRange(9), 10},
+		{newBitset(6, 9), 6},
+		{newBitsetRange(16), 16},
+		{newBitsetRange(16), 1},
+		{newBitsetRange(16), 25},
+		{newBitset(3, 16), 16},
+	}
+
+	for i := 0; i < b.N; i++ {
+		for _, tc := range testcases {
+			input := tc.starter
+			input.remove(tc.toremove)
+		}
+	}
+}
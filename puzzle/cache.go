@@ -0,0 +1,185 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+Encoding cache
+
+Many spectators can be watching the same puzzle, and each of
+them asks for its State (or Summary) whenever it changes, so a
+puzzle keeps the JSON encodings it last sent (and their gzip
+compressions, for clients that accept them) and reuses them
+until it changes.  Every change made through the puzzle's
+methods makes a new version, but clients can also change the
+Metadata and Info fields directly, so a cached encoding is good
+exactly as long as its version is the puzzle's current one and
+its digest of the Metadata and Info matches theirs.  Readers
+holding a shared lock (as with SafePuzzle) may fill the cache
+concurrently, so the encodings are swapped in atomically.
+
+*/
+
+// An encoding is the JSON encoding of a puzzle value (or its
+// gzip compression) as of a version of the puzzle and of its
+// Metadata and Info.
+type encoding struct {
+	version int
+	extras  uint64
+	data    []byte
+}
+
+// An encodingCache holds a puzzle's latest encodings.
+type encodingCache struct {
+	summary     atomic.Pointer[encoding]
+	state       atomic.Pointer[encoding]
+	summaryGzip atomic.Pointer[encoding]
+	stateGzip   atomic.Pointer[encoding]
+	etag        atomic.Pointer[encoding]
+}
+
+// extrasDigest returns a digest of the puzzle's Metadata and
+// Info, which is all of the puzzle's content that can change
+// without making a new version.
+func (p *Puzzle) extrasDigest() uint64 {
+	h := fnv.New64a()
+	for _, k := range slices.Sorted(maps.Keys(p.Metadata)) {
+		fmt.Fprintf(h, "%q:%q,", k, p.Metadata[k])
+	}
+	info := &p.Info
+	fmt.Fprintf(h, "|%q %q %q %d %s %s %q", info.Name, info.Author, info.Source, info.Difficulty,
+		info.Created.Format(time.RFC3339Nano), info.Modified.Format(time.RFC3339Nano), info.Tags)
+	return h.Sum64()
+}
+
+// cached returns the encoding in the slot if it's current, and
+// otherwise encodes the value made by the given function and
+// caches that.  The returned bytes are shared, so they must not
+// be modified.
+func (p *Puzzle) cached(slot *atomic.Pointer[encoding], value func() jsonAppender) ([]byte, error) {
+	extras := p.extrasDigest()
+	if e := slot.Load(); e != nil && e.version == p.changes && e.extras == extras {
+		return e.data, nil
+	}
+	bp := jsonBuffers.Get().(*[]byte)
+	defer jsonBuffers.Put(bp)
+	buf, err := value().AppendJSON((*bp)[:0])
+	if err != nil {
+		return nil, err
+	}
+	if cap(buf) <= maxPooledJSONBuffer {
+		*bp = buf[:0]
+	}
+	bytes := append([]byte(nil), buf...) // the cache keeps only what it needs
+	slot.Store(&encoding{p.changes, extras, bytes})
+	return bytes, nil
+}
+
+// compressed returns the gzip compression in the slot if it's
+// current, and otherwise compresses the given encoding and caches
+// that.  Like cached, the returned bytes are shared.
+func (p *Puzzle) compressed(slot *atomic.Pointer[encoding], encoded func() ([]byte, error)) ([]byte, error) {
+	extras := p.extrasDigest()
+	if e := slot.Load(); e != nil && e.version == p.changes && e.extras == extras {
+		return e.data, nil
+	}
+	plain, err := encoded()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(plain); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	slot.Store(&encoding{p.changes, extras, buf.Bytes()})
+	return buf.Bytes(), nil
+}
+
+// summaryJSON returns the JSON encoding of the puzzle's summary.
+func (p *Puzzle) summaryJSON() ([]byte, error) {
+	return p.cached(&p.encodings.summary, func() jsonAppender { return p.summary() })
+}
+
+// stateJSON returns the JSON encoding of the puzzle's state.
+func (p *Puzzle) stateJSON() ([]byte, error) {
+	return p.cached(&p.encodings.state, func() jsonAppender { return p.state() })
+}
+
+// summaryGzip returns the gzip compression of the puzzle's
+// summary encoding.
+func (p *Puzzle) summaryGzip() ([]byte, error) {
+	return p.compressed(&p.encodings.summaryGzip, p.summaryJSON)
+}
+
+// stateGzip returns the gzip compression of the puzzle's state
+// encoding.
+func (p *Puzzle) stateGzip() ([]byte, error) {
+	return p.compressed(&p.encodings.stateGzip, p.stateJSON)
+}
+
+// etag returns the entity tag for the puzzle, a digest of its
+// encoded summary, state, and journal.  The tag is cached like
+// the encodings it's computed from.
+func (p *Puzzle) etag() string {
+	extras := p.extrasDigest()
+	if e := p.encodings.etag.Load(); e != nil && e.version == p.changes && e.extras == extras {
+		return string(e.data)
+	}
+	h := sha256.New()
+	summary, err1 := p.summaryJSON()
+	state, err2 := p.stateJSON()
+	h.Write(summary)
+	h.Write(state)
+	if j, _ := p.Journal(); j != nil {
+		json.NewEncoder(h).Encode(j)
+	}
+	tag := fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+	if err1 == nil && err2 == nil {
+		p.encodings.etag.Store(&encoding{p.changes, extras, []byte(tag)})
+	}
+	return tag
+}
+
+// cachedBytes returns the size of the puzzle's cached encodings.
+func (p *Puzzle) cachedBytes() (total int) {
+	c := &p.encodings
+	for _, slot := range []*atomic.Pointer[encoding]{&c.summary, &c.state, &c.summaryGzip, &c.stateGzip, &c.etag} {
+		if e := slot.Load(); e != nil {
+			total += cap(e.data)
+		}
+	}
+	return
+}
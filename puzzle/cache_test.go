@@ -0,0 +1,191 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// gunzip decompresses gzipped bytes, or returns nil if it can't.
+func gunzip(data []byte) []byte {
+	zr, e := gzip.NewReader(bytes.NewReader(data))
+	if e != nil {
+		return nil
+	}
+	plain, _ := io.ReadAll(zr)
+	return plain
+}
+
+func TestEncodingCache(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	check := func(when string) {
+		state, e := p.stateJSON()
+		if expected, _ := p.state().AppendJSON(nil); e != nil || string(state) != string(expected) {
+			t.Errorf("%s: state encoding %s, %v; expected %s", when, state, e, expected)
+		}
+		summary, e := p.summaryJSON()
+		if expected, _ := p.summary().AppendJSON(nil); e != nil || string(summary) != string(expected) {
+			t.Errorf("%s: summary encoding %s, %v; expected %s", when, summary, e, expected)
+		}
+		if again, _ := p.stateJSON(); &again[0] != &state[0] {
+			t.Errorf("%s: state wasn't cached", when)
+		}
+		if again, _ := p.summaryJSON(); &again[0] != &summary[0] {
+			t.Errorf("%s: summary wasn't cached", when)
+		}
+		zstate, e := p.stateGzip()
+		if e != nil || string(gunzip(zstate)) != string(state) {
+			t.Errorf("%s: gzipped state %s, %v; expected %s", when, gunzip(zstate), e, state)
+		}
+		zsummary, e := p.summaryGzip()
+		if e != nil || string(gunzip(zsummary)) != string(summary) {
+			t.Errorf("%s: gzipped summary %s, %v; expected %s", when, gunzip(zsummary), e, summary)
+		}
+		if again, _ := p.stateGzip(); &again[0] != &zstate[0] {
+			t.Errorf("%s: gzipped state wasn't cached", when)
+		}
+	}
+	check("new puzzle")
+
+	// every kind of change invalidates the cache
+	changes := []struct {
+		name string
+		op   func() error
+	}{
+		{"Assign", func() error { _, e := p.Assign(Choice{13, 2}); return e }},
+		{"AddMark", func() error { _, e := p.AddMark(2, 2); return e }},
+		{"Undo", func() error { _, e := p.Undo(); return e }},
+		{"Redo", func() error { _, e := p.Redo(); return e }},
+		{"Unassign", func() error { _, e := p.Unassign(13); return e }},
+		{"SetAssist", func() error { return p.SetAssist(AssistNone) }},
+		{"SetMetadata", func() error { return p.SetMetadata("name", "rotation") }},
+		{"SetInfo", func() error { return p.SetInfo(Info{Name: "rotation"}) }},
+		{"Metadata", func() error { p.Metadata["name"] = "rotated"; return nil }},
+		{"Info", func() error { p.Info.Tags = append(p.Info.Tags, "small"); return nil }},
+	}
+	for _, tc := range changes {
+		if e := tc.op(); e != nil {
+			t.Fatalf("%s failed: %v", tc.name, e)
+		}
+		check(tc.name)
+	}
+
+	// the handlers send the cached encodings
+	for i, handler := range []func(w *httptest.ResponseRecorder) error{
+		func(w *httptest.ResponseRecorder) error {
+			return p.StateHandler(w, httptest.NewRequest("GET", "/", nil))
+		},
+		func(w *httptest.ResponseRecorder) error {
+			return p.SummaryHandler(w, httptest.NewRequest("GET", "/", nil))
+		},
+	} {
+		w := httptest.NewRecorder()
+		if e := handler(w); e != nil {
+			t.Fatalf("Handler %d failed: %v", i, e)
+		}
+		expected, _ := p.stateJSON()
+		if i == 1 {
+			expected, _ = p.summaryJSON()
+		}
+		if w.Body.String() != string(expected) {
+			t.Errorf("Handler %d sent %s, expected %s", i, w.Body, expected)
+		}
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "deflate, gzip;q=0.5")
+	w := httptest.NewRecorder()
+	if e := p.StateHandler(w, r); e != nil {
+		t.Fatalf("Gzipped state handler failed: %v", e)
+	}
+	expected, _ := p.stateJSON()
+	if w.Header().Get("Content-Encoding") != "gzip" || string(gunzip(w.Body.Bytes())) != string(expected) {
+		t.Errorf("Gzipped state handler sent %v, %q", w.Header(), gunzip(w.Body.Bytes()))
+	}
+	r.Header.Set("Accept-Encoding", "gzip;q=0")
+	if acceptsGzip(r) {
+		t.Errorf("Request that refuses gzip accepts it")
+	}
+	if ms, _ := p.MemStats(); ms.Encodings == 0 {
+		t.Errorf("MemStats doesn't count the cached encodings: %+v", *ms)
+	}
+
+	// copies don't share the cache
+	c := p.copy()
+	c.Assign(Choice{15, 4})
+	cs, _ := c.stateJSON()
+	ps, _ := p.stateJSON()
+	if string(cs) == string(ps) {
+		t.Errorf("Copy's change showed in original's cached state")
+	}
+}
+
+func TestEncodingCacheConcurrent(t *testing.T) {
+	sp, e := NewSafe(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				p, unlock := sp.read()
+				p.stateJSON()
+				p.summaryJSON()
+				unlock()
+			}
+		}()
+	}
+	for j := 0; j < 5; j++ {
+		if _, e := sp.Assign(Choice{9, 7}); e == nil {
+			sp.Unassign(9)
+		}
+	}
+	wg.Wait()
+	p, unlock := sp.read()
+	defer unlock()
+	state, _ := p.stateJSON()
+	if expected, _ := p.state().AppendJSON(nil); string(state) != string(expected) {
+		t.Errorf("Cached state %s, expected %s", state, expected)
+	}
+}
+
+func BenchmarkStateHandler(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if e := p.StateHandler(httptest.NewRecorder(), r); e != nil {
+			b.Fatalf("StateHandler failed: %v", e)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Checking against a solution
+
+A player in "check my work" mode wants to know about a wrong
+value as soon as it's entered, not only once it causes a
+conflict.  When the client has the puzzle's solution, it can
+have the puzzle compare each assigned square against it.
+
+*/
+
+// A Verdict says how a square compares with the solution.
+type Verdict int
+
+// The possible verdicts.
+const (
+	EmptyVerdict   Verdict = iota // the square is not assigned
+	CorrectVerdict                // the square is assigned the solution value
+	WrongVerdict                  // the square is assigned some other value
+	MaxVerdict
+)
+
+var verdictNames = [...]string{
+	EmptyVerdict:   "empty",
+	CorrectVerdict: "correct",
+	WrongVerdict:   "wrong",
+}
+
+// Verdicts implement Stringer
+func (v Verdict) String() string {
+	if v >= 0 && v < MaxVerdict {
+		return verdictNames[v]
+	}
+	return verdictNames[EmptyVerdict]
+}
+
+// CheckAgainst compares each square's assigned value against
+// the given solution, which lists every square's value in index
+// order.  The returned verdicts are also in index order, so the
+// verdict for square i is at position i-1.  It's an Error if the
+// solution is the wrong size or has values out of range.
+func (p *Puzzle) CheckAgainst(solution []int) ([]Verdict, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if len(solution) != p.mapping.scount {
+		return nil, argumentError(PuzzleSizeAttribute, WrongPuzzleSizeCondition, len(solution), p.mapping.sidelen)
+	}
+	for _, v := range solution {
+		if v < 1 || v > p.mapping.sidelen {
+			return nil, rangeError(ValueAttribute, v, 1, p.mapping.sidelen)
+		}
+	}
+	verdicts := make([]Verdict, p.mapping.scount)
+	for i := 1; i <= p.mapping.scount; i++ {
+		switch aval := p.squares[i].aval; aval {
+		case 0:
+			verdicts[i-1] = EmptyVerdict
+		case solution[i-1]:
+			verdicts[i-1] = CorrectVerdict
+		default:
+			verdicts[i-1] = WrongVerdict
+		}
+	}
+	return verdicts, nil
+}
+
+// VerifySolution checks that the given values, which list every
+// square's value in index order, solve the puzzle: they agree
+// with every assigned square, and no group has any value twice.
+// It returns the indices of the squares that disagree with an
+// assigned value or repeat a value in one of their groups, in
+// order, so the solution is good if there are none.  It's an
+// Error if the solution is the wrong size or has values out of
+// range.
+func (p *Puzzle) VerifySolution(solution []int) ([]int, error) {
+	verdicts, e := p.CheckAgainst(solution)
+	if e != nil {
+		return nil, e
+	}
+	var bad intset
+	for i, v := range verdicts {
+		if v == WrongVerdict {
+			bad.insert(i + 1)
+		}
+	}
+	for _, gd := range p.mapping.gdescs[1:] {
+		seen := make(map[int]int, len(gd.indices))
+		for _, i := range gd.indices {
+			if j, ok := seen[solution[i-1]]; ok {
+				bad.insert(j)
+				bad.insert(i)
+			} else {
+				seen[solution[i-1]] = i
+			}
+		}
+	}
+	return bad, nil
+}
@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckAgainst(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	check := func(solution []int, idx int, expect Verdict) {
+		verdicts, e := p.CheckAgainst(solution)
+		if e != nil {
+			t.Fatalf("CheckAgainst(%v) failed: %v", solution, e)
+		}
+		if len(verdicts) != len(solution) {
+			t.Fatalf("CheckAgainst(%v) returned %d verdicts", solution, len(verdicts))
+		}
+		for i, v := range verdicts {
+			want := EmptyVerdict
+			if i+1 == idx {
+				want = expect
+			} else if rotation4Puzzle1PartialValues[i] != 0 {
+				want = CorrectVerdict
+			}
+			if v != want {
+				t.Errorf("Square %d verdict is %v, expected %v", i+1, v, want)
+			}
+		}
+	}
+	check(rotation4Puzzle1Complete1, 13, CorrectVerdict)
+	check(rotation4Puzzle1Complete2, 13, WrongVerdict)
+
+	if _, e := p.CheckAgainst(rotation4Puzzle1Complete1[1:]); e == nil {
+		t.Errorf("CheckAgainst a short solution succeeded")
+	} else if err, ok := e.(Error); !ok || err.Condition != WrongPuzzleSizeCondition {
+		t.Errorf("CheckAgainst a short solution gave wrong error: %v", e)
+	}
+	bad := append([]int(nil), rotation4Puzzle1Complete1...)
+	bad[5] = 5
+	if _, e := p.CheckAgainst(bad); e == nil {
+		t.Errorf("CheckAgainst an out-of-range solution succeeded")
+	} else if err, ok := e.(Error); !ok || err.Condition != TooLargeCondition {
+		t.Errorf("CheckAgainst an out-of-range solution gave wrong error: %v", e)
+	}
+}
+
+func TestVerifySolution(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	check := func(solution []int, expect []int) {
+		bad, e := p.VerifySolution(solution)
+		if e != nil {
+			t.Fatalf("VerifySolution(%v) failed: %v", solution, e)
+		}
+		if !reflect.DeepEqual(bad, expect) {
+			t.Errorf("VerifySolution(%v) = %v, expected %v", solution, bad, expect)
+		}
+	}
+	check(rotation4Puzzle1Complete1, nil)
+	check(rotation4Puzzle1Complete2, []int{13})
+	// square 1 disagrees with its given, and repeats the 2 in
+	// square 2 (row and tile) and square 13 (column)
+	bad := append([]int(nil), rotation4Puzzle1Complete1...)
+	bad[0] = 2
+	check(bad, []int{1, 2, 13})
+
+	if _, e := p.VerifySolution(rotation4Puzzle1Complete1[1:]); e == nil {
+		t.Errorf("VerifySolution of a short solution succeeded")
+	} else if err, ok := e.(Error); !ok || err.Condition != WrongPuzzleSizeCondition {
+		t.Errorf("VerifySolution of a short solution gave wrong error: %v", e)
+	}
+}
+
+func TestVerdictString(t *testing.T) {
+	for v, name := range verdictNames {
+		if Verdict(v).String() != name {
+			t.Errorf("Verdict %d has name %q, expected %q", v, Verdict(v).String(), name)
+		}
+	}
+	if MaxVerdict.String() != "empty" {
+		t.Errorf("MaxVerdict has name %q, expected %q", MaxVerdict.String(), "empty")
+	}
+}
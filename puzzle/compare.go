@@ -0,0 +1,293 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"fmt"
+	"slices"
+)
+
+/*
+
+Comparing puzzles
+
+*/
+
+// sameGeometry returns an Error unless two valid puzzles have
+// the same geometry, side length, and constraints.
+func sameGeometry(a, b *Puzzle) error {
+	if !a.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, a)
+	}
+	if !b.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, b)
+	}
+	if !sameMapping(a.mapping, b.mapping) {
+		ga := fmt.Sprintf("%s %d%s", a.mapping.geometry, a.mapping.sidelen, a.mapping.stackKey())
+		gb := fmt.Sprintf("%s %d%s", b.mapping.geometry, b.mapping.sidelen, b.mapping.stackKey())
+		err := argumentError(GeometryAttribute, MismatchedGeometryCondition, gb, ga)
+		err.Message = err.Error()
+		return err
+	}
+	return nil
+}
+
+// sameMapping returns whether two mappings lay out the same
+// puzzle.  Mappings with killer cages aren't shared, so two
+// puzzles can have distinct mappings with the same geometry, side
+// length, and constraints.
+func sameMapping(m, n *puzzleMapping) bool {
+	if m == n {
+		return true
+	}
+	return m.geometry == n.geometry && m.sidelen == n.sidelen && m.stackKey() == n.stackKey()
+}
+
+// sameSquare returns whether two squares have the same
+// assigned, bound, and possible values (and binding groups).
+func sameSquare(s, t *square) bool {
+	if s.aval != t.aval || s.bval != t.bval {
+		return false
+	}
+	return s.pvals == t.pvals && slices.Equal(s.bsrc, t.bsrc)
+}
+
+// Diff compares two puzzles with the same geometry, returning
+// the squares of the second puzzle whose assigned, bound, or
+// possible values differ from those in the first, along with the
+// errors of the second puzzle.  So a client with the first
+// puzzle's State can apply the result as an update to get the
+// second puzzle's State.  It's an Error if the puzzles don't have
+// the same geometry.
+func Diff(a, b *Puzzle) (*Content, error) {
+	if err := sameGeometry(a, b); err != nil {
+		return nil, err
+	}
+	var is intset
+	for i := 1; i <= b.mapping.scount; i++ {
+		if !sameSquare(a.squares[i], b.squares[i]) {
+			is = append(is, i)
+		}
+	}
+	return &Content{b.indicesToSquares(is), b.allErrors(true)}, nil
+}
+
+// Equal returns whether two puzzles have the same geometry and
+// the same assigned values.  It's an Error if either puzzle is
+// invalid.
+func Equal(a, b *Puzzle) (bool, error) {
+	if err := sameGeometry(a, b); err != nil {
+		if err.(Error).Condition == MismatchedGeometryCondition {
+			return false, nil
+		}
+		return false, err
+	}
+	for i := 1; i <= a.mapping.scount; i++ {
+		if a.squares[i].aval != b.squares[i].aval {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Equivalent returns whether two puzzles have the same geometry
+// and the assigned values of one can be turned into those of the
+// other by a symmetry of the geometry: relabeling the values,
+// reordering the rows within a band of tiles or the bands
+// themselves, doing the same for columns, and (if the tiles are
+// square) transposing rows and columns.  Those aren't symmetries
+// of puzzles with constraints, so constrained puzzles are only
+// equivalent if their values are relabelings of each other (or,
+// with killer cages, which fix the values, if they're equal).
+// It's an Error if either puzzle is invalid or the side length
+// is more than 9, because larger puzzles have too many
+// symmetries to compare.
+func Equivalent(a, b *Puzzle) (bool, error) {
+	if err := sameGeometry(a, b); err != nil {
+		if err.(Error).Condition == MismatchedGeometryCondition {
+			return false, nil
+		}
+		return false, err
+	}
+	if a.mapping.sidelen > maxCanonicalSideLength {
+		return false, rangeError(SideLengthAttribute, a.mapping.sidelen, 1, maxCanonicalSideLength)
+	}
+	// equivalent puzzles have the same number of assigned squares
+	count := 0
+	for i := 1; i <= a.mapping.scount; i++ {
+		if a.squares[i].aval != 0 {
+			count++
+		}
+		if b.squares[i].aval != 0 {
+			count--
+		}
+	}
+	if count != 0 {
+		return false, nil
+	}
+	return slices.Equal(a.canonicalValues(), b.canonicalValues()), nil
+}
+
+/*
+
+Canonical forms
+
+Two puzzles are equivalent if they have the same canonical form,
+which is the least (in lexical order) of the value arrays that
+can be made from a puzzle by the symmetries of its geometry.
+Value relabeling is handled by numbering the values in the order
+they first appear, which is the least labeling for any
+arrangement of the squares, so only the arrangements need to be
+searched.  The search abandons each arrangement as soon as it
+can't beat the best found so far, but it's still exhaustive, so
+it's limited to puzzles with small side lengths.
+
+*/
+
+// maxCanonicalSideLength is the largest side length for which
+// canonical forms are computed.
+const maxCanonicalSideLength = 9
+
+// arrangements returns all the orderings of count blocks of size
+// consecutive indices, where the blocks can be reordered and so
+// can the indices within each block.
+func arrangements(count, size int) [][]int {
+	var result [][]int
+	iorders := permutations(size)
+	for _, border := range permutations(count) {
+		// extend the arrangements block by block, in order
+		partial := [][]int{{}}
+		for _, b := range border {
+			var next [][]int
+			for _, arr := range partial {
+				for _, iorder := range iorders {
+					ext := make([]int, len(arr), len(arr)+size)
+					copy(ext, arr)
+					for _, i := range iorder {
+						ext = append(ext, b*size+i)
+					}
+					next = append(next, ext)
+				}
+			}
+			partial = next
+		}
+		result = append(result, partial...)
+	}
+	return result
+}
+
+// permutations returns all the orderings of 0 through n-1.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var result [][]int
+	for _, perm := range permutations(n - 1) {
+		for pos := 0; pos <= len(perm); pos++ {
+			next := make([]int, 0, n)
+			next = append(next, perm[:pos]...)
+			next = append(next, n-1)
+			next = append(next, perm[pos:]...)
+			result = append(result, next)
+		}
+	}
+	return result
+}
+
+// canonicalValues returns the canonical form of the puzzle's
+// assigned values.  The only symmetry of a constrained puzzle is
+// relabeling, and not even that if it has killer cages.
+func (p *Puzzle) canonicalValues() []int {
+	n, m := p.mapping.sidelen, p.mapping
+	grids := [][]int{p.allValues()}
+	if m.stack != nil {
+		for _, c := range m.stack.constraints {
+			if len(c.Cages) > 0 {
+				return grids[0]
+			}
+		}
+		identity := make([]int, n)
+		for i := range identity {
+			identity[i] = i
+		}
+		best := make([]int, m.scount)
+		fillCandidate(best, grids[0], identity, identity, make([]int, n+1), nil)
+		return best
+	}
+	if m.tileX == m.tileY {
+		transposed := make([]int, m.scount)
+		for r := 0; r < n; r++ {
+			for c := 0; c < n; c++ {
+				transposed[c*n+r] = grids[0][r*n+c]
+			}
+		}
+		grids = append(grids, transposed)
+	}
+	rowArrs := arrangements(n/m.tileY, m.tileY)
+	colArrs := arrangements(n/m.tileX, m.tileX)
+	var best []int
+	candidate := make([]int, m.scount)
+	labels := make([]int, n+1)
+	for _, grid := range grids {
+		for _, rows := range rowArrs {
+			for _, cols := range colArrs {
+				if best == nil {
+					best = make([]int, m.scount)
+					fillCandidate(best, grid, rows, cols, labels, nil)
+					continue
+				}
+				if fillCandidate(candidate, grid, rows, cols, labels, best) {
+					best, candidate = candidate, best
+				}
+			}
+		}
+	}
+	return best
+}
+
+// fillCandidate fills in the relabeled values of a grid for an
+// arrangement of its rows and columns, comparing them against
+// the best values so far (if any).  It returns whether the
+// candidate is less than the best, giving up as soon as it's
+// clear it isn't.
+func fillCandidate(candidate, grid, rows, cols, labels, best []int) bool {
+	n := len(rows)
+	for i := range labels {
+		labels[i] = 0
+	}
+	next, less := 1, best == nil
+	for k := range candidate {
+		v := grid[rows[k/n]*n+cols[k%n]]
+		if v != 0 {
+			if labels[v] == 0 {
+				labels[v] = next
+				next++
+			}
+			v = labels[v]
+		}
+		if !less {
+			if v > best[k] {
+				return false
+			}
+			less = v < best[k]
+		}
+		candidate[k] = v
+	}
+	return less
+}
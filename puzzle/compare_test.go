@@ -0,0 +1,217 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	b := a.copy()
+	update, e := Diff(a, b)
+	if e != nil {
+		t.Fatalf("Diff of copies failed: %v", e)
+	}
+	if len(update.Squares) != 0 {
+		t.Errorf("Diff of copies returned squares %v", update.Squares)
+	}
+
+	// the diff matches the update from the assignment
+	assigned, e := b.Assign(Choice{13, 2})
+	if e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	update, e = Diff(a, b)
+	if e != nil {
+		t.Fatalf("Diff after assignment failed: %v", e)
+	}
+	if !reflect.DeepEqual(update, assigned) {
+		t.Errorf("Diff after assignment returned %+v, expected %+v", update, assigned)
+	}
+	// applying the diff to the first puzzle's state gives the second's
+	state, _ := a.State()
+	for _, S := range update.Squares {
+		state.Squares[S.Index-1] = S
+	}
+	if expected, _ := b.State(); !reflect.DeepEqual(state, expected) {
+		t.Errorf("Applying diff gave %+v, expected %+v", state, expected)
+	}
+
+	// error cases
+	c, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	_, e = Diff(a, c)
+	if e == nil || e.(Error).Condition != MismatchedGeometryCondition {
+		t.Errorf("Diff of mismatched puzzles produced incorrect error: %v", e)
+	}
+	_, e = Diff(nil, a)
+	if e == nil || e.(Error).Condition != InvalidArgumentCondition {
+		t.Errorf("Diff with nil puzzle produced incorrect error: %v", e)
+	}
+}
+
+func TestEqualEquivalent(t *testing.T) {
+	a, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	// b swaps the first two bands, transposes, and swaps values 1 and 2
+	values := make([]int, 81)
+	for r := 0; r < 9; r++ {
+		src := r
+		if r < 3 {
+			src = r + 3
+		} else if r < 6 {
+			src = r - 3
+		}
+		for c := 0; c < 9; c++ {
+			v := threeStarValues[src*9+c]
+			if v == 1 || v == 2 {
+				v = 3 - v
+			}
+			values[c*9+r] = v
+		}
+	}
+	b, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: values})
+	if e != nil {
+		t.Fatalf("Creation of transformed puzzle failed: %v", e)
+	}
+	if eq, e := Equal(a, a.copy()); !eq || e != nil {
+		t.Errorf("Puzzle isn't equal to its copy (%v)", e)
+	}
+	if eq, e := Equal(a, b); eq || e != nil {
+		t.Errorf("Puzzle is equal to its transform (%v)", e)
+	}
+	if eq, e := Equivalent(a, b); !eq || e != nil {
+		t.Errorf("Puzzle isn't equivalent to its transform (%v)", e)
+	}
+	c := a.copy()
+	empty := 1
+	for threeStarValues[empty-1] != 0 {
+		empty++
+	}
+	if _, e := c.Assign(Choice{empty, c.squares[empty].pvals.min()}); e != nil {
+		t.Fatalf("Assign to square %d failed: %v", empty, e)
+	}
+	if eq, e := Equal(a, c); eq || e != nil {
+		t.Errorf("Puzzle is equal to one with an extra value (%v)", e)
+	}
+	if eq, e := Equivalent(a, c); eq || e != nil {
+		t.Errorf("Puzzle is equivalent to one with an extra value (%v)", e)
+	}
+
+	// rectangular puzzles can't be transposed, but can be relabeled
+	r1, e := New(&Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: []int{
+		1, 2, 3, 0, 0, 0,
+		0, 0, 0, 1, 2, 3,
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+	}})
+	if e != nil {
+		t.Fatalf("Creation of rectangular puzzle failed: %v", e)
+	}
+	r2, e := New(&Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: []int{
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+		4, 5, 6, 0, 0, 0,
+		0, 0, 0, 6, 5, 4,
+	}})
+	if e != nil {
+		t.Fatalf("Creation of rectangular puzzle failed: %v", e)
+	}
+	if eq, e := Equivalent(r1, r2); !eq || e != nil {
+		t.Errorf("Rectangular puzzle isn't equivalent to its transform (%v)", e)
+	}
+
+	// puzzles of different geometries are neither equal nor equivalent
+	if eq, e := Equal(a, r1); eq || e != nil {
+		t.Errorf("Puzzles of different geometries are equal (%v)", e)
+	}
+	if eq, e := Equivalent(a, r1); eq || e != nil {
+		t.Errorf("Puzzles of different geometries are equivalent (%v)", e)
+	}
+
+	// error cases
+	if _, e := Equal(nil, a); e == nil || e.(Error).Condition != InvalidArgumentCondition {
+		t.Errorf("Equal with nil puzzle produced incorrect error: %v", e)
+	}
+	big, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16})
+	if e != nil {
+		t.Fatalf("Creation of 16x16 puzzle failed: %v", e)
+	}
+	if _, e := Equivalent(big, big.copy()); e == nil || e.(Error).Condition != TooLargeCondition {
+		t.Errorf("Equivalent of large puzzles produced incorrect error: %v", e)
+	}
+}
+
+func TestCompareConstrained(t *testing.T) {
+	killer := []Constraint{{Kind: KillerConstraint, Cages: []Cage{{5, []int{2, 6}}}}}
+	k1, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: killer})
+	if e != nil {
+		t.Fatalf("Creation of killer puzzle failed: %v", e)
+	}
+	k2, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: killer})
+	if e != nil {
+		t.Fatalf("Creation of killer puzzle failed: %v", e)
+	}
+	if eq, e := Equal(k1, k2); !eq || e != nil {
+		t.Errorf("Killer puzzles with the same cages aren't equal (%v)", e)
+	}
+	if _, e := k2.Assign(Choice{6, 3}); e != nil {
+		t.Fatalf("Assign(Choice{6, 3}) failed: %v", e)
+	}
+	if diff, e := Diff(k1, k2); e != nil || len(diff.Squares) == 0 {
+		t.Errorf("Diff of killer puzzles gave %v, %v", diff, e)
+	}
+	plain, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4})
+	if eq, e := Equal(k1, plain); eq || e != nil {
+		t.Errorf("Killer puzzle is equal to a plain one (%v)", e)
+	}
+
+	// row swaps aren't symmetries of a diagonal puzzle
+	diagonal := []Constraint{{Kind: DiagonalConstraint}}
+	corner := make([]int, 16)
+	corner[0] = 1
+	offDiagonal := make([]int, 16)
+	offDiagonal[4] = 2
+	d1, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: corner, Constraints: diagonal})
+	d2, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: offDiagonal, Constraints: diagonal})
+	if eq, e := Equivalent(d1, d2); eq || e != nil {
+		t.Errorf("Diagonal puzzle is equivalent to a row swap of it (%v)", e)
+	}
+	corner[0] = 2
+	d3, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: corner, Constraints: diagonal})
+	if eq, e := Equivalent(d1, d3); !eq || e != nil {
+		t.Errorf("Diagonal puzzle isn't equivalent to a relabeling of it (%v)", e)
+	}
+	if eq, e := Equivalent(k1, k1.copy()); !eq || e != nil {
+		t.Errorf("Killer puzzle isn't equivalent to its copy (%v)", e)
+	}
+}
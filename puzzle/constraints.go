@@ -0,0 +1,511 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+
+Constraint stacks
+
+Hybrid variants put several sets of constraints on one puzzle:
+the diagonals, say, plus the anti-knight rule, plus killer cages.
+A summary lists the sets it uses as its constraints, and the
+puzzle's mapping is composed from the mapping of its geometry
+and each of the sets in turn.  A set can contribute three kinds
+of constraint, which the engine handles generically:
+
+- groups, which (like rows and columns) must contain one of each
+value, and are analyzed just like them;
+
+- exclusions, which keep pairs of squares from sharing a value,
+and so make the squares peers without putting them in a group;
+
+- rules, which restrict the possible values of the squares they
+cover in some other way (such as a cage's sum), and are enforced
+whenever one of their squares is assigned.
+
+Puzzles without constraints have the plain mapping of their
+geometry, and don't pay for any of this.  Composed mappings are
+shared like plain ones, except those with cages, which belong to
+just one puzzle and its copies.
+
+*/
+
+// A Constraint is one set of constraints in a puzzle's stack.
+// Its kind says which set it is; only killer constraints have
+// cages.
+type Constraint struct {
+	Kind  string `json:"kind"`
+	Cages []Cage `json:"cages,omitempty"`
+}
+
+// A Cage is a set of squares whose values must be different and
+// must add up to the cage's sum.
+type Cage struct {
+	Sum     int   `json:"sum"`
+	Indices []int `json:"indices"`
+}
+
+// Constraint kinds.
+const (
+	DiagonalConstraint   = "diagonal"
+	AntiKnightConstraint = "anti-knight"
+	KillerConstraint     = "killer"
+)
+
+// knownConstraints is the lookup table for the functions that
+// add each kind of constraint set to a mapping.
+var knownConstraints = map[string]func(*puzzleMapping, Constraint) error{
+	DiagonalConstraint:   addDiagonals,
+	AntiKnightConstraint: addAntiKnight,
+	KillerConstraint:     addCages,
+}
+
+// A constraintStack is the part of a composed mapping that
+// comes from its constraints.  Groups added by the constraints
+// are in the mapping itself.
+type constraintStack struct {
+	constraints []Constraint
+	xpeers      [][]exclusion // for each square, the squares it excludes
+	rules       []rule
+	rulemap     [][]int // for each square, the rules covering it
+	shared      bool    // whether the mapping is memoized
+}
+
+// An exclusion keeps a square from sharing its value with
+// another, and names the source of the exclusion for errors.
+type exclusion struct {
+	index  int
+	source GroupID
+}
+
+// A rule restricts the possible values of the squares it covers
+// beyond what exclusions do.  Restricting never removes a value
+// that some completion of the rule's squares could use, and
+// reports an Error once the rule can't be met.
+type rule interface {
+	indices() intset
+	restrict(ss []*square) []Error
+}
+
+// copyConstraints returns a copy of a constraint stack that
+// doesn't share storage with it.
+func copyConstraints(cs []Constraint) []Constraint {
+	if len(cs) == 0 {
+		return nil
+	}
+	result := make([]Constraint, len(cs))
+	for i, c := range cs {
+		result[i] = Constraint{Kind: c.Kind}
+		if len(c.Cages) > 0 {
+			result[i].Cages = make([]Cage, len(c.Cages))
+			for j, cage := range c.Cages {
+				result[i].Cages[j] = Cage{cage.Sum, append([]int(nil), cage.Indices...)}
+			}
+		}
+	}
+	return result
+}
+
+// constraintsKey returns a string that identifies a constraint
+// stack, for hashing and memoizing.  It's empty for an empty
+// stack.
+func constraintsKey(cs []Constraint) string {
+	var sb strings.Builder
+	for _, c := range cs {
+		sb.WriteString("+" + c.Kind)
+		for _, cage := range c.Cages {
+			fmt.Fprintf(&sb, ":%d=%v", cage.Sum, cage.Indices)
+		}
+	}
+	return sb.String()
+}
+
+// String describes a constraint set, for text renderings.
+func (c Constraint) String() string {
+	if len(c.Cages) == 0 {
+		return c.Kind
+	}
+	parts := make([]string, len(c.Cages))
+	for i, cage := range c.Cages {
+		parts[i] = fmt.Sprintf("%d=%v", cage.Sum, cage.Indices)
+	}
+	return c.Kind + " " + strings.Join(parts, " ")
+}
+
+// stackKey returns the key of a mapping's constraints.
+func (m *puzzleMapping) stackKey() string {
+	if m.stack == nil {
+		return ""
+	}
+	return constraintsKey(m.stack.constraints)
+}
+
+// constraints returns a copy of a mapping's constraints.
+func (m *puzzleMapping) constraints() []Constraint {
+	if m.stack == nil {
+		return nil
+	}
+	return copyConstraints(m.stack.constraints)
+}
+
+// composedPuzzleMaps is where we memoize composed mappings that
+// can be shared, keyed by geometry, side length, and stack.
+var composedPuzzleMaps = make(map[string]*puzzleMapping)
+
+// composeMapping returns the mapping that composes the given
+// constraints with a geometry's mapping.  It's an Error if a
+// constraint is of an unknown kind, appears twice, or doesn't
+// fit the geometry.
+func composeMapping(base *puzzleMapping, cs []Constraint) (*puzzleMapping, error) {
+	if len(cs) == 0 {
+		return base, nil
+	}
+	shared := true
+	for _, c := range cs {
+		shared = shared && len(c.Cages) == 0
+	}
+	key := fmt.Sprintf("%s %d%s", base.geometry, base.sidelen, constraintsKey(cs))
+	if shared {
+		mappingMutex.Lock()
+		pm, ok := composedPuzzleMaps[key]
+		mappingMutex.Unlock()
+		if ok {
+			return pm, nil
+		}
+	}
+	m := &puzzleMapping{
+		geometry: base.geometry,
+		sidelen:  base.sidelen,
+		tileX:    base.tileX,
+		tileY:    base.tileY,
+		scount:   base.scount,
+		gcount:   base.gcount,
+		gdescs:   append([]groupDescriptor(nil), base.gdescs...),
+		ixmap:    make([][]int, base.scount+1),
+		stack: &constraintStack{
+			constraints: copyConstraints(cs),
+			xpeers:      make([][]exclusion, base.scount+1),
+			rulemap:     make([][]int, base.scount+1),
+			shared:      shared,
+		},
+	}
+	for i := 1; i <= m.scount; i++ {
+		m.ixmap[i] = append([]int(nil), base.ixmap[i]...)
+	}
+	seen := make(map[string]bool)
+	for _, c := range cs {
+		add, ok := knownConstraints[c.Kind]
+		if !ok || seen[c.Kind] {
+			return nil, argumentError(ConstraintAttribute, InvalidArgumentCondition, c.Kind)
+		}
+		seen[c.Kind] = true
+		if e := add(m, c); e != nil {
+			return nil, e
+		}
+	}
+	m.computePeers()
+	if shared {
+		mappingMutex.Lock()
+		defer mappingMutex.Unlock()
+		if pm, ok := composedPuzzleMaps[key]; ok {
+			return pm, nil
+		}
+		composedPuzzleMaps[key] = m
+	}
+	return m, nil
+}
+
+// newConstrainedPuzzle creates a puzzle of the given geometry
+// and constraints from the given values.
+func newConstrainedPuzzle(geometry string, cs []Constraint, values []int) (*Puzzle, error) {
+	base, e := findMapping(geometry, len(values))
+	if e != nil {
+		return nil, e
+	}
+	mapping, e := composeMapping(base, cs)
+	if e != nil {
+		return nil, e
+	}
+	return create(mapping, values)
+}
+
+// addGroup adds a group with the given ID and squares to a
+// mapping being composed.
+func (m *puzzleMapping) addGroup(id GroupID, indices intset) {
+	gi := len(m.gdescs)
+	m.gdescs = append(m.gdescs, groupDescriptor{gi, id, indices})
+	m.gcount++
+	for _, i := range indices {
+		m.ixmap[i] = append(m.ixmap[i], gi)
+	}
+}
+
+// addExclusion keeps two squares of a mapping being composed
+// from sharing a value.  Squares that share a group, or are
+// already excluded, are left alone.
+func (m *puzzleMapping) addExclusion(i, j int, source GroupID) {
+	for _, gi := range m.ixmap[i] {
+		if _, found := m.gdescs[gi].indices.find(j); found {
+			return
+		}
+	}
+	for _, x := range m.stack.xpeers[i] {
+		if x.index == j {
+			return
+		}
+	}
+	m.stack.xpeers[i] = append(m.stack.xpeers[i], exclusion{j, source})
+	m.stack.xpeers[j] = append(m.stack.xpeers[j], exclusion{i, source})
+}
+
+// addRule adds a rule to a mapping being composed.
+func (m *puzzleMapping) addRule(r rule) {
+	ri := len(m.stack.rules)
+	m.stack.rules = append(m.stack.rules, r)
+	for _, i := range r.indices() {
+		m.stack.rulemap[i] = append(m.stack.rulemap[i], ri)
+	}
+}
+
+// check applies a mapping's constraints to newly created
+// squares, returning any Errors.  This is the constraint
+// equivalent of group construction and analysis.
+func (st *constraintStack) check(ss []*square) []Error {
+	var errs []Error
+	for i := 1; i < len(ss); i++ {
+		for _, x := range st.xpeers[i] {
+			if a := ss[x.index].aval; a == 0 {
+				continue
+			} else if ss[i].aval == 0 {
+				errs = append(errs, ss[i].remove(a)...)
+			} else if ss[i].aval == a && x.index > i {
+				errs = append(errs, groupError(x.source, a, DuplicateGroupValuesCondition))
+			}
+		}
+	}
+	for _, r := range st.rules {
+		errs = append(errs, r.restrict(ss)...)
+	}
+	return errs
+}
+
+// assign applies a mapping's constraints to the squares
+// affected by an assignment to the square with the given index,
+// stopping at the first Error (which makes the puzzle
+// unsolvable).  This is the constraint equivalent of group
+// assignment.
+func (st *constraintStack) assign(ss []*square, idx int) []Error {
+	val := ss[idx].aval
+	for _, x := range st.xpeers[idx] {
+		s := ss[x.index]
+		if s.aval == val {
+			return []Error{groupError(x.source, val, DuplicateGroupValuesCondition)}
+		}
+		if s.aval == 0 {
+			if errs := s.remove(val); len(errs) > 0 {
+				return errs
+			}
+		}
+	}
+	for _, ri := range st.rulemap[idx] {
+		if errs := st.rules[ri].restrict(ss); len(errs) > 0 {
+			return errs
+		}
+	}
+	return nil
+}
+
+/*
+
+Diagonals
+
+*/
+
+// addDiagonals adds the two main diagonals of a puzzle as groups.
+func addDiagonals(m *puzzleMapping, c Constraint) error {
+	if len(c.Cages) > 0 {
+		return argumentError(ConstraintAttribute, InvalidArgumentCondition, c.Kind)
+	}
+	down, up := make(intset, m.sidelen), make(intset, m.sidelen)
+	for i := 0; i < m.sidelen; i++ {
+		down[i] = m.sidelen*i + i + 1                 // 1-based indices
+		up[i] = m.sidelen*i + (m.sidelen - 1 - i) + 1 // 1-based indices
+	}
+	m.addGroup(GroupID{GtypeDiagonal, 1}, down)
+	m.addGroup(GroupID{GtypeDiagonal, 2}, up)
+	return nil
+}
+
+/*
+
+Anti-knight
+
+*/
+
+// knightMoves are the row and column offsets of a knight's move.
+var knightMoves = [8][2]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
+
+// addAntiKnight keeps squares a knight's move apart from sharing
+// a value.  The source of each exclusion is the knight group of
+// the lower-numbered square.
+func addAntiKnight(m *puzzleMapping, c Constraint) error {
+	if len(c.Cages) > 0 {
+		return argumentError(ConstraintAttribute, InvalidArgumentCondition, c.Kind)
+	}
+	n := m.sidelen
+	for i := 1; i <= m.scount; i++ {
+		row, col := (i-1)/n, (i-1)%n
+		for _, mv := range knightMoves {
+			kr, kc := row+mv[0], col+mv[1]
+			if kr < 0 || kr >= n || kc < 0 || kc >= n {
+				continue
+			}
+			if j := kr*n + kc + 1; j > i {
+				m.addExclusion(i, j, GroupID{GtypeKnight, i})
+			}
+		}
+	}
+	return nil
+}
+
+/*
+
+Killer cages
+
+*/
+
+// A cageRule requires the values of a cage to add up to its sum.
+// (The cage's values are kept different by exclusions.)
+type cageRule struct {
+	id     GroupID
+	sum    int
+	cindex intset
+}
+
+// addCages adds the cages of a killer constraint.  Every cage
+// must have squares in range that aren't in another cage, and a
+// sum that some distinct values could add up to.
+func addCages(m *puzzleMapping, c Constraint) error {
+	if len(c.Cages) == 0 {
+		return argumentError(ConstraintAttribute, InvalidArgumentCondition, c.Kind)
+	}
+	caged := make([]bool, m.scount+1)
+	for ci, cage := range c.Cages {
+		bad := argumentError(ConstraintAttribute, InvalidArgumentCondition, cage)
+		k := len(cage.Indices)
+		if k == 0 || k > m.sidelen {
+			return bad
+		}
+		if lo, hi := k*(k+1)/2, k*(2*m.sidelen-k+1)/2; cage.Sum < lo || cage.Sum > hi {
+			return bad
+		}
+		var indices intset
+		for _, i := range cage.Indices {
+			if i < 1 || i > m.scount || caged[i] {
+				return bad
+			}
+			caged[i] = true
+			indices.insert(i)
+		}
+		id := GroupID{GtypeCage, ci + 1}
+		for x, i := range indices {
+			for _, j := range indices[x+1:] {
+				m.addExclusion(i, j, id)
+			}
+		}
+		m.addRule(&cageRule{id, cage.Sum, indices})
+	}
+	return nil
+}
+
+// indices returns the squares in the cage.
+func (r *cageRule) indices() intset {
+	return r.cindex
+}
+
+// restrict removes the possible values of the cage's empty
+// squares that can't be part of its sum.  A value can be part of
+// the sum if the rest of the sum is between the smallest and
+// largest totals of distinct values the other empty squares
+// might take.  Once the cage is full, its values must add up to
+// the sum.
+func (r *cageRule) restrict(ss []*square) []Error {
+	rest, used := r.sum, bitset(0)
+	var empty []*square
+	for _, i := range r.cindex {
+		if a := ss[i].aval; a != 0 {
+			rest -= a
+			used.insert(a)
+		} else {
+			empty = append(empty, ss[i])
+		}
+	}
+	if len(empty) == 0 {
+		if rest != 0 {
+			return []Error{groupError(r.id, r.sum, ImpossibleSumCondition)}
+		}
+		return nil
+	}
+	for _, s := range empty {
+		var others bitset
+		for _, o := range empty {
+			if o != s {
+				others |= o.pvals
+			}
+		}
+		others &^= used
+		var drop bitset
+		for v := range s.pvals.values() {
+			vals := others
+			vals.remove(v)
+			lo, hi, ok := sumRange(vals, len(empty)-1)
+			if !ok || rest-v < lo || rest-v > hi {
+				drop.insert(v)
+			}
+		}
+		if drop == s.pvals {
+			return []Error{groupError(r.id, r.sum, ImpossibleSumCondition)}
+		}
+		if drop != 0 {
+			if errs := s.subtract(drop); len(errs) > 0 {
+				return errs
+			}
+		}
+	}
+	return nil
+}
+
+// sumRange returns the smallest and largest totals of k distinct
+// values from a bitset, and whether it has that many values.
+func sumRange(vals bitset, k int) (lo, hi int, ok bool) {
+	all := vals.intset()
+	if len(all) < k {
+		return 0, 0, false
+	}
+	for i := 0; i < k; i++ {
+		lo += all[i]
+		hi += all[len(all)-1-i]
+	}
+	return lo, hi, true
+}
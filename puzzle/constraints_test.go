@@ -0,0 +1,291 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiagonalConstraint(t *testing.T) {
+	diagonal := []Constraint{{Kind: DiagonalConstraint}}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: diagonal})
+	if e != nil {
+		t.Fatalf("Creation of empty diagonal puzzle failed: %v", e)
+	}
+	gids, _ := p.GroupsOf(6)
+	if !reflect.DeepEqual(gids[3:], []GroupID{{GtypeDiagonal, 1}}) {
+		t.Errorf("Square 6 is in groups %v, expected a diagonal", gids)
+	}
+	gids, _ = p.GroupsOf(7)
+	if !reflect.DeepEqual(gids[3:], []GroupID{{GtypeDiagonal, 2}}) {
+		t.Errorf("Square 7 is in groups %v, expected the other diagonal", gids)
+	}
+	solns, e := p.Solutions()
+	if e != nil || len(solns) == 0 {
+		t.Fatalf("Solutions of empty diagonal puzzle failed: %v, %v", solns, e)
+	}
+	for _, soln := range solns {
+		v := soln.Values
+		for _, diag := range [][]int{{0, 5, 10, 15}, {3, 6, 9, 12}} {
+			seen := map[int]bool{}
+			for _, i := range diag {
+				seen[v[i]] = true
+			}
+			if len(seen) != 4 {
+				t.Fatalf("Solution %v repeats a value on a diagonal", v)
+			}
+		}
+	}
+	if plain, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4}); len(solns) >= len(plain.allSolutions()) {
+		t.Errorf("Diagonals didn't rule out any of the %d solutions", len(solns))
+	}
+
+	// the rotation puzzle repeats 1 on its down diagonal
+	q, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4,
+		Values: rotation4Puzzle1PartialValues, Constraints: diagonal})
+	if e != nil {
+		t.Fatalf("Creation of diagonal rotation puzzle failed: %v", e)
+	}
+	expected := groupError(GroupID{GtypeDiagonal, 1}, 1, DuplicateGroupValuesCondition)
+	if len(q.errors) == 0 || !reflect.DeepEqual(q.errors[0], expected) {
+		t.Errorf("Diagonal rotation puzzle has errors %v, expected %v", q.errors, expected)
+	}
+}
+
+func TestAntiKnightConstraint(t *testing.T) {
+	antiKnight := []Constraint{{Kind: AntiKnightConstraint}}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: antiKnight})
+	if e != nil {
+		t.Fatalf("Creation of empty anti-knight puzzle failed: %v", e)
+	}
+	peers, _ := p.Peers(1)
+	if _, found := (*intset)(&peers).find(7); !found {
+		t.Errorf("Square 1 has peers %v, expected a knight's move to 7", peers)
+	}
+	content, e := p.Assign(Choice{1, 1})
+	if e != nil {
+		t.Fatalf("Assign(Choice{1, 1}) failed: %v", e)
+	}
+	changed := map[int]bool{}
+	for _, s := range content.Squares {
+		changed[s.Index] = true
+	}
+	for _, i := range []int{7, 10} {
+		if !changed[i] {
+			t.Errorf("Assignment didn't report square %d", i)
+		}
+		if found := p.squares[i].pvals.find(1); found {
+			t.Errorf("Square %d still has possible values %v", i, p.squares[i].pvals)
+		}
+	}
+	if errs := p.Validate(); errs != nil {
+		t.Errorf("Validate after assign found %v", errs)
+	}
+	if _, e := p.Unassign(1); e != nil {
+		t.Fatalf("Unassign(1) failed: %v", e)
+	}
+	for _, i := range []int{7, 10} {
+		if found := p.squares[i].pvals.find(1); !found {
+			t.Errorf("Square %d has possible values %v after unassign", i, p.squares[i].pvals)
+		}
+	}
+	if errs := p.Validate(); errs != nil {
+		t.Errorf("Validate after unassign found %v", errs)
+	}
+
+	// a knight's move apart with the same value is an error
+	values := make([]int, 16)
+	values[0], values[6] = 1, 1
+	q, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: values, Constraints: antiKnight})
+	if e != nil {
+		t.Fatalf("Creation of conflicting anti-knight puzzle failed: %v", e)
+	}
+	expected := groupError(GroupID{GtypeKnight, 1}, 1, DuplicateGroupValuesCondition)
+	if len(q.errors) == 0 || !reflect.DeepEqual(q.errors[0], expected) {
+		t.Errorf("Conflicting anti-knight puzzle has errors %v, expected %v", q.errors, expected)
+	}
+}
+
+func TestKillerConstraint(t *testing.T) {
+	killer := []Constraint{{Kind: KillerConstraint, Cages: []Cage{{5, []int{2, 6}}}}}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: killer})
+	if e != nil {
+		t.Fatalf("Creation of empty killer puzzle failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{6, 3}); e != nil {
+		t.Fatalf("Assign(Choice{6, 3}) failed: %v", e)
+	}
+	if pvals := p.squares[2].pvals; pvals != newBitset(2) {
+		t.Errorf("Caged square has possible values %v, expected [2]", pvals)
+	}
+	if errs := p.Validate(); errs != nil {
+		t.Errorf("Validate after assign found %v", errs)
+	}
+	if _, e := p.Unassign(6); e != nil {
+		t.Fatalf("Unassign(6) failed: %v", e)
+	}
+	if pvals := p.squares[2].pvals; pvals != newBitset(1, 2, 3, 4) {
+		t.Errorf("Caged square has possible values %v after unassign", pvals)
+	}
+	if errs := p.Validate(); errs != nil {
+		t.Errorf("Validate after unassign found %v", errs)
+	}
+
+	// the cage picks one of the rotation puzzle's two solutions
+	q, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4,
+		Values: rotation4Puzzle1PartialValues, Constraints: killer})
+	if e != nil {
+		t.Fatalf("Creation of killer rotation puzzle failed: %v", e)
+	}
+	solns, e := q.Solutions()
+	if e != nil || len(solns) != 1 || solns[0].Values[1] != 2 {
+		t.Errorf("Killer rotation puzzle has solutions %v (%v), expected one with 2 in square 2", solns, e)
+	}
+
+	// a full cage with the wrong sum is an error
+	values := make([]int, 16)
+	values[1], values[5] = 1, 3
+	r, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: values, Constraints: killer})
+	if e != nil {
+		t.Fatalf("Creation of wrong-sum killer puzzle failed: %v", e)
+	}
+	expected := groupError(GroupID{GtypeCage, 1}, 5, ImpossibleSumCondition)
+	if len(r.errors) == 0 || !reflect.DeepEqual(r.errors[0], expected) {
+		t.Errorf("Wrong-sum killer puzzle has errors %v, expected %v", r.errors, expected)
+	}
+}
+
+func TestConstraintStack(t *testing.T) {
+	stack := []Constraint{
+		{Kind: DiagonalConstraint},
+		{Kind: AntiKnightConstraint},
+		{Kind: KillerConstraint, Cages: []Cage{{3, []int{1, 2}}, {7, []int{15, 16}}}},
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Constraints: stack})
+	if e != nil {
+		t.Fatalf("Creation of stacked puzzle failed: %v", e)
+	}
+	if pvals := p.squares[1].pvals; pvals != newBitset(1, 2) {
+		t.Errorf("Caged square has possible values %v, expected [1 2]", pvals)
+	}
+	if _, e := p.Assign(Choice{1, 1}); e != nil {
+		t.Fatalf("Assign(Choice{1, 1}) failed: %v", e)
+	}
+	if errs := p.Validate(); errs != nil {
+		t.Errorf("Validate after assign found %v", errs)
+	}
+
+	// the stack survives a round trip through a summary, and
+	// changes the puzzle's hash
+	bytes, e := json.Marshal(p.summary())
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	if !reflect.DeepEqual(decoded.Constraints, stack) {
+		t.Errorf("Decoded summary has constraints %v, expected %v", decoded.Constraints, stack)
+	}
+	q, e := New(&decoded)
+	if e != nil {
+		t.Fatalf("Failed to create puzzle from summary: %v", e)
+	}
+	if !reflect.DeepEqual(q.allSquares(), p.allSquares()) {
+		t.Errorf("Resumed puzzle has squares %v, expected %v", q.allSquares(), p.allSquares())
+	}
+	plain := &Summary{Geometry: StandardGeometryName, SideLength: 9, Values: decoded.Values}
+	if plain.hash() == decoded.hash() {
+		t.Errorf("Constraints don't change the hash")
+	}
+	if q.hash() != decoded.hash() {
+		t.Errorf("Puzzle hash %v doesn't match summary hash %v", q.hash(), decoded.hash())
+	}
+
+	// mappings without cages are shared, others aren't
+	r, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Constraints: stack[:2]})
+	s, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Constraints: stack[:2]})
+	if r.mapping != s.mapping {
+		t.Errorf("Mappings for the same constraints aren't shared")
+	}
+	if q.mapping == p.mapping {
+		t.Errorf("Mappings with cages are shared")
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		stack []Constraint
+	}{
+		{"unknown kind", []Constraint{{Kind: "sandwich"}}},
+		{"repeated kind", []Constraint{{Kind: DiagonalConstraint}, {Kind: DiagonalConstraint}}},
+		{"diagonal cages", []Constraint{{Kind: DiagonalConstraint, Cages: []Cage{{3, []int{1, 2}}}}}},
+		{"no cages", []Constraint{{Kind: KillerConstraint}}},
+		{"empty cage", []Constraint{{Kind: KillerConstraint, Cages: []Cage{{3, nil}}}}},
+		{"overlapping cages", []Constraint{{Kind: KillerConstraint, Cages: []Cage{{3, []int{1, 2}}, {3, []int{2, 3}}}}}},
+		{"index out of range", []Constraint{{Kind: KillerConstraint, Cages: []Cage{{3, []int{1, 17}}}}}},
+		{"sum too small", []Constraint{{Kind: KillerConstraint, Cages: []Cage{{2, []int{1, 2}}}}}},
+		{"sum too large", []Constraint{{Kind: KillerConstraint, Cages: []Cage{{8, []int{1, 2}}}}}},
+	}
+	for _, test := range tests {
+		_, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: test.stack})
+		if err, ok := e.(Error); !ok || err.Attribute != ConstraintAttribute {
+			t.Errorf("%s: got %v, expected a constraint error", test.name, e)
+		}
+	}
+}
+
+func TestUnassignConstrained(t *testing.T) {
+	stacks := [][]Constraint{
+		{{Kind: DiagonalConstraint}},
+		{{Kind: AntiKnightConstraint}},
+		{{Kind: KillerConstraint, Cages: []Cage{{6, []int{1, 2}}, {4, []int{3, 4}}}}},
+	}
+	for _, stack := range stacks {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Constraints: stack})
+		if e != nil {
+			t.Fatalf("Creation of %v puzzle failed: %v", stack, e)
+		}
+		before := p.allSquares()
+		if _, e := p.Assign(Choice{1, 2}); e != nil {
+			t.Fatalf("%v: Assign(Choice{1, 2}) failed: %v", stack, e)
+		}
+		assigned := p.state().Squares
+		update, e := p.Unassign(1)
+		if e != nil {
+			t.Fatalf("%v: Unassign(1) failed: %v", stack, e)
+		}
+		if after := p.allSquares(); !reflect.DeepEqual(after, before) {
+			t.Errorf("%v: Unassign left squares %v, expected %v", stack, after, before)
+		}
+		if got, want := applyDelta(assigned, update), p.state().Squares; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: Unassign update gives squares %v, expected %v", stack, got, want)
+		}
+		if len(update.Squares) < 2 || update.Squares[0].Index != 1 {
+			t.Errorf("%v: Unassign reported squares %v", stack, update.Squares)
+		}
+		if errs := p.Validate(); errs != nil {
+			t.Errorf("%v: Validate after unassign found %v", stack, errs)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "context"
+
+/*
+
+Context-aware operations
+
+Operations on big puzzles can take long enough that a caller
+may want to give up on them, so the heavier ones have variants
+that take a context.  Cancellation is checked at propagation
+boundaries (such as between the analyses of the groups affected
+by an assignment), and an operation that's stopped part way
+through is taken back, so the puzzle is never left half
+changed.  A stopped operation returns an Error with
+CanceledCondition whose value is the context's error.
+
+*/
+
+// canceled returns whether the context of the operation in
+// progress (if any) is done.
+func (p *Puzzle) canceled() bool {
+	return p.ctx != nil && p.ctx.Err() != nil
+}
+
+// canceledError returns the Error for an operation whose context
+// is done.
+func canceledError(ctx context.Context) Error {
+	err := Error{
+		Scope:     RequestScope,
+		Structure: ScopeStructure,
+		Condition: CanceledCondition,
+		Values:    ErrorData{ctx.Err().Error()},
+		cause:     ctx.Err(),
+	}
+	err.Message = err.Error()
+	return err
+}
+
+// AssignContext is Assign with a context.  If the context is
+// done before the assignment has been propagated through the
+// puzzle, the assignment is taken back and an Error is returned.
+func (p *Puzzle) AssignContext(ctx context.Context, choice Choice) (*Content, error) {
+	if err := p.checkAssignable(); err != nil {
+		return nil, err
+	}
+	if err := p.checkChoice(choice, 0); err != nil {
+		return nil, err
+	}
+	if err := p.checkJournalRoom(1); err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, canceledError(ctx)
+	}
+	token := p.checkpoint()
+	p.ctx = ctx
+	is := p.do(p.clientMove(AssignAction, choice.Index, choice.Value))
+	p.ctx = nil
+	if ctx.Err() != nil {
+		p.rollback(token)
+		return nil, canceledError(ctx)
+	}
+	p.commit(token)
+	return p.update(is), nil
+}
+
+// StateContext is State with a context, which is checked after
+// each row's worth of squares.
+func (p *Puzzle) StateContext(ctx context.Context) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	SS := make([]Square, p.mapping.scount)
+	for i := range SS {
+		if i%p.mapping.sidelen == 0 && ctx.Err() != nil {
+			return nil, canceledError(ctx)
+		}
+		SS[i] = p.indexToSquare(i + 1)
+	}
+	return &Content{SS, p.allErrors(true)}, nil
+}
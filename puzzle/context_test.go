@@ -0,0 +1,106 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// countdownContext is a context that becomes canceled after its
+// Err method has been called a given number of times.
+type countdownContext struct {
+	context.Context
+	count int
+}
+
+func (c *countdownContext) Err() error {
+	if c.count <= 0 {
+		return context.Canceled
+	}
+	c.count--
+	return nil
+}
+
+func TestContextOperations(t *testing.T) {
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary := &Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues}
+	_, e := NewContext(done, summary)
+	if e == nil || e.(Error).Condition != CanceledCondition {
+		t.Fatalf("NewContext with done context produced incorrect error: %v", e)
+	}
+	if status := e.(Error).HTTPStatus(); status != http.StatusServiceUnavailable {
+		t.Errorf("Canceled error has status %d, expected %d", status, http.StatusServiceUnavailable)
+	}
+	p, e := NewContext(context.Background(), summary)
+	if e != nil {
+		t.Fatalf("NewContext failed: %v", e)
+	}
+	solution := p.allSolutions()[0].Values
+	empty := 1
+	for threeStarValues[empty-1] != 0 {
+		empty++
+	}
+	choice := Choice{empty, solution[empty-1]}
+
+	// an assignment stopped part way through is taken back
+	before := p.allSquares()
+	_, e = p.AssignContext(&countdownContext{context.Background(), 3}, choice)
+	if e == nil || e.(Error).Condition != CanceledCondition {
+		t.Fatalf("Canceled AssignContext produced incorrect error: %v", e)
+	}
+	if !reflect.DeepEqual(p.allSquares(), before) || len(p.errors) != 0 {
+		t.Errorf("Canceled AssignContext changed the puzzle")
+	}
+	if _, e := p.Undo(); e == nil {
+		t.Errorf("Canceled AssignContext left a move to undo")
+	}
+	update, e := p.AssignContext(context.Background(), choice)
+	if e != nil {
+		t.Fatalf("AssignContext(%v) failed: %v", choice, e)
+	}
+	q, _ := New(summary)
+	if expected, _ := q.Assign(choice); !reflect.DeepEqual(update, expected) {
+		t.Errorf("AssignContext returned %v, expected %v", update, expected)
+	}
+	if _, e := p.AssignContext(done, Choice{0, 1}); e == nil || e.(Error).Condition != TooSmallCondition {
+		t.Errorf("AssignContext of bad choice produced incorrect error: %v", e)
+	}
+
+	// journal replay is stopped, too
+	summary = p.summary()
+	summary.Journal, _ = p.Journal()
+	_, e = NewContext(&countdownContext{context.Background(), 2}, summary)
+	if e == nil || e.(Error).Condition != CanceledCondition {
+		t.Errorf("NewContext canceled during replay produced incorrect error: %v", e)
+	}
+
+	// state
+	state, e := p.StateContext(context.Background())
+	if expected, _ := p.State(); e != nil || !reflect.DeepEqual(state, expected) {
+		t.Errorf("StateContext returned %v (%v), expected %v", state, e, expected)
+	}
+	_, e = p.StateContext(&countdownContext{context.Background(), 4})
+	if e == nil || e.(Error).Condition != CanceledCondition {
+		t.Errorf("Canceled StateContext produced incorrect error: %v", e)
+	}
+}
@@ -0,0 +1,64 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "sync"
+
+/*
+
+Defaults
+
+Servers can change some of the engine's defaults while running.
+A default applies to every puzzle that hasn't made its own
+choice, including puzzles already made, so changing a default
+changes them too.  Choices puzzles have made (such as an assist
+level set with SetAssist) are kept in their metadata and aren't
+affected.
+
+*/
+
+// Defaults are the engine's settings for puzzles that haven't
+// chosen their own.
+type Defaults struct {
+	Assist AssistLevel `json:"assist"`
+}
+
+var (
+	defaultsMutex sync.RWMutex
+	defaults      Defaults
+)
+
+// CurrentDefaults returns the engine's defaults.
+func CurrentDefaults() Defaults {
+	defaultsMutex.RLock()
+	defer defaultsMutex.RUnlock()
+	return defaults
+}
+
+// SetDefaults changes the engine's defaults.  It's an error if a
+// default isn't valid.
+func SetDefaults(d Defaults) error {
+	if d.Assist < AssistFull || d.Assist >= MaxAssist {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "Assist level", int(d.Assist))
+	}
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+	defaults = d
+	return nil
+}
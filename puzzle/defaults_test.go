@@ -0,0 +1,75 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "testing"
+
+func TestSetDefaults(t *testing.T) {
+	defer SetDefaults(CurrentDefaults())
+	if e := SetDefaults(Defaults{Assist: MaxAssist}); e == nil {
+		t.Errorf("SetDefaults with a bad assist level succeeded")
+	}
+	if e := SetDefaults(Defaults{Assist: AssistNone}); e != nil {
+		t.Fatalf("SetDefaults failed: %v", e)
+	}
+	if d := CurrentDefaults(); d.Assist != AssistNone {
+		t.Errorf("Defaults are %+v after setting them", d)
+	}
+}
+
+func TestDefaultAssist(t *testing.T) {
+	defer SetDefaults(CurrentDefaults())
+	SetDefaults(Defaults{Assist: AssistNone})
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if p.Assist() != AssistNone {
+		t.Errorf("New puzzle has assist level %v, expected the default", p.Assist())
+	}
+	if _, ok := p.Metadata[AssistMetadataKey]; ok {
+		t.Errorf("Default assist level was recorded: %v", p.Metadata)
+	}
+
+	// setting full assist, when it isn't the default, records it
+	if e := p.SetAssist(AssistFull); e != nil {
+		t.Fatalf("SetAssist(AssistFull) failed: %v", e)
+	}
+	if p.Metadata[AssistMetadataKey] != "full" {
+		t.Errorf("Full assist level wasn't recorded: %v", p.Metadata)
+	}
+	q, e := New(p.summary())
+	if e != nil || q.Assist() != AssistFull {
+		t.Errorf("Summary round trip gave assist level %v (%v)", q.Assist(), e)
+	}
+
+	// a puzzle following the default changes with it
+	r, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	SetDefaults(Defaults{Assist: AssistFull})
+	if s, _ := New(r.summary()); s.Assist() != AssistFull {
+		t.Errorf("Puzzle following the default has assist level %v", s.Assist())
+	}
+
+	if al, ok := ParseAssistLevel("candidates"); !ok || al != AssistCandidates {
+		t.Errorf("ParseAssistLevel(candidates) gave %v, %v", al, ok)
+	}
+	if _, ok := ParseAssistLevel("some"); ok {
+		t.Errorf("ParseAssistLevel(some) succeeded")
+	}
+}
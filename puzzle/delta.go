@@ -0,0 +1,100 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Versions and deltas
+
+A puzzle's version is its count of changes, and each square
+remembers the version at which it last changed.  A client that
+has the puzzle's State as of some version can catch up by
+asking for the State since that version, which has only the
+squares changed since then.  On big grids this is much less
+than the full State, which matters for clients that poll or
+reconnect.
+
+*/
+
+// stamp records that the squares with the given indices changed
+// in the puzzle's current version.  Squares that have never
+// changed have version 0, so the storage for the versions isn't
+// made until something changes.
+func (p *Puzzle) stamp(is intset) {
+	if len(is) == 0 {
+		return
+	}
+	if p.versions == nil {
+		p.versions = make([]int, p.mapping.scount+1) // 1-based indexing
+	}
+	for _, idx := range is {
+		p.versions[idx] = p.changes
+	}
+}
+
+// changedSince returns the indices of the squares that changed
+// after the given version.
+func (p *Puzzle) changedSince(version int) intset {
+	is := intset{}
+	for idx, v := range p.versions {
+		if v > version {
+			is = append(is, idx)
+		}
+	}
+	return is
+}
+
+// Version returns the puzzle's current version.  Every change to
+// the puzzle's State makes a new version, and versions only
+// increase.  Copies of a puzzle start at the version of the
+// original.
+func (p *Puzzle) Version() (int, error) {
+	if !p.isValid() {
+		return 0, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	return p.changes, nil
+}
+
+// StateSince returns the content of the squares that have changed
+// since the given version of the puzzle (along with all the
+// puzzle's errors) and the puzzle's current version, which the
+// caller can use for its next request.  Applying the returned
+// squares to the State as of the given version gives the current
+// State.  If the given version is later than the current one, an
+// Error is returned.
+func (p *Puzzle) StateSince(version int) (*Content, int, error) {
+	if !p.isValid() {
+		return nil, 0, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if version < 0 || version > p.changes {
+		return nil, 0, argumentError(NamedAttribute, InvalidArgumentCondition, "Version", version)
+	}
+	return &Content{
+		Squares: p.indicesToSquares(p.changedSince(version)),
+		Errors:  p.allErrors(true),
+	}, p.changes, nil
+}
+
+// copyVersions returns a copy of a puzzle's square versions.
+func (p *Puzzle) copyVersions() []int {
+	if p.versions == nil {
+		return nil
+	}
+	return append([]int(nil), p.versions...)
+}
@@ -0,0 +1,153 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// applyDelta updates a copy of the squares in a State with the
+// squares in a delta.
+func applyDelta(squares []Square, delta *Content) []Square {
+	result := append([]Square(nil), squares...)
+	for _, s := range delta.Squares {
+		result[s.Index-1] = s
+	}
+	return result
+}
+
+func TestStateSince(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if delta, version, e := p.StateSince(0); e != nil || version != 0 || len(delta.Squares) != 0 {
+		t.Fatalf("StateSince(0) of new puzzle gave %v, %d, %v", delta, version, e)
+	}
+
+	// after each operation, the delta since each prior version
+	// brings that version's State up to date
+	states := []*Content{p.state()}
+	versions := []int{0}
+	ops := []struct {
+		name string
+		op   func() (*Content, error)
+	}{
+		{"Assign", func() (*Content, error) { return p.Assign(Choice{13, 2}) }},
+		{"AssignAll", func() (*Content, error) { return p.AssignAll([]Choice{{10, 4}}) }},
+		{"AddMark", func() (*Content, error) { return p.AddMark(2, 2) }},
+		{"Unassign", func() (*Content, error) { return p.Unassign(10) }},
+		{"Undo", func() (*Content, error) { return p.Undo() }},
+		{"Redo", func() (*Content, error) { return p.Redo() }},
+		{"ClearMarks", func() (*Content, error) { return p.ClearMarks(2) }},
+	}
+	for _, tc := range ops {
+		update, e := tc.op()
+		if e != nil {
+			t.Fatalf("%s failed: %v", tc.name, e)
+		}
+		state := p.state()
+		current, _ := p.Version()
+		if current <= versions[len(versions)-1] {
+			t.Errorf("%s: version %d didn't increase", tc.name, current)
+		}
+		delta, version, e := p.StateSince(versions[len(versions)-1])
+		if e != nil || version != current {
+			t.Fatalf("%s: StateSince gave version %d, error %v", tc.name, version, e)
+		}
+		if !reflect.DeepEqual(delta.Squares, update.Squares) {
+			t.Errorf("%s: delta %v doesn't match update %v", tc.name, delta.Squares, update.Squares)
+		}
+		for i, old := range states {
+			delta, _, _ := p.StateSince(versions[i])
+			if got := applyDelta(old.Squares, delta); !reflect.DeepEqual(got, state.Squares) {
+				t.Errorf("%s: delta since version %d gave %v, expected %v",
+					tc.name, versions[i], got, state.Squares)
+			}
+			if !reflect.DeepEqual(delta.Errors, state.Errors) {
+				t.Errorf("%s: delta errors %v, expected %v", tc.name, delta.Errors, state.Errors)
+			}
+		}
+		states, versions = append(states, state), append(versions, current)
+	}
+
+	// copies keep the versions, but change independently
+	c := p.copy()
+	c.Assign(Choice{15, 4})
+	if delta, _, _ := p.StateSince(versions[len(versions)-1]); len(delta.Squares) != 0 {
+		t.Errorf("Change to copy showed in original: %v", delta.Squares)
+	}
+	cdelta, _, _ := c.StateSince(versions[len(versions)-1])
+	if len(cdelta.Squares) == 0 || cdelta.Squares[len(cdelta.Squares)-1].Index != 15 {
+		t.Errorf("Copy's delta %v doesn't have its change", cdelta.Squares)
+	}
+
+	// bad versions and puzzles
+	current, _ := p.Version()
+	for _, v := range []int{-1, current + 1} {
+		if _, _, e := p.StateSince(v); e == nil {
+			t.Errorf("No error for StateSince(%d)", v)
+		}
+	}
+	if _, _, e := (*Puzzle)(nil).StateSince(0); e == nil {
+		t.Errorf("No error for StateSince of nil puzzle")
+	}
+	if _, e := (*Puzzle)(nil).Version(); e == nil {
+		t.Errorf("No error for Version of nil puzzle")
+	}
+}
+
+func TestStateHandlerSince(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/"+query, nil)
+		w := httptest.NewRecorder()
+		p.StateHandler(w, r)
+		return w
+	}
+	w := get("")
+	version := w.Header().Get(VersionHeader)
+	if w.Code != http.StatusOK || version != "0" {
+		t.Fatalf("Full state gave status %d, version %q", w.Code, version)
+	}
+	update, e := p.Assign(Choice{13, 2})
+	if e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	w = get("?since=" + version)
+	if w.Code != http.StatusOK || w.Header().Get(VersionHeader) != strconv.Itoa(p.changes) {
+		t.Fatalf("Delta gave status %d, version %q", w.Code, w.Header().Get(VersionHeader))
+	}
+	expected, _ := update.AppendJSON(nil)
+	if got := w.Body.String(); got != string(expected) {
+		t.Errorf("Delta was %s, expected %s", got, expected)
+	}
+	for _, bad := range []string{"?since=x", "?since=100"} {
+		if w = get(bad); w.Code != http.StatusBadRequest {
+			t.Errorf("%s gave status %d", bad, w.Code)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Per-square difficulty
+
+The solver places a square's value in one of a few ways: the
+square has only one candidate left, or a group binds it to the
+only place a value can go, or (once those run out) a choice is
+needed.  Simulating the easy placements round by round tells
+how hard each empty square is to get to, which the teaching
+client uses to color the grid and point out easy wins.
+
+*/
+
+// A DifficultyTier says how a square's value can be deduced.
+type DifficultyTier int
+
+// The difficulty tiers, easiest first.
+const (
+	UnknownTier DifficultyTier = iota
+	SingleTier                 // the square has only one candidate now
+	BoundTier                  // a group binds the square's value now
+	DeducedTier                // single or bound after other easy placements
+	ChoiceTier                 // can't be placed without a choice
+	MaxTier
+)
+
+var tierNames = [...]string{
+	UnknownTier: "unknown",
+	SingleTier:  "single",
+	BoundTier:   "bound",
+	DeducedTier: "deduced",
+	ChoiceTier:  "choice",
+}
+
+// DifficultyTiers implement Stringer
+func (dt DifficultyTier) String() string {
+	if dt >= 0 && dt < MaxTier {
+		return tierNames[dt]
+	}
+	return tierNames[UnknownTier]
+}
+
+// A SquareDifficulty estimates how hard it is to deduce the
+// value of an empty square.  Round is the number of rounds of
+// easy placements that have to be made before the square's own
+// placement is easy: it is 0 for the single and bound tiers, and
+// at least 1 for the deduced tier.  Squares in the choice tier
+// have a Round of 0.
+type SquareDifficulty struct {
+	Index int            `json:"index"`
+	Tier  DifficultyTier `json:"tier"`
+	Round int            `json:"round,omitempty"`
+}
+
+// Difficulties returns the estimated difficulty of each empty
+// square in the puzzle, in index order.  It's an Error if the
+// puzzle has errors, since then no square's value can be
+// deduced.
+func (p *Puzzle) Difficulties() ([]SquareDifficulty, error) {
+	if err := p.checkAssignable(); err != nil {
+		return nil, err
+	}
+	var result []SquareDifficulty
+	where := make(map[int]int) // index of each empty square in the result
+	for i := 1; i <= p.mapping.scount; i++ {
+		if p.squares[i].aval == 0 {
+			where[i] = len(result)
+			result = append(result, SquareDifficulty{Index: i, Tier: ChoiceTier})
+		}
+	}
+
+	// make rounds of easy placements on a copy of the puzzle,
+	// until there are none left or they produce errors
+	c, release := p.scratchCopy()
+	defer release()
+	for round := 0; len(c.errors) == 0; round++ {
+		var choices []Choice
+		for i := 1; i <= c.mapping.scount; i++ {
+			s := c.squares[i]
+			if s.aval != 0 {
+				continue
+			}
+			tier := DeducedTier
+			switch {
+			case s.pvals.len() == 1:
+				choices = append(choices, Choice{i, s.pvals.min()})
+				if round == 0 {
+					tier = SingleTier
+				}
+			case s.bval != 0:
+				choices = append(choices, Choice{i, s.bval})
+				if round == 0 {
+					tier = BoundTier
+				}
+			default:
+				continue
+			}
+			if tier == DeducedTier {
+				result[where[i]].Round = round
+			}
+			result[where[i]].Tier = tier
+		}
+		if len(choices) == 0 {
+			break
+		}
+		for _, choice := range choices {
+			if c.squares[choice.Index].aval == 0 && len(c.errors) == 0 {
+				c.assign(choice.Index, choice.Value)
+			}
+		}
+	}
+	return result, nil
+}
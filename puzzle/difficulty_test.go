@@ -0,0 +1,94 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "testing"
+
+func TestDifficulties(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	ds, e := p.Difficulties()
+	if e != nil {
+		t.Fatalf("Difficulties failed: %v", e)
+	}
+	empty := 0
+	for _, v := range threeStarValues {
+		if v == 0 {
+			empty++
+		}
+	}
+	if len(ds) != empty {
+		t.Fatalf("Got %d difficulties for %d empty squares", len(ds), empty)
+	}
+	deduced := 0
+	for i, d := range ds {
+		if i > 0 && d.Index <= ds[i-1].Index {
+			t.Errorf("Difficulties are out of order at %v", d)
+		}
+		s := p.squares[d.Index]
+		switch d.Tier {
+		case SingleTier:
+			if s.pvals.len() != 1 || d.Round != 0 {
+				t.Errorf("Square %d is %v but has candidates %v", d.Index, d, s.pvals)
+			}
+		case BoundTier:
+			if s.pvals.len() == 1 || s.bval == 0 || d.Round != 0 {
+				t.Errorf("Square %d is %v but has candidates %v and binding %d", d.Index, d, s.pvals, s.bval)
+			}
+		case DeducedTier:
+			deduced++
+			if s.pvals.len() == 1 || s.bval != 0 || d.Round < 1 {
+				t.Errorf("Square %d is %v but has candidates %v and binding %d", d.Index, d, s.pvals, s.bval)
+			}
+		default:
+			// this puzzle can be solved without choices
+			t.Errorf("Square %d has tier %v", d.Index, d.Tier)
+		}
+	}
+	if deduced == 0 {
+		t.Errorf("No squares were deduced")
+	}
+
+	// some squares in this puzzle need a choice
+	p, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: solveSimpleStartValues})
+	if e != nil {
+		t.Fatalf("Creation of solveSimple puzzle failed: %v", e)
+	}
+	ds, _ = p.Difficulties()
+	choices := 0
+	for _, d := range ds {
+		if d.Tier == ChoiceTier {
+			choices++
+		}
+	}
+	if choices == 0 {
+		t.Errorf("No squares in solveSimple puzzle need a choice: %v", ds)
+	}
+
+	// a puzzle with errors has no difficulties
+	p, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1})
+	if e != nil {
+		t.Fatalf("Creation of conflicting puzzle failed: %v", e)
+	}
+	if _, e := p.Difficulties(); e == nil {
+		t.Errorf("Difficulties of conflicting puzzle succeeded")
+	}
+}
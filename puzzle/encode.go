@@ -0,0 +1,329 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+
+Appending JSON encoders
+
+Contents are the bulk of what the web service sends: one for
+every assignment, undo, and state request.  Encoding them with
+reflection costs more than computing them, so Square, Content,
+and Summary have encoders that append their JSON to a buffer
+(which the service reuses across responses).  The output is
+exactly what the encoding/json package would produce, and their
+MarshalJSON methods use them, so encoding one with
+encoding/json gives the same result.
+
+The parts of Summaries that are rarely present (Info, the
+Journal, Errors, and Annotations) are encoded by their usual
+encoders.
+
+*/
+
+// AppendJSON appends the JSON encoding of the Square to the
+// buffer, and returns the extended buffer.
+func (S *Square) AppendJSON(buf []byte) []byte {
+	buf = append(buf, `{"index":`...)
+	buf = strconv.AppendInt(buf, int64(S.Index), 10)
+	if S.Aval != 0 {
+		buf = append(buf, `,"aval":`...)
+		buf = strconv.AppendInt(buf, int64(S.Aval), 10)
+	}
+	if S.Entered {
+		buf = append(buf, `,"entered":true`...)
+	}
+	if S.Bval != 0 {
+		buf = append(buf, `,"bval":`...)
+		buf = strconv.AppendInt(buf, int64(S.Bval), 10)
+	}
+	if len(S.Bsrc) > 0 {
+		buf = append(buf, `,"bsrc":[`...)
+		for i, gid := range S.Bsrc {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, `{"gtype":`...)
+			buf = appendJSONString(buf, gid.Gtype)
+			buf = append(buf, `,"index":`...)
+			buf = strconv.AppendInt(buf, int64(gid.Index), 10)
+			buf = append(buf, '}')
+		}
+		buf = append(buf, ']')
+	}
+	if len(S.Pvals) > 0 {
+		buf = append(buf, `,"pvals":`...)
+		buf = appendJSONInts(buf, S.Pvals)
+	}
+	if len(S.Marks) > 0 {
+		buf = append(buf, `,"marks":`...)
+		buf = appendJSONInts(buf, S.Marks)
+	}
+	return append(buf, '}')
+}
+
+// MarshalJSON encodes the Square using AppendJSON.
+func (S Square) MarshalJSON() ([]byte, error) {
+	return S.AppendJSON(nil), nil
+}
+
+// AppendJSON appends the JSON encoding of the Content to the
+// buffer, and returns the extended buffer.  The only Errors come
+// from encoding the Content's Errors.
+func (c *Content) AppendJSON(buf []byte) ([]byte, error) {
+	buf = append(buf, `{"squares":`...)
+	if c.Squares == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i := range c.Squares {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = c.Squares[i].AppendJSON(buf)
+		}
+		buf = append(buf, ']')
+	}
+	if len(c.Errors) > 0 {
+		var e error
+		buf = append(buf, `,"errors":`...)
+		if buf, e = appendJSONErrors(buf, c.Errors); e != nil {
+			return nil, e
+		}
+	}
+	return append(buf, '}'), nil
+}
+
+// MarshalJSON encodes the Content using AppendJSON.
+func (c Content) MarshalJSON() ([]byte, error) {
+	return c.AppendJSON(nil)
+}
+
+// AppendJSON appends the JSON encoding of the Summary to the
+// buffer, and returns the extended buffer.  The encoding ends
+// with the SummarySchema it follows.  The only Errors come
+// from encoding the Summary's Info, Errors, Journal,
+// Annotations, and Constraints.
+func (s *Summary) AppendJSON(buf []byte) ([]byte, error) {
+	var e error
+	buf = append(buf, '{')
+	if len(s.Metadata) > 0 {
+		buf = append(buf, `"metadata":{`...)
+		keys := make([]string, 0, len(s.Metadata))
+		for k := range s.Metadata {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, k)
+			buf = append(buf, ':')
+			buf = appendJSONString(buf, s.Metadata[k])
+		}
+		buf = append(buf, "},"...)
+	}
+	if s.Info != nil {
+		buf = append(buf, `"info":`...)
+		if buf, e = appendJSONValue(buf, s.Info); e != nil {
+			return nil, e
+		}
+		buf = append(buf, ',')
+	}
+	buf = append(buf, `"geometry":`...)
+	buf = appendJSONString(buf, s.Geometry)
+	buf = append(buf, `,"sidelen":`...)
+	buf = strconv.AppendInt(buf, int64(s.SideLength), 10)
+	if len(s.Values) > 0 {
+		buf = append(buf, `,"values":`...)
+		buf = appendJSONInts(buf, s.Values)
+	}
+	if len(s.Errors) > 0 {
+		buf = append(buf, `,"errors":`...)
+		if buf, e = appendJSONErrors(buf, s.Errors); e != nil {
+			return nil, e
+		}
+	}
+	if s.Journal != nil {
+		buf = append(buf, `,"journal":`...)
+		if buf, e = appendJSONValue(buf, s.Journal); e != nil {
+			return nil, e
+		}
+	}
+	if len(s.Marks) > 0 {
+		// encoding/json sorts map keys by their string form
+		keys := make([]string, 0, len(s.Marks))
+		for k := range s.Marks {
+			keys = append(keys, strconv.Itoa(k))
+		}
+		slices.Sort(keys)
+		buf = append(buf, `,"marks":{`...)
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			idx, _ := strconv.Atoi(k)
+			buf = append(buf, '"')
+			buf = append(buf, k...)
+			buf = append(buf, `":`...)
+			buf = appendJSONInts(buf, s.Marks[idx])
+		}
+		buf = append(buf, '}')
+	}
+	if len(s.Entered) > 0 {
+		buf = append(buf, `,"entered":`...)
+		buf = appendJSONInts(buf, s.Entered)
+	}
+	if len(s.Annotations) > 0 {
+		buf = append(buf, `,"annotations":`...)
+		if buf, e = appendJSONValue(buf, s.Annotations); e != nil {
+			return nil, e
+		}
+	}
+	if len(s.Constraints) > 0 {
+		buf = append(buf, `,"constraints":`...)
+		if buf, e = appendJSONValue(buf, s.Constraints); e != nil {
+			return nil, e
+		}
+	}
+	buf = append(buf, `,"schema":`...)
+	buf = strconv.AppendInt(buf, SummarySchema, 10)
+	return append(buf, '}'), nil
+}
+
+// MarshalJSON encodes the Summary using AppendJSON.
+func (s Summary) MarshalJSON() ([]byte, error) {
+	return s.AppendJSON(nil)
+}
+
+// A jsonAppender can append its JSON encoding to a buffer.
+type jsonAppender interface {
+	AppendJSON(buf []byte) ([]byte, error)
+}
+
+// jsonBuffers holds buffers for encoding responses.
+var jsonBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// maxPooledJSONBuffer is the capacity beyond which buffers are
+// not returned to the pool, so one huge response doesn't pin
+// its buffer forever.
+const maxPooledJSONBuffer = 1 << 18
+
+// appendJSONInts appends a slice of ints as a JSON array (or
+// null, if the slice is nil).
+func appendJSONInts(buf []byte, vals []int) []byte {
+	if vals == nil {
+		return append(buf, "null"...)
+	}
+	buf = append(buf, '[')
+	for i, v := range vals {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(v), 10)
+	}
+	return append(buf, ']')
+}
+
+// appendJSONErrors appends a slice of Errors as a JSON array.
+func appendJSONErrors(buf []byte, errs []Error) ([]byte, error) {
+	buf = append(buf, '[')
+	for i := range errs {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		bytes, e := errs[i].MarshalJSON()
+		if e != nil {
+			return nil, e
+		}
+		buf = append(buf, bytes...)
+	}
+	return append(buf, ']'), nil
+}
+
+// appendJSONValue appends the usual JSON encoding of a value.
+func appendJSONValue(buf []byte, v any) ([]byte, error) {
+	bytes, e := json.Marshal(v)
+	if e != nil {
+		return nil, e
+	}
+	return append(buf, bytes...), nil
+}
+
+// appendJSONString appends a string as a JSON string, escaped
+// just as encoding/json escapes it: HTML characters and the
+// JavaScript line separators are escaped, and invalid UTF-8 is
+// replaced with the Unicode replacement character.
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\b':
+				buf = append(buf, '\\', 'b')
+			case '\f':
+				buf = append(buf, '\\', 'f')
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = utf8.AppendRune(buf, utf8.RuneError)
+		} else if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hex[r&0xF])
+		} else {
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
@@ -0,0 +1,177 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// The plain types have the fields of the encoded types but not
+// their methods, so encoding/json encodes them by reflection.
+type plainSquare Square
+
+type plainContent struct {
+	Squares []plainSquare `json:"squares"`
+	Errors  []Error       `json:"errors,omitempty"`
+}
+
+type plainSummary versionedSummary
+
+func plainContentOf(c *Content) plainContent {
+	pc := plainContent{Errors: c.Errors}
+	if c.Squares != nil {
+		pc.Squares = make([]plainSquare, len(c.Squares))
+		for i, S := range c.Squares {
+			pc.Squares[i] = plainSquare(S)
+		}
+	}
+	return pc
+}
+
+// a string that needs every kind of escaping
+const escapingString = "a\"b\\c<d>e&f\b\f\n\r\t\x01\x7f  \xfféz"
+
+func TestAppendJSONContent(t *testing.T) {
+	threeStar, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	conflicting, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	assigned, e := threeStar.copy().Assign(Choice{9, 7})
+	if e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	cases := []*Content{
+		threeStar.state(),
+		conflicting.state(),
+		assigned,
+		&Content{},
+		&Content{Squares: []Square{}},
+		&Content{Squares: []Square{
+			{Index: 1, Aval: 3, Entered: true},
+			{Index: 2, Bval: 4, Bsrc: []GroupID{{GtypeRow, 1}, {escapingString, 2}}, Pvals: intset{1, 4}, Marks: intset{1}},
+			{Index: 3, Pvals: intset{}, Marks: intset{}},
+		}},
+		&Content{Errors: []Error{{Scope: ArgumentScope, Message: escapingString}}},
+	}
+	for i, c := range cases {
+		expected, e := json.Marshal(plainContentOf(c))
+		if e != nil {
+			t.Fatalf("Case %d: encoding/json failed: %v", i, e)
+		}
+		got, e := c.AppendJSON([]byte("prefix"))
+		if e != nil {
+			t.Fatalf("Case %d: AppendJSON failed: %v", i, e)
+		}
+		if string(got) != "prefix"+string(expected) {
+			t.Errorf("Case %d: AppendJSON gave\n%s\nexpected\nprefix%s", i, got, expected)
+		}
+		marshaled, e := json.Marshal(c)
+		if e != nil || string(marshaled) != string(expected) {
+			t.Errorf("Case %d: Marshal gave %s, %v; expected %s", i, marshaled, e, expected)
+		}
+		var decoded Content
+		if e := json.Unmarshal(marshaled, &decoded); e != nil {
+			t.Errorf("Case %d: encoding doesn't decode: %v", i, e)
+		}
+	}
+}
+
+func TestAppendJSONSummary(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	if _, e := p.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	journal, e := p.Journal()
+	if e != nil {
+		t.Fatalf("Journal failed: %v", e)
+	}
+	info := &Info{Name: escapingString, Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Tags: []string{"x"}}
+	cases := []*Summary{
+		p.summary(),
+		&Summary{},
+		&Summary{
+			Metadata:   map[string]string{"b": escapingString, "a": "1", escapingString: ""},
+			Info:       info,
+			Geometry:   StandardGeometryName,
+			SideLength: 9,
+			Values:     threeStarValues,
+			Errors:     []Error{{Scope: ArgumentScope, Values: ErrorData{1, "x", intset{2}}}},
+			Journal:    journal,
+			Marks:      map[int][]int{2: {1, 3}, 10: {4}, 1: nil},
+			Entered:    []int{9},
+		},
+	}
+	for i, s := range cases {
+		expected, e := json.Marshal(plainSummary{summaryFields(*s), SummarySchema})
+		if e != nil {
+			t.Fatalf("Case %d: encoding/json failed: %v", i, e)
+		}
+		got, e := s.AppendJSON(nil)
+		if e != nil {
+			t.Fatalf("Case %d: AppendJSON failed: %v", i, e)
+		}
+		if string(got) != string(expected) {
+			t.Errorf("Case %d: AppendJSON gave\n%s\nexpected\n%s", i, got, expected)
+		}
+		marshaled, e := json.Marshal(s)
+		if e != nil || string(marshaled) != string(expected) {
+			t.Errorf("Case %d: Marshal gave %s, %v; expected %s", i, marshaled, e, expected)
+		}
+	}
+}
+
+func BenchmarkMarshalContent(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	c := plainContentOf(p.state())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, e := json.Marshal(c); e != nil {
+			b.Fatalf("Marshal failed: %v", e)
+		}
+	}
+}
+
+func BenchmarkAppendJSONContent(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	c := p.state()
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if buf, e = c.AppendJSON(buf[:0]); e != nil {
+			b.Fatalf("AppendJSON failed: %v", e)
+		}
+	}
+}
@@ -19,7 +19,9 @@
 package puzzle
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 )
 
 /*
@@ -41,6 +43,7 @@ type Error struct {
 	Attribute ErrorAttribute `json:"attribute,omitempty"`
 	Values    ErrorData      `json:"values,omitempty"`
 	Message   string         `json:"message,omitempty"` // custom message
+	cause     error          // underlying error, if any (see Unwrap)
 }
 
 // An ErrorScope explains what type of thing the error is
@@ -100,6 +103,21 @@ const (
 	WrongPuzzleSizeCondition
 	InvalidArgumentCondition
 	MismatchedSummaryErrorsCondition
+	UnknownEndpointCondition
+	MethodNotAllowedCondition
+	TooManyRequestsCondition
+	NotAuthorizedCondition
+	NotAssignedCondition
+	NothingToUndoCondition
+	NothingToRedoCondition
+	InvalidJournalCondition
+	UnknownCheckpointCondition
+	LockedGivenCondition
+	MismatchedGeometryCondition
+	CanceledCondition
+	ReservedKeyCondition
+	QuotaExceededCondition
+	ImpossibleSumCondition
 	MaxCondition
 )
 
@@ -126,6 +144,15 @@ const (
 	SideLengthAttribute
 	PuzzleAttribute
 	SummaryAttribute
+	CheckpointAttribute
+	MarkAttribute
+	GroupAttribute
+	MetadataAttribute
+	TechniqueAttribute
+	BranchAttribute
+	LimitAttribute
+	AnnotationAttribute
+	ConstraintAttribute
 	MaxAttribute
 )
 
@@ -143,7 +170,8 @@ type ErrorData []interface{}
 
 // Return an error string from an Error.  If the Error has a
 // pre-canned message, this will use it, otherwise it will
-// produce an appropriate (English, non-localized) message.
+// produce an appropriate (English, non-localized) message.  Use
+// Localize for messages in other languages.
 func (e Error) Error() string {
 	es := e.Message
 	if len(es) > 0 {
@@ -208,6 +236,24 @@ func (e Error) Error() string {
 			es += "Summary"
 		case SideLengthAttribute:
 			es += "Side length"
+		case CheckpointAttribute:
+			es += "Checkpoint"
+		case MarkAttribute:
+			es += "Mark"
+		case GroupAttribute:
+			es += "Group"
+		case MetadataAttribute:
+			es += "Metadata"
+		case TechniqueAttribute:
+			es += "Technique"
+		case BranchAttribute:
+			es += "Branch"
+		case LimitAttribute:
+			es += "Limit"
+		case AnnotationAttribute:
+			es += "Annotation"
+		case ConstraintAttribute:
+			es += "Constraint"
 		case LocationAttribute:
 			es += fmt.Sprintf("In puzzle.%v", nextVal())
 		default:
@@ -249,8 +295,274 @@ func (e Error) Error() string {
 		es += fmt.Sprintf("Required value was missing or invalid")
 	case MismatchedSummaryErrorsCondition:
 		es += fmt.Sprintf("Summary has errors but puzzle created from it does not")
+	case UnknownEndpointCondition:
+		es += fmt.Sprintf("No such endpoint")
+	case MethodNotAllowedCondition:
+		es += fmt.Sprintf("Method %v not allowed", nextVal())
+	case TooManyRequestsCondition:
+		es += fmt.Sprintf("Too many requests; retry after %v seconds", nextVal())
+	case NotAuthorizedCondition:
+		es += fmt.Sprintf("Authorization required")
+	case NotAssignedCondition:
+		es += fmt.Sprintf("Square has no assigned value")
+	case NothingToUndoCondition:
+		es += fmt.Sprintf("There are no moves to undo")
+	case NothingToRedoCondition:
+		es += fmt.Sprintf("There are no undone moves to redo")
+	case InvalidJournalCondition:
+		es += fmt.Sprintf("Journal doesn't match the puzzle's values")
+	case UnknownCheckpointCondition:
+		es += fmt.Sprintf("Not an open checkpoint")
+	case LockedGivenCondition:
+		es += fmt.Sprintf("Square's value is a given and must be unlocked first")
+	case MismatchedGeometryCondition:
+		es += fmt.Sprintf("Doesn't match the geometry of the other puzzle (%v)", nextVal())
+	case CanceledCondition:
+		es += fmt.Sprintf("Operation was stopped before it finished (%v)", nextVal())
+	case ReservedKeyCondition:
+		es += fmt.Sprintf("Key is reserved for use by the puzzle package")
+	case QuotaExceededCondition:
+		es += fmt.Sprintf("Exceeds the limit of %v", nextVal())
+	case ImpossibleSumCondition:
+		es += fmt.Sprintf("Values can't add up to %v", nextVal())
 	default:
 		es += fmt.Sprintf("Supplemental data is %v", values)
 	}
 	return es
 }
+
+/*
+
+Machine-readable codes
+
+The numeric error fields are stable in meaning but not in value
+(new constants can be added anywhere before the Max sentinels),
+so for clients that dispatch on errors we also provide a stable
+string code for each Error.  The code is the scope name, then
+(for attribute errors) the attribute name, then the condition
+name, separated by dots: e.g., "argument.index.too-large".
+
+*/
+
+var scopeNames = [...]string{
+	UnknownScope:  "unknown",
+	RequestScope:  "request",
+	ArgumentScope: "argument",
+	GeometryScope: "geometry",
+	GroupScope:    "group",
+	SquareScope:   "square",
+	InternalScope: "internal",
+}
+
+var attributeNames = [...]string{
+	UnknownAttribute:        "unknown",
+	DecodeAttribute:         "decode",
+	EncodeAttribute:         "encode",
+	URLAttribute:            "url",
+	LocationAttribute:       "location",
+	NamedAttribute:          "named",
+	GeometryAttribute:       "geometry",
+	IndexAttribute:          "index",
+	ValueAttribute:          "value",
+	AssignedValueAttribute:  "assigned-value",
+	BoundValueAttribute:     "bound-value",
+	RemovedValueAttribute:   "removed-value",
+	RemovedValuesAttribute:  "removed-values",
+	RetainedValuesAttribute: "retained-values",
+	PuzzleSizeAttribute:     "puzzle-size",
+	SideLengthAttribute:     "side-length",
+	PuzzleAttribute:         "puzzle",
+	SummaryAttribute:        "summary",
+	CheckpointAttribute:     "checkpoint",
+	MarkAttribute:           "mark",
+	GroupAttribute:          "group",
+	MetadataAttribute:       "metadata",
+	TechniqueAttribute:      "technique",
+	BranchAttribute:         "branch",
+	LimitAttribute:          "limit",
+	AnnotationAttribute:     "annotation",
+	ConstraintAttribute:     "constraint",
+}
+
+var conditionNames = [...]string{
+	UnknownCondition:                 "unknown",
+	GeneralCondition:                 "general",
+	TooLargeCondition:                "too-large",
+	TooSmallCondition:                "too-small",
+	DuplicateAssignmentCondition:     "duplicate-assignment",
+	NotInSetCondition:                "not-in-set",
+	NoPossibleValuesCondition:        "no-possible-values",
+	NoGroupValueCondition:            "no-group-value",
+	DuplicateGroupValuesCondition:    "duplicate-group-values",
+	UnknownGeometryCondition:         "unknown-geometry",
+	NonSquareCondition:               "non-square",
+	NonRectangularCondition:          "non-rectangular",
+	InvalidPuzzleAssignmentCondition: "invalid-puzzle-assignment",
+	WrongPuzzleSizeCondition:         "wrong-puzzle-size",
+	InvalidArgumentCondition:         "invalid-argument",
+	MismatchedSummaryErrorsCondition: "mismatched-summary-errors",
+	UnknownEndpointCondition:         "unknown-endpoint",
+	MethodNotAllowedCondition:        "method-not-allowed",
+	TooManyRequestsCondition:         "too-many-requests",
+	NotAuthorizedCondition:           "not-authorized",
+	NotAssignedCondition:             "not-assigned",
+	NothingToUndoCondition:           "nothing-to-undo",
+	NothingToRedoCondition:           "nothing-to-redo",
+	InvalidJournalCondition:          "invalid-journal",
+	UnknownCheckpointCondition:       "unknown-checkpoint",
+	LockedGivenCondition:             "locked-given",
+	MismatchedGeometryCondition:      "mismatched-geometry",
+	CanceledCondition:                "canceled",
+	ReservedKeyCondition:             "reserved-key",
+	QuotaExceededCondition:           "quota-exceeded",
+	ImpossibleSumCondition:           "impossible-sum",
+}
+
+// String returns the scope's code name.
+func (sc ErrorScope) String() string {
+	if sc >= 0 && int(sc) < len(scopeNames) {
+		return scopeNames[sc]
+	}
+	return scopeNames[UnknownScope]
+}
+
+// String returns the attribute's code name.
+func (at ErrorAttribute) String() string {
+	if at >= 0 && int(at) < len(attributeNames) {
+		return attributeNames[at]
+	}
+	return attributeNames[UnknownAttribute]
+}
+
+// String returns the condition's code name.
+func (co ErrorCondition) String() string {
+	if co >= 0 && int(co) < len(conditionNames) {
+		return conditionNames[co]
+	}
+	return conditionNames[UnknownCondition]
+}
+
+// Code returns the Error's stable machine-readable code.
+func (e Error) Code() string {
+	code := e.Scope.String()
+	if e.Structure == AttributeStructure || e.Structure == AttributeValueStructure {
+		code += "." + e.Attribute.String()
+	}
+	return code + "." + e.Condition.String()
+}
+
+// HTTPStatus returns the HTTP response status that goes with
+// the Error when it's sent to a web client.  Problems with the
+// request itself map to the matching 4xx status, problems with
+// the arguments or the puzzle map to 400, requests that were
+// stopped before they finished map to 503, and internal problems
+// map to 500.  Exceeded quotas map to 413 for request bodies,
+// 503 for concurrent jobs (which will free up), and 403 for the
+// rest.
+func (e Error) HTTPStatus() int {
+	if e.Condition == QuotaExceededCondition {
+		var limit interface{}
+		if len(e.Values) > 0 {
+			limit = e.Values[0]
+		}
+		switch limit {
+		case RequestBodyLimit:
+			return http.StatusRequestEntityTooLarge
+		case ConcurrentJobsLimit:
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusForbidden
+	}
+	switch e.Scope {
+	case RequestScope:
+		switch e.Condition {
+		case UnknownEndpointCondition:
+			return http.StatusNotFound
+		case MethodNotAllowedCondition:
+			return http.StatusMethodNotAllowed
+		case TooManyRequestsCondition:
+			return http.StatusTooManyRequests
+		case NotAuthorizedCondition:
+			return http.StatusUnauthorized
+		case CanceledCondition:
+			return http.StatusServiceUnavailable
+		}
+		if e.Attribute == URLAttribute {
+			return http.StatusNotFound
+		}
+		return http.StatusBadRequest
+	case ArgumentScope, GeometryScope, GroupScope, SquareScope:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// MarshalJSON encodes an Error with its code alongside its
+// other fields.  The code is for clients only; decoding ignores
+// it.
+func (e Error) MarshalJSON() ([]byte, error) {
+	type plainError Error
+	return json.Marshal(struct {
+		plainError
+		Code string `json:"code"`
+	}{plainError(e), e.Code()})
+}
+
+/*
+
+Matching errors
+
+Errors are values with codes, so the standard errors package
+can't tell one kind from another on its own.  The sentinels
+below give errors.Is something to match against for the kinds
+of failure that callers most often need to recognize.
+
+*/
+
+// A sentinelError is matched by any Error that its match
+// function accepts.
+type sentinelError struct {
+	msg   string
+	match func(e Error) bool
+}
+
+func (s *sentinelError) Error() string {
+	return s.msg
+}
+
+// Sentinel errors for use with errors.Is.
+var (
+	// ErrUnsolvable matches the errors that make a puzzle
+	// unsolvable: those found in its squares or groups.
+	ErrUnsolvable error = &sentinelError{"puzzle is unsolvable", func(e Error) bool {
+		return e.Scope == SquareScope || e.Scope == GroupScope
+	}}
+	// ErrDuplicateAssignment matches an assignment of a value
+	// that a peer square already has.
+	ErrDuplicateAssignment error = &sentinelError{"duplicate assignment", func(e Error) bool {
+		return e.Condition == DuplicateAssignmentCondition
+	}}
+	// ErrOutOfRange matches an argument that is too large or
+	// too small.
+	ErrOutOfRange error = &sentinelError{"argument out of range", func(e Error) bool {
+		return e.Scope == ArgumentScope &&
+			(e.Condition == TooLargeCondition || e.Condition == TooSmallCondition)
+	}}
+)
+
+// Is reports whether the Error matches target, which is one of
+// the package's sentinel errors, for use by errors.Is.
+func (e Error) Is(target error) bool {
+	if s, ok := target.(*sentinelError); ok {
+		return s.match(e)
+	}
+	return false
+}
+
+// Unwrap returns the error that caused this one, if any, such as
+// the context error behind a CanceledCondition.  Causes are not
+// serialized, so an Error decoded from JSON never has one.
+func (e Error) Unwrap() error {
+	return e.cause
+}
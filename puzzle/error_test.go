@@ -19,6 +19,11 @@
 package puzzle
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -51,3 +56,138 @@ func TestErrorNoPanicNoEmpty(t *testing.T) {
 		}
 	}
 }
+
+// Every scope, attribute, and condition must have a distinct code
+// name, so codes are unambiguous.
+func TestErrorCodeNames(t *testing.T) {
+	if len(scopeNames) != int(MaxScope) {
+		t.Errorf("%d scope names for %d scopes", len(scopeNames), MaxScope)
+	}
+	if len(attributeNames) != int(MaxAttribute) {
+		t.Errorf("%d attribute names for %d attributes", len(attributeNames), MaxAttribute)
+	}
+	if len(conditionNames) != int(MaxCondition) {
+		t.Errorf("%d condition names for %d conditions", len(conditionNames), MaxCondition)
+	}
+	for _, names := range [][]string{scopeNames[:], attributeNames[:], conditionNames[:]} {
+		seen := make(map[string]bool)
+		for i, name := range names {
+			if name == "" || seen[name] {
+				t.Errorf("Code name %d (%q) is empty or duplicated", i, name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func TestErrorCodeAndStatus(t *testing.T) {
+	cases := []struct {
+		err    Error
+		code   string
+		status int
+	}{
+		{rangeError(IndexAttribute, 0, 1, 81), "argument.index.too-small", http.StatusBadRequest},
+		{groupError(GroupID{GtypeRow, 1}, 3, NoGroupValueCondition), "group.no-group-value", http.StatusBadRequest},
+		{RequestError(UnknownEndpointCondition, "/api/nosuch"), "request.url.unknown-endpoint", http.StatusNotFound},
+		{RequestError(MethodNotAllowedCondition, "/api/state", "PUT"), "request.url.method-not-allowed",
+			http.StatusMethodNotAllowed},
+		{RequestError(TooManyRequestsCondition, "/api/state", 2), "request.url.too-many-requests",
+			http.StatusTooManyRequests},
+		{RequestError(NotAuthorizedCondition, "/admin/"), "request.url.not-authorized", http.StatusUnauthorized},
+		{DecodeError(json.Unmarshal([]byte("{"), new(int))), "request.decode.general", http.StatusBadRequest},
+		{InternalError("test", "failure"), "internal.location.general", http.StatusInternalServerError},
+		{Error{Scope: MaxScope + 3, Condition: MaxCondition + 1}, "unknown.unknown", http.StatusInternalServerError},
+	}
+	for i, c := range cases {
+		if code := c.err.Code(); code != c.code {
+			t.Errorf("Case %d: code is %q, expected %q", i, code, c.code)
+		}
+		if status := c.err.HTTPStatus(); status != c.status {
+			t.Errorf("Case %d: status is %d, expected %d", i, status, c.status)
+		}
+	}
+}
+
+func TestErrorJSONCode(t *testing.T) {
+	err := RequestError(MethodNotAllowedCondition, "/api/state", "PUT")
+	err.Message = err.Error()
+	bytes, e := json.Marshal(err)
+	if e != nil {
+		t.Fatalf("Couldn't encode error: %v", e)
+	}
+	if !strings.Contains(string(bytes), `"code":"request.url.method-not-allowed"`) {
+		t.Errorf("Encoded error has no code: %s", bytes)
+	}
+	var decoded Error
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Couldn't decode error: %v", e)
+	}
+	if decoded.Code() != err.Code() || decoded.Message != err.Message {
+		t.Errorf("Decoded error %+v doesn't match %+v", decoded, err)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	testcases := []struct {
+		err                       Error
+		unsolvable, dup, outRange bool
+	}{
+		{Error{Scope: SquareScope, Condition: NoPossibleValuesCondition}, true, false, false},
+		{Error{Scope: SquareScope, Condition: DuplicateAssignmentCondition}, true, true, false},
+		{Error{Scope: GroupScope, Condition: DuplicateGroupValuesCondition}, true, false, false},
+		{rangeError(IndexAttribute, 17, 1, 16), false, false, true},
+		{rangeError(IndexAttribute, 0, 1, 16), false, false, true},
+		{argumentError(PuzzleAttribute, InvalidArgumentCondition), false, false, false},
+	}
+	for i, tc := range testcases {
+		var e error = tc.err
+		if errors.Is(e, ErrUnsolvable) != tc.unsolvable ||
+			errors.Is(e, ErrDuplicateAssignment) != tc.dup ||
+			errors.Is(e, ErrOutOfRange) != tc.outRange {
+			t.Errorf("Case %d: %v matched the wrong sentinels", i, e)
+		}
+	}
+
+	// errors from the API match, and can be extracted with As
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	_, e = p.Assign(Choice{17, 1})
+	if !errors.Is(e, ErrOutOfRange) {
+		t.Errorf("Out of range assignment gave %v, which isn't ErrOutOfRange", e)
+	}
+	var err Error
+	if !errors.As(e, &err) || err.Attribute != IndexAttribute {
+		t.Errorf("Couldn't extract an index Error from %v", e)
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, e := NewContext(ctx, &Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if !errors.Is(e, context.Canceled) {
+		t.Errorf("Canceled creation gave %v, which doesn't wrap context.Canceled", e)
+	}
+
+	cause := errors.New("rejected")
+	MetadataValidator = func(key, value string) error {
+		return cause
+	}
+	defer func() { MetadataValidator = nil }()
+	e = validateMetadata(map[string]string{"k": "v"}, false)
+	if !errors.Is(e, cause) {
+		t.Errorf("Rejected metadata gave %v, which doesn't wrap the validator's error", e)
+	}
+
+	// causes don't survive serialization
+	bytes, _ := json.Marshal(e)
+	var decoded Error
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatalf("Failed to decode %s: %v", bytes, err)
+	}
+	if decoded.Unwrap() != nil {
+		t.Errorf("Decoded error has a cause: %v", decoded.Unwrap())
+	}
+}
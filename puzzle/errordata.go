@@ -0,0 +1,207 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+
+Error value serialization
+
+Plain JSON has no way to say what type a value is, so an Error
+whose Values went through a JSON round trip used to come back
+with float64s where it had ints and maps where it had GroupIDs,
+and no longer compared equal to the Error it started as.  So
+each value is encoded with a tag giving its type, and decoded
+back into that type.  Values of types the package doesn't know
+are encoded as plain JSON (tagged "json"), and decode the way
+encoding/json decodes into an interface{}.
+
+Decoding also accepts the old, untagged form, converting whole
+numbers to ints and group-shaped objects to GroupIDs.
+
+*/
+
+// The type tags of encoded ErrorData values.
+const (
+	nullValueType   = "null"
+	intValueType    = "int"
+	floatValueType  = "float"
+	boolValueType   = "bool"
+	stringValueType = "string"
+	groupValueType  = "group"
+	intsetValueType = "intset"
+	intsValueType   = "ints"
+	errorsValueType = "errors"
+	timeValueType   = "time"
+	jsonValueType   = "json"
+)
+
+// A typedValue is the encoded form of an ErrorData value.
+type typedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MarshalJSON encodes each value along with a tag for its type.
+func (ed ErrorData) MarshalJSON() ([]byte, error) {
+	tvs := make([]typedValue, len(ed))
+	for i, v := range ed {
+		var tag string
+		switch v.(type) {
+		case nil:
+			tvs[i] = typedValue{Type: nullValueType}
+			continue
+		case int:
+			tag = intValueType
+		case float64:
+			tag = floatValueType
+		case bool:
+			tag = boolValueType
+		case string:
+			tag = stringValueType
+		case GroupID:
+			tag = groupValueType
+		case intset:
+			tag = intsetValueType
+		case []int:
+			tag = intsValueType
+		case []Error:
+			tag = errorsValueType
+		case time.Time:
+			tag = timeValueType
+		default:
+			tag = jsonValueType
+		}
+		bytes, e := json.Marshal(v)
+		if e != nil {
+			return nil, e
+		}
+		tvs[i] = typedValue{tag, bytes}
+	}
+	return json.Marshal(tvs)
+}
+
+// UnmarshalJSON decodes values encoded by MarshalJSON, or values
+// in the old untagged form.
+func (ed *ErrorData) UnmarshalJSON(bytes []byte) error {
+	var raws []json.RawMessage
+	if e := json.Unmarshal(bytes, &raws); e != nil {
+		return e
+	}
+	if raws == nil {
+		*ed = nil
+		return nil
+	}
+	vals := make(ErrorData, len(raws))
+	for i, raw := range raws {
+		var tv typedValue
+		if e := json.Unmarshal(raw, &tv); e != nil || tv.Type == "" {
+			// not a tagged value, so it's in the old form
+			v, e := decodeUntypedValue(raw)
+			if e != nil {
+				return e
+			}
+			vals[i] = v
+			continue
+		}
+		v, e := decodeTypedValue(tv)
+		if e != nil {
+			return e
+		}
+		vals[i] = v
+	}
+	*ed = vals
+	return nil
+}
+
+// decodeTypedValue returns the value of the tagged type.
+func decodeTypedValue(tv typedValue) (interface{}, error) {
+	var e error
+	switch tv.Type {
+	case nullValueType:
+		return nil, nil
+	case intValueType:
+		var v int
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case floatValueType:
+		var v float64
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case boolValueType:
+		var v bool
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case stringValueType:
+		var v string
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case groupValueType:
+		var v GroupID
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case intsetValueType:
+		var v intset
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case intsValueType:
+		var v []int
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case errorsValueType:
+		var v []Error
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case timeValueType:
+		var v time.Time
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	case jsonValueType:
+		var v interface{}
+		e = json.Unmarshal(tv.Value, &v)
+		return v, e
+	}
+	return nil, fmt.Errorf("unknown error value type %q", tv.Type)
+}
+
+// decodeUntypedValue decodes a value in the old form, where
+// only its JSON shape is known.
+func decodeUntypedValue(raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	if e := json.Unmarshal(raw, &v); e != nil {
+		return nil, e
+	}
+	switch v := v.(type) {
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case map[string]interface{}:
+		var gid GroupID
+		if _, ok := v["gtype"]; ok && len(v) == 2 && json.Unmarshal(raw, &gid) == nil {
+			return gid, nil
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,108 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestErrorDataRoundTrip(t *testing.T) {
+	when := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	inner := Error{Scope: GroupScope, Structure: ScopeStructure, Condition: NoGroupValueCondition,
+		Values: ErrorData{GroupID{GtypeTile, 2}, 1}}
+	err := Error{
+		Scope:     SquareScope,
+		Structure: AttributeValueStructure,
+		Attribute: AssignedValueAttribute,
+		Condition: NotInSetCondition,
+		Values: ErrorData{3, "three", 2.5, true, nil, GroupID{GtypeRow, 1},
+			intset{1, 4}, []int{2, 3}, []Error{inner}, when},
+		Message: "test error",
+	}
+	bytes, e := json.Marshal(err)
+	if e != nil {
+		t.Fatalf("Failed to encode %+v: %v", err, e)
+	}
+	var decoded Error
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode %s: %v", bytes, e)
+	}
+	if !reflect.DeepEqual(decoded, err) {
+		t.Errorf("Round trip of %+v gave %+v", err, decoded)
+	}
+
+	// values of unknown types decode as plain JSON
+	bytes, e = json.Marshal(ErrorData{map[string]int{"a": 1}})
+	if e != nil {
+		t.Fatalf("Failed to encode a map value: %v", e)
+	}
+	var ed ErrorData
+	if e := json.Unmarshal(bytes, &ed); e != nil {
+		t.Fatalf("Failed to decode %s: %v", bytes, e)
+	}
+	if !reflect.DeepEqual(ed, ErrorData{map[string]interface{}{"a": 1.0}}) {
+		t.Errorf("Map value decoded as %#v", ed)
+	}
+
+	// unknown tags are rejected
+	if e := json.Unmarshal([]byte(`[{"type":"bogus","value":1}]`), &ed); e == nil {
+		t.Errorf("Decoded a value with an unknown tag: %#v", ed)
+	}
+}
+
+func TestErrorDataUntyped(t *testing.T) {
+	var ed ErrorData
+	data := `[3, 2.5, "x", {"gtype":"row","index":1}, {"other":1}, [1,2], null]`
+	if e := json.Unmarshal([]byte(data), &ed); e != nil {
+		t.Fatalf("Failed to decode %s: %v", data, e)
+	}
+	expect := ErrorData{3, 2.5, "x", GroupID{GtypeRow, 1},
+		map[string]interface{}{"other": 1.0}, []interface{}{1.0, 2.0}, nil}
+	if !reflect.DeepEqual(ed, expect) {
+		t.Errorf("Untyped values decoded as %#v, expected %#v", ed, expect)
+	}
+}
+
+func TestErrorSummaryRoundTrip(t *testing.T) {
+	bad, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1})
+	if e != nil {
+		t.Fatalf("Creation of conflicting4Puzzle1 failed: %v", e)
+	}
+	if len(bad.errors) == 0 {
+		t.Fatalf("conflicting4Puzzle1 has no errors")
+	}
+	bytes, e := json.Marshal(bad.summary())
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var summary Summary
+	if e := json.Unmarshal(bytes, &summary); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	q, e := New(&summary)
+	if e != nil {
+		t.Fatalf("Failed to recreate puzzle from summary: %v", e)
+	}
+	if !reflect.DeepEqual(q.allErrors(true), bad.allErrors(true)) {
+		t.Errorf("Errors were %+v, expected %+v", q.allErrors(true), bad.allErrors(true))
+	}
+}
@@ -0,0 +1,138 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Explaining errors
+
+When a puzzle has become unsolvable, the move that broke it is
+often well before the one where a group got a duplicate value
+or a square ran out of candidates.  Walking the puzzle's
+history backward, taking back one move at a time until the
+puzzle is solvable again, finds the earliest move after which
+the puzzle could never be solved: the move that doomed it.  If
+the puzzle hasn't violated a constraint yet, making the
+placements that are forced from where it is now shows which
+constraint it eventually violates.
+
+*/
+
+// An ErrorExplanation traces an unsolvable puzzle back to the
+// move that doomed it.  Position is the 1-based position of the
+// move in the puzzle's history; both are empty if the puzzle was
+// unsolvable before any moves were made.  Expected is the value
+// the move's square had in a solution just before the move.
+// Forced are the placements, from the puzzle as it is, that lead
+// to the Violations; there are none if the puzzle already has
+// errors.  If the puzzle can only be shown unsolvable by making
+// choices, there are no Violations.
+type ErrorExplanation struct {
+	Move       *Move    `json:"move,omitempty"`
+	Position   int      `json:"position,omitempty"`
+	Expected   int      `json:"expected,omitempty"`
+	Forced     []Choice `json:"forced,omitempty"`
+	Violations []Error  `json:"violations,omitempty"`
+}
+
+// ExplainError explains why the puzzle is unsolvable.  If the
+// puzzle can still be solved, there is nothing to explain, and
+// the explanation is nil.  The puzzle is not altered.
+func (p *Puzzle) ExplainError() (*ErrorExplanation, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if ok, _ := solvable(p); ok {
+		return nil, nil
+	}
+	moves, _ := p.History()
+	x := &ErrorExplanation{}
+
+	// walk backward through the history until solvable
+	c, release := p.scratchCopy()
+	defer release()
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		if m.Action == UnassignAction {
+			c.assign(m.Index, m.Value)
+		} else {
+			c.unassign(m.Index)
+		}
+		if ok, solution := solvable(c); ok {
+			x.Move, x.Position = &moves[i], i+1
+			if m.Action == AssignAction {
+				x.Expected = solution[m.Index-1]
+			}
+			break
+		}
+	}
+
+	// find the violated constraints
+	if len(p.errors) > 0 {
+		x.Violations = p.allErrors(true)
+		return x, nil
+	}
+	q, release := p.scratchCopy()
+	defer release()
+	for len(q.errors) == 0 {
+		choice, ok := forcedChoice(q)
+		if !ok {
+			break
+		}
+		x.Forced = append(x.Forced, choice)
+		q.assign(choice.Index, choice.Value)
+	}
+	x.Violations = q.allErrors(true)
+	return x, nil
+}
+
+// solvable reports whether the puzzle has a solution, and if so
+// returns the values of one.  The puzzle is not altered.
+func solvable(p *Puzzle) (bool, []int) {
+	if len(p.errors) > 0 {
+		return false, nil
+	}
+	q, release := p.scratchCopy()
+	defer release()
+	q.begin()
+	s, _ := solve(q, nil)
+	if len(s.errors) > 0 {
+		return false, nil
+	}
+	return true, s.allValues()
+}
+
+// forcedChoice finds an empty square whose value is forced,
+// either because it has only one candidate or because a group
+// binds it.
+func forcedChoice(p *Puzzle) (Choice, bool) {
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		if s.aval != 0 {
+			continue
+		}
+		if s.pvals.len() == 1 {
+			return Choice{i, s.pvals.min()}, true
+		}
+		if s.bval != 0 {
+			return Choice{i, s.bval}, true
+		}
+	}
+	return Choice{}, false
+}
@@ -0,0 +1,145 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"testing"
+)
+
+func TestExplainError(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	solution := p.allSolutions()[0].Values
+	if x, e := p.ExplainError(); x != nil || e != nil {
+		t.Fatalf("Solvable puzzle explanation is %+v (%v)", x, e)
+	}
+
+	// find empty squares and a wrong candidate for one of them
+	var empty []int
+	for i := 1; i <= p.mapping.scount; i++ {
+		if p.squares[i].aval == 0 {
+			empty = append(empty, i)
+		}
+	}
+	wrong := func(idx int) Choice {
+		for v := range p.squares[idx].pvals.values() {
+			if v != solution[idx-1] {
+				return Choice{idx, v}
+			}
+		}
+		t.Fatalf("Square %d has no wrong candidates", idx)
+		return Choice{}
+	}
+	var bad Choice
+	for _, idx := range empty {
+		if p.squares[idx].pvals.len() > 1 {
+			bad = wrong(idx)
+			break
+		}
+	}
+
+	// a wrong move that's taken back doesn't count
+	if _, e := p.Assign(bad); e != nil {
+		t.Fatalf("Failed to assign %v: %v", bad, e)
+	}
+	if _, e := p.Unassign(bad.Index); e != nil {
+		t.Fatalf("Failed to unassign %v: %v", bad, e)
+	}
+	good := Choice{empty[0], solution[empty[0]-1]}
+	if good.Index == bad.Index {
+		good = Choice{empty[1], solution[empty[1]-1]}
+	}
+	for _, c := range []Choice{good, bad} {
+		if _, e := p.Assign(c); e != nil {
+			t.Fatalf("Failed to assign %v: %v", c, e)
+		}
+	}
+	// later moves, while they're allowed, don't count either
+	moves := 4
+	for _, idx := range empty {
+		if len(p.errors) > 0 || moves == 6 {
+			break
+		}
+		if p.squares[idx].aval == 0 && p.squares[idx].pvals.len() > 0 {
+			if _, e := p.Assign(Choice{idx, p.squares[idx].pvals.min()}); e != nil {
+				t.Fatalf("Failed to assign to square %d: %v", idx, e)
+			}
+			moves++
+		}
+	}
+
+	x, e := p.ExplainError()
+	if e != nil || x == nil {
+		t.Fatalf("Unsolvable puzzle explanation is %+v (%v)", x, e)
+	}
+	if x.Move == nil || x.Move.Index != bad.Index || x.Move.Value != bad.Value || x.Position != 4 {
+		t.Errorf("Dooming move is %+v at %d, expected %v at 4", x.Move, x.Position, bad)
+	}
+	if x.Expected != solution[bad.Index-1] {
+		t.Errorf("Expected value is %d, expected %d", x.Expected, solution[bad.Index-1])
+	}
+	if len(x.Violations) == 0 {
+		t.Errorf("No violations after forced placements %v", x.Forced)
+	}
+	for _, v := range x.Violations {
+		if v.Message == "" {
+			t.Errorf("Violation %+v has no message", v)
+		}
+	}
+	if h, _ := p.History(); len(h) != moves {
+		t.Errorf("Explaining changed the history to %v", h)
+	}
+
+	// a puzzle with no moves has no dooming move
+	q, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: p.allValues()})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if x, e := q.ExplainError(); e != nil || x == nil || x.Move != nil || x.Position != 0 {
+		t.Errorf("Unsolvable puzzle with no moves has explanation %+v (%v)", x, e)
+	}
+
+	// a wrong move that doesn't break a constraint right away
+	// is explained by the placements it forces
+	found := false
+	for _, idx := range empty {
+		r, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+		for v := range r.squares[idx].pvals.values() {
+			if v != solution[idx-1] && !found {
+				r.Assign(Choice{idx, v})
+				if len(r.errors) > 0 {
+					break
+				}
+				found = true
+				x, e := r.ExplainError()
+				if e != nil || x == nil || x.Position != 1 || len(x.Forced) == 0 || len(x.Violations) == 0 {
+					t.Errorf("Explanation of wrong move in square %d is %+v (%v)", idx, x, e)
+				}
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		t.Errorf("Every wrong move breaks a constraint right away")
+	}
+}
@@ -0,0 +1,308 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+// Package generator makes new puzzles with unique solutions, at
+// a requested difficulty, for programs that serve puzzles
+// without a library of them.
+package generator
+
+import (
+	"context"
+	"fmt"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"math/rand"
+	"strconv"
+)
+
+/*
+
+Generation
+
+A puzzle is generated in three steps.  First a full solution is
+found by giving an empty puzzle a few random clues and solving
+it.  Then clues are removed from the solution in random order,
+keeping each removal only if the puzzle still has a unique
+solution, until no more can be removed (or the requested number
+of clues is left).  Finally, if the solver rates the puzzle
+harder than requested, clues from the solution are given back
+until it's easy enough.  Puzzles that end up easier than
+requested are thrown away and the steps are tried again.
+
+All the randomness comes from the seed, so the same arguments
+always generate the same puzzle.
+
+*/
+
+// A Level is a difficulty to generate a puzzle at: one of the
+// solver's 1- to 5-star ratings, or any rating at all.
+type Level int
+
+// The levels, easiest first.
+const (
+	AnyLevel Level = iota // whatever the fewest clues make it
+	OneStar
+	TwoStar
+	ThreeStar
+	FourStar
+	FiveStar
+	MaxLevel
+)
+
+// Levels implement Stringer
+func (l Level) String() string {
+	if l > AnyLevel && l < MaxLevel {
+		return strconv.Itoa(int(l)) + "-star"
+	}
+	return "any"
+}
+
+// DifficultyMetadataKey is the metadata key that holds the
+// solver's rating of a generated puzzle.
+const DifficultyMetadataKey = puzzle.ReservedMetadataPrefix + "difficulty"
+
+// levelAttempts is how many puzzles are generated while looking
+// for one at the requested level.
+var levelAttempts = 50
+
+// solutionAttempts is how many sets of random clues are tried
+// while looking for a full solution.  Random clues almost always
+// have a solution, so running out means something is wrong with
+// the geometry.
+var solutionAttempts = 20
+
+// Options are the settings for GenerateOptions.  Easiest and
+// Hardest give the range of acceptable levels, where AnyLevel
+// means no limit at that end.  Clues is how many clues to leave
+// in the puzzle, if it can have that many and still be unique
+// and at an acceptable level; 0 means as few as possible.
+type Options struct {
+	Easiest, Hardest Level
+	Clues            int
+}
+
+// Generate makes a puzzle of the given geometry and side length
+// with a unique solution, at the given difficulty level, using
+// randomness from the given seed.  The measured difficulty is
+// in the result's Metadata under DifficultyMetadataKey.  It's an
+// Error if the geometry and side length aren't a valid puzzle,
+// or if the level isn't one of the defined levels, and an error
+// if no puzzle at the level was found.
+func Generate(geometry string, sidelen int, difficulty Level, seed int64) (*puzzle.Summary, error) {
+	return GenerateContext(context.Background(), geometry, sidelen, difficulty, seed)
+}
+
+// GenerateContext is Generate with a context.  If the context is
+// done before the puzzle is, generation stops and an Error with
+// CanceledCondition is returned.  Generating big puzzles can take
+// a long time, so servers should give it a deadline.
+func GenerateContext(ctx context.Context, geometry string, sidelen int, difficulty Level, seed int64) (*puzzle.Summary, error) {
+	return GenerateOptions(ctx, geometry, sidelen, Options{Easiest: difficulty, Hardest: difficulty}, seed)
+}
+
+// GenerateOptions is GenerateContext with a range of levels and
+// a number of clues; see Options.  It's an Error if either end
+// of the range isn't a defined level or the range is backwards.
+func GenerateOptions(ctx context.Context, geometry string, sidelen int, opts Options, seed int64) (*puzzle.Summary, error) {
+	for _, l := range []Level{opts.Easiest, opts.Hardest} {
+		if l < AnyLevel || l >= MaxLevel {
+			return nil, levelError(l)
+		}
+	}
+	if opts.Hardest != AnyLevel && opts.Easiest > opts.Hardest {
+		return nil, levelError(opts.Easiest)
+	}
+	g := &generator{ctx: ctx, geometry: geometry, sidelen: sidelen, rng: rand.New(rand.NewSource(seed))}
+	for attempt := 0; attempt < levelAttempts; attempt++ {
+		solution, err := g.solution()
+		if err != nil {
+			return nil, err
+		}
+		values := append([]int(nil), solution...)
+		if _, err := Minimize(ctx, g.summary(values), g.rng.Perm(len(values)), opts.Clues); err != nil {
+			return nil, err
+		}
+		rating, err := g.rate(values)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range g.rng.Perm(len(values)) {
+			if opts.Hardest == AnyLevel || rating <= int(opts.Hardest) {
+				break
+			}
+			if values[i] == 0 {
+				values[i] = solution[i]
+				if rating, err = g.rate(values); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if rating >= int(opts.Easiest) && (opts.Hardest == AnyLevel || rating <= int(opts.Hardest)) {
+			summary := g.summary(values)
+			summary.Metadata = map[string]string{DifficultyMetadataKey: strconv.Itoa(rating)}
+			return summary, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s puzzle found in %d attempts", levelRange(opts), levelAttempts)
+}
+
+// levelError is the Error for a level that can't be generated.
+func levelError(l Level) error {
+	return puzzle.Error{
+		Scope:     puzzle.ArgumentScope,
+		Structure: puzzle.AttributeValueStructure,
+		Attribute: puzzle.NamedAttribute,
+		Condition: puzzle.InvalidArgumentCondition,
+		Values:    puzzle.ErrorData{"difficulty", int(l)},
+	}
+}
+
+// levelRange describes the levels in the options.
+func levelRange(opts Options) string {
+	if opts.Easiest == opts.Hardest {
+		return opts.Easiest.String()
+	}
+	return opts.Easiest.String() + " to " + opts.Hardest.String()
+}
+
+// Minimize removes clues from the summary's values, in place,
+// trying the squares in the given order and keeping each removal
+// only if the puzzle still has a unique solution, until only the
+// given number of clues is left (0 to remove as many as can be).
+// It returns the indexes of the squares whose clues were
+// removed.  It's an error if the puzzle doesn't have a unique
+// solution to start with.
+func Minimize(ctx context.Context, summary *puzzle.Summary, order []int, clues int) ([]int, error) {
+	unique := func() (bool, error) {
+		p, err := puzzle.NewContext(ctx, summary)
+		if err != nil {
+			return false, err
+		}
+		solutions, err := p.SolveContext(ctx, 2)
+		return len(solutions) == 1, err
+	}
+	if ok, err := unique(); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("puzzle doesn't have a unique solution")
+	}
+	remaining := 0
+	for _, v := range summary.Values {
+		if v != 0 {
+			remaining++
+		}
+	}
+	var removed []int
+	for _, i := range order {
+		if remaining <= clues {
+			break
+		}
+		v := summary.Values[i]
+		if v == 0 {
+			continue
+		}
+		summary.Values[i] = 0
+		if ok, err := unique(); err != nil {
+			return nil, err
+		} else if ok {
+			remaining--
+			removed = append(removed, i)
+		} else {
+			summary.Values[i] = v
+		}
+	}
+	return removed, nil
+}
+
+// A generator holds what's shared by the steps of generating a
+// puzzle.
+type generator struct {
+	ctx      context.Context
+	geometry string
+	sidelen  int
+	rng      *rand.Rand
+}
+
+// summary returns a summary of a puzzle with the given values.
+func (g *generator) summary(values []int) *puzzle.Summary {
+	return &puzzle.Summary{
+		Geometry:   g.geometry,
+		SideLength: g.sidelen,
+		Values:     values,
+	}
+}
+
+// solution returns the values of a random full solution.  A
+// side length's worth of random clues are assigned to an empty
+// puzzle, which is then solved; clues that leave it unsolvable
+// are thrown away and new ones are tried, up to
+// solutionAttempts times.
+func (g *generator) solution() ([]int, error) {
+	for attempt := 0; attempt < solutionAttempts; attempt++ {
+		p, err := puzzle.NewContext(g.ctx, g.summary(make([]int, g.sidelen*g.sidelen)))
+		if err != nil {
+			return nil, err
+		}
+		state, err := p.State()
+		if err != nil {
+			return nil, err
+		}
+		squares := state.Squares
+		for _, i := range g.rng.Perm(len(squares))[:g.sidelen] {
+			sq := squares[i]
+			if sq.Aval != 0 || len(sq.Pvals) == 0 {
+				continue
+			}
+			choice := puzzle.Choice{Index: sq.Index, Value: sq.Pvals[g.rng.Intn(len(sq.Pvals))]}
+			update, err := p.Assign(choice)
+			if err != nil {
+				return nil, err
+			}
+			if len(update.Errors) > 0 {
+				break
+			}
+			for _, sq := range update.Squares {
+				squares[sq.Index-1] = sq
+			}
+		}
+		solutions, err := p.SolveContext(g.ctx, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(solutions) > 0 {
+			return solutions[0].Values, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s puzzle of side %d found in %d attempts", g.geometry, g.sidelen, solutionAttempts)
+}
+
+// rate returns the solver's rating of the puzzle with the given
+// values.
+func (g *generator) rate(values []int) (int, error) {
+	p, err := puzzle.NewContext(g.ctx, g.summary(values))
+	if err != nil {
+		return 0, err
+	}
+	solutions, err := p.SolveContext(g.ctx, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(solutions) == 0 {
+		return 0, fmt.Errorf("generated puzzle has no solution")
+	}
+	return solutions[0].Rating, nil
+}
@@ -0,0 +1,181 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package generator
+
+import (
+	"context"
+	"errors"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	testcases := []struct {
+		geometry   string
+		side       int
+		difficulty Level
+	}{
+		{puzzle.StandardGeometryName, 4, AnyLevel},
+		{puzzle.RectangularGeometryName, 6, AnyLevel},
+		{puzzle.StandardGeometryName, 9, AnyLevel},
+		{puzzle.StandardGeometryName, 9, OneStar},
+		{puzzle.StandardGeometryName, 9, ThreeStar},
+	}
+	for i, tc := range testcases {
+		s, err := Generate(tc.geometry, tc.side, tc.difficulty, int64(i))
+		if err != nil {
+			t.Fatalf("Case %d: generate failed: %v", i, err)
+		}
+		if s.Geometry != tc.geometry || s.SideLength != tc.side {
+			t.Errorf("Case %d: generated %s %d", i, s.Geometry, s.SideLength)
+		}
+		p, err := puzzle.New(s)
+		if err != nil {
+			t.Fatalf("Case %d: generated puzzle is invalid: %v", i, err)
+		}
+		solutions, err := p.SolveContext(context.Background(), 2)
+		if err != nil || len(solutions) != 1 {
+			t.Fatalf("Case %d: generated puzzle has %d solutions (%v)", i, len(solutions), err)
+		}
+		rating := strconv.Itoa(solutions[0].Rating)
+		if got := s.Metadata[DifficultyMetadataKey]; got != rating {
+			t.Errorf("Case %d: difficulty tagged %q, rated %s", i, got, rating)
+		}
+		if tc.difficulty != AnyLevel && rating != strconv.Itoa(int(tc.difficulty)) {
+			t.Errorf("Case %d: rated %s, requested %v", i, rating, tc.difficulty)
+		}
+	}
+}
+
+func TestGenerateSeed(t *testing.T) {
+	first, err := Generate(puzzle.StandardGeometryName, 9, AnyLevel, 7)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	again, _ := Generate(puzzle.StandardGeometryName, 9, AnyLevel, 7)
+	if !slices.Equal(first.Values, again.Values) {
+		t.Errorf("Same seed generated %v and %v", first.Values, again.Values)
+	}
+	other, _ := Generate(puzzle.StandardGeometryName, 9, AnyLevel, 8)
+	if slices.Equal(first.Values, other.Values) {
+		t.Errorf("Different seeds both generated %v", first.Values)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	var e puzzle.Error
+	for _, l := range []Level{-1, MaxLevel} {
+		_, err := Generate(puzzle.StandardGeometryName, 9, l, 1)
+		if !errors.As(err, &e) || e.Condition != puzzle.InvalidArgumentCondition {
+			t.Errorf("Level %d: expected invalid argument, got %v", l, err)
+		}
+	}
+	_, err := GenerateOptions(context.Background(), puzzle.StandardGeometryName, 9, Options{Easiest: ThreeStar, Hardest: OneStar}, 1)
+	if !errors.As(err, &e) || e.Condition != puzzle.InvalidArgumentCondition {
+		t.Errorf("Backwards range: expected invalid argument, got %v", err)
+	}
+	if _, err := Generate("bogus", 9, AnyLevel, 1); err == nil {
+		t.Errorf("No error for bogus geometry")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = GenerateContext(ctx, puzzle.StandardGeometryName, 9, AnyLevel, 1)
+	if !errors.As(err, &e) || e.Condition != puzzle.CanceledCondition {
+		t.Errorf("Canceled generate: expected canceled, got %v", err)
+	}
+	saved := solutionAttempts
+	solutionAttempts = 0
+	defer func() { solutionAttempts = saved }()
+	if _, err := Generate(puzzle.StandardGeometryName, 4, AnyLevel, 1); err == nil {
+		t.Errorf("No error when no solution attempts are allowed")
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	ctx := context.Background()
+	s, err := GenerateOptions(ctx, puzzle.StandardGeometryName, 9, Options{Clues: 40}, 1)
+	if err != nil {
+		t.Fatalf("Generate with clues failed: %v", err)
+	}
+	clues := 0
+	for _, v := range s.Values {
+		if v != 0 {
+			clues++
+		}
+	}
+	if clues != 40 {
+		t.Errorf("Generated %d clues, expected 40", clues)
+	}
+	s, err = GenerateOptions(ctx, puzzle.StandardGeometryName, 9, Options{Easiest: TwoStar, Hardest: FourStar}, 2)
+	if err != nil {
+		t.Fatalf("Generate with range failed: %v", err)
+	}
+	if r, _ := strconv.Atoi(s.Metadata[DifficultyMetadataKey]); r < 2 || r > 4 {
+		t.Errorf("Generated rating %d, expected 2-4", r)
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	ctx := context.Background()
+	s, err := Generate(puzzle.StandardGeometryName, 4, AnyLevel, 3)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	p, _ := puzzle.New(s)
+	solutions, _ := p.SolveContext(ctx, 1)
+	full := &puzzle.Summary{Geometry: s.Geometry, SideLength: s.SideLength, Values: solutions[0].Values}
+	order := make([]int, len(full.Values))
+	for i := range order {
+		order[i] = i
+	}
+	removed, err := Minimize(ctx, full, order, 0)
+	if err != nil {
+		t.Fatalf("Minimize failed: %v", err)
+	}
+	for _, i := range removed {
+		if full.Values[i] != 0 {
+			t.Errorf("Removed square %d still has clue %d", i, full.Values[i])
+		}
+	}
+	for i, v := range full.Values {
+		if v == 0 {
+			continue
+		}
+		full.Values[i] = 0
+		p, _ := puzzle.New(full)
+		if solutions, _ := p.SolveContext(ctx, 2); len(solutions) == 1 {
+			t.Errorf("Clue %d could still be removed", i)
+		}
+		full.Values[i] = v
+	}
+	ambiguous := &puzzle.Summary{Geometry: puzzle.StandardGeometryName, SideLength: 4, Values: make([]int, 16)}
+	if _, err := Minimize(ctx, ambiguous, order, 0); err == nil {
+		t.Errorf("Minimized a puzzle with many solutions")
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	for l, s := range map[Level]string{AnyLevel: "any", OneStar: "1-star", FiveStar: "5-star", MaxLevel: "any"} {
+		if l.String() != s {
+			t.Errorf("Level %d: got %q, expected %q", int(l), l.String(), s)
+		}
+	}
+}
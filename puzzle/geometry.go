@@ -18,6 +18,8 @@
 
 package puzzle
 
+import "sync"
+
 /*
 
 Puzzle Geometries
@@ -49,6 +51,41 @@ type puzzleMapping struct {
 	gcount   int
 	gdescs   []groupDescriptor
 	ixmap    [][]int
+	peers    [][]int          // for each square, the squares it can't share a value with
+	pgroups  [][]int          // for each square, the groups of it and its peers
+	stack    *constraintStack // the constraints composed onto the geometry, if any
+}
+
+// computePeers fills in the peer lists and peer groups of a
+// mapping from its group descriptors, index map, and constraint
+// exclusions (if any).  Both are sorted, and neither has
+// duplicates, so assignment can find the squares and groups it
+// affects without revisiting any of them.
+func (m *puzzleMapping) computePeers() {
+	m.peers = make([][]int, m.scount+1)   // 1-based indexing
+	m.pgroups = make([][]int, m.scount+1) // 1-based indexing
+	for idx := 1; idx <= m.scount; idx++ {
+		var peers, pgroups intset
+		for _, gi := range m.ixmap[idx] {
+			pgroups.insert(gi)
+			for _, i := range m.gdescs[gi].indices {
+				if i != idx {
+					peers.insert(i)
+				}
+			}
+		}
+		if m.stack != nil {
+			for _, x := range m.stack.xpeers[idx] {
+				peers.insert(x.index)
+			}
+		}
+		for _, i := range peers {
+			for _, gi := range m.ixmap[i] {
+				pgroups.insert(gi)
+			}
+		}
+		m.peers[idx], m.pgroups[idx] = peers, pgroups
+	}
 }
 
 /*
@@ -57,6 +94,14 @@ Registered geometries
 
 */
 
+// The largest puzzles have this many squares on a side (see the
+// mapping functions), and so have this many groups (counting the
+// diagonals a constraint stack can add).
+const (
+	maxSideLength = 26
+	maxGroupCount = 3*maxSideLength + 2
+)
+
 const (
 	StandardGeometryName    = "square"
 	SquareGeometryName      = "square"
@@ -72,6 +117,18 @@ var knownGeometries = map[string]func([]int) (*Puzzle, error){
 	RectangularGeometryName: newRectangularPuzzle,
 }
 
+// findMapping returns the mapping for puzzles of a known
+// geometry with the given number of squares.
+func findMapping(geometry string, psize int) (*puzzleMapping, error) {
+	if _, ok := knownGeometries[geometry]; !ok {
+		return nil, argumentError(GeometryAttribute, UnknownGeometryCondition, geometry)
+	}
+	if geometry == RectangularGeometryName {
+		return rectangularPuzzleMapping(psize)
+	}
+	return squarePuzzleMapping(psize)
+}
+
 // newStandardPuzzle creates a Standard puzzle from the given values
 func newStandardPuzzle(values []int) (*Puzzle, error) {
 	mapping, err := squarePuzzleMapping(len(values))
@@ -96,6 +153,10 @@ Standard (aka square) Geometry
 
 */
 
+// mappingMutex serializes access to the memoized puzzle maps, so
+// puzzles can be created concurrently.
+var mappingMutex sync.Mutex
+
 // squarePuzzleMaps is where we memoize computed square puzzle
 // maps for each side length we've encountered, to avoid
 // computing them more than once.
@@ -152,7 +213,9 @@ func computeSquarePuzzleMapping(slen, tlen int) *puzzleMapping {
 		}
 		gs[tgi] = groupDescriptor{tgi, GroupID{GtypeTile, i + 1}, tile}
 	}
-	return &puzzleMapping{StandardGeometryName, slen, tlen, tlen, scount, gcount, gs, im}
+	pm := &puzzleMapping{StandardGeometryName, slen, tlen, tlen, scount, gcount, gs, im, nil, nil, nil}
+	pm.computePeers()
+	return pm
 }
 
 // squarePuzzleMapping returns the puzzle map for a square puzzle
@@ -164,7 +227,7 @@ func squarePuzzleMapping(psize int) (*puzzleMapping, error) {
 	if !ok {
 		return nil, formatError(PuzzleSizeAttribute, psize, NonSquareCondition, 0)
 	}
-	min, max := 4, 26 // bounded above by row value representation
+	min, max := 4, maxSideLength // bounded above by row value representation
 	if sidelen < min {
 		return nil, formatError(SideLengthAttribute, sidelen, TooSmallCondition, min)
 	}
@@ -175,6 +238,8 @@ func squarePuzzleMapping(psize int) (*puzzleMapping, error) {
 	if !ok {
 		return nil, formatError(SideLengthAttribute, sidelen, NonSquareCondition, 0)
 	}
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
 	pm, ok := squarePuzzleMaps[sidelen]
 	if ok {
 		return pm, nil
@@ -285,7 +350,9 @@ func computeRectangularPuzzleMapping(slen, tileX, tileY int) *puzzleMapping {
 		}
 		gs[tgi] = groupDescriptor{tgi, GroupID{GtypeTile, i + 1}, tile}
 	}
-	return &puzzleMapping{RectangularGeometryName, slen, tileX, tileY, scount, gcount, gs, im}
+	pm := &puzzleMapping{RectangularGeometryName, slen, tileX, tileY, scount, gcount, gs, im, nil, nil, nil}
+	pm.computePeers()
+	return pm
 }
 
 // rectangularPuzzleMapping returns the puzzle map for a square puzzle
@@ -297,7 +364,7 @@ func rectangularPuzzleMapping(psize int) (*puzzleMapping, error) {
 	if !ok {
 		return nil, formatError(PuzzleSizeAttribute, psize, NonSquareCondition, 0)
 	}
-	min, max := 6, 26 // bounded above by row value representation
+	min, max := 6, maxSideLength // bounded above by row value representation
 	if sidelen < min {
 		return nil, formatError(SideLengthAttribute, sidelen, TooSmallCondition, min)
 	}
@@ -308,6 +375,8 @@ func rectangularPuzzleMapping(psize int) (*puzzleMapping, error) {
 	if !ok {
 		return nil, formatError(SideLengthAttribute, sidelen, NonRectangularCondition, 0)
 	}
+	mappingMutex.Lock()
+	defer mappingMutex.Unlock()
 	pm, ok := rectangularPuzzleMaps[sidelen]
 	if ok {
 		return pm, nil
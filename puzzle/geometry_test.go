@@ -140,7 +140,8 @@ func TestSquarePuzzleMapping(t *testing.T) {
 		[]int{9, 13, 26}, []int{9, 14, 26}, []int{9, 15, 26},
 		[]int{9, 16, 27}, []int{9, 17, 27}, []int{9, 18, 27},
 	}
-	sm9 := puzzleMapping{StandardGeometryName, 9, 3, 3, 81, 27, gd9, gm9}
+	sm9 := puzzleMapping{StandardGeometryName, 9, 3, 3, 81, 27, gd9, gm9, nil, nil, nil}
+	sm9.computePeers() // checked by TestComputePeers
 	sm9c := computeSquarePuzzleMapping(9, 3)
 	sm9a, err := squarePuzzleMapping(81)
 	if err != nil {
@@ -260,7 +261,8 @@ func TestRectangularPuzzleMapping(t *testing.T) {
 		[]int{6, 7, 17}, []int{6, 8, 17}, []int{6, 9, 17},
 		[]int{6, 10, 18}, []int{6, 11, 18}, []int{6, 12, 18},
 	}
-	sm6 := puzzleMapping{RectangularGeometryName, 6, 3, 2, 36, 18, gd6, gm6}
+	sm6 := puzzleMapping{RectangularGeometryName, 6, 3, 2, 36, 18, gd6, gm6, nil, nil, nil}
+	sm6.computePeers() // checked by TestComputePeers
 	sm6c := computeRectangularPuzzleMapping(6, 3, 2)
 	sm6a, err := rectangularPuzzleMapping(36)
 	if err != nil {
@@ -291,3 +293,45 @@ func TestRectangularPuzzleMapping(t *testing.T) {
 		t.Errorf("First side 6 rectangular puzzle mapping was not reused!")
 	}
 }
+
+func TestComputePeers(t *testing.T) {
+	mappings := []*puzzleMapping{
+		computeSquarePuzzleMapping(4, 2),
+		computeSquarePuzzleMapping(9, 3),
+		computeRectangularPuzzleMapping(6, 3, 2),
+	}
+	for _, m := range mappings {
+		for idx := 1; idx <= m.scount; idx++ {
+			// peers share a group with the square
+			var peers, pgroups intset
+			for i := 1; i <= m.scount; i++ {
+				shared := false
+				for _, gi := range m.ixmap[idx] {
+					for _, gj := range m.ixmap[i] {
+						shared = shared || gi == gj
+					}
+				}
+				if shared && i != idx {
+					peers = append(peers, i)
+				}
+			}
+			// peer groups contain the square or a peer
+			for gi := 1; gi <= m.gcount; gi++ {
+				for _, i := range m.gdescs[gi].indices {
+					if _, found := peers.find(i); found || i == idx {
+						pgroups = append(pgroups, gi)
+						break
+					}
+				}
+			}
+			if !reflect.DeepEqual(m.peers[idx], []int(peers)) {
+				t.Errorf("%s %d peers of %d: got %v, expected %v",
+					m.geometry, m.sidelen, idx, m.peers[idx], peers)
+			}
+			if !reflect.DeepEqual(m.pgroups[idx], []int(pgroups)) {
+				t.Errorf("%s %d peer groups of %d: got %v, expected %v",
+					m.geometry, m.sidelen, idx, m.pgroups[idx], pgroups)
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Givens
+
+The values a puzzle is created with are its givens (the clues),
+except for those a summary says were entered by the player.
+Givens can't be unassigned, and since an assigned square can't
+be reassigned they can't be overwritten either.  A given can be
+unlocked, after which it's treated like an entered value.
+
+Moves never touch givens, so the set of givens changes only
+when a given is unlocked or the puzzle is frozen, and then it's
+replaced rather than modified (which lets copies of a puzzle
+share it).
+
+*/
+
+// isGiven returns whether a square's value is a given.
+func (p *Puzzle) isGiven(idx int) bool {
+	_, found := p.givens.find(idx)
+	return found
+}
+
+// allEntered returns the indices of the assigned squares whose
+// values aren't givens, or nil if there are none.
+func (p *Puzzle) allEntered() []int {
+	var result []int
+	for i := 1; i <= p.mapping.scount; i++ {
+		if p.squares[i].aval != 0 && !p.isGiven(i) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// setGivens makes every assigned square a given except those
+// whose indices are listed as entered, validating them first.
+func (p *Puzzle) setGivens(entered []int) error {
+	for _, idx := range entered {
+		if idx < 1 || idx > p.mapping.scount {
+			return rangeError(IndexAttribute, idx, 1, p.mapping.scount)
+		}
+		if p.squares[idx].aval == 0 {
+			err := argumentError(IndexAttribute, NotAssignedCondition, idx)
+			err.Message = err.Error()
+			return err
+		}
+	}
+	var result intset
+	for i := 1; i <= p.mapping.scount; i++ {
+		if p.squares[i].aval != 0 {
+			result = append(result, i)
+		}
+	}
+	for _, idx := range entered {
+		result.remove(idx)
+	}
+	p.givens = result
+	return nil
+}
+
+// Unlock turns the given in a square into an entered value, so
+// it can be unassigned.  It's an Error if the index is out of
+// range or the square has no assigned value; unlocking a value
+// that isn't a given does nothing.
+func (p *Puzzle) Unlock(index int) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 1 || index > p.mapping.scount {
+		return rangeError(IndexAttribute, index, 1, p.mapping.scount)
+	}
+	if p.squares[index].aval == 0 {
+		err := argumentError(IndexAttribute, NotAssignedCondition, index)
+		err.Message = err.Error()
+		return err
+	}
+	if !p.isGiven(index) {
+		return nil
+	}
+	result := newIntsetCopy(p.givens)
+	result.remove(index)
+	p.givens = result
+	p.changes++
+	p.update(intset{index})
+	return nil
+}
+
+// Freeze makes all the puzzle's assigned values givens, so an
+// edited puzzle can be handed to a player with its clues
+// protected.  Since undoing the moves that entered the new
+// givens would unassign them, the puzzle's journal (and any
+// checkpoints) are discarded.
+func (p *Puzzle) Freeze() error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	entered := p.allEntered()
+	p.journal = nil
+	if len(entered) == 0 {
+		return nil
+	}
+	result := newIntsetCopy(p.givens)
+	for _, idx := range entered {
+		result.insert(idx)
+	}
+	p.givens = result
+	p.changes++
+	p.update(intset(entered))
+	return nil
+}
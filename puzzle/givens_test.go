@@ -0,0 +1,165 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGivens(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if entered := p.allEntered(); entered != nil {
+		t.Errorf("New puzzle has entered values %v", entered)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{10, 4}); e != nil {
+		t.Fatalf("Assign(Choice{10, 4}) failed: %v", e)
+	}
+	if entered := p.allEntered(); !reflect.DeepEqual(entered, []int{10, 13}) {
+		t.Errorf("Puzzle has entered values %v, expected [10 13]", entered)
+	}
+
+	// givens can't be overwritten or unassigned, entered values can
+	_, e = p.Assign(Choice{1, 2})
+	if e == nil || e.(Error).Condition != DuplicateAssignmentCondition {
+		t.Errorf("Overwrite of given produced incorrect error: %v", e)
+	}
+	_, e = p.Unassign(1)
+	if e == nil || e.(Error).Condition != LockedGivenCondition {
+		t.Errorf("Unassign of given produced incorrect error: %v", e)
+	}
+	if _, e := p.Unassign(10); e != nil {
+		t.Errorf("Unassign of entered value failed: %v", e)
+	}
+
+	// unlocking a given in a copy doesn't affect the original
+	q := p.copy()
+	if e := q.Unlock(1); e != nil {
+		t.Fatalf("Unlock(1) failed: %v", e)
+	}
+	if e := q.Unlock(13); e != nil {
+		t.Errorf("Unlock of entered value failed: %v", e)
+	}
+	if _, e := q.Unassign(1); e != nil {
+		t.Errorf("Unassign of unlocked given failed: %v", e)
+	}
+	if !p.isGiven(1) {
+		t.Errorf("Unlock in copy unlocked the original")
+	}
+
+	// entered values survive a round trip through a summary
+	bytes, e := json.Marshal(p.summary())
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	if !reflect.DeepEqual(decoded.Entered, []int{13}) {
+		t.Errorf("Decoded summary has entered values %v, expected [13]", decoded.Entered)
+	}
+	r, e := New(&decoded)
+	if e != nil {
+		t.Fatalf("Failed to create puzzle from summary: %v", e)
+	}
+	if !reflect.DeepEqual(r.allSquares(), p.allSquares()) {
+		t.Errorf("Resumed puzzle has squares %v, expected %v", r.allSquares(), p.allSquares())
+	}
+
+	// error cases
+	e = p.Unlock(0)
+	if e == nil || e.(Error).Condition != TooSmallCondition {
+		t.Errorf("Unlock of index too small produced incorrect error: %v", e)
+	}
+	e = p.Unlock(10)
+	if e == nil || e.(Error).Condition != NotAssignedCondition {
+		t.Errorf("Unlock of empty square produced incorrect error: %v", e)
+	}
+	badcases := [][]int{{0}, {17}, {10}}
+	conditions := []ErrorCondition{TooSmallCondition, TooLargeCondition, NotAssignedCondition}
+	for i, entered := range badcases {
+		_, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues, Entered: entered})
+		if e == nil || e.(Error).Condition != conditions[i] {
+			t.Errorf("Case %d: bad entered values gave incorrect error: %v", i, e)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{10, 4}); e != nil {
+		t.Fatalf("Assign(Choice{10, 4}) failed: %v", e)
+	}
+	changes := p.changes
+	if e := p.Freeze(); e != nil {
+		t.Fatalf("Freeze failed: %v", e)
+	}
+	if p.changes == changes {
+		t.Errorf("Freeze didn't count as a change")
+	}
+	if entered := p.allEntered(); entered != nil {
+		t.Errorf("Frozen puzzle has entered values %v", entered)
+	}
+	if summary := p.summary(); summary.Entered != nil {
+		t.Errorf("Frozen puzzle summary has entered values %v", summary.Entered)
+	}
+	_, e = p.Unassign(13)
+	if e == nil || e.(Error).Condition != LockedGivenCondition {
+		t.Errorf("Unassign of frozen value produced incorrect error: %v", e)
+	}
+	_, e = p.Undo()
+	if e == nil || e.(Error).Condition != NothingToUndoCondition {
+		t.Errorf("Undo after freeze produced incorrect error: %v", e)
+	}
+
+	// frozen values can still be unlocked
+	if e := p.Unlock(13); e != nil {
+		t.Fatalf("Unlock(13) failed: %v", e)
+	}
+	if _, e := p.Unassign(13); e != nil {
+		t.Errorf("Unassign of unlocked value failed: %v", e)
+	}
+
+	// freezing with nothing entered changes nothing
+	q, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	changes = q.changes
+	if e := q.Freeze(); e != nil {
+		t.Errorf("Freeze with nothing entered failed: %v", e)
+	}
+	if q.changes != changes {
+		t.Errorf("Freeze with nothing entered counted as a change")
+	}
+	if e := (&Puzzle{}).Freeze(); e == nil {
+		t.Errorf("Freeze of an invalid puzzle succeeded")
+	}
+}
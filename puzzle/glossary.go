@@ -0,0 +1,196 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Technique glossary
+
+The glossary describes the techniques the solver uses to place
+values.  So it isn't just static text, each technique can also
+be looked for in a puzzle: an instance is a placement the
+technique makes right now, along with the groups and squares
+that justify it and the eliminations that leave it as the only
+possibility.
+
+*/
+
+// A GlossaryEntry describes a solving technique.
+type GlossaryEntry struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+var glossary = []GlossaryEntry{
+	{
+		Name:  "naked-single",
+		Title: "Naked single",
+		Description: "A square whose row, column, and tile already contain every " +
+			"value but one.  The missing value is the only one the square can take.",
+	},
+	{
+		Name:  "hidden-single",
+		Title: "Hidden single",
+		Description: "A value that a group still needs, but that every empty square " +
+			"in the group except one is ruled out of.  The value has to go in that square, " +
+			"even if the square could take other values.",
+	},
+}
+
+// Glossary returns the techniques the solver uses, easiest first.
+func Glossary() []GlossaryEntry {
+	return append([]GlossaryEntry(nil), glossary...)
+}
+
+// An Elimination explains why a square can't take a value: the
+// Cause square, which shares the Group with it, is assigned the
+// value.  The Cause is 0 if the value was ruled out some other
+// way.
+type Elimination struct {
+	Square int     `json:"square"`
+	Value  int     `json:"value"`
+	Cause  int     `json:"cause,omitempty"`
+	Group  GroupID `json:"group"`
+}
+
+// A TechniqueInstance is a placement a technique makes in a
+// puzzle.  Groups and Squares list everything involved (the
+// Squares in index order), and the Eliminations say why the
+// placement is the only possibility.
+type TechniqueInstance struct {
+	Technique    string        `json:"technique"`
+	Choice       Choice        `json:"choice"`
+	Groups       []GroupID     `json:"groups"`
+	Squares      []int         `json:"squares"`
+	Eliminations []Elimination `json:"eliminations"`
+}
+
+// FindTechnique looks for an instance of the named technique in
+// the puzzle, returning nil if there is none (as there never is
+// in a puzzle with errors).  It's an Error if there's no such
+// technique in the glossary.
+func (p *Puzzle) FindTechnique(name string) (*TechniqueInstance, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	var find func() *TechniqueInstance
+	switch name {
+	case "naked-single":
+		find = p.findNakedSingle
+	case "hidden-single":
+		find = p.findHiddenSingle
+	default:
+		return nil, argumentError(TechniqueAttribute, InvalidArgumentCondition, name)
+	}
+	if len(p.errors) > 0 {
+		return nil, nil
+	}
+	return find(), nil
+}
+
+// findNakedSingle finds the first square with only one possible
+// value, and the assigned peers that rule out the others.
+func (p *Puzzle) findNakedSingle() *TechniqueInstance {
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		if s.aval != 0 || s.pvals.len() != 1 {
+			continue
+		}
+		ti := &TechniqueInstance{Technique: "naked-single", Choice: Choice{i, s.pvals.min()}}
+		var squares intset
+		squares.insert(i)
+		for v := 1; v <= p.mapping.sidelen; v++ {
+			if v != s.pvals.min() {
+				ti.addElimination(p.eliminate(i, v), &squares)
+			}
+		}
+		ti.Squares = squares
+		return ti
+	}
+	return nil
+}
+
+// findHiddenSingle finds the first square a group binds to a
+// value, and the assigned squares that rule the value out of the
+// group's other empty squares.  Squares that are also naked
+// singles are only used if there are no others.
+func (p *Puzzle) findHiddenSingle() *TechniqueInstance {
+	found := 0
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		if s.aval != 0 || s.bval == 0 {
+			continue
+		}
+		if found == 0 || s.pvals.len() > 1 {
+			found = i
+		}
+		if s.pvals.len() > 1 {
+			break
+		}
+	}
+	if found == 0 {
+		return nil
+	}
+	s := p.squares[found]
+	ti := &TechniqueInstance{
+		Technique: "hidden-single",
+		Choice:    Choice{found, s.bval},
+		Groups:    []GroupID{s.bsrc[0]},
+	}
+	var squares intset
+	squares.insert(found)
+	for _, j := range p.mapping.gdescs[p.findGroup(s.bsrc[0])].indices {
+		if j != found && p.squares[j].aval == 0 {
+			squares.insert(j)
+			ti.addElimination(p.eliminate(j, s.bval), &squares)
+		}
+	}
+	ti.Squares = squares
+	return ti
+}
+
+// eliminate explains why the square at the index can't take the
+// value.
+func (p *Puzzle) eliminate(index, value int) Elimination {
+	for _, gi := range p.mapping.ixmap[index] {
+		for _, j := range p.mapping.gdescs[gi].indices {
+			if j != index && p.squares[j].aval == value {
+				return Elimination{index, value, j, p.mapping.gdescs[gi].id}
+			}
+		}
+	}
+	return Elimination{Square: index, Value: value}
+}
+
+// addElimination adds an elimination to the instance, along with
+// the squares and group it involves.
+func (ti *TechniqueInstance) addElimination(e Elimination, squares *intset) {
+	ti.Eliminations = append(ti.Eliminations, e)
+	if e.Cause == 0 {
+		return
+	}
+	squares.insert(e.Cause)
+	for _, gid := range ti.Groups {
+		if gid == e.Group {
+			return
+		}
+	}
+	ti.Groups = append(ti.Groups, e.Group)
+}
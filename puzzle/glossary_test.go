@@ -0,0 +1,76 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlossary(t *testing.T) {
+	for _, entry := range Glossary() {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues})
+		if e != nil {
+			t.Fatalf("Creation of empty4Puzzle failed: %v", e)
+		}
+		if ti, e := p.FindTechnique(entry.Name); e != nil || ti != nil {
+			t.Errorf("Empty puzzle has a %s: %+v, %v", entry.Name, ti, e)
+		}
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.FindTechnique("x-wing"); e == nil {
+		t.Errorf("Found an unknown technique")
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+
+	naked := &TechniqueInstance{
+		Technique: "naked-single",
+		Choice:    Choice{5, 4},
+		Groups:    []GroupID{{GtypeRow, 2}, {GtypeCol, 1}},
+		Squares:   []int{5, 6, 8, 13},
+		Eliminations: []Elimination{
+			{5, 1, 8, GroupID{GtypeRow, 2}},
+			{5, 2, 13, GroupID{GtypeCol, 1}},
+			{5, 3, 6, GroupID{GtypeRow, 2}},
+		},
+	}
+	if ti, e := p.FindTechnique("naked-single"); e != nil {
+		t.Errorf("Naked single search failed: %v", e)
+	} else if !reflect.DeepEqual(ti, naked) {
+		t.Errorf("Naked single was %+v, expected %+v", ti, naked)
+	}
+
+	hidden := &TechniqueInstance{
+		Technique:    "hidden-single",
+		Choice:       Choice{2, 2},
+		Groups:       []GroupID{{GtypeCol, 2}, {GtypeTile, 3}},
+		Squares:      []int{2, 10, 13},
+		Eliminations: []Elimination{{10, 2, 13, GroupID{GtypeTile, 3}}},
+	}
+	if ti, e := p.FindTechnique("hidden-single"); e != nil {
+		t.Errorf("Hidden single search failed: %v", e)
+	} else if !reflect.DeepEqual(ti, hidden) {
+		t.Errorf("Hidden single was %+v, expected %+v", ti, hidden)
+	}
+}
@@ -0,0 +1,52 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Grid access
+
+Summaries and States give the puzzle's squares as a flat list,
+which nearly every client immediately reshapes into rows.  The
+grid accessor does that once, here.
+
+*/
+
+// Grid returns the puzzle's assigned values as a slice of rows,
+// each a slice of the values in that row (0 for an empty
+// square), along with a parallel mask that is true for the
+// squares that hold givens.  The result does not share storage
+// with the puzzle.
+func (p *Puzzle) Grid() ([][]int, [][]bool, error) {
+	if !p.isValid() {
+		return nil, nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	n := p.mapping.sidelen
+	values, givens := make([][]int, n), make([][]bool, n)
+	vstore, gstore := make([]int, n*n), make([]bool, n*n)
+	for r := 0; r < n; r++ {
+		values[r], givens[r] = vstore[r*n:(r+1)*n:(r+1)*n], gstore[r*n:(r+1)*n:(r+1)*n]
+		for c := 0; c < n; c++ {
+			idx := r*n + c + 1
+			values[r][c] = p.squares[idx].aval
+			givens[r][c] = p.isGiven(idx)
+		}
+	}
+	return values, givens, nil
+}
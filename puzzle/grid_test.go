@@ -0,0 +1,63 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGrid(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	values, givens, e := p.Grid()
+	if e != nil {
+		t.Fatalf("Grid failed: %v", e)
+	}
+	flat := p.allValues()
+	for r := 0; r < 4; r++ {
+		if !reflect.DeepEqual(values[r], flat[r*4:(r+1)*4]) {
+			t.Errorf("Row %d is %v, expected %v", r+1, values[r], flat[r*4:(r+1)*4])
+		}
+		for c := 0; c < 4; c++ {
+			if given := rotation4Puzzle1PartialValues[r*4+c] != 0; givens[r][c] != given {
+				t.Errorf("Square (%d, %d) given is %v, expected %v", r+1, c+1, givens[r][c], given)
+			}
+		}
+	}
+
+	// rows don't share storage with each other or the puzzle
+	values[0] = append(values[0], 99)
+	values[1][0] = 99
+	if again, _, _ := p.Grid(); !reflect.DeepEqual(again[1][0], flat[4]) {
+		t.Errorf("Changing the grid changed the puzzle")
+	}
+	if values[1][0] != 99 || len(values[1]) != 4 {
+		t.Errorf("Appending to one row changed another: %v", values[1])
+	}
+
+	if _, _, e := (&Puzzle{}).Grid(); e == nil {
+		t.Errorf("Grid of an invalid puzzle succeeded")
+	}
+}
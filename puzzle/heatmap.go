@@ -0,0 +1,88 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Candidate heatmap
+
+A quick picture of how constrained each part of the puzzle is:
+clients shade squares by how many values they could still take,
+and hint heuristics look for the squares and groups with the
+fewest choices left.
+
+*/
+
+// A Heatmap gives the number of candidate values left in each
+// square and the number of values still needed by each group.
+// Counts is indexed by square index - 1.  An assigned square
+// has no candidates (a count of 0), and a bound square has only
+// its bound value (a count of 1).
+type Heatmap struct {
+	Counts []int       `json:"counts"`
+	Needs  []GroupNeed `json:"needs"`
+}
+
+// A GroupNeed gives the number of values whose square in a group
+// is still undetermined: no square in the group is assigned the
+// value, bound to it, or left with it as its only candidate.
+type GroupNeed struct {
+	Group GroupID `json:"group"`
+	Need  int     `json:"need"`
+}
+
+// Heatmap returns the puzzle's current Heatmap, with the group
+// needs in the puzzle's group order.
+func (p *Puzzle) Heatmap() (*Heatmap, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	hm := &Heatmap{
+		Counts: make([]int, p.mapping.scount),
+		Needs:  make([]GroupNeed, p.mapping.gcount),
+	}
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		switch {
+		case s.aval != 0:
+			hm.Counts[i-1] = 0
+		case s.bval != 0:
+			hm.Counts[i-1] = 1
+		default:
+			hm.Counts[i-1] = s.pvals.len()
+		}
+	}
+	for gi := 1; gi <= p.mapping.gcount; gi++ {
+		gd := p.mapping.gdescs[gi]
+		placed := make(map[int]bool, len(gd.indices))
+		for _, i := range gd.indices {
+			s := p.squares[i]
+			switch {
+			case s.aval != 0:
+				placed[s.aval] = true
+			case s.bval != 0:
+				placed[s.bval] = true
+			case s.pvals.len() == 1:
+				placed[s.pvals.min()] = true
+			}
+		}
+		hm.Needs[gi-1] = GroupNeed{gd.id, len(gd.indices) - len(placed)}
+	}
+	return hm, nil
+}
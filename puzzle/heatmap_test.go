@@ -0,0 +1,91 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHeatmap(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	hm, e := p.Heatmap()
+	if e != nil {
+		t.Fatalf("Heatmap failed: %v", e)
+	}
+
+	counts := make([]int, len(rotation4Puzzle1PartialAssign1CapitalSquares))
+	for i, s := range rotation4Puzzle1PartialAssign1CapitalSquares {
+		switch {
+		case s.Aval != 0:
+		case s.Bval != 0:
+			counts[i] = 1
+		default:
+			counts[i] = len(s.Pvals)
+		}
+	}
+	if !reflect.DeepEqual(hm.Counts, counts) {
+		t.Errorf("Heatmap counts were %v, expected %v", hm.Counts, counts)
+	}
+
+	var needs []GroupNeed
+	for gid := range p.Groups() {
+		have := make(map[int]bool)
+		for s := range p.GroupSquares(gid) {
+			if s.Aval != 0 {
+				have[s.Aval] = true
+			} else if s.Bval != 0 {
+				have[s.Bval] = true
+			} else if len(s.Pvals) == 1 {
+				have[s.Pvals[0]] = true
+			}
+		}
+		needs = append(needs, GroupNeed{gid, 4 - len(have)})
+	}
+	if !reflect.DeepEqual(hm.Needs, needs) {
+		t.Errorf("Heatmap needs were %v, expected %v", hm.Needs, needs)
+	}
+
+	// in an empty puzzle, everything is possible and needed
+	p, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: make([]int, 16)})
+	if e != nil {
+		t.Fatalf("Creation of empty puzzle failed: %v", e)
+	}
+	hm, _ = p.Heatmap()
+	for i, c := range hm.Counts {
+		if c != 4 {
+			t.Errorf("Square %d of empty puzzle has count %d", i+1, c)
+		}
+	}
+	for _, gn := range hm.Needs {
+		if gn.Need != 4 {
+			t.Errorf("Group %v of empty puzzle needs %d", gn.Group, gn.Need)
+		}
+	}
+
+	if _, e := (&Puzzle{}).Heatmap(); e == nil {
+		t.Errorf("Heatmap of an invalid puzzle succeeded")
+	}
+}
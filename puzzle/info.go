@@ -0,0 +1,128 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "time"
+
+/*
+
+Typed metadata
+
+Most clients want to know the same few things about a puzzle,
+so rather than have each of them invent keys for the free-form
+Metadata map, those things have typed fields in an Info.  The
+Metadata map is still there for anything else.
+
+*/
+
+// An Info gives the common descriptive data about a puzzle.
+// All of the fields are optional.  The Difficulty is on the
+// same 1-5 scale as a Solution's Rating (0 means unrated), and
+// the Tags are distinct, non-empty strings.
+type Info struct {
+	Name       string    `json:"name,omitempty"`
+	Author     string    `json:"author,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Difficulty int       `json:"difficulty,omitempty"`
+	Created    time.Time `json:"created,omitzero"`
+	Modified   time.Time `json:"modified,omitzero"`
+	Tags       []string  `json:"tags,omitempty"`
+}
+
+// Limits on the sizes of Info fields.
+const (
+	maxInfoTextLength = 200
+	maxInfoTags       = 20
+	maxInfoTagLength  = 50
+)
+
+// copy returns a copy of an Info that shares no storage with it.
+func (info *Info) copy() Info {
+	c := *info
+	c.Tags = append([]string(nil), info.Tags...)
+	if len(c.Tags) == 0 {
+		c.Tags = nil
+	}
+	return c
+}
+
+// summary returns a copy of an Info for a Summary, or nil if the
+// Info is empty.
+func (info *Info) summary() *Info {
+	if info.Name == "" && info.Author == "" && info.Source == "" && info.Difficulty == 0 &&
+		info.Created.IsZero() && info.Modified.IsZero() && len(info.Tags) == 0 {
+		return nil
+	}
+	c := info.copy()
+	return &c
+}
+
+// SetInfo replaces the puzzle's Info.  It's an Error if the Info
+// isn't valid, as it would be for New.  Like SetMetadata, this
+// makes a new version of the puzzle.
+func (p *Puzzle) SetInfo(info Info) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if e := info.validate(); e != nil {
+		return e
+	}
+	p.Info = info.copy()
+	p.changes++
+	return nil
+}
+
+// infoError returns an Error about the value of an Info field.
+func infoError(field string, cond ErrorCondition, values ...interface{}) Error {
+	err := argumentError(NamedAttribute, cond, append([]interface{}{field}, values...)...)
+	err.Message = err.Error()
+	return err
+}
+
+// validate returns an Error if any of an Info's fields has an
+// invalid value.
+func (info *Info) validate() error {
+	for _, f := range []struct {
+		name, value string
+	}{{"Name", info.Name}, {"Author", info.Author}, {"Source", info.Source}} {
+		if len(f.value) > maxInfoTextLength {
+			return infoError(f.name+" length", TooLargeCondition, len(f.value), maxInfoTextLength)
+		}
+	}
+	if info.Difficulty < 0 {
+		return infoError("Difficulty", TooSmallCondition, info.Difficulty, 0)
+	}
+	if info.Difficulty > 5 {
+		return infoError("Difficulty", TooLargeCondition, info.Difficulty, 5)
+	}
+	if !info.Created.IsZero() && !info.Modified.IsZero() && info.Modified.Before(info.Created) {
+		return infoError("Modified", TooSmallCondition, info.Modified, info.Created)
+	}
+	if len(info.Tags) > maxInfoTags {
+		return infoError("Tag count", TooLargeCondition, len(info.Tags), maxInfoTags)
+	}
+	seen := make(map[string]bool, len(info.Tags))
+	for _, tag := range info.Tags {
+		if tag == "" || len(tag) > maxInfoTagLength || seen[tag] {
+			return infoError("Tag", InvalidArgumentCondition, tag)
+		}
+		seen[tag] = true
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	created := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	info := &Info{
+		Name:       "Rotation",
+		Author:     "dcb",
+		Difficulty: 2,
+		Created:    created,
+		Modified:   created.Add(time.Hour),
+		Tags:       []string{"small", "symmetric"},
+	}
+	summary := &Summary{Info: info, Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues}
+	p, e := New(summary)
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if !reflect.DeepEqual(p.Info, *info) {
+		t.Errorf("Puzzle has info %+v, expected %+v", p.Info, *info)
+	}
+	info.Tags[0] = "changed"
+	if p.Info.Tags[0] != "small" {
+		t.Errorf("Puzzle info shares storage with its summary")
+	}
+
+	// info survives a round trip through an encoded summary
+	bytes, e := json.Marshal(p.summary())
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	if !reflect.DeepEqual(decoded.Info, p.summary().Info) {
+		t.Errorf("Decoded summary has info %+v, expected %+v", decoded.Info, p.summary().Info)
+	}
+	q := p.copy()
+	q.Info.Tags[0] = "changed"
+	if p.Info.Tags[0] != "small" {
+		t.Errorf("Puzzle info shares storage with its copy")
+	}
+
+	// empty info is omitted
+	if e := p.SetInfo(Info{}); e != nil {
+		t.Fatalf("SetInfo failed: %v", e)
+	}
+	if s := p.summary(); s.Info != nil {
+		t.Errorf("Summary of puzzle without info has info %+v", s.Info)
+	}
+	if bytes, _ := json.Marshal(p.summary()); strings.Contains(string(bytes), "info") {
+		t.Errorf("Encoded summary of puzzle without info is %s", bytes)
+	}
+
+	// error cases
+	badcases := []struct {
+		info      Info
+		condition ErrorCondition
+	}{
+		{Info{Name: strings.Repeat("x", 201)}, TooLargeCondition},
+		{Info{Difficulty: -1}, TooSmallCondition},
+		{Info{Difficulty: 6}, TooLargeCondition},
+		{Info{Created: created, Modified: created.Add(-time.Hour)}, TooSmallCondition},
+		{Info{Tags: []string{"a", ""}}, InvalidArgumentCondition},
+		{Info{Tags: []string{"a", "a"}}, InvalidArgumentCondition},
+		{Info{Tags: make([]string, 21)}, TooLargeCondition},
+	}
+	for i, tc := range badcases {
+		summary.Info = &tc.info
+		_, e := New(summary)
+		if e == nil || e.(Error).Condition != tc.condition {
+			t.Errorf("Case %d: bad info gave incorrect error: %v", i, e)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Recognized grids
+
+Clients that scan printed puzzles hand the grid to an external
+OCR tool, which reads a value (or a blank) for every cell, with
+some confidence.  Before the grid becomes a puzzle it's reviewed
+against the puzzle model: cells read with low confidence, cells
+read as values that can't be in the puzzle, and cells whose
+values repeat in one of their groups are flagged for the user.
+The user fixes the flagged cells, or confirms that a
+low-confidence cell was read correctly, and resubmits the grid.
+Conflicts and impossible values can only be fixed, not
+confirmed, and a grid with no solutions can't be used at all
+(a misread cell somewhere usually explains it).  A grid with
+more than one solution usually has a given that was read as a
+blank, so the review says whether the solution is unique.
+
+*/
+
+// DefaultConfidenceThreshold is the confidence below which a
+// recognized cell is flagged, if the grid doesn't give one.
+const DefaultConfidenceThreshold = 0.8
+
+// Reasons a recognized cell is flagged.
+const (
+	LowConfidenceFlag = "low-confidence" // the recognizer wasn't sure of it
+	OutOfRangeFlag    = "out-of-range"   // its value can't be in the puzzle
+	ConflictFlag      = "conflict"       // its value repeats in a group
+)
+
+// A RecognizedCell is one cell of a recognized grid: its value
+// (0 for a blank) and the recognizer's confidence in it, from 0
+// to 1.
+type RecognizedCell struct {
+	Value      int     `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+// A RecognizedGrid is a puzzle as read by a recognizer, with its
+// cells in square order.  Confirmed lists the squares the user
+// has confirmed were read correctly.
+type RecognizedGrid struct {
+	Geometry   string           `json:"geometry"`
+	SideLength int              `json:"sidelen"`
+	Cells      []RecognizedCell `json:"cells"`
+	Threshold  float64          `json:"threshold,omitempty"`
+	Confirmed  []int            `json:"confirmed,omitempty"`
+}
+
+// A CellFlag is a recognized cell that needs the user's
+// attention.  Conflicts lists the squares that share its value
+// in one of its groups.
+type CellFlag struct {
+	Index      int     `json:"index"`
+	Value      int     `json:"value"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"`
+	Conflicts  []int   `json:"conflicts,omitempty"`
+}
+
+// A GridReview is the result of reviewing a recognized grid.
+// The summary has the grid's values, with impossible values left
+// blank.  The grid is ready to become a puzzle when nothing is
+// flagged and it has a solution.
+type GridReview struct {
+	Summary   *Summary   `json:"summary"`
+	Flags     []CellFlag `json:"flags"`
+	Solutions int        `json:"solutions"` // 0, 1, or 2 for more than one
+	Unique    bool       `json:"unique"`
+	Ready     bool       `json:"ready"`
+}
+
+// ReviewGrid reviews a recognized grid.  It's an Error if the
+// grid's geometry is unknown, its size doesn't match its side
+// length, or it confirms squares that aren't in it.
+func ReviewGrid(g *RecognizedGrid) (*GridReview, error) {
+	if g == nil {
+		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, g)
+	}
+	threshold := g.Threshold
+	if threshold <= 0 {
+		threshold = DefaultConfidenceThreshold
+	}
+	summary := &Summary{Geometry: g.Geometry, SideLength: g.SideLength, Values: make([]int, len(g.Cells))}
+	for i, c := range g.Cells {
+		if c.Value >= 1 && c.Value <= g.SideLength {
+			summary.Values[i] = c.Value
+		}
+	}
+	if len(summary.Values) == 0 {
+		// New would make an empty puzzle of the right size
+		return nil, argumentError(PuzzleSizeAttribute, WrongPuzzleSizeCondition, 0, g.SideLength)
+	}
+	p, err := New(summary)
+	if err != nil {
+		return nil, err
+	}
+	confirmed := make(map[int]bool, len(g.Confirmed))
+	for _, idx := range g.Confirmed {
+		if idx < 1 || idx > len(g.Cells) {
+			return nil, rangeError(IndexAttribute, idx, 1, len(g.Cells))
+		}
+		confirmed[idx] = true
+	}
+
+	review := &GridReview{Summary: summary, Flags: []CellFlag{}}
+	for i, c := range g.Cells {
+		idx := i + 1
+		flag := CellFlag{Index: idx, Value: c.Value, Confidence: c.Confidence}
+		switch {
+		case c.Value < 0 || c.Value > g.SideLength:
+			flag.Reason = OutOfRangeFlag
+		case c.Value != 0 && p.conflicts(idx) != nil:
+			flag.Reason, flag.Conflicts = ConflictFlag, p.conflicts(idx)
+		case c.Confidence < threshold && !confirmed[idx]:
+			flag.Reason = LowConfidenceFlag
+		default:
+			continue
+		}
+		review.Flags = append(review.Flags, flag)
+	}
+	if !review.hasConflicts() {
+		review.Solutions = p.countSolutions(2)
+	}
+	review.Unique = review.Solutions == 1
+	review.Ready = len(review.Flags) == 0 && review.Solutions > 0
+	return review, nil
+}
+
+// hasConflicts: whether any flagged cell conflicts with others.
+func (r *GridReview) hasConflicts() bool {
+	for _, f := range r.Flags {
+		if f.Reason == ConflictFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// conflicts returns the peers of a square that have its
+// assigned value, in order (peers are sorted), or nil if there
+// are none.
+func (p *Puzzle) conflicts(idx int) []int {
+	var result []int
+	for _, j := range p.mapping.peers[idx] {
+		if p.squares[j].aval == p.squares[idx].aval {
+			result = append(result, j)
+		}
+	}
+	return result
+}
+
+// countSolutions counts the solutions of a puzzle, stopping once
+// it has found the given number of them.  The puzzle is not
+// altered.
+func (p *Puzzle) countSolutions(limit int) int {
+	if len(p.errors) > 0 {
+		return 0
+	}
+	q, release := p.scratchCopy()
+	vals, _ := rateNoChoices(q)
+	release()
+	if vals != nil {
+		return 1
+	}
+	count := 0
+	var t thread
+	q, release = p.scratchCopy()
+	defer release()
+	q.begin()
+	for q, t = solve(q, t); len(q.errors) == 0; q, t = solve(q, t) {
+		if count++; count >= limit {
+			break
+		}
+		q, t = popChoice(q, t)
+		if len(t) == 0 {
+			break
+		}
+	}
+	return count
+}
@@ -0,0 +1,101 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recognizedGrid makes a recognized grid from values, read with
+// full confidence.
+func recognizedGrid(sidelen int, values []int) *RecognizedGrid {
+	g := &RecognizedGrid{Geometry: StandardGeometryName, SideLength: sidelen}
+	for _, v := range values {
+		g.Cells = append(g.Cells, RecognizedCell{Value: v, Confidence: 1})
+	}
+	return g
+}
+
+func TestReviewGrid(t *testing.T) {
+	g := recognizedGrid(9, threeStarValues)
+	r, e := ReviewGrid(g)
+	if e != nil {
+		t.Fatalf("Review of a clean grid failed: %v", e)
+	}
+	if !r.Ready || !r.Unique || len(r.Flags) != 0 || !reflect.DeepEqual(r.Summary.Values, threeStarValues) {
+		t.Errorf("Review of a clean grid is %+v", r)
+	}
+
+	// unsure cells are flagged until confirmed
+	g.Cells[1].Confidence, g.Cells[2].Confidence = 0.5, 0.9
+	r, _ = ReviewGrid(g)
+	if r.Ready || len(r.Flags) != 1 || r.Flags[0].Index != 2 || r.Flags[0].Reason != LowConfidenceFlag {
+		t.Errorf("Review of an unsure grid is %+v", r)
+	}
+	g.Threshold = 0.95
+	if r, _ = ReviewGrid(g); len(r.Flags) != 2 {
+		t.Errorf("Review with a higher threshold is %+v", r)
+	}
+	g.Threshold, g.Confirmed = 0, []int{2}
+	if r, _ = ReviewGrid(g); !r.Ready {
+		t.Errorf("Review of a confirmed grid is %+v", r)
+	}
+
+	// conflicts and impossible values can't be confirmed
+	g = recognizedGrid(9, threeStarValues)
+	g.Cells[0].Value, g.Cells[3].Value = 1, 10
+	g.Confirmed = []int{1, 2, 4}
+	r, _ = ReviewGrid(g)
+	expect := []CellFlag{
+		{Index: 1, Value: 1, Confidence: 1, Reason: ConflictFlag, Conflicts: []int{2}},
+		{Index: 2, Value: 1, Confidence: 1, Reason: ConflictFlag, Conflicts: []int{1}},
+		{Index: 4, Value: 10, Confidence: 1, Reason: OutOfRangeFlag},
+	}
+	if r.Ready || r.Solutions != 0 || !reflect.DeepEqual(r.Flags, expect) {
+		t.Errorf("Review of a conflicted grid is %+v, expected flags %+v", r, expect)
+	}
+	if r.Summary.Values[3] != 0 {
+		t.Errorf("Impossible value kept in summary: %v", r.Summary.Values[3])
+	}
+
+	// a blank grid is usable, but not unique
+	r, e = ReviewGrid(recognizedGrid(9, make([]int, 81)))
+	if e != nil || !r.Ready || r.Unique || r.Solutions != 2 {
+		t.Errorf("Review of a blank grid is %+v (%v)", r, e)
+	}
+}
+
+func TestReviewGridErrors(t *testing.T) {
+	unknown := recognizedGrid(9, threeStarValues)
+	unknown.Geometry = "no-such-geometry"
+	badConfirm := recognizedGrid(9, threeStarValues)
+	badConfirm.Confirmed = []int{82}
+	for i, g := range []*RecognizedGrid{
+		nil,
+		recognizedGrid(9, nil),
+		recognizedGrid(9, threeStarValues[:80]),
+		unknown,
+		badConfirm,
+	} {
+		if r, e := ReviewGrid(g); e == nil {
+			t.Errorf("Case %d: review succeeded: %+v", i, r)
+		}
+	}
+}
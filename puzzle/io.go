@@ -56,9 +56,13 @@ Pretty-printed puzzles in strings, for debugging.
 
 */
 
-// String gives a pretty-printed view of a puzzle.
+// String gives a pretty-printed view of a puzzle, followed by
+// its constraints (if any) and errors.
 func (p *Puzzle) String() string {
-	return p.ValuesString(true) + p.ErrorsString()
+	if p == nil {
+		return ""
+	}
+	return p.ValuesString(true) + constraintsString(p.mapping.constraints()) + p.ErrorsString()
 }
 
 // valuesString: return a pretty-printed grid of the values.  If
@@ -68,7 +72,91 @@ func (p *Puzzle) ValuesString(showBindings bool) (result string) {
 	if p == nil {
 		return
 	}
-	slen, tileX, tileY := p.mapping.sidelen, p.mapping.tileX, p.mapping.tileY
+	return gridString(p.mapping, func(idx int) string {
+		s := p.squares[idx]
+		return cellString(s.aval, s.bval, s.pvals.intset(), showBindings)
+	})
+}
+
+func (p *Puzzle) ErrorsString() (result string) {
+	if p != nil {
+		result = errorsString(p.errors)
+	}
+	return
+}
+
+// String gives a pretty-printed view of a summary, laid out
+// according to its geometry.  Summaries whose geometry or size
+// is invalid are shown as a list of values.
+func (s *Summary) String() (result string) {
+	if s == nil {
+		return
+	}
+	m, err := findMapping(s.Geometry, s.SideLength*s.SideLength)
+	if err != nil || len(s.Values) != m.scount {
+		result = fmt.Sprintf("%s %d: %v\n", s.Geometry, s.SideLength, s.Values)
+	} else {
+		result = gridString(m, func(idx int) string {
+			return cellString(s.Values[idx-1], 0, nil, false)
+		})
+	}
+	return result + constraintsString(s.Constraints) + errorsString(s.Errors)
+}
+
+// String gives a pretty-printed view of a content.  A content
+// with every square of a standard or rectangular puzzle is shown
+// as a grid, other contents (such as updates) as a list of
+// squares.  Either way, squares show their bindings as in the
+// Puzzle String.
+func (c *Content) String() (result string) {
+	if c == nil {
+		return
+	}
+	if m := contentMapping(c.Squares); m != nil {
+		squares := make([]*Square, m.scount+1)
+		for i := range c.Squares {
+			squares[c.Squares[i].Index] = &c.Squares[i]
+		}
+		result = gridString(m, func(idx int) string {
+			s := squares[idx]
+			return cellString(s.Aval, s.Bval, s.Pvals, true)
+		})
+	} else {
+		for _, s := range c.Squares {
+			result += fmt.Sprintf("%3d:%s\n", s.Index, cellString(s.Aval, s.Bval, s.Pvals, true))
+		}
+	}
+	return result + errorsString(c.Errors)
+}
+
+// contentMapping returns the mapping for a puzzle whose squares
+// are exactly the given ones, preferring the standard geometry
+// to the rectangular one.  It returns nil if there's no such
+// mapping.
+func contentMapping(squares []Square) *puzzleMapping {
+	m, err := findMapping(StandardGeometryName, len(squares))
+	if err != nil {
+		m, err = findMapping(RectangularGeometryName, len(squares))
+	}
+	if err != nil {
+		return nil
+	}
+	seen := make([]bool, m.scount+1)
+	for _, s := range squares {
+		if s.Index < 1 || s.Index > m.scount || seen[s.Index] {
+			return nil
+		}
+		seen[s.Index] = true
+	}
+	return m
+}
+
+// gridString lays out the cells of a puzzle in a grid, with
+// column numbers across the top, row letters down the side, and
+// borders between tiles.  The cell function gives the
+// three-character form of the square with a given index.
+func gridString(m *puzzleMapping, cell func(idx int) string) (result string) {
+	slen, tileX, tileY := m.sidelen, m.tileX, m.tileY
 	// first put out the header
 	result += " "
 	for i := 0; i < slen; i++ {
@@ -91,44 +179,57 @@ func (p *Puzzle) ValuesString(showBindings bool) (result string) {
 		}
 		result += string(rowhdr)
 		for i := 0; i < slen; i++ {
-			s := p.squares[(ri*slen)+i+1]
 			if i%tileX != 0 {
 				result += " "
 			} else {
 				result += "|"
 			}
-			if s.aval != 0 {
-				result += fmt.Sprintf(" %s ", vstr(s.aval))
-			} else if showBindings {
-				if len(s.pvals) == 1 {
-					result += fmt.Sprintf("=%s ", vstr(s.pvals[0]))
-				} else if s.bval != 0 {
-					result += fmt.Sprintf("+%s ", vstr(s.bval))
-				} else if len(s.pvals) == 2 {
-					result += fmt.Sprintf("%s,%s", vstr(s.pvals[0]), vstr(s.pvals[1]))
-				} else {
-					result += fmt.Sprintf(" _ ")
-				}
-			} else {
-				result += fmt.Sprintf(" _ ")
-			}
+			result += cell((ri * slen) + i + 1)
 		}
 		result += "\n"
 	}
 	return
 }
 
-func (p *Puzzle) ErrorsString() (result string) {
-	if p != nil {
-		if elen := len(p.errors); elen > 0 {
-			if elen > 1 {
-				result += fmt.Sprintf("Errors (%d):\n", elen)
-				for i, err := range p.errors {
-					result += fmt.Sprintf("  #%d: %v\n", i+1, err)
-				}
-			} else {
-				result += fmt.Sprintf("Error: %v\n", p.errors[0])
+// cellString gives the three-character form of a square with
+// the given assigned value, bound value, and possible values.
+// If showBindings is specified, single-value squares, bound
+// squares, and 2-choice squares show their contents.
+func cellString(aval, bval int, pvals intset, showBindings bool) string {
+	if aval != 0 {
+		return fmt.Sprintf(" %s ", vstr(aval))
+	}
+	if showBindings {
+		if len(pvals) == 1 {
+			return fmt.Sprintf("=%s ", vstr(pvals[0]))
+		} else if bval != 0 {
+			return fmt.Sprintf("+%s ", vstr(bval))
+		} else if len(pvals) == 2 {
+			return fmt.Sprintf("%s,%s", vstr(pvals[0]), vstr(pvals[1]))
+		}
+	}
+	return " _ "
+}
+
+// constraintsString lists the given constraint sets, one to a
+// line.
+func constraintsString(cs []Constraint) (result string) {
+	for _, c := range cs {
+		result += fmt.Sprintf("Constraint: %v\n", c)
+	}
+	return
+}
+
+// errorsString lists the given errors, one to a line.
+func errorsString(errs []Error) (result string) {
+	if elen := len(errs); elen > 0 {
+		if elen > 1 {
+			result += fmt.Sprintf("Errors (%d):\n", elen)
+			for i, err := range errs {
+				result += fmt.Sprintf("  #%d: %v\n", i+1, err)
 			}
+		} else {
+			result += fmt.Sprintf("Error: %v\n", errs[0])
 		}
 	}
 	return
@@ -175,12 +276,12 @@ func (p *Puzzle) ValuesMarkdown(showBindings bool) (result string) {
 			if s.aval != 0 {
 				result += fmt.Sprintf(" %s ", vstr(s.aval))
 			} else if showBindings {
-				if len(s.pvals) == 1 {
-					result += fmt.Sprintf("=%s ", vstr(s.pvals[0]))
+				if s.pvals.len() == 1 {
+					result += fmt.Sprintf("=%s ", vstr(s.pvals.min()))
 				} else if s.bval != 0 {
 					result += fmt.Sprintf("+%s ", vstr(s.bval))
-				} else if len(s.pvals) == 2 {
-					result += fmt.Sprintf("%s,%s", vstr(s.pvals[0]), vstr(s.pvals[1]))
+				} else if s.pvals.len() == 2 {
+					result += fmt.Sprintf("%s,%s", vstr(s.pvals.min()), vstr(s.pvals.max()))
 				} else {
 					result += fmt.Sprintf("   ")
 				}
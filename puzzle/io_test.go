@@ -99,7 +99,7 @@ func TestPuzzleString(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 	// do a 9x9 empty puzzle test to cover unknown squares
-	p, err = New(&Summary{nil, StandardGeometryName, 9, nil, nil})
+	p, err = New(&Summary{Geometry: StandardGeometryName, SideLength: 9})
 	if err != nil {
 		t.Fatalf("Puzzle creation failed: %v", err)
 	}
@@ -121,7 +121,7 @@ func TestPuzzleString(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 	// do a 12x12 empty puzzle test to cover rectangular borders
-	p, err = New(&Summary{nil, RectangularGeometryName, 12, nil, nil})
+	p, err = New(&Summary{Geometry: RectangularGeometryName, SideLength: 12})
 	if err != nil {
 		t.Fatalf("Puzzle creation failed: %v", err)
 	}
@@ -148,6 +148,83 @@ func TestPuzzleString(t *testing.T) {
 	}
 }
 
+func TestSummaryString(t *testing.T) {
+	if s := (*Summary)(nil).String(); s != "" {
+		t.Errorf("Unexpected nil summary string: %q", s)
+	}
+	summary := &Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialAssign1Values}
+	s := summary.String()
+	e := " | 1   2 | 3   4 \n" +
+		" +---+---+---+---\n" +
+		"a| 1   _ | 3   _ \n" +
+		"b| _   3 | _   1 \n" +
+		" +---+---+---+---\n" +
+		"c| 3   _ | 1   _ \n" +
+		"d| 2   1 | _   3 \n"
+	if s != e {
+		t.Errorf("Unexpected summary string:\n%vExpected:\n%v", s, e)
+	}
+	// a 6x6 rectangular summary has 2x3 tiles
+	summary = &Summary{Geometry: RectangularGeometryName, SideLength: 6, Values: make([]int, 36)}
+	s = summary.String()
+	e = " | 1   2   3 | 4   5   6 \n" +
+		" +---+---+---+---+---+---\n" +
+		"a| _   _   _ | _   _   _ \n" +
+		"b| _   _   _ | _   _   _ \n" +
+		" +---+---+---+---+---+---\n" +
+		"c| _   _   _ | _   _   _ \n" +
+		"d| _   _   _ | _   _   _ \n" +
+		" +---+---+---+---+---+---\n" +
+		"e| _   _   _ | _   _   _ \n" +
+		"f| _   _   _ | _   _   _ \n"
+	if s != e {
+		t.Errorf("Unexpected summary string:\n%vExpected:\n%v", s, e)
+	}
+	// summaries that don't fit their geometry are listed
+	summary = &Summary{Geometry: "bogus", SideLength: 2, Values: []int{1, 0, 0, 2}}
+	if s, e := summary.String(), "bogus 2: [1 0 0 2]\n"; s != e {
+		t.Errorf("Unexpected summary string: %q, Expected: %q", s, e)
+	}
+	// errors follow the grid
+	p, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	summary = p.summary()
+	s = summary.String()
+	if e := p.ValuesString(false) + p.ErrorsString(); s != e {
+		t.Errorf("Unexpected summary string:\n%vExpected:\n%v", s, e)
+	}
+}
+
+func TestContentString(t *testing.T) {
+	if s := (*Content)(nil).String(); s != "" {
+		t.Errorf("Unexpected nil content string: %q", s)
+	}
+	p, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialAssign1Values})
+	if err != nil {
+		t.Fatalf("Puzzle creation failed: %v", err)
+	}
+	// full contents look like the puzzle, in any order
+	content := p.state()
+	content.Squares[0], content.Squares[15] = content.Squares[15], content.Squares[0]
+	if s, e := content.String(), p.String(); s != e {
+		t.Errorf("Unexpected content string:\n%vExpected:\n%v", s, e)
+	}
+	// partial contents are listed
+	content, err = p.Assign(Choice{2, 2})
+	if err != nil {
+		t.Fatalf("Assign failed: %v", err)
+	}
+	e := ""
+	for _, sq := range content.Squares {
+		e += fmt.Sprintf("%3d:%s\n", sq.Index, cellString(sq.Aval, sq.Bval, sq.Pvals, true))
+	}
+	if s := content.String(); s != e {
+		t.Errorf("Unexpected content string:\n%vExpected:\n%v", s, e)
+	}
+}
+
 /*
 
 Markdown
@@ -190,7 +267,7 @@ func TestPuzzleValuesMarkdown(t *testing.T) {
 		t.Errorf("Unexpected puzzle string:\n%vExpected:\n%v", s, e)
 	}
 	// do a 9x9 empty puzzle test to cover unknown squares
-	p, err = New(&Summary{nil, StandardGeometryName, 9, nil, nil})
+	p, err = New(&Summary{Geometry: StandardGeometryName, SideLength: 9})
 	if err != nil {
 		t.Fatalf("Puzzle creation failed: %v", err)
 	}
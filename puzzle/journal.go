@@ -0,0 +1,527 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "time"
+
+/*
+
+Journals
+
+*/
+
+// A Move is an operation done by a client on a puzzle: either
+// the assignment of a value to a square, or the removal of the
+// value assigned to a square.  The value is recorded in both
+// cases, so moves can be read backwards as well as forwards.
+//
+// Moves made by clients are stamped with the (UTC) time they
+// were made and the puzzle's actor at the time (see SetActor).
+// Moves made by the solver are not stamped.
+type Move struct {
+	Action string    `json:"action"`
+	Index  int       `json:"index"`
+	Value  int       `json:"value"`
+	Time   time.Time `json:"time,omitzero"`
+	Actor  string    `json:"actor,omitempty"`
+}
+
+// Action constants for Moves.
+const (
+	AssignAction   = "assign"
+	UnassignAction = "unassign"
+)
+
+// A Journal is the serializable form of a puzzle's history: the
+// moves made on it, in order, and how many of them are done.
+// The moves past the done ones have been undone, and can be
+// redone.  Puzzles only have a journal if they have a history,
+// and summaries only include a journal if the client puts it
+// there, so journals are optional in serialized puzzles.
+type Journal struct {
+	Moves []Move `json:"moves"`
+	Done  int    `json:"done"`
+}
+
+// A journal is a puzzle's record of the moves made on it.
+//
+// Each move is recorded along with images of the squares and
+// groups it changed, saved just before they were changed (see
+// the indexLogger, which watches over the squares and groups),
+// so the move can be undone and redone exactly, without any
+// recomputation.
+// Because only changed content is saved, journaling a move is
+// much cheaper than copying the puzzle.
+//
+// Checkpoints are marks in the journal that the puzzle can be
+// rolled back to.  They nest: rolling back to (or committing) a
+// checkpoint does the same to all the checkpoints taken after
+// it.
+type journal struct {
+	entries     []*journalEntry
+	done        int          // entries[:done] are done, entries[done:] are undone
+	checkpoints []checkpoint // open checkpoints, oldest first
+	serial      CheckpointToken
+}
+
+// A journalEntry is a sequence of moves and their images.
+// Before the moves are done, the images hold the puzzle content
+// from before the moves; after, they hold the content from after
+// the moves.  Client moves each get their own entry, but the
+// solver batches all the moves it makes between choices into one
+// entry, so it saves each square and group at most once per
+// choice.
+type journalEntry struct {
+	moves    []Move
+	sindices []int    // indices of the imaged squares
+	squares  []square // images of the squares
+	gindices []int    // indices of the imaged groups
+	groups   []group  // images of the groups
+	errors   []Error  // image of the puzzle errors
+	ints     []int    // storage for the image intsets
+}
+
+// keep copies an intset into the entry's storage, so images don't
+// need an allocation each.  The copy's capacity is capped, so
+// appending to it can't overwrite other images.
+func (e *journalEntry) keep(is []int) []int {
+	if is == nil {
+		return nil
+	}
+	start := len(e.ints)
+	e.ints = append(e.ints, is...)
+	return e.ints[start:len(e.ints):len(e.ints)]
+}
+
+// clock gives the time at which client moves are made.  Tests
+// replace it to get predictable times.
+var clock = time.Now
+
+// clientMove returns a move made by a client, stamped with the
+// current time and the puzzle's actor.
+func (p *Puzzle) clientMove(action string, index, value int) Move {
+	return Move{action, index, value, clock().UTC(), p.actor}
+}
+
+// begin starts a new journal entry, in which all moves are
+// recorded until end is called.  Any undone moves are forgotten,
+// along with any checkpoints taken while they were done.
+func (p *Puzzle) begin() {
+	if p.journal == nil {
+		p.journal = &journal{}
+	}
+	j := p.journal
+	j.entries = j.entries[:j.done]
+	for len(j.checkpoints) > 0 && j.checkpoints[len(j.checkpoints)-1].done > j.done {
+		j.checkpoints = j.checkpoints[:len(j.checkpoints)-1]
+	}
+	e := &journalEntry{errors: p.allErrors(false)}
+	j.entries = append(j.entries, e)
+	j.done++
+	p.logger.entry = e
+}
+
+// end finishes the journal entry being made, if any.
+func (p *Puzzle) end() {
+	p.logger.entry = nil
+}
+
+// do makes a move on a puzzle, recording it in the puzzle's
+// journal, and returns an intset of the indices of all the
+// squares modified by the move.  If there's an entry being made
+// the move is added to it, otherwise the move gets its own
+// entry.  The move must be valid.
+func (p *Puzzle) do(m Move) intset {
+	if p.logger.entry == nil {
+		p.begin()
+		defer p.end()
+	}
+	e := p.logger.entry
+	e.moves = append(e.moves, m)
+	if m.Action == UnassignAction {
+		return p.unassign(m.Index)
+	}
+	return p.assign(m.Index, m.Value)
+}
+
+// saveSquare adds an image of a square to a journal entry, unless
+// it already has one.
+func (e *journalEntry) saveSquare(s *square) {
+	for _, i := range e.sindices {
+		if i == s.index {
+			return
+		}
+	}
+	e.sindices = append(e.sindices, s.index)
+	e.squares = append(e.squares, square{
+		index: s.index,
+		aval:  s.aval,
+		pvals: s.pvals,
+		bval:  s.bval,
+		bsrc:  append([]GroupID(nil), s.bsrc...),
+	})
+}
+
+// saveGroup adds an image of a group to a journal entry, unless
+// it already has one.
+func (e *journalEntry) saveGroup(g *group) {
+	gi := g.desc.index
+	for _, i := range e.gindices {
+		if i == gi {
+			return
+		}
+	}
+	e.gindices = append(e.gindices, gi)
+	e.groups = append(e.groups, group{
+		desc:  g.desc,
+		where: e.keep(g.where),
+		need:  g.need,
+		free:  e.keep(g.free),
+	})
+}
+
+// swap exchanges the content of a puzzle with the images in a
+// journal entry, returning the indices of the squares whose
+// content changed.  Swapping twice leaves everything as it was,
+// so this both undoes and redoes the entry's move.
+func (e *journalEntry) swap(p *Puzzle) intset {
+	var changed intset
+	for k, i := range e.sindices {
+		s, img := p.squares[i], &e.squares[k]
+		if !s.sameContent(img) {
+			changed.insert(i)
+		}
+		s.aval, img.aval = img.aval, s.aval
+		s.pvals, img.pvals = img.pvals, s.pvals
+		s.bval, img.bval = img.bval, s.bval
+		s.bsrc, img.bsrc = img.bsrc, s.bsrc
+	}
+	for k, gi := range e.gindices {
+		g, img := p.groups[gi], &e.groups[k]
+		g.where, img.where = img.where, g.where
+		g.need, img.need = img.need, g.need
+		g.free, img.free = img.free, g.free
+	}
+	p.errors, e.errors = e.errors, p.errors
+	p.changes++
+	return changed
+}
+
+// sameContent compares the values and bindings of two squares.
+func (s *square) sameContent(o *square) bool {
+	if s.aval != o.aval || s.bval != o.bval || s.pvals != o.pvals || len(s.bsrc) != len(o.bsrc) {
+		return false
+	}
+	for i := range s.bsrc {
+		if s.bsrc[i] != o.bsrc[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// undo takes back the last done move, returning the indices of
+// the squares it changed, or nil if there's nothing to undo.
+func (p *Puzzle) undo() intset {
+	p.end()
+	if p.journal == nil || p.journal.done == 0 {
+		return nil
+	}
+	p.journal.done--
+	return p.journal.entries[p.journal.done].swap(p)
+}
+
+// redo makes the last undone move again, returning the indices
+// of the squares it changed, or nil if there's nothing to redo.
+func (p *Puzzle) redo() intset {
+	p.end()
+	if p.journal == nil || p.journal.done == len(p.journal.entries) {
+		return nil
+	}
+	p.journal.done++
+	return p.journal.entries[p.journal.done-1].swap(p)
+}
+
+// Undo takes back the last move made on the puzzle, returning
+// an update to the puzzle's State.  It's an Error if there are
+// no moves to undo.
+func (p *Puzzle) Undo() (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if p.journal == nil || p.journal.done == 0 {
+		return nil, Error{Scope: ArgumentScope, Structure: ScopeStructure, Condition: NothingToUndoCondition}
+	}
+	is := p.undo()
+	return p.update(is), nil
+}
+
+// Redo makes the last undone move again, returning an update to
+// the puzzle's State.  It's an Error if there are no undone
+// moves (which there never are after a new move is made).
+func (p *Puzzle) Redo() (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if p.journal == nil || p.journal.done == len(p.journal.entries) {
+		return nil, Error{Scope: ArgumentScope, Structure: ScopeStructure, Condition: NothingToRedoCondition}
+	}
+	is := p.redo()
+	return p.update(is), nil
+}
+
+// Journal returns the serializable form of the puzzle's history,
+// or nil if it has none.  Put the journal in a puzzle's Summary
+// to have the puzzle created from the summary resume with its
+// history intact.
+func (p *Puzzle) Journal() (*Journal, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if p.journal == nil || len(p.journal.entries) == 0 {
+		return nil, nil
+	}
+	j := &Journal{}
+	for i, e := range p.journal.entries {
+		j.Moves = append(j.Moves, e.moves...)
+		if i < p.journal.done {
+			j.Done = len(j.Moves)
+		}
+	}
+	return j, nil
+}
+
+// History returns the moves that are done on the puzzle, oldest
+// first, each with the time it was made and its actor.  Undone
+// moves are not included (see Journal).  A puzzle with no
+// history has no moves.
+func (p *Puzzle) History() ([]Move, error) {
+	j, e := p.Journal()
+	if e != nil || j == nil {
+		return nil, e
+	}
+	return j.Moves[:j.Done], nil
+}
+
+// SetActor sets the actor recorded with the client moves made on
+// the puzzle from now on, such as the ID of the player's
+// session.  An empty actor leaves future moves unattributed.
+func (p *Puzzle) SetActor(actor string) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	p.actor = actor
+	return nil
+}
+
+// replay gives a newly created puzzle the history in a journal.
+// The puzzle's values are the ones after the done moves, so we
+// take those moves back to find the starting values, rebuild
+// the puzzle from there by making all the moves, and then undo
+// the ones that weren't done.  Returns an Error if the journal
+// doesn't fit the puzzle.
+func (p *Puzzle) replay(j *Journal) error {
+	invalid := argumentError(SummaryAttribute, InvalidJournalCondition, j)
+	if j.Done < 0 || j.Done > len(j.Moves) {
+		return invalid
+	}
+	if len(j.Moves) == 0 {
+		return nil
+	}
+	values := p.allValues()
+	for i := j.Done - 1; i >= 0; i-- {
+		m := j.Moves[i]
+		if m.Index < 1 || m.Index > len(values) {
+			return invalid
+		}
+		switch m.Action {
+		case AssignAction:
+			if values[m.Index-1] != m.Value {
+				return invalid
+			}
+			values[m.Index-1] = 0
+		case UnassignAction:
+			if values[m.Index-1] != 0 {
+				return invalid
+			}
+			values[m.Index-1] = m.Value
+		default:
+			return invalid
+		}
+	}
+	start, e := create(p.mapping, values)
+	if e != nil {
+		return invalid
+	}
+	start.givens = p.givens // moves never touch givens
+	start.ctx = p.ctx
+	defer func() { start.ctx = nil }()
+	for _, m := range j.Moves {
+		if start.canceled() {
+			return canceledError(start.ctx)
+		}
+		switch m.Action {
+		case AssignAction:
+			_, e = start.Assign(Choice{m.Index, m.Value})
+		case UnassignAction:
+			if m.Index >= 1 && m.Index <= len(values) && start.squares[m.Index].aval != m.Value {
+				e = invalid
+			} else {
+				_, e = start.Unassign(m.Index)
+			}
+		default:
+			e = invalid
+		}
+		if e != nil {
+			return invalid
+		}
+		// keep the original move's time and actor
+		entry := start.journal.entries[start.journal.done-1]
+		entry.moves[len(entry.moves)-1] = m
+	}
+	for start.journal.done > j.Done {
+		start.undo()
+	}
+	p.squares, p.groups, p.errors, p.logger = start.squares, start.groups, start.errors, start.logger
+	p.journal = start.journal
+	return nil
+}
+
+/*
+
+Checkpoints
+
+*/
+
+// A CheckpointToken identifies a checkpoint taken on a puzzle.
+type CheckpointToken int
+
+// A checkpoint is a journal position that can be rolled back to.
+type checkpoint struct {
+	token CheckpointToken
+	done  int
+}
+
+// checkpoint opens a new checkpoint at the current journal
+// position.
+func (p *Puzzle) checkpoint() CheckpointToken {
+	if p.journal == nil {
+		p.journal = &journal{}
+	}
+	j := p.journal
+	j.serial++
+	j.checkpoints = append(j.checkpoints, checkpoint{j.serial, j.done})
+	return j.serial
+}
+
+// findCheckpoint returns the position of an open checkpoint in
+// the journal's list, or -1 if it isn't open.
+func (j *journal) findCheckpoint(token CheckpointToken) int {
+	if j != nil {
+		for i := len(j.checkpoints) - 1; i >= 0; i-- {
+			if j.checkpoints[i].token == token {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// rollback returns the puzzle to the state it had when the given
+// checkpoint was taken, closing that checkpoint and all later
+// ones.  The moves made since the checkpoint are forgotten, so
+// they can't be redone.  Returns the indices of the squares
+// changed, and whether the checkpoint was open.
+func (p *Puzzle) rollback(token CheckpointToken) (intset, bool) {
+	ci := p.journal.findCheckpoint(token)
+	if ci < 0 {
+		return nil, false
+	}
+	p.end()
+	j := p.journal
+	done := j.checkpoints[ci].done
+	var changed intset
+	for j.done > done {
+		for _, i := range p.undo() {
+			changed.insert(i)
+		}
+	}
+	for j.done < done {
+		// moves undone after the checkpoint was taken
+		for _, i := range p.redo() {
+			changed.insert(i)
+		}
+	}
+	j.entries = j.entries[:done]
+	j.checkpoints = j.checkpoints[:ci]
+	return changed, true
+}
+
+// commit closes the given checkpoint and all later ones, keeping
+// the moves made since.  Returns whether the checkpoint was open.
+func (p *Puzzle) commit(token CheckpointToken) bool {
+	ci := p.journal.findCheckpoint(token)
+	if ci < 0 {
+		return false
+	}
+	p.journal.checkpoints = p.journal.checkpoints[:ci]
+	return true
+}
+
+// Checkpoint marks the puzzle's current state, returning a token
+// that can be used to roll the puzzle back to that state or to
+// commit the moves made since.  Checkpoints nest, so they can be
+// used to explore a branch of choices within a branch.
+func (p *Puzzle) Checkpoint() (CheckpointToken, error) {
+	if !p.isValid() {
+		return 0, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	return p.checkpoint(), nil
+}
+
+// Rollback returns the puzzle to the state it had when the
+// checkpoint with the given token was taken, returning an update
+// to the puzzle's State.  The checkpoint, and any taken after it,
+// are closed.  The moves made since the checkpoint are removed
+// from the puzzle's history, so they can't be redone.  It's an
+// Error if the checkpoint isn't open.
+func (p *Puzzle) Rollback(token CheckpointToken) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	is, ok := p.rollback(token)
+	if !ok {
+		return nil, argumentError(CheckpointAttribute, UnknownCheckpointCondition, token)
+	}
+	return p.update(is), nil
+}
+
+// Commit closes the checkpoint with the given token, and any
+// taken after it, keeping the moves made since (which remain in
+// the puzzle's history, and can be undone).  It's an Error if
+// the checkpoint isn't open.
+func (p *Puzzle) Commit(token CheckpointToken) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if !p.commit(token) {
+		return argumentError(CheckpointAttribute, UnknownCheckpointCondition, token)
+	}
+	return nil
+}
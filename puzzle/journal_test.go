@@ -0,0 +1,376 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUndoRedo(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	if _, e := p.Undo(); e == nil || e.(Error).Condition != NothingToUndoCondition {
+		t.Errorf("Undo on new puzzle produced incorrect error: %v", e)
+	}
+	if _, e := p.Redo(); e == nil || e.(Error).Condition != NothingToRedoCondition {
+		t.Errorf("Redo on new puzzle produced incorrect error: %v", e)
+	}
+
+	// make some moves, remembering the state before each one
+	solution := p.allSolutions()[0].Values
+	var states [][]Square
+	var last int
+	for i, v := range threeStarValues {
+		if v == 0 && len(states) < 10 {
+			states, last = append(states, p.allSquares()), i+1
+			if _, e := p.Assign(Choice{i + 1, solution[i]}); e != nil {
+				t.Fatalf("Assign(Choice{%d, %d}) failed: %v", i+1, solution[i], e)
+			}
+		}
+	}
+	states = append(states, p.allSquares())
+	if _, e := p.Unassign(last); e != nil {
+		t.Fatalf("Unassign(%d) failed: %v", last, e)
+	}
+	final := p.allSquares()
+
+	// undo everything: we should go back through the states exactly
+	if _, e := p.Undo(); e != nil {
+		t.Fatalf("Undo of Unassign failed: %v", e)
+	}
+	for i := len(states) - 1; i >= 0; i-- {
+		if SS := p.allSquares(); !reflect.DeepEqual(SS, states[i]) {
+			t.Fatalf("After undo to move %d, state is %v, expected %v", i, SS, states[i])
+		}
+		if i > 0 {
+			before := p.allSquares()
+			update, e := p.Undo()
+			if e != nil {
+				t.Fatalf("Undo of move %d failed: %v", i, e)
+			}
+			// the update must contain exactly the changed squares
+			after := p.allSquares()
+			for _, S := range update.Squares {
+				if reflect.DeepEqual(S, before[S.Index-1]) || !reflect.DeepEqual(S, after[S.Index-1]) {
+					t.Errorf("Undo of move %d: bad update square %v", i, S)
+				}
+			}
+		}
+	}
+	if _, e := p.Undo(); e == nil {
+		t.Errorf("Undo past first move didn't fail")
+	}
+
+	// redo everything: we should get back to the final state
+	for i := range states {
+		if _, e := p.Redo(); e != nil {
+			t.Fatalf("Redo of move %d failed: %v", i, e)
+		}
+	}
+	if SS := p.allSquares(); !reflect.DeepEqual(SS, final) {
+		t.Errorf("After redo, state is %v, expected %v", SS, final)
+	}
+	if _, e := p.Redo(); e == nil {
+		t.Errorf("Redo past last move didn't fail")
+	}
+
+	// a new move forgets undone moves
+	p.Undo()
+	if _, e := p.Unassign(last); e != nil {
+		t.Fatalf("Unassign(%d) after undo failed: %v", last, e)
+	}
+	if _, e := p.Redo(); e == nil {
+		t.Errorf("Redo after new move didn't fail")
+	}
+	j, _ := p.Journal()
+	if len(j.Moves) != len(states) || j.Done != len(states) {
+		t.Errorf("Journal after new move is %+v", j)
+	}
+}
+
+func TestUndoFixesErrors(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	p.Assign(Choice{13, 4})
+	good := p.allSquares()
+	p.Assign(Choice{4, 4})
+	if len(p.errors) == 0 {
+		t.Fatalf("Assign(Choice{4, 4}) didn't produce errors")
+	}
+	update, e := p.Undo()
+	if e != nil {
+		t.Fatalf("Undo of bad move failed: %v", e)
+	}
+	if len(update.Errors) != 0 || !reflect.DeepEqual(p.allSquares(), good) {
+		t.Errorf("Undo of bad move gave %v, expected %v", p.allSquares(), good)
+	}
+	// undoing an unassignment puts the errors back
+	p.Redo()
+	p.Unassign(4)
+	if _, e := p.Undo(); e != nil || len(p.errors) == 0 {
+		t.Errorf("Undo of fixing move gave errors %v (%v)", p.errors, e)
+	}
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if j, e := p.Journal(); j != nil || e != nil {
+		t.Errorf("New puzzle has journal %v (%v)", j, e)
+	}
+	p.Assign(Choice{13, 2})
+	p.Assign(Choice{10, 4})
+	p.Unassign(13)
+	p.Assign(Choice{15, 4})
+	p.Undo()
+
+	summary := p.summary()
+	if summary.Journal != nil {
+		t.Errorf("Summary includes journal by default")
+	}
+	summary.Journal, _ = p.Journal()
+	bytes, e := json.Marshal(summary)
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	r, e := New(&decoded)
+	if e != nil {
+		t.Fatalf("Failed to create puzzle from journaled summary: %v", e)
+	}
+	if !reflect.DeepEqual(r.allValues(), p.allValues()) {
+		t.Errorf("Resumed puzzle has values %v, expected %v", r.allValues(), p.allValues())
+	}
+	if rj, _ := r.Journal(); !reflect.DeepEqual(rj, summary.Journal) {
+		t.Errorf("Resumed puzzle has journal %+v, expected %+v", rj, summary.Journal)
+	}
+	// both puzzles should undo and redo the same way
+	for _, op := range []func(*Puzzle) (*Content, error){
+		(*Puzzle).Redo, (*Puzzle).Undo, (*Puzzle).Undo, (*Puzzle).Undo, (*Puzzle).Undo,
+	} {
+		op(p)
+		op(r)
+		if !reflect.DeepEqual(r.allValues(), p.allValues()) {
+			t.Errorf("Resumed puzzle has values %v, expected %v", r.allValues(), p.allValues())
+		}
+	}
+	if !reflect.DeepEqual(r.allValues(), rotation4Puzzle1PartialValues) {
+		t.Errorf("Fully undone puzzle has values %v", r.allValues())
+	}
+
+	// journals that don't match the values are rejected
+	badcases := []*Journal{
+		{Moves: []Move{{Action: AssignAction, Index: 13, Value: 2}}, Done: 2},
+		{Moves: []Move{{Action: AssignAction, Index: 13, Value: 2}}, Done: 1},
+		{Moves: []Move{{Action: UnassignAction, Index: 1, Value: 1}}, Done: 1},
+		{Moves: []Move{{Action: "erase", Index: 13, Value: 2}}, Done: 0},
+		{Moves: []Move{{Action: AssignAction, Index: 99, Value: 2}}, Done: 1},
+	}
+	for i, j := range badcases {
+		_, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues, Journal: j})
+		if e == nil || e.(Error).Condition != InvalidJournalCondition {
+			t.Errorf("Case %d: bad journal gave incorrect error: %v", i, e)
+		}
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	solution := p.allSolutions()[0].Values
+	var empties []int
+	for i, v := range threeStarValues {
+		if v == 0 {
+			empties = append(empties, i+1)
+		}
+	}
+	move := func(i int) {
+		if _, e := p.Assign(Choice{empties[i], solution[empties[i]-1]}); e != nil {
+			t.Fatalf("Assign to square %d failed: %v", empties[i], e)
+		}
+	}
+
+	// nested checkpoints roll back exactly
+	move(0)
+	start := p.allSquares()
+	outer, _ := p.Checkpoint()
+	move(1)
+	move(2)
+	middle := p.allSquares()
+	inner, _ := p.Checkpoint()
+	move(3)
+	p.Unassign(empties[1])
+	if _, e := p.Rollback(inner); e != nil {
+		t.Fatalf("Rollback to inner checkpoint failed: %v", e)
+	}
+	if SS := p.allSquares(); !reflect.DeepEqual(SS, middle) {
+		t.Errorf("Rollback to inner checkpoint gave %v, expected %v", SS, middle)
+	}
+	if _, e := p.Redo(); e == nil {
+		t.Errorf("Redo after rollback didn't fail")
+	}
+	if _, e := p.Rollback(inner); e == nil || e.(Error).Condition != UnknownCheckpointCondition {
+		t.Errorf("Second rollback to inner checkpoint gave incorrect error: %v", e)
+	}
+	inner, _ = p.Checkpoint()
+	move(4)
+	update, e := p.Rollback(outer)
+	if e != nil {
+		t.Fatalf("Rollback to outer checkpoint failed: %v", e)
+	}
+	if SS := p.allSquares(); !reflect.DeepEqual(SS, start) {
+		t.Errorf("Rollback to outer checkpoint gave %v, expected %v", SS, start)
+	}
+	if len(update.Squares) == 0 {
+		t.Errorf("Rollback to outer checkpoint reported no changes")
+	}
+	if e := p.Commit(inner); e == nil || e.(Error).Condition != UnknownCheckpointCondition {
+		t.Errorf("Commit of checkpoint closed by rollback gave incorrect error: %v", e)
+	}
+
+	// committed moves stay, and can still be undone
+	outer, _ = p.Checkpoint()
+	move(5)
+	if e := p.Commit(outer); e != nil {
+		t.Fatalf("Commit failed: %v", e)
+	}
+	if _, e := p.Rollback(outer); e == nil {
+		t.Errorf("Rollback after commit didn't fail")
+	}
+	if j, _ := p.Journal(); len(j.Moves) != 2 || j.Done != 2 {
+		t.Errorf("Journal after commit is %+v", j)
+	}
+	if _, e := p.Undo(); e != nil {
+		t.Errorf("Undo of committed move failed: %v", e)
+	}
+	if SS := p.allSquares(); !reflect.DeepEqual(SS, start) {
+		t.Errorf("Undo of committed move gave %v, expected %v", SS, start)
+	}
+
+	// moves undone inside a checkpoint are restored by rollback
+	move(6)
+	after := p.allSquares()
+	mark, _ := p.Checkpoint()
+	p.Undo()
+	p.Undo()
+	if _, e := p.Rollback(mark); e != nil {
+		t.Fatalf("Rollback after undo failed: %v", e)
+	}
+	if SS := p.allSquares(); !reflect.DeepEqual(SS, after) {
+		t.Errorf("Rollback after undo gave %v, expected %v", SS, after)
+	}
+
+	// a new move after undoing past a checkpoint closes it
+	mark, _ = p.Checkpoint()
+	p.Undo()
+	move(7)
+	if _, e := p.Rollback(mark); e == nil {
+		t.Errorf("Rollback to checkpoint in forgotten history didn't fail")
+	}
+}
+
+// freezeClock makes all client moves happen at the same time, so
+// puzzles given the same moves compare equal.  Call the returned
+// function to restore the clock.
+func freezeClock() func() {
+	frozen := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock = func() time.Time {
+		return frozen
+	}
+	return func() { clock = time.Now }
+}
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	clock = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	defer func() { clock = time.Now }()
+
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if h, e := p.History(); h != nil || e != nil {
+		t.Errorf("New puzzle has history %v (%v)", h, e)
+	}
+	p.SetActor("alice")
+	p.Assign(Choice{13, 2})
+	p.SetActor("bob")
+	p.Assign(Choice{10, 4})
+	p.Unassign(13)
+	p.Assign(Choice{15, 4})
+	p.Undo()
+	expected := []Move{
+		{AssignAction, 13, 2, start.Add(1 * time.Second), "alice"},
+		{AssignAction, 10, 4, start.Add(2 * time.Second), "bob"},
+		{UnassignAction, 13, 2, start.Add(3 * time.Second), "bob"},
+	}
+	h, e := p.History()
+	if e != nil {
+		t.Fatalf("History failed: %v", e)
+	}
+	if !reflect.DeepEqual(h, expected) {
+		t.Errorf("History was %+v, expected %+v", h, expected)
+	}
+
+	// the stamps survive a round trip through a summary
+	summary := p.summary()
+	summary.Journal, _ = p.Journal()
+	bytes, e := json.Marshal(summary)
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(bytes, &decoded); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	r, e := New(&decoded)
+	if e != nil {
+		t.Fatalf("Failed to create puzzle from journaled summary: %v", e)
+	}
+	if rh, _ := r.History(); !reflect.DeepEqual(rh, expected) {
+		t.Errorf("Resumed puzzle has history %+v, expected %+v", rh, expected)
+	}
+
+	// solver moves aren't stamped or recorded in the puzzle
+	p.Solutions()
+	if h, _ := p.History(); len(h) != len(expected) {
+		t.Errorf("History after Solutions has %d moves", len(h))
+	}
+	if e := (&Puzzle{}).SetActor("eve"); e == nil {
+		t.Errorf("SetActor on an invalid puzzle succeeded")
+	}
+}
@@ -0,0 +1,129 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "sync"
+
+/*
+
+Limits
+
+Servers built on this package can put hard limits on what a
+puzzle may use: how big it can be, and how long its history can
+grow.  A puzzle that would go past a limit isn't made (or the
+move isn't made) and the caller gets a quota-exceeded Error,
+whose values are the name of the limit and its setting.  The
+same kind of Error serves for the limits servers enforce
+themselves (see QuotaError), so clients handle them all alike.
+There are no limits until some are set.
+
+*/
+
+// Limits are the hard limits on puzzles.  A zero limit means
+// no limit.  The journal length counts the moves in a puzzle's
+// history, including any undone moves in a summary's journal.
+type Limits struct {
+	MaxSideLength    int `json:"maxSideLength"`
+	MaxJournalLength int `json:"maxJournalLength"`
+}
+
+// Names of limits, as given in quota-exceeded Errors.
+const (
+	SideLengthLimit     = "side-length"
+	JournalLengthLimit  = "journal-length"
+	ConcurrentJobsLimit = "concurrent-jobs"
+	SessionPuzzlesLimit = "session-puzzles"
+	RequestBodyLimit    = "request-body"
+)
+
+var (
+	limitsMutex sync.RWMutex
+	limits      Limits
+)
+
+// CurrentLimits returns the limits puzzles are held to.
+func CurrentLimits() Limits {
+	limitsMutex.RLock()
+	defer limitsMutex.RUnlock()
+	return limits
+}
+
+// SetLimits holds puzzles to the given limits from now on.
+// Puzzles that already go past them keep what they have.  It's
+// an error if a limit is negative.
+func SetLimits(l Limits) error {
+	if l.MaxSideLength < 0 {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "MaxSideLength", l.MaxSideLength)
+	}
+	if l.MaxJournalLength < 0 {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "MaxJournalLength", l.MaxJournalLength)
+	}
+	limitsMutex.Lock()
+	defer limitsMutex.Unlock()
+	limits = l
+	return nil
+}
+
+// QuotaError returns an Error describing a request that would go
+// past the named server limit, which is set to max.
+func QuotaError(limit string, max int) Error {
+	return Error{
+		Scope:     RequestScope,
+		Structure: AttributeValueStructure,
+		Attribute: LimitAttribute,
+		Condition: QuotaExceededCondition,
+		Values:    ErrorData{limit, max},
+	}
+}
+
+// quotaError: an Error for an argument that would take a puzzle
+// past the named limit.
+func quotaError(limit string, max int) Error {
+	return argumentError(LimitAttribute, QuotaExceededCondition, limit, max)
+}
+
+// checkSideLength returns a quota-exceeded Error if the side
+// length is over the limit.
+func checkSideLength(sidelen int) error {
+	if max := CurrentLimits().MaxSideLength; max > 0 && sidelen > max {
+		return quotaError(SideLengthLimit, max)
+	}
+	return nil
+}
+
+// checkJournalRoom returns a quota-exceeded Error if making the
+// given number of client moves would take the puzzle's history
+// over the limit.  Undone moves don't count, since making a move
+// forgets them.
+func (p *Puzzle) checkJournalRoom(moves int) error {
+	max := CurrentLimits().MaxJournalLength
+	if max <= 0 {
+		return nil
+	}
+	count := moves
+	if j := p.journal; j != nil {
+		for _, e := range j.entries[:j.done] {
+			count += len(e.moves)
+		}
+	}
+	if count > max {
+		return quotaError(JournalLengthLimit, max)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetLimits(t *testing.T) {
+	defer SetLimits(Limits{})
+	for _, bad := range []Limits{{MaxSideLength: -1}, {MaxJournalLength: -1}} {
+		if e := SetLimits(bad); e == nil {
+			t.Errorf("Set bad limits %+v", bad)
+		}
+	}
+	if CurrentLimits() != (Limits{}) {
+		t.Errorf("Bad limits were kept: %+v", CurrentLimits())
+	}
+	l := Limits{MaxSideLength: 9, MaxJournalLength: 100}
+	if e := SetLimits(l); e != nil || CurrentLimits() != l {
+		t.Errorf("Setting limits gave %v, limits are %+v", e, CurrentLimits())
+	}
+}
+
+func TestSideLengthLimit(t *testing.T) {
+	defer SetLimits(Limits{})
+	SetLimits(Limits{MaxSideLength: 4})
+	if _, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues}); e != nil {
+		t.Errorf("Puzzle at the limit failed: %v", e)
+	}
+	_, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	expect := quotaError(SideLengthLimit, 4)
+	if !reflect.DeepEqual(e, expect) {
+		t.Errorf("Puzzle over the limit gave %v, expected %v", e, expect)
+	}
+}
+
+func TestJournalLengthLimit(t *testing.T) {
+	defer SetLimits(Limits{})
+	SetLimits(Limits{MaxJournalLength: 2})
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	isQuota := func(e error) bool {
+		err, ok := e.(Error)
+		return ok && err.Condition == QuotaExceededCondition && err.Values[0] == JournalLengthLimit
+	}
+	if _, e := p.Assign(Choice{1, 3}); e != nil {
+		t.Fatalf("First assign failed: %v", e)
+	}
+	if _, e := p.AssignAll([]Choice{{3, 4}, {5, 8}}); !isQuota(e) {
+		t.Errorf("Assigning past the limit gave %v", e)
+	}
+	if _, e := p.Unassign(1); e != nil {
+		t.Fatalf("Unassign at the limit failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{1, 3}); !isQuota(e) {
+		t.Errorf("Assigning over the limit gave %v", e)
+	}
+
+	// undone moves don't count against the limit
+	if _, e := p.Undo(); e != nil {
+		t.Fatalf("Undo failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{3, 4}); e != nil {
+		t.Errorf("Assigning after an undo failed: %v", e)
+	}
+
+	// nor can a summary bring in a longer history
+	s := &Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues,
+		Journal: &Journal{Moves: make([]Move, 3)}}
+	if _, e := New(s); !isQuota(e) {
+		t.Errorf("Summary with a long journal gave %v", e)
+	}
+}
+
+func TestQuotaError(t *testing.T) {
+	cases := []struct {
+		err    Error
+		code   string
+		status int
+	}{
+		{QuotaError(RequestBodyLimit, 1024), "request.limit.quota-exceeded", http.StatusRequestEntityTooLarge},
+		{QuotaError(ConcurrentJobsLimit, 4), "request.limit.quota-exceeded", http.StatusServiceUnavailable},
+		{QuotaError(SessionPuzzlesLimit, 100), "request.limit.quota-exceeded", http.StatusForbidden},
+		{quotaError(SideLengthLimit, 16), "argument.limit.quota-exceeded", http.StatusForbidden},
+	}
+	for i, c := range cases {
+		if code := c.err.Code(); code != c.code {
+			t.Errorf("Case %d: code is %q, expected %q", i, code, c.code)
+		}
+		if status := c.err.HTTPStatus(); status != c.status {
+			t.Errorf("Case %d: status is %d, expected %d", i, status, c.status)
+		}
+		bytes, e := json.Marshal(c.err)
+		var decoded Error
+		if e == nil {
+			e = json.Unmarshal(bytes, &decoded)
+		}
+		if e != nil || decoded.HTTPStatus() != c.status || !reflect.DeepEqual(decoded.Values, c.err.Values) {
+			t.Errorf("Case %d: round trip gave %+v (%v)", i, decoded, e)
+		}
+	}
+	if msg := QuotaError(RequestBodyLimit, 1024).Error(); msg != "Invalid request: Limit (request-body): Exceeds the limit of 1024" {
+		t.Errorf("Quota error message is %q", msg)
+	}
+	if errors.Is(QuotaError(RequestBodyLimit, 1024), ErrOutOfRange) {
+		t.Errorf("Quota error matches ErrOutOfRange")
+	}
+
+	// bodies cut off for size decode as quota errors
+	body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(`{"index": 1, "value": 3}`)), 8)
+	var choice Choice
+	e := json.NewDecoder(body).Decode(&choice)
+	if err := DecodeError(e); !reflect.DeepEqual(err, QuotaError(RequestBodyLimit, 8)) {
+		t.Errorf("Decoding a cut-off body gave %v", err)
+	}
+}
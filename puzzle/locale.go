@@ -0,0 +1,166 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+
+Localized error messages
+
+An Error carries codes rather than text, so that clients can
+say what went wrong in whatever language (and register) suits
+their users.  The package keeps a catalog of Translators, one
+per language tag, and ships only English; clients register any
+others they need.  Web clients choose their language with the
+Accept-Language header, Go clients by calling Localize.
+
+*/
+
+// A Translator turns Errors into messages in a single language.
+// Translate returns false for any Error it can't express, and
+// the message then falls back to English.
+type Translator interface {
+	Translate(err Error) (string, bool)
+}
+
+// A TranslatorFunc is an ordinary function used as a Translator.
+type TranslatorFunc func(err Error) (string, bool)
+
+// Translate calls f(err).
+func (f TranslatorFunc) Translate(err Error) (string, bool) {
+	return f(err)
+}
+
+// DefaultLanguage is the language of the built-in messages.
+const DefaultLanguage = "en"
+
+var (
+	translatorMutex sync.RWMutex
+	translators     = map[string]Translator{
+		DefaultLanguage: TranslatorFunc(englishMessage),
+	}
+)
+
+// englishMessage is the built-in Translator.
+func englishMessage(err Error) (string, bool) {
+	return err.Error(), true
+}
+
+// RegisterTranslator makes t the Translator for the language
+// with the given tag (such as "fr" or "en-x-kids"), replacing
+// any previous one.  Tags are matched without regard to case.  A
+// nil Translator removes the language from the catalog, which
+// can be used to replace the built-in English messages but not
+// to remove them.
+func RegisterTranslator(lang string, t Translator) error {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "Language", lang)
+	}
+	translatorMutex.Lock()
+	defer translatorMutex.Unlock()
+	if t == nil {
+		if lang == DefaultLanguage {
+			t = TranslatorFunc(englishMessage)
+		} else {
+			delete(translators, lang)
+			return nil
+		}
+	}
+	translators[lang] = t
+	return nil
+}
+
+// findTranslator returns the Translator for a language tag, or
+// for its primary language if there isn't one for the full tag
+// (so "fr-CA" falls back to "fr").
+func findTranslator(lang string) (Translator, string) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	translatorMutex.RLock()
+	defer translatorMutex.RUnlock()
+	for lang != "" {
+		if t, ok := translators[lang]; ok {
+			return t, lang
+		}
+		i := strings.LastIndexByte(lang, '-')
+		if i < 0 {
+			break
+		}
+		lang = lang[:i]
+	}
+	return nil, ""
+}
+
+// Localize returns the Error's message in the given language, or
+// in English if there is no Translator for the language or the
+// Translator can't express this Error.
+func (e Error) Localize(lang string) string {
+	if t, _ := findTranslator(lang); t != nil {
+		if msg, ok := t.Translate(e); ok {
+			return msg
+		}
+	}
+	return e.Error()
+}
+
+// requestLanguage returns the most preferred language in the
+// request's Accept-Language header for which there is a
+// Translator, or DefaultLanguage if there are none.
+func requestLanguage(r *http.Request) string {
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		lang := strings.TrimSpace(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, e := strconv.ParseFloat(param[2:], 64); e == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			choices = append(choices, choice{lang, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].q > choices[j].q
+	})
+	for _, c := range choices {
+		if t, lang := findTranslator(c.lang); t != nil {
+			return lang
+		}
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,122 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// kidTranslator speaks (a very little) kid-friendly French.
+var kidTranslator = TranslatorFunc(func(err Error) (string, bool) {
+	if err.Condition == DuplicateAssignmentCondition {
+		return "Oups ! Ce chiffre est déjà là.", true
+	}
+	return "", false
+})
+
+func TestLocalize(t *testing.T) {
+	if e := RegisterTranslator("FR", kidTranslator); e != nil {
+		t.Fatalf("Failed to register translator: %v", e)
+	}
+	defer RegisterTranslator("fr", nil)
+	if e := RegisterTranslator(" ", kidTranslator); e == nil {
+		t.Errorf("Registered a translator with an empty language")
+	}
+
+	dup := Error{Scope: SquareScope, Structure: ScopeStructure, Condition: DuplicateAssignmentCondition, Values: ErrorData{1, 2}}
+	other := argumentError(IndexAttribute, TooLargeCondition, 17, 16)
+	testcases := []struct {
+		lang string
+		err  Error
+		msg  string
+	}{
+		{"fr", dup, "Oups ! Ce chiffre est déjà là."},
+		{"fr-CA", dup, "Oups ! Ce chiffre est déjà là."},
+		{"fr", other, other.Error()},
+		{"de", dup, dup.Error()},
+		{"", dup, dup.Error()},
+		{"en-US", other, other.Error()},
+	}
+	for i, tc := range testcases {
+		if msg := tc.err.Localize(tc.lang); msg != tc.msg {
+			t.Errorf("Case %d (%s): got %q, expected %q", i, tc.lang, msg, tc.msg)
+		}
+	}
+
+	// English can be replaced but not removed
+	RegisterTranslator(DefaultLanguage, TranslatorFunc(func(Error) (string, bool) {
+		return "oops", true
+	}))
+	if msg := other.Localize(DefaultLanguage); msg != "oops" {
+		t.Errorf("Replaced English gave %q", msg)
+	}
+	RegisterTranslator(DefaultLanguage, nil)
+	if msg := other.Localize(DefaultLanguage); msg != other.Error() {
+		t.Errorf("Restored English gave %q", msg)
+	}
+}
+
+func TestRequestLanguage(t *testing.T) {
+	RegisterTranslator("fr", kidTranslator)
+	defer RegisterTranslator("fr", nil)
+	testcases := []struct {
+		header, lang string
+	}{
+		{"", DefaultLanguage},
+		{"de", DefaultLanguage},
+		{"fr", "fr"},
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr"},
+		{"en;q=0.8, fr;q=0.9", "fr"},
+		{"fr;q=0, en", "en"},
+		{"*, de;q=0.5", DefaultLanguage},
+	}
+	for _, tc := range testcases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", tc.header)
+		if lang := requestLanguage(r); lang != tc.lang {
+			t.Errorf("Header %q: got language %q, expected %q", tc.header, lang, tc.lang)
+		}
+	}
+}
+
+func TestSendErrorLocalized(t *testing.T) {
+	RegisterTranslator("fr", kidTranslator)
+	defer RegisterTranslator("fr", nil)
+	dup := Error{Scope: SquareScope, Structure: ScopeStructure, Condition: DuplicateAssignmentCondition, Values: ErrorData{1, 2}}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "fr-FR,en;q=0.5")
+	SendError(dup, w, r)
+	if lang := w.Header().Get("Content-Language"); lang != "fr" {
+		t.Errorf("Content-Language was %q, expected %q", lang, "fr")
+	}
+	var err Error
+	if e := json.Unmarshal(w.Body.Bytes(), &err); e != nil {
+		t.Fatalf("Failed to decode error: %v", e)
+	}
+	if err.Message != "Oups ! Ce chiffre est déjà là." {
+		t.Errorf("Message was %q", err.Message)
+	}
+	if w.Code == http.StatusOK {
+		t.Errorf("Error was sent with an OK status")
+	}
+}
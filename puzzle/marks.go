@@ -0,0 +1,163 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Pencil marks
+
+Players who solve by hand often note the values they think an
+empty square might take.  These marks are kept separately from
+the possible values computed by the puzzle: the puzzle never
+changes them, and they play no part in assignments or errors.
+Marks on a square are kept while it's assigned, but are only
+reported while it's empty.
+
+*/
+
+// marksOf returns a copy of the marks on a square (or nil).
+func (p *Puzzle) marksOf(idx int) intset {
+	if p.marks == nil {
+		return nil
+	}
+	return newIntsetCopy(p.marks[idx])
+}
+
+// copyMarks returns a copy of the puzzle's marks.
+func (p *Puzzle) copyMarks() []intset {
+	if p.marks == nil {
+		return nil
+	}
+	result := make([]intset, len(p.marks))
+	for i, ms := range p.marks {
+		result[i] = newIntsetCopy(ms)
+	}
+	return result
+}
+
+// allMarks returns the marks on the puzzle's squares, keyed by
+// square index, or nil if there are none.
+func (p *Puzzle) allMarks() map[int][]int {
+	var result map[int][]int
+	for idx, ms := range p.marks {
+		if len(ms) > 0 {
+			if result == nil {
+				result = make(map[int][]int)
+			}
+			result[idx] = newIntsetCopy(ms)
+		}
+	}
+	return result
+}
+
+// setMarks replaces the marks on the puzzle's squares with the
+// given ones, validating them first.
+func (p *Puzzle) setMarks(marks map[int][]int) error {
+	if len(marks) == 0 {
+		p.marks = nil
+		return nil
+	}
+	result := make([]intset, p.mapping.scount+1) // 1-based indexing
+	for idx, ms := range marks {
+		if idx < 1 || idx > p.mapping.scount {
+			return rangeError(IndexAttribute, idx, 1, p.mapping.scount)
+		}
+		for _, m := range ms {
+			if m < 1 || m > p.mapping.sidelen {
+				return rangeError(MarkAttribute, m, 1, p.mapping.sidelen)
+			}
+			result[idx].insert(m)
+		}
+	}
+	p.marks = result
+	return nil
+}
+
+// checkMark validates the arguments to a mark operation.  A
+// value of 0 skips the value check.
+func (p *Puzzle) checkMark(idx, val int) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if idx < 1 || idx > p.mapping.scount {
+		return rangeError(IndexAttribute, idx, 1, p.mapping.scount)
+	}
+	if val != 0 && (val < 1 || val > p.mapping.sidelen) {
+		return rangeError(MarkAttribute, val, 1, p.mapping.sidelen)
+	}
+	if aval := p.squares[idx].aval; aval != 0 {
+		err := Error{
+			Scope:     ArgumentScope,
+			Structure: AttributeValueStructure,
+			Attribute: MarkAttribute,
+			Condition: DuplicateAssignmentCondition,
+			Values:    ErrorData{val, idx, aval},
+		}
+		err.Message = err.Error()
+		return err
+	}
+	return nil
+}
+
+// markUpdate counts a change to the marks on a square and
+// returns the update for it.
+func (p *Puzzle) markUpdate(idx int) *Content {
+	p.changes++
+	return p.update(intset{idx})
+}
+
+// AddMark adds a pencil mark for a value to an empty square,
+// returning an update to the puzzle's State.  It's an Error if
+// the index or value is out of range, or the square is
+// assigned.
+func (p *Puzzle) AddMark(index, value int) (*Content, error) {
+	if err := p.checkMark(index, value); err != nil {
+		return nil, err
+	}
+	if p.marks == nil {
+		p.marks = make([]intset, p.mapping.scount+1) // 1-based indexing
+	}
+	p.marks[index].insert(value)
+	return p.markUpdate(index), nil
+}
+
+// RemoveMark removes the pencil mark for a value from an empty
+// square, returning an update to the puzzle's State.  Removing a
+// mark that isn't there is not an Error.
+func (p *Puzzle) RemoveMark(index, value int) (*Content, error) {
+	if err := p.checkMark(index, value); err != nil {
+		return nil, err
+	}
+	if p.marks != nil {
+		p.marks[index].remove(value)
+	}
+	return p.markUpdate(index), nil
+}
+
+// ClearMarks removes all the pencil marks from an empty square,
+// returning an update to the puzzle's State.
+func (p *Puzzle) ClearMarks(index int) (*Content, error) {
+	if err := p.checkMark(index, 0); err != nil {
+		return nil, err
+	}
+	if p.marks != nil {
+		p.marks[index] = nil
+	}
+	return p.markUpdate(index), nil
+}
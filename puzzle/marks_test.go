@@ -0,0 +1,118 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMarks(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	etag := p.etag()
+	update, e := p.AddMark(2, 4)
+	if e != nil {
+		t.Fatalf("AddMark(2, 4) failed: %v", e)
+	}
+	if len(update.Squares) != 1 || !reflect.DeepEqual(update.Squares[0].Marks, intset{4}) {
+		t.Errorf("AddMark(2, 4) returned update %+v", update)
+	}
+	if p.etag() == etag {
+		t.Errorf("AddMark didn't change the ETag")
+	}
+	// marks are independent of possible values
+	p.AddMark(2, 3)
+	p.AddMark(2, 1)
+	p.AddMark(2, 3)
+	if ms := p.allSquares()[1].Marks; !reflect.DeepEqual(ms, intset{1, 3, 4}) {
+		t.Errorf("Marks on square 2 are %v, expected [1 3 4]", ms)
+	}
+	if pvs := p.allSquares()[1].Pvals; !reflect.DeepEqual(pvs, intset{2, 4}) {
+		t.Errorf("Marks changed possible values on square 2 to %v", pvs)
+	}
+	if update, _ := p.RemoveMark(2, 1); !reflect.DeepEqual(update.Squares[0].Marks, intset{3, 4}) {
+		t.Errorf("RemoveMark(2, 1) returned update %+v", update)
+	}
+	if _, e := p.RemoveMark(2, 2); e != nil {
+		t.Errorf("RemoveMark of missing mark failed: %v", e)
+	}
+	p.AddMark(4, 2)
+
+	// marks survive summaries and copies
+	bytes, e := json.Marshal(p.summary())
+	if e != nil {
+		t.Fatalf("Failed to encode summary: %v", e)
+	}
+	var summary Summary
+	if e := json.Unmarshal(bytes, &summary); e != nil {
+		t.Fatalf("Failed to decode summary: %v", e)
+	}
+	expected := map[int][]int{2: {3, 4}, 4: {2}}
+	if !reflect.DeepEqual(summary.Marks, expected) {
+		t.Errorf("Summary marks are %v, expected %v", summary.Marks, expected)
+	}
+	r, e := New(&summary)
+	if e != nil {
+		t.Fatalf("Failed to create puzzle from summary with marks: %v", e)
+	}
+	c := r.copy()
+	c.ClearMarks(2)
+	if !reflect.DeepEqual(r.allSquares(), p.allSquares()) {
+		t.Errorf("Puzzle from summary has squares %v, expected %v", r.allSquares(), p.allSquares())
+	}
+	if ms := c.allSquares()[1].Marks; ms != nil {
+		t.Errorf("ClearMarks(2) left marks %v", ms)
+	}
+
+	// marks on assigned squares are kept but not shown
+	p.Assign(Choice{4, 4})
+	if ms := p.allSquares()[3].Marks; ms != nil {
+		t.Errorf("Assigned square shows marks %v", ms)
+	}
+	if _, e := p.AddMark(4, 1); e == nil || e.(Error).Condition != DuplicateAssignmentCondition {
+		t.Errorf("AddMark on assigned square gave incorrect error: %v", e)
+	}
+	p.Unassign(4)
+	if ms := p.allSquares()[3].Marks; !reflect.DeepEqual(ms, intset{2}) {
+		t.Errorf("Unassigned square shows marks %v, expected [2]", ms)
+	}
+
+	// error cases
+	if _, e := p.AddMark(0, 1); e == nil || e.(Error).Condition != TooSmallCondition {
+		t.Errorf("AddMark with index too small gave incorrect error: %v", e)
+	}
+	if _, e := p.AddMark(2, 5); e == nil || e.(Error).Attribute != MarkAttribute {
+		t.Errorf("AddMark with value too large gave incorrect error: %v", e)
+	}
+	if _, e := (&Puzzle{}).ClearMarks(1); e == nil || e.(Error).Condition != InvalidArgumentCondition {
+		t.Errorf("ClearMarks on invalid puzzle gave incorrect error: %v", e)
+	}
+	summary.Marks = map[int][]int{17: {1}}
+	if _, e := New(&summary); e == nil {
+		t.Errorf("Summary with bad mark index didn't fail")
+	}
+	summary.Marks = map[int][]int{1: {9}}
+	if _, e := New(&summary); e == nil {
+		t.Errorf("Summary with bad mark value didn't fail")
+	}
+}
@@ -0,0 +1,116 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"unsafe"
+)
+
+/*
+
+Memory usage
+
+Big variant puzzles (and long journals) take a lot of memory,
+so servers holding many of them need to know how much each one
+takes.  The estimates here count the puzzle's own structures
+and the storage they reference, at its allocated capacity, but
+not the mapping (which is shared by all puzzles of the same
+geometry and size) or allocator and map overhead.
+
+*/
+
+// A MemStats gives the approximate number of bytes used by the
+// parts of a puzzle.  Squares includes the squares' bindings,
+// pencil marks, and versions; Pvals is the squares' possible values; Groups
+// includes the groups' candidate sets; Journal includes the
+// images saved with the moves; Metadata includes the Info; and
+// Encodings is the cached JSON of the puzzle's summary and state.
+type MemStats struct {
+	Squares   int `json:"squares"`
+	Pvals     int `json:"pvals"`
+	Groups    int `json:"groups"`
+	Journal   int `json:"journal"`
+	Metadata  int `json:"metadata"`
+	Encodings int `json:"encodings"`
+	Total     int `json:"total"`
+}
+
+// sizes of the puzzle's building blocks
+const (
+	intBytes     = int(unsafe.Sizeof(int(0)))
+	pointerBytes = int(unsafe.Sizeof(uintptr(0)))
+	stringBytes  = int(unsafe.Sizeof(""))
+	sliceBytes   = int(unsafe.Sizeof([]int(nil)))
+	squareBytes  = int(unsafe.Sizeof(square{}))
+	bitsetBytes  = int(unsafe.Sizeof(bitset(0)))
+	groupBytes   = int(unsafe.Sizeof(group{}))
+	groupIDBytes = int(unsafe.Sizeof(GroupID{}))
+	errorBytes   = int(unsafe.Sizeof(Error{}))
+	moveBytes    = int(unsafe.Sizeof(Move{}))
+	entryBytes   = int(unsafe.Sizeof(journalEntry{}))
+)
+
+// MemStats estimates the memory used by the puzzle.  It's an
+// Error if the puzzle isn't valid.
+func (p *Puzzle) MemStats() (*MemStats, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	ms := &MemStats{}
+	ms.Squares = cap(p.squares)*pointerBytes + p.mapping.scount*(squareBytes-bitsetBytes)
+	ms.Pvals = p.mapping.scount * bitsetBytes
+	for _, s := range p.squares[1:] {
+		ms.Squares += cap(s.bsrc) * groupIDBytes
+	}
+	ms.Squares += cap(p.marks) * sliceBytes
+	for _, m := range p.marks {
+		ms.Squares += cap(m) * intBytes
+	}
+	ms.Squares += cap(p.versions) * intBytes
+	ms.Groups = cap(p.groups)*pointerBytes + p.mapping.gcount*groupBytes
+	for _, g := range p.groups[1:] {
+		ms.Groups += (cap(g.where) + cap(g.free)) * intBytes
+	}
+	if j := p.journal; j != nil {
+		ms.Journal = cap(j.entries)*pointerBytes + cap(j.checkpoints)*int(unsafe.Sizeof(checkpoint{}))
+		for _, e := range j.entries {
+			ms.Journal += entryBytes + cap(e.moves)*moveBytes
+			for _, m := range e.moves {
+				ms.Journal += len(m.Actor)
+			}
+			ms.Journal += (cap(e.sindices) + cap(e.gindices) + cap(e.ints)) * intBytes
+			ms.Journal += cap(e.squares)*squareBytes + cap(e.groups)*groupBytes
+			for _, s := range e.squares {
+				ms.Journal += cap(s.bsrc) * groupIDBytes
+			}
+			ms.Journal += cap(e.errors) * errorBytes
+		}
+	}
+	for k, v := range p.Metadata {
+		ms.Metadata += 2*stringBytes + len(k) + len(v)
+	}
+	ms.Metadata += len(p.Info.Name) + len(p.Info.Author) + len(p.Info.Source)
+	ms.Metadata += cap(p.Info.Tags) * stringBytes
+	for _, tag := range p.Info.Tags {
+		ms.Metadata += len(tag)
+	}
+	ms.Encodings = p.cachedBytes()
+	ms.Total = ms.Squares + ms.Pvals + ms.Groups + ms.Journal + ms.Metadata + ms.Encodings
+	return ms, nil
+}
@@ -0,0 +1,86 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"testing"
+)
+
+func TestMemStats(t *testing.T) {
+	if _, e := (*Puzzle)(nil).MemStats(); e == nil {
+		t.Errorf("MemStats of nil puzzle succeeded")
+	}
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	ms, e := p.MemStats()
+	if e != nil {
+		t.Fatalf("MemStats failed: %v", e)
+	}
+	if pvals := 81 * bitsetBytes; ms.Pvals != pvals {
+		t.Errorf("Pvals is %d, expected %d", ms.Pvals, pvals)
+	}
+	if min := 81 * (squareBytes - bitsetBytes); ms.Squares < min {
+		t.Errorf("Squares is %d, expected at least %d", ms.Squares, min)
+	}
+	if min := 27 * (groupBytes + 19*intBytes); ms.Groups < min {
+		t.Errorf("Groups is %d, expected at least %d", ms.Groups, min)
+	}
+	if ms.Journal != 0 || ms.Metadata != 0 {
+		t.Errorf("New puzzle has journal %d, metadata %d", ms.Journal, ms.Metadata)
+	}
+	if ms.Total != ms.Squares+ms.Pvals+ms.Groups+ms.Journal+ms.Metadata+ms.Encodings {
+		t.Errorf("Total %d is not the sum of the parts in %+v", ms.Total, *ms)
+	}
+
+	// moves and metadata add to the total
+	if _, e := p.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if e := p.SetMetadata("name", "threeStar"); e != nil {
+		t.Fatalf("SetMetadata failed: %v", e)
+	}
+	after, e := p.MemStats()
+	if e != nil {
+		t.Fatalf("MemStats failed: %v", e)
+	}
+	if after.Journal <= 0 {
+		t.Errorf("Journal is %d after a move", after.Journal)
+	}
+	if expected := 2*stringBytes + len("name") + len("threeStar"); after.Metadata != expected {
+		t.Errorf("Metadata is %d, expected %d", after.Metadata, expected)
+	}
+	if after.Total <= ms.Total {
+		t.Errorf("Total went from %d to %d", ms.Total, after.Total)
+	}
+
+	// bigger puzzles take more
+	big, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 25})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	bms, e := big.MemStats()
+	if e != nil {
+		t.Fatalf("MemStats failed: %v", e)
+	}
+	if bms.Total <= 5*ms.Total {
+		t.Errorf("25x25 total %d isn't much bigger than 9x9 total %d", bms.Total, ms.Total)
+	}
+}
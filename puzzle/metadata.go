@@ -0,0 +1,126 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "strings"
+
+/*
+
+Metadata policy
+
+Puzzle metadata is stored and served along with the puzzle, so
+it has to be kept to a sensible size, and keys that the package
+writes itself (those starting with ReservedMetadataPrefix) must
+not be settable by clients.  Metadata from a trusted source,
+such as storage, may use reserved keys; metadata from a client
+request may not.
+
+*/
+
+// ReservedMetadataPrefix starts every metadata key that is
+// reserved for use by the puzzle package.
+const ReservedMetadataPrefix = "susen."
+
+// Limits on the size of puzzle metadata.
+const (
+	maxMetadataEntries     = 50
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 1024
+)
+
+// MetadataValidator, if non-nil, is called on each metadata entry
+// after the package's own checks have passed.  A non-nil return
+// rejects the metadata.  It should be set during initialization,
+// before any puzzles are created.
+var MetadataValidator func(key, value string) error
+
+// validMetadataKey reports whether a key is non-empty and not
+// too long.  Any characters are allowed, since stored puzzles use
+// all sorts of keys.
+func validMetadataKey(key string) bool {
+	return key != "" && len(key) <= maxMetadataKeyLength
+}
+
+// validateMetadata returns an Error if the metadata is too large,
+// has an empty or over-long key or an over-long value, or is rejected by
+// the MetadataValidator.  Unless allowReserved is true, it is also
+// an error for any key to start with ReservedMetadataPrefix.
+func validateMetadata(md map[string]string, allowReserved bool) error {
+	if len(md) > maxMetadataEntries {
+		return argumentError(MetadataAttribute, TooLargeCondition, len(md), maxMetadataEntries)
+	}
+	for k, v := range md {
+		if !validMetadataKey(k) {
+			return argumentError(MetadataAttribute, InvalidArgumentCondition, k)
+		}
+		if !allowReserved && strings.HasPrefix(k, ReservedMetadataPrefix) {
+			return argumentError(MetadataAttribute, ReservedKeyCondition, k)
+		}
+		if len(v) > maxMetadataValueLength {
+			return argumentError(MetadataAttribute, TooLargeCondition, len(v), maxMetadataValueLength)
+		}
+	}
+	if MetadataValidator != nil {
+		for k, v := range md {
+			if e := MetadataValidator(k, v); e != nil {
+				err := argumentError(MetadataAttribute, InvalidArgumentCondition, k)
+				err.Message = e.Error()
+				err.cause = e
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetMetadata sets an entry in the puzzle's metadata, or removes
+// the entry if the value is empty.  The host program is trusted,
+// so the key may be reserved, except for AssistMetadataKey, which
+// is set by SetAssist.  It's an Error if the entry would make the
+// metadata invalid.  Changing the metadata makes a new version of
+// the puzzle.
+func (p *Puzzle) SetMetadata(key, value string) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if key == AssistMetadataKey {
+		return argumentError(MetadataAttribute, ReservedKeyCondition, key)
+	}
+	if old, ok := p.Metadata[key]; ok == (value != "") && old == value {
+		return nil
+	}
+	md := p.allMetadata()
+	if value == "" {
+		delete(md, key)
+	} else {
+		if md == nil {
+			md = make(map[string]string)
+		}
+		md[key] = value
+	}
+	if e := validateMetadata(md, true); e != nil {
+		return e
+	}
+	if len(md) == 0 {
+		md = nil
+	}
+	p.Metadata = md
+	p.changes++
+	return nil
+}
@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tooMany := make(map[string]string, maxMetadataEntries+1)
+	for i := 0; i <= maxMetadataEntries; i++ {
+		tooMany[strings.Repeat("k", i+1)] = "v"
+	}
+	testcases := []struct {
+		name          string
+		md            map[string]string
+		allowReserved bool
+		cond          ErrorCondition
+	}{
+		{"nil", nil, false, UnknownCondition},
+		{"ordinary", map[string]string{"name": "x", "client.id-2_b": "y"}, false, UnknownCondition},
+		{"reserved allowed", map[string]string{ReservedMetadataPrefix + "id": "x"}, true, UnknownCondition},
+		{"reserved", map[string]string{ReservedMetadataPrefix + "id": "x"}, false, ReservedKeyCondition},
+		{"empty key", map[string]string{"": "x"}, true, InvalidArgumentCondition},
+		{"any characters", map[string]string{"Name": "x", "source key": "y", "日付": "z"}, false, UnknownCondition},
+		{"long key", map[string]string{strings.Repeat("k", maxMetadataKeyLength+1): "x"}, true, InvalidArgumentCondition},
+		{"long value", map[string]string{"k": strings.Repeat("v", maxMetadataValueLength+1)}, true, TooLargeCondition},
+		{"too many", tooMany, true, TooLargeCondition},
+	}
+	for _, tc := range testcases {
+		e := validateMetadata(tc.md, tc.allowReserved)
+		if tc.cond == UnknownCondition {
+			if e != nil {
+				t.Errorf("Test %s: unexpected error: %v", tc.name, e)
+			}
+			continue
+		}
+		err, ok := e.(Error)
+		if !ok {
+			t.Errorf("Test %s: expected an Error, got %v", tc.name, e)
+			continue
+		}
+		if err.Attribute != MetadataAttribute || err.Condition != tc.cond {
+			t.Errorf("Test %s: got %v/%v, expected %v/%v",
+				tc.name, err.Attribute, err.Condition, MetadataAttribute, tc.cond)
+		}
+	}
+}
+
+func TestMetadataValidator(t *testing.T) {
+	defer func() { MetadataValidator = nil }()
+	MetadataValidator = func(key, value string) error {
+		if value == "bad" {
+			return errors.New("no bad values")
+		}
+		return nil
+	}
+	summary := &Summary{Metadata: map[string]string{"k": "bad"}, Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues}
+	_, e := New(summary)
+	if err, ok := e.(Error); !ok || err.Attribute != MetadataAttribute || err.Error() != "no bad values" {
+		t.Errorf("New with rejected metadata gave %v, expected validator error", e)
+	}
+	summary.Metadata["k"] = "good"
+	p, e := New(summary)
+	if e != nil {
+		t.Fatalf("New with accepted metadata failed: %v", e)
+	}
+
+	// metadata set after creation is checked as it's set
+	if e := p.SetMetadata("k", "bad"); e == nil {
+		t.Errorf("SetMetadata succeeded with rejected metadata")
+	}
+	if p.Metadata["k"] != "good" {
+		t.Errorf("Rejected metadata was set: %v", p.Metadata)
+	}
+	if e := p.SetMetadata(ReservedMetadataPrefix+"id", "trusted"); e != nil {
+		t.Errorf("SetMetadata with a reserved key failed: %v", e)
+	}
+	if e := p.SetMetadata(AssistMetadataKey, "none"); e == nil {
+		t.Errorf("SetMetadata set the assist level")
+	}
+	if e := p.SetMetadata("k", ""); e != nil || len(p.Metadata) != 1 {
+		t.Errorf("SetMetadata didn't remove a key: %v, %v", p.Metadata, e)
+	}
+	if _, e := p.Summary(); e != nil {
+		t.Errorf("Summary with a reserved key failed: %v", e)
+	}
+
+	// metadata changed directly is checked on the way out
+	p.Metadata["k"] = "bad"
+	if _, e := p.Summary(); e == nil {
+		t.Errorf("Summary succeeded with rejected metadata")
+	}
+}
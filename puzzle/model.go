@@ -46,8 +46,9 @@
 // square being equal in length to the area of one tile (e.g, 4x3
 // tiles and a 12x12 square).
 //
-// Another Sudoku variant, not yet implemented, uses the Standard
-// geometry but adds the diagonals as two additional groups.
+// Variants such as Diagonal, Anti-knight, and Killer Sudoku add
+// constraints to a geometry, and can be combined: a puzzle's
+// summary lists the constraint sets it stacks on its geometry.
 //
 // If a square in a group is the only possible location for a
 // needed value, we say that the square is bound by the group,
@@ -60,8 +61,12 @@
 package puzzle
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
 )
 
 /*
@@ -71,20 +76,34 @@ Puzzles
 */
 
 // A Puzzle is our puzzle implementation.  The puzzle's Metadata
-// is a convenience for clients who manipulate puzzles; it is
-// ignored by the puzzle operations.
+// and Info are a convenience for clients who manipulate puzzles;
+// they are ignored by the puzzle operations.  Clients may change
+// them directly, or with SetMetadata and SetInfo (which check the
+// change as New would).
 //
 // The zero Puzzle value does not represent a valid puzzle;
 // always use New to create one.  Also, do not try to copy
 // puzzles by assigning them, use Copy instead.
 type Puzzle struct {
-	Metadata map[string]string
-	mapping  *puzzleMapping
-	squares  []*square
-	groups   []*group
-	errors   []Error
-	logger   *indexLogger
-	valid    bool
+	Metadata  map[string]string
+	Info      Info
+	mapping   *puzzleMapping
+	squares   []*square
+	groups    []*group
+	errors    []Error
+	logger    *indexLogger
+	journal   *journal        // moves made by clients, if any
+	marks     []intset        // pencil marks made by clients, if any
+	notes     []Annotation    // annotations made by clients, if any
+	givens    intset          // indices of squares holding the original clues
+	assist    AssistLevel     // how much analysis the squares show
+	actor     string          // who is making client moves, if known
+	observers []*observer     // change observers, if any
+	ctx       context.Context // set during context-aware operations
+	changes   int             // count of changes made to the puzzle
+	versions  []int           // change count at each square's last change, if any
+	encodings encodingCache   // encodings of the summary and state, if cached
+	valid     bool
 }
 
 // isValid checks whether a Puzzle pointer is non-nil and points
@@ -127,7 +146,9 @@ func (p *Puzzle) allValues() []int {
 func (p *Puzzle) indicesToPossibles(is intset) [][]int {
 	vs := make([][]int, len(is))
 	for i, idx := range is {
-		vs[i] = newIntsetCopy(p.squares[idx].pvals)
+		if s := p.squares[idx]; s.aval == 0 {
+			vs[i] = s.pvals.intset()
+		}
 	}
 	return vs
 }
@@ -140,30 +161,111 @@ func (p *Puzzle) allPossibles() [][]int {
 }
 
 // indicesToSquares is a helper that takes an intset of indices
-// and creates a slice of Squares for those indices.
+// and creates a slice of Squares for those indices.  The
+// Squares' sets are carved out of two shared arrays rather than
+// allocated one by one, since updates are made for every move.
 func (p *Puzzle) indicesToSquares(is intset) []Square {
 	SS := make([]Square, len(is))
-	for i, idx := range is {
-		S, s := &SS[i], p.squares[idx]
-		S.Index = s.index
-		if s.aval != 0 {
-			S.Aval = s.aval
-			continue
-		}
-		S.Pvals = newIntsetCopy(s.pvals)
-		if len(s.pvals) == 1 {
-			// don't return bindings if only one value,
-			// because they are extraneous and confusing.
-			continue
-		}
-		if s.bval != 0 {
-			S.Bval = s.bval
-			S.Bsrc = append(S.Bsrc, s.bsrc...)
+	nints, ngids := 0, 0
+	for _, idx := range is {
+		if s := p.squares[idx]; s.aval == 0 {
+			nints += s.pvals.len()
+			ngids += len(s.bsrc)
+			if p.marks != nil {
+				nints += len(p.marks[idx])
+			}
 		}
 	}
+	st := &squareStorage{make([]int, 0, nints), make([]GroupID, 0, ngids)}
+	for i, idx := range is {
+		SS[i] = p.makeSquare(idx, st)
+	}
 	return SS
 }
 
+// indexToSquare returns the public Square for an index.
+func (p *Puzzle) indexToSquare(idx int) Square {
+	return p.makeSquare(idx, nil)
+}
+
+// makeSquare returns the public Square for an index, with its
+// sets kept in the given storage (or allocated, if it's nil).
+func (p *Puzzle) makeSquare(idx int, st *squareStorage) Square {
+	var S Square
+	s := p.squares[idx]
+	S.Index = s.index
+	if s.aval != 0 {
+		S.Aval = s.aval
+		S.Entered = !p.isGiven(idx)
+		return S
+	}
+	if p.marks != nil {
+		S.Marks = st.keepInts(p.marks[idx])
+	}
+	if p.assist == AssistNone {
+		return S
+	}
+	S.Pvals = st.keepBits(s.pvals)
+	if s.pvals.len() == 1 || p.assist == AssistCandidates {
+		// don't return bindings if only one value,
+		// because they are extraneous and confusing,
+		// or if the assist level hides them.
+		return S
+	}
+	if s.bval != 0 {
+		S.Bval = s.bval
+		S.Bsrc = st.keepGroups(s.bsrc)
+	}
+	return S
+}
+
+// squareStorage holds the sets of a batch of public Squares.
+type squareStorage struct {
+	ints []int
+	gids []GroupID
+}
+
+// keepInts copies an intset into the storage, or allocates a
+// copy if there's no storage.  Like journal images, the copies
+// have capped capacity so appending to one can't overwrite
+// another.
+func (st *squareStorage) keepInts(is intset) intset {
+	if st == nil || is == nil {
+		return newIntsetCopy(is)
+	}
+	start := len(st.ints)
+	st.ints = append(st.ints, is...)
+	return st.ints[start:len(st.ints):len(st.ints)]
+}
+
+// keepBits copies the values in a bitset into the storage, as
+// keepInts does for an intset.
+func (st *squareStorage) keepBits(bs bitset) intset {
+	if st == nil {
+		return bs.intset()
+	}
+	start := len(st.ints)
+	for v := range bs.values() {
+		st.ints = append(st.ints, v)
+	}
+	return st.ints[start:len(st.ints):len(st.ints)]
+}
+
+// keepGroups copies a list of group IDs into the storage, or
+// allocates a copy if there's no storage.  Empty lists are kept
+// as nil.
+func (st *squareStorage) keepGroups(gids []GroupID) []GroupID {
+	if len(gids) == 0 {
+		return nil
+	}
+	if st == nil {
+		return append([]GroupID(nil), gids...)
+	}
+	start := len(st.gids)
+	st.gids = append(st.gids, gids...)
+	return st.gids[start:len(st.gids):len(st.gids)]
+}
+
 // allSquares returns a Square for each of a puzzle's squares.
 func (p *Puzzle) allSquares() []Square {
 	is := newIntsetRange(p.mapping.scount)
@@ -184,17 +286,17 @@ func (p *Puzzle) allErrors(verbose bool) []Error {
 
 // hash returns the current hash of a puzzle.
 func (p *Puzzle) hash() Signature {
-	return computeHash(p.mapping.geometry, p.allValues())
+	return computeHash(p.mapping.geometry+p.mapping.stackKey(), p.allValues())
 }
 
 // hash also works on summaries.
 func (s *Summary) hash() Signature {
-	return computeHash(s.Geometry, s.Values)
+	return computeHash(s.Geometry+constraintsKey(s.Constraints), s.Values)
 }
 
-// do the actual hashing work.  We hash the geometry name and the
-// values in case there are two different geometries that can use
-// the same value.
+// do the actual hashing work.  We hash the geometry name (with
+// the key of any constraints) and the values in case there are
+// two different geometries that can use the same value.
 func computeHash(geo string, vals []int) Signature {
 	glen, vlen := len(geo), len(vals)
 	bytes := make([]byte, glen+vlen)
@@ -211,12 +313,18 @@ func computeHash(geo string, vals []int) Signature {
 // summary returns the current summary of a puzzle.
 func (p *Puzzle) summary() *Summary {
 	return &Summary{
-		Metadata:   p.allMetadata(),
-		Geometry:   p.mapping.geometry,
-		SideLength: p.mapping.sidelen,
-		Values:     p.allValues(),
-		Errors:     p.allErrors(true),
+		Metadata:    p.allMetadata(),
+		Info:        p.Info.summary(),
+		Geometry:    p.mapping.geometry,
+		SideLength:  p.mapping.sidelen,
+		Values:      p.allValues(),
+		Errors:      p.allErrors(true),
+		Marks:       p.allMarks(),
+		Entered:     p.allEntered(),
+		Annotations: copyAnnotations(p.notes),
+		Constraints: p.mapping.constraints(),
 	}
+
 }
 
 // state returns the current state (full content) of a puzzle.
@@ -236,10 +344,16 @@ func (p *Puzzle) state() *Content {
 // the assignment or the constraint relaxation are added to the
 // puzzle.
 func (p *Puzzle) assign(idx, val int) intset {
+	// count the change
+	p.changes++
 	// set up to log the affected squares, so they can be returned.
 	p.logger.start(idx)
 	// after we're done, reset the puzzle logger
 	defer func() { p.logger.stop() }()
+	if p.logger.tracing() {
+		p.logger.trace("puzzle assign", "index", idx, "value", val)
+		defer func(count int) { p.logger.traceErrors(p.errors[count:]) }(len(p.errors))
+	}
 
 	// do the assignment
 	errs := p.squares[idx].assign(val)
@@ -256,20 +370,8 @@ func (p *Puzzle) assign(idx, val int) intset {
 	// containing unassigned squares in those three containing
 	// groups (because those unassigned squares will have the
 	// assigned value removed).
-	affected := make([]int, p.mapping.gcount+1) // 1-based group indexes
-	for _, gi := range p.mapping.ixmap[idx] {
-		// this group needs to be analyzed
-		affected[gi]++
-		for _, ei := range p.mapping.gdescs[gi].indices {
-			// and for each of its unassigned squares...
-			if p.squares[ei].aval == 0 {
-				// ... its containing groups need to be analyzed
-				for _, gi := range p.mapping.ixmap[ei] {
-					affected[gi]++
-				}
-			}
-		}
-	}
+	var buf [maxGroupCount + 1]int
+	affected := p.affectedGroups(idx, buf[:])
 
 	// Part 2: Notify the three groups containing the assigned
 	// square of the assignment.  Each of them will remove the
@@ -283,35 +385,230 @@ func (p *Puzzle) assign(idx, val int) intset {
 		}
 	}
 
+	// Then the puzzle's constraints (if any) remove the assigned
+	// value from squares they keep from sharing it, and enforce
+	// their rules on the squares they cover.
+	if len(p.errors) == 0 && p.mapping.stack != nil {
+		p.errors = append(p.errors, p.mapping.stack.assign(p.squares, idx)...)
+	}
+
 	/// Part 3: Analyze all the affected groups.  This allows
 	/// them to discover solvability problems and also required
 	/// bindings induced by the assignment.
 	if len(p.errors) == 0 {
 		// no need to analyze if we already have errors; in fact,
 		// it may duplicate some of the already found errors.
+		var gbuf [maxGroupCount]int
+		gis := gbuf[:0]
+		for _, gi := range p.mapping.pgroups[idx] {
+			if affected[gi] > 0 {
+				gis = append(gis, gi)
+			}
+		}
+		// group analyze Errors make the puzzle unsolvable, so
+		// all we need is the first error to know we're
+		// unsolvable!  If the operation is canceled, the caller
+		// will take back the assignment.
+		p.errors = append(p.errors, analyzeGroups(p.groups, gis, p.squares, true, p.canceled)...)
+	}
+	return p.logger.entries
+}
+
+// affectedGroups finds the groups that can be affected by an
+// assignment to (or unassignment of) a square.  These are not
+// just the groups containing the square, but also the groups
+// containing unassigned peers of the square (because those
+// unassigned squares will have their possible values changed).
+// The result is indexed by group, and the groups with non-zero
+// counts are the affected ones; they are all among the square's
+// peer groups in the mapping.  It's made in the given buffer, if
+// that's big enough, so callers can keep it off the heap.
+func (p *Puzzle) affectedGroups(idx int, buf []int) []int {
+	var affected []int // 1-based group indexes
+	if n := p.mapping.gcount + 1; cap(buf) >= n {
+		affected = buf[:n]
+		clear(affected)
+	} else {
+		affected = make([]int, n)
+	}
+	for _, gi := range p.mapping.ixmap[idx] {
+		// the square's groups need to be analyzed
+		affected[gi]++
+	}
+	for _, ei := range p.mapping.peers[idx] {
+		// and for each of its unassigned peers...
+		if p.squares[ei].aval == 0 {
+			// ... their containing groups need to be analyzed
+			for _, gi := range p.mapping.ixmap[ei] {
+				affected[gi]++
+			}
+		}
+	}
+	return affected
+}
+
+// groupSquares returns the indices of all the squares in the
+// groups with non-zero counts among the given groups.
+func (p *Puzzle) groupSquares(gis []int, counts []int) intset {
+	var is intset
+	for _, gi := range gis {
+		if counts[gi] > 0 {
+			for _, i := range p.mapping.gdescs[gi].indices {
+				is.insert(i)
+			}
+		}
+	}
+	return is
+}
+
+// unassign clears the value assigned to a square, returning an
+// intset of the indices of all the squares modified by the
+// unassignment (including the unassigned square).
+//
+// Because possible values only depend on the values assigned in
+// a square's groups, and bindings only depend on possible
+// values, we only need to recompute the region of the puzzle
+// that the original assignment could have affected: the groups
+// containing the square, and the groups containing the empty
+// squares in those groups.  Everything outside that region is
+// left alone.
+//
+// Errors are not tracked incrementally (they depend on the order
+// in which assignments were made), so if the puzzle has errors
+// it is rebuilt from its remaining values instead.  So are
+// puzzles whose constraints have rules, since what a rule
+// restricts depends on all the squares it covers.
+func (p *Puzzle) unassign(idx int) intset {
+	// count the change
+	p.changes++
+
+	// Part 1: Find the affected groups, exactly as in assign,
+	// and the squares in them.  We remember the current form
+	// of those squares so we can tell which ones we change.
+	// A puzzle with errors or constraint rules is rebuilt, which
+	// can change any square, so then we remember them all.
+	var buf [maxGroupCount + 1]int
+	affected := p.affectedGroups(idx, buf[:])
+	rebuild := len(p.errors) > 0 || (p.mapping.stack != nil && len(p.mapping.stack.rules) > 0)
+	region := p.groupSquares(p.mapping.pgroups[idx], affected)
+	if rebuild {
+		region = newIntsetRange(p.mapping.scount)
+	}
+	affectedIDs := make(map[GroupID]bool)
+	for _, gi := range p.mapping.pgroups[idx] {
+		if affected[gi] > 0 {
+			affectedIDs[p.mapping.gdescs[gi].id] = true
+		}
+	}
+	before := p.indicesToSquares(region)
+	if p.logger.tracing() {
+		p.logger.trace("puzzle unassign", "index", idx, "value", p.squares[idx].aval)
+	}
+
+	// clear the square
+	p.logger.save(p.squares[idx])
+	p.squares[idx].aval = 0
+	if rebuild {
+		p.rebuild()
+	} else {
+		// Part 2: Recompute the possible values of the empty
+		// squares in the groups containing the square, and
+		// drop any bindings made by the affected groups.
+		recompute := func(s *square) {
+			p.logger.save(s)
+			pvals := newBitsetRange(p.mapping.sidelen)
+			for _, j := range p.mapping.peers[s.index] {
+				pvals.remove(p.squares[j].aval)
+			}
+			s.pvals = pvals
+		}
+		recompute(p.squares[idx])
+		for _, i := range p.mapping.peers[idx] {
+			if s := p.squares[i]; s.aval == 0 {
+				recompute(s)
+			}
+		}
+		for _, i := range region {
+			if s := p.squares[i]; s.aval == 0 && s.bval != 0 {
+				var bsrc []GroupID
+				for _, gid := range s.bsrc {
+					if !affectedIDs[gid] {
+						bsrc = append(bsrc, gid)
+					}
+				}
+				p.logger.save(s)
+				if s.bsrc = bsrc; len(bsrc) == 0 {
+					s.bval = 0
+				}
+			}
+		}
+
+		// Part 3: Rebuild the affected groups from their
+		// assigned squares, and reanalyze them.  The puzzle had
+		// no errors with the square assigned, so it shouldn't
+		// have any without it.
+		var gis []int
 		for gi, count := range affected {
 			if count > 0 {
-				if errs := p.groups[gi].analyze(p.squares); len(errs) > 0 {
-					// group analyze Errors make the puzzle unsolvable
-					p.errors = append(p.errors, errs...)
-					// all we need is the first error to know we're unsolvable!
-					break
-				}
+				p.logger.saveGroup(p.groups[gi])
+				g, _ := newGroup(&p.mapping.gdescs[gi], p.squares)
+				*p.groups[gi] = *g
+				gis = append(gis, gi)
 			}
 		}
+		p.errors = append(p.errors, analyzeGroups(p.groups, gis, p.squares, false, nil)...)
 	}
-	return p.logger.entries
+
+	// report the squares that changed
+	result := intset{idx}
+	for i, S := range p.indicesToSquares(region) {
+		if !reflect.DeepEqual(S, before[i]) {
+			result.insert(S.Index)
+		}
+	}
+	return result
+}
+
+// rebuild reconstructs a puzzle's squares, groups, and errors
+// from its assigned values, keeping its metadata and change
+// count.  The content of the existing squares and groups is
+// replaced, so they are saved in any journal entry being made.
+func (p *Puzzle) rebuild() {
+	r, e := create(p.mapping, p.allValues())
+	if e != nil {
+		// the values came from the puzzle, so this can't happen!
+		panic(fmt.Errorf("Rebuild of puzzle failed: %v", e))
+	}
+	for i := 1; i <= p.mapping.scount; i++ {
+		p.logger.save(p.squares[i])
+		*p.squares[i] = *r.squares[i]
+		p.squares[i].logger = p.logger
+	}
+	for gi := 1; gi <= p.mapping.gcount; gi++ {
+		p.logger.saveGroup(p.groups[gi])
+		*p.groups[gi] = *r.groups[gi]
+	}
+	p.errors = r.errors
 }
 
-// copy returns a deep copy of a puzzle
+// copy returns a deep copy of a puzzle.  The copy has no
+// history; its journal starts empty.
 func (p *Puzzle) copy() *Puzzle {
 	// first the basic puzzle structure
 	c := &Puzzle{
-		Metadata: p.allMetadata(),    // metadata is mutable, so never shared
-		mapping:  p.mapping,          // mappings are invariant and always shared
-		logger:   &indexLogger{},     // loggers are per-puzzle, initialized empty
-		errors:   p.allErrors(false), // errors are per-puzzle, copied from source
-		valid:    p.valid,            // valid flag is a boolean
+		Metadata: p.allMetadata(),          // metadata is mutable, so never shared
+		Info:     p.Info.copy(),            // info has mutable tags, so never shared
+		mapping:  p.mapping,                // mappings are invariant and always shared
+		logger:   &indexLogger{},           // loggers are per-puzzle, initialized empty
+		errors:   p.allErrors(false),       // errors are per-puzzle, copied from source
+		marks:    p.copyMarks(),            // marks are mutable, so never shared
+		notes:    copyAnnotations(p.notes), // annotations are mutable, so never shared
+		givens:   p.givens,                 // givens change only by replacement, so shared
+		assist:   p.assist,                 // assist level is an int
+		actor:    p.actor,                  // actor is a string
+		changes:  p.changes,                // change count is an int
+		versions: p.copyVersions(),         // versions are mutable, so never shared
+		valid:    p.valid,                  // valid flag is a boolean
 	}
 	// then the squares
 	c.squares = make([]*square, c.mapping.scount+1) // 1-based indexing
@@ -319,7 +616,7 @@ func (p *Puzzle) copy() *Puzzle {
 		c.squares[i] = &square{
 			index:  p.squares[i].index,
 			aval:   p.squares[i].aval,
-			pvals:  newIntsetCopy(p.squares[i].pvals),
+			pvals:  p.squares[i].pvals,
 			bval:   p.squares[i].bval,
 			bsrc:   append([]GroupID(nil), p.squares[i].bsrc...),
 			logger: c.logger,
@@ -331,7 +628,7 @@ func (p *Puzzle) copy() *Puzzle {
 		c.groups[i] = &group{
 			desc:  p.groups[i].desc, // descriptors are part of mappings, so shared
 			where: append([]int(nil), p.groups[i].where...),
-			need:  newIntsetCopy(p.groups[i].need),
+			need:  p.groups[i].need,
 			free:  newIntsetCopy(p.groups[i].free),
 		}
 	}
@@ -351,34 +648,51 @@ encodings so the package entries can be invoked via HTTP.
 // summary of such puzzles includes their errors.
 //
 // For compactness of encoding, an empty values array indicates
-// an empty puzzle; that is, all squares are unassigned.
+// an empty puzzle; that is, all squares are unassigned.  The
+// pencil marks are keyed by square index, and only squares with
+// marks appear.  The entered indices are the assigned squares
+// whose values were entered by the player; all other assigned
+// values are the puzzle's givens (its original clues).  The
+// annotations are the notes made on the puzzle's squares and
+// groups.  The constraints are the constraint sets stacked on
+// the puzzle's geometry, if any.
 type Summary struct {
-	Metadata   map[string]string `json:"metadata,omitempty"`
-	Geometry   string            `json:"geometry"`
-	SideLength int               `json:"sidelen"`
-	Values     []int             `json:"values,omitempty"`
-	Errors     []Error           `json:"errors,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Info        *Info             `json:"info,omitempty"`
+	Geometry    string            `json:"geometry"`
+	SideLength  int               `json:"sidelen"`
+	Values      []int             `json:"values,omitempty"`
+	Errors      []Error           `json:"errors,omitempty"`
+	Journal     *Journal          `json:"journal,omitempty"`
+	Marks       map[int][]int     `json:"marks,omitempty"`
+	Entered     []int             `json:"entered,omitempty"`
+	Annotations []Annotation      `json:"annotations,omitempty"`
+	Constraints []Constraint      `json:"constraints,omitempty"`
 }
 
 // A Square in a puzzle gives the square's index, assigned value
 // (if any), bound value (if any, with sources), and possible
-// values (if more than one).  Puzzle squares are numbered
+// values (if more than one), along with any pencil marks the
+// client has made on it.  Puzzle squares are numbered
 // left-to-right, top-to-bottom, starting at 1, and the sequence
 // of squares is returned in that order.
 //
 // Only required fields are specified in a Square, so as to
 // minimize the Square's JSON-encoded form (which is used for
 // transmission of puzzle data from server to client).  If an
-// Aval (user-assigned value) is specified, no other fields
-// should be present.  If the square has a Bval (bound value) and
-// Bsrc (bound value source) then the Pvals should not be
-// present.
+// Aval (assigned value) is specified, the only other field that
+// can be present is Entered, which says the value was entered
+// by the player rather than given in the original puzzle.  If
+// the square has a Bval (bound value) and Bsrc (bound value
+// source) then the Pvals should not be present.
 type Square struct {
-	Index int       `json:"index"`
-	Aval  int       `json:"aval,omitempty"`
-	Bval  int       `json:"bval,omitempty"`
-	Bsrc  []GroupID `json:"bsrc,omitempty"`
-	Pvals intset    `json:"pvals,omitempty"`
+	Index   int       `json:"index"`
+	Aval    int       `json:"aval,omitempty"`
+	Entered bool      `json:"entered,omitempty"`
+	Bval    int       `json:"bval,omitempty"`
+	Bsrc    []GroupID `json:"bsrc,omitempty"`
+	Pvals   intset    `json:"pvals,omitempty"`
+	Marks   intset    `json:"marks,omitempty"`
 }
 
 // A GroupID names a row, column, tile, diagonal, or other set of
@@ -406,6 +720,8 @@ const (
 	GtypeCol      = "column"
 	GtypeTile     = "tile"
 	GtypeDiagonal = "diagonal"
+	GtypeKnight   = "knight"
+	GtypeCage     = "cage"
 )
 
 // A Choice assigns a value to a cell.  The cell is referred to
@@ -476,11 +792,28 @@ func (s *Summary) Hash() (Signature, error) {
 	return s.hash(), nil
 }
 
-// Summary returns the current summary of the puzzle.
+// ETag returns a strong HTTP entity tag for the puzzle's current
+// content.  The tag is a digest of everything a client can see
+// (the puzzle's summary, state, and journal), so it changes
+// whenever the puzzle does, and a puzzle reloaded from its summary
+// and journal keeps the tag it had.
+func (p *Puzzle) ETag() (string, error) {
+	if !p.isValid() {
+		return "", argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	return p.etag(), nil
+}
+
+// Summary returns the current summary of the puzzle.  It is an
+// error if the puzzle's metadata is no longer accepted by the
+// MetadataValidator.
 func (p *Puzzle) Summary() (*Summary, error) {
 	if !p.isValid() {
 		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
 	}
+	if e := validateMetadata(p.Metadata, true); e != nil {
+		return nil, e
+	}
 	return p.summary(), nil
 }
 
@@ -501,8 +834,26 @@ func (p *Puzzle) State() (*Content, error) {
 // value are out of range, the puzzle isn't updated and an Error
 // is returned.
 func (p *Puzzle) Assign(choice Choice) (*Content, error) {
+	if err := p.checkAssignable(); err != nil {
+		return nil, err
+	}
+	if err := p.checkChoice(choice, 0); err != nil {
+		return nil, err
+	}
+	if err := p.checkJournalRoom(1); err != nil {
+		return nil, err
+	}
+
+	// assigning this value to this square is allowed, so try it
+	is := p.do(p.clientMove(AssignAction, choice.Index, choice.Value))
+	return p.update(is), nil
+}
+
+// checkAssignable returns an Error unless the puzzle is valid
+// and has no errors, so it allows assignments.
+func (p *Puzzle) checkAssignable() error {
 	if !p.isValid() {
-		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
 	}
 	if count := len(p.errors); count != 0 {
 		err := Error{
@@ -511,33 +862,124 @@ func (p *Puzzle) Assign(choice Choice) (*Content, error) {
 			Condition: InvalidPuzzleAssignmentCondition,
 		}
 		err.Message = err.Error()
-		return nil, err
+		return err
 	}
+	return nil
+}
+
+// checkChoice returns an Error unless the choice is in range
+// and its square is empty.  A nonzero prior is a value already
+// chosen for the square, which also makes it unavailable.
+func (p *Puzzle) checkChoice(choice Choice, prior int) error {
 	idx, val := choice.Index, choice.Value
 	if idx < 1 || idx > p.mapping.scount {
-		return nil, rangeError(IndexAttribute, idx, 1, p.mapping.scount)
+		return rangeError(IndexAttribute, idx, 1, p.mapping.scount)
 	}
 	if val < 1 || val > p.mapping.sidelen {
-		return nil, rangeError(ValueAttribute, val, 1, p.mapping.sidelen)
+		return rangeError(ValueAttribute, val, 1, p.mapping.sidelen)
+	}
+	if aval := p.squares[idx].aval; aval != 0 {
+		prior = aval
 	}
-	if p.squares[idx].aval != 0 {
+	if prior != 0 {
 		err := Error{
 			Scope:     ArgumentScope,
 			Structure: AttributeValueStructure,
 			Attribute: AssignedValueAttribute,
 			Condition: DuplicateAssignmentCondition,
-			Values:    ErrorData{val, idx, p.squares[idx].aval},
+			Values:    ErrorData{val, idx, prior},
 		}
 		err.Message = err.Error()
+		return err
+	}
+	return nil
+}
+
+// AssignAll assigns a list of choices to a puzzle as a unit,
+// returning a single update to the puzzle's State that covers
+// all of them.  The choices are all checked before any is made,
+// and it's an Error if any of them couldn't be made by Assign or
+// two of them are for the same square.  If the choices together
+// make the puzzle unsolvable, they are all taken back and the
+// first of the resulting puzzle errors is returned.  The choices
+// are a single move as far as Undo and Redo are concerned.
+func (p *Puzzle) AssignAll(choices []Choice) (*Content, error) {
+	if err := p.checkAssignable(); err != nil {
+		return nil, err
+	}
+	seen := make(map[int]int, len(choices))
+	for _, choice := range choices {
+		if err := p.checkChoice(choice, seen[choice.Index]); err != nil {
+			return nil, err
+		}
+		seen[choice.Index] = choice.Value
+	}
+	if len(choices) == 0 {
+		return &Content{[]Square{}, nil}, nil
+	}
+	if err := p.checkJournalRoom(len(choices)); err != nil {
 		return nil, err
 	}
 
-	// assigning this value to this square is allowed, so try it
-	is := p.assign(idx, val)
-	return &Content{p.indicesToSquares(is), p.allErrors(true)}, nil
+	// the choices are all allowed, so try them as a unit
+	token := p.checkpoint()
+	p.begin()
+	var is intset
+	for _, choice := range choices {
+		for _, i := range p.do(p.clientMove(AssignAction, choice.Index, choice.Value)) {
+			is.insert(i)
+		}
+		if len(p.errors) > 0 {
+			break
+		}
+	}
+	p.end()
+	if len(p.errors) > 0 {
+		err := p.errors[0]
+		p.rollback(token)
+		return nil, err
+	}
+	p.commit(token)
+	return p.update(is), nil
+}
+
+// Unassign clears the value assigned to a square in a puzzle,
+// returning an update to the puzzle's State that contains every
+// square whose content changed.  If the index is out of range,
+// the square has no assigned value, or the value is a given that
+// hasn't been unlocked, the puzzle isn't updated and an Error is
+// returned.
+//
+// Unlike Assign, Unassign is allowed on puzzles with errors,
+// since removing a bad assignment is how a player fixes them.
+// The errors on the updated puzzle are those found by checking
+// its remaining values from scratch.
+func (p *Puzzle) Unassign(index int) (*Content, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 1 || index > p.mapping.scount {
+		return nil, rangeError(IndexAttribute, index, 1, p.mapping.scount)
+	}
+	if p.squares[index].aval == 0 {
+		err := argumentError(IndexAttribute, NotAssignedCondition, index)
+		err.Message = err.Error()
+		return nil, err
+	}
+	if p.isGiven(index) {
+		err := argumentError(IndexAttribute, LockedGivenCondition, index)
+		err.Message = err.Error()
+		return nil, err
+	}
+	if err := p.checkJournalRoom(1); err != nil {
+		return nil, err
+	}
+	is := p.do(p.clientMove(UnassignAction, index, p.squares[index].aval))
+	return p.update(is), nil
 }
 
-// Copy returns a copy of the wrapped puzzle (no shared structure)
+// Copy returns a copy of the wrapped puzzle (no shared
+// structure).  The copy does not include the puzzle's history.
 func (p *Puzzle) Copy() (*Puzzle, error) {
 	if !p.isValid() {
 		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
@@ -560,19 +1002,43 @@ Puzzle construction
 // and all possible bindings have been done.  This may lead to
 // the returned Puzzle having Errors, which make it unsolvable.
 func create(mapping *puzzleMapping, values []int) (*Puzzle, error) {
-	// create the square array.  Errors encountered in this phase
-	// mean that the puzzle can not be created because the inputs
-	// were bad.
+	// create the square array, with the given values assigned.
+	// Errors encountered in this phase mean that the puzzle can
+	// not be created because the inputs were bad.
+	//
+	// The squares are carved from a slab, so that even the
+	// biggest puzzles take a few allocations and are laid out
+	// together in memory.
 	squares := make([]*square, len(values)+1) // 1-based indices
-	logger := &indexLogger{}                  // uninitialized, so no logging done
+	slab := make([]square, len(values))
+	logger := &indexLogger{} // uninitialized, so no logging done
 	for i, val := range values {
-		if val == 0 {
-			squares[i+1] = newEmptySquare(i+1, mapping.sidelen, logger)
-		} else {
-			if val < 1 || val > mapping.sidelen {
-				return nil, rangeError(ValueAttribute, val, 1, mapping.sidelen)
-			}
-			squares[i+1] = newFilledSquare(i+1, mapping.sidelen, val, logger)
+		if val != 0 && (val < 1 || val > mapping.sidelen) {
+			return nil, rangeError(ValueAttribute, val, 1, mapping.sidelen)
+		}
+		slab[i] = square{index: i + 1, aval: val, logger: logger}
+		squares[i+1] = &slab[i]
+	}
+
+	// Derive the possible values of the empty squares from the
+	// values assigned to their peers.  Mostly-filled puzzles
+	// (such as those imported from collections, or replayed)
+	// have few empty squares with few possible values each, so
+	// this takes much less work than starting every
+	// empty square with every value and having the groups remove
+	// them.  A square whose peers leave it no possible values
+	// starts with every value, so the groups find (and report)
+	// the problem as usual.
+	for i, s := range squares {
+		if s == nil || s.aval != 0 {
+			continue
+		}
+		s.pvals = newBitsetRange(mapping.sidelen)
+		for _, j := range mapping.peers[i] {
+			s.pvals.remove(squares[j].aval)
+		}
+		if s.pvals == 0 {
+			s.pvals = newBitsetRange(mapping.sidelen)
 		}
 	}
 
@@ -589,17 +1055,24 @@ func create(mapping *puzzleMapping, values []int) (*Puzzle, error) {
 		}
 	}
 
+	// Apply the puzzle's constraints (if any) to the squares.
+	if mapping.stack != nil {
+		errors = append(errors, mapping.stack.check(squares)...)
+	}
+
 	// Analyze the constructed groups, which will assemble their
 	// candidate lists and then do constraint relaxation.
-	for i := 1; i <= mapping.gcount; i++ {
-		errs = groups[i].analyze(squares)
-		if len(errs) > 0 {
-			errors = append(errors, errs...)
-		}
-	}
+	errors = append(errors, analyzeGroups(groups, newIntsetRange(mapping.gcount), squares, false, nil)...)
 
 	// assemble the puzzle from its pieces
-	return &Puzzle{nil, mapping, squares, groups, errors, logger, true}, nil
+	return &Puzzle{
+		mapping: mapping,
+		squares: squares,
+		groups:  groups,
+		errors:  errors,
+		logger:  logger,
+		valid:   true,
+	}, nil
 }
 
 // New takes a puzzle summary and returns the puzzle with that
@@ -616,6 +1089,17 @@ func create(mapping *puzzleMapping, values []int) (*Puzzle, error) {
 // errors, to ensure that the resulting puzzle has the summary you
 // expect.
 func New(summary *Summary) (*Puzzle, error) {
+	return NewContext(context.Background(), summary)
+}
+
+// NewContext is New with a context, which is checked between the
+// phases of building the puzzle and between the moves replayed
+// from the summary's journal.  If the context is done before the
+// puzzle is built, an Error with CanceledCondition is returned.
+func NewContext(ctx context.Context, summary *Summary) (*Puzzle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, canceledError(ctx)
+	}
 	if summary == nil {
 		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, summary)
 	}
@@ -626,16 +1110,42 @@ func New(summary *Summary) (*Puzzle, error) {
 	if summary.SideLength == 0 {
 		return nil, argumentError(SideLengthAttribute, InvalidArgumentCondition, 0)
 	}
+	if e := checkSideLength(summary.SideLength); e != nil {
+		return nil, e
+	}
+	if max := CurrentLimits().MaxJournalLength; max > 0 && summary.Journal != nil && len(summary.Journal.Moves) > max {
+		return nil, quotaError(JournalLengthLimit, max)
+	}
 	values := summary.Values
 	if len(values) == 0 {
 		values = make([]int, summary.SideLength*summary.SideLength)
 	} else if len(values) != summary.SideLength*summary.SideLength {
 		return nil, argumentError(PuzzleSizeAttribute, WrongPuzzleSizeCondition, len(values), summary.SideLength)
 	}
-	p, e := makefn(values)
+	var p *Puzzle
+	var e error
+	if len(summary.Constraints) == 0 {
+		p, e = makefn(values)
+	} else {
+		p, e = newConstrainedPuzzle(summary.Geometry, summary.Constraints, values)
+	}
 	if e != nil {
 		return nil, e
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, canceledError(ctx)
+	}
+	if e := p.setGivens(summary.Entered); e != nil {
+		return nil, e
+	}
+	if summary.Journal != nil {
+		p.ctx = ctx
+		e := p.replay(summary.Journal)
+		p.ctx = nil
+		if e != nil {
+			return nil, e
+		}
+	}
 	if len(summary.Errors) > 0 {
 		if len(p.errors) == 0 {
 			// must have been a bogus summary - no errors in the puzzle!
@@ -646,6 +1156,24 @@ func New(summary *Summary) (*Puzzle, error) {
 			p.errors[i] = e
 		}
 	}
+	if e := p.setMarks(summary.Marks); e != nil {
+		return nil, e
+	}
+	if e := p.setAnnotations(summary.Annotations); e != nil {
+		return nil, e
+	}
+	if summary.Info != nil {
+		if e := summary.Info.validate(); e != nil {
+			return nil, e
+		}
+		p.Info = summary.Info.copy()
+	}
+	if e := validateMetadata(summary.Metadata, true); e != nil {
+		return nil, e
+	}
+	if p.assist, e = parseAssist(summary.Metadata); e != nil {
+		return nil, e
+	}
 	if len(summary.Metadata) > 0 {
 		p.Metadata = make(map[string]string, len(summary.Metadata))
 		for k, v := range summary.Metadata {
@@ -681,7 +1209,7 @@ Groups
 type group struct {
 	desc  *groupDescriptor
 	where []int  // array map: where[v] = index of square with assigned value v
-	need  intset // values the group still needs assigned or bound
+	need  bitset // values the group still needs assigned or bound
 	free  intset // indexes of squares not yet assigned or bound
 }
 
@@ -689,18 +1217,20 @@ type group struct {
 // which may already have assigned values.  Returns a list of
 // Errors encountered during the construction of the group.
 func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
-	// initialize the group members
+	// initialize the group members, all carved from one
+	// allocation (with capped capacity, so they can't grow into
+	// each other)
 	sidelen := len(gd.indices)
-	where := make([]int, sidelen+1) // 1-based values
-	need := newIntsetRange(sidelen)
-	free := append(intset(nil), gd.indices...)
+	ints := make([]int, 2*sidelen+1)
+	where := ints[: sidelen+1 : sidelen+1] // 1-based values
+	free := intset(ints[sidelen+1 : sidelen+1 : 2*sidelen+1])
+	var need bitset
 
 	// work in two passes:
 	//
-	// Pass 1: walk the assigned squares, rembering what value is
-	// assigned where, removing the assigned values from the
-	// needed values, and removing all assigned squares from the
-	// free squares
+	// Pass 1: walk the squares, rembering what value is assigned
+	// where, and collecting the unassigned squares as the free
+	// squares and the unassigned values as the needed values
 	var errs []Error
 	for _, i := range gd.indices {
 		s := ss[i]
@@ -709,8 +1239,13 @@ func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
 				errs = append(errs, groupError(gd.id, a, DuplicateGroupValuesCondition))
 			}
 			where[a] = i
-			free.remove(i)
-			need.remove(a)
+		} else {
+			free = append(free, i)
+		}
+	}
+	for v := 1; v <= sidelen; v++ {
+		if where[v] == 0 {
+			need.insert(v)
 		}
 	}
 
@@ -743,61 +1278,92 @@ func newGroup(gd *groupDescriptor, ss []*square) (*group, []Error) {
 // the constructed or assigned group can not be analyzed alone;
 // the overlapping groups need to be constructed/assigned before
 // all of them can be analyzed together.
+//
+// Analysis is done in two parts: planning the steps, which only
+// reads the group and the possible values of its squares, and
+// applying them, which binds squares.  Binding never changes
+// possible values, so groups can be planned in any order (or
+// concurrently) as long as their plans are applied in order.
 func (g *group) analyze(ss []*square) []Error {
-	counts := make([]int, len(g.desc.indices)+1) // candidate counts for each needed value
-	lasts := make([]int, len(g.desc.indices)+1)  // last candidates for each needed value
-	var errs []Error                             // errs arising from the analysis
+	var buf [2 * maxSideLength]groupStep
+	return g.apply(ss, g.plan(ss, buf[:0]))
+}
 
-	// helper: set this index as the candidate for this value in this group
-	setCandidate := func(idx int, val int) {
-		g.free.remove(idx)
-		g.need.remove(val)
-		// bind the square, if needed
-		if len(ss[idx].pvals) > 1 {
-			errs = append(errs, ss[idx].bind(val, g.desc.id)...)
-		}
-		// Issue 32: make sure this value isn't bound elsewhere in the group
-		for _, i := range g.desc.indices {
-			if i != idx && ss[i].bval == val {
-				errs = append(errs, groupError(g.desc.id, val, DuplicateGroupValuesCondition))
-				break
-			}
-		}
-	}
+// A groupStep is one step in the analysis of a group: making a
+// square the candidate for a value or, if the index is 0,
+// finding that a needed value has no candidates.
+type groupStep struct {
+	idx int
+	val int
+}
 
-	// First walk the list of free squares, collecting which ones
-	// are candidates for which values.
-	//
-	// (We walk the list back to front, so we can remove
-	// candidates without screwing up the iteration.)
+// plan the analysis of a group, appending the steps to the given
+// slice.  There is at most one step for each free square and one
+// for each needed value.
+func (g *group) plan(ss []*square, steps []groupStep) []groupStep {
+	var countsBuf, lastsBuf [maxSideLength + 1]int
+	counts := countsBuf[:len(g.desc.indices)+1] // candidate counts for each needed value
+	lasts := lastsBuf[:len(g.desc.indices)+1]   // last candidates for each needed value
+	var placed bitset                           // values with single-valued candidates
+
+	// First walk the list of free squares (back to front),
+	// collecting which ones are candidates for which values.
 	for fi := len(g.free) - 1; fi >= 0; fi-- {
 		i := g.free[fi]
-		if len(ss[i].pvals) == 1 {
+		if pvals := ss[i].pvals; pvals.len() == 1 {
 			// this square can only have one value, so it
 			// must be used as the candidate for that value
-			setCandidate(i, ss[i].pvals[0])
+			steps = append(steps, groupStep{i, pvals.min()})
+			placed |= pvals
 		} else {
 			// remember this square as a potential candidate for
 			// each of its possible values
-			for _, v := range ss[i].pvals {
+			for v := range pvals.values() {
 				counts[v]++
 				lasts[v] = i
 			}
 		}
 	}
-	// Now walk the list of candidates for each needed value,
-	// raising an Error if there aren't any, and binding them if
-	// they are the only ones.
-	//
-	// (We walk the list of needed values back to front,
-	// so we can remove needed values without screwing up the
-	// iteration.)
-	for i := len(g.need) - 1; i >= 0; i-- {
-		switch v := g.need[i]; counts[v] {
+	// Now walk the list of needed values (back to front) that
+	// weren't placed above, noting the ones with no candidates
+	// and binding the ones with only one.
+	for rest := g.need &^ placed; rest != 0; {
+		v := rest.max()
+		rest.remove(v)
+		switch counts[v] {
 		case 0:
-			errs = append(errs, groupError(g.desc.id, v, NoGroupValueCondition))
+			steps = append(steps, groupStep{0, v})
 		case 1:
-			setCandidate(lasts[v], v)
+			steps = append(steps, groupStep{lasts[v], v})
+		}
+	}
+	return steps
+}
+
+// apply the planned steps of a group's analysis, returning the
+// Errors that arise.
+func (g *group) apply(ss []*square, steps []groupStep) []Error {
+	var errs []Error
+	for _, step := range steps {
+		idx, val := step.idx, step.val
+		if idx == 0 {
+			errs = append(errs, groupError(g.desc.id, val, NoGroupValueCondition))
+			continue
+		}
+		// set this index as the candidate for this value in this group
+		ss[idx].logger.saveGroup(g)
+		g.free.remove(idx)
+		g.need.remove(val)
+		// bind the square, if needed
+		if ss[idx].pvals.len() > 1 {
+			errs = append(errs, ss[idx].bind(val, g.desc.id)...)
+		}
+		// Issue 32: make sure this value isn't bound elsewhere in the group
+		for _, i := range g.desc.indices {
+			if i != idx && ss[i].bval == val {
+				errs = append(errs, groupError(g.desc.id, val, DuplicateGroupValuesCondition))
+				break
+			}
 		}
 	}
 	return errs
@@ -825,6 +1391,7 @@ func (g *group) assign(ss []*square, ai int) []Error {
 	}
 
 	// record the assignment
+	ss[ai].logger.saveGroup(g)
 	g.where[av] = ai
 	g.need.remove(av)
 	g.free.remove(ai)
@@ -848,7 +1415,7 @@ Squares
 type square struct {
 	index  int          // 1-based index of the square
 	aval   int          // value assigned by the user
-	pvals  intset       // possible (not in conflict) values
+	pvals  bitset       // possible (not in conflict) values
 	bval   int          // value bound (required) by a containing group
 	bsrc   []GroupID    // group(s) binding the bound value
 	logger *indexLogger // a log of modifications
@@ -857,7 +1424,7 @@ type square struct {
 // Make an empty square with the given index in a puzzle with the
 // given side length.  Doesn't do error checking.
 func newEmptySquare(index, sidelen int, logger *indexLogger) *square {
-	return &square{index: index, pvals: newIntsetRange(sidelen), logger: logger}
+	return &square{index: index, pvals: newBitsetRange(sidelen), logger: logger}
 }
 
 // Make a square with the given index in a puzzle with the given
@@ -871,17 +1438,17 @@ func newFilledSquare(index, sidelen int, value int, logger *indexLogger) *square
 // generated by the assignment.  Doesn't guard against the square
 // already being assigned, and will assign an impossible value.
 func (s *square) assign(aval int) (errs []Error) {
+	s.logger.save(s)
 	if s.bval != 0 && s.bval != aval {
 		for i := range s.bsrc {
 			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
 		}
 	}
-	_, found := s.pvals.find(aval)
-	if !found {
+	if !s.pvals.find(aval) {
 		errs = append(errs, squareError(s, aval, AssignedValueAttribute, NotInSetCondition))
 	}
 	s.aval = aval
-	s.pvals = nil
+	s.pvals = 0
 	s.logger.log(s.index)
 	return
 }
@@ -891,18 +1458,21 @@ func (s *square) assign(aval int) (errs []Error) {
 // the binding.  Doesn't guard against the square being assigned,
 // or binding an impossible value.
 func (s *square) bind(bval int, bsrc GroupID) (errs []Error) {
+	s.logger.save(s)
 	if s.bval != 0 && s.bval != bval {
 		for i := range s.bsrc {
 			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
 		}
 	}
-	_, found := s.pvals.find(bval)
-	if !found {
+	if !s.pvals.find(bval) {
 		errs = append(errs, squareError(s, bval, BoundValueAttribute, NotInSetCondition))
 	}
 	s.bval = bval
 	s.bsrc = append(s.bsrc, bsrc)
 	s.logger.log(s.index)
+	if s.logger.tracing() {
+		s.logger.trace("square bind", "index", s.index, "value", bval, "group", bsrc.String())
+	}
 	return
 }
 
@@ -915,13 +1485,19 @@ func (s *square) remove(val int) (errs []Error) {
 			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
 		}
 	}
-	removed := s.pvals.remove(val)
-	if removed {
-		if len(s.pvals) == 0 {
+	if !s.pvals.find(val) {
+		return
+	}
+	s.logger.save(s)
+	if s.pvals.remove(val) {
+		if s.pvals == 0 {
 			errs = append(errs,
 				squareError(s, val, RemovedValueAttribute, NoPossibleValuesCondition))
 		}
 		s.logger.log(s.index)
+		if s.logger.tracing() {
+			s.logger.trace("square eliminate", "index", s.index, "values", []int{val})
+		}
 	}
 	return
 }
@@ -929,22 +1505,24 @@ func (s *square) remove(val int) (errs []Error) {
 // Subtract possible values from a square.  Returns any Errors
 // generated by the removal.  Doesn't guard against the square
 // being assigned, or being left with no possible values.
-func (s *square) subtract(vals intset) []Error {
+func (s *square) subtract(vals bitset) []Error {
 	return s.removeMultiple(vals, false)
 }
 
 // Intersect possible values on a square.  Returns any Errors
 // generated by the intersection.  Doesn't guard against the
 // square being assigned, or being left with no possible values.
-func (s *square) intersect(vals intset) []Error {
+func (s *square) intersect(vals bitset) []Error {
 	return s.removeMultiple(vals, true)
 }
 
 // Validate and apply the result of a set operation on a square.
 // This is a helper that does the work of subract and intersect.
-func (s *square) removeMultiple(vals intset, keepVals bool) (errs []Error) {
+func (s *square) removeMultiple(vals bitset, keepVals bool) (errs []Error) {
 	var remsome, rembound bool
 	var attr ErrorAttribute
+	before := s.pvals
+	s.logger.save(s)
 	if keepVals {
 		attr = RetainedValuesAttribute
 		remsome, rembound = s.pvals.intersect(vals, s.bval)
@@ -957,11 +1535,14 @@ func (s *square) removeMultiple(vals intset, keepVals bool) (errs []Error) {
 			errs = append(errs, groupError(s.bsrc[i], s.bval, NoGroupValueCondition))
 		}
 	}
-	if len(s.pvals) == 0 {
-		errs = append(errs, squareError(s, vals, attr, NoPossibleValuesCondition))
+	if s.pvals == 0 {
+		errs = append(errs, squareError(s, vals.intset(), attr, NoPossibleValuesCondition))
 	}
 	if remsome {
 		s.logger.log(s.index)
+		if s.logger.tracing() {
+			s.logger.trace("square eliminate", "index", s.index, "values", []int((before &^ s.pvals).intset()))
+		}
 	}
 	return
 }
@@ -973,16 +1554,24 @@ indexLoggers
 */
 
 // An indexLogger is an intset that is used to log indices.
+// When a move is being journaled, the logger also holds the
+// journal entry, so squares and groups can save their content in
+// it before they are changed.  (Groups find the logger through
+// their squares.)
 type indexLogger struct {
 	logging bool
 	entries intset
+	entry   *journalEntry
+	tracer  *slog.Logger
 }
 
-// start turns on a logger, giving it an initial entry.
+// start turns on a logger, giving it an initial entry.  The
+// entries from the last time it ran are reused, so callers must
+// be done with them by the next start.
 func (l *indexLogger) start(idx int) {
 	if l != nil {
 		l.logging = true
-		l.entries = intset{idx}
+		l.entries = append(l.entries[:0], idx)
 	}
 }
 
@@ -1002,6 +1591,45 @@ func (l *indexLogger) log(idx int) {
 	}
 }
 
+// save adds an image of a square to the journal entry being
+// made, if any.  Squares must call this before they change.
+func (l *indexLogger) save(s *square) {
+	if l != nil && l.entry != nil {
+		l.entry.saveSquare(s)
+	}
+}
+
+// saveGroup adds an image of a group to the journal entry being
+// made, if any.  Groups must call this before they change.
+func (l *indexLogger) saveGroup(g *group) {
+	if l != nil && l.entry != nil {
+		l.entry.saveGroup(g)
+	}
+}
+
+// tracing returns whether the logger has a tracer.  Callers
+// check this before assembling trace arguments, so untraced
+// puzzles don't pay for them.
+func (l *indexLogger) tracing() bool {
+	return l != nil && l.tracer != nil
+}
+
+// trace emits a debug event to the logger's tracer, if any.
+func (l *indexLogger) trace(msg string, args ...any) {
+	if l.tracing() {
+		l.tracer.Debug(msg, args...)
+	}
+}
+
+// traceErrors emits a debug event for each of the given errors.
+func (l *indexLogger) traceErrors(errs []Error) {
+	if l.tracing() {
+		for _, e := range errs {
+			l.tracer.Debug("puzzle error", "code", e.Code(), "error", e.Error())
+		}
+	}
+}
+
 /*
 
 Integer sets
@@ -1035,21 +1663,21 @@ func newIntsetCopy(in intset) intset {
 	return out
 }
 
+// newIntset: Make an intset from values in any order, dropping
+// duplicates.
+func newIntset(vals ...int) intset {
+	if len(vals) == 0 {
+		return intset{}
+	}
+	out := append(intset(nil), vals...)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
 // Find value v, returning where it should be in the intset and
 // whether it was found there.
 func (ps *intset) find(v int) (int, bool) {
-	end := len(*ps)
-	where := end
-	for i := 0; i < end; i++ {
-		if (*ps)[i] == v {
-			return i, true
-		}
-		if (*ps)[i] > v {
-			where = i
-			break
-		}
-	}
-	return where, false
+	return slices.BinarySearch(*ps, v)
 }
 
 // Insert value v, returning whether it was there already.
@@ -1071,19 +1699,71 @@ func (ps *intset) insert(v int) bool {
 
 // Remove value v, returning whether it was there.
 func (ps *intset) remove(v int) bool {
-	end := len(*ps)
-	for i := 0; i < end; i++ {
-		pv := (*ps)[i]
-		if pv == v {
-			copy((*ps)[i:], (*ps)[i+1:])
-			*ps = (*ps)[:end-1]
-			return true
+	where, found := ps.find(v)
+	if !found {
+		return false
+	}
+	copy((*ps)[where:], (*ps)[where+1:])
+	*ps = (*ps)[:len(*ps)-1]
+	return true
+}
+
+// Contains returns whether every value of the passed intset is
+// in this one.
+func (ps *intset) contains(xs intset) bool {
+	pi, pend := 0, len(*ps)
+	for _, xv := range xs {
+		for pi < pend && (*ps)[pi] < xv {
+			pi++
 		}
-		if pv > v {
+		if pi == pend || (*ps)[pi] != xv {
 			return false
 		}
+		pi++
 	}
-	return false
+	return true
+}
+
+// Union with the passed intset, returning whether anything was
+// added.  The union is made in new storage (if anything is
+// added), so it's safe with intsets of capped capacity.
+func (ps *intset) union(xs intset) bool {
+	if ps.contains(xs) {
+		return false
+	}
+	pend, xend := len(*ps), len(xs)
+	out := make(intset, 0, pend+xend)
+	pi, xi := 0, 0
+	for pi < pend && xi < xend {
+		switch pv, xv := (*ps)[pi], xs[xi]; {
+		case pv < xv:
+			out = append(out, pv)
+			pi++
+		case pv > xv:
+			out = append(out, xv)
+			xi++
+		default:
+			out = append(out, pv)
+			pi++
+			xi++
+		}
+	}
+	out = append(out, (*ps)[pi:]...)
+	*ps = append(out, xs[xi:]...)
+	return true
+}
+
+// Equals returns whether the passed intset has the same values.
+func (ps *intset) equals(xs intset) bool {
+	if len(*ps) != len(xs) {
+		return false
+	}
+	for i, v := range *ps {
+		if xs[i] != v {
+			return false
+		}
+	}
+	return true
 }
 
 // Subtract the passed intset, returning whether anything was
@@ -1213,7 +1893,7 @@ func squareError(s *square, v interface{}, attr ErrorAttribute, cond ErrorCondit
 	}
 	switch cond {
 	case NotInSetCondition:
-		err.Values = append(err.Values, s.pvals)
+		err.Values = append(err.Values, s.pvals.intset())
 	case NoPossibleValuesCondition:
 	default:
 		panic(fmt.Errorf("Unexpected square error condition (%v) in square %+v", cond, *s))
@@ -1232,6 +1912,7 @@ func groupError(gid GroupID, v int, cond ErrorCondition) Error {
 	switch cond {
 	case NoGroupValueCondition:
 	case DuplicateGroupValuesCondition:
+	case ImpossibleSumCondition:
 	default:
 		panic(fmt.Errorf("Unexpected group error condition (%v) in group %v", cond, gid))
 	}
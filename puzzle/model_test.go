@@ -28,7 +28,9 @@ Tests for the puzzle representation.
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -42,7 +44,7 @@ func helperDupSquare(sq *square) *square {
 	return &square{
 		sq.index,
 		sq.aval,
-		newIntsetCopy(sq.pvals),
+		sq.pvals,
 		sq.bval,
 		append([]GroupID(nil), sq.bsrc...),
 		sq.logger,
@@ -52,7 +54,7 @@ func helperDupSquare(sq *square) *square {
 // depends on newEmptySquare and (*square).subtract, test those first
 func helperRestrictedSquare(index, sidelen int, excepts ...int) *square {
 	sp := newEmptySquare(index, sidelen, nil)
-	errs := sp.subtract(excepts)
+	errs := sp.subtract(newBitset(excepts...))
 	if len(errs) > 0 {
 		panic(errs[0])
 	}
@@ -228,7 +230,7 @@ func helperSquareEqual(s1, s2 *square) bool {
 	return (s1 == nil && s2 == nil) ||
 		(s1.index == s2.index &&
 			s1.aval == s2.aval &&
-			reflect.DeepEqual(s1.pvals, s2.pvals) &&
+			s1.pvals == s2.pvals &&
 			s1.bval == s2.bval &&
 			reflect.DeepEqual(s1.bsrc, s2.bsrc))
 }
@@ -313,59 +315,59 @@ var (
 	rotation4Puzzle1PartialSquares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2, 4}},
+		&square{index: 2, pvals: newBitset(2, 4)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}},
-		&square{index: 5, pvals: intset{2, 4}},
+		&square{index: 4, pvals: newBitset(2, 4)},
+		&square{index: 5, pvals: newBitset(2, 4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2, 4}},
+		&square{index: 7, pvals: newBitset(2, 4)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
-		&square{index: 10, pvals: intset{2, 4}},
+		&square{index: 10, pvals: newBitset(2, 4)},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2, 4}},
-		&square{index: 13, pvals: intset{2, 4}},
+		&square{index: 12, pvals: newBitset(2, 4)},
+		&square{index: 13, pvals: newBitset(2, 4)},
 		&square{index: 14, aval: 1},
-		&square{index: 15, pvals: intset{2, 4}},
+		&square{index: 15, pvals: newBitset(2, 4)},
 		&square{index: 16, aval: 3},
 	}
 	rotation4Puzzle1PartialGroups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{2, 4}, intset{2, 4},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newBitset(2, 4), intset{2, 4},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{2, 4}, intset{5, 7},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newBitset(2, 4), intset{5, 7},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, intset{2, 4}, intset{10, 12},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, newBitset(2, 4), intset{10, 12},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 0, 16, 0}, intset{2, 4}, intset{13, 15},
+			&square4Map.gdescs[4], []int{0, 14, 0, 16, 0}, newBitset(2, 4), intset{13, 15},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 0, 9, 0}, intset{2, 4}, intset{5, 13},
+			&square4Map.gdescs[5], []int{0, 1, 0, 9, 0}, newBitset(2, 4), intset{5, 13},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, intset{2, 4}, intset{2, 10},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, newBitset(2, 4), intset{2, 10},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, intset{2, 4}, intset{7, 15},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, newBitset(2, 4), intset{7, 15},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{2, 4}, intset{4, 12},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newBitset(2, 4), intset{4, 12},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{2, 4}, intset{2, 5},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newBitset(2, 4), intset{2, 5},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{2, 4}, intset{4, 7},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newBitset(2, 4), intset{4, 7},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 0, 9, 0}, intset{2, 4}, intset{10, 13},
+			&square4Map.gdescs[11], []int{0, 14, 0, 9, 0}, newBitset(2, 4), intset{10, 13},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, intset{2, 4}, intset{12, 15},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, newBitset(2, 4), intset{12, 15},
 		},
 	}
 	rotation4Puzzle1PartialAssign1Values = []int{ // assign(13, 2)
@@ -383,59 +385,59 @@ var (
 	rotation4Puzzle1PartialAssign1Squares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(4+2, 8+1)},
+		&square{index: 2, pvals: newBitset(2, 4), bval: 2, bsrc: helperBsrc(4+2, 8+1)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}},
-		&square{index: 5, pvals: intset{4}},
+		&square{index: 4, pvals: newBitset(2, 4)},
+		&square{index: 5, pvals: newBitset(4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(0+2, 4+3)},
+		&square{index: 7, pvals: newBitset(2, 4), bval: 2, bsrc: helperBsrc(0+2, 4+3)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
-		&square{index: 10, pvals: intset{4}},
+		&square{index: 10, pvals: newBitset(4)},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(0+3, 8+4)},
+		&square{index: 12, pvals: newBitset(2, 4), bval: 2, bsrc: helperBsrc(0+3, 8+4)},
 		&square{index: 13, aval: 2},
 		&square{index: 14, aval: 1},
-		&square{index: 15, pvals: intset{4}},
+		&square{index: 15, pvals: newBitset(4)},
 		&square{index: 16, aval: 3},
 	}
 	rotation4Puzzle1PartialAssign1Groups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{2, 4}, intset{2, 4},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newBitset(2, 4), intset{2, 4},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 0}, newBitset(), intset{},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, newBitset(), intset{},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, newBitset(), intset{},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, newBitset(), intset{},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{2, 4}, intset{4, 12},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newBitset(2, 4), intset{4, 12},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{2, 4}, intset{4, 7},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newBitset(2, 4), intset{4, 7},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[11], []int{0, 14, 13, 9, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, newBitset(), intset{},
 		},
 	}
 	rotation4Puzzle1PartialAssign1CapitalSquares = []Square{
@@ -454,7 +456,7 @@ var (
 		Square{Index: 11, Aval: 1},
 		Square{Index: 12, Pvals: intset{2, 4},
 			Bval: 2, Bsrc: []GroupID{GroupID{GtypeRow, 3}, GroupID{GtypeTile, 4}}},
-		Square{Index: 13, Aval: 2},
+		Square{Index: 13, Aval: 2, Entered: true},
 		Square{Index: 14, Aval: 1},
 		Square{Index: 15, Pvals: intset{4}},
 		Square{Index: 16, Aval: 3},
@@ -474,59 +476,59 @@ var (
 	rotation4Puzzle1PartialAssign2Squares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2}, bval: 2, bsrc: helperBsrc(4+2, 8+1)},
+		&square{index: 2, pvals: newBitset(2), bval: 2, bsrc: helperBsrc(4+2, 8+1)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}, bval: 4, bsrc: helperBsrc(0+1, 4+4)},
-		&square{index: 5, pvals: intset{4}},
+		&square{index: 4, pvals: newBitset(2, 4), bval: 4, bsrc: helperBsrc(0+1, 4+4)},
+		&square{index: 5, pvals: newBitset(4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2, 4}, bval: 2, bsrc: helperBsrc(0+2, 4+3)},
+		&square{index: 7, pvals: newBitset(2, 4), bval: 2, bsrc: helperBsrc(0+2, 4+3)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
 		&square{index: 10, aval: 4},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2}, bval: 2, bsrc: helperBsrc(0+3, 8+4)},
+		&square{index: 12, pvals: newBitset(2), bval: 2, bsrc: helperBsrc(0+3, 8+4)},
 		&square{index: 13, aval: 2},
 		&square{index: 14, aval: 1},
-		&square{index: 15, pvals: intset{4}},
+		&square{index: 15, pvals: newBitset(4)},
 		&square{index: 16, aval: 3},
 	}
 	rotation4Puzzle1PartialAssign2Groups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newBitset(), intset{},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, newBitset(), intset{},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[4], []int{0, 14, 13, 16, 0}, newBitset(), intset{},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, newBitset(), intset{},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, intset{}, intset{},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, newBitset(), intset{},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 0}, newBitset(), intset{},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{2, 4}, intset{4, 7},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newBitset(2, 4), intset{4, 7},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, newBitset(), intset{},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 0}, newBitset(), intset{},
 		},
 	}
 	rotation4Puzzle1PartialAssign2CapitalSquares = []Square{
@@ -541,10 +543,10 @@ var (
 			Bval: 2, Bsrc: []GroupID{GroupID{GtypeRow, 2}, GroupID{GtypeCol, 3}}},
 		Square{Index: 8, Aval: 1},
 		Square{Index: 9, Aval: 3},
-		Square{Index: 10, Aval: 4},
+		Square{Index: 10, Aval: 4, Entered: true},
 		Square{Index: 11, Aval: 1},
 		Square{Index: 12, Pvals: intset{2}},
-		Square{Index: 13, Aval: 2},
+		Square{Index: 13, Aval: 2, Entered: true},
 		Square{Index: 14, Aval: 1},
 		Square{Index: 15, Pvals: intset{4}},
 		Square{Index: 16, Aval: 3},
@@ -564,17 +566,17 @@ var (
 	rotation4Puzzle1PartialAssign3Squares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2}, bval: 2, bsrc: helperBsrc(4+2, 8+1)},
+		&square{index: 2, pvals: newBitset(2), bval: 2, bsrc: helperBsrc(4+2, 8+1)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}, bval: 4, bsrc: helperBsrc(0+1, 4+4, 8+2)},
-		&square{index: 5, pvals: intset{4}},
+		&square{index: 4, pvals: newBitset(2, 4), bval: 4, bsrc: helperBsrc(0+1, 4+4, 8+2)},
+		&square{index: 5, pvals: newBitset(4)},
 		&square{index: 6, aval: 3},
-		&square{index: 7, pvals: intset{2}, bval: 2, bsrc: helperBsrc(0+2, 4+3)},
+		&square{index: 7, pvals: newBitset(2), bval: 2, bsrc: helperBsrc(0+2, 4+3)},
 		&square{index: 8, aval: 1},
 		&square{index: 9, aval: 3},
 		&square{index: 10, aval: 4},
 		&square{index: 11, aval: 1},
-		&square{index: 12, pvals: intset{2}, bval: 2, bsrc: helperBsrc(0+3, 8+4)},
+		&square{index: 12, pvals: newBitset(2), bval: 2, bsrc: helperBsrc(0+3, 8+4)},
 		&square{index: 13, aval: 2},
 		&square{index: 14, aval: 1},
 		&square{index: 15, aval: 4},
@@ -583,40 +585,40 @@ var (
 	rotation4Puzzle1PartialAssign3Groups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newBitset(), intset{},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[2], []int{0, 8, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[3], []int{0, 11, 0, 9, 10}, newBitset(), intset{},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 14, 13, 16, 15}, intset{}, intset{},
+			&square4Map.gdescs[4], []int{0, 14, 13, 16, 15}, newBitset(), intset{},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 13, 9, 0}, newBitset(), intset{},
 		},
 		&group{ // column 2
-			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, intset{}, intset{},
+			&square4Map.gdescs[6], []int{0, 14, 0, 6, 10}, newBitset(), intset{},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 11, 0, 3, 15}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 11, 0, 3, 15}, newBitset(), intset{},
 		},
 		&group{ // column 4
-			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, intset{}, intset{},
+			&square4Map.gdescs[8], []int{0, 8, 0, 16, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, intset{}, intset{},
+			&square4Map.gdescs[9], []int{0, 1, 0, 6, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, intset{}, intset{},
+			&square4Map.gdescs[10], []int{0, 8, 0, 3, 0}, newBitset(), intset{},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, intset{}, intset{},
+			&square4Map.gdescs[11], []int{0, 14, 13, 9, 10}, newBitset(), intset{},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 11, 0, 16, 15}, intset{}, intset{},
+			&square4Map.gdescs[12], []int{0, 11, 0, 16, 15}, newBitset(), intset{},
 		},
 	}
 	rotation4Puzzle1PartialAssign3CapitalSquares = []Square{
@@ -637,12 +639,12 @@ var (
 		Square{Index: 7, Pvals: intset{2}},
 		Square{Index: 8, Aval: 1},
 		Square{Index: 9, Aval: 3},
-		Square{Index: 10, Aval: 4},
+		Square{Index: 10, Aval: 4, Entered: true},
 		Square{Index: 11, Aval: 1},
 		Square{Index: 12, Pvals: intset{2}},
-		Square{Index: 13, Aval: 2},
+		Square{Index: 13, Aval: 2, Entered: true},
 		Square{Index: 14, Aval: 1},
-		Square{Index: 15, Aval: 4},
+		Square{Index: 15, Aval: 4, Entered: true},
 		Square{Index: 16, Aval: 3},
 	}
 	rotation4Puzzle1Complete1 = []int{
@@ -690,61 +692,61 @@ var (
 	rotation4Puzzle2PartialSquares = []*square{
 		nil,
 		&square{index: 1, aval: 1},
-		&square{index: 2, pvals: intset{2, 4}},
+		&square{index: 2, pvals: newBitset(2, 4)},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{2, 4}},
+		&square{index: 4, pvals: newBitset(2, 4)},
 		&square{index: 5, aval: 3},
-		&square{index: 6, pvals: intset{2, 4}},
+		&square{index: 6, pvals: newBitset(2, 4)},
 		&square{index: 7, aval: 1},
-		&square{index: 8, pvals: intset{2, 4}},
+		&square{index: 8, pvals: newBitset(2, 4)},
 		&square{index: 9, aval: 2},
-		&square{index: 10, pvals: intset{1, 3}},
+		&square{index: 10, pvals: newBitset(1, 3)},
 		&square{index: 11, aval: 4},
-		&square{index: 12, pvals: intset{1, 3}},
+		&square{index: 12, pvals: newBitset(1, 3)},
 		&square{index: 13, aval: 4},
-		&square{index: 14, pvals: intset{1, 3}},
+		&square{index: 14, pvals: newBitset(1, 3)},
 		&square{index: 15, aval: 2},
-		&square{index: 16, pvals: intset{1, 3}},
+		&square{index: 16, pvals: newBitset(1, 3)},
 	}
 	rotation4Puzzle2PartialGroups = []*group{
 		nil,
 		&group{ // row 1
-			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, intset{2, 4}, intset{2, 4},
+			&square4Map.gdescs[1], []int{0, 1, 0, 3, 0}, newBitset(2, 4), intset{2, 4},
 		},
 		&group{ // row 2
-			&square4Map.gdescs[2], []int{0, 7, 0, 5, 0}, intset{2, 4}, intset{6, 8},
+			&square4Map.gdescs[2], []int{0, 7, 0, 5, 0}, newBitset(2, 4), intset{6, 8},
 		},
 		&group{ // row 3
-			&square4Map.gdescs[3], []int{0, 0, 9, 0, 11}, intset{1, 3}, intset{10, 12},
+			&square4Map.gdescs[3], []int{0, 0, 9, 0, 11}, newBitset(1, 3), intset{10, 12},
 		},
 		&group{ // row 4
-			&square4Map.gdescs[4], []int{0, 0, 15, 0, 13}, intset{1, 3}, intset{14, 16},
+			&square4Map.gdescs[4], []int{0, 0, 15, 0, 13}, newBitset(1, 3), intset{14, 16},
 		},
 		&group{ // column 1
-			&square4Map.gdescs[5], []int{0, 1, 9, 5, 13}, intset{}, intset{},
+			&square4Map.gdescs[5], []int{0, 1, 9, 5, 13}, newBitset(), intset{},
 		},
 		&group{ // column 2
 			&square4Map.gdescs[6],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{2, 6, 10, 14},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{2, 6, 10, 14},
 		},
 		&group{ // column 3
-			&square4Map.gdescs[7], []int{0, 7, 15, 3, 11}, intset{}, intset{},
+			&square4Map.gdescs[7], []int{0, 7, 15, 3, 11}, newBitset(), intset{},
 		},
 		&group{ // column 4
 			&square4Map.gdescs[8],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{4, 8, 12, 16},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{4, 8, 12, 16},
 		},
 		&group{ // tile 1
-			&square4Map.gdescs[9], []int{0, 1, 0, 5, 0}, intset{2, 4}, intset{2, 6},
+			&square4Map.gdescs[9], []int{0, 1, 0, 5, 0}, newBitset(2, 4), intset{2, 6},
 		},
 		&group{ // tile 2
-			&square4Map.gdescs[10], []int{0, 7, 0, 3, 0}, intset{2, 4}, intset{4, 8},
+			&square4Map.gdescs[10], []int{0, 7, 0, 3, 0}, newBitset(2, 4), intset{4, 8},
 		},
 		&group{ // tile 3
-			&square4Map.gdescs[11], []int{0, 0, 9, 0, 13}, intset{1, 3}, intset{10, 14},
+			&square4Map.gdescs[11], []int{0, 0, 9, 0, 13}, newBitset(1, 3), intset{10, 14},
 		},
 		&group{ // tile 4
-			&square4Map.gdescs[12], []int{0, 0, 15, 0, 11}, intset{1, 3}, intset{12, 16},
+			&square4Map.gdescs[12], []int{0, 0, 15, 0, 11}, newBitset(1, 3), intset{12, 16},
 		},
 	}
 	rotation4Puzzle2Complete1 = []int{
@@ -773,22 +775,22 @@ var (
 	}
 	empty4PuzzleSquares = []*square{
 		nil,
-		&square{index: 1, pvals: intset{1, 2, 3, 4}},
-		&square{index: 2, pvals: intset{1, 2, 3, 4}},
-		&square{index: 3, pvals: intset{1, 2, 3, 4}},
-		&square{index: 4, pvals: intset{1, 2, 3, 4}},
-		&square{index: 5, pvals: intset{1, 2, 3, 4}},
-		&square{index: 6, pvals: intset{1, 2, 3, 4}},
-		&square{index: 7, pvals: intset{1, 2, 3, 4}},
-		&square{index: 8, pvals: intset{1, 2, 3, 4}},
-		&square{index: 9, pvals: intset{1, 2, 3, 4}},
-		&square{index: 10, pvals: intset{1, 2, 3, 4}},
-		&square{index: 11, pvals: intset{1, 2, 3, 4}},
-		&square{index: 12, pvals: intset{1, 2, 3, 4}},
-		&square{index: 13, pvals: intset{1, 2, 3, 4}},
-		&square{index: 14, pvals: intset{1, 2, 3, 4}},
-		&square{index: 15, pvals: intset{1, 2, 3, 4}},
-		&square{index: 16, pvals: intset{1, 2, 3, 4}},
+		&square{index: 1, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 2, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 3, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 4, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 5, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 6, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 7, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 8, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 9, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 10, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 11, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 12, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 13, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 14, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 15, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 16, pvals: newBitset(1, 2, 3, 4)},
 	}
 	empty4PuzzleCapitalSquares = []Square{
 		Square{Index: 1, Pvals: intset{1, 2, 3, 4}},
@@ -812,51 +814,51 @@ var (
 		nil,
 		&group{ // row 1
 			&square4Map.gdescs[1],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{1, 2, 3, 4},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{1, 2, 3, 4},
 		},
 		&group{ // row 2
 			&square4Map.gdescs[2],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{5, 6, 7, 8},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{5, 6, 7, 8},
 		},
 		&group{ // row 3
 			&square4Map.gdescs[3],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{9, 10, 11, 12},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{9, 10, 11, 12},
 		},
 		&group{ // row 4
 			&square4Map.gdescs[4],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{13, 14, 15, 16},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{13, 14, 15, 16},
 		},
 		&group{ // column 1
 			&square4Map.gdescs[5],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{1, 5, 9, 13},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{1, 5, 9, 13},
 		},
 		&group{ // column 2
 			&square4Map.gdescs[6],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{2, 6, 10, 14},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{2, 6, 10, 14},
 		},
 		&group{ // column 3
 			&square4Map.gdescs[7],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{3, 7, 11, 15},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{3, 7, 11, 15},
 		},
 		&group{ // column 4
 			&square4Map.gdescs[8],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{4, 8, 12, 16},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{4, 8, 12, 16},
 		},
 		&group{ // tile 1
 			&square4Map.gdescs[9],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{1, 2, 5, 6},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{1, 2, 5, 6},
 		},
 		&group{ // tile 2
 			&square4Map.gdescs[10],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{3, 4, 7, 8},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{3, 4, 7, 8},
 		},
 		&group{ // tile 3
 			&square4Map.gdescs[11],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{9, 10, 13, 14},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{9, 10, 13, 14},
 		},
 		&group{ // tile 4
 			&square4Map.gdescs[12],
-			[]int{0, 0, 0, 0, 0}, intset{1, 2, 3, 4}, intset{11, 12, 15, 16},
+			[]int{0, 0, 0, 0, 0}, newBitset(1, 2, 3, 4), intset{11, 12, 15, 16},
 		},
 	}
 	empty4PuzzleAssign1Values = []int{
@@ -876,19 +878,19 @@ var (
 		&square{index: 1, aval: 1},
 		&square{index: 2, aval: 2},
 		&square{index: 3, aval: 3},
-		&square{index: 4, pvals: intset{4}},
-		&square{index: 5, pvals: intset{3, 4}},
-		&square{index: 6, pvals: intset{3, 4}},
-		&square{index: 7, pvals: intset{1, 2, 4}},
-		&square{index: 8, pvals: intset{1, 2, 4}},
-		&square{index: 9, pvals: intset{2, 3, 4}},
-		&square{index: 10, pvals: intset{1, 3, 4}},
-		&square{index: 11, pvals: intset{1, 2, 4}},
-		&square{index: 12, pvals: intset{1, 2, 3, 4}},
-		&square{index: 13, pvals: intset{2, 3, 4}},
-		&square{index: 14, pvals: intset{1, 3, 4}},
-		&square{index: 15, pvals: intset{1, 2, 4}},
-		&square{index: 16, pvals: intset{1, 2, 3, 4}},
+		&square{index: 4, pvals: newBitset(4)},
+		&square{index: 5, pvals: newBitset(3, 4)},
+		&square{index: 6, pvals: newBitset(3, 4)},
+		&square{index: 7, pvals: newBitset(1, 2, 4)},
+		&square{index: 8, pvals: newBitset(1, 2, 4)},
+		&square{index: 9, pvals: newBitset(2, 3, 4)},
+		&square{index: 10, pvals: newBitset(1, 3, 4)},
+		&square{index: 11, pvals: newBitset(1, 2, 4)},
+		&square{index: 12, pvals: newBitset(1, 2, 3, 4)},
+		&square{index: 13, pvals: newBitset(2, 3, 4)},
+		&square{index: 14, pvals: newBitset(1, 3, 4)},
+		&square{index: 15, pvals: newBitset(1, 2, 4)},
+		&square{index: 16, pvals: newBitset(1, 2, 3, 4)},
 	}
 	conflicting4Puzzle1 = []int{
 		1, 0, 0, 0,
@@ -1391,6 +1393,158 @@ func TestIntsetIntersect(t *testing.T) {
 	}
 }
 
+func TestNewIntset(t *testing.T) {
+	testcases := []struct {
+		in  []int
+		out intset
+	}{
+		{nil, intset{}},
+		{[]int{3}, intset{3}},
+		{[]int{5, 1, 3, 1, 5, 2}, intset{1, 2, 3, 5}},
+		{[]int{9, 8, 7, 6, 5, 4, 3, 2, 1}, newIntsetRange(9)},
+	}
+	for _, tc := range testcases {
+		if out := newIntset(tc.in...); !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("newIntset(%v) gave %v, expected %v", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestIntsetContains(t *testing.T) {
+	testcases := []struct {
+		ps, xs intset
+		out    bool
+	}{
+		{intset{}, intset{}, true},
+		{intset{1, 2}, nil, true},
+		{intset{}, intset{1}, false},
+		{intset{1, 3, 5, 7}, intset{3, 7}, true},
+		{intset{1, 3, 5, 7}, intset{1, 3, 5, 7}, true},
+		{intset{1, 3, 5, 7}, intset{3, 4}, false},
+		{intset{1, 3, 5, 7}, intset{7, 8}, false},
+		{intset{3, 5}, intset{1, 3}, false},
+	}
+	for _, tc := range testcases {
+		if out := tc.ps.contains(tc.xs); out != tc.out {
+			t.Errorf("%v.contains(%v) gave %v, expected %v", tc.ps, tc.xs, out, tc.out)
+		}
+	}
+}
+
+func TestIntsetUnion(t *testing.T) {
+	testcases := []struct {
+		ps, xs, out intset
+		added       bool
+	}{
+		{intset{}, intset{}, intset{}, false},
+		{intset{1, 2}, nil, intset{1, 2}, false},
+		{intset{}, intset{1}, intset{1}, true},
+		{intset{1, 3, 5, 7}, intset{3, 7}, intset{1, 3, 5, 7}, false},
+		{intset{1, 3, 5, 7}, intset{2, 3, 8, 9}, intset{1, 2, 3, 5, 7, 8, 9}, true},
+		{intset{4, 5}, intset{1, 2}, intset{1, 2, 4, 5}, true},
+	}
+	for _, tc := range testcases {
+		ps := newIntsetCopy(tc.ps)
+		added := ps.union(tc.xs)
+		if added != tc.added || !reflect.DeepEqual(ps, tc.out) {
+			t.Errorf("%v.union(%v) gave %v, %v, expected %v, %v",
+				tc.ps, tc.xs, ps, added, tc.out, tc.added)
+		}
+	}
+	// union must not write past the capacity of a capped intset
+	storage := intset{1, 5, 9}
+	capped := storage[0:2:2]
+	capped.union(intset{2})
+	if storage[2] != 9 {
+		t.Errorf("union of capped intset overwrote neighboring storage")
+	}
+}
+
+// FuzzIntset checks the intset operations against a map-based
+// model of sets.  Each byte of input is a value from 0 to 31; the
+// first half of the input makes one set and the second half the
+// other.
+func FuzzIntset(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 2, 3, 4})
+	f.Add([]byte{})
+	f.Add([]byte{9, 9, 9, 0, 31, 17, 5})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var as, bs []int
+		for i, b := range data {
+			if i < len(data)/2 {
+				as = append(as, int(b%32))
+			} else {
+				bs = append(bs, int(b%32))
+			}
+		}
+		model := func(vals intset) map[int]bool {
+			m := make(map[int]bool)
+			for _, v := range vals {
+				m[v] = true
+			}
+			return m
+		}
+		check := func(op string, got intset, expected map[int]bool) {
+			if !slices.IsSorted(got) || len(slices.Compact(slices.Clone(got))) != len(got) {
+				t.Fatalf("%s gave unsorted or duplicated %v", op, got)
+			}
+			if !reflect.DeepEqual(model(got), expected) {
+				t.Fatalf("%s gave %v, expected %v", op, got, expected)
+			}
+		}
+		a, b := newIntset(as...), newIntset(bs...)
+		am, bm := model(intset(as)), model(intset(bs))
+		check("newIntset", a, am)
+
+		// find, insert, and remove each value of b in a copy of a
+		for _, v := range bs {
+			c := newIntsetCopy(a)
+			if _, found := c.find(v); found != am[v] {
+				t.Fatalf("%v.find(%d) gave %v", a, v, found)
+			}
+			if was := c.insert(v); was != am[v] {
+				t.Fatalf("%v.insert(%d) gave %v", a, v, was)
+			}
+			if was := c.remove(v); !was {
+				t.Fatalf("remove(%d) after insert gave false", v)
+			}
+			expected := model(a)
+			delete(expected, v)
+			check("insert then remove", c, expected)
+		}
+
+		// contains, union, subtract, intersect
+		contains := true
+		for v := range bm {
+			contains = contains && am[v]
+		}
+		if got := a.contains(b); got != contains {
+			t.Fatalf("%v.contains(%v) gave %v", a, b, got)
+		}
+		union, subtraction, intersection := model(a), model(a), model(a)
+		for v := range bm {
+			union[v] = true
+			delete(subtraction, v)
+		}
+		for v := range am {
+			if !bm[v] {
+				delete(intersection, v)
+			}
+		}
+		c := newIntsetCopy(a)
+		if added := c.union(b); added == contains {
+			t.Fatalf("%v.union(%v) gave %v", a, b, added)
+		}
+		check("union", c, union)
+		c = newIntsetCopy(a)
+		c.subtract(b, -1)
+		check("subtract", c, subtraction)
+		c = newIntsetCopy(a)
+		c.intersect(b, -1)
+		check("intersect", c, intersection)
+	})
+}
+
 type intsetRemoveBenchcase struct {
 	starter  intset
 	toremove int
@@ -1491,6 +1645,38 @@ func BenchmarkIntsetSubtractMulti(b *testing.B) {
 	}
 }
 
+func BenchmarkIntsetFind(b *testing.B) {
+	sets := []intset{newIntsetRange(9), newIntsetRange(16), newIntsetRange(25), intset{3, 16}}
+	for i := 0; i < b.N; i++ {
+		for _, s := range sets {
+			for v := 0; v <= 26; v += 3 {
+				s.find(v)
+			}
+		}
+	}
+}
+
+func BenchmarkIntsetUnion(b *testing.B) {
+	testcases := []struct{ starter, toadd intset }{
+		{intset{1, 4, 7}, intset{2, 5, 8}},
+		{intset{3, 4, 6, 9}, intset{3, 9}},
+		{intset{1, 3, 5, 7, 9, 11, 13, 15}, intset{2, 4, 6, 8, 10, 12, 14, 16}},
+	}
+	for i := 0; i < b.N; i++ {
+		for _, tc := range testcases {
+			input := tc.starter
+			input.union(tc.toadd)
+		}
+	}
+}
+
+func BenchmarkNewIntset(b *testing.B) {
+	vals := []int{9, 3, 7, 1, 3, 5, 2, 8, 9, 4, 6}
+	for i := 0; i < b.N; i++ {
+		newIntset(vals...)
+	}
+}
+
 /*
 
 Squares
@@ -1506,7 +1692,7 @@ func TestNewEmptySquares(t *testing.T) {
 		for _, i := range indices {
 			sq := newEmptySquare(i, s, nil)
 			if sq.index != i || sq.aval != 0 || sq.bval != 0 || sq.bsrc != nil ||
-				!reflect.DeepEqual(sq.pvals, newIntsetRange(s)) {
+				sq.pvals != newBitsetRange(s) {
 				t.Fatalf("newEmptySquare(%d, %d) incorrect: %v", i, s, sq)
 			}
 		}
@@ -1525,7 +1711,7 @@ func TestNewFilledSquares(t *testing.T) {
 				sq := newFilledSquare(i, s, v, nil)
 				if sq.index != i || sq.aval != v ||
 					sq.bval != 0 || sq.bsrc != nil ||
-					sq.pvals != nil {
+					sq.pvals != 0 {
 					t.Fatalf("newFilledSquare(%d, %d, %d) incorrect: %v", i, s, v, sq)
 				}
 			}
@@ -1548,12 +1734,12 @@ type squareAssignTestcase struct {
 func TestSquareAssign(t *testing.T) {
 	errcases := []squareAssignErrcase{
 		squareAssignErrcase{
-			&square{index: 2, pvals: intset{3, 4, 5, 7}, bval: 4, bsrc: helperBsrc(5)},
+			&square{index: 2, pvals: newBitset(3, 4, 5, 7), bval: 4, bsrc: helperBsrc(5)},
 			3,
 			NoGroupValueCondition,
 		},
 		squareAssignErrcase{
-			&square{index: 1, pvals: intset{3, 5}},
+			&square{index: 1, pvals: newBitset(3, 5)},
 			4,
 			NotInSetCondition,
 		},
@@ -1571,27 +1757,27 @@ func TestSquareAssign(t *testing.T) {
 
 	testcases := []squareAssignTestcase{
 		squareAssignTestcase{ // one in the middle
-			&square{index: 1, pvals: intset{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+			&square{index: 1, pvals: newBitset(1, 2, 3, 4, 5, 6, 7, 8, 9)},
 			4,
 			nil,
 		},
 		squareAssignTestcase{ // one at the end
-			&square{index: 2, pvals: intset{3, 4, 6, 9}},
+			&square{index: 2, pvals: newBitset(3, 4, 6, 9)},
 			9,
 			nil,
 		},
 		squareAssignTestcase{ // one at the beginning
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newBitset(3, 4, 6, 9)},
 			3,
 			nil,
 		},
 		squareAssignTestcase{ // one already bound, with a binding source
-			&square{index: 4, pvals: intset{7, 9}, bval: 9, bsrc: helperBsrc(4)},
+			&square{index: 4, pvals: newBitset(7, 9), bval: 9, bsrc: helperBsrc(4)},
 			9,
 			helperBsrc(4),
 		},
 		squareAssignTestcase{ // one already bound, with a double binding source
-			&square{index: 5, pvals: intset{3, 5, 9}, bval: 9, bsrc: helperBsrc(1, 10)},
+			&square{index: 5, pvals: newBitset(3, 5, 9), bval: 9, bsrc: helperBsrc(1, 10)},
 			9,
 			helperBsrc(1, 10),
 		},
@@ -1607,7 +1793,7 @@ func TestSquareAssign(t *testing.T) {
 			t.Errorf("Assigning %v to %v gave assignment %v",
 				tc.toassign, *tc.square, input.aval)
 		}
-		if input.pvals != nil {
+		if input.pvals != 0 {
 			t.Errorf("Assigning %v to %v gave pvals %v",
 				tc.toassign, *tc.square, input.pvals)
 		}
@@ -1635,17 +1821,17 @@ type squareBindTestcase struct {
 func TestSquareBind(t *testing.T) {
 	errcases := []squareBindErrcase{
 		squareBindErrcase{
-			&square{index: 2, bval: 4, bsrc: helperBsrc(6), pvals: intset{3, 4, 5, 6}},
+			&square{index: 2, bval: 4, bsrc: helperBsrc(6), pvals: newBitset(3, 4, 5, 6)},
 			3, helperGID(102),
 			NoGroupValueCondition,
 		},
 		squareBindErrcase{
-			&square{index: 3, pvals: intset{3, 5}},
+			&square{index: 3, pvals: newBitset(3, 5)},
 			4, helperGID(103),
 			NotInSetCondition,
 		},
 		squareBindErrcase{
-			&square{index: 4, pvals: intset{5}},
+			&square{index: 4, pvals: newBitset(5)},
 			4, helperGID(103),
 			NotInSetCondition,
 		},
@@ -1663,32 +1849,32 @@ func TestSquareBind(t *testing.T) {
 
 	testcases := []squareBindTestcase{
 		squareBindTestcase{ // one in the middle
-			&square{index: 1, pvals: intset{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+			&square{index: 1, pvals: newBitset(1, 2, 3, 4, 5, 6, 7, 8, 9)},
 			4, helperGID(101),
 			helperBsrc(101),
 		},
 		squareBindTestcase{ // one at the end
-			&square{index: 2, pvals: intset{3, 4, 6, 9}},
+			&square{index: 2, pvals: newBitset(3, 4, 6, 9)},
 			9, helperGID(102),
 			helperBsrc(102),
 		},
 		squareBindTestcase{ // one at the beginning
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newBitset(3, 4, 6, 9)},
 			3, helperGID(103),
 			helperBsrc(103),
 		},
 		squareBindTestcase{ // one already bound, with a binding source
-			&square{index: 4, bval: 9, pvals: intset{7, 9}, bsrc: helperBsrc(7)},
+			&square{index: 4, bval: 9, pvals: newBitset(7, 9), bsrc: helperBsrc(7)},
 			9, helperGID(6),
 			helperBsrc(7, 6),
 		},
 		squareBindTestcase{ // one already bound, with a double binding source
-			&square{index: 6, pvals: intset{3, 5, 9}, bval: 9, bsrc: helperBsrc(4, 7)},
+			&square{index: 6, pvals: newBitset(3, 5, 9), bval: 9, bsrc: helperBsrc(4, 7)},
 			9, helperGID(8),
 			helperBsrc(4, 7, 8),
 		},
 		squareBindTestcase{ // one with a single value
-			&square{index: 7, pvals: intset{1}},
+			&square{index: 7, pvals: newBitset(1)},
 			1, helperGID(1),
 			helperBsrc(1),
 		},
@@ -1700,7 +1886,7 @@ func TestSquareBind(t *testing.T) {
 		if len(errs) != 0 {
 			t.Fatalf("Binding %v to %v produced errors %v", tc.tobind, *tc.square, errs)
 		}
-		if !reflect.DeepEqual(input.pvals, tc.square.pvals) {
+		if input.pvals != tc.square.pvals {
 			t.Errorf("Binding %v to %v altered possible values to %v",
 				tc.tobind, *tc.square, input.pvals)
 		}
@@ -1738,7 +1924,7 @@ func TestSquareRemove(t *testing.T) {
 			NoGroupValueCondition,
 		},
 		squareRemoveErrcase{
-			&square{index: 3, pvals: intset{6}},
+			&square{index: 3, pvals: newBitset(6)},
 			6,
 			NoPossibleValuesCondition,
 		},
@@ -1762,19 +1948,19 @@ func TestSquareRemove(t *testing.T) {
 			0, nil,
 		},
 		squareRemoveTestcase{ // input not present
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newBitset(3, 4, 6, 9)},
 			2,
 			intset{3, 4, 6, 9},
 			0, nil,
 		},
 		squareRemoveTestcase{ // input leaves just one possible
-			&square{index: 4, pvals: intset{6, 9}},
+			&square{index: 4, pvals: newBitset(6, 9)},
 			9,
 			intset{6},
 			0, nil,
 		},
 		squareRemoveTestcase{ // reduce to already bound
-			&square{index: 105, pvals: intset{3, 12}, bval: 3, bsrc: helperBsrc(5)},
+			&square{index: 105, pvals: newBitset(3, 12), bval: 3, bsrc: helperBsrc(5)},
 			12,
 			intset{3},
 			3, helperBsrc(5),
@@ -1787,7 +1973,7 @@ func TestSquareRemove(t *testing.T) {
 		if e != nil {
 			t.Fatalf("Removing %v from %v produced error %v", tc.toremove, tc.square, e)
 		}
-		if !reflect.DeepEqual(input.pvals, tc.remaining) {
+		if input.pvals != newBitset(tc.remaining...) {
 			t.Errorf("Removing %v from %v left %v not %v",
 				tc.toremove, *tc.square, input.pvals, tc.remaining)
 		}
@@ -1820,14 +2006,14 @@ func TestSquareSubtract(t *testing.T) {
 			NoGroupValueCondition,
 		},
 		squareSubtractErrcase{
-			&square{index: 3, pvals: intset{3, 5}},
+			&square{index: 3, pvals: newBitset(3, 5)},
 			intset{1, 3, 5},
 			NoPossibleValuesCondition,
 		},
 	}
 	for _, e := range errcases {
 		input := helperDupSquare(e.square)
-		if errs := input.subtract(e.tosubtract); len(errs) == 0 {
+		if errs := input.subtract(newBitset(e.tosubtract...)); len(errs) == 0 {
 			t.Errorf("Removal of %v from %v didn't return error", e.tosubtract, *e.square)
 		} else {
 			if !helperCheckCondition(e.cond, errs) {
@@ -1850,19 +2036,19 @@ func TestSquareSubtract(t *testing.T) {
 			0, nil,
 		},
 		squareSubtractTestcase{ // input disjoint from range
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newBitset(3, 4, 6, 9)},
 			intset{1, 2, 5, 7, 8},
 			intset{3, 4, 6, 9},
 			0, nil,
 		},
 		squareSubtractTestcase{ // input leaves just one possible
-			&square{index: 4, pvals: intset{3, 4, 6, 9}},
+			&square{index: 4, pvals: newBitset(3, 4, 6, 9)},
 			intset{1, 2, 3, 4, 5, 7, 8, 9},
 			intset{6},
 			0, nil,
 		},
 		squareSubtractTestcase{ // reduce to already bound
-			&square{index: 105, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16},
+			&square{index: 105, pvals: newBitset(3, 4, 6, 9, 12, 13, 15, 16),
 				bval: 3, bsrc: helperBsrc(9)},
 			intset{1, 2, 4, 5, 6, 7, 8, 9, 12, 13, 15, 16},
 			intset{3},
@@ -1882,13 +2068,13 @@ func TestSquareSubtract(t *testing.T) {
 			0, nil,
 		},
 		squareSubtractTestcase{ // input disjoint from range
-			&square{index: 103, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
+			&square{index: 103, pvals: newBitset(3, 4, 6, 9, 12, 13, 15, 16)},
 			intset{1, 2, 5, 7, 8, 10, 11, 14},
 			intset{3, 4, 6, 9, 12, 13, 15, 16},
 			0, nil,
 		},
 		squareSubtractTestcase{ // input leaves just one possible
-			&square{index: 104, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
+			&square{index: 104, pvals: newBitset(3, 4, 6, 9, 12, 13, 15, 16)},
 			intset{1, 2, 3, 4, 5, 6, 7, 8, 9, 12, 13, 15},
 			intset{16},
 			0, nil,
@@ -1897,11 +2083,11 @@ func TestSquareSubtract(t *testing.T) {
 	for _, tc := range testcases {
 		// dup input square to preserve test case for error messages
 		input := helperDupSquare(tc.square)
-		e := input.subtract(tc.tosubtract)
+		e := input.subtract(newBitset(tc.tosubtract...))
 		if e != nil {
 			t.Fatalf("Removing %v from %v produced error %v", tc.tosubtract, tc.square, e)
 		}
-		if !reflect.DeepEqual(input.pvals, tc.remaining) {
+		if input.pvals != newBitset(tc.remaining...) {
 			t.Errorf("Removing %v from %v left %v not %v",
 				tc.tosubtract, *tc.square, input.pvals, tc.remaining)
 		}
@@ -1934,14 +2120,14 @@ func TestSquareIntersect(t *testing.T) {
 			NoGroupValueCondition,
 		},
 		squareIntersectErrcase{
-			&square{index: 3, pvals: intset{3, 5}},
+			&square{index: 3, pvals: newBitset(3, 5)},
 			intset{1, 2, 4},
 			NoPossibleValuesCondition,
 		},
 	}
 	for _, e := range errcases {
 		input := helperDupSquare(e.square)
-		if errs := input.intersect(e.tointersect); len(errs) == 0 {
+		if errs := input.intersect(newBitset(e.tointersect...)); len(errs) == 0 {
 			t.Errorf("Intersection of %v with %v didn't return error",
 				e.tointersect, *e.square)
 		} else {
@@ -1965,19 +2151,19 @@ func TestSquareIntersect(t *testing.T) {
 			0, nil,
 		},
 		squareIntersectTestcase{ // input equal to range
-			&square{index: 3, pvals: intset{3, 4, 6, 9}},
+			&square{index: 3, pvals: newBitset(3, 4, 6, 9)},
 			intset{3, 4, 6, 9},
 			intset{3, 4, 6, 9},
 			0, nil,
 		},
 		squareIntersectTestcase{ // input leaves just one possible
-			&square{index: 4, pvals: intset{3, 4, 6, 9}},
+			&square{index: 4, pvals: newBitset(3, 4, 6, 9)},
 			intset{6},
 			intset{6},
 			0, nil,
 		},
 		squareIntersectTestcase{ // reduce to already bound
-			&square{index: 105, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16},
+			&square{index: 105, pvals: newBitset(3, 4, 6, 9, 12, 13, 15, 16),
 				bval: 3, bsrc: helperBsrc(105)},
 			intset{3},
 			intset{3},
@@ -1997,13 +2183,13 @@ func TestSquareIntersect(t *testing.T) {
 			0, nil,
 		},
 		squareIntersectTestcase{ // input equal to range
-			&square{index: 103, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
+			&square{index: 103, pvals: newBitset(3, 4, 6, 9, 12, 13, 15, 16)},
 			intset{3, 4, 6, 9, 12, 13, 15, 16},
 			intset{3, 4, 6, 9, 12, 13, 15, 16},
 			0, nil,
 		},
 		squareIntersectTestcase{ // input leaves just one possible
-			&square{index: 104, pvals: intset{3, 4, 6, 9, 12, 13, 15, 16}},
+			&square{index: 104, pvals: newBitset(3, 4, 6, 9, 12, 13, 15, 16)},
 			intset{16},
 			intset{16},
 			0, nil,
@@ -2012,11 +2198,11 @@ func TestSquareIntersect(t *testing.T) {
 	for _, tc := range testcases {
 		// dup input square to preserve test case for error messages
 		input := helperDupSquare(tc.square)
-		e := input.intersect(tc.tointersect)
+		e := input.intersect(newBitset(tc.tointersect...))
 		if e != nil {
 			t.Fatalf("Removing %v from %v produced error %v", tc.tointersect, tc.square, e)
 		}
-		if !reflect.DeepEqual(input.pvals, tc.remaining) {
+		if input.pvals != newBitset(tc.remaining...) {
 			t.Errorf("Removing %v from %v left %v not %v",
 				tc.tointersect, *tc.square, input.pvals, tc.remaining)
 		}
@@ -2052,7 +2238,7 @@ type newGroupTestcase struct {
 	gindex  int
 	vals    []int
 	where   []int
-	need    intset
+	need    bitset
 	empty   intset
 }
 
@@ -2078,7 +2264,7 @@ func TestNewGroup(t *testing.T) {
 				nil,
 				newFilledSquare(1, 4, 1, nil),
 				newFilledSquare(2, 4, 2, nil),
-				&square{index: 3, pvals: intset{1, 2}},
+				&square{index: 3, pvals: newBitset(1, 2)},
 				newEmptySquare(4, 4, nil),
 			},
 			NotInSetCondition,
@@ -2107,32 +2293,32 @@ func TestNewGroup(t *testing.T) {
 		newGroupTestcase{ // first 2 of 4 assigned, no other info
 			"test 1", 4, GtypeRow, 1,
 			[]int{1, 2, 0, 0},
-			[]int{0, 1, 2, 0, 0}, intset{3, 4}, intset{3, 4},
+			[]int{0, 1, 2, 0, 0}, newBitset(3, 4), intset{3, 4},
 		},
 		newGroupTestcase{ // first 3 of 4 assigned, forces last via removal
 			"test 2", 4, GtypeRow, 1,
 			[]int{1, 2, 3, 0},
-			[]int{0, 1, 2, 3, 0}, intset{4}, intset{4},
+			[]int{0, 1, 2, 3, 0}, newBitset(4), intset{4},
 		},
 		newGroupTestcase{ // last 2 of 4 assigned, no other info
 			"test 3", 4, GtypeRow, 1,
 			[]int{0, 0, 3, 4},
-			[]int{0, 0, 0, 3, 4}, intset{1, 2}, intset{1, 2},
+			[]int{0, 0, 0, 3, 4}, newBitset(1, 2), intset{1, 2},
 		},
 		newGroupTestcase{ // 2 of 4 assigned out of order, with a gap
 			"test 4", 4, GtypeRow, 1,
 			[]int{0, 4, 0, 3},
-			[]int{0, 0, 0, 4, 2}, intset{1, 2}, intset{1, 3},
+			[]int{0, 0, 0, 4, 2}, newBitset(1, 2), intset{1, 3},
 		},
 		newGroupTestcase{ // 1 of 4 assigned out of order
 			"test 5", 4, GtypeRow, 1,
 			[]int{0, 0, 0, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newBitset(1, 2, 4), intset{1, 2, 3},
 		},
 		newGroupTestcase{ // 1 of 4 assigned, the other three reduced
 			"test 6", 4, GtypeRow, 1,
 			[]int{-2, -1, -4, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newBitset(1, 2, 4), intset{1, 2, 3},
 		},
 	}
 	for _, tc := range testcases {
@@ -2162,7 +2348,7 @@ type groupAnalyzeTestcase struct {
 	gindex  int
 	vals    []int
 	where   []int
-	need    intset
+	need    bitset
 	empty   intset
 	bs      []binding
 }
@@ -2183,8 +2369,8 @@ func TestGroupAnalyze(t *testing.T) {
 				nil,
 				newFilledSquare(1, 4, 2, nil),
 				newFilledSquare(2, 4, 1, nil),
-				&square{index: 3, pvals: intset{1, 3}},
-				&square{index: 4, pvals: intset{2, 3}},
+				&square{index: 3, pvals: newBitset(1, 3)},
+				&square{index: 4, pvals: newBitset(2, 3)},
 			},
 			NoGroupValueCondition,
 		},
@@ -2194,8 +2380,8 @@ func TestGroupAnalyze(t *testing.T) {
 				nil,
 				newFilledSquare(1, 4, 2, nil),
 				newFilledSquare(2, 4, 1, nil),
-				&square{index: 3, pvals: intset{1, 3}},
-				&square{index: 4, pvals: intset{3, 4}, bval: 3, bsrc: helperBsrc(2)},
+				&square{index: 3, pvals: newBitset(1, 3)},
+				&square{index: 4, pvals: newBitset(3, 4), bval: 3, bsrc: helperBsrc(2)},
 			},
 			NoGroupValueCondition,
 		},
@@ -2204,9 +2390,9 @@ func TestGroupAnalyze(t *testing.T) {
 			[]*square{
 				nil,
 				newFilledSquare(1, 4, 2, nil),
-				&square{index: 2, pvals: intset{3, 4}, bval: 3, bsrc: helperBsrc(2)},
-				&square{index: 3, pvals: intset{3}},
-				&square{index: 4, pvals: intset{1, 4}},
+				&square{index: 2, pvals: newBitset(3, 4), bval: 3, bsrc: helperBsrc(2)},
+				&square{index: 3, pvals: newBitset(3)},
+				&square{index: 4, pvals: newBitset(1, 4)},
 			},
 			DuplicateGroupValuesCondition,
 		},
@@ -2226,49 +2412,49 @@ func TestGroupAnalyze(t *testing.T) {
 		groupAnalyzeTestcase{ // first 2 of 4 assigned, no other info
 			"test 1", 4, GtypeRow, 1,
 			[]int{2, 1, 0, 0},
-			[]int{0, 2, 1, 0, 0}, intset{3, 4}, intset{3, 4},
+			[]int{0, 2, 1, 0, 0}, newBitset(3, 4), intset{3, 4},
 			nil,
 		},
 		groupAnalyzeTestcase{ // first 3 of 4 assigned, forces last
 			"test 2", 4, GtypeRow, 1,
 			[]int{3, 2, 1, 0},
-			[]int{0, 3, 2, 1, 0}, intset{}, intset{},
+			[]int{0, 3, 2, 1, 0}, newBitset(), intset{},
 			nil,
 		},
 		groupAnalyzeTestcase{ // last 2 of 4 assigned, no other info
 			"test 3", 4, GtypeRow, 1,
 			[]int{0, 0, 4, 3},
-			[]int{0, 0, 0, 4, 3}, intset{1, 2}, intset{1, 2},
+			[]int{0, 0, 0, 4, 3}, newBitset(1, 2), intset{1, 2},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 2 of 4 assigned, with a gap
 			"test 4", 4, GtypeRow, 1,
 			[]int{0, 3, 0, 1},
-			[]int{0, 4, 0, 2, 0}, intset{2, 4}, intset{1, 3},
+			[]int{0, 4, 0, 2, 0}, newBitset(2, 4), intset{1, 3},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 1 of 4 assigned
 			"test 5", 4, GtypeRow, 1,
 			[]int{0, 0, 0, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newBitset(1, 2, 4), intset{1, 2, 3},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 1 of 4 assigned, the other three reduced
 			"test 6", 4, GtypeRow, 1,
 			[]int{-2, -1, -4, 3},
-			[]int{0, 0, 0, 4, 0}, intset{1, 2, 4}, intset{1, 2, 3},
+			[]int{0, 0, 0, 4, 0}, newBitset(1, 2, 4), intset{1, 2, 3},
 			nil,
 		},
 		groupAnalyzeTestcase{ // 2 of 4 assigned, reduction forces binding
 			"test 7", 4, GtypeRow, 1,
 			[]int{0, 4, -1, 2},
-			[]int{0, 0, 4, 0, 2}, intset{}, intset{},
+			[]int{0, 0, 4, 0, 2}, newBitset(), intset{},
 			[]binding{binding{1, 1, helperBsrc(0 + 1)}},
 		},
 		groupAnalyzeTestcase{ // like the prior one, but a tile instead.
 			"test 8", 4, GtypeTile, 2,
 			[]int{0, 4, -1, 2},
-			[]int{0, 0, 8, 0, 4}, intset{}, intset{},
+			[]int{0, 0, 8, 0, 4}, newBitset(), intset{},
 			[]binding{binding{3, 1, helperBsrc(8 + 2)}},
 		},
 	}
@@ -2448,7 +2634,7 @@ func TestGroupAssign(t *testing.T) {
 			s := ss[si]
 			if si == tc.ai {
 				// make sure group noticed the assignment
-				_, needed := g.need.find(tc.av)
+				needed := g.need.find(tc.av)
 				_, free := g.free.find(tc.ai)
 				if g.where[tc.av] != si || needed || free {
 					t.Errorf("groupAssign case %v: assign(%d, %d) didn't take: %v",
@@ -2872,17 +3058,17 @@ func TestSummary(t *testing.T) {
 		summaryTestcase{
 			map[string]string{"name": "test 1"},
 			rotation4Puzzle1PartialAssign1Values,
-			Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil},
+			Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialAssign1Values},
 		},
 		summaryTestcase{
 			map[string]string{"name": "test 2"},
 			empty4PuzzleValues,
-			Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil},
+			Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues},
 		},
 		summaryTestcase{
 			map[string]string{"name": "test 3"},
 			rotation4Puzzle1Complete1,
-			Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil},
+			Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1Complete1},
 		},
 	}
 	for _, tc := range testcases {
@@ -2933,7 +3119,7 @@ func TestInternalAssign(t *testing.T) {
 		},
 	}
 	// we apply the testcases in sequence to a base setup
-	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -2986,7 +3172,7 @@ func BenchmarkInternalAssign(b *testing.B) {
 		assignInternalBenchcase{"test 3", 15, 4},
 	}
 	// we apply the benchcases in sequence to a base setup
-	master, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	master, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if e != nil {
 		b.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3003,6 +3189,101 @@ func BenchmarkInternalAssign(b *testing.B) {
 	}
 }
 
+// allocation benchmarks, for the external entry points that
+// make updates
+func BenchmarkAssign(b *testing.B) {
+	master, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		b.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		p := master.copy()
+		b.StartTimer()
+		if _, e := p.Assign(Choice{9, 7}); e != nil {
+			b.Fatalf("Assign(Choice{9, 7}) failed: %v", e)
+		}
+	}
+}
+
+func BenchmarkState(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		b.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, e := p.State(); e != nil {
+			b.Fatalf("State failed: %v", e)
+		}
+	}
+}
+
+func BenchmarkNew25(b *testing.B) {
+	values := make([]int, 25*25)
+	for i := 0; i < 25; i++ {
+		values[i*25+i] = i + 1 // the diagonal
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 25, Values: values}); e != nil {
+			b.Fatalf("Creation of 25x25 puzzle failed: %v", e)
+		}
+	}
+}
+
+// a collection import makes puzzles from mostly-filled grids
+func BenchmarkBulkImport(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		b.Fatalf("Creation of 16x16 puzzle failed: %v", e)
+	}
+	solution := p.allSolutions()[0].Values
+	collection := make([][]int, 16)
+	for i := range collection {
+		collection[i] = append([]int(nil), solution...)
+		for j := i; j < len(solution); j += 9 {
+			collection[i][j] = 0
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, values := range collection {
+			if _, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: values}); e != nil {
+				b.Fatalf("Creation of 16x16 puzzle failed: %v", e)
+			}
+		}
+	}
+}
+
+// the inner loops of assignment and update don't allocate
+// per group or per square
+func TestHotPathAllocs(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	var buf [maxGroupCount + 1]int
+	if n := testing.AllocsPerRun(10, func() { p.affectedGroups(9, buf[:]) }); n != 0 {
+		t.Errorf("affectedGroups made %v allocations", n)
+	}
+	if n := testing.AllocsPerRun(10, func() { p.groups[1].analyze(p.squares) }); n != 0 {
+		t.Errorf("analyze of an analyzed group made %v allocations", n)
+	}
+	all := newIntsetRange(p.mapping.scount)
+	if n := testing.AllocsPerRun(10, func() { p.indicesToSquares(all) }); n > 3 {
+		t.Errorf("indicesToSquares made %v allocations", n)
+	}
+	if S, SS := p.indexToSquare(9), p.indicesToSquares(intset{9}); !reflect.DeepEqual(S, SS[0]) {
+		t.Errorf("indexToSquare gave %+v, indicesToSquares gave %+v", S, SS[0])
+	}
+}
+
 type assignExternalTestcase struct {
 	name   string
 	ai, av int
@@ -3020,7 +3301,7 @@ func TestExternalAssign(t *testing.T) {
 	if e.(Error).Scope != ArgumentScope {
 		t.Errorf("Assign to puzzle with one issue returned wrong error: %v", e.Error())
 	}
-	pi, e = New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	pi, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if e != nil {
 		t.Fatalf("Creation of valid 4 puzzle produced error: %v", e)
 	}
@@ -3060,7 +3341,7 @@ func TestExternalAssign(t *testing.T) {
 		},
 	}
 	// we apply the testcases in sequence to a base setup
-	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3079,6 +3360,202 @@ func TestExternalAssign(t *testing.T) {
 	}
 }
 
+// helperCompareFresh checks that the assigned and possible
+// values of every square in the puzzle match those in a puzzle
+// freshly created from the puzzle's values, and that it has the
+// same number of errors.  Bindings depend on the order of
+// assignments, so they can't be compared; instead, if a solution
+// is given, every binding must agree with it.
+func helperCompareFresh(t *testing.T, name string, p *Puzzle, solution []int) {
+	fresh, e := New(&Summary{Geometry: p.mapping.geometry, SideLength: p.mapping.sidelen, Values: p.allValues()})
+	if e != nil {
+		t.Fatalf("%s: creation of fresh puzzle failed: %v", name, e)
+	}
+	for i := 1; i <= p.mapping.scount; i++ {
+		s, f := p.squares[i], fresh.squares[i]
+		if s.aval != f.aval || s.pvals != f.pvals {
+			t.Errorf("%s: square %d is %+v, expected %+v", name, i, *s, *f)
+		}
+		if solution != nil && s.bval != 0 && s.bval != solution[i-1] {
+			t.Errorf("%s: square %d is bound to %d, solution has %d", name, i, s.bval, solution[i-1])
+		}
+	}
+	if len(p.errors) != len(fresh.errors) {
+		t.Errorf("%s: puzzle has errors %v, expected %v", name, p.errors, fresh.errors)
+	}
+}
+
+func TestAssignAll(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	before := p.allSquares()
+	choices := []Choice{{13, 2}, {10, 4}, {15, 4}}
+	update, e := p.AssignAll(choices)
+	if e != nil {
+		t.Fatalf("AssignAll(%v) failed: %v", choices, e)
+	}
+	changed := make(map[int]bool)
+	for _, S := range update.Squares {
+		changed[S.Index] = true
+	}
+	for i, S := range p.allSquares() {
+		if !reflect.DeepEqual(S, rotation4Puzzle1PartialAssign3CapitalSquares[i]) {
+			t.Errorf("AssignAll: Square %d was %v, expected %v",
+				S.Index, S, rotation4Puzzle1PartialAssign3CapitalSquares[i])
+		}
+		if !reflect.DeepEqual(S, before[i]) && !changed[S.Index] {
+			t.Errorf("AssignAll: changed square %d is not in the update", S.Index)
+		}
+	}
+	// the choices are undone as a unit
+	if _, e := p.Undo(); e != nil {
+		t.Fatalf("Undo of AssignAll failed: %v", e)
+	}
+	if !reflect.DeepEqual(p.allSquares(), before) {
+		t.Errorf("Undo of AssignAll left squares %v, expected %v", p.allSquares(), before)
+	}
+
+	// choices that make the puzzle unsolvable are all taken back
+	if _, e := p.AssignAll([]Choice{{13, 2}, {2, 1}}); e == nil {
+		t.Errorf("AssignAll of conflicting choices succeeded")
+	}
+	if !reflect.DeepEqual(p.allSquares(), before) || len(p.errors) != 0 {
+		t.Errorf("Failed AssignAll left squares %v, errors %v", p.allSquares(), p.errors)
+	}
+	if _, e := p.Undo(); e == nil || e.(Error).Condition != NothingToUndoCondition {
+		t.Errorf("Failed AssignAll left a move to undo: %v", e)
+	}
+
+	// bad choices are rejected before any is made
+	badcases := []struct {
+		choices   []Choice
+		condition ErrorCondition
+	}{
+		{[]Choice{{2, 2}, {0, 1}}, TooSmallCondition},
+		{[]Choice{{2, 2}, {4, 5}}, TooLargeCondition},
+		{[]Choice{{2, 2}, {1, 1}}, DuplicateAssignmentCondition},
+		{[]Choice{{2, 2}, {2, 4}}, DuplicateAssignmentCondition},
+	}
+	values := p.allValues()
+	for i, tc := range badcases {
+		_, e := p.AssignAll(tc.choices)
+		if e == nil || e.(Error).Condition != tc.condition {
+			t.Errorf("Case %d: AssignAll(%v) produced incorrect error: %v", i, tc.choices, e)
+		}
+		if !reflect.DeepEqual(p.allValues(), values) {
+			t.Errorf("Case %d: AssignAll(%v) changed the puzzle", i, tc.choices)
+		}
+	}
+	if update, e := p.AssignAll(nil); e != nil || len(update.Squares) != 0 {
+		t.Errorf("AssignAll of no choices returned %v, %v", update, e)
+	}
+}
+
+func TestUnassign(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	solution := p.allSolutions()[0].Values
+
+	// assign the solution to the empty squares, then take the
+	// assignments back one at a time, making sure the puzzle
+	// always looks like it was freshly made.
+	var assigned []int
+	for i, v := range threeStarValues {
+		if v == 0 && len(assigned) < 30 {
+			if _, e := p.Assign(Choice{i + 1, solution[i]}); e != nil {
+				t.Fatalf("Assign(Choice{%d, %d}) failed: %v", i+1, solution[i], e)
+			}
+			assigned = append(assigned, i+1)
+		}
+	}
+	for i := len(assigned) - 1; i >= 0; i-- {
+		before := p.allSquares()
+		update, e := p.Unassign(assigned[i])
+		if e != nil {
+			t.Fatalf("Unassign(%d) failed: %v", assigned[i], e)
+		}
+		name := fmt.Sprintf("Unassign(%d)", assigned[i])
+		helperCompareFresh(t, name, p, solution)
+		// every changed square must be in the update
+		changed := make(map[int]bool)
+		for _, S := range update.Squares {
+			changed[S.Index] = true
+		}
+		for j, S := range p.allSquares() {
+			if !reflect.DeepEqual(S, before[j]) && !changed[S.Index] {
+				t.Errorf("%s: changed square %d is not in the update", name, S.Index)
+			}
+		}
+	}
+
+	// givens can only be unassigned once they are unlocked
+	given := 1
+	for threeStarValues[given-1] == 0 {
+		given++
+	}
+	_, e = p.Unassign(given)
+	if e == nil || e.(Error).Condition != LockedGivenCondition {
+		t.Errorf("Unassign of locked given produced incorrect error: %v", e)
+	}
+	if e := p.Unlock(given); e != nil {
+		t.Fatalf("Unlock of given square %d failed: %v", given, e)
+	}
+	if _, e := p.Unassign(given); e != nil {
+		t.Fatalf("Unassign of given square %d failed: %v", given, e)
+	}
+	helperCompareFresh(t, "Unassign of given", p, solution)
+
+	// error cases
+	_, e = p.Unassign(0)
+	if e == nil || e.(Error).Condition != TooSmallCondition {
+		t.Errorf("Unassign of index too small produced incorrect error: %v", e)
+	}
+	_, e = p.Unassign(82)
+	if e == nil || e.(Error).Condition != TooLargeCondition {
+		t.Errorf("Unassign of index too large produced incorrect error: %v", e)
+	}
+	_, e = p.Unassign(given)
+	if e == nil || e.(Error).Condition != NotAssignedCondition {
+		t.Errorf("Unassign of empty square produced incorrect error: %v", e)
+	}
+}
+
+func TestUnassignFixesErrors(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	start := p.allSquares()
+	// this is the failing final assignment from the end-to-end test
+	if _, e := p.Assign(Choice{13, 4}); e != nil {
+		t.Fatalf("Assign(Choice{13, 4}) failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{4, 4}); e != nil {
+		t.Fatalf("Assign(Choice{4, 4}) failed: %v", e)
+	}
+	if len(p.errors) == 0 {
+		t.Fatalf("Assign(Choice{4, 4}) didn't produce errors")
+	}
+	update, e := p.Unassign(4)
+	if e != nil {
+		t.Fatalf("Unassign(4) on puzzle with errors failed: %v", e)
+	}
+	if len(update.Errors) != 0 || len(p.errors) != 0 {
+		t.Errorf("Unassign(4) left errors: %v", p.errors)
+	}
+	helperCompareFresh(t, "Unassign(4)", p, nil)
+	if _, e := p.Unassign(13); e != nil {
+		t.Fatalf("Unassign(13) failed: %v", e)
+	}
+	if SS := p.allSquares(); !reflect.DeepEqual(SS, start) {
+		t.Errorf("Unassigning all the assignments gave %v, expected %v", SS, start)
+	}
+}
+
 type stateTestcase struct {
 	name   string
 	ai, av int
@@ -3103,7 +3580,7 @@ func TestState(t *testing.T) {
 		},
 	}
 	// we apply the testcases in sequence to a base setup
-	p, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3142,6 +3619,7 @@ type puzzleCopyTestcase struct {
 }
 
 func TestPuzzleInternalCopy(t *testing.T) {
+	defer freezeClock()()
 	testcases := []puzzleCopyTestcase{
 		puzzleCopyTestcase{
 			"test 1",
@@ -3180,7 +3658,7 @@ func TestPuzzleInternalCopy(t *testing.T) {
 		},
 	}
 	for _, tc := range testcases {
-		p, e := New(&Summary{nil, StandardGeometryName, 4, tc.vals, nil})
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: tc.vals})
 		if e != nil {
 			t.Fatalf("puzzleCopy %s failed to make puzzle: %v", tc.name, e)
 		}
@@ -3214,7 +3692,7 @@ func TestPuzzleInternalCopy(t *testing.T) {
 }
 
 func TestPuzzleExternalCopy(t *testing.T) {
-	in, e := New(&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialValues, nil})
+	in, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if e != nil {
 		t.Fatalf("Creation of rotation4Puzzle1 failed: %s", e.Error())
 	}
@@ -3398,9 +3876,9 @@ func TestEndToEndPuzzleAssignment(t *testing.T) {
 	}
 	for _, test := range tests {
 		if test.init == nil {
-			p, _ = New(&Summary{nil, StandardGeometryName, 4, nil, nil})
+			p, _ = New(&Summary{Geometry: StandardGeometryName, SideLength: 4})
 		} else {
-			p, _ = New(&Summary{nil, StandardGeometryName, 4, test.init, nil})
+			p, _ = New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: test.init})
 		}
 		for _, assign := range test.setup {
 			tryassign(assign.ai, assign.av, true)
@@ -3440,6 +3918,26 @@ func TestExternalNil(t *testing.T) {
 			t.Errorf("case %v Assign: No error or incorrect condition on invalid puzzle: %v",
 				i, err)
 		}
+		_, err = p.AssignAll([]Choice{{1, 1}})
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v AssignAll: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
+		_, err = p.Unassign(1)
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v Unassign: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
+		err = p.Unlock(1)
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v Unlock: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
+		_, err = p.Checkpoint()
+		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("case %v Checkpoint: No error or incorrect condition on invalid puzzle: %v",
+				i, err)
+		}
 		_, err = p.Copy()
 		if err == nil || err.(Error).Condition != InvalidArgumentCondition {
 			t.Errorf("case %v Copy: No error or incorrect condition on invalid puzzle: %v",
@@ -3487,3 +3985,33 @@ func TestIssue32(t *testing.T) {
 		t.Errorf("Issue 32: pathological9puzzle was created without errors:\n%s", p)
 	}
 }
+
+func TestUnassignErrorful(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 30; trial++ {
+		// assign random possible values until there are errors
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9})
+		if e != nil {
+			t.Fatalf("Creation of empty puzzle failed: %v", e)
+		}
+		var assigned []int
+		for _, i := range rng.Perm(81) {
+			if len(p.errors) > 0 {
+				break
+			}
+			if s := p.squares[i+1]; s.aval == 0 && s.pvals.len() > 0 {
+				p.assign(i+1, s.pvals.intset()[rng.Intn(s.pvals.len())])
+				assigned = append(assigned, i+1)
+			}
+		}
+		// unassigning any of them updates the State correctly
+		for _, i := range assigned {
+			q := p.copy()
+			before := q.state().Squares
+			update := &Content{Squares: q.indicesToSquares(q.unassign(i))}
+			if got, want := applyDelta(before, update), q.state().Squares; !reflect.DeepEqual(got, want) {
+				t.Fatalf("Trial %d: unassign(%d) update gives %v, expected %v", trial, i, got, want)
+			}
+		}
+	}
+}
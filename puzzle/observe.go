@@ -0,0 +1,78 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Change observers
+
+Code that needs to follow a puzzle's changes (such as a push
+channel to clients, or autosave) can register an observer
+rather than wrapping every mutating call.  Observers are called
+synchronously, in the order they were registered, after each
+public operation that changes the puzzle's State, and they get
+the same update as the operation returns.  Observers belong to
+a puzzle, so they are not shared with its copies.
+
+*/
+
+// An observer wraps a registered function, so it has an
+// identity that can be used to cancel it.
+type observer struct {
+	fn func(Content)
+}
+
+// update returns the update to the puzzle's State for the
+// squares with the given indices, after stamping them with the
+// puzzle's version and passing the update to the puzzle's
+// observers.
+func (p *Puzzle) update(is intset) *Content {
+	p.stamp(is)
+	c := &Content{p.indicesToSquares(is), p.allErrors(true)}
+	for _, o := range p.observers {
+		o.fn(*c)
+	}
+	return c
+}
+
+// OnChange registers a function to be called with the update to
+// the puzzle's State after each change made by Assign,
+// AssignAll, Unassign, Unlock, Undo, Redo, Rollback, or a change
+// to the pencil marks.  The update shares storage with the one
+// returned by the operation, so the function must not modify
+// it.  The returned function cancels the registration.
+func (p *Puzzle) OnChange(fn func(Content)) (func(), error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if fn == nil {
+		return nil, argumentError(NamedAttribute, InvalidArgumentCondition, "Observer", fn)
+	}
+	o := &observer{fn}
+	p.observers = append(p.observers, o)
+	cancel := func() {
+		for i, x := range p.observers {
+			if x == o {
+				p.observers = append(p.observers[:i:i], p.observers[i+1:]...)
+				return
+			}
+		}
+	}
+	return cancel, nil
+}
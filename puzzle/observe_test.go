@@ -0,0 +1,102 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOnChange(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	var seen []Content
+	cancel, e := p.OnChange(func(c Content) { seen = append(seen, c) })
+	if e != nil {
+		t.Fatalf("OnChange failed: %v", e)
+	}
+	count := 0
+	cancel2, _ := p.OnChange(func(Content) { count++ })
+
+	// each operation's update is passed to the observers
+	ops := []struct {
+		name string
+		op   func() (*Content, error)
+	}{
+		{"Assign", func() (*Content, error) { return p.Assign(Choice{13, 2}) }},
+		{"AssignAll", func() (*Content, error) { return p.AssignAll([]Choice{{10, 4}}) }},
+		{"Unassign", func() (*Content, error) { return p.Unassign(10) }},
+		{"Undo", func() (*Content, error) { return p.Undo() }},
+		{"Redo", func() (*Content, error) { return p.Redo() }},
+		{"AddMark", func() (*Content, error) { return p.AddMark(2, 2) }},
+		{"RemoveMark", func() (*Content, error) { return p.RemoveMark(2, 2) }},
+		{"ClearMarks", func() (*Content, error) { return p.ClearMarks(2) }},
+	}
+	for i, tc := range ops {
+		update, e := tc.op()
+		if e != nil {
+			t.Fatalf("%s failed: %v", tc.name, e)
+		}
+		if len(seen) != i+1 || !reflect.DeepEqual(seen[i], *update) {
+			t.Errorf("%s: observer saw %v, expected %v", tc.name, seen[len(seen)-1], *update)
+		}
+	}
+	if count != len(ops) {
+		t.Errorf("Second observer was called %d times, expected %d", count, len(ops))
+	}
+	if e := p.Unlock(1); e != nil {
+		t.Fatalf("Unlock(1) failed: %v", e)
+	}
+	if last := seen[len(seen)-1]; len(last.Squares) != 1 || !last.Squares[0].Entered {
+		t.Errorf("Unlock: observer saw %v", last)
+	}
+
+	// failed operations, copies, and cancelled observers aren't notified
+	before := len(seen)
+	p.Assign(Choice{1, 1})
+	q := p.copy()
+	q.Assign(Choice{15, 4})
+	if len(seen) != before {
+		t.Errorf("Observer was called for a failed operation or a copy")
+	}
+	cancel()
+	p.Assign(Choice{15, 4})
+	if len(seen) != before {
+		t.Errorf("Cancelled observer was called")
+	}
+	if count != len(ops)+2 {
+		t.Errorf("Second observer was called %d times, expected %d", count, len(ops)+2)
+	}
+	cancel2()
+	cancel2()
+	if len(p.observers) != 0 {
+		t.Errorf("Puzzle still has observers after cancelling them: %v", p.observers)
+	}
+
+	// error cases
+	if _, e := p.OnChange(nil); e == nil || e.(Error).Condition != InvalidArgumentCondition {
+		t.Errorf("OnChange with nil function produced incorrect error: %v", e)
+	}
+	var np *Puzzle
+	if _, e := np.OnChange(func(Content) {}); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("OnChange on nil puzzle produced incorrect error: %v", e)
+	}
+}
@@ -0,0 +1,70 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+/*
+
+Value occurrences
+
+Highlighting all the squares that have (or could have) a given
+value is a common client feature.  The puzzle already knows the
+answer, so clients can ask rather than recompute it.
+
+*/
+
+// ValueOccurrences gives the indices of the squares where a
+// value occurs, in index order.  Assigned squares have the value
+// assigned, Bound squares are unassigned but bound to the value,
+// and Possible squares are neither assigned nor bound but still
+// have the value as a candidate.
+type ValueOccurrences struct {
+	Value    int   `json:"value"`
+	Assigned []int `json:"assigned,omitempty"`
+	Bound    []int `json:"bound,omitempty"`
+	Possible []int `json:"possible,omitempty"`
+}
+
+// Occurrences returns the squares where the given value is
+// assigned, bound, or still possible.  It's an Error if the
+// value is out of range.
+func (p *Puzzle) Occurrences(value int) (*ValueOccurrences, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if value < 1 || value > p.mapping.sidelen {
+		return nil, rangeError(ValueAttribute, value, 1, p.mapping.sidelen)
+	}
+	vo := &ValueOccurrences{Value: value}
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		switch {
+		case s.aval == value:
+			vo.Assigned = append(vo.Assigned, i)
+		case s.aval != 0:
+		case s.bval == value:
+			vo.Bound = append(vo.Bound, i)
+		case s.bval != 0:
+		default:
+			if s.pvals.find(value) {
+				vo.Possible = append(vo.Possible, i)
+			}
+		}
+	}
+	return vo, nil
+}
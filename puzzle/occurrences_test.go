@@ -0,0 +1,64 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOccurrences(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	for v := 1; v <= 4; v++ {
+		expected := &ValueOccurrences{Value: v}
+		for _, s := range rotation4Puzzle1PartialAssign1CapitalSquares {
+			if s.Aval == v {
+				expected.Assigned = append(expected.Assigned, s.Index)
+			} else if s.Aval == 0 && s.Bval == v {
+				expected.Bound = append(expected.Bound, s.Index)
+			} else if s.Aval == 0 && s.Bval == 0 {
+				for _, pv := range s.Pvals {
+					if pv == v {
+						expected.Possible = append(expected.Possible, s.Index)
+					}
+				}
+			}
+		}
+		vo, e := p.Occurrences(v)
+		if e != nil {
+			t.Fatalf("Occurrences(%d) failed: %v", v, e)
+		}
+		if !reflect.DeepEqual(vo, expected) {
+			t.Errorf("Occurrences(%d) was %+v, expected %+v", v, *vo, *expected)
+		}
+	}
+	for _, v := range []int{0, 5} {
+		if _, e := p.Occurrences(v); e == nil {
+			t.Errorf("Occurrences(%d) succeeded", v)
+		} else if err := e.(Error); err.Attribute != ValueAttribute {
+			t.Errorf("Occurrences(%d) gave the wrong error: %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+
+Parallel group analysis
+
+An assignment in a big puzzle can affect dozens of groups, and
+analyzing them is most of the cost of the assignment.  So, in
+puzzles with sides of at least parallelAnalysisSideLength,
+groups are planned concurrently (see group.analyze) and then
+their plans are applied one at a time in group order.  Because
+planning doesn't depend on the order of the groups, the results
+(including the order of any Errors) are exactly the same as
+analyzing the groups one at a time.  Smaller puzzles have too
+little work per group to make concurrency worthwhile.
+
+The planning is done by the calling goroutine and as many
+helpers as it can get from a pool shared by all puzzles, which
+is bounded by the number of processors.
+
+*/
+
+// parallelAnalysisSideLength is the smallest side length for
+// which groups are analyzed concurrently.
+var parallelAnalysisSideLength = 16
+
+// analysisHelpers holds a token for each helper goroutine that
+// may be planning groups.
+var analysisHelpers = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// analyzeGroups analyzes the groups with the given indices, in
+// order, returning the Errors they find.  If firstErrors is
+// true, it stops after the first group that finds Errors.  If
+// canceled is non-nil, it's checked before each group is
+// analyzed, and analysis stops if it returns true.
+func analyzeGroups(groups []*group, gis []int, ss []*square, firstErrors bool, canceled func() bool) []Error {
+	var plans [][]groupStep
+	if len(gis) > 1 && len(groups[gis[0]].desc.indices) >= parallelAnalysisSideLength {
+		plans = planGroups(groups, gis, ss)
+	}
+	var errs []Error
+	for i, gi := range gis {
+		if canceled != nil && canceled() {
+			break
+		}
+		var gerrs []Error
+		if plans != nil {
+			gerrs = groups[gi].apply(ss, plans[i])
+		} else {
+			gerrs = groups[gi].analyze(ss)
+		}
+		if len(gerrs) > 0 {
+			errs = append(errs, gerrs...)
+			if firstErrors {
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// planGroups plans the analyses of the groups with the given
+// indices concurrently, returning the plans in the same order.
+func planGroups(groups []*group, gis []int, ss []*square) [][]groupStep {
+	plans := make([][]groupStep, len(gis))
+	var next atomic.Int64
+	work := func() {
+		for i := int(next.Add(1) - 1); i < len(gis); i = int(next.Add(1) - 1) {
+			plans[i] = groups[gis[i]].plan(ss, nil)
+		}
+	}
+	var wg sync.WaitGroup
+helpers:
+	for h := 1; h < len(gis); h++ {
+		select {
+		case analysisHelpers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() { <-analysisHelpers; wg.Done() }()
+				work()
+			}()
+		default:
+			break helpers // the pool is in use
+		}
+	}
+	work()
+	wg.Wait()
+	return plans
+}
@@ -0,0 +1,153 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+// analysisRun makes a puzzle, then fills it one square at a time
+// (taking the first possible value when nothing is forced) until
+// it's full or has errors, then unassigns the filled squares in
+// reverse.  It returns the puzzle's content after each step.
+func analysisRun(t *testing.T, sidelen int, vals []int) []*Content {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: sidelen, Values: vals})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	state := func() *Content {
+		c, e := p.State()
+		if e != nil {
+			t.Fatalf("State failed: %v", e)
+		}
+		return c
+	}
+	states := []*Content{state()}
+	var filled []int
+	for len(p.errors) == 0 {
+		idx := 0
+		for i := 1; i <= p.mapping.scount && idx == 0; i++ {
+			if s := p.squares[i]; s.aval == 0 && (s.bval != 0 || s.pvals.len() == 1) {
+				idx = i
+			}
+		}
+		for i := 1; i <= p.mapping.scount && idx == 0; i++ {
+			if p.squares[i].aval == 0 {
+				idx = i
+			}
+		}
+		if idx == 0 {
+			break
+		}
+		val := p.squares[idx].bval
+		if val == 0 {
+			val = p.squares[idx].pvals.min()
+		}
+		p.assign(idx, val)
+		filled = append(filled, idx)
+		states = append(states, state())
+	}
+	for i := len(filled) - 1; i >= 0; i-- {
+		p.unassign(filled[i])
+		states = append(states, state())
+	}
+	return states
+}
+
+func TestParallelAnalysis(t *testing.T) {
+	defer func(old int) { parallelAnalysisSideLength = old }(parallelAnalysisSideLength)
+	conflicting := append([]int(nil), sixteenValues...)
+	conflicting[0] = conflicting[1]
+	cases := []struct {
+		name    string
+		sidelen int
+		vals    []int
+	}{
+		{"4x4", 4, rotation4Puzzle1PartialValues},
+		{"9x9", 9, threeStarValues},
+		{"16x16", 16, sixteenValues},
+		{"16x16 conflicting", 16, conflicting},
+	}
+	for _, tc := range cases {
+		parallelAnalysisSideLength = maxSideLength + 1
+		serial := analysisRun(t, tc.sidelen, tc.vals)
+		parallelAnalysisSideLength = 1
+		parallel := analysisRun(t, tc.sidelen, tc.vals)
+		if len(serial) != len(parallel) {
+			t.Fatalf("%s: serial run had %d steps, parallel run had %d",
+				tc.name, len(serial), len(parallel))
+		}
+		for i := range serial {
+			if !reflect.DeepEqual(serial[i], parallel[i]) {
+				t.Errorf("%s step %d: serial content %v, parallel content %v",
+					tc.name, i, serial[i], parallel[i])
+			}
+		}
+	}
+}
+
+func TestParallelAnalysisCanceled(t *testing.T) {
+	defer func(old int) { parallelAnalysisSideLength = old }(parallelAnalysisSideLength)
+	parallelAnalysisSideLength = 1
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	gis := newIntsetRange(p.mapping.gcount)
+	calls := 0
+	canceled := func() bool { calls++; return calls > 2 }
+	if errs := analyzeGroups(p.groups, gis, p.squares, true, canceled); errs != nil {
+		t.Errorf("Analysis of an analyzed puzzle found errors: %v", errs)
+	}
+	if calls != 3 {
+		t.Errorf("Cancellation was checked %d times, expected 3", calls)
+	}
+}
+
+func benchmarkAnalysis(b *testing.B, side int) {
+	defer func(old int) { parallelAnalysisSideLength = old }(parallelAnalysisSideLength)
+	parallelAnalysisSideLength = side
+	master, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	idx := 1
+	for master.squares[idx].aval != 0 {
+		idx++
+	}
+	val := master.allSolutions()[0].Values[idx-1]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		p, release := master.scratchCopy()
+		b.StartTimer()
+		p.assign(idx, val)
+		release()
+	}
+}
+
+func BenchmarkSerialAnalysis(b *testing.B) {
+	benchmarkAnalysis(b, maxSideLength+1)
+}
+
+func BenchmarkParallelAnalysis(b *testing.B) {
+	benchmarkAnalysis(b, 16)
+}
@@ -0,0 +1,168 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"math"
+	"sync"
+)
+
+/*
+
+Rating bands
+
+The solver rates a solution from 1 to 5 stars by what it took
+to find: how many bound squares, if no choice was needed, or
+else how many choices and among how many values.  The cutoffs
+between the stars are the rating bands.  They start out as the
+ones the solver has always used, and can be recalibrated while
+the server runs (say, from how hard real solvers found the
+puzzles of each rating).
+
+*/
+
+// RatingBands are the cutoffs between star ratings.
+// BoundFraction is the count of bound squares, as a fraction of
+// the side length, that makes a no-choice puzzle a 2-star rather
+// than a 1-star.  A choice among more than WideChoice values is
+// a wide choice, which adds a star to puzzles with fewer than
+// FiveStarChoices choices; puzzles with that many choices are
+// always 5-stars.
+type RatingBands struct {
+	BoundFraction   float64 `json:"boundFraction"`
+	WideChoice      int     `json:"wideChoice"`
+	FiveStarChoices int     `json:"fiveStarChoices"`
+}
+
+// DefaultRatingBands are the bands the solver starts with.
+var DefaultRatingBands = RatingBands{BoundFraction: 0.5, WideChoice: 2, FiveStarChoices: 3}
+
+var (
+	bandsMutex  sync.RWMutex
+	ratingBands = DefaultRatingBands
+)
+
+// CurrentRatingBands returns the bands the solver is rating with.
+func CurrentRatingBands() RatingBands {
+	bandsMutex.RLock()
+	defer bandsMutex.RUnlock()
+	return ratingBands
+}
+
+// SetRatingBands makes the solver rate with the given bands from
+// now on.  It's an error if the bands can't be rated with: a
+// negative bound fraction, or choice cutoffs less than 2.
+func SetRatingBands(b RatingBands) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	bandsMutex.Lock()
+	defer bandsMutex.Unlock()
+	ratingBands = b
+	return nil
+}
+
+// validate checks that the bands can be rated with.
+func (b RatingBands) validate() error {
+	if math.IsNaN(b.BoundFraction) || math.IsInf(b.BoundFraction, 0) || b.BoundFraction < 0 {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "BoundFraction", b.BoundFraction)
+	}
+	if b.WideChoice < 2 {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "WideChoice", b.WideChoice)
+	}
+	if b.FiveStarChoices < 2 {
+		return argumentError(NamedAttribute, InvalidArgumentCondition, "FiveStarChoices", b.FiveStarChoices)
+	}
+	return nil
+}
+
+// rateBound rates a no-choice solution that found the given
+// count of bound squares.
+func (b RatingBands) rateBound(bound, sidelen int) int {
+	if bound < int(b.BoundFraction*float64(sidelen)) {
+		return 1
+	}
+	return 2
+}
+
+// rateChoices rates a solution that made choices among the
+// given counts of values.
+func (b RatingBands) rateChoices(counts []int) int {
+	if len(counts) >= b.FiveStarChoices {
+		return 5
+	}
+	wide := 0
+	for _, count := range counts {
+		if count > b.WideChoice {
+			wide = 1
+		}
+	}
+	if len(counts) == 1 {
+		return 3 + wide
+	}
+	return 4 + wide
+}
+
+// A RatingMeasure is what the solver rates a puzzle by: the
+// bound squares it found, if the puzzle needs no choices, or the
+// count of values it chose among at each choice made in its
+// first solution.
+type RatingMeasure struct {
+	SideLength int   `json:"sideLength"`
+	Bound      int   `json:"bound,omitempty"`
+	Counts     []int `json:"counts,omitempty"`
+}
+
+// Rating rates the measure with the given bands.
+func (m *RatingMeasure) Rating(b RatingBands) int {
+	if len(m.Counts) > 0 {
+		return b.rateChoices(m.Counts)
+	}
+	return b.rateBound(m.Bound, m.SideLength)
+}
+
+// RatingMeasure measures the puzzle the way the solver does when
+// rating it, so it can be rated with other bands.  It's an Error
+// if the puzzle is invalid or has no solution.  The puzzle is not
+// altered.
+func (p *Puzzle) RatingMeasure() (*RatingMeasure, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition)
+	}
+	m := &RatingMeasure{SideLength: p.mapping.sidelen}
+	q, release := p.scratchCopy()
+	vals, bound := solveNoChoices(q)
+	release()
+	if vals != nil {
+		m.Bound = bound
+		return m, nil
+	}
+
+	q, release = p.scratchCopy()
+	defer release()
+	q.begin()
+	s, t := solve(q, nil)
+	if len(s.errors) > 0 {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition)
+	}
+	for _, c := range t {
+		m.Counts = append(m.Counts, c.ccount)
+	}
+	return m, nil
+}
@@ -0,0 +1,147 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRateChoices(t *testing.T) {
+	tcs := []struct {
+		counts []int
+		rating int
+	}{
+		{[]int{2}, 3},
+		{[]int{3}, 4},
+		{[]int{2, 2}, 4},
+		{[]int{2, 3}, 5},
+		{[]int{4, 2}, 5},
+		{[]int{2, 2, 2}, 5},
+	}
+	for i, tc := range tcs {
+		if r := DefaultRatingBands.rateChoices(tc.counts); r != tc.rating {
+			t.Errorf("test %d: counts %v rated %d, expected %d", i+1, tc.counts, r, tc.rating)
+		}
+	}
+
+	wider := RatingBands{BoundFraction: 0.5, WideChoice: 3, FiveStarChoices: 4}
+	for i, tc := range []struct {
+		counts []int
+		rating int
+	}{
+		{[]int{3}, 3},
+		{[]int{4}, 4},
+		{[]int{2, 3}, 4},
+		{[]int{2, 2, 4}, 5},
+		{[]int{2, 2, 2}, 4},
+		{[]int{2, 2, 2, 2}, 5},
+	} {
+		if r := wider.rateChoices(tc.counts); r != tc.rating {
+			t.Errorf("wider test %d: counts %v rated %d, expected %d", i+1, tc.counts, r, tc.rating)
+		}
+	}
+}
+
+func TestRateBound(t *testing.T) {
+	// the default bands match the solver's original sidelen/2
+	for _, sidelen := range []int{4, 6, 9, 12, 16} {
+		for bound := 0; bound <= sidelen; bound++ {
+			expect := 2
+			if bound < sidelen/2 {
+				expect = 1
+			}
+			if r := DefaultRatingBands.rateBound(bound, sidelen); r != expect {
+				t.Errorf("side %d bound %d rated %d, expected %d", sidelen, bound, r, expect)
+			}
+		}
+	}
+}
+
+func TestSetRatingBands(t *testing.T) {
+	defer SetRatingBands(DefaultRatingBands)
+	for i, b := range []RatingBands{
+		{BoundFraction: -1, WideChoice: 2, FiveStarChoices: 3},
+		{BoundFraction: math.NaN(), WideChoice: 2, FiveStarChoices: 3},
+		{BoundFraction: 0.5, WideChoice: 1, FiveStarChoices: 3},
+		{BoundFraction: 0.5, WideChoice: 2, FiveStarChoices: 1},
+	} {
+		if err := SetRatingBands(b); err == nil {
+			t.Errorf("test %d: invalid bands %+v were accepted", i+1, b)
+		}
+	}
+	if b := CurrentRatingBands(); b != DefaultRatingBands {
+		t.Errorf("Invalid bands changed the current bands to %+v", b)
+	}
+
+	// a huge bound fraction makes every no-choice puzzle a 1-star
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	if sols := p.allSolutions(); sols[0].Rating != 2 {
+		t.Fatalf("Default rating is %d, expected 2", sols[0].Rating)
+	}
+	if err := SetRatingBands(RatingBands{BoundFraction: 10, WideChoice: 2, FiveStarChoices: 3}); err != nil {
+		t.Fatalf("Failed to set bands: %v", err)
+	}
+	if sols := p.allSolutions(); sols[0].Rating != 1 {
+		t.Errorf("Recalibrated rating is %d, expected 1", sols[0].Rating)
+	}
+}
+
+func TestRatingMeasure(t *testing.T) {
+	tcs := []struct {
+		sidelen int
+		values  []int
+		choices bool
+	}{
+		{9, oneStarValues, false},
+		{9, threeStarValues, false},
+		{9, sixStarValues, true},
+		{9, fiveStarValues, true},
+		{4, solveSimpleStartValues, true},
+	}
+	for i, tc := range tcs {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: tc.sidelen, Values: tc.values})
+		if e != nil {
+			t.Fatalf("test %d: Failed to create puzzle: %v", i+1, e)
+		}
+		m, e := p.RatingMeasure()
+		if e != nil {
+			t.Fatalf("test %d: Failed to measure puzzle: %v", i+1, e)
+		}
+		if m.SideLength != tc.sidelen || (len(m.Counts) > 0) != tc.choices {
+			t.Errorf("test %d: Unexpected measure %+v", i+1, m)
+		}
+		if r, expect := m.Rating(DefaultRatingBands), p.allSolutions()[0].Rating; r != expect {
+			t.Errorf("test %d: Measure rated %d, expected %d", i+1, r, expect)
+		}
+	}
+
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	p.Assign(Choice{Index: 1, Value: 1})
+	p.Assign(Choice{Index: 2, Value: 1})
+	if _, e := p.RatingMeasure(); e == nil {
+		t.Errorf("Measured a puzzle with errors")
+	}
+}
@@ -0,0 +1,69 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "context"
+
+/*
+
+Replay
+
+A recorded game is a starting puzzle plus the choices the player
+made.  Replaying it step by step gives a viewer the change at
+each step, and gives a server a way to check that a claimed game
+could actually have been played.
+
+*/
+
+// Replay creates a puzzle from a summary and then assigns the
+// given choices to it in order, as if each were passed to
+// Assign.  It returns the puzzle and the Content returned by each
+// assignment.
+//
+// If a choice can't be assigned, Replay stops there and returns
+// the puzzle as it was before that choice, the steps before it,
+// and the Error from Assign; so the failed choice is the one at
+// index len(steps).  If the puzzle can't be created, the puzzle
+// and steps are nil.
+func Replay(summary *Summary, choices []Choice) (*Puzzle, []*Content, error) {
+	return ReplayContext(context.Background(), summary, choices)
+}
+
+// ReplayContext is Replay with a context, which is checked
+// before each choice.  If the context is done before the replay
+// finishes, the result is as for a failed choice, with an Error
+// whose condition is CanceledCondition.
+func ReplayContext(ctx context.Context, summary *Summary, choices []Choice) (*Puzzle, []*Content, error) {
+	p, e := NewContext(ctx, summary)
+	if e != nil {
+		return nil, nil, e
+	}
+	steps := make([]*Content, 0, len(choices))
+	for _, choice := range choices {
+		if ctx.Err() != nil {
+			return p, steps, canceledError(ctx)
+		}
+		c, e := p.Assign(choice)
+		if e != nil {
+			return p, steps, e
+		}
+		steps = append(steps, c)
+	}
+	return p, steps, nil
+}
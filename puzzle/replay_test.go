@@ -0,0 +1,82 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	summary := &Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues}
+	choices := []Choice{{13, 2}, {10, 4}, {15, 4}}
+	p, steps, e := Replay(summary, choices)
+	if e != nil {
+		t.Fatalf("Replay(%v) failed: %v", choices, e)
+	}
+	if !reflect.DeepEqual(p.allSquares(), rotation4Puzzle1PartialAssign3CapitalSquares) {
+		t.Errorf("Replay left squares %v", p.allSquares())
+	}
+	// the steps are what Assign would have returned
+	q, _ := New(summary)
+	if len(steps) != len(choices) {
+		t.Fatalf("Replay returned %d steps, expected %d", len(steps), len(choices))
+	}
+	for i, choice := range choices {
+		c, _ := q.Assign(choice)
+		if !reflect.DeepEqual(steps[i], c) {
+			t.Errorf("Step %d was %+v, expected %+v", i, *steps[i], *c)
+		}
+	}
+	// the replayed moves can be undone
+	if _, e := p.Undo(); e != nil {
+		t.Errorf("Undo after Replay failed: %v", e)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	summary := &Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues}
+	choices := []Choice{{13, 2}, {10, 4}, {15, 4}, {13, 1}, {16, 1}}
+	p, steps, e := Replay(summary, choices)
+	if e == nil {
+		t.Fatalf("Replay(%v) succeeded", choices)
+	}
+	if err := e.(Error); err.Condition != DuplicateAssignmentCondition {
+		t.Errorf("Replay gave the wrong error: %v", err)
+	}
+	if len(steps) != 3 {
+		t.Errorf("Replay failed after %d steps, expected 3", len(steps))
+	}
+	if !reflect.DeepEqual(p.allSquares(), rotation4Puzzle1PartialAssign3CapitalSquares) {
+		t.Errorf("Failed replay left squares %v", p.allSquares())
+	}
+
+	p, steps, e = Replay(&Summary{}, choices)
+	if e == nil || p != nil || steps != nil {
+		t.Errorf("Replay of an invalid summary gave %v, %v, %v", p, steps, e)
+	}
+
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+	p, _, e = ReplayContext(done, summary, choices)
+	if e == nil || e.(Error).Condition != CanceledCondition || p != nil {
+		t.Errorf("Replay with a done context gave %v, %v", p, e)
+	}
+}
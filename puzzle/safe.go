@@ -0,0 +1,469 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+
+Concurrency-safe puzzles
+
+Puzzles are not safe for concurrent use: even queries read
+squares that operations change in place.  A SafePuzzle wraps a
+puzzle with a reader/writer lock, so that its queries can run
+concurrently with each other while its operations are
+serialized.  Readers that want to work without holding the lock
+(such as renderers and raters) can take a Snapshot.
+
+Observers registered with OnChange are called while the lock is
+held for writing, so they must not call back into the
+SafePuzzle.
+
+*/
+
+// A SafePuzzle is a puzzle that's safe for concurrent use.
+type SafePuzzle struct {
+	mutex sync.RWMutex
+	p     *Puzzle
+}
+
+// NewSafe creates a SafePuzzle from a summary, just as New
+// creates a Puzzle.
+func NewSafe(summary *Summary) (*SafePuzzle, error) {
+	p, e := New(summary)
+	if e != nil {
+		return nil, e
+	}
+	return &SafePuzzle{p: p}, nil
+}
+
+// read returns the wrapped puzzle locked for reading, along with
+// the function that unlocks it.  A nil SafePuzzle has a nil
+// puzzle, so its queries return an Error.
+func (sp *SafePuzzle) read() (*Puzzle, func()) {
+	if sp == nil {
+		return nil, func() {}
+	}
+	sp.mutex.RLock()
+	return sp.p, sp.mutex.RUnlock
+}
+
+// write returns the wrapped puzzle locked for writing, along
+// with the function that unlocks it.
+func (sp *SafePuzzle) write() (*Puzzle, func()) {
+	if sp == nil {
+		return nil, func() {}
+	}
+	sp.mutex.Lock()
+	return sp.p, sp.mutex.Unlock
+}
+
+// Update calls a function with the wrapped puzzle while holding
+// the lock for writing, so that a sequence of operations is made
+// as a unit.  The function must not keep the puzzle.
+func (sp *SafePuzzle) Update(fn func(*Puzzle) error) error {
+	p, unlock := sp.write()
+	defer unlock()
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	return fn(p)
+}
+
+/*
+
+Queries, which are made with the lock held for reading.
+
+*/
+
+// Hash returns the Signature of the puzzle.
+func (sp *SafePuzzle) Hash() (Signature, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Hash()
+}
+
+// ETag returns the entity tag of the puzzle.
+func (sp *SafePuzzle) ETag() (string, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.ETag()
+}
+
+// Summary returns the summary of the puzzle.
+func (sp *SafePuzzle) Summary() (*Summary, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Summary()
+}
+
+// State returns the entire content of the puzzle.
+func (sp *SafePuzzle) State() (*Content, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.State()
+}
+
+// Version returns the puzzle's current version.
+func (sp *SafePuzzle) Version() (int, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Version()
+}
+
+// StateSince returns the content of the squares changed since the
+// given version, and the puzzle's current version.
+func (sp *SafePuzzle) StateSince(version int) (*Content, int, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.StateSince(version)
+}
+
+// Journal returns the puzzle's history of moves.
+func (sp *SafePuzzle) Journal() (*Journal, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Journal()
+}
+
+// History returns the moves that are done on the puzzle.
+func (sp *SafePuzzle) History() ([]Move, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.History()
+}
+
+// Solutions finds all solutions to the puzzle.
+func (sp *SafePuzzle) Solutions() ([]Solution, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Solutions()
+}
+
+// Solve finds a solution to the puzzle, if it has one.
+func (sp *SafePuzzle) Solve() (*Solution, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Solve()
+}
+
+// SolveContext finds up to max solutions to the puzzle (all of
+// them, if max is 0), stopping if the context is done.
+func (sp *SafePuzzle) SolveContext(ctx context.Context, max int) ([]Solution, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.SolveContext(ctx, max)
+}
+
+// RatingMeasure measures the puzzle the way the solver does when
+// rating it.
+func (sp *SafePuzzle) RatingMeasure() (*RatingMeasure, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.RatingMeasure()
+}
+
+// Copy returns a new (unwrapped) puzzle with the same content.
+func (sp *SafePuzzle) Copy() (*Puzzle, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Copy()
+}
+
+// Snapshot returns a read-only view of the puzzle as it is now.
+func (sp *SafePuzzle) Snapshot() (*PuzzleView, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Snapshot()
+}
+
+// Group returns the squares in a group of the puzzle.
+func (sp *SafePuzzle) Group(gid GroupID) ([]Square, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Group(gid)
+}
+
+// Row returns the squares in a row of the puzzle.
+func (sp *SafePuzzle) Row(i int) ([]Square, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Row(i)
+}
+
+// Column returns the squares in a column of the puzzle.
+func (sp *SafePuzzle) Column(i int) ([]Square, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Column(i)
+}
+
+// Peers returns the peers of a square in the puzzle.
+func (sp *SafePuzzle) Peers(index int) ([]int, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Peers(index)
+}
+
+// GroupsOf returns the groups of a square in the puzzle.
+func (sp *SafePuzzle) GroupsOf(index int) ([]GroupID, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.GroupsOf(index)
+}
+
+// Heatmap returns the candidate heatmap of the puzzle.
+func (sp *SafePuzzle) Heatmap() (*Heatmap, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Heatmap()
+}
+
+// Occurrences returns where a value occurs in the puzzle.
+func (sp *SafePuzzle) Occurrences(value int) (*ValueOccurrences, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Occurrences(value)
+}
+
+// Grid returns the puzzle's values and givens by row.
+func (sp *SafePuzzle) Grid() ([][]int, [][]bool, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Grid()
+}
+
+// Validate cross-checks the puzzle's internal state.
+func (sp *SafePuzzle) Validate() []Error {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Validate()
+}
+
+// MemStats estimates the memory used by the puzzle.
+func (sp *SafePuzzle) MemStats() (*MemStats, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.MemStats()
+}
+
+// CheckAgainst compares the puzzle's assigned values with a
+// solution.
+func (sp *SafePuzzle) CheckAgainst(solution []int) ([]Verdict, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.CheckAgainst(solution)
+}
+
+// VerifySolution checks that a solution solves the puzzle.
+func (sp *SafePuzzle) VerifySolution(solution []int) ([]int, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.VerifySolution(solution)
+}
+
+// FindTechnique looks for an instance of the named technique in
+// the puzzle.
+func (sp *SafePuzzle) FindTechnique(name string) (*TechniqueInstance, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.FindTechnique(name)
+}
+
+// ExplainError explains why the puzzle is unsolvable.
+func (sp *SafePuzzle) ExplainError() (*ErrorExplanation, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.ExplainError()
+}
+
+// Describe returns an accessible description of the puzzle, with
+// a square selected.
+func (sp *SafePuzzle) Describe(index int, braille bool) (*Description, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Describe(index, braille)
+}
+
+// Difficulties estimates the difficulty of the puzzle's empty
+// squares.
+func (sp *SafePuzzle) Difficulties() ([]SquareDifficulty, error) {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Difficulties()
+}
+
+// Assist returns the puzzle's assist level.
+func (sp *SafePuzzle) Assist() AssistLevel {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Assist()
+}
+
+// Annotations returns the puzzle's annotations.
+func (sp *SafePuzzle) Annotations() []Annotation {
+	p, unlock := sp.read()
+	defer unlock()
+	return p.Annotations()
+}
+
+/*
+
+Operations, which are made with the lock held for writing.
+
+*/
+
+// Assign a choice to the puzzle.
+func (sp *SafePuzzle) Assign(choice Choice) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Assign(choice)
+}
+
+// AssignAll assigns a list of choices to the puzzle as a unit.
+func (sp *SafePuzzle) AssignAll(choices []Choice) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.AssignAll(choices)
+}
+
+// Unassign clears the value assigned to a square.
+func (sp *SafePuzzle) Unassign(index int) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Unassign(index)
+}
+
+// SetAssist sets the puzzle's assist level.
+func (sp *SafePuzzle) SetAssist(level AssistLevel) error {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.SetAssist(level)
+}
+
+// Annotate adds an annotation to the puzzle.
+func (sp *SafePuzzle) Annotate(a Annotation) (Annotation, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Annotate(a)
+}
+
+// RemoveAnnotation removes one of the puzzle's annotations.
+func (sp *SafePuzzle) RemoveAnnotation(id int) error {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.RemoveAnnotation(id)
+}
+
+// SetActor sets the actor recorded with later moves on the puzzle.
+func (sp *SafePuzzle) SetActor(actor string) error {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.SetActor(actor)
+}
+
+// Unlock turns the given in a square into an entered value.
+func (sp *SafePuzzle) Unlock(index int) error {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Unlock(index)
+}
+
+// Freeze makes all the puzzle's assigned values givens.
+func (sp *SafePuzzle) Freeze() error {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Freeze()
+}
+
+// Undo takes back the last move made on the puzzle.
+func (sp *SafePuzzle) Undo() (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Undo()
+}
+
+// Redo makes the last undone move again.
+func (sp *SafePuzzle) Redo() (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Redo()
+}
+
+// Checkpoint marks the puzzle's current state.
+func (sp *SafePuzzle) Checkpoint() (CheckpointToken, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Checkpoint()
+}
+
+// Rollback returns the puzzle to the state of a checkpoint.
+func (sp *SafePuzzle) Rollback(token CheckpointToken) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Rollback(token)
+}
+
+// Commit closes a checkpoint, keeping the moves made since.
+func (sp *SafePuzzle) Commit(token CheckpointToken) error {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.Commit(token)
+}
+
+// AddMark adds a pencil mark to an empty square.
+func (sp *SafePuzzle) AddMark(index, value int) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.AddMark(index, value)
+}
+
+// RemoveMark removes a pencil mark from an empty square.
+func (sp *SafePuzzle) RemoveMark(index, value int) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.RemoveMark(index, value)
+}
+
+// ClearMarks removes all the pencil marks from an empty square.
+func (sp *SafePuzzle) ClearMarks(index int) (*Content, error) {
+	p, unlock := sp.write()
+	defer unlock()
+	return p.ClearMarks(index)
+}
+
+// OnChange registers a function to be called after each change
+// to the puzzle.  The returned function cancels the
+// registration, and is also safe for concurrent use.
+func (sp *SafePuzzle) OnChange(fn func(Content)) (func(), error) {
+	p, unlock := sp.write()
+	defer unlock()
+	cancel, e := p.OnChange(fn)
+	if e != nil {
+		return nil, e
+	}
+	return func() {
+		_, unlock := sp.write()
+		defer unlock()
+		cancel()
+	}, nil
+}
@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSafePuzzle(t *testing.T) {
+	sp, e := NewSafe(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	solutions, e := sp.Solutions()
+	if e != nil || len(solutions) != 1 {
+		t.Fatalf("Solutions returned %v (%v)", solutions, e)
+	}
+	solution := solutions[0].Values
+	changes := 0
+	cancel, e := sp.OnChange(func(Content) { changes++ })
+	if e != nil {
+		t.Fatalf("OnChange failed: %v", e)
+	}
+
+	// writers fill in disjoint sets of squares, while readers watch
+	var wg sync.WaitGroup
+	writers, assigned := 3, 0
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(solution); i += writers {
+				if threeStarValues[i] == 0 {
+					if _, e := sp.Assign(Choice{i + 1, solution[i]}); e != nil {
+						t.Errorf("Assign(Choice{%d, %d}) failed: %v", i+1, solution[i], e)
+					}
+				}
+			}
+		}(w)
+	}
+	for _, v := range threeStarValues {
+		if v == 0 {
+			assigned++
+		}
+	}
+	for r := 0; r < 3; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, e := sp.State(); e != nil {
+					t.Errorf("State failed: %v", e)
+				}
+				sp.Row(1)
+				sp.Peers(41)
+				sp.Hash()
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	if changes != assigned {
+		t.Errorf("Observer saw %d changes, expected %d", changes, assigned)
+	}
+	summary, _ := sp.Summary()
+	for i, v := range summary.Values {
+		if v != solution[i] {
+			t.Fatalf("Concurrently filled puzzle has values %v, expected %v", summary.Values, solution)
+		}
+	}
+
+	// Update makes a sequence of operations as a unit
+	e = sp.Update(func(p *Puzzle) error {
+		if _, e := p.Unassign(summary.Entered[0]); e != nil {
+			return e
+		}
+		_, e := p.Undo()
+		return e
+	})
+	if e != nil {
+		t.Errorf("Update failed: %v", e)
+	}
+
+	// error cases
+	if _, e := NewSafe(&Summary{Geometry: "notachance", SideLength: 9}); e == nil {
+		t.Errorf("NewSafe of bad summary succeeded")
+	}
+	var nsp *SafePuzzle
+	if _, e := nsp.State(); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("State on nil SafePuzzle produced incorrect error: %v", e)
+	}
+	if e := nsp.Update(func(*Puzzle) error { return nil }); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("Update on nil SafePuzzle produced incorrect error: %v", e)
+	}
+}
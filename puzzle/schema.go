@@ -0,0 +1,318 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+
+Summary schemas
+
+Summaries outlive the release that wrote them: they sit in
+session caches, backups, and exported files, and get read back
+by whatever release is running later.  So the encoding of a
+Summary says which schema it follows, and decoding converts
+older schemas to the current one before the puzzle sees them.
+
+Schema 1 is every summary written before schemas were recorded,
+so it covers a range of releases.  Depending on which one wrote
+it, a schema 1 summary may be missing its side length, may have
+errors that carry only their code or no structure, and may have
+a journal of player moves but no list of entered squares (so
+that New would take the player's moves for givens).  Its
+metadata predates the limits that New enforces, so it may have
+empty or over-long keys, over-long values, or too many entries.
+Untagged error values are handled by ErrorData itself.
+
+Schema 2 is the current schema.  Its summaries end with the
+schema number, which encoding/json and older releases ignore.
+
+*/
+
+// SummarySchema is the schema of the summaries written by this
+// release.
+const SummarySchema = 2
+
+// summaryUpgrades[i] converts the fields of a schema i+1 summary
+// to those of a schema i+2 summary.
+var summaryUpgrades = []func(fields map[string]json.RawMessage) error{
+	upgradeSummary1,
+}
+
+// summaryFields has the fields of a Summary without its methods,
+// so it can be decoded without recursion.
+type summaryFields Summary
+
+// A versionedSummary is the encoded form of a Summary, including
+// its schema.
+type versionedSummary struct {
+	summaryFields
+	Schema int `json:"schema"`
+}
+
+// UnmarshalJSON decodes a Summary of any schema up to the
+// current one, converting older schemas as it goes.  It's an
+// Error if the summary is from a newer schema than this
+// release knows.
+func (s *Summary) UnmarshalJSON(data []byte) error {
+	var vs versionedSummary
+	if e := json.Unmarshal(data, &vs); e != nil {
+		return e
+	}
+	if vs.Schema == SummarySchema {
+		*s = Summary(vs.summaryFields)
+		return nil
+	}
+	data, e := UpgradeSummaryJSON(data)
+	if e != nil {
+		return e
+	}
+	vs = versionedSummary{}
+	if e := json.Unmarshal(data, &vs); e != nil {
+		return e
+	}
+	*s = Summary(vs.summaryFields)
+	return nil
+}
+
+// SummaryJSONSchema returns the schema of an encoded summary.
+// Summaries without a schema are schema 1.
+func SummaryJSONSchema(data []byte) (int, error) {
+	var v struct {
+		Schema int `json:"schema"`
+	}
+	if e := json.Unmarshal(data, &v); e != nil {
+		return 0, argumentError(SummaryAttribute, InvalidArgumentCondition, e.Error())
+	}
+	if v.Schema == 0 {
+		return 1, nil
+	}
+	return v.Schema, nil
+}
+
+// UpgradeSummaryJSON converts an encoded summary of any schema
+// to the current schema, and returns its new encoding.  Current
+// summaries are returned unchanged.
+func UpgradeSummaryJSON(data []byte) ([]byte, error) {
+	schema, e := SummaryJSONSchema(data)
+	if e != nil {
+		return nil, e
+	}
+	if schema == SummarySchema {
+		return data, nil
+	}
+	if schema < 1 || schema > SummarySchema {
+		return nil, rangeError(SummaryAttribute, schema, 1, SummarySchema)
+	}
+	var fields map[string]json.RawMessage
+	if e := json.Unmarshal(data, &fields); e != nil || fields == nil {
+		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, string(data))
+	}
+	for ; schema < SummarySchema; schema++ {
+		if e := summaryUpgrades[schema-1](fields); e != nil {
+			return nil, e
+		}
+	}
+	fields["schema"] = json.RawMessage(strconv.Itoa(SummarySchema))
+	return json.Marshal(fields)
+}
+
+// upgradeSummary1 converts a schema 1 summary to schema 2.
+func upgradeSummary1(fields map[string]json.RawMessage) error {
+	invalid := argumentError(SummaryAttribute, InvalidArgumentCondition, fields)
+	// the side length is implied by the values
+	var sidelen int
+	if raw, ok := fields["sidelen"]; ok {
+		if e := json.Unmarshal(raw, &sidelen); e != nil {
+			return invalid
+		}
+	}
+	if sidelen == 0 {
+		var values []int
+		if raw, ok := fields["values"]; ok {
+			if e := json.Unmarshal(raw, &values); e != nil {
+				return invalid
+			}
+		}
+		for sidelen*sidelen < len(values) {
+			sidelen++
+		}
+		if sidelen > 0 && sidelen*sidelen == len(values) {
+			fields["sidelen"] = json.RawMessage(strconv.Itoa(sidelen))
+		}
+	}
+	// metadata is fit to the limits
+	if raw, ok := fields["metadata"]; ok && !isJSONNull(raw) {
+		var md map[string]string
+		if e := json.Unmarshal(raw, &md); e != nil {
+			return invalid
+		}
+		encoded, e := json.Marshal(upgradeMetadata1(md))
+		if e != nil {
+			return invalid
+		}
+		fields["metadata"] = encoded
+	}
+	// errors get a structure, and a scope from their code
+	if raw, ok := fields["errors"]; ok && !isJSONNull(raw) {
+		var errs []map[string]json.RawMessage
+		if e := json.Unmarshal(raw, &errs); e != nil {
+			return invalid
+		}
+		for _, err := range errs {
+			if e := upgradeError1(err); e != nil {
+				return invalid
+			}
+		}
+		encoded, e := json.Marshal(errs)
+		if e != nil {
+			return invalid
+		}
+		fields["errors"] = encoded
+	}
+	// the entered squares are the ones assigned by the journal
+	if _, ok := fields["entered"]; !ok {
+		if raw, ok := fields["journal"]; ok && !isJSONNull(raw) {
+			var j Journal
+			if e := json.Unmarshal(raw, &j); e != nil || j.Done < 0 || j.Done > len(j.Moves) {
+				return invalid
+			}
+			var entered intset
+			for _, m := range j.Moves[:j.Done] {
+				switch m.Action {
+				case AssignAction:
+					entered.insert(m.Index)
+				case UnassignAction:
+					entered.remove(m.Index)
+				}
+			}
+			if len(entered) > 0 {
+				encoded, _ := json.Marshal([]int(entered))
+				fields["entered"] = encoded
+			}
+		}
+	}
+	return nil
+}
+
+// upgradeMetadata1 fits the metadata of a schema 1 summary to
+// the limits New enforces.  Over-long keys and values are cut
+// short, and entries with empty keys are dropped.  If there are
+// too many entries (or two keys are the same once cut short), the
+// entries with the first keys in sorted order are kept.
+func upgradeMetadata1(md map[string]string) map[string]string {
+	result := make(map[string]string, len(md))
+	for _, k := range slices.Sorted(maps.Keys(md)) {
+		key := truncateUTF8(k, maxMetadataKeyLength)
+		if _, ok := result[key]; ok || key == "" || len(result) == maxMetadataEntries {
+			continue
+		}
+		result[key] = truncateUTF8(md[k], maxMetadataValueLength)
+	}
+	return result
+}
+
+// truncateUTF8 cuts a string to at most max bytes without
+// splitting a character.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// upgradeError1 converts the fields of an error in a schema 1
+// summary.  An error with only a code gets its scope, attribute,
+// and condition from the code.  An error without a structure
+// gets one from its attribute: the errors in summaries describe
+// squares and groups, and those with attributes also name the
+// value that's wrong.
+func upgradeError1(fields map[string]json.RawMessage) error {
+	var err struct {
+		Scope     ErrorScope     `json:"scope"`
+		Structure ErrorStructure `json:"structure"`
+		Attribute ErrorAttribute `json:"attribute"`
+		Condition ErrorCondition `json:"condition"`
+		Code      string         `json:"code"`
+	}
+	encoded, _ := json.Marshal(fields)
+	if e := json.Unmarshal(encoded, &err); e != nil {
+		return e
+	}
+	if err.Scope == UnknownScope && err.Code != "" {
+		if !parseErrorCode(err.Code, &err.Scope, &err.Attribute, &err.Condition) {
+			return argumentError(SummaryAttribute, InvalidArgumentCondition, err.Code)
+		}
+		fields["scope"] = json.RawMessage(strconv.Itoa(int(err.Scope)))
+		fields["condition"] = json.RawMessage(strconv.Itoa(int(err.Condition)))
+		if err.Attribute != UnknownAttribute {
+			fields["attribute"] = json.RawMessage(strconv.Itoa(int(err.Attribute)))
+		}
+	}
+	if err.Structure == UnknownStructure {
+		structure := ScopeStructure
+		if err.Attribute != UnknownAttribute {
+			structure = AttributeValueStructure
+		}
+		fields["structure"] = json.RawMessage(strconv.Itoa(int(structure)))
+	}
+	return nil
+}
+
+// parseErrorCode is the inverse of Error.Code: it looks up the
+// names in a code, and reports whether they are all known.
+func parseErrorCode(code string, sc *ErrorScope, at *ErrorAttribute, co *ErrorCondition) bool {
+	parts := strings.Split(code, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return false
+	}
+	lookup := func(name string, names []string) int {
+		for i, n := range names {
+			if i > 0 && n == name {
+				return i
+			}
+		}
+		return 0
+	}
+	*sc = ErrorScope(lookup(parts[0], scopeNames[:]))
+	*co = ErrorCondition(lookup(parts[len(parts)-1], conditionNames[:]))
+	*at = UnknownAttribute
+	if len(parts) == 3 {
+		if *at = ErrorAttribute(lookup(parts[1], attributeNames[:])); *at == UnknownAttribute {
+			return false
+		}
+	}
+	return *sc != UnknownScope && *co != UnknownCondition
+}
+
+// isJSONNull reports whether an encoded value is null.
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
@@ -0,0 +1,203 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarySchemaRoundTrip(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	if _, e := p.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	summary, e := p.Summary()
+	if e != nil {
+		t.Fatalf("Summary failed: %v", e)
+	}
+	encoded, e := json.Marshal(summary)
+	if e != nil {
+		t.Fatalf("Marshal failed: %v", e)
+	}
+	if !strings.HasSuffix(string(encoded), `,"schema":2}`) {
+		t.Errorf("Encoding doesn't end with the schema: %s", encoded)
+	}
+	if schema, e := SummaryJSONSchema(encoded); e != nil || schema != SummarySchema {
+		t.Errorf("Schema of encoding is %d, %v", schema, e)
+	}
+	if upgraded, e := UpgradeSummaryJSON(encoded); e != nil || string(upgraded) != string(encoded) {
+		t.Errorf("Upgrade of current summary gave %s, %v", upgraded, e)
+	}
+	var decoded Summary
+	if e := json.Unmarshal(encoded, &decoded); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if !reflect.DeepEqual(&decoded, summary) {
+		t.Errorf("Decoded summary is %+v, expected %+v", decoded, *summary)
+	}
+}
+
+func TestSummarySchemaLegacyJournal(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	for _, c := range []Choice{{9, 7}, {12, 4}} {
+		if _, e := p.Assign(c); e != nil {
+			t.Fatalf("Assign of %v failed: %v", c, e)
+		}
+	}
+	if _, e := p.Undo(); e != nil {
+		t.Fatalf("Undo failed: %v", e)
+	}
+	journal, e := p.Journal()
+	if e != nil {
+		t.Fatalf("Journal failed: %v", e)
+	}
+	// a schema 1 summary: no side length, no entered squares
+	legacy, e := json.Marshal(map[string]interface{}{
+		"geometry": StandardGeometryName,
+		"values":   p.allValues(),
+		"journal":  journal,
+	})
+	if e != nil {
+		t.Fatalf("Marshal failed: %v", e)
+	}
+	if schema, e := SummaryJSONSchema(legacy); e != nil || schema != 1 {
+		t.Errorf("Schema of legacy summary is %d, %v", schema, e)
+	}
+	var summary Summary
+	if e := json.Unmarshal(legacy, &summary); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	if summary.SideLength != 9 || !reflect.DeepEqual(summary.Entered, []int{9}) {
+		t.Errorf("Upgraded summary has side length %d, entered %v", summary.SideLength, summary.Entered)
+	}
+	upgraded, e := New(&summary)
+	if e != nil {
+		t.Fatalf("New on upgraded summary failed: %v", e)
+	}
+	if _, e := upgraded.Redo(); e != nil {
+		t.Errorf("Redo on upgraded puzzle failed: %v", e)
+	}
+	if _, e := upgraded.Unassign(9); e != nil {
+		t.Errorf("Unassign of journaled move failed: %v", e)
+	}
+}
+
+func TestSummarySchemaLegacyErrors(t *testing.T) {
+	legacy := `{"geometry":"square","sidelen":4,"errors":[` +
+		`{"code":"square.assigned-value.duplicate-assignment","values":[2,3]},` +
+		`{"scope":4,"condition":7,"values":[{"gtype":"row","index":1},1]}]}`
+	var summary Summary
+	if e := json.Unmarshal([]byte(legacy), &summary); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	expected := []Error{
+		{Scope: SquareScope, Structure: AttributeValueStructure, Attribute: AssignedValueAttribute,
+			Condition: DuplicateAssignmentCondition, Values: ErrorData{2, 3}},
+		{Scope: GroupScope, Structure: ScopeStructure, Condition: NoGroupValueCondition,
+			Values: ErrorData{GroupID{GtypeRow, 1}, 1}},
+	}
+	if !reflect.DeepEqual(summary.Errors, expected) {
+		t.Errorf("Upgraded errors are %+v, expected %+v", summary.Errors, expected)
+	}
+	for _, bad := range []string{
+		`{"geometry":"square","sidelen":4,"errors":[{"code":"square.no-such-condition"}]}`,
+		`{"geometry":"square","sidelen":4,"schema":3}`,
+		`{"geometry":"square","sidelen":4,"schema":-1}`,
+		`[1, 2]`,
+	} {
+		if e := json.Unmarshal([]byte(bad), &summary); e == nil {
+			t.Errorf("Unmarshal of %s succeeded", bad)
+		}
+	}
+}
+
+func TestSummarySchemaLegacyMetadata(t *testing.T) {
+	// written by the encoder of a release from before schemas
+	// were recorded, with metadata that breaks the current limits
+	legacy, e := os.ReadFile("testdata/schema1-summary.json")
+	if e != nil {
+		t.Fatalf("Failed to read fixture: %v", e)
+	}
+	var summary Summary
+	if e := json.Unmarshal(legacy, &summary); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	expected := map[string]string{
+		"Name":       "Rotation 4",
+		"source key": "newspaper",
+		strings.Repeat("k", maxMetadataKeyLength): "long key",
+		"notes": strings.Repeat("v", maxMetadataValueLength),
+	}
+	if !reflect.DeepEqual(summary.Metadata, expected) {
+		t.Errorf("Upgraded metadata is %v, expected %v", summary.Metadata, expected)
+	}
+	p, e := New(&summary)
+	if e != nil {
+		t.Fatalf("New on upgraded summary failed: %v", e)
+	}
+	if p.Metadata["Name"] != "Rotation 4" || p.allValues()[1] != 2 {
+		t.Errorf("Upgraded puzzle has metadata %v, values %v", p.Metadata, p.allValues())
+	}
+
+	// cutting keys short can make them the same
+	md := map[string]string{"": "x", strings.Repeat("k", maxMetadataKeyLength) + "a": "a", strings.Repeat("k", maxMetadataKeyLength) + "b": "b"}
+	if upgraded := upgradeMetadata1(md); len(upgraded) != 1 || upgraded[strings.Repeat("k", maxMetadataKeyLength)] != "a" {
+		t.Errorf("Upgraded metadata is %v", upgraded)
+	}
+	if s := truncateUTF8("ab日", 4); s != "ab" {
+		t.Errorf("Truncation split a character: %q", s)
+	}
+}
+
+func TestParseErrorCode(t *testing.T) {
+	for sc := RequestScope; sc < MaxScope; sc++ {
+		for co := GeneralCondition; co < MaxCondition; co++ {
+			for _, at := range []ErrorAttribute{UnknownAttribute, IndexAttribute, TechniqueAttribute} {
+				err := Error{Scope: sc, Structure: ScopeStructure, Condition: co}
+				if at != UnknownAttribute {
+					err.Structure, err.Attribute = AttributeStructure, at
+				}
+				var psc ErrorScope
+				var pat ErrorAttribute
+				var pco ErrorCondition
+				if !parseErrorCode(err.Code(), &psc, &pat, &pco) || psc != sc || pat != at || pco != co {
+					t.Errorf("Parse of %q gave %v, %v, %v", err.Code(), psc, pat, pco)
+				}
+			}
+		}
+	}
+	for _, bad := range []string{"", "square", "square.x.y.z", "nowhere.general", "square.nowhere.general"} {
+		var sc ErrorScope
+		var at ErrorAttribute
+		var co ErrorCondition
+		if parseErrorCode(bad, &sc, &at, &co) {
+			t.Errorf("Parse of %q succeeded", bad)
+		}
+	}
+}
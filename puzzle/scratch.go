@@ -0,0 +1,151 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"sync"
+)
+
+/*
+
+Scratch puzzles
+
+The solver and the difficulty estimator work on copies of the
+puzzles they're given, and services that rate or generate
+puzzles call them over and over.  Rather than make each copy
+from scratch, they take scratch copies, which reuse the squares,
+groups, and set storage of scratch copies that have been
+released.  Scratch copies have the puzzle's content and tracer,
+but no metadata, info, marks, or observers.
+
+*/
+
+// A scratch is a scratch puzzle and the storage for its sets.
+type scratch struct {
+	p    *Puzzle
+	ints []int
+}
+
+// scratchPools holds a pool of released scratches for each
+// mapping, since only puzzles with the same mapping can share
+// storage.
+var scratchPools sync.Map // *puzzleMapping -> *sync.Pool
+
+// scratchPool returns the pool for a mapping.  Mappings that
+// aren't shared (see composeMapping) get a pool of their own,
+// which isn't kept, so the pools don't pile up.
+func scratchPool(m *puzzleMapping) *sync.Pool {
+	if m.stack != nil && !m.stack.shared {
+		return &sync.Pool{}
+	}
+	if pool, ok := scratchPools.Load(m); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := scratchPools.LoadOrStore(m, &sync.Pool{})
+	return pool.(*sync.Pool)
+}
+
+// scratchCopy returns a scratch copy of the puzzle and a
+// function that releases it.  Once the copy is released, nothing
+// taken from it (not even its errors) may be used, because its
+// storage will be reused.
+func (p *Puzzle) scratchCopy() (*Puzzle, func()) {
+	pool := scratchPool(p.mapping)
+	sc, _ := pool.Get().(*scratch)
+	if sc == nil {
+		sc = &scratch{p: &Puzzle{logger: &indexLogger{}}}
+	}
+	sc.ints = p.copyInto(sc.p, sc.ints[:0])
+	return sc.p, func() {
+		sc.p.journal, sc.p.errors, sc.p.ctx = nil, nil, nil
+		pool.Put(sc)
+	}
+}
+
+// copyInto copies the puzzle's content into a scratch puzzle,
+// reusing the scratch puzzle's squares and groups and carving
+// the sets from the given storage, which it returns.  Like
+// journal images, the sets have capped capacity so they can't
+// grow into each other.
+func (p *Puzzle) copyInto(c *Puzzle, ints []int) []int {
+	total := 0
+	for i := 1; i <= p.mapping.gcount; i++ {
+		total += len(p.groups[i].free)
+	}
+	if cap(ints) < total {
+		ints = make([]int, 0, total)
+	}
+	keep := func(is intset) intset {
+		if is == nil {
+			return nil
+		} else if len(is) == 0 {
+			return intset{} // storage may be nil
+		}
+		start := len(ints)
+		ints = append(ints, is...)
+		return ints[start:len(ints):len(ints)]
+	}
+
+	logger, squares, groups := c.logger, c.squares, c.groups
+	*logger = indexLogger{entries: logger.entries[:0], tracer: p.logger.tracer}
+	*c = Puzzle{
+		mapping: p.mapping,
+		logger:  logger,
+		errors:  p.allErrors(false),
+		givens:  p.givens,
+		assist:  p.assist,
+		actor:   p.actor,
+		changes: p.changes,
+		valid:   p.valid,
+	}
+	if len(squares) != p.mapping.scount+1 {
+		squares = make([]*square, p.mapping.scount+1) // 1-based indexing
+		for i := 1; i <= p.mapping.scount; i++ {
+			squares[i] = &square{}
+		}
+	}
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		*squares[i] = square{
+			index:  s.index,
+			aval:   s.aval,
+			pvals:  s.pvals,
+			bval:   s.bval,
+			bsrc:   append([]GroupID(nil), s.bsrc...),
+			logger: logger,
+		}
+	}
+	if len(groups) != p.mapping.gcount+1 {
+		groups = make([]*group, p.mapping.gcount+1) // 1-based indexing
+		for i := 1; i <= p.mapping.gcount; i++ {
+			groups[i] = &group{}
+		}
+	}
+	for i := 1; i <= p.mapping.gcount; i++ {
+		g := p.groups[i]
+		*groups[i] = group{
+			desc:  g.desc,
+			where: append(groups[i].where[:0], g.where...),
+			need:  g.need,
+			free:  keep(g.free),
+		}
+	}
+	c.squares, c.groups = squares, groups
+	return ints
+}
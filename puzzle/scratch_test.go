@@ -0,0 +1,184 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+// a 16x16 puzzle with a unique solution
+var sixteenValues = []int{
+	0, 9, 11, 8, 0, 16, 0, 0, 0, 0, 14, 0, 0, 5, 0, 13,
+	14, 1, 15, 3, 13, 6, 0, 5, 0, 0, 4, 0, 0, 10, 12, 0,
+	12, 10, 0, 16, 0, 3, 14, 0, 0, 5, 7, 6, 0, 9, 4, 0,
+	7, 0, 13, 0, 0, 8, 0, 9, 0, 0, 0, 16, 0, 0, 0, 15,
+	0, 0, 0, 10, 0, 1, 0, 16, 14, 3, 0, 0, 9, 0, 0, 7,
+	13, 3, 0, 0, 0, 0, 0, 6, 4, 8, 2, 10, 0, 0, 15, 0,
+	0, 16, 12, 0, 14, 5, 13, 0, 0, 0, 11, 9, 0, 0, 2, 0,
+	11, 0, 7, 0, 4, 0, 2, 0, 0, 16, 0, 1, 5, 3, 13, 14,
+	0, 0, 0, 4, 0, 0, 1, 0, 3, 15, 0, 0, 7, 0, 9, 6,
+	9, 13, 6, 7, 8, 0, 10, 0, 16, 0, 0, 12, 14, 0, 0, 0,
+	0, 0, 3, 0, 0, 7, 9, 13, 0, 0, 10, 4, 12, 0, 1, 16,
+	1, 2, 16, 12, 0, 0, 5, 15, 0, 0, 9, 7, 4, 0, 0, 0,
+	0, 14, 0, 13, 9, 0, 0, 7, 10, 4, 16, 0, 15, 0, 0, 0,
+	8, 7, 0, 0, 0, 0, 0, 4, 1, 12, 0, 0, 13, 0, 0, 5,
+	16, 0, 0, 0, 0, 0, 3, 0, 0, 14, 0, 13, 0, 7, 8, 0,
+	3, 12, 1, 0, 0, 0, 6, 14, 0, 7, 8, 11, 0, 0, 16, 0,
+}
+
+// scratchMatches checks that a scratch copy has the same content
+// as its source.
+func scratchMatches(t *testing.T, name string, p, c *Puzzle) {
+	if c.mapping != p.mapping {
+		t.Fatalf("%s: scratch copy has a different mapping", name)
+	}
+	for i := 1; i <= p.mapping.scount; i++ {
+		ps, cs := *p.squares[i], *c.squares[i]
+		ps.logger, cs.logger = nil, nil
+		if !reflect.DeepEqual(ps, cs) {
+			t.Errorf("%s: square %d is %+v, expected %+v", name, i, cs, ps)
+		}
+	}
+	for i := 1; i <= p.mapping.gcount; i++ {
+		if !reflect.DeepEqual(*p.groups[i], *c.groups[i]) {
+			t.Errorf("%s: group %d is %+v, expected %+v", name, i, *c.groups[i], *p.groups[i])
+		}
+	}
+	if !reflect.DeepEqual(p.errors, c.errors) {
+		t.Errorf("%s: scratch errors are %v, expected %v", name, c.errors, p.errors)
+	}
+	if errs := c.Validate(); errs != nil {
+		t.Errorf("%s: scratch copy fails validation: %v", name, errs)
+	}
+}
+
+func TestScratchCopy(t *testing.T) {
+	cases := []struct {
+		name string
+		vals []int
+		ai   int
+		av   int
+	}{
+		{"partial", rotation4Puzzle1PartialValues, 2, 2},
+		{"complete", rotation4Puzzle1Complete1, 0, 0},
+		{"conflicting", conflicting4Puzzle1, 0, 0},
+	}
+	for _, tc := range cases {
+		p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: tc.vals})
+		if e != nil {
+			t.Fatalf("%s: failed to make puzzle: %v", tc.name, e)
+		}
+		c, release := p.scratchCopy()
+		scratchMatches(t, tc.name, p, c)
+		if tc.ai != 0 {
+			if _, e := c.Assign(Choice{tc.ai, tc.av}); e != nil {
+				t.Fatalf("%s: scratch Assign failed: %v", tc.name, e)
+			}
+			if p.squares[tc.ai].aval != 0 {
+				t.Errorf("%s: scratch Assign altered original", tc.name)
+			}
+		}
+		release()
+		// whether or not the storage is reused, a new copy
+		// must not have any trace of the old one
+		c, release = p.scratchCopy()
+		scratchMatches(t, tc.name+" (again)", p, c)
+		release()
+	}
+}
+
+func TestScratchCopyReuse(t *testing.T) {
+	// storage is reused across puzzles with the same mapping
+	p1, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	p2, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1Complete2})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	for i := 0; i < 10; i++ {
+		c1, release1 := p1.scratchCopy()
+		c2, release2 := p2.scratchCopy()
+		scratchMatches(t, "p1", p1, c1)
+		scratchMatches(t, "p2", p2, c2)
+		release2()
+		release1()
+	}
+}
+
+func TestSolutionsSixteen(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	before, _ := p.State()
+	sols := p.allSolutions()
+	if len(sols) != 1 {
+		t.Fatalf("Got %d solutions, expected 1", len(sols))
+	}
+	q, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sols[0].Values})
+	if e != nil {
+		t.Fatalf("Failed to make solved puzzle: %v", e)
+	}
+	if errs := q.allErrors(false); len(errs) != 0 {
+		t.Errorf("Solution has errors: %v", errs)
+	}
+	if after, _ := p.State(); !reflect.DeepEqual(before, after) {
+		t.Errorf("Solving altered the puzzle")
+	}
+}
+
+func BenchmarkCopy(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.copy()
+	}
+}
+
+func BenchmarkScratchCopy(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, release := p.scratchCopy()
+		release()
+	}
+}
+
+func BenchmarkSolutionsSixteen(b *testing.B) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 16, Values: sixteenValues})
+	if e != nil {
+		b.Fatalf("Failed to make puzzle: %v", e)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.allSolutions()
+	}
+}
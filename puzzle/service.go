@@ -20,8 +20,11 @@ package puzzle
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 /*
@@ -39,7 +42,9 @@ Puzzle Creation
 // caller.
 //
 // If we can't decode the posted Summary, we send a 400 reponse and
-// return the error to the caller.
+// return the error to the caller.  The same goes for a Summary
+// whose metadata uses keys reserved for the package (see
+// ReservedMetadataPrefix).
 //
 // If we can't encode the response to the client (which should
 // never happen), then the client gets an error response and the
@@ -50,7 +55,10 @@ func NewHandler(w http.ResponseWriter, r *http.Request) (*Puzzle, error) {
 	var summary Summary
 	e := dec.Decode(&summary)
 	if e != nil {
-		return nil, writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+		return nil, SendError(DecodeError(e), w, r)
+	}
+	if e := validateMetadata(summary.Metadata, false); e != nil {
+		return nil, SendError(e.(Error), w, r)
 	}
 	p, e := New(&summary)
 	if e != nil {
@@ -58,8 +66,7 @@ func NewHandler(w http.ResponseWriter, r *http.Request) (*Puzzle, error) {
 		if !ok {
 			return nil, writeError(errorFormatError, ErrorData{"NewHandler", e.Error()}, w, r)
 		}
-		err.Message = err.Error()
-		return nil, writeJSON(err, http.StatusBadRequest, w, r)
+		return nil, SendError(err, w, r)
 	}
 	return p, p.StateHandler(w, r)
 }
@@ -70,35 +77,113 @@ Puzzle Download Methods
 
 */
 
+// VersionHeader is the response header that gives the version of
+// the puzzle whose state is sent.
+const VersionHeader = "Puzzle-Version"
+
 // SummaryHandler responds with the Puzzle's summary.  If we can't
 // encode the response to the client successfully, we give both
 // the client and the golang caller an Error response.
+//
+// The response carries the puzzle's ETag, and if the request's
+// If-None-Match header matches it, the response is a 304 with no
+// body.  The encoded summary is cached until the puzzle changes,
+// and is sent gzipped (also from a cache) to clients that accept
+// that.
 func (p *Puzzle) SummaryHandler(w http.ResponseWriter, r *http.Request) error {
 	if !p.isValid() {
 		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
 	}
-	return writeJSON(p.summary(), http.StatusOK, w, r)
+	if e := validateMetadata(p.Metadata, true); e != nil {
+		return SendError(e.(Error), w, r)
+	}
+	gzipped := acceptsGzip(r)
+	if p.notModified(w, r, gzipped) {
+		return nil
+	}
+	if gzipped {
+		bytes, e := p.summaryGzip()
+		if e != nil {
+			return writeError(responseEncodingError, ErrorData{e.Error()}, w, r)
+		}
+		return writeGzippedJSON(bytes, w)
+	}
+	bytes, e := p.summaryJSON()
+	if e != nil {
+		return writeError(responseEncodingError, ErrorData{e.Error()}, w, r)
+	}
+	return writeJSON(json.RawMessage(bytes), http.StatusOK, w, r)
 }
 
 // StateHandler responds with the Puzzle's content.  If we can't
 // encode the response to the client successfully, we give both
 // the client and the golang caller an Error response.
+//
+// Like SummaryHandler, this honors If-None-Match against the
+// puzzle's ETag and caches the encoded (and gzipped) state.
+//
+// The response's Puzzle-Version header gives the puzzle's
+// version.  If the request has a since query parameter, the
+// response has only the squares changed since that version (see
+// StateSince).
 func (p *Puzzle) StateHandler(w http.ResponseWriter, r *http.Request) error {
 	if !p.isValid() {
 		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
 	}
-	return writeJSON(p.state(), http.StatusOK, w, r)
+	w.Header().Set(VersionHeader, strconv.Itoa(p.changes))
+	since := r.URL.Query().Get("since")
+	gzipped := since == "" && acceptsGzip(r)
+	if p.notModified(w, r, gzipped) {
+		return nil
+	}
+	if gzipped {
+		bytes, e := p.stateGzip()
+		if e != nil {
+			return writeError(responseEncodingError, ErrorData{e.Error()}, w, r)
+		}
+		return writeGzippedJSON(bytes, w)
+	}
+	if since == "" {
+		bytes, e := p.stateJSON()
+		if e != nil {
+			return writeError(responseEncodingError, ErrorData{e.Error()}, w, r)
+		}
+		return writeJSON(json.RawMessage(bytes), http.StatusOK, w, r)
+	}
+	version, e := strconv.Atoi(since)
+	if e != nil {
+		return SendError(DecodeError(e), w, r)
+	}
+	delta, _, e := p.StateSince(version)
+	if e != nil {
+		return SendError(e.(Error), w, r)
+	}
+	return writeJSON(delta, http.StatusOK, w, r)
 }
 
 // SolutionsHandler responds with the Puzzle's solutions (or the
-// Error produced by computing the puzzle's solutions).  If we
-// can't encode the response to the client successfully, we give
-// both the client and the golang caller an Error response.
+// Error produced by computing the puzzle's solutions).  A "max"
+// query parameter limits how many solutions are found, and the
+// search stops if the request is canceled.  If we can't encode
+// the response to the client successfully, we give both the
+// client and the golang caller an Error response.
 func (p *Puzzle) SolutionsHandler(w http.ResponseWriter, r *http.Request) error {
 	if !p.isValid() {
 		return writeError(noPuzzleError, ErrorData{r.URL.Path, "No puzzle"}, w, r)
 	}
-	return writeJSON(p.allSolutions(), http.StatusOK, w, r)
+	max := 0
+	if arg := r.URL.Query().Get("max"); arg != "" {
+		n, e := strconv.Atoi(arg)
+		if e != nil {
+			return SendError(DecodeError(e), w, r)
+		}
+		max = n
+	}
+	solutions, e := p.SolveContext(r.Context(), max)
+	if e != nil {
+		return SendError(e.(Error), w, r)
+	}
+	return writeJSON(solutions, http.StatusOK, w, r)
 }
 
 /*
@@ -125,7 +210,7 @@ func (p *Puzzle) AssignHandler(w http.ResponseWriter, r *http.Request) (*Choice,
 	var choice Choice
 	e := dec.Decode(&choice)
 	if e != nil {
-		return nil, nil, writeError(requestDecodingError, ErrorData{e.Error()}, w, r)
+		return nil, nil, SendError(DecodeError(e), w, r)
 	}
 	update, e := p.Assign(choice)
 	if e != nil {
@@ -134,8 +219,7 @@ func (p *Puzzle) AssignHandler(w http.ResponseWriter, r *http.Request) (*Choice,
 			e = writeError(errorFormatError, ErrorData{"AssignHandler", e.Error()}, w, r)
 			return &choice, nil, err
 		}
-		err.Message = err.Error()
-		return &choice, nil, writeJSON(err, http.StatusBadRequest, w, r)
+		return &choice, nil, SendError(err, w, r)
 	}
 	return &choice, update, writeJSON(update, http.StatusOK, w, r)
 }
@@ -146,6 +230,45 @@ Utilities
 
 */
 
+// notModified sets the puzzle's ETag on the response, and checks
+// whether the request's If-None-Match header matches it.  If so,
+// it sends a 304 response and returns true.  The caller must not
+// send any further response in that case.  A gzipped response is
+// a different representation, so it gets a different tag.
+func (p *Puzzle) notModified(w http.ResponseWriter, r *http.Request, gzipped bool) bool {
+	etag := p.etag()
+	if gzipped {
+		etag = etag[:len(etag)-1] + `-gzip"`
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept-Encoding")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip returns whether a request's Accept-Encoding header
+// allows a gzipped response.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if v, e := strconv.ParseFloat(q, 64); e == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 type handlerError int
 
 const (
@@ -161,10 +284,8 @@ const (
 func writeError(et handlerError, ed ErrorData,
 	w http.ResponseWriter, r *http.Request) error {
 	var err Error
-	var status int
 	switch et {
 	case requestDecodingError:
-		status = http.StatusBadRequest
 		err = Error{
 			Scope:     RequestScope,
 			Structure: AttributeStructure,
@@ -173,7 +294,6 @@ func writeError(et handlerError, ed ErrorData,
 			Values:    ed,
 		}
 	case responseEncodingError:
-		status = http.StatusInternalServerError
 		err = Error{
 			Scope:     InternalScope,
 			Structure: AttributeStructure,
@@ -182,7 +302,6 @@ func writeError(et handlerError, ed ErrorData,
 			Values:    ed,
 		}
 	case noPuzzleError:
-		status = http.StatusNotFound
 		err = Error{
 			Scope:     RequestScope,
 			Structure: AttributeValueStructure,
@@ -191,7 +310,6 @@ func writeError(et handlerError, ed ErrorData,
 			Values:    ed,
 		}
 	case errorFormatError:
-		status = http.StatusInternalServerError
 		err = Error{
 			Scope:     InternalScope,
 			Structure: AttributeStructure,
@@ -200,7 +318,6 @@ func writeError(et handlerError, ed ErrorData,
 			Values:    ed,
 		}
 	default:
-		status = http.StatusInternalServerError
 		err = Error{
 			Scope:     InternalScope,
 			Structure: AttributeStructure,
@@ -212,8 +329,64 @@ func writeError(et handlerError, ed ErrorData,
 			},
 		}
 	}
-	err.Message = err.Error()
-	return writeJSON(err, status, w, r)
+	return SendError(err, w, r)
+}
+
+// SendError sends an Error to a web client as JSON, with the
+// HTTP status that goes with it, and returns the Error.  Web
+// services built on this package should use it for all their
+// error responses, so clients see a single error format.
+//
+// The Error's message is in the language the client prefers, as
+// given by its Accept-Language header (see RegisterTranslator).
+func SendError(err Error, w http.ResponseWriter, r *http.Request) error {
+	lang := requestLanguage(r)
+	err.Message = err.Localize(lang)
+	w.Header().Set("Content-Language", lang)
+	return writeJSON(err, err.HTTPStatus(), w, r)
+}
+
+// RequestError returns an Error describing a request for the
+// resource at the given path that failed the given condition.
+// Conditions that take a value (such as the method that wasn't
+// allowed) expect it as the value.
+func RequestError(cond ErrorCondition, path string, value ...interface{}) Error {
+	return Error{
+		Scope:     RequestScope,
+		Structure: AttributeValueStructure,
+		Attribute: URLAttribute,
+		Condition: cond,
+		Values:    append(ErrorData{path}, value...),
+	}
+}
+
+// DecodeError returns an Error describing a request body that
+// couldn't be decoded.  A body cut off by http.MaxBytesReader
+// gets a quota-exceeded Error instead.
+func DecodeError(e error) Error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(e, &tooLarge) {
+		return QuotaError(RequestBodyLimit, int(tooLarge.Limit))
+	}
+	return Error{
+		Scope:     RequestScope,
+		Structure: AttributeStructure,
+		Attribute: DecodeAttribute,
+		Condition: GeneralCondition,
+		Values:    ErrorData{e.Error()},
+	}
+}
+
+// InternalError returns an Error describing an unexpected
+// failure at the named location.
+func InternalError(location string, e interface{}) Error {
+	return Error{
+		Scope:     InternalScope,
+		Structure: AttributeStructure,
+		Attribute: LocationAttribute,
+		Condition: GeneralCondition,
+		Values:    ErrorData{location, fmt.Sprint(e)},
+	}
 }
 
 // writeJSON is called by handlers to encode and send the client
@@ -234,7 +407,22 @@ func writeError(et handlerError, ed ErrorData,
 // return nil to the handler.
 func writeJSON(obj interface{}, status int, w http.ResponseWriter, r *http.Request) error {
 	err, isErr := obj.(Error)
-	bytes, e := json.Marshal(obj)
+	var bytes []byte
+	var e error
+	if raw, ok := obj.(json.RawMessage); ok {
+		bytes = raw // already encoded
+	} else if a, ok := obj.(jsonAppender); ok {
+		bp := jsonBuffers.Get().(*[]byte)
+		defer func() {
+			if cap(bytes) <= maxPooledJSONBuffer {
+				*bp = bytes[:0]
+				jsonBuffers.Put(bp)
+			}
+		}()
+		bytes, e = a.AppendJSON((*bp)[:0])
+	} else {
+		bytes, e = json.Marshal(obj)
+	}
 	if e != nil {
 		if isErr && err.Scope == InternalScope && err.Attribute == EncodeAttribute {
 			// We just failed to encode an Encoding error.  This
@@ -258,3 +446,14 @@ func writeJSON(obj interface{}, status int, w http.ResponseWriter, r *http.Reque
 	}
 	return nil
 }
+
+// writeGzippedJSON sends an already gzipped JSON encoding with
+// an OK status.
+func writeGzippedJSON(bytes []byte, w http.ResponseWriter) error {
+	hs := w.Header()
+	hs.Add("Content-Type", "application/json")
+	hs.Set("Content-Encoding", "gzip")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+	return nil
+}
@@ -46,7 +46,7 @@ var badError = Error{Message: "unencodable error", Values: ErrorData{unencodable
 type badEncoderPuzzle Puzzle
 
 func (b *badEncoderPuzzle) Summary() (*Summary, error) {
-	return &Summary{nil, StandardGeometryName, 0, []int{}, nil}, nil
+	return &Summary{Geometry: StandardGeometryName, SideLength: 0, Values: []int{}}, nil
 }
 
 func (b *badEncoderPuzzle) State() (*Content, error) {
@@ -86,11 +86,11 @@ GET handlers
 
 func TestPuzzleGetHandlers(t *testing.T) {
 	tests := []*Summary{
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil},
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil},
-		&Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil},
-		&Summary{nil, StandardGeometryName, 9, oneStarValues, nil},
-		&Summary{nil, StandardGeometryName, 9, sixStarValues, nil},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialAssign1Values},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1Complete1},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues},
+		&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: oneStarValues},
+		&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: sixStarValues},
 	}
 	for i, test := range tests {
 		p, e := New(test)
@@ -173,6 +173,141 @@ func TestGetHandlerErrors(t *testing.T) {
 	}
 }
 
+func TestGetHandlerETags(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of puzzle failed: %v", e)
+	}
+	handlers := []func(http.ResponseWriter, *http.Request) error{
+		p.SummaryHandler,
+		p.StateHandler,
+	}
+	for i, handler := range handlers {
+		get := func(etag string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", "/", nil)
+			if etag != "" {
+				r.Header.Set("If-None-Match", etag)
+			}
+			w := httptest.NewRecorder()
+			if err := handler(w, r); err != nil {
+				t.Fatalf("handler %d: failed: %v", i, err)
+			}
+			return w
+		}
+		w := get("")
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || etag == "" {
+			t.Fatalf("handler %d: status %d, ETag %q", i, w.Code, etag)
+		}
+		if w = get(`"other", ` + etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("handler %d: conditional get gave status %d, body %q", i, w.Code, w.Body)
+		}
+		if w = get(`"other"`); w.Code != http.StatusOK {
+			t.Errorf("handler %d: mismatched get gave status %d", i, w.Code)
+		}
+
+		// changing the metadata or info changes the tag
+		if e := p.SetMetadata("name", fmt.Sprintf("rotation %d", i)); e != nil {
+			t.Fatalf("SetMetadata failed: %v", e)
+		}
+		if w = get(etag); w.Code != http.StatusOK {
+			t.Errorf("handler %d: get after metadata change gave status %d", i, w.Code)
+		}
+		etag = w.Header().Get("ETag")
+		if e := p.SetInfo(Info{Name: fmt.Sprintf("rotation %d", i)}); e != nil {
+			t.Fatalf("SetInfo failed: %v", e)
+		}
+		if w = get(etag); w.Code != http.StatusOK {
+			t.Errorf("handler %d: get after info change gave status %d", i, w.Code)
+		}
+	}
+
+	before, _ := p.ETag()
+	if _, e := p.Assign(Choice{Index: 2, Value: 2}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if after, _ := p.ETag(); after == before {
+		t.Errorf("ETag %s didn't change after assignment", after)
+	}
+	if _, e := (*Puzzle)(nil).ETag(); e == nil {
+		t.Errorf("No error getting ETag of nil puzzle")
+	}
+}
+
+func TestETagReload(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of puzzle failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{Index: 2, Value: 2}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if _, e := p.AddMark(5, 2); e != nil {
+		t.Fatalf("AddMark failed: %v", e)
+	}
+	before, _ := p.ETag()
+
+	// a puzzle reloaded from its summary and journal has the
+	// same content, so it keeps its tag, even though its count
+	// of changes starts over
+	summary, _ := p.Summary()
+	summary.Journal, _ = p.Journal()
+	q, e := New(summary)
+	if e != nil {
+		t.Fatalf("Reload of puzzle failed: %v", e)
+	}
+	if reloaded, _ := q.ETag(); reloaded != before {
+		t.Errorf("Reloaded puzzle has ETag %s, expected %s", reloaded, before)
+	}
+
+	// but any change to the reloaded puzzle changes the tag
+	changes := []struct {
+		name string
+		op   func() error
+	}{
+		{"AddMark", func() error { _, e := q.AddMark(4, 2); return e }},
+		{"Annotate", func() error { _, e := q.Annotate(Annotation{Square: 7, Author: "tester", Text: "check"}); return e }},
+		{"Metadata", func() error { q.Metadata = map[string]string{"name": "reloaded"}; return nil }},
+		{"Info", func() error { q.Info.Name = "reloaded"; return nil }},
+		{"Undo", func() error { _, e := q.Undo(); return e }},
+	}
+	seen := map[string]string{before: "reload"}
+	for _, tc := range changes {
+		if e := tc.op(); e != nil {
+			t.Fatalf("%s failed: %v", tc.name, e)
+		}
+		etag, _ := q.ETag()
+		if prior, ok := seen[etag]; ok {
+			t.Errorf("ETag after %s is the same as after %s", tc.name, prior)
+		}
+		seen[etag] = tc.name
+	}
+}
+
+func TestSolutionsHandlerMax(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of puzzle failed: %v", e)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.SolutionsHandler(w, httptest.NewRequest("GET", "/"+query, nil))
+		return w
+	}
+	for query, expected := range map[string]int{"": 2, "?max=1": 1, "?max=5": 2} {
+		var solns []Solution
+		w := get(query)
+		if e := json.Unmarshal(w.Body.Bytes(), &solns); w.Code != http.StatusOK || e != nil || len(solns) != expected {
+			t.Errorf("%q: status %d, %d solutions (%v), expected %d", query, w.Code, len(solns), e, expected)
+		}
+	}
+	for _, bad := range []string{"?max=x", "?max=-1"} {
+		if w := get(bad); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, expected %d", bad, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
 /*
 
 POST handlers
@@ -181,9 +316,9 @@ POST handlers
 
 func TestNewHandler(t *testing.T) {
 	testcases := []*Summary{
-		&Summary{nil, StandardGeometryName, 4, empty4PuzzleValues, nil},
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1PartialAssign1Values, nil},
-		&Summary{nil, StandardGeometryName, 4, rotation4Puzzle1Complete1, nil},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: empty4PuzzleValues},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialAssign1Values},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1Complete1},
 	}
 	for i, tc := range testcases {
 		pe, err := New(tc)
@@ -250,6 +385,7 @@ func TestNewHandlerErrors(t *testing.T) {
 		{"bad input", `"string not summary"`, DecodeAttribute},
 		{"unknown geometry", `{"geometry":"nope","sidelen":4}`, GeometryAttribute},
 		{"values incompatible", `{"geometry":"square","sidelen":4,"values":[1, 2, 3]}`, PuzzleSizeAttribute},
+		{"reserved metadata", `{"metadata":{"susen.id":"x"},"geometry":"square","sidelen":4,"values":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0]}`, MetadataAttribute},
 	}
 
 	for _, tc := range testcases {
@@ -287,6 +423,7 @@ func TestNewHandlerErrors(t *testing.T) {
 }
 
 func TestAssignHandler(t *testing.T) {
+	defer freezeClock()()
 	choices := []Choice{{13, 2}, {10, 4}, {15, 4}}
 	p1, err := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
 	if err != nil {
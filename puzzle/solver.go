@@ -19,6 +19,7 @@
 package puzzle
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -49,8 +50,8 @@ minotaur's maze.
 possible values.  (Any order for choosing the square works, this
 algorithm uses reading order.)
 
-3.2 Save the puzzle state, the chosen square, and the possible
-values on the top of the stack.
+3.2 Save the puzzle state (as a checkpoint), the chosen square,
+and the possible values on the top of the stack.
 
 3.3 Assign the first of the possible values to the chosen square.
 
@@ -63,7 +64,7 @@ for its chosen square.
 
 4.2 If the stack is empty, stop.  The puzzle can't be solved.
 
-4.3 Restore the puzzle state from the state on the stack.
+4.3 Roll the puzzle back to the checkpoint on the stack.
 
 4.4 Fill in the chosen square with the first remaining possible value.
 
@@ -81,13 +82,16 @@ step 4.
 
 */
 
-// A choice records a point where Ariadne makes a choice
+// A choice records a point where Ariadne makes a choice.  The
+// puzzle state before the choice is saved as a checkpoint in the
+// puzzle's journal, so the choice can be rolled back.  All the
+// moves made after a choice go into a single journal entry.
 type choice struct {
-	puz    *Puzzle
+	mark   CheckpointToken
 	cindex int    // where the choice was made
 	ccount int    // how many branchings there are
 	cvalue int    // which branch was taken
-	cnext  intset // the branches left to try
+	cnext  bitset // the branches left to try
 }
 
 // A thread is a stack of choices
@@ -96,9 +100,14 @@ type thread []choice
 // solve a puzzle using Ariadne's thread.  Entered with a puzzle
 // and a stack of prior choices (which can be empty), this finds
 // the next possible solution and returns the puzzle and stack at
-// time of solution (or unsolvable error).
+// time of solution (or unsolvable error).  If the puzzle's
+// context is done, this stops wherever it is, and the caller
+// must not use the result.
 func solve(p *Puzzle, t thread) (*Puzzle, thread) {
 	for {
+		if p.canceled() {
+			return p, t
+		}
 		if len(p.errors) == 0 && assignKnown(p) {
 			return p, t
 		}
@@ -116,22 +125,52 @@ func solve(p *Puzzle, t thread) (*Puzzle, thread) {
 // allSolutions finds all solutions to a given puzzle.  The
 // puzzle is not altered.
 func (p *Puzzle) allSolutions() []Solution {
+	solutions, _ := p.solutions(context.Background(), 0)
+	return solutions
+}
+
+// solutions finds the solutions to a given puzzle, stopping once
+// it has found max of them (if max isn't 0).  The context is
+// checked before each choice, and if it's done the search stops
+// with an Error.  The puzzle is not altered.
+func (p *Puzzle) solutions(ctx context.Context, max int) ([]Solution, error) {
+	if ctx.Err() != nil {
+		return nil, canceledError(ctx)
+	}
+
 	// first see if there are no choices needed
-	if vals, rating := rateNoChoices(p.copy()); vals != nil {
-		return []Solution{{Values: vals, Rating: rating}}
+	q, release := p.scratchCopy()
+	vals, rating := rateNoChoices(q)
+	release()
+	if vals != nil {
+		return []Solution{{Values: vals, Rating: rating}}, nil
 	}
 
 	// choices needed: do Ariadne's thread
 	var solutions []Solution
 	var t thread
-	for p, t = solve(p.copy(), t); len(p.errors) == 0; p, t = solve(p, t) {
-		solutions = append(solutions, newSolution(p, t))
-		p, t = popChoice(p, t)
+	q, release = p.scratchCopy()
+	defer release()
+	q.ctx = ctx
+	q.begin()
+	for q, t = solve(q, t); ; q, t = solve(q, t) {
+		if ctx.Err() != nil {
+			return nil, canceledError(ctx)
+		}
+		if len(q.errors) > 0 {
+			break
+		}
+		solutions = append(solutions, newSolution(q, t))
+		q.logger.trace("solver solution", "choices", len(t))
+		if max > 0 && len(solutions) >= max {
+			break
+		}
+		q, t = popChoice(q, t)
 		if len(t) == 0 {
 			break
 		}
 	}
-	return solutions
+	return solutions, nil
 }
 
 // Solutions finds all solutions to a given puzzle.  The
@@ -144,6 +183,32 @@ func (p *Puzzle) Solutions() ([]Solution, error) {
 	return p.allSolutions(), nil
 }
 
+// Solve finds a solution to a given puzzle, stopping the search
+// as soon as it has one.  If the puzzle can't be solved, the
+// returned solution is nil.  The puzzle is not altered.
+func (p *Puzzle) Solve() (*Solution, error) {
+	solutions, e := p.SolveContext(context.Background(), 1)
+	if e != nil || len(solutions) == 0 {
+		return nil, e
+	}
+	return &solutions[0], nil
+}
+
+// SolveContext finds up to max solutions to a given puzzle (all
+// of them, if max is 0), in the order Solutions would return
+// them.  If the context is done before the search is, the
+// search stops and an Error with CanceledCondition is returned.
+// The puzzle is not altered.
+func (p *Puzzle) SolveContext(ctx context.Context, max int) ([]Solution, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition)
+	}
+	if max < 0 {
+		return nil, argumentError(NamedAttribute, InvalidArgumentCondition, "max", max)
+	}
+	return p.solutions(ctx, max)
+}
+
 // assignKnown takes a solvable puzzle and tries to solve it by
 // assigning all the single-possible-value empty squares
 // to their known value and then looping to see if those
@@ -159,10 +224,10 @@ func assignKnown(p *Puzzle) bool {
 			if p.squares[i].aval == 0 {
 				if p.squares[i].bval != 0 {
 					known++
-					p.assign(i, p.squares[i].bval)
-				} else if len(p.squares[i].pvals) == 1 {
+					p.do(Move{Action: AssignAction, Index: i, Value: p.squares[i].bval})
+				} else if p.squares[i].pvals.len() == 1 {
 					known++
-					p.assign(i, p.squares[i].pvals[0])
+					p.do(Move{Action: AssignAction, Index: i, Value: p.squares[i].pvals.min()})
 				} else {
 					unknown++
 				}
@@ -183,30 +248,42 @@ func assignKnown(p *Puzzle) bool {
 // popChoice resets a puzzle to the next choice after the current
 // choice in a thread has failed.  If there is no next choice,
 // the incoming puzzle is returned, along with the empty thread.
+//
+// Choices without a next choice are popped without rolling the
+// puzzle back, because rolling back to an earlier choice also
+// undoes everything done after it.
 func popChoice(p *Puzzle, t thread) (*Puzzle, thread) {
 	for len(t) > 0 {
 		top := &t[len(t)-1]
-		if len(top.cnext) == 0 {
+		if top.cnext == 0 {
 			*top = choice{} // release storage held in choice before pop
 			t = t[:len(t)-1]
 			continue
 		}
-		new := top.puz.copy()
-		top.cvalue, top.cnext = top.cnext[0], top.cnext[1:]
-		new.assign(top.cindex, top.cvalue) // errors handled by caller
-		return new, t
+		p.rollback(top.mark)
+		top.mark = p.checkpoint()
+		p.begin()
+		top.cvalue = top.cnext.min()
+		top.cnext.remove(top.cvalue)
+		if p.logger.tracing() {
+			p.logger.trace("solver backtrack", "depth", len(t))
+			p.logger.trace("solver choice", "index", top.cindex, "value", top.cvalue, "depth", len(t))
+		}
+		p.do(Move{Action: AssignAction, Index: top.cindex, Value: top.cvalue}) // errors handled by caller
+		return p, t
 	}
 	return p, t
 }
 
-// pushChoice chooses an unbound square to assign, pushes a
-// puzzle copy and the choice on the stack, and then applies that
-// choice to the puzzle.
+// pushChoice chooses an unbound square to assign, checkpoints
+// the puzzle, pushes the choice on the stack, and then applies
+// that choice to the puzzle.  The puzzle may have errors after
+// the choice is applied.
 func pushChoice(p *Puzzle, t thread) (*Puzzle, thread) {
 	cindex, ccount := 0, p.mapping.sidelen+1
 	for i := 1; i <= p.mapping.scount; i++ {
 		if p.squares[i].aval == 0 && p.squares[i].bval == 0 {
-			count := len(p.squares[i].pvals)
+			count := p.squares[i].pvals.len()
 			if count == 2 {
 				cindex, ccount = i, 2
 				break
@@ -220,19 +297,24 @@ func pushChoice(p *Puzzle, t thread) (*Puzzle, thread) {
 		// internal caller error - called when no choice available
 		panic(fmt.Errorf("pushChoice called with no available choices"))
 	}
+	p.end()
 	c := choice{
-		puz:    p.copy(),
+		mark:   p.checkpoint(),
 		cindex: cindex,
 		ccount: ccount,
-		cvalue: p.squares[cindex].pvals[0],
-		cnext:  newIntsetCopy(p.squares[cindex].pvals[1:]),
+		cvalue: p.squares[cindex].pvals.min(),
+		cnext:  p.squares[cindex].pvals,
 	}
-	p.assign(c.cindex, c.cvalue)
-	if len(p.errors) > 0 {
-		// can't happen: the choice was unacceptable for the square
-		panic(fmt.Errorf("Assign of %v to %+v failed: %v",
-			c.cvalue, *p.squares[cindex], p.errors))
+	c.cnext.remove(c.cvalue)
+	p.begin()
+	if p.logger.tracing() {
+		p.logger.trace("solver choice", "index", c.cindex, "value", c.cvalue, "depth", len(t)+1)
 	}
+	// the choice is a possible value for the square, but it can
+	// still leave another square in one of its groups with no
+	// possible values, or a value with no place to go; solve
+	// backtracks from such choices just like any other failure
+	p.do(Move{Action: AssignAction, Index: c.cindex, Value: c.cvalue})
 	return p, append(t, c)
 }
 
@@ -260,48 +342,44 @@ filling in bound squares, then it's a 2-star.
 
 */
 
-// rate the choices that went into a solution.  If it requires
-// only a single 2-valued choice, then it's a three-star.  If it
-// requires two 2-valued choices, or a single 3-valued choice,
-// then it's a 4-star.  If it requires more than two choices,
-// then it's a 5-star.
+// rate the choices that went into a solution.  With the default
+// bands, if it requires only a single 2-valued choice, then it's
+// a three-star.  If it requires two 2-valued choices, or a single
+// 3-valued choice, then it's a 4-star.  If it requires more than
+// two choices, then it's a 5-star.
 func rateChoices(counts []int) int {
-	switch len(counts) {
-	case 1:
-		if counts[0] > 2 {
-			return 4
-		} else {
-			return 3
-		}
-	case 2:
-		if counts[0] > 2 || counts[1] > 2 {
-			return 5
-		} else {
-			return 4
-		}
-	default:
-		return 5
-	}
+	return CurrentRatingBands().rateChoices(counts)
 }
 
 // rateNoChoices checks to see if the puzzle does not require a
 // choice.  If so, it returns the solved puzzle values and a
 // rating of 1 or 2 (depending on how many bound squares the
 // solver had to find.).  If not, it returns nil and 0.
+func rateNoChoices(p *Puzzle) ([]int, int) {
+	vals, bound := solveNoChoices(p)
+	if vals == nil {
+		return nil, 0
+	}
+	return vals, CurrentRatingBands().rateBound(bound, p.mapping.sidelen)
+}
+
+// solveNoChoices tries to solve the puzzle without a choice.
+// If it can, it returns the solved puzzle values and the number
+// of bound squares it had to find.  If not, it returns nil and 0.
 //
 // The solving happens so as to minimize the number of bound squares:
 // 1. Do all single-valued squares.
 // 2. If you find a bound-valued square, fill it and go back to 1.
-// 3. If the puzzle is solved, return the ratio.  If not, return 0.
-func rateNoChoices(p *Puzzle) ([]int, int) {
+// 3. If the puzzle is solved, return the count.  If not, return 0.
+func solveNoChoices(p *Puzzle) ([]int, int) {
 	totalBound, totalSingle := 0, 0
 	for {
 		bound, single := 0, 0
 		for i := 1; i <= p.mapping.scount; i++ {
 			if p.squares[i].aval == 0 {
-				if len(p.squares[i].pvals) == 1 {
+				if p.squares[i].pvals.len() == 1 {
 					single++
-					p.assign(i, p.squares[i].pvals[0])
+					p.assign(i, p.squares[i].pvals.min())
 				}
 			}
 		}
@@ -332,9 +410,5 @@ func rateNoChoices(p *Puzzle) ([]int, int) {
 		}
 		break
 	}
-	if totalBound < p.mapping.sidelen/2 {
-		return p.allValues(), 1
-	} else {
-		return p.allValues(), 2
-	}
+	return p.allValues(), totalBound
 }
@@ -19,6 +19,7 @@
 package puzzle
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -415,11 +416,11 @@ func TestPopThread(t *testing.T) {
 	if e != nil {
 		t.Fatalf("TestPopThread: Failed to create puzzle: %v", e)
 	}
-	thin := thread{choice{pin, 2, 2, 0, intset{2, 4}}} // artificial stack top
+	thin := thread{choice{pin.checkpoint(), 2, 2, 0, newBitset(2, 4)}} // artificial stack top
 	p, th := popChoice(pin, thin)
-	if reflect.DeepEqual(p, pin) ||
+	if p != pin ||
 		len(th) != 1 || th[0].cindex != 2 ||
-		th[0].cvalue != 2 || !reflect.DeepEqual(th[0].cnext, intset{4}) {
+		th[0].cvalue != 2 || th[0].cnext != newBitset(4) {
 		t.Errorf("TestPopThread: 1st popped stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), solveSimpleFirstValues) {
@@ -428,9 +429,9 @@ func TestPopThread(t *testing.T) {
 	}
 	pin, thin = p, th
 	p, th = popChoice(pin, thin)
-	if reflect.DeepEqual(p, pin) ||
+	if p != pin ||
 		len(th) != 1 || th[0].cindex != 2 ||
-		th[0].cvalue != 4 || !reflect.DeepEqual(th[0].cnext, intset{}) {
+		th[0].cvalue != 4 || th[0].cnext != newBitset() {
 		t.Errorf("TestPopThread: 2nd popped stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), solveSimpleSecondValues) {
@@ -439,7 +440,7 @@ func TestPopThread(t *testing.T) {
 	}
 	pin, thin = p, th
 	p, th = popChoice(pin, thin)
-	if !reflect.DeepEqual(p, pin) ||
+	if p != pin ||
 		len(th) != 0 {
 		t.Errorf("TestPopThread: 3rd popped stack top is wrong: %+v", th[0])
 	}
@@ -459,9 +460,9 @@ func TestPushThread(t *testing.T) {
 	if len(th) != 1 {
 		t.Fatalf("TestPushThread: 1st pushed stack is too deep.")
 	}
-	if reflect.DeepEqual(p, th[0].puz) ||
+	if p != pin || p.journal.findCheckpoint(th[0].mark) < 0 ||
 		th[0].cindex != 2 || th[0].cvalue != 2 ||
-		!reflect.DeepEqual(th[0].cnext, intset{4}) {
+		th[0].cnext != newBitset(4) {
 		t.Errorf("TestPushThread: 1st pushed stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), solveSimpleFirstValues) {
@@ -477,9 +478,9 @@ func TestPushThread(t *testing.T) {
 	if len(th) != 1 {
 		t.Fatalf("TestPushThread: 2nd pushed stack is too deep.")
 	}
-	if reflect.DeepEqual(p, th[0].puz) ||
+	if p != pin || p.journal.findCheckpoint(th[0].mark) < 0 ||
 		th[0].cindex != 1 || th[0].cvalue != 1 ||
-		!reflect.DeepEqual(th[0].cnext, intset{2, 3, 4}) {
+		th[0].cnext != newBitset(2, 3, 4) {
 		t.Errorf("TestPushThread: 2nd pushed stack top is wrong: %+v", th[0])
 	}
 	if !reflect.DeepEqual(p.allValues(), empty4PuzzleAssign1Values) {
@@ -577,7 +578,7 @@ func TestSolve(t *testing.T) {
 				} else if tc.elen > 0 {
 					if th[tc.elen-1].cindex != tc.elasti ||
 						th[tc.elen-1].cvalue != tc.elastv ||
-						!reflect.DeepEqual(th[tc.elen-1].cnext, tc.elastn) {
+						th[tc.elen-1].cnext != newBitset(tc.elastn...) {
 						t.Errorf("TestSolve case %d: Last choice is wrong: %+v",
 							i+1, th[tc.elen-1])
 					}
@@ -713,3 +714,44 @@ func TestSolutions(t *testing.T) {
 		}
 	}
 }
+
+func TestSolveContext(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: multiChoiceStartValues})
+	if e != nil {
+		t.Fatalf("Failed to create puzzle: %v", e)
+	}
+	all := []Solution{multiChoiceSolution1, multiChoiceSolution2, multiChoiceSolution3, multiChoiceSolution4}
+	for max, expected := range [][]Solution{all, all[:1], all[:2], all[:3], all, all} {
+		solns, e := p.SolveContext(context.Background(), max)
+		if e != nil || !reflect.DeepEqual(solns, expected) {
+			t.Errorf("SolveContext(%d) returned %v (%v), expected %v", max, solns, e, expected)
+		}
+	}
+	soln, e := p.Solve()
+	if e != nil || soln == nil || !reflect.DeepEqual(*soln, multiChoiceSolution1) {
+		t.Errorf("Solve returned %v (%v), expected %v", soln, e, multiChoiceSolution1)
+	}
+	if _, e := p.SolveContext(context.Background(), -1); e == nil || e.(Error).Condition != InvalidArgumentCondition {
+		t.Errorf("SolveContext(-1) produced incorrect error: %v", e)
+	}
+	if _, e := (*Puzzle)(nil).Solve(); e == nil {
+		t.Errorf("Solve of nil puzzle succeeded")
+	}
+
+	// a search stopped part way through returns no solutions
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, ctx := range []context.Context{done, &countdownContext{context.Background(), 5}} {
+		solns, e := p.SolveContext(ctx, 0)
+		if e == nil || e.(Error).Condition != CanceledCondition || solns != nil {
+			t.Errorf("Canceled SolveContext returned %v, %v", solns, e)
+		}
+	}
+
+	// unsolvable puzzles have no solution
+	q, _ := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues,
+		Constraints: []Constraint{{Kind: DiagonalConstraint}}})
+	if soln, e := q.Solve(); soln != nil || e != nil {
+		t.Errorf("Solve of unsolvable puzzle returned %v, %v", soln, e)
+	}
+}
@@ -0,0 +1,158 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "iter"
+
+/*
+
+Structure queries
+
+Clients and solvers often need to look at a puzzle a group at a
+time.  These queries answer in terms of the public Square and
+GroupID types, so callers never need to know how a geometry
+numbers its squares.  The iterators don't materialize slices,
+and they yield nothing if the puzzle is invalid (or, for a
+group's squares, if the puzzle has no such group).
+
+*/
+
+// findGroup returns the index of the group with the given ID, or
+// 0 if the puzzle has no such group.
+func (p *Puzzle) findGroup(gid GroupID) int {
+	for gi := 1; gi <= p.mapping.gcount; gi++ {
+		if p.mapping.gdescs[gi].id == gid {
+			return gi
+		}
+	}
+	return 0
+}
+
+// Group returns the squares in the group with the given ID, in
+// index order.  An assigned square carries its value in its
+// Aval, just as in the puzzle's State.  It's an Error if the
+// puzzle has no such group.
+func (p *Puzzle) Group(gid GroupID) ([]Square, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	gi := p.findGroup(gid)
+	if gi == 0 {
+		err := argumentError(GroupAttribute, InvalidArgumentCondition, gid)
+		err.Message = err.Error()
+		return nil, err
+	}
+	return p.indicesToSquares(p.mapping.gdescs[gi].indices), nil
+}
+
+// Row returns the squares in the i'th row (1-based) of the
+// puzzle.  See Group for details.
+func (p *Puzzle) Row(i int) ([]Square, error) {
+	return p.Group(GroupID{GtypeRow, i})
+}
+
+// Column returns the squares in the i'th column (1-based) of the
+// puzzle.  See Group for details.
+func (p *Puzzle) Column(i int) ([]Square, error) {
+	return p.Group(GroupID{GtypeCol, i})
+}
+
+// Peers returns the indices of the squares that share a group
+// with the square at the given index, in index order.  The
+// square itself is not included.  It's an Error if the index is
+// out of range.
+func (p *Puzzle) Peers(index int) ([]int, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 1 || index > p.mapping.scount {
+		return nil, rangeError(IndexAttribute, index, 1, p.mapping.scount)
+	}
+	return append([]int(nil), p.mapping.peers[index]...), nil
+}
+
+// GroupsOf returns the IDs of the groups that contain the square
+// at the given index, in the order the geometry defines them
+// (rows first, then columns, then tiles and any other group
+// types).  It's an Error if the index is out of range.
+func (p *Puzzle) GroupsOf(index int) ([]GroupID, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	if index < 1 || index > p.mapping.scount {
+		return nil, rangeError(IndexAttribute, index, 1, p.mapping.scount)
+	}
+	gis := p.mapping.ixmap[index]
+	result := make([]GroupID, len(gis))
+	for i, gi := range gis {
+		result[i] = p.mapping.gdescs[gi].id
+	}
+	return result, nil
+}
+
+// Squares returns an iterator over the puzzle's squares, in
+// index order.  Each Square is computed as it's yielded, so it
+// reflects any changes made to the puzzle during iteration.
+func (p *Puzzle) Squares() iter.Seq[Square] {
+	return func(yield func(Square) bool) {
+		if !p.isValid() {
+			return
+		}
+		for idx := 1; idx <= p.mapping.scount; idx++ {
+			if !yield(p.indexToSquare(idx)) {
+				return
+			}
+		}
+	}
+}
+
+// Groups returns an iterator over the IDs of the puzzle's
+// groups, in the order the geometry defines them.
+func (p *Puzzle) Groups() iter.Seq[GroupID] {
+	return func(yield func(GroupID) bool) {
+		if !p.isValid() {
+			return
+		}
+		for gi := 1; gi <= p.mapping.gcount; gi++ {
+			if !yield(p.mapping.gdescs[gi].id) {
+				return
+			}
+		}
+	}
+}
+
+// GroupSquares returns an iterator over the squares in the group
+// with the given ID, in index order.  It's the iterator form of
+// Group.
+func (p *Puzzle) GroupSquares(gid GroupID) iter.Seq[Square] {
+	return func(yield func(Square) bool) {
+		if !p.isValid() {
+			return
+		}
+		gi := p.findGroup(gid)
+		if gi == 0 {
+			return
+		}
+		for _, idx := range p.mapping.gdescs[gi].indices {
+			if !yield(p.indexToSquare(idx)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupQueries(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if _, e := p.Assign(Choice{13, 2}); e != nil {
+		t.Fatalf("Assign(Choice{13, 2}) failed: %v", e)
+	}
+	expected := func(indices ...int) []Square {
+		result := make([]Square, len(indices))
+		for i, idx := range indices {
+			result[i] = rotation4Puzzle1PartialAssign1CapitalSquares[idx-1]
+		}
+		return result
+	}
+	testcases := []struct {
+		name   string
+		query  func() ([]Square, error)
+		result []Square
+	}{
+		{"Row(4)", func() ([]Square, error) { return p.Row(4) }, expected(13, 14, 15, 16)},
+		{"Column(1)", func() ([]Square, error) { return p.Column(1) }, expected(1, 5, 9, 13)},
+		{"Group(tile 1)", func() ([]Square, error) { return p.Group(GroupID{GtypeTile, 1}) }, expected(1, 2, 5, 6)},
+	}
+	for _, tc := range testcases {
+		SS, e := tc.query()
+		if e != nil {
+			t.Errorf("%s failed: %v", tc.name, e)
+			continue
+		}
+		if !reflect.DeepEqual(SS, tc.result) {
+			t.Errorf("%s returned %v, expected %v", tc.name, SS, tc.result)
+		}
+	}
+
+	// error cases
+	badcases := []GroupID{{GtypeRow, 0}, {GtypeCol, 5}, {GtypeDiagonal, 1}, {"window", 1}}
+	for _, gid := range badcases {
+		_, e := p.Group(gid)
+		if e == nil || e.(Error).Attribute != GroupAttribute || e.(Error).Condition != InvalidArgumentCondition {
+			t.Errorf("Group(%v) produced incorrect error: %v", gid, e)
+		}
+	}
+	var np *Puzzle
+	if _, e := np.Row(1); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("Row on nil puzzle produced incorrect error: %v", e)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	peers, e := p.Peers(6)
+	if e != nil {
+		t.Fatalf("Peers(6) failed: %v", e)
+	}
+	if expected := []int{1, 2, 5, 7, 8, 10, 14}; !reflect.DeepEqual(peers, expected) {
+		t.Errorf("Peers(6) returned %v, expected %v", peers, expected)
+	}
+
+	// every square in a standard 9x9 puzzle has 20 peers
+	p, e = New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	for idx := 1; idx <= 81; idx++ {
+		if peers, _ := p.Peers(idx); len(peers) != 20 {
+			t.Errorf("Peers(%d) returned %d peers, expected 20", idx, len(peers))
+		}
+	}
+
+	// error cases
+	_, e = p.Peers(0)
+	if e == nil || e.(Error).Condition != TooSmallCondition {
+		t.Errorf("Peers of index too small produced incorrect error: %v", e)
+	}
+	_, e = p.Peers(82)
+	if e == nil || e.(Error).Condition != TooLargeCondition {
+		t.Errorf("Peers of index too large produced incorrect error: %v", e)
+	}
+}
+
+func TestGroupsOf(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Creation of threeStar puzzle failed: %v", e)
+	}
+	gids, e := p.GroupsOf(41)
+	if e != nil {
+		t.Fatalf("GroupsOf(41) failed: %v", e)
+	}
+	expected := []GroupID{{GtypeRow, 5}, {GtypeCol, 5}, {GtypeTile, 5}}
+	if !reflect.DeepEqual(gids, expected) {
+		t.Errorf("GroupsOf(41) returned %v, expected %v", gids, expected)
+	}
+	// each group of a square must contain it
+	for idx := 1; idx <= 81; idx++ {
+		gids, _ := p.GroupsOf(idx)
+		for _, gid := range gids {
+			SS, _ := p.Group(gid)
+			found := false
+			for _, S := range SS {
+				found = found || S.Index == idx
+			}
+			if !found {
+				t.Errorf("GroupsOf(%d) returned %v, which doesn't contain it", idx, gid)
+			}
+		}
+	}
+
+	// error cases
+	_, e = p.GroupsOf(0)
+	if e == nil || e.(Error).Condition != TooSmallCondition {
+		t.Errorf("GroupsOf index too small produced incorrect error: %v", e)
+	}
+	_, e = p.GroupsOf(82)
+	if e == nil || e.(Error).Condition != TooLargeCondition {
+		t.Errorf("GroupsOf index too large produced incorrect error: %v", e)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	var SS []Square
+	for S := range p.Squares() {
+		SS = append(SS, S)
+	}
+	if !reflect.DeepEqual(SS, p.allSquares()) {
+		t.Errorf("Squares yielded %v, expected %v", SS, p.allSquares())
+	}
+
+	count := 0
+	for gid := range p.Groups() {
+		count++
+		expected, e := p.Group(gid)
+		if e != nil {
+			t.Fatalf("Group(%v) failed: %v", gid, e)
+		}
+		SS = nil
+		for S := range p.GroupSquares(gid) {
+			SS = append(SS, S)
+		}
+		if !reflect.DeepEqual(SS, expected) {
+			t.Errorf("GroupSquares(%v) yielded %v, expected %v", gid, SS, expected)
+		}
+	}
+	if count != 12 {
+		t.Errorf("Groups yielded %d groups, expected 12", count)
+	}
+
+	// iteration stops early on break
+	count = 0
+	for S := range p.Squares() {
+		if S.Index > 3 {
+			break
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("Squares yielded %d squares before break, expected 3", count)
+	}
+
+	// nothing is yielded for invalid puzzles or unknown groups
+	var np *Puzzle
+	for range np.Squares() {
+		t.Errorf("Squares yielded a square from a nil puzzle")
+	}
+	for range np.Groups() {
+		t.Errorf("Groups yielded a group from a nil puzzle")
+	}
+	for range p.GroupSquares(GroupID{GtypeDiagonal, 1}) {
+		t.Errorf("GroupSquares yielded a square from an unknown group")
+	}
+}
@@ -0,0 +1,53 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "log/slog"
+
+/*
+
+Tracing
+
+Constraint bugs are hard to reproduce, so a puzzle can be given
+a structured logger that it traces its work to.  Events are
+logged at debug level, with these messages:
+
+	puzzle assign     a value is assigned to a square
+	puzzle unassign   a square's value is cleared
+	square bind       a group binds a value to a square
+	square eliminate  values are removed from a square's possibles
+	puzzle error      an assignment made the puzzle unsolvable
+	solver choice     the solver tries a value for a square
+	solver backtrack  the solver takes back a choice
+	solver solution   the solver finds a solution
+
+The solver traces the work it does on its copies of a puzzle
+to the puzzle's tracer.
+
+*/
+
+// SetTracer makes the puzzle trace its work to the given logger.
+// A nil logger turns tracing off.
+func (p *Puzzle) SetTracer(logger *slog.Logger) error {
+	if !p.isValid() {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	p.logger.tracer = logger
+	return nil
+}
@@ -0,0 +1,86 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// traceEvents returns the counts of the messages in a JSON trace.
+func traceEvents(t *testing.T, buf *bytes.Buffer) map[string]int {
+	counts := make(map[string]int)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var event map[string]interface{}
+		if e := dec.Decode(&event); e != nil {
+			t.Fatalf("Failed to decode trace: %v", e)
+		}
+		counts[event["msg"].(string)]++
+	}
+	return counts
+}
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	if e := p.SetTracer(logger); e != nil {
+		t.Fatalf("SetTracer failed: %v", e)
+	}
+	p.Assign(Choice{13, 2})
+	p.Unassign(13)
+	p.Solutions()
+	counts := traceEvents(t, &buf)
+	for _, msg := range []string{
+		"puzzle assign", "puzzle unassign", "square eliminate", "square bind",
+		"solver choice", "solver backtrack", "solver solution",
+	} {
+		if counts[msg] == 0 {
+			t.Errorf("Trace has no %q events: %v", msg, counts)
+		}
+	}
+	if counts["solver solution"] != 2 {
+		t.Errorf("Trace has %d solutions, expected 2", counts["solver solution"])
+	}
+
+	// errors are traced
+	p.Assign(Choice{2, 1})
+	if counts := traceEvents(t, &buf); counts["puzzle error"] == 0 {
+		t.Errorf("Trace has no error events: %v", counts)
+	}
+
+	// copies and untraced puzzles are silent
+	q := p.copy()
+	q.Unassign(2)
+	p.SetTracer(nil)
+	p.Unassign(2)
+	if buf.Len() != 0 {
+		t.Errorf("Untraced puzzles traced %q", buf.String())
+	}
+	var np *Puzzle
+	if e := np.SetTracer(logger); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("SetTracer on nil puzzle produced incorrect error: %v", e)
+	}
+}
@@ -0,0 +1,200 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"fmt"
+)
+
+/*
+
+Validation
+
+Assignment and unassignment update a puzzle incrementally,
+touching only the squares and groups they have to.  Validation
+recomputes the possible values of every square from scratch,
+and checks that the squares and groups agree with each other.
+(It can't just compare the puzzle with one built from its
+values, because incremental analysis can find bindings that a
+from-scratch build, which analyzes each group only once, can't.)  It's meant for tests,
+for sanity checks on puzzles rebuilt from storage, and for
+debugging, since it costs about as much as creating the puzzle.
+
+*/
+
+// Validate cross-checks the internal state of a puzzle, and
+// returns an Error describing each inconsistency it finds.  A
+// puzzle that passes has a nil result.  Note that a puzzle can
+// pass validation and still have errors (such as duplicate
+// values in a group): Validate reports bugs, not conflicts.
+func (p *Puzzle) Validate() []Error {
+	if !p.isValid() {
+		return []Error{argumentError(PuzzleAttribute, InvalidArgumentCondition, p)}
+	}
+	var errs []Error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, InternalError("Validate", fmt.Sprintf(format, args...)))
+	}
+
+	// the squares must be consistent with their own values and
+	// with the assigned values in their groups
+	n := p.mapping.sidelen
+	for i := 1; i <= p.mapping.scount; i++ {
+		s := p.squares[i]
+		if s.index != i {
+			report("square %d has index %d", i, s.index)
+		}
+		if s.aval < 0 || s.aval > n {
+			report("square %d has assigned value %d out of range", i, s.aval)
+			continue
+		}
+		if s.aval != 0 {
+			if s.pvals.len() != 0 {
+				report("assigned square %d has possible values %v", i, s.pvals)
+			}
+			continue
+		}
+		bs := newBitsetRange(n)
+		for _, j := range p.mapping.peers[i] {
+			bs.remove(p.squares[j].aval)
+		}
+		if p.restricted(i) {
+			// rules can remove more values, but never add any
+			if !bs.contains(s.pvals) {
+				report("square %d has possible values %v, expected some of %v", i, s.pvals, bs)
+			}
+		} else if s.pvals != bs {
+			report("square %d has possible values %v, expected %v", i, s.pvals, bs)
+		}
+		if s.bval != 0 {
+			if len(s.bsrc) == 0 {
+				report("square %d is bound to %d with no source", i, s.bval)
+			}
+			for _, gid := range s.bsrc {
+				if !p.inGroup(i, gid) {
+					report("square %d is bound by %v, which doesn't contain it", i, gid)
+				}
+			}
+		} else if len(s.bsrc) != 0 {
+			report("unbound square %d has binding sources %v", i, s.bsrc)
+		}
+	}
+
+	// the groups must agree with their squares
+	for gi := 1; gi <= p.mapping.gcount; gi++ {
+		g := p.groups[gi]
+		if g.desc != &p.mapping.gdescs[gi] {
+			report("group %d has the wrong descriptor", gi)
+			continue
+		}
+		id := g.desc.id
+		if len(g.where) != n+1 {
+			report("%v has a value map of length %d", id, len(g.where))
+			continue
+		}
+		for v := 1; v <= n; v++ {
+			if wi := g.where[v]; wi != 0 && (p.squares[wi].aval != v || !p.inGroup(wi, id)) {
+				report("%v records value %d in square %d", id, v, wi)
+			}
+		}
+		for _, i := range g.free {
+			if !p.inGroup(i, id) || p.squares[i].aval != 0 {
+				report("%v has square %d free", id, i)
+			}
+		}
+		for _, i := range g.desc.indices {
+			if v := p.squares[i].aval; v != 0 && g.where[v] == 0 {
+				report("%v doesn't record value %d in square %d", id, v, i)
+			}
+		}
+		if len(p.errors) > 0 {
+			// analysis stops at the first error, so the needed
+			// values and free squares may be out of date
+			continue
+		}
+		// every square is free unless it's been assigned or
+		// placed (it has one possible value, or the group bound
+		// it), and every value is needed unless it's been
+		// assigned or placed
+		var need bitset
+		for v := 1; v <= n; v++ {
+			if g.where[v] == 0 {
+				need.insert(v)
+			}
+		}
+		var free intset
+		for _, i := range g.desc.indices {
+			s := p.squares[i]
+			switch {
+			case s.aval != 0:
+			case s.pvals.len() == 1:
+				need.remove(s.pvals.min())
+			case s.bval != 0 && containsGroup(s.bsrc, id):
+				need.remove(s.bval)
+			default:
+				free = append(free, i)
+			}
+		}
+		if !g.free.equals(free) {
+			report("%v has free squares %v, expected %v", id, g.free, free)
+		}
+		if g.need != need {
+			report("%v needs %v, expected %v", id, g.need, need)
+		}
+	}
+
+	// the puzzle has errors if and only if a puzzle built from
+	// scratch with its values does
+	r, e := create(p.mapping, p.allValues())
+	if e != nil {
+		report("rebuild failed: %v", e)
+	} else if len(r.errors) > 0 && len(p.errors) == 0 {
+		report("puzzle has no errors, but its rebuild has %v", r.errors)
+	} else if len(r.errors) == 0 && len(p.errors) > 0 {
+		report("puzzle has errors %v, but its rebuild has none", p.errors)
+	}
+	return errs
+}
+
+// containsGroup returns whether the given group ID is in a list.
+func containsGroup(gids []GroupID, gid GroupID) bool {
+	for _, g := range gids {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// restricted returns whether the square with the given index is
+// covered by any of the puzzle's constraint rules.
+func (p *Puzzle) restricted(idx int) bool {
+	return p.mapping.stack != nil && len(p.mapping.stack.rulemap[idx]) > 0
+}
+
+// inGroup returns whether the square with the given index is in
+// the group with the given ID.
+func (p *Puzzle) inGroup(idx int, gid GroupID) bool {
+	for _, gi := range p.mapping.ixmap[idx] {
+		if p.mapping.gdescs[gi].id == gid {
+			return true
+		}
+	}
+	return false
+}
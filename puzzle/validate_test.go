@@ -0,0 +1,139 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []*Summary{
+		&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues},
+		&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: solveSimpleStartValues},
+		&Summary{Geometry: RectangularGeometryName, SideLength: 6},
+	}
+	for i, summary := range cases {
+		p, e := New(summary)
+		if e != nil {
+			t.Fatalf("Case %d: failed to create puzzle: %v", i, e)
+		}
+		validateFill(t, p)
+	}
+
+	// conflicts aren't inconsistencies
+	c, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: conflicting4Puzzle1})
+	if e != nil {
+		t.Fatalf("Failed to create conflicting puzzle: %v", e)
+	}
+	if errs := c.Validate(); errs != nil {
+		t.Errorf("Conflicting puzzle fails validation: %v", errs)
+	}
+
+	// corrupted puzzles fail
+	corruptions := []func(q *Puzzle){
+		func(q *Puzzle) {
+			q.squares[2].pvals = newBitset(2)
+		},
+		func(q *Puzzle) {
+			q.squares[1].pvals = newBitset(1)
+		},
+		func(q *Puzzle) {
+			q.squares[2].bval, q.squares[2].bsrc = 3, nil
+		},
+		func(q *Puzzle) {
+			q.squares[2].bsrc = []GroupID{{GtypeRow, 4}}
+		},
+		func(q *Puzzle) {
+			q.groups[1].where[3] = 0
+		},
+		func(q *Puzzle) {
+			q.groups[1].need.insert(1)
+		},
+		func(q *Puzzle) {
+			q.groups[1].free.insert(1)
+		},
+		func(q *Puzzle) {
+			q.groups[2].free = nil
+		},
+	}
+	r, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Failed to create rotation4Puzzle1: %v", e)
+	}
+	for i, corrupt := range corruptions {
+		q := r.copy()
+		corrupt(q)
+		if errs := q.Validate(); errs == nil {
+			t.Errorf("Case %d: corrupted puzzle passes validation", i)
+		} else if errs[0].Scope != InternalScope {
+			t.Errorf("Case %d: validation gave wrong error: %v", i, errs[0])
+		}
+	}
+	if errs := (&Puzzle{}).Validate(); len(errs) != 1 || errs[0].Condition != InvalidArgumentCondition {
+		t.Errorf("Validation of invalid puzzle gave wrong errors: %v", errs)
+	}
+}
+
+// validateFill fills in a puzzle one square at a time, validating
+// each step, then empties it again in the opposite order.  Easy
+// squares are filled first; when there aren't any, the first
+// empty square gets its first possible value, which may well
+// lead to a conflict.
+func validateFill(t *testing.T, p *Puzzle) {
+	if errs := p.Validate(); errs != nil {
+		t.Fatalf("New puzzle fails validation: %v", errs)
+	}
+	var order []int
+	for len(p.errors) == 0 {
+		idx, val := 0, 0
+		for i := 1; i <= p.mapping.scount && idx == 0; i++ {
+			if s := p.squares[i]; s.aval == 0 && s.bval != 0 {
+				idx, val = i, s.bval
+			} else if s.aval == 0 && s.pvals.len() == 1 {
+				idx, val = i, s.pvals.min()
+			}
+		}
+		for i := 1; i <= p.mapping.scount && idx == 0; i++ {
+			if s := p.squares[i]; s.aval == 0 {
+				idx, val = i, s.pvals.min()
+			}
+		}
+		if idx == 0 {
+			break
+		}
+		if _, e := p.Assign(Choice{idx, val}); e != nil {
+			t.Fatalf("Assign(%d, %d) failed: %v", idx, val, e)
+		}
+		order = append(order, idx)
+		if errs := p.Validate(); errs != nil {
+			t.Fatalf("Puzzle fails validation after Assign(%d, %d): %v", idx, val, errs)
+		}
+	}
+	if len(order) == 0 {
+		t.Fatalf("No squares to assign")
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		if _, e := p.Unassign(order[i]); e != nil {
+			t.Fatalf("Unassign(%d) failed: %v", order[i], e)
+		}
+		if errs := p.Validate(); errs != nil {
+			t.Fatalf("Puzzle fails validation after Unassign(%d): %v", order[i], errs)
+		}
+	}
+}
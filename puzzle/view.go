@@ -0,0 +1,219 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import "iter"
+
+/*
+
+Read-only snapshots
+
+A PuzzleView is a snapshot of a puzzle that offers the puzzle's
+queries but none of its operations.  The snapshot is a private
+copy of the puzzle's squares and groups (which shares the
+puzzle's immutable structure, such as its geometry mapping), and
+since nothing ever changes it, any number of goroutines can use
+it at once without locks or further copies.
+
+*/
+
+// A PuzzleView is a read-only snapshot of a puzzle.
+type PuzzleView struct {
+	p *Puzzle
+}
+
+// Snapshot returns a read-only view of the puzzle as it is now.
+// Later changes to the puzzle don't affect the view.
+func (p *Puzzle) Snapshot() (*PuzzleView, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	return &PuzzleView{p.copy()}, nil
+}
+
+// puzzle returns the view's puzzle, or nil for a nil view (which
+// makes the queries return an Error).
+func (v *PuzzleView) puzzle() *Puzzle {
+	if v == nil {
+		return nil
+	}
+	return v.p
+}
+
+// Hash returns the Signature of the viewed puzzle.
+func (v *PuzzleView) Hash() (Signature, error) {
+	return v.puzzle().Hash()
+}
+
+// ETag returns the entity tag of the viewed puzzle.
+func (v *PuzzleView) ETag() (string, error) {
+	return v.puzzle().ETag()
+}
+
+// Summary returns the summary of the viewed puzzle.
+func (v *PuzzleView) Summary() (*Summary, error) {
+	return v.puzzle().Summary()
+}
+
+// State returns the entire content of the viewed puzzle.
+func (v *PuzzleView) State() (*Content, error) {
+	return v.puzzle().State()
+}
+
+// Version returns the version of the viewed puzzle.
+func (v *PuzzleView) Version() (int, error) {
+	return v.puzzle().Version()
+}
+
+// StateSince returns the content of the viewed puzzle's squares
+// changed since the given version, and the viewed version.
+func (v *PuzzleView) StateSince(version int) (*Content, int, error) {
+	return v.puzzle().StateSince(version)
+}
+
+// Solutions finds all solutions to the viewed puzzle.
+func (v *PuzzleView) Solutions() ([]Solution, error) {
+	return v.puzzle().Solutions()
+}
+
+// RatingMeasure measures the viewed puzzle the way the solver
+// does when rating it.
+func (v *PuzzleView) RatingMeasure() (*RatingMeasure, error) {
+	return v.puzzle().RatingMeasure()
+}
+
+// Copy returns a new (mutable) puzzle with the viewed content.
+func (v *PuzzleView) Copy() (*Puzzle, error) {
+	return v.puzzle().Copy()
+}
+
+// Group returns the squares in a group of the viewed puzzle.
+func (v *PuzzleView) Group(gid GroupID) ([]Square, error) {
+	return v.puzzle().Group(gid)
+}
+
+// Row returns the squares in a row of the viewed puzzle.
+func (v *PuzzleView) Row(i int) ([]Square, error) {
+	return v.puzzle().Row(i)
+}
+
+// Column returns the squares in a column of the viewed puzzle.
+func (v *PuzzleView) Column(i int) ([]Square, error) {
+	return v.puzzle().Column(i)
+}
+
+// Peers returns the peers of a square in the viewed puzzle.
+func (v *PuzzleView) Peers(index int) ([]int, error) {
+	return v.puzzle().Peers(index)
+}
+
+// GroupsOf returns the groups of a square in the viewed puzzle.
+func (v *PuzzleView) GroupsOf(index int) ([]GroupID, error) {
+	return v.puzzle().GroupsOf(index)
+}
+
+// Heatmap returns the candidate heatmap of the viewed puzzle.
+func (v *PuzzleView) Heatmap() (*Heatmap, error) {
+	return v.puzzle().Heatmap()
+}
+
+// Occurrences returns where a value occurs in the viewed puzzle.
+func (v *PuzzleView) Occurrences(value int) (*ValueOccurrences, error) {
+	return v.puzzle().Occurrences(value)
+}
+
+// Grid returns the values and givens of the viewed puzzle by row.
+func (v *PuzzleView) Grid() ([][]int, [][]bool, error) {
+	return v.puzzle().Grid()
+}
+
+// Validate cross-checks the internal state of the viewed puzzle.
+func (v *PuzzleView) Validate() []Error {
+	return v.puzzle().Validate()
+}
+
+// MemStats estimates the memory used by the viewed puzzle.
+func (v *PuzzleView) MemStats() (*MemStats, error) {
+	return v.puzzle().MemStats()
+}
+
+// CheckAgainst compares the viewed puzzle's assigned values
+// with a solution.
+func (v *PuzzleView) CheckAgainst(solution []int) ([]Verdict, error) {
+	return v.puzzle().CheckAgainst(solution)
+}
+
+// VerifySolution checks that a solution solves the viewed puzzle.
+func (v *PuzzleView) VerifySolution(solution []int) ([]int, error) {
+	return v.puzzle().VerifySolution(solution)
+}
+
+// FindTechnique looks for an instance of the named technique in
+// the viewed puzzle.
+func (v *PuzzleView) FindTechnique(name string) (*TechniqueInstance, error) {
+	return v.puzzle().FindTechnique(name)
+}
+
+// ExplainError explains why the viewed puzzle is unsolvable.
+func (v *PuzzleView) ExplainError() (*ErrorExplanation, error) {
+	return v.puzzle().ExplainError()
+}
+
+// Describe returns an accessible description of the viewed
+// puzzle, with a square selected.
+func (v *PuzzleView) Describe(index int, braille bool) (*Description, error) {
+	return v.puzzle().Describe(index, braille)
+}
+
+// Difficulties estimates the difficulty of the empty squares in
+// the viewed puzzle.
+func (v *PuzzleView) Difficulties() ([]SquareDifficulty, error) {
+	return v.puzzle().Difficulties()
+}
+
+// Assist returns the assist level of the viewed puzzle.
+func (v *PuzzleView) Assist() AssistLevel {
+	return v.puzzle().Assist()
+}
+
+// Annotations returns the annotations of the viewed puzzle.
+func (v *PuzzleView) Annotations() []Annotation {
+	return v.puzzle().Annotations()
+}
+
+// Squares iterates over the squares of the viewed puzzle.
+func (v *PuzzleView) Squares() iter.Seq[Square] {
+	return v.puzzle().Squares()
+}
+
+// Groups iterates over the group IDs of the viewed puzzle.
+func (v *PuzzleView) Groups() iter.Seq[GroupID] {
+	return v.puzzle().Groups()
+}
+
+// GroupSquares iterates over the squares in a group of the viewed
+// puzzle.
+func (v *PuzzleView) GroupSquares(gid GroupID) iter.Seq[Square] {
+	return v.puzzle().GroupSquares(gid)
+}
+
+// String gives a pretty-printed view of the viewed puzzle.
+func (v *PuzzleView) String() string {
+	return v.puzzle().String()
+}
@@ -0,0 +1,92 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 4, Values: rotation4Puzzle1PartialValues})
+	if e != nil {
+		t.Fatalf("Creation of rotation4Puzzle1 failed: %v", e)
+	}
+	v, e := p.Snapshot()
+	if e != nil {
+		t.Fatalf("Snapshot failed: %v", e)
+	}
+	expected, _ := p.State()
+
+	// readers share the view while the puzzle changes
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if state, _ := v.State(); !reflect.DeepEqual(state, expected) {
+					t.Errorf("View state changed to %v", state)
+					return
+				}
+				v.Row(1)
+				v.Peers(6)
+				for range v.Squares() {
+				}
+			}
+		}()
+	}
+	for _, choice := range []Choice{{13, 2}, {10, 4}, {15, 4}} {
+		if _, e := p.Assign(choice); e != nil {
+			t.Fatalf("Assign(%v) failed: %v", choice, e)
+		}
+	}
+	wg.Wait()
+
+	// the view still has the snapshot content
+	if state, _ := v.State(); !reflect.DeepEqual(state, expected) {
+		t.Errorf("View state is %v, expected %v", state, expected)
+	}
+	SS, e := v.Row(4)
+	if e != nil || SS[0].Aval != 0 {
+		t.Errorf("View Row(4) returned %v (%v)", SS, e)
+	}
+	if solutions, e := v.Solutions(); e != nil || len(solutions) != 2 {
+		t.Errorf("View Solutions returned %v (%v)", solutions, e)
+	}
+	q, e := v.Copy()
+	if e != nil {
+		t.Fatalf("View Copy failed: %v", e)
+	}
+	q.Assign(Choice{13, 2})
+	if state, _ := v.State(); !reflect.DeepEqual(state, expected) {
+		t.Errorf("Changing a copy changed the view")
+	}
+
+	// error cases
+	var nv *PuzzleView
+	if _, e := nv.State(); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("State on nil view produced incorrect error: %v", e)
+	}
+	var np *Puzzle
+	if _, e := np.Snapshot(); e == nil || e.(Error).Attribute != PuzzleAttribute {
+		t.Errorf("Snapshot of nil puzzle produced incorrect error: %v", e)
+	}
+}
@@ -0,0 +1,260 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+
+Workspaces
+
+Players rarely work on just one version of a puzzle: they save
+the position before a risky guess so they can come back to it,
+and they try ideas out on a copy they mean to throw away.  A
+Workspace keeps those versions together.  It holds named
+branches of a puzzle, one of which is current, and a scratch
+copy of the current branch.  Branches keep their history, so
+undo and redo work in each of them; the scratch copy starts
+without history, and is discarded whenever the current branch
+changes.
+
+Like Puzzles, Workspaces are not safe for concurrent use.
+
+*/
+
+// MainBranch is the name of the branch holding the puzzle a
+// workspace was made from.
+const MainBranch = "main"
+
+// maxBranchNameLength is the longest name a branch can have.
+const maxBranchNameLength = 50
+
+// A Workspace holds several named branches of a puzzle.
+type Workspace struct {
+	current  string
+	branches map[string]*Puzzle
+	scratch  *Puzzle
+}
+
+// A WorkspaceSummary gives the data needed to reconstruct a
+// workspace.  The branch summaries include their journals.
+type WorkspaceSummary struct {
+	Current  string              `json:"current"`
+	Branches map[string]*Summary `json:"branches"`
+	Scratch  *Summary            `json:"scratch,omitempty"`
+}
+
+// NewWorkspace returns a workspace whose only branch, the
+// current one, is the given puzzle (not a copy of it), under the
+// name MainBranch.
+func NewWorkspace(p *Puzzle) (*Workspace, error) {
+	if !p.isValid() {
+		return nil, argumentError(PuzzleAttribute, InvalidArgumentCondition, p)
+	}
+	return &Workspace{current: MainBranch, branches: map[string]*Puzzle{MainBranch: p}}, nil
+}
+
+// OpenWorkspace reconstructs a workspace from its summary.  It's
+// an Error if a branch's summary doesn't make a puzzle, or if
+// the current branch isn't one of the branches.
+func OpenWorkspace(summary *WorkspaceSummary) (*Workspace, error) {
+	if summary == nil {
+		return nil, argumentError(SummaryAttribute, InvalidArgumentCondition, summary)
+	}
+	if _, ok := summary.Branches[summary.Current]; !ok {
+		return nil, argumentError(BranchAttribute, InvalidArgumentCondition, summary.Current)
+	}
+	w := &Workspace{current: summary.Current, branches: make(map[string]*Puzzle, len(summary.Branches))}
+	for name, s := range summary.Branches {
+		if !validBranchName(name) {
+			return nil, argumentError(BranchAttribute, InvalidArgumentCondition, name)
+		}
+		p, e := New(s)
+		if e != nil {
+			return nil, e
+		}
+		w.branches[name] = p
+	}
+	if summary.Scratch != nil {
+		p, e := New(summary.Scratch)
+		if e != nil {
+			return nil, e
+		}
+		w.scratch = p
+	}
+	return w, nil
+}
+
+// Summary returns the summary of the workspace.
+func (w *Workspace) Summary() (*WorkspaceSummary, error) {
+	ws := &WorkspaceSummary{Current: w.current, Branches: make(map[string]*Summary, len(w.branches))}
+	for name, p := range w.branches {
+		s, e := historySummary(p)
+		if e != nil {
+			return nil, e
+		}
+		ws.Branches[name] = s
+	}
+	if w.scratch != nil {
+		s, e := historySummary(w.scratch)
+		if e != nil {
+			return nil, e
+		}
+		ws.Scratch = s
+	}
+	return ws, nil
+}
+
+// historySummary returns the summary of a puzzle with its
+// journal.
+func historySummary(p *Puzzle) (*Summary, error) {
+	s, e := p.Summary()
+	if e != nil {
+		return nil, e
+	}
+	if s.Journal, e = p.Journal(); e != nil {
+		return nil, e
+	}
+	return s, nil
+}
+
+// validBranchName: branch names have to be non-empty, not too
+// long, and printable.
+func validBranchName(name string) bool {
+	if name == "" || len(name) > maxBranchNameLength || !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Current returns the puzzle in the current branch.
+func (w *Workspace) Current() *Puzzle {
+	return w.branches[w.current]
+}
+
+// CurrentBranch returns the name of the current branch.
+func (w *Workspace) CurrentBranch() string {
+	return w.current
+}
+
+// Branches returns the names of the branches, sorted.
+func (w *Workspace) Branches() []string {
+	names := make([]string, 0, len(w.branches))
+	for name := range w.branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Branch returns the puzzle in the named branch, and whether
+// there is such a branch.
+func (w *Workspace) Branch(name string) (*Puzzle, bool) {
+	p, ok := w.branches[name]
+	return p, ok
+}
+
+// SaveBranch saves a copy of the current branch, history and
+// all, under the given name, replacing any branch already saved
+// under that name.  The current branch can't be replaced.
+func (w *Workspace) SaveBranch(name string) error {
+	if !validBranchName(name) || name == w.current {
+		return argumentError(BranchAttribute, InvalidArgumentCondition, name)
+	}
+	p, e := copyWithHistory(w.Current())
+	if e != nil {
+		return e
+	}
+	w.branches[name] = p
+	return nil
+}
+
+// copyWithHistory: a copy of the puzzle that keeps its journal.
+func copyWithHistory(p *Puzzle) (*Puzzle, error) {
+	s, e := historySummary(p)
+	if e != nil {
+		return nil, e
+	}
+	return New(s)
+}
+
+// Checkout makes the named branch current, discarding the
+// scratch copy.
+func (w *Workspace) Checkout(name string) error {
+	if _, ok := w.branches[name]; !ok {
+		return argumentError(BranchAttribute, InvalidArgumentCondition, name)
+	}
+	if name != w.current {
+		w.current, w.scratch = name, nil
+	}
+	return nil
+}
+
+// DeleteBranch removes the named branch.  The current branch
+// can't be removed.
+func (w *Workspace) DeleteBranch(name string) error {
+	if _, ok := w.branches[name]; !ok || name == w.current {
+		return argumentError(BranchAttribute, InvalidArgumentCondition, name)
+	}
+	delete(w.branches, name)
+	return nil
+}
+
+// Scratch returns the scratch copy of the current branch,
+// making it if there isn't one.  Changes to the scratch copy
+// don't affect the branch.
+func (w *Workspace) Scratch() (*Puzzle, error) {
+	if w.scratch == nil {
+		p, e := w.Current().Copy()
+		if e != nil {
+			return nil, e
+		}
+		w.scratch = p
+	}
+	return w.scratch, nil
+}
+
+// DiscardScratch throws away the scratch copy, so the next call
+// to Scratch copies the current branch afresh.
+func (w *Workspace) DiscardScratch() {
+	w.scratch = nil
+}
+
+// KeepScratch saves the scratch copy as a branch under the given
+// name, which becomes the current branch.  It's an Error if there
+// is no scratch copy, or if the name is the current branch's.
+func (w *Workspace) KeepScratch(name string) error {
+	if w.scratch == nil {
+		return argumentError(PuzzleAttribute, InvalidArgumentCondition, nil)
+	}
+	if !validBranchName(name) || name == w.current {
+		return argumentError(BranchAttribute, InvalidArgumentCondition, name)
+	}
+	w.branches[name], w.current, w.scratch = w.scratch, name, nil
+	return nil
+}
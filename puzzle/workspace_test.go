@@ -0,0 +1,174 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package puzzle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWorkspaceBranches(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	w, e := NewWorkspace(p)
+	if e != nil {
+		t.Fatalf("Failed to make workspace: %v", e)
+	}
+	if w.Current() != p || w.CurrentBranch() != MainBranch {
+		t.Fatalf("New workspace has current branch %q", w.CurrentBranch())
+	}
+	if _, e := p.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if e := w.SaveBranch("guess"); e != nil {
+		t.Fatalf("SaveBranch failed: %v", e)
+	}
+	if e := w.Checkout("guess"); e != nil {
+		t.Fatalf("Checkout failed: %v", e)
+	}
+	guess := w.Current()
+	if guess == p || !reflect.DeepEqual(guess.allValues(), p.allValues()) {
+		t.Errorf("Branch isn't a copy of its source")
+	}
+	// the branch has the history of its source
+	if _, e := guess.Undo(); e != nil {
+		t.Errorf("Undo on branch failed: %v", e)
+	}
+	if p.squares[9].aval != 7 {
+		t.Errorf("Undo on branch changed its source")
+	}
+	if names := w.Branches(); !reflect.DeepEqual(names, []string{"guess", MainBranch}) {
+		t.Errorf("Branches are %v", names)
+	}
+	for _, name := range []string{"", "guess", "bad\nname", string(make([]byte, maxBranchNameLength+1))} {
+		if e := w.SaveBranch(name); e == nil {
+			t.Errorf("SaveBranch of %q succeeded", name)
+		}
+	}
+	if e := w.DeleteBranch("guess"); e == nil {
+		t.Errorf("Deleted the current branch")
+	}
+	if e := w.Checkout("missing"); e == nil {
+		t.Errorf("Checked out a missing branch")
+	}
+	if e := w.Checkout(MainBranch); e != nil {
+		t.Fatalf("Checkout failed: %v", e)
+	}
+	if e := w.DeleteBranch("guess"); e != nil {
+		t.Errorf("DeleteBranch failed: %v", e)
+	}
+	if _, ok := w.Branch("guess"); ok {
+		t.Errorf("Deleted branch is still there")
+	}
+	if _, e := NewWorkspace(&Puzzle{}); e == nil {
+		t.Errorf("Made a workspace from an invalid puzzle")
+	}
+}
+
+func TestWorkspaceScratch(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	w, _ := NewWorkspace(p)
+	if e := w.KeepScratch("try"); e == nil {
+		t.Errorf("Kept a missing scratch copy")
+	}
+	sc, e := w.Scratch()
+	if e != nil {
+		t.Fatalf("Scratch failed: %v", e)
+	}
+	if again, _ := w.Scratch(); again != sc {
+		t.Errorf("Scratch made a second copy")
+	}
+	if _, e := sc.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if p.squares[9].aval != 0 {
+		t.Errorf("Assign to scratch copy changed the branch")
+	}
+	w.DiscardScratch()
+	if sc, _ = w.Scratch(); sc.squares[9].aval != 0 {
+		t.Errorf("Discarded scratch copy came back")
+	}
+	if _, e := sc.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	if e := w.KeepScratch(MainBranch); e == nil {
+		t.Errorf("Kept scratch copy over the current branch")
+	}
+	if e := w.KeepScratch("try"); e != nil {
+		t.Fatalf("KeepScratch failed: %v", e)
+	}
+	if w.CurrentBranch() != "try" || w.Current() != sc || w.scratch != nil {
+		t.Errorf("Kept scratch copy isn't the current branch")
+	}
+}
+
+func TestWorkspaceSummary(t *testing.T) {
+	p, e := New(&Summary{Geometry: StandardGeometryName, SideLength: 9, Values: threeStarValues})
+	if e != nil {
+		t.Fatalf("Failed to make puzzle: %v", e)
+	}
+	w, _ := NewWorkspace(p)
+	if _, e := p.Assign(Choice{9, 7}); e != nil {
+		t.Fatalf("Assign failed: %v", e)
+	}
+	w.SaveBranch("saved")
+	sc, _ := w.Scratch()
+	sc.Assign(Choice{12, 4})
+	summary, e := w.Summary()
+	if e != nil {
+		t.Fatalf("Summary failed: %v", e)
+	}
+	encoded, e := json.Marshal(summary)
+	if e != nil {
+		t.Fatalf("Marshal failed: %v", e)
+	}
+	var decoded WorkspaceSummary
+	if e := json.Unmarshal(encoded, &decoded); e != nil {
+		t.Fatalf("Unmarshal failed: %v", e)
+	}
+	ow, e := OpenWorkspace(&decoded)
+	if e != nil {
+		t.Fatalf("OpenWorkspace failed: %v", e)
+	}
+	if ow.CurrentBranch() != MainBranch || !reflect.DeepEqual(ow.Branches(), w.Branches()) {
+		t.Errorf("Reopened workspace has branches %v, current %q", ow.Branches(), ow.CurrentBranch())
+	}
+	if !reflect.DeepEqual(ow.Current().allValues(), p.allValues()) || ow.scratch.squares[12].aval != 4 {
+		t.Errorf("Reopened workspace has the wrong values")
+	}
+	if _, e := ow.Current().Undo(); e != nil {
+		t.Errorf("Reopened branch lost its history: %v", e)
+	}
+	for _, bad := range []*WorkspaceSummary{
+		nil,
+		{Current: "missing", Branches: decoded.Branches},
+		{Current: MainBranch, Branches: map[string]*Summary{MainBranch: {Geometry: "bogus", SideLength: 9}}},
+		{Current: "", Branches: map[string]*Summary{"": decoded.Branches[MainBranch]}},
+	} {
+		if _, e := OpenWorkspace(bad); e == nil {
+			t.Errorf("OpenWorkspace of %+v succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"time"
+)
+
+/*
+
+achievements
+
+Each completed puzzle is recorded with the statistics badges are
+judged on: the puzzle's size and rating, the hints given, and
+whether it was a puzzle of the day.  A session's badges are
+evaluated from its completions whenever they're asked for, so
+adding a badge awards it retroactively.
+
+*/
+
+// A Badge is an achievement a session can earn.
+type Badge struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// An EarnedBadge is a badge and the time it was earned.
+type EarnedBadge struct {
+	Badge
+	Earned time.Time `json:"earned"`
+}
+
+// A Completion records the completion of a session puzzle.
+// Elapsed is the time solving took, which isn't known for
+// completions recorded before it was.
+type Completion struct {
+	PuzzleId   string        `json:"puzzleId"`
+	SideLength int           `json:"sideLength"`
+	Rating     int           `json:"rating"`
+	Hints      int           `json:"hints"`
+	Daily      bool          `json:"daily"`
+	Completed  time.Time     `json:"completed"`
+	Elapsed    time.Duration `json:"elapsed,omitempty"`
+}
+
+// dailyStreakDays is the length of daily streak that earns a
+// badge.
+const dailyStreakDays = 7
+
+// A badgeRule finds the completion that earned a badge, given a
+// session's completions in time order, or returns -1 if the
+// badge hasn't been earned.
+type badgeRule func(cs []Completion) int
+
+var badges = []struct {
+	Badge
+	rule badgeRule
+}{
+	{
+		Badge{"first-9x9", "First 9x9", "Solved a 9x9 puzzle."},
+		firstCompletion(func(c Completion) bool { return c.SideLength == 9 }),
+	},
+	{
+		Badge{"no-hints", "Unaided", "Solved a puzzle without any hints."},
+		firstCompletion(func(c Completion) bool { return c.Hints == 0 }),
+	},
+	{
+		Badge{"beyond-singles", "Beyond singles",
+			"Solved a puzzle that can't be finished with naked and hidden singles alone."},
+		firstCompletion(func(c Completion) bool { return c.Rating >= 3 }),
+	},
+	{
+		Badge{"daily-streak", "Daily streak",
+			fmt.Sprintf("Solved a puzzle of the day %d days in a row.", dailyStreakDays)},
+		dailyStreak,
+	},
+}
+
+// firstCompletion makes a rule that's met by the first
+// completion that passes the test.
+func firstCompletion(test func(c Completion) bool) badgeRule {
+	return func(cs []Completion) int {
+		for i, c := range cs {
+			if test(c) {
+				return i
+			}
+		}
+		return -1
+	}
+}
+
+// dailyStreak finds the completion that finished the first
+// streak of consecutive days solving a puzzle of the day.
+func dailyStreak(cs []Completion) int {
+	streak, last := 0, -1
+	for i, c := range cs {
+		if !c.Daily {
+			continue
+		}
+		day := dayNumber(c.Completed.UTC())
+		switch day {
+		case last:
+			continue
+		case last + 1:
+			streak++
+		default:
+			streak = 1
+		}
+		if last = day; streak == dailyStreakDays {
+			return i
+		}
+	}
+	return -1
+}
+
+// EvaluateBadges returns the badges earned with the given
+// completions, which must be in time order, and the badges still
+// available.  Both lists are in badge order.
+func EvaluateBadges(cs []Completion) (earned []EarnedBadge, available []Badge) {
+	for _, b := range badges {
+		if i := b.rule(cs); i >= 0 {
+			earned = append(earned, EarnedBadge{b.Badge, cs[i].Completed})
+		} else {
+			available = append(available, b.Badge)
+		}
+	}
+	return
+}
+
+// Completions returns the completions recorded for a session, in
+// time order.
+func Completions(sid string) []Completion {
+	var cs []Completion
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT puzzleId, sideLength, rating, hints, daily, completed, elapsed FROM completions "+
+				"WHERE sessionId = $1 ORDER BY completed, completionId", sid)
+		if err != nil {
+			return fmt.Errorf("Database failure loading completions for session %q: %v", sid, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var c Completion
+			var side, rating, hints int32
+			var elapsed pgx.NullInt64
+			if err := rows.Scan(&c.PuzzleId, &side, &rating, &hints, &c.Daily, &c.Completed, &elapsed); err != nil {
+				return fmt.Errorf("Database failure reading completions for session %q: %v", sid, err)
+			}
+			c.SideLength, c.Rating, c.Hints = int(side), int(rating), int(hints)
+			c.Elapsed = time.Duration(elapsed.Int64) * time.Millisecond
+			cs = append(cs, c)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return cs
+}
+
+// Badges returns the badges the session has earned, and the ones
+// still available.
+func (s *Session) Badges() ([]EarnedBadge, []Badge) {
+	return EvaluateBadges(Completions(s.sid))
+}
+
+// recordCompletion: record the completion of the active puzzle,
+// with the score it was given.
+func (s *Session) recordCompletion(sc *Score, completed time.Time) {
+	daily := IsDailyPuzzle(completed, s.Info.PuzzleId)
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO completions "+
+				"(sessionId, puzzleId, sideLength, rating, hints, daily, completed, elapsed) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			s.sid, s.Info.PuzzleId, s.Info.SideLength, sc.Rating, sc.Hints, daily, completed,
+			int64(sc.Elapsed/time.Millisecond))
+		if err != nil {
+			return fmt.Errorf("Database failure recording completion for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+}
@@ -0,0 +1,320 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/garyburd/redigo/redis"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/dbprep"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"time"
+)
+
+/*
+
+Administration
+
+These entries support the server's admin endpoints.  Like the
+rest of the package, they panic on storage failures.
+
+*/
+
+// A SessionSummary describes a stored session.
+type SessionSummary struct {
+	SessionId string    `json:"sessionId"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	ActivePID string    `json:"activePuzzleId"`
+	Entries   int       `json:"entries"`
+}
+
+// ListSessions returns summaries of the stored user sessions, most
+// recently updated first.  At most limit sessions are returned.
+func ListSessions(limit int) []*SessionSummary {
+	var sums []*SessionSummary
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT s.sessionId, s.created, s.updated, s.active, COUNT(e.puzzleId) "+
+				"FROM sessions s LEFT JOIN sessionEntries e ON s.sessionId = e.sessionId "+
+				"WHERE s.sessionId <> $1 GROUP BY s.sessionId "+
+				"ORDER BY s.updated DESC LIMIT $2", dbprep.SampleSessionName, limit)
+		if err != nil {
+			return fmt.Errorf("Failed to list sessions: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sum SessionSummary
+			var count int64
+			if err := rows.Scan(&sum.SessionId, &sum.Created, &sum.Updated, &sum.ActivePID, &count); err != nil {
+				return fmt.Errorf("Failure reading session list: %v", err)
+			}
+			sum.Entries = int(count)
+			sums = append(sums, &sum)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return sums
+}
+
+// EvictSession removes a session's data from the cache, so the
+// next request in the session reloads it from the database.  It
+// returns the number of cache keys removed.
+func EvictSession(sessionId string) int {
+	if sessionId == "" {
+		panic(fmt.Errorf("Session IDs cannot be null"))
+	}
+	s := &Session{sid: sessionId}
+	var count int
+	body := func(tx redis.Conn) error {
+		keys, err := redis.Strings(tx.Do("KEYS", s.key()+":*"))
+		if err != nil {
+			return fmt.Errorf("Cache error listing keys for session %q: %v", sessionId, err)
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		count, err = redis.Int(tx.Do("DEL", redis.Args{}.AddFlat(keys)...))
+		if err != nil {
+			return fmt.Errorf("Cache error evicting session %q: %v", sessionId, err)
+		}
+		return nil
+	}
+	rdExecute(body)
+	return count
+}
+
+// ValidateSession rebuilds the active puzzle of a stored session
+// from its choices, without touching the cache, and returns the
+// result of validating it (see puzzle.Validate).  It returns
+// false if there's no such session.
+func ValidateSession(sessionId string) ([]puzzle.Error, bool) {
+	p := rebuildActivePuzzle(sessionId)
+	if p == nil {
+		return nil, false
+	}
+	return p.Validate(), true
+}
+
+// SessionMemStats rebuilds the active puzzle of a stored session,
+// as ValidateSession does, and returns its estimated memory use
+// (see puzzle.MemStats).  It returns false if there's no such
+// session.
+func SessionMemStats(sessionId string) (*puzzle.MemStats, bool) {
+	p := rebuildActivePuzzle(sessionId)
+	if p == nil {
+		return nil, false
+	}
+	ms, err := p.MemStats()
+	if err != nil {
+		panic(fmt.Errorf("Failure measuring puzzle: %v", err))
+	}
+	return ms, true
+}
+
+// rebuildActivePuzzle rebuilds the active puzzle of a stored
+// session from its choices, without touching the cache.  It
+// returns nil if there's no such session.
+func rebuildActivePuzzle(sessionId string) *puzzle.Puzzle {
+	if sessionId == "" {
+		panic(fmt.Errorf("Session IDs cannot be null"))
+	}
+	s := &Session{sid: sessionId, active: -1}
+	s.databaseLoadSession()
+	if s.info == nil {
+		return nil
+	}
+	for _, se := range s.entries {
+		if se.PuzzleId != s.info.ActivePID {
+			continue
+		}
+		p := loadPuzzleEntry(se.PuzzleId).makePuzzle()
+		for j := 0; j+1 < len(se.Choices); j = j + 2 {
+			choice := puzzle.Choice{Index: int(se.Choices[j]), Value: int(se.Choices[j+1])}
+			if _, err := p.Assign(choice); err != nil {
+				panic(fmt.Errorf("Failure assigning to puzzle: %v", err))
+			}
+		}
+		return p
+	}
+	panic(fmt.Errorf("Session %q has no entry for its active puzzle %q", sessionId, s.info.ActivePID))
+}
+
+// A StorageUsage counts what's held in storage.
+type StorageUsage struct {
+	Puzzles        int64 `json:"puzzles"`
+	Solutions      int64 `json:"solutions"`
+	Sessions       int64 `json:"sessions"`
+	SessionEntries int64 `json:"sessionEntries"`
+	LibraryPuzzles int64 `json:"libraryPuzzles"`
+	CacheKeys      int64 `json:"cacheKeys"`
+}
+
+// Usage reports how much is held in the database and cache.
+func Usage() *StorageUsage {
+	u := &StorageUsage{}
+	body := func(tx *pgx.Tx) error {
+		counts := []struct {
+			query string
+			dest  *int64
+		}{
+			{"SELECT COUNT(*) FROM puzzles", &u.Puzzles},
+			{"SELECT COUNT(*) FROM solutions", &u.Solutions},
+			{"SELECT COUNT(*) FROM sessions", &u.Sessions},
+			{"SELECT COUNT(*) FROM sessionEntries", &u.SessionEntries},
+		}
+		for _, c := range counts {
+			if err := tx.QueryRow(c.query).Scan(c.dest); err != nil {
+				return fmt.Errorf("Database failure counting %q: %v", c.query, err)
+			}
+		}
+		row := tx.QueryRow("SELECT COUNT(*) FROM sessionEntries WHERE sessionId = $1",
+			dbprep.SampleSessionName)
+		if err := row.Scan(&u.LibraryPuzzles); err != nil {
+			return fmt.Errorf("Database failure counting library puzzles: %v", err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	rdExecute(func(tx redis.Conn) (err error) {
+		u.CacheKeys, err = redis.Int64(tx.Do("DBSIZE"))
+		if err != nil {
+			err = fmt.Errorf("Cache failure reading size: %v", err)
+		}
+		return
+	})
+	return u
+}
+
+/*
+
+Library management
+
+The library is the sample session: its puzzles are the ones new
+sessions start with, and the ones featured as daily puzzles.
+
+*/
+
+// LibraryPuzzles returns info about all the library puzzles.
+func LibraryPuzzles() []*PuzzleInfo {
+	ss := loadSampleSession()
+	infos := make([]*PuzzleInfo, len(ss.entries))
+	for i := range ss.entries {
+		infos[i] = ss.makePuzzleInfo(i)
+	}
+	return infos
+}
+
+// AddLibraryPuzzle adds a puzzle to the library under the given
+// name.  The summary must describe a valid puzzle, and the name
+// must not already be used in the library.
+func AddLibraryPuzzle(name string, summary *puzzle.Summary) *PuzzleInfo {
+	name = strings.ToLower(name)
+	if name == "" {
+		panic(fmt.Errorf("Library puzzles must have a name"))
+	}
+	p, err := puzzle.New(summary)
+	if err != nil {
+		panic(fmt.Errorf("Invalid library puzzle %q: %v", name, err))
+	}
+	hash, err := p.Hash()
+	if err != nil {
+		panic(fmt.Errorf("Failed to hash library puzzle %q: %v", name, err))
+	}
+	pe := &puzzleEntry{
+		PuzzleId:   string(hash),
+		Geometry:   summary.Geometry,
+		SideLength: int32(summary.SideLength),
+		Values:     make([]int32, len(summary.Values)),
+	}
+	for i, v := range summary.Values {
+		pe.Values[i] = int32(v)
+	}
+	body := func(tx *pgx.Tx) error {
+		var count int64
+		row := tx.QueryRow("SELECT COUNT(*) FROM sessionEntries "+
+			"WHERE sessionId = $1 AND (puzzleName = $2 OR puzzleId = $3)",
+			dbprep.SampleSessionName, name, pe.PuzzleId)
+		if err := row.Scan(&count); err != nil {
+			return fmt.Errorf("Database failure checking library for %q: %v", name, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("Library already has puzzle %q or its content", name)
+		}
+		_, err := tx.Exec(
+			"INSERT INTO puzzles (puzzleId, geometry, sideLength, valueList, created) "+
+				"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (puzzleId) DO NOTHING",
+			pe.PuzzleId, pe.Geometry, pe.SideLength, pe.Values, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database error saving library puzzle %q: %v", name, err)
+		}
+		_, err = tx.Exec(
+			"INSERT INTO sessionEntries (sessionId, puzzleId, puzzleName, lastView) "+
+				"VALUES ($1, $2, $3, $4)",
+			dbprep.SampleSessionName, pe.PuzzleId, name, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database error adding %q to library: %v", name, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	reloadSampleSession()
+	ss := loadSampleSession()
+	for i, se := range ss.entries {
+		if se.PuzzleName == name {
+			return ss.makePuzzleInfo(i)
+		}
+	}
+	panic(fmt.Errorf("Library puzzle %q missing after insert", name))
+}
+
+// RemoveLibraryPuzzle removes the named puzzle from the library.
+// Sessions that already have the puzzle keep it.  It returns
+// whether there was such a puzzle.  The library's active puzzle
+// can't be removed.
+func RemoveLibraryPuzzle(name string) bool {
+	name = strings.ToLower(name)
+	ss := loadSampleSession()
+	for _, se := range ss.entries {
+		if se.PuzzleName == name && se.PuzzleId == ss.info.ActivePID {
+			panic(fmt.Errorf("Can't remove %q, the library's starting puzzle", name))
+		}
+	}
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec("DELETE FROM sessionEntries WHERE sessionId = $1 AND puzzleName = $2",
+			dbprep.SampleSessionName, name)
+		if err != nil {
+			return fmt.Errorf("Database error removing %q from library: %v", name, err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	reloadSampleSession()
+	return removed
+}
+
+// reloadSampleSession forgets the in-memory sample session, so
+// it's reloaded from the database on next use.
+func reloadSampleSession() {
+	sampleSession = &Session{sid: dbprep.SampleSessionName, active: -1}
+}
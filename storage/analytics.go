@@ -0,0 +1,300 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"sort"
+)
+
+/*
+
+mistake analytics
+
+To see where players go wrong, their move journals are replayed
+from each puzzle's start, checking every assign against the
+puzzle's solution and against the easy placements available at
+the time.  A wrong value is a mistake, and if a practice
+technique would have given the right value, the player missed
+that technique.  An assign that no technique justified is a
+guess, right or wrong.
+
+Analytics are aggregated over all the journals of a session (for
+the player) or of a puzzle (across players).
+
+*/
+
+// MistakeAnalytics summarizes the assigns in some move journals.
+// Justified counts, for each practice technique, the assigns
+// made where the technique gave the square's value, and Missed
+// counts the ones of those that were mistakes.  Cells lists the
+// squares with mistakes or guesses, the most troublesome first.
+type MistakeAnalytics struct {
+	Assigns   int            `json:"assigns"`
+	Mistakes  int            `json:"mistakes"`
+	Guesses   int            `json:"guesses"`
+	Justified map[string]int `json:"justified"`
+	Missed    map[string]int `json:"missed"`
+	Cells     []*CellStats   `json:"cells"`
+}
+
+// CellStats counts the mistakes and guesses made on a square.
+type CellStats struct {
+	PuzzleId string `json:"puzzleId"`
+	Index    int    `json:"index"`
+	Mistakes int    `json:"mistakes"`
+	Guesses  int    `json:"guesses"`
+}
+
+// newMistakeAnalytics returns empty analytics.
+func newMistakeAnalytics() *MistakeAnalytics {
+	ma := &MistakeAnalytics{Justified: make(map[string]int), Missed: make(map[string]int), Cells: []*CellStats{}}
+	for _, technique := range PracticeTechniques() {
+		ma.Justified[technique] = 0
+		ma.Missed[technique] = 0
+	}
+	return ma
+}
+
+// AnalyzeMoves analyzes the move journal of a puzzle, given its
+// starting state and solution values.
+func AnalyzeMoves(pid string, start *puzzle.Puzzle, solution []int, moves []Move) *MistakeAnalytics {
+	ma := newMistakeAnalytics()
+	ma.analyze(pid, start, solution, moves)
+	ma.sortCells()
+	return ma
+}
+
+// replayMoves replays a move journal from the puzzle's start,
+// which isn't changed.  The before function (if any) is called
+// with each move and the puzzle as the player saw it just before
+// the move, and the after function (if any) with the puzzle just
+// after.  The puzzle is rebuilt from the start on every undo or
+// reset, so it's always the one the player saw.
+func replayMoves(start *puzzle.Puzzle, moves []Move, before, after func(m Move, p *puzzle.Puzzle)) {
+	var choices []puzzle.Choice
+	var p *puzzle.Puzzle
+	rebuild := func() {
+		p, _ = start.Copy()
+		for _, c := range choices {
+			p.Assign(c)
+		}
+	}
+	rebuild()
+	for _, m := range moves {
+		if before != nil {
+			before(m, p)
+		}
+		switch m.Kind {
+		case AssignMove:
+			if _, err := p.Assign(m.Choice); err == nil {
+				choices = append(choices, m.Choice)
+			}
+		case UndoMove:
+			if len(choices) > 0 {
+				choices = choices[:len(choices)-1]
+				rebuild()
+			}
+		case ResetMove:
+			choices = nil
+			rebuild()
+		}
+		if after != nil {
+			after(m, p)
+		}
+	}
+}
+
+// analyze adds the analysis of a move journal.
+func (ma *MistakeAnalytics) analyze(pid string, start *puzzle.Puzzle, solution []int, moves []Move) {
+	cells := make(map[int]*CellStats)
+	replayMoves(start, moves, func(m Move, p *puzzle.Puzzle) {
+		if m.Kind == AssignMove {
+			ma.analyzeAssign(p, solution, m.Choice, cells)
+		}
+	}, nil)
+	for _, cs := range cells {
+		cs.PuzzleId = pid
+		ma.Cells = append(ma.Cells, cs)
+	}
+}
+
+// analyzeAssign classifies an assign made on the puzzle, before
+// it's made.
+func (ma *MistakeAnalytics) analyzeAssign(p *puzzle.Puzzle, solution []int, c puzzle.Choice, cells map[int]*CellStats) {
+	if c.Index < 1 || c.Index > len(solution) {
+		return
+	}
+	ma.Assigns++
+	// the first technique (in practice order) that places the
+	// square justifies the assign
+	var technique string
+	placements := easyPlacements(p)
+	for _, name := range PracticeTechniques() {
+		for _, ep := range placements[name] {
+			if ep.Index == c.Index && technique == "" {
+				technique = name
+			}
+		}
+	}
+	cell := func() *CellStats {
+		if cells[c.Index] == nil {
+			cells[c.Index] = &CellStats{Index: c.Index}
+		}
+		return cells[c.Index]
+	}
+	if technique == "" {
+		ma.Guesses++
+		cell().Guesses++
+	} else {
+		ma.Justified[technique]++
+	}
+	if c.Value != solution[c.Index-1] {
+		ma.Mistakes++
+		cell().Mistakes++
+		if technique != "" {
+			ma.Missed[technique]++
+		}
+	}
+}
+
+// sortCells puts the most troublesome cells first.
+func (ma *MistakeAnalytics) sortCells() {
+	sort.Slice(ma.Cells, func(i, j int) bool {
+		ci, cj := ma.Cells[i], ma.Cells[j]
+		if ti, tj := ci.Mistakes+ci.Guesses, cj.Mistakes+cj.Guesses; ti != tj {
+			return ti > tj
+		}
+		if ci.PuzzleId != cj.PuzzleId {
+			return ci.PuzzleId < cj.PuzzleId
+		}
+		return ci.Index < cj.Index
+	})
+}
+
+// SessionMistakes analyzes all of a session's move journals.
+func SessionMistakes(sid string) *MistakeAnalytics {
+	return analyzeJournals("sessionId", sid)
+}
+
+// PuzzleMistakes analyzes the move journals of a puzzle across
+// all sessions.
+func PuzzleMistakes(pid string) *MistakeAnalytics {
+	return analyzeJournals("puzzleId", pid)
+}
+
+// analyzeJournals analyzes the move journals whose column has the
+// given value.  Journals of puzzles with no solution are skipped.
+func analyzeJournals(column, value string) *MistakeAnalytics {
+	type journalKey struct{ sid, pid string }
+	var keys []journalKey
+	journals := make(map[journalKey][]Move)
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT sessionId, puzzleId, kind, squareIndex, squareValue, mistake, made "+
+				"FROM moveJournal WHERE "+column+" = $1 ORDER BY moveId", value)
+		if err != nil {
+			return fmt.Errorf("Database failure loading move journals by %s %q: %v", column, value, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key journalKey
+			var m Move
+			var index, val pgx.NullInt32
+			if err := rows.Scan(&key.sid, &key.pid, &m.Kind, &index, &val, &m.Mistake, &m.Made); err != nil {
+				return fmt.Errorf("Database failure reading move journals by %s %q: %v", column, value, err)
+			}
+			m.Choice = puzzle.Choice{Index: int(index.Int32), Value: int(val.Int32)}
+			if _, ok := journals[key]; !ok {
+				keys = append(keys, key)
+			}
+			journals[key] = append(journals[key], m)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+
+	type solvedPuzzle struct {
+		start    *puzzle.Puzzle
+		solution []int
+	}
+	solved := make(map[string]*solvedPuzzle)
+	ma := newMistakeAnalytics()
+	for _, key := range keys {
+		sp, ok := solved[key.pid]
+		if !ok {
+			start := loadPuzzleEntry(key.pid).makePuzzle()
+			if sols, err := start.Solutions(); err == nil && len(sols) > 0 {
+				sp = &solvedPuzzle{start, sols[0].Values}
+			}
+			solved[key.pid] = sp
+		}
+		if sp != nil {
+			ma.analyze(key.pid, sp.start, sp.solution, journals[key])
+		}
+	}
+	ma.mergeCells()
+	ma.sortCells()
+	return ma
+}
+
+// mergeCells combines the stats for the same cell from different
+// journals.
+func (ma *MistakeAnalytics) mergeCells() {
+	type cellKey struct {
+		pid   string
+		index int
+	}
+	merged := make(map[cellKey]*CellStats)
+	cells := ma.Cells[:0]
+	for _, cs := range ma.Cells {
+		key := cellKey{cs.PuzzleId, cs.Index}
+		if m := merged[key]; m != nil {
+			m.Mistakes += cs.Mistakes
+			m.Guesses += cs.Guesses
+		} else {
+			merged[key] = cs
+			cells = append(cells, cs)
+		}
+	}
+	ma.Cells = cells
+}
+
+// ExplainError traces the active puzzle, if it's unsolvable, back
+// to the choice that doomed it (see puzzle.ExplainError).  The
+// session's puzzle may have been loaded without its history, so
+// the explanation comes from a copy rebuilt from the session's
+// choices.  It's nil if the puzzle is still solvable.
+func (s *Session) ExplainError() *puzzle.ErrorExplanation {
+	choices := s.entries[s.active].Choices
+	p := loadPuzzleEntry(s.entries[s.active].PuzzleId).makePuzzle()
+	for j := 0; j+1 < len(choices); j += 2 {
+		choice := puzzle.Choice{Index: int(choices[j]), Value: int(choices[j+1])}
+		if _, err := p.Assign(choice); err != nil {
+			panic(fmt.Errorf("Failure assigning to puzzle: %v", err))
+		}
+	}
+	x, err := p.ExplainError()
+	if err != nil {
+		panic(fmt.Errorf("Failure explaining puzzle errors: %v", err))
+	}
+	return x
+}
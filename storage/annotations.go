@@ -0,0 +1,202 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/garyburd/redigo/redis"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"time"
+)
+
+/*
+
+annotations
+
+A session's puzzles can carry annotations (see puzzle.Annotation)
+made by the player or by the player's teacher.  The puzzle steps
+in the cache are snapshots, and undoing a move mustn't undo a
+note, so annotations are kept apart from the steps: in the
+database, with a copy of each puzzle's in the cache, and they are
+attached to the active puzzle whenever it's loaded.  Annotations
+have their database ids, and show their authors by player tag or
+teacher name.  Players can only remove their own annotations,
+and teachers theirs.
+
+*/
+
+// notesKey: returns the cache key for the active puzzle's annotations
+func (s *Session) notesKey() string {
+	return s.key() + ":PID:" + s.entries[s.active].PuzzleId + ":Notes"
+}
+
+// attachAnnotations: attach the active puzzle's annotations to it,
+// loading them into the cache if they aren't there.
+func (s *Session) attachAnnotations() {
+	var bytes []byte
+	body := func(tx redis.Conn) (err error) {
+		bytes, err = redis.Bytes(tx.Do("GET", s.notesKey()))
+		if err == redis.ErrNil {
+			return nil
+		}
+		if err != nil {
+			err = fmt.Errorf("Cache failure loading annotations: %v", err)
+		}
+		return
+	}
+	rdExecute(body)
+	var notes []puzzle.Annotation
+	if len(bytes) > 0 {
+		if err := json.Unmarshal(bytes, &notes); err != nil {
+			panic(fmt.Errorf("Failed to unmarshal annotations: %v", err))
+		}
+	} else {
+		notes = s.databaseLoadAnnotations()
+		if bytes, err := json.Marshal(notes); err != nil {
+			panic(fmt.Errorf("Failed to marshal annotations: %v", err))
+		} else {
+			rdExecute(func(tx redis.Conn) (err error) {
+				if _, err = tx.Do("SET", s.notesKey(), bytes); err != nil {
+					err = fmt.Errorf("Cache failure saving annotations: %v", err)
+				}
+				return
+			})
+		}
+	}
+	if err := s.Puzzle.SetAnnotations(notes); err != nil {
+		panic(fmt.Errorf("Stored annotations don't fit puzzle %q: %v", s.entries[s.active].PuzzleId, err))
+	}
+}
+
+// databaseLoadAnnotations: load the active puzzle's annotations
+// from the database.
+func (s *Session) databaseLoadAnnotations() []puzzle.Annotation {
+	notes := []puzzle.Annotation{}
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT annotationId, square, gtype, gindex, author, body, created FROM annotations "+
+				"WHERE sessionId = $1 AND puzzleId = $2 ORDER BY annotationId",
+			s.sid, s.entries[s.active].PuzzleId)
+		if err != nil {
+			return fmt.Errorf("Database failure loading annotations: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var a puzzle.Annotation
+			var id int64
+			var square, gindex pgx.NullInt32
+			var gtype pgx.NullString
+			if err := rows.Scan(&id, &square, &gtype, &gindex, &a.Author, &a.Text, &a.Created); err != nil {
+				return fmt.Errorf("Database failure reading annotations: %v", err)
+			}
+			a.Id, a.Square = int(id), int(square.Int32)
+			if gtype.Valid {
+				a.Group = &puzzle.GroupID{Gtype: gtype.String, Index: int(gindex.Int32)}
+			}
+			notes = append(notes, a)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return notes
+}
+
+// clearAnnotations: drop the active puzzle's cached annotations
+// and attach them afresh.
+func (s *Session) clearAnnotations() {
+	rdExecute(func(tx redis.Conn) (err error) {
+		if _, err = tx.Do("DEL", s.notesKey()); err != nil {
+			err = fmt.Errorf("Cache failure clearing annotations: %v", err)
+		}
+		return
+	})
+	s.attachAnnotations()
+}
+
+// Annotate adds an annotation to the active puzzle, made by the
+// given teacher or, if there isn't one, by the session's player.
+// The annotation's id, author, and time are filled in, and it's
+// returned as stored.  It's a puzzle.Error if the annotation
+// doesn't fit the puzzle.
+func (s *Session) Annotate(a puzzle.Annotation, teacher string) (puzzle.Annotation, error) {
+	a.Id, a.Created = 0, time.Now()
+	a.Author = teacher
+	if teacher == "" {
+		a.Author = PlayerTag(s.sid)
+	}
+	checked, err := s.Puzzle.Annotate(a)
+	if err != nil {
+		return a, err
+	}
+	var id int64
+	body := func(tx *pgx.Tx) error {
+		var square, gindex, gtype, teacherName interface{}
+		if checked.Group != nil {
+			gtype, gindex = checked.Group.Gtype, int32(checked.Group.Index)
+		} else {
+			square = int32(checked.Square)
+		}
+		if teacher != "" {
+			teacherName = teacher
+		}
+		err := tx.QueryRow(
+			"INSERT INTO annotations (sessionId, puzzleId, square, gtype, gindex, author, teacherName, body, created) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING annotationId",
+			s.sid, s.entries[s.active].PuzzleId, square, gtype, gindex,
+			checked.Author, teacherName, checked.Text, checked.Created).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("Database failure saving annotation for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	s.clearAnnotations()
+	checked.Id = int(id)
+	return checked, nil
+}
+
+// RemoveAnnotation removes an annotation from the active puzzle,
+// if it's there and was made by the given teacher or, if there
+// isn't one, by the player.  It returns whether it removed one.
+func (s *Session) RemoveAnnotation(id int, teacher string) bool {
+	var count int64
+	body := func(tx *pgx.Tx) error {
+		owner := "teacherName IS NULL"
+		args := []interface{}{int64(id), s.sid, s.entries[s.active].PuzzleId}
+		if teacher != "" {
+			owner = "teacherName = $4"
+			args = append(args, teacher)
+		}
+		tag, err := tx.Exec(
+			"DELETE FROM annotations WHERE annotationId = $1 AND sessionId = $2 AND puzzleId = $3 AND "+
+				owner, args...)
+		if err != nil {
+			return fmt.Errorf("Database failure removing annotation %d: %v", id, err)
+		}
+		count = tag.RowsAffected()
+		return nil
+	}
+	pgExecute(body)
+	if count > 0 {
+		s.clearAnnotations()
+	}
+	return count > 0
+}
@@ -0,0 +1,234 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"time"
+)
+
+/*
+
+assignments
+
+A teacher can assign a class a set of library puzzles, due by a
+given time.  Students find their assignments from their session,
+and work an assignment puzzle by adding it to their session.
+Completion is tracked through the recorded completions, so a
+puzzle the student already finished counts too: an assignment
+puzzle is done as soon as the student's session first completes
+it, and on time if that's by the due time.
+
+Assignment names follow the rules for lesson names.
+
+*/
+
+// An Assignment is a set of puzzles assigned to a class.
+type Assignment struct {
+	Class   string    `json:"class"`
+	Name    string    `json:"name"`
+	Title   string    `json:"title"`
+	Due     time.Time `json:"due"`
+	Puzzles []string  `json:"puzzles"` // puzzle IDs, in order
+}
+
+// An AssignmentStatus is a student's view of an assignment:
+// when (if at all) they completed each of its puzzles.
+type AssignmentStatus struct {
+	*Assignment
+	Completed []*time.Time `json:"completed"`
+}
+
+// An AssignmentResult is a student's result on one puzzle of an
+// assignment.  The score is their best, if they completed it.
+type AssignmentResult struct {
+	Student   string     `json:"student"`
+	Position  int        `json:"position"`
+	PuzzleId  string     `json:"puzzleId"`
+	Completed *time.Time `json:"completed"`
+	OnTime    bool       `json:"onTime"`
+	Score     *int       `json:"score"`
+}
+
+// AddAssignment: add an assignment to its class.  Returns false
+// if the class already has an assignment with that name.  Panics
+// on an invalid name, a missing class, or a puzzle that isn't
+// stored.
+func AddAssignment(a *Assignment) bool {
+	if !ValidLessonName(a.Name) {
+		panic(fmt.Errorf("Invalid assignment name: %q", a.Name))
+	}
+	added := false
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"INSERT INTO assignments (className, assignmentName, title, due, created) "+
+				"VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+			a.Class, a.Name, a.Title, a.Due, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure adding assignment %q to class %q: %v", a.Name, a.Class, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+		for i, pid := range a.Puzzles {
+			_, err := tx.Exec(
+				"INSERT INTO assignmentPuzzles (className, assignmentName, position, puzzleId) "+
+					"VALUES ($1, $2, $3, $4)",
+				a.Class, a.Name, i+1, pid)
+			if err != nil {
+				return fmt.Errorf("Database failure adding puzzle %d of assignment %q: %v", i+1, a.Name, err)
+			}
+		}
+		added = true
+		return nil
+	}
+	pgExecute(body)
+	return added
+}
+
+// ClassAssignments returns the assignments of a class, soonest
+// due first.
+func ClassAssignments(class string) []*Assignment {
+	return loadAssignments("a.className = $1", class)
+}
+
+// FindAssignment returns the named assignment of a class, or nil
+// if there is none.
+func FindAssignment(class, name string) *Assignment {
+	if as := loadAssignments("a.className = $1 AND a.assignmentName = $2", class, name); len(as) > 0 {
+		return as[0]
+	}
+	return nil
+}
+
+// loadAssignments loads the assignments that meet the condition,
+// soonest due first.
+func loadAssignments(where string, args ...interface{}) []*Assignment {
+	var as []*Assignment
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT a.className, a.assignmentName, a.title, a.due, p.puzzleId "+
+				"FROM assignments a JOIN assignmentPuzzles p "+
+				"ON a.className = p.className AND a.assignmentName = p.assignmentName "+
+				"WHERE "+where+" ORDER BY a.due, a.className, a.assignmentName, p.position", args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading assignments: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var a Assignment
+			var pid string
+			if err := rows.Scan(&a.Class, &a.Name, &a.Title, &a.Due, &pid); err != nil {
+				return fmt.Errorf("Database failure reading assignments: %v", err)
+			}
+			if n := len(as); n == 0 || as[n-1].Class != a.Class || as[n-1].Name != a.Name {
+				as = append(as, &a)
+			}
+			last := as[len(as)-1]
+			last.Puzzles = append(last.Puzzles, pid)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return as
+}
+
+// Assignments returns the session's assignments in all the
+// classes it has joined, soonest due first.
+func (s *Session) Assignments() []*AssignmentStatus {
+	as := loadAssignments(
+		"a.className IN (SELECT className FROM classStudents WHERE sessionId = $1)", s.sid)
+	first := make(map[string]time.Time)
+	for _, c := range Completions(s.sid) {
+		if _, ok := first[c.PuzzleId]; !ok {
+			first[c.PuzzleId] = c.Completed
+		}
+	}
+	statuses := make([]*AssignmentStatus, len(as))
+	for i, a := range as {
+		statuses[i] = &AssignmentStatus{a, make([]*time.Time, len(a.Puzzles))}
+		for j, pid := range a.Puzzles {
+			if completed, ok := first[pid]; ok {
+				statuses[i].Completed[j] = &completed
+			}
+		}
+	}
+	return statuses
+}
+
+// StartAssignment: make the puzzle of an assignment (given by its
+// 1-based position) the active puzzle, adding it to the session
+// first if need be.  Any choices already made on it are kept.
+// Returns false (and changes nothing) if the assignment has no
+// such puzzle.
+func (s *Session) StartAssignment(a *Assignment, position int) bool {
+	if position < 1 || position > len(a.Puzzles) {
+		return false
+	}
+	pid := a.Puzzles[position-1]
+	if s.findEntry(pid) < 0 {
+		s.addEntry(pid, fmt.Sprintf("%s-%s-%d", a.Class, a.Name, position))
+	}
+	s.SelectPuzzle(pid)
+	return true
+}
+
+// AssignmentResults returns every student's result on every
+// puzzle of an assignment, by student and then position.
+func AssignmentResults(a *Assignment) []*AssignmentResult {
+	var results []*AssignmentResult
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT s.studentName, p.position, p.puzzleId, "+
+				"(SELECT MIN(c.completed) FROM completions c "+
+				"WHERE c.sessionId = s.sessionId AND c.puzzleId = p.puzzleId), "+
+				"(SELECT sc.total FROM scores sc "+
+				"WHERE sc.sessionId = s.sessionId AND sc.puzzleId = p.puzzleId) "+
+				"FROM classStudents s JOIN assignmentPuzzles p ON s.className = p.className "+
+				"WHERE p.className = $1 AND p.assignmentName = $2 "+
+				"ORDER BY s.studentName, p.position", a.Class, a.Name)
+		if err != nil {
+			return fmt.Errorf("Database failure loading results of assignment %q: %v", a.Name, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r AssignmentResult
+			var position int32
+			var completed pgx.NullTime
+			var score pgx.NullInt32
+			if err := rows.Scan(&r.Student, &position, &r.PuzzleId, &completed, &score); err != nil {
+				return fmt.Errorf("Database failure reading results of assignment %q: %v", a.Name, err)
+			}
+			r.Position = int(position)
+			if completed.Valid {
+				r.Completed = &completed.Time
+				r.OnTime = !completed.Time.After(a.Due)
+			}
+			if score.Valid {
+				total := int(score.Int32)
+				r.Score = &total
+			}
+			results = append(results, &r)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return results
+}
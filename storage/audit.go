@@ -0,0 +1,156 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"strings"
+	"time"
+)
+
+/*
+
+audit log
+
+The audit log records administrative and security-relevant
+actions: who did what to what, from where, and when.  Entries are
+only ever appended (the database refuses to change or delete
+them), and the log isn't part of backups, so restoring a backup
+doesn't rewrite history; the restore itself is in the log.
+Actions are dotted names, resource first (library.add,
+session.evict), so operators can select them by prefix.
+
+*/
+
+// Audit log query limits.
+const (
+	defaultAuditCount = 100
+	maxAuditCount     = 1000
+)
+
+// An AuditEntry is one action in the audit log.
+type AuditEntry struct {
+	Id       int64                  `json:"id"`
+	Occurred time.Time              `json:"occurred"`
+	Actor    string                 `json:"actor"`
+	Action   string                 `json:"action"`
+	Target   string                 `json:"target,omitempty"`
+	Address  string                 `json:"address,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// An AuditQuery selects entries from the audit log.  Empty fields
+// don't restrict the search.
+type AuditQuery struct {
+	Actor  string
+	Action string // an action, or a prefix ending in "." (library.)
+	Target string
+	Since  time.Time
+	Until  time.Time // exclusive
+	Count  int       // defaults to 100, at most 1000
+	Offset int
+}
+
+// RecordAudit appends an entry to the audit log, and returns it
+// with its id and time filled in.
+func RecordAudit(actor, action, target, address string, details map[string]interface{}) *AuditEntry {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	e := &AuditEntry{Actor: actor, Action: action, Target: target, Address: address, Details: details}
+	body := func(tx *pgx.Tx) error {
+		err := tx.QueryRow(
+			"INSERT INTO auditLog (actor, action, target, address, details) "+
+				"VALUES ($1, $2, $3, $4, $5) RETURNING auditId, occurred",
+			actor, action, target, address, details).Scan(&e.Id, &e.Occurred)
+		if err != nil {
+			return fmt.Errorf("Database failure recording %s audit entry: %v", action, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return e
+}
+
+// AuditLog returns the audit log entries selected by a query,
+// newest first.
+func AuditLog(q AuditQuery) []*AuditEntry {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.Actor != "" {
+		where = append(where, "actor = "+arg(q.Actor))
+	}
+	if strings.HasSuffix(q.Action, ".") {
+		where = append(where, "action LIKE "+arg(likeEscaper.Replace(q.Action)+"%"))
+	} else if q.Action != "" {
+		where = append(where, "action = "+arg(q.Action))
+	}
+	if q.Target != "" {
+		where = append(where, "target = "+arg(q.Target))
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "occurred >= "+arg(q.Since))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "occurred < "+arg(q.Until))
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = "WHERE " + strings.Join(where, " AND ")
+	}
+	count := q.Count
+	if count <= 0 || count > maxAuditCount {
+		count = defaultAuditCount
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	clause += fmt.Sprintf(" ORDER BY occurred DESC, auditId DESC LIMIT %d OFFSET %d", count, offset)
+
+	var entries []*AuditEntry
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT auditId, occurred, actor, action, target, address, details FROM auditLog "+
+				clause, args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading audit log: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e := &AuditEntry{}
+			if err := rows.Scan(&e.Id, &e.Occurred, &e.Actor, &e.Action,
+				&e.Target, &e.Address, &e.Details); err != nil {
+				return fmt.Errorf("Database failure reading audit log: %v", err)
+			}
+			if len(e.Details) == 0 {
+				e.Details = nil
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return entries
+}
@@ -0,0 +1,207 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/garyburd/redigo/redis"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"time"
+)
+
+/*
+
+backup and restore
+
+A backup is a JSON document holding every row of every data
+table, along with the schema version the rows fit.  Rows are JSON
+objects keyed by column name, as Postgres writes them, so reading
+a backup doesn't need Postgres: any storage that can load JSON
+can take one.  Restoring into Postgres needs the database to be
+at the backup's schema version (so migrate first), and replaces
+all the data in one transaction.  The cache holds nothing that
+isn't in the database, so it's not backed up, and it's cleared by
+a restore.
+
+*/
+
+// BackupFormat is the version of the backup document format.
+const BackupFormat = 1
+
+// A Backup is all the stored data.
+type Backup struct {
+	Format  int           `json:"format"`
+	Schema  int           `json:"schema"`
+	Created time.Time     `json:"created"`
+	Tables  []BackupTable `json:"tables"`
+}
+
+// A BackupTable is all the rows in one table.
+type BackupTable struct {
+	Name string            `json:"name"`
+	Rows []json.RawMessage `json:"rows"`
+}
+
+// backupTables are the data tables, in restore order: every table
+// comes after the tables its rows refer to.  The audit log isn't
+// one of them, since restores mustn't rewrite it.
+var backupTables = []string{
+	"puzzles", "sessions", "solutions", "sessionEntries",
+	"certificates", "saveSlots",
+	"lessons", "lessonExamples", "practiceAttempts",
+	"moveJournal", "scores", "completions",
+	"teachers", "classes", "classStudents", "assignments", "assignmentPuzzles",
+	"calibrations", "timers", "dailies",
+	"tournaments", "tournamentRounds", "tournamentEntrants",
+	"replays", "annotations", "bookmarks", "subscriptions",
+}
+
+// backupSerials are the serial columns, by table, whose sequences
+// have to be moved past the restored rows.
+var backupSerials = map[string]string{
+	"moveJournal":  "moveId",
+	"completions":  "completionId",
+	"calibrations": "calibrationId",
+	"replays":      "replayId",
+	"annotations":  "annotationId",
+	"bookmarks":    "bookmarkId",
+}
+
+// MakeBackup reads all the stored data, in one transaction so
+// the backup is consistent.
+func MakeBackup() *Backup {
+	b := &Backup{Format: BackupFormat, Created: time.Now().UTC()}
+	body := func(tx *pgx.Tx) error {
+		var err error
+		if b.Schema, err = schemaVersion(tx); err != nil {
+			return err
+		}
+		for _, table := range backupTables {
+			bt := BackupTable{Name: table, Rows: []json.RawMessage{}}
+			rows, err := tx.Query("SELECT row_to_json(t)::text FROM " + table + " t")
+			if err != nil {
+				return fmt.Errorf("Database failure backing up %s: %v", table, err)
+			}
+			for rows.Next() {
+				var row string
+				if err := rows.Scan(&row); err != nil {
+					rows.Close()
+					return fmt.Errorf("Database failure reading %s for backup: %v", table, err)
+				}
+				bt.Rows = append(bt.Rows, json.RawMessage(row))
+			}
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("Database failure reading %s for backup: %v", table, err)
+			}
+			b.Tables = append(b.Tables, bt)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return b
+}
+
+// RestoreBackup replaces all the stored data with a backup's, and
+// returns the number of rows restored.  It's an error if the
+// backup's format or schema version doesn't match this server's,
+// or it has a table the server doesn't.  Tables missing from the
+// backup are left empty.
+func RestoreBackup(b *Backup) (int, error) {
+	if b.Format != BackupFormat {
+		return 0, fmt.Errorf("Backup has format %d, expected %d", b.Format, BackupFormat)
+	}
+	tables := make(map[string]BackupTable)
+	for _, bt := range b.Tables {
+		known := false
+		for _, table := range backupTables {
+			known = known || strings.EqualFold(bt.Name, table)
+		}
+		if !known {
+			return 0, fmt.Errorf("Backup has unknown table %q", bt.Name)
+		}
+		tables[strings.ToLower(bt.Name)] = bt
+	}
+	var schema int
+	pgExecute(func(tx *pgx.Tx) (err error) {
+		schema, err = schemaVersion(tx)
+		return
+	})
+	if b.Schema != schema {
+		return 0, fmt.Errorf("Backup has schema version %d, database is at %d", b.Schema, schema)
+	}
+
+	count := 0
+	body := func(tx *pgx.Tx) error {
+		for i := len(backupTables) - 1; i >= 0; i-- {
+			if _, err := tx.Exec("DELETE FROM " + backupTables[i]); err != nil {
+				return fmt.Errorf("Database failure clearing %s for restore: %v", backupTables[i], err)
+			}
+		}
+		for _, table := range backupTables {
+			bt := tables[strings.ToLower(table)]
+			if len(bt.Rows) == 0 {
+				continue
+			}
+			rows, err := json.Marshal(bt.Rows)
+			if err != nil {
+				return fmt.Errorf("Can't encode %s rows for restore: %v", table, err)
+			}
+			_, err = tx.Exec("INSERT INTO "+table+" SELECT * FROM json_populate_recordset(NULL::"+table+", $1::json)",
+				string(rows))
+			if err != nil {
+				return fmt.Errorf("Database failure restoring %s: %v", table, err)
+			}
+			count += len(bt.Rows)
+		}
+		for table, column := range backupSerials {
+			_, err := tx.Exec(fmt.Sprintf(
+				"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+				strings.ToLower(table), strings.ToLower(column), column, table))
+			if err != nil {
+				return fmt.Errorf("Database failure resetting %s sequence: %v", table, err)
+			}
+		}
+		return nil
+	}
+	pgExecute(body)
+
+	// nothing remembered from before the restore is valid
+	rdExecute(func(tx redis.Conn) error {
+		if _, err := tx.Do("FLUSHDB"); err != nil {
+			return fmt.Errorf("Cache error clearing cache after restore: %v", err)
+		}
+		return nil
+	})
+	reloadSampleSession()
+	puzzle.SetRatingBands(puzzle.DefaultRatingBands)
+	RestoreRatingBands()
+	return count, nil
+}
+
+// schemaVersion returns the database's migration version.
+func schemaVersion(tx *pgx.Tx) (int, error) {
+	var version int32
+	if err := tx.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("Database failure reading schema version: %v", err)
+	}
+	return int(version), nil
+}
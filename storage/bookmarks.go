@@ -0,0 +1,205 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+	"time"
+)
+
+/*
+
+bookmarks
+
+Players can bookmark library puzzles and positions in progress
+to come back to later.  A puzzle bookmark opens the puzzle from
+scratch; a position bookmark opens the puzzle with the choices
+made when it was bookmarked, the way restoring a save slot does.
+Opening a bookmark adds its puzzle to the session if it isn't
+there any more.  Bookmarks belong to the session, which is the
+player's identity, so they go wherever the session's cookie goes.
+They're only kept in the database, since they are rarely read.
+
+*/
+
+// maxBookmarkLabelLength is the longest label a bookmark can have.
+const maxBookmarkLabelLength = 50
+
+// A Bookmark is a puzzle, or a position in one, saved for later.
+type Bookmark struct {
+	Id       int             // unique ID for this bookmark
+	PuzzleId string          // the bookmarked puzzle
+	Name     string          // the puzzle's name
+	Label    string          // the player's label for the bookmark
+	Choices  []puzzle.Choice // the position's choices, nil for a puzzle
+	Created  time.Time       // when the bookmark was made
+}
+
+// ValidBookmarkLabel: labels can be empty (the puzzle's name is
+// used instead) but not too long.
+func ValidBookmarkLabel(label string) bool {
+	return len(label) <= maxBookmarkLabelLength
+}
+
+// BookmarkPuzzle bookmarks the library puzzle with the given
+// name.  It returns nil (and bookmarks nothing) if there's no
+// such library puzzle.
+func (s *Session) BookmarkPuzzle(name, label string) *Bookmark {
+	name = strings.ToLower(name)
+	for _, se := range loadSampleSession().entries {
+		if se.PuzzleName == name {
+			return s.addBookmark(se.PuzzleId, se.PuzzleName, label, nil)
+		}
+	}
+	return nil
+}
+
+// BookmarkPosition bookmarks the active puzzle with the choices
+// made in it so far.
+func (s *Session) BookmarkPosition(label string) *Bookmark {
+	se := s.entries[s.active]
+	choices := se.Choices
+	if choices == nil {
+		// an empty position is still a position
+		choices = []int32{}
+	}
+	return s.addBookmark(se.PuzzleId, se.PuzzleName, label, choices)
+}
+
+// addBookmark stores a bookmark for the session.
+func (s *Session) addBookmark(pid, name, label string, choices []int32) *Bookmark {
+	if !ValidBookmarkLabel(label) {
+		panic(fmt.Errorf("Invalid bookmark label: %q", label))
+	}
+	if label == "" {
+		label = name
+	}
+	b := &Bookmark{PuzzleId: pid, Name: name, Label: label, Created: time.Now(), Choices: unpackChoices(choices)}
+	body := func(tx *pgx.Tx) error {
+		var id int64
+		err := tx.QueryRow(
+			"INSERT INTO bookmarks (sessionId, puzzleId, puzzleName, label, choicePairs, created) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) RETURNING bookmarkId",
+			s.sid, pid, name, label, choices, b.Created).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("Database failure saving bookmark for session %q: %v", s.sid, err)
+		}
+		b.Id = int(id)
+		return nil
+	}
+	pgExecute(body)
+	return b
+}
+
+// unpackChoices turns flattened choice pairs into choices,
+// keeping nil as nil.
+func unpackChoices(pairs []int32) []puzzle.Choice {
+	if pairs == nil {
+		return nil
+	}
+	choices := make([]puzzle.Choice, len(pairs)/2)
+	for i := range choices {
+		choices[i] = puzzle.Choice{Index: int(pairs[2*i]), Value: int(pairs[2*i+1])}
+	}
+	return choices
+}
+
+// Bookmarks lists the session's bookmarks, oldest first.
+func (s *Session) Bookmarks() []*Bookmark {
+	bookmarks := []*Bookmark{}
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT bookmarkId, puzzleId, puzzleName, label, choicePairs, created FROM bookmarks "+
+				"WHERE sessionId = $1 ORDER BY created, bookmarkId",
+			s.sid)
+		if err != nil {
+			return fmt.Errorf("Database failure fetching bookmarks for session %q: %v", s.sid, err)
+		}
+		for rows.Next() {
+			var id int64
+			var pairs []int32
+			b := &Bookmark{}
+			if err := rows.Scan(&id, &b.PuzzleId, &b.Name, &b.Label, &pairs, &b.Created); err != nil {
+				rows.Close()
+				return fmt.Errorf("Database failure loading bookmarks for session %q: %v", s.sid, err)
+			}
+			b.Id, b.Choices = int(id), unpackChoices(pairs)
+			bookmarks = append(bookmarks, b)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return bookmarks
+}
+
+// findBookmark returns the session's bookmark with the given id,
+// or nil if it doesn't have one.
+func (s *Session) findBookmark(id int) *Bookmark {
+	for _, b := range s.Bookmarks() {
+		if b.Id == id {
+			return b
+		}
+	}
+	return nil
+}
+
+// RemoveBookmark removes one of the session's bookmarks.  Returns
+// false if the session has no such bookmark.
+func (s *Session) RemoveBookmark(id int) bool {
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"DELETE FROM bookmarks WHERE bookmarkId = $1 AND sessionId = $2",
+			int64(id), s.sid)
+		if err != nil {
+			return fmt.Errorf("Database failure removing bookmark %d for session %q: %v", id, s.sid, err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return removed
+}
+
+// OpenBookmark makes the bookmarked puzzle the active one, adding
+// it to the session if need be.  A puzzle bookmark leaves any
+// choices already made in the puzzle alone; a position bookmark
+// replaces them with the position's.  Returns false (and changes
+// nothing) if the session has no such bookmark.
+func (s *Session) OpenBookmark(id int) bool {
+	b := s.findBookmark(id)
+	if b == nil {
+		return false
+	}
+	if s.findEntry(b.PuzzleId) < 0 {
+		s.addEntry(b.PuzzleId, b.Name)
+	}
+	s.SelectPuzzle(b.PuzzleId)
+	if b.Choices != nil {
+		pairs := make([]int32, 0, 2*len(b.Choices))
+		for _, c := range b.Choices {
+			pairs = append(pairs, int32(c.Index), int32(c.Value))
+		}
+		s.replaceChoices(pairs)
+	}
+	return true
+}
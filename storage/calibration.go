@@ -0,0 +1,354 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"math"
+	"sort"
+	"time"
+)
+
+/*
+
+difficulty calibration
+
+The solver rates puzzles by what it takes to solve them, but
+real solvers are the judges of how hard a puzzle is: how long
+their solves take, and how often they start a puzzle and never
+finish it.  Putting those together gives each puzzle an
+observed effort, the expected solving time per finished solve.
+
+A calibration measures each observed puzzle the way the solver
+does, and rates the measures with candidate rating bands.  The
+bands whose ratings best agree with the order of the observed
+efforts are proposed, and an admin can apply them.  Applied
+bands are recorded, so they're restored when the server starts.
+
+*/
+
+// Calibration limits: a puzzle's effort is only observed once
+// it's been attempted minAttempts times, and bands are only
+// proposed from at least minCalibrationPuzzles observed puzzles.
+const (
+	minAttempts           = 3
+	minCalibrationPuzzles = 5
+)
+
+// The candidate band values a calibration chooses among (along
+// with the current ones).
+var (
+	boundFractionCandidates   = []float64{0.25, 0.5, 0.75, 1, 1.5, 2}
+	wideChoiceCandidates      = []int{2, 3, 4}
+	fiveStarChoicesCandidates = []int{2, 3, 4}
+)
+
+// A PuzzleDifficulty is how hard solvers found a puzzle.
+// Attempts counts the sessions that assigned a square in it, and
+// Seconds are the times from first move to completion of each
+// solve.
+type PuzzleDifficulty struct {
+	PuzzleId string                `json:"puzzleId"`
+	Measure  *puzzle.RatingMeasure `json:"measure"`
+	Attempts int                   `json:"attempts"`
+	Seconds  []float64             `json:"seconds"`
+}
+
+// FailureRate is the fraction of attempts that weren't solved.
+func (pd *PuzzleDifficulty) FailureRate() float64 {
+	if pd.Attempts <= len(pd.Seconds) {
+		return 0
+	}
+	return 1 - float64(len(pd.Seconds))/float64(pd.Attempts)
+}
+
+// effort is the median solve time divided by the fraction of
+// attempts that are solved.  A puzzle nobody has solved takes
+// infinite effort.
+func (pd *PuzzleDifficulty) effort() float64 {
+	if len(pd.Seconds) == 0 {
+		return math.Inf(1)
+	}
+	return median(pd.Seconds) / (1 - pd.FailureRate())
+}
+
+// RatingStats aggregates the observed difficulty of the puzzles
+// with a rating.
+type RatingStats struct {
+	Rating        int     `json:"rating"`
+	Puzzles       int     `json:"puzzles"`
+	Attempts      int     `json:"attempts"`
+	Solves        int     `json:"solves"`
+	FailureRate   float64 `json:"failureRate"`
+	MedianSeconds float64 `json:"medianSeconds"`
+}
+
+// A Calibration compares the current rating bands with the ones
+// that best fit the observed puzzles.  Agreement is the Kendall
+// tau between the bands' ratings and the puzzles' efforts: 1 if
+// they put every pair of puzzles in the same order, -1 if they
+// put every pair in the opposite order.  Ratings are the stats
+// for each rating under the current bands.
+type Calibration struct {
+	Puzzles           int                `json:"puzzles"`
+	Current           puzzle.RatingBands `json:"current"`
+	Agreement         float64            `json:"agreement"`
+	Proposed          puzzle.RatingBands `json:"proposed"`
+	ProposedAgreement float64            `json:"proposedAgreement"`
+	Ratings           []RatingStats      `json:"ratings"`
+}
+
+// Calibrate fits rating bands to the observed puzzles, starting
+// from the current bands.  Puzzles with too few attempts are
+// left out, and with too few puzzles the current bands are
+// proposed.  Ties go to the current bands, so a recalibration
+// never changes them without improving on them.
+func Calibrate(current puzzle.RatingBands, observed []*PuzzleDifficulty) *Calibration {
+	var pds []*PuzzleDifficulty
+	for _, pd := range observed {
+		if pd.Measure != nil && pd.Attempts >= minAttempts {
+			pds = append(pds, pd)
+		}
+	}
+	c := &Calibration{Puzzles: len(pds), Current: current, Proposed: current}
+	c.Agreement = agreement(current, pds)
+	c.ProposedAgreement = c.Agreement
+	c.Ratings = ratingStats(current, pds)
+	if len(pds) < minCalibrationPuzzles {
+		return c
+	}
+	fractions := append([]float64{current.BoundFraction}, boundFractionCandidates...)
+	wides := append([]int{current.WideChoice}, wideChoiceCandidates...)
+	fives := append([]int{current.FiveStarChoices}, fiveStarChoicesCandidates...)
+	for _, fraction := range fractions {
+		for _, wide := range wides {
+			for _, five := range fives {
+				b := puzzle.RatingBands{BoundFraction: fraction, WideChoice: wide, FiveStarChoices: five}
+				if a := agreement(b, pds); a > c.ProposedAgreement {
+					c.Proposed, c.ProposedAgreement = b, a
+				}
+			}
+		}
+	}
+	return c
+}
+
+// agreement is the Kendall tau between the ratings the bands
+// give the puzzles and the puzzles' efforts.  Pairs with the same
+// effort don't count, and pairs with the same rating count as
+// neither agreeing nor disagreeing.
+func agreement(b puzzle.RatingBands, pds []*PuzzleDifficulty) float64 {
+	ratings := make([]int, len(pds))
+	efforts := make([]float64, len(pds))
+	for i, pd := range pds {
+		ratings[i], efforts[i] = pd.Measure.Rating(b), pd.effort()
+	}
+	pairs, score := 0, 0
+	for i := range pds {
+		for j := i + 1; j < len(pds); j++ {
+			if efforts[i] == efforts[j] {
+				continue
+			}
+			pairs++
+			if ratings[i] != ratings[j] && (ratings[i] < ratings[j]) == (efforts[i] < efforts[j]) {
+				score++
+			} else if ratings[i] != ratings[j] {
+				score--
+			}
+		}
+	}
+	if pairs == 0 {
+		return 0
+	}
+	return float64(score) / float64(pairs)
+}
+
+// ratingStats aggregates the puzzles by the ratings the bands
+// give them, in rating order.
+func ratingStats(b puzzle.RatingBands, pds []*PuzzleDifficulty) []RatingStats {
+	byRating := make(map[int]*RatingStats)
+	seconds := make(map[int][]float64)
+	for _, pd := range pds {
+		r := pd.Measure.Rating(b)
+		rs := byRating[r]
+		if rs == nil {
+			rs = &RatingStats{Rating: r}
+			byRating[r] = rs
+		}
+		rs.Puzzles++
+		rs.Attempts += pd.Attempts
+		rs.Solves += len(pd.Seconds)
+		seconds[r] = append(seconds[r], pd.Seconds...)
+	}
+	result := make([]RatingStats, 0, len(byRating))
+	for r, rs := range byRating {
+		if rs.Attempts > rs.Solves {
+			rs.FailureRate = 1 - float64(rs.Solves)/float64(rs.Attempts)
+		}
+		rs.MedianSeconds = median(seconds[r])
+		result = append(result, *rs)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Rating < result[j].Rating })
+	return result
+}
+
+// median returns the median of the values, or 0 if there are
+// none.  The values are sorted in place.
+func median(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	sort.Float64s(vals)
+	mid := len(vals) / 2
+	if len(vals)%2 == 0 {
+		return (vals[mid-1] + vals[mid]) / 2
+	}
+	return vals[mid]
+}
+
+// PuzzleDifficulties gathers the observed difficulty of every
+// puzzle that's been attempted, from the move journals and
+// completions.  Puzzles without a solution have no measure.
+func PuzzleDifficulties() []*PuzzleDifficulty {
+	var pids []string
+	observed := make(map[string]*PuzzleDifficulty)
+	find := func(pid string) *PuzzleDifficulty {
+		pd := observed[pid]
+		if pd == nil {
+			pd = &PuzzleDifficulty{PuzzleId: pid}
+			observed[pid] = pd
+			pids = append(pids, pid)
+		}
+		return pd
+	}
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT puzzleId, count(DISTINCT sessionId) FROM moveJournal "+
+				"WHERE kind = $1 GROUP BY puzzleId ORDER BY puzzleId", AssignMove)
+		if err != nil {
+			return fmt.Errorf("Database failure counting puzzle attempts: %v", err)
+		}
+		for rows.Next() {
+			var pid string
+			var attempts int64
+			if err := rows.Scan(&pid, &attempts); err != nil {
+				rows.Close()
+				return fmt.Errorf("Database failure reading puzzle attempts: %v", err)
+			}
+			find(pid).Attempts = int(attempts)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("Database failure reading puzzle attempts: %v", err)
+		}
+
+		rows, err = tx.Query(
+			"SELECT c.puzzleId, date_part('epoch', c.completed - min(j.made)) " +
+				"FROM completions c JOIN moveJournal j " +
+				"ON j.sessionId = c.sessionId AND j.puzzleId = c.puzzleId AND j.made <= c.completed " +
+				"GROUP BY c.completionId, c.puzzleId, c.completed ORDER BY c.completionId")
+		if err != nil {
+			return fmt.Errorf("Database failure loading solve times: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var pid string
+			var seconds float64
+			if err := rows.Scan(&pid, &seconds); err != nil {
+				return fmt.Errorf("Database failure reading solve times: %v", err)
+			}
+			pd := find(pid)
+			pd.Seconds = append(pd.Seconds, seconds)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+
+	result := make([]*PuzzleDifficulty, 0, len(pids))
+	for _, pid := range pids {
+		pd := observed[pid]
+		if pd.Attempts < len(pd.Seconds) {
+			pd.Attempts = len(pd.Seconds)
+		}
+		if m, err := loadPuzzleEntry(pid).makePuzzle().RatingMeasure(); err == nil {
+			pd.Measure = m
+		}
+		result = append(result, pd)
+	}
+	return result
+}
+
+// CurrentCalibration calibrates the solver's current bands
+// against every observed puzzle.
+func CurrentCalibration() *Calibration {
+	return Calibrate(puzzle.CurrentRatingBands(), PuzzleDifficulties())
+}
+
+// ApplyRatingBands makes the solver rate with the given bands,
+// and records them so they're restored on restart.  The count of
+// puzzles they were fitted to is recorded with them.  It's an
+// error if the bands are invalid.
+func ApplyRatingBands(b puzzle.RatingBands, puzzles int) error {
+	if err := puzzle.SetRatingBands(b); err != nil {
+		return err
+	}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO calibrations (boundFraction, wideChoice, fiveStarChoices, puzzles, applied) "+
+				"VALUES ($1, $2, $3, $4, $5)",
+			b.BoundFraction, b.WideChoice, b.FiveStarChoices, puzzles, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure recording calibration: %v", err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return nil
+}
+
+// RestoreRatingBands makes the solver rate with the latest
+// applied bands, if there are any, and returns the bands in use.
+func RestoreRatingBands() puzzle.RatingBands {
+	var b puzzle.RatingBands
+	found := false
+	body := func(tx *pgx.Tx) error {
+		var wide, five int32
+		err := tx.QueryRow(
+			"SELECT boundFraction, wideChoice, fiveStarChoices FROM calibrations "+
+				"ORDER BY calibrationId DESC LIMIT 1").Scan(&b.BoundFraction, &wide, &five)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading calibration: %v", err)
+		}
+		b.WideChoice, b.FiveStarChoices = int(wide), int(five)
+		found = true
+		return nil
+	}
+	pgExecute(body)
+	if found {
+		if err := puzzle.SetRatingBands(b); err != nil {
+			panic(fmt.Errorf("Invalid calibration in database: %v", err))
+		}
+	}
+	return puzzle.CurrentRatingBands()
+}
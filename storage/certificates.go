@@ -0,0 +1,112 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"time"
+)
+
+/*
+
+TLS certificate cache
+
+*/
+
+// ErrCertMiss is returned by CertCache.Get when there is no saved
+// data for the given key.
+var ErrCertMiss = errors.New("storage: certificate cache miss")
+
+// A CertCache saves the certificates and keys obtained by an
+// ACME client in the database, so that they survive restarts
+// and are shared by all server instances.  Its method set
+// matches the Cache interface of the autocert package.
+//
+// Unlike the rest of this package, CertCache methods return
+// errors rather than panicking, because their caller is the
+// TLS machinery rather than a request handler.
+type CertCache struct{}
+
+// Get returns the data saved under the given key, or ErrCertMiss.
+func (CertCache) Get(ctx context.Context, key string) (data []byte, err error) {
+	body := func(tx *pgx.Tx) error {
+		row := tx.QueryRow("SELECT certData FROM certificates WHERE certKey = $1", key)
+		err := row.Scan(&data)
+		if err == pgx.ErrNoRows {
+			data = nil
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading certificate %q: %v", key, err)
+		}
+		return nil
+	}
+	if err = catchPanic(func() { pgExecute(body) }); err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrCertMiss
+	}
+	return data, nil
+}
+
+// Put saves data under the given key, replacing any existing data.
+func (CertCache) Put(ctx context.Context, key string, data []byte) error {
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO certificates (certKey, certData, updated) VALUES ($1, $2, $3) "+
+				"ON CONFLICT (certKey) DO UPDATE SET (certData, updated) = ($2, $3)",
+			key, data, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure saving certificate %q: %v", key, err)
+		}
+		return nil
+	}
+	return catchPanic(func() { pgExecute(body) })
+}
+
+// Delete removes any data saved under the given key.
+func (CertCache) Delete(ctx context.Context, key string) error {
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec("DELETE FROM certificates WHERE certKey = $1", key)
+		if err != nil {
+			return fmt.Errorf("Database failure deleting certificate %q: %v", key, err)
+		}
+		return nil
+	}
+	return catchPanic(func() { pgExecute(body) })
+}
+
+// catchPanic runs fn, converting any panic into an error.
+func catchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("Caught panic: %v", r)
+			}
+		}
+	}()
+	fn()
+	return nil
+}
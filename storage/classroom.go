@@ -0,0 +1,297 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"time"
+)
+
+/*
+
+classrooms
+
+A teacher has classes, and students join a class from their
+sessions, under the name the teacher will see them by.  Teachers
+sign in with a bearer token, made when the teacher is added;
+only a hash of it is stored.  The teacher's view of a class is
+the live progress of each student's active puzzle.
+
+Class and teacher names follow the rules for lesson names.
+
+*/
+
+// A Class is a teacher's class and its students, by name.
+type Class struct {
+	Name     string    `json:"name"`
+	Teacher  string    `json:"teacher"`
+	Title    string    `json:"title"`
+	Created  time.Time `json:"created"`
+	Students []string  `json:"students"`
+}
+
+// A StudentProgress describes how a student is doing on their
+// active puzzle.  Hints and mistakes are those journaled for the
+// puzzle, and the student is stuck for the time since their last
+// move, unless the puzzle is complete.
+type StudentProgress struct {
+	Student    string        `json:"student"`
+	PuzzleId   string        `json:"puzzleId"`
+	PuzzleName string        `json:"puzzleName"`
+	Values     []int         `json:"values"`
+	Choices    int           `json:"choices"`
+	Remaining  int           `json:"remaining"`
+	Hints      int           `json:"hints"`
+	Mistakes   int           `json:"mistakes"`
+	LastMove   time.Time     `json:"lastMove"`
+	Stuck      time.Duration `json:"stuck"`
+}
+
+// tokenHash returns the stored form of a teacher token.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddTeacher: add a teacher, returning their new token, or ""
+// if there's already a teacher with that name.  Panics on an
+// invalid name.
+func AddTeacher(name string) string {
+	if !ValidLessonName(name) {
+		panic(fmt.Errorf("Invalid teacher name: %q", name))
+	}
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(fmt.Errorf("Failed to make token for teacher %q: %v", name, err))
+	}
+	token := hex.EncodeToString(bytes)
+	added := false
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"INSERT INTO teachers (teacherName, tokenHash, created) VALUES ($1, $2, $3) "+
+				"ON CONFLICT (teacherName) DO NOTHING",
+			name, tokenHash(token), time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure adding teacher %q: %v", name, err)
+		}
+		added = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	if !added {
+		return ""
+	}
+	return token
+}
+
+// FindTeacher returns the name of the teacher with the given
+// token, or "" if there is none.
+func FindTeacher(token string) string {
+	var name string
+	body := func(tx *pgx.Tx) error {
+		err := tx.QueryRow("SELECT teacherName FROM teachers WHERE tokenHash = $1",
+			tokenHash(token)).Scan(&name)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure finding teacher: %v", err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return name
+}
+
+// AddClass: add a class for a teacher.  Returns false if there's
+// already a class with that name.  Panics on an invalid name.
+func AddClass(teacher, name, title string) bool {
+	if !ValidLessonName(name) {
+		panic(fmt.Errorf("Invalid class name: %q", name))
+	}
+	added := false
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"INSERT INTO classes (className, teacherName, title, created) VALUES ($1, $2, $3, $4) "+
+				"ON CONFLICT (className) DO NOTHING",
+			name, teacher, title, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure adding class %q: %v", name, err)
+		}
+		added = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return added
+}
+
+// TeacherClasses returns a teacher's classes, in name order.
+func TeacherClasses(teacher string) []*Class {
+	return loadClasses("teacherName", teacher)
+}
+
+// FindClass returns the named class, or nil if there is none.
+func FindClass(name string) *Class {
+	if cs := loadClasses("className", name); len(cs) > 0 {
+		return cs[0]
+	}
+	return nil
+}
+
+// loadClasses loads the classes whose column has the given value,
+// with their students in name order.
+func loadClasses(column, value string) []*Class {
+	var classes []*Class
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT c.className, c.teacherName, c.title, c.created, s.studentName "+
+				"FROM classes c LEFT JOIN classStudents s ON c.className = s.className "+
+				"WHERE c."+column+" = $1 ORDER BY c.className, s.studentName", value)
+		if err != nil {
+			return fmt.Errorf("Database failure loading classes by %s %q: %v", column, value, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var c Class
+			var student pgx.NullString
+			if err := rows.Scan(&c.Name, &c.Teacher, &c.Title, &c.Created, &student); err != nil {
+				return fmt.Errorf("Database failure reading classes by %s %q: %v", column, value, err)
+			}
+			if len(classes) == 0 || classes[len(classes)-1].Name != c.Name {
+				c.Students = []string{}
+				classes = append(classes, &c)
+			}
+			if student.Valid {
+				last := classes[len(classes)-1]
+				last.Students = append(last.Students, student.String)
+			}
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return classes
+}
+
+// JoinClass: add the session to the named class as the named
+// student, or rename the student if the session is already in
+// the class.  Returns false if there's no such class or another
+// student has the name.
+func (s *Session) JoinClass(class, student string) bool {
+	if FindClass(class) == nil {
+		return false
+	}
+	joined := false
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"INSERT INTO classStudents (className, sessionId, studentName, joined) "+
+				"VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+			class, s.sid, student, time.Now())
+		if err == nil && tag.RowsAffected() == 0 {
+			tag, err = tx.Exec(
+				"UPDATE classStudents SET studentName = $3 WHERE className = $1 AND sessionId = $2 "+
+					"AND NOT EXISTS (SELECT 1 FROM classStudents "+
+					"WHERE className = $1 AND studentName = $3 AND sessionId <> $2)",
+				class, s.sid, student)
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure adding session %q to class %q: %v", s.sid, class, err)
+		}
+		joined = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return joined
+}
+
+// StudentSession loads the session of the named student in the
+// class, or returns nil if there's no such student.
+func StudentSession(class, student string) *Session {
+	var sid string
+	body := func(tx *pgx.Tx) error {
+		err := tx.QueryRow(
+			"SELECT sessionId FROM classStudents WHERE className = $1 AND studentName = $2",
+			class, student).Scan(&sid)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure finding student %q in class %q: %v", student, class, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	if sid == "" {
+		return nil
+	}
+	return LoadSession(sid)
+}
+
+// ClassProgress returns the progress of each student in the
+// class, in name order.
+func ClassProgress(class *Class) []*StudentProgress {
+	progress := make([]*StudentProgress, 0, len(class.Students))
+	for _, student := range class.Students {
+		if s := StudentSession(class.Name, student); s != nil {
+			progress = append(progress, s.progress(student, time.Now()))
+		}
+	}
+	return progress
+}
+
+// progress: describe how the session is doing on its active
+// puzzle, as of the given time.
+func (s *Session) progress(student string, now time.Time) *StudentProgress {
+	sp := &StudentProgress{
+		Student:    student,
+		PuzzleId:   s.Info.PuzzleId,
+		PuzzleName: s.Info.Name,
+		Choices:    len(s.Info.Choices),
+		Remaining:  s.Info.Remaining,
+		LastMove:   s.Info.LastView,
+	}
+	if summary, err := s.Puzzle.Summary(); err == nil {
+		sp.Values = summary.Values
+	}
+	moves := s.Moves()
+	for _, m := range moves {
+		switch {
+		case m.Kind == HintMove:
+			sp.Hints++
+		case m.Mistake:
+			sp.Mistakes++
+		}
+	}
+	if len(moves) > 0 {
+		sp.LastMove = moves[len(moves)-1].Made
+	}
+	if sp.Remaining > 0 {
+		sp.Stuck = now.Sub(sp.LastMove)
+	}
+	return sp
+}
+
+// ValidStudentName: student names have to be non-empty and not
+// too long.
+func ValidStudentName(name string) bool {
+	return name != "" && len(name) <= maxSlotNameLength
+}
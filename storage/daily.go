@@ -0,0 +1,483 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+daily puzzles
+
+Each day features one library puzzle at each difficulty rating
+the library has puzzles for.  A day's puzzles are chosen when the
+day is published: a puzzle an admin queued for the day takes
+precedence at its rating, and otherwise the puzzle comes from a
+rotation through the library puzzles with that rating, in name
+order.  Days are counted in UTC, so all instances agree on the
+puzzles of the day.  Published days are recorded, so the archive
+of past days doesn't change when the library or the rating bands
+do.
+
+*/
+
+// A DailyPuzzle is the library puzzle featured on a given day at
+// a given rating.
+type DailyPuzzle struct {
+	Date   time.Time   // midnight UTC at the start of the day
+	Rating int         // the difficulty it's featured at
+	Info   *PuzzleInfo // the featured puzzle
+	Values []int       // the featured puzzle's starting values
+}
+
+// dailyRatings is the range of ratings with a daily puzzle.
+const (
+	minDailyRating = 1
+	maxDailyRating = 5
+)
+
+// DailyDate returns the start of the (UTC) day containing the
+// given time.
+func DailyDate(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// DailyPuzzles returns the daily puzzles for the count days
+// ending with the one containing the given time, most recent day
+// first and easiest first within a day.  Days up to the current
+// one are published as a side effect; later days are previews,
+// which may change before they are published.
+func DailyPuzzles(day time.Time, count int) []*DailyPuzzle {
+	day = DailyDate(day)
+	today := DailyDate(time.Now())
+	var dailies []*DailyPuzzle
+	for i := 0; i < count; i++ {
+		date := day.AddDate(0, 0, -i)
+		set, _ := dailySet(date, !date.After(today))
+		dailies = append(dailies, set...)
+	}
+	return dailies
+}
+
+// PublishDailies publishes the puzzles for the day containing the
+// given time, if they haven't been already, and returns the ones
+// that this call published.
+func PublishDailies(now time.Time) []*DailyPuzzle {
+	_, fresh := dailySet(DailyDate(now), true)
+	return fresh
+}
+
+// IsDailyPuzzle reports whether the puzzle is one of the puzzles
+// of the day containing the given time.
+func IsDailyPuzzle(t time.Time, pid string) bool {
+	for _, d := range DailyPuzzles(t, 1) {
+		if d.Info.PuzzleId == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// dailySet returns the puzzles for the given date, along with the
+// ones that were published by this call.  If publish is false,
+// nothing is recorded, and ratings without a queued puzzle are
+// filled from the rotation.
+func dailySet(date time.Time, publish bool) (set, fresh []*DailyPuzzle) {
+	rotation := dailyRotation(date)
+	type row struct {
+		pid, name string
+		fresh     bool
+	}
+	rows := make(map[int]*row)
+	body := func(tx *pgx.Tx) error {
+		published := make(map[int]bool)
+		if publish {
+			now := time.Now()
+			for rating, info := range rotation {
+				tag, err := tx.Exec(
+					"INSERT INTO dailies (day, rating, puzzleId, puzzleName, published) "+
+						"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (day, rating) DO NOTHING",
+					date, rating, info.PuzzleId, info.Name, now)
+				if err != nil {
+					return fmt.Errorf("Database failure publishing daily puzzle for %v: %v", date, err)
+				}
+				published[rating] = tag.RowsAffected() > 0
+			}
+			queued, err := tx.Query(
+				"UPDATE dailies SET published = $2 WHERE day = $1 AND published IS NULL RETURNING rating",
+				date, now)
+			if err != nil {
+				return fmt.Errorf("Database failure publishing queued puzzles for %v: %v", date, err)
+			}
+			defer queued.Close()
+			for queued.Next() {
+				var rating int32
+				if err := queued.Scan(&rating); err != nil {
+					return fmt.Errorf("Database failure reading queued puzzles for %v: %v", date, err)
+				}
+				published[int(rating)] = true
+			}
+			if err := queued.Err(); err != nil {
+				return err
+			}
+			queued.Close()
+		}
+		rs, err := tx.Query("SELECT rating, puzzleId, puzzleName FROM dailies WHERE day = $1", date)
+		if err != nil {
+			return fmt.Errorf("Database failure loading daily puzzles for %v: %v", date, err)
+		}
+		defer rs.Close()
+		for rs.Next() {
+			var rating int32
+			r := &row{}
+			if err := rs.Scan(&rating, &r.pid, &r.name); err != nil {
+				return fmt.Errorf("Database failure reading daily puzzles for %v: %v", date, err)
+			}
+			r.fresh = published[int(rating)]
+			rows[int(rating)] = r
+		}
+		return rs.Err()
+	}
+	pgExecute(body)
+
+	for rating := minDailyRating; rating <= maxDailyRating; rating++ {
+		r := rows[rating]
+		if r == nil {
+			info := rotation[rating]
+			if info == nil {
+				continue
+			}
+			r = &row{pid: info.PuzzleId, name: info.Name}
+		}
+		d := makeDailyPuzzle(date, rating, r.pid, r.name)
+		set = append(set, d)
+		if r.fresh {
+			fresh = append(fresh, d)
+		}
+	}
+	return
+}
+
+// dailyRotation returns the library puzzle at each rating that
+// the rotation features on the given date.
+func dailyRotation(date time.Time) map[int]*PuzzleInfo {
+	infos := LibraryPuzzles()
+	sort.Sort(ByName(infos))
+	byRating := make(map[int][]*PuzzleInfo)
+	for _, info := range infos {
+		rating := libraryRating(info.PuzzleId)
+		byRating[rating] = append(byRating[rating], info)
+	}
+	rotation := make(map[int]*PuzzleInfo)
+	for rating, candidates := range byRating {
+		if rating >= minDailyRating && rating <= maxDailyRating {
+			rotation[rating] = candidates[dayNumber(date)%len(candidates)]
+		}
+	}
+	return rotation
+}
+
+// library puzzle ratings, which only change with the rating
+// bands, so we remember them for the bands in use.
+var (
+	libraryRatingMutex sync.Mutex
+	libraryRatingBands puzzle.RatingBands
+	libraryRatings     = make(map[string]int)
+)
+
+// libraryRating returns the current rating of a stored puzzle.
+func libraryRating(pid string) int {
+	libraryRatingMutex.Lock()
+	defer libraryRatingMutex.Unlock()
+	if bands := puzzle.CurrentRatingBands(); bands != libraryRatingBands {
+		libraryRatingBands = bands
+		libraryRatings = make(map[string]int)
+	}
+	if rating, ok := libraryRatings[pid]; ok {
+		return rating
+	}
+	rating := puzzleRating(loadPuzzleEntry(pid))
+	libraryRatings[pid] = rating
+	return rating
+}
+
+// makeDailyPuzzle fills in a daily puzzle from its stored entry.
+// Puzzles no longer in the library keep the name they were
+// featured under.
+func makeDailyPuzzle(date time.Time, rating int, pid, name string) *DailyPuzzle {
+	info, values := featuredPuzzle(pid, name)
+	return &DailyPuzzle{Date: date, Rating: rating, Info: info, Values: values}
+}
+
+// featuredPuzzle returns the info and starting values of a stored
+// puzzle featured under the given name.
+func featuredPuzzle(pid, name string) (*PuzzleInfo, []int) {
+	pe := loadPuzzleEntry(pid)
+	values := make([]int, len(pe.Values))
+	for j, v := range pe.Values {
+		values[j] = int(v)
+	}
+	return &PuzzleInfo{PuzzleId: pid, Name: name, Geometry: pe.Geometry, SideLength: int(pe.SideLength)}, values
+}
+
+// dailyDate converts a date read from the database, which pgx
+// gives in local time, to midnight UTC.
+func dailyDate(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// dayNumber counts the days from the Unix epoch to the given day.
+func dayNumber(day time.Time) int {
+	return int(day.Unix() / (24 * 60 * 60))
+}
+
+/*
+
+archive and queue
+
+*/
+
+// DailyArchive returns the published daily puzzles for the count
+// most recent published days before the one containing the given
+// time, most recent day first and easiest first within a day.
+func DailyArchive(before time.Time, count int) []*DailyPuzzle {
+	return loadDailies(
+		"SELECT day, rating, puzzleId, puzzleName FROM dailies "+
+			"WHERE published IS NOT NULL AND day IN "+
+			"(SELECT DISTINCT day FROM dailies WHERE published IS NOT NULL AND day < $1 "+
+			"ORDER BY day DESC LIMIT $2) ORDER BY day DESC, rating",
+		DailyDate(before), count)
+}
+
+// QueuedDailies returns the puzzles queued for days that haven't
+// been published, earliest first.
+func QueuedDailies() []*DailyPuzzle {
+	return loadDailies(
+		"SELECT day, rating, puzzleId, puzzleName FROM dailies " +
+			"WHERE published IS NULL ORDER BY day, rating")
+}
+
+// loadDailies runs a query for daily puzzle rows.
+func loadDailies(query string, args ...interface{}) []*DailyPuzzle {
+	type row struct {
+		date      time.Time
+		rating    int
+		pid, name string
+	}
+	var rows []row
+	body := func(tx *pgx.Tx) error {
+		rs, err := tx.Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading daily puzzles: %v", err)
+		}
+		defer rs.Close()
+		for rs.Next() {
+			var r row
+			var rating int32
+			if err := rs.Scan(&r.date, &rating, &r.pid, &r.name); err != nil {
+				return fmt.Errorf("Database failure reading daily puzzles: %v", err)
+			}
+			r.date, r.rating = dailyDate(r.date), int(rating)
+			rows = append(rows, r)
+		}
+		return rs.Err()
+	}
+	pgExecute(body)
+	dailies := make([]*DailyPuzzle, len(rows))
+	for i, r := range rows {
+		dailies[i] = makeDailyPuzzle(r.date, r.rating, r.pid, r.name)
+	}
+	return dailies
+}
+
+// QueueDaily queues the named library puzzle to be featured at
+// its rating on the day containing the given time, replacing any
+// puzzle already queued there.  Only days after the current one
+// can be queued.
+func QueueDaily(day time.Time, name string) (*DailyPuzzle, error) {
+	date := DailyDate(day)
+	if !date.After(DailyDate(time.Now())) {
+		return nil, fmt.Errorf("Can't queue a puzzle for %s, which has been published",
+			date.Format("2006-01-02"))
+	}
+	info := findLibraryPuzzle(name)
+	if info == nil {
+		return nil, fmt.Errorf("There is no library puzzle named %q", name)
+	}
+	rating := libraryRating(info.PuzzleId)
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO dailies (day, rating, puzzleId, puzzleName) VALUES ($1, $2, $3, $4) "+
+				"ON CONFLICT (day, rating) DO UPDATE SET puzzleId = $3, puzzleName = $4 "+
+				"WHERE dailies.published IS NULL",
+			date, rating, info.PuzzleId, info.Name)
+		if err != nil {
+			return fmt.Errorf("Database failure queueing %q for %v: %v", name, date, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return makeDailyPuzzle(date, rating, info.PuzzleId, info.Name), nil
+}
+
+// findLibraryPuzzle returns the info of the library puzzle with
+// the given name (in any case), or nil if there's none.
+func findLibraryPuzzle(name string) *PuzzleInfo {
+	name = strings.ToLower(name)
+	for _, info := range LibraryPuzzles() {
+		if info.Name == name {
+			return info
+		}
+	}
+	return nil
+}
+
+// UnqueueDaily removes the puzzle queued at the given rating on
+// the day containing the given time, reporting whether there was
+// one.
+func UnqueueDaily(day time.Time, rating int) bool {
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec("DELETE FROM dailies WHERE day = $1 AND rating = $2 AND published IS NULL",
+			DailyDate(day), rating)
+		if err != nil {
+			return fmt.Errorf("Database failure unqueueing daily puzzle: %v", err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return removed
+}
+
+/*
+
+leaderboards
+
+Each published daily puzzle has a leaderboard of the sessions
+that completed it on its day, ranked by hints taken, then by
+solving time, then by when they finished.  Only a session's first
+completion counts.  Sessions are identified by a tag derived from
+the session ID, which can't be used to recover it.
+
+*/
+
+// A LeaderboardEntry is one session's place on a leaderboard.
+// Completions recorded before solving was timed have no elapsed
+// time, and rank after those that do.
+type LeaderboardEntry struct {
+	Rank      int           `json:"rank"`
+	Player    string        `json:"player"`
+	Self      bool          `json:"self,omitempty"`
+	Hints     int           `json:"hints"`
+	Elapsed   time.Duration `json:"elapsed,omitempty"`
+	Completed time.Time     `json:"completed"`
+}
+
+// DailyLeaderboard returns the top count entries on the
+// leaderboard for the daily puzzle at the given rating on the day
+// containing the given time.  The entry for the given session is
+// marked, and is added at the end if it's not in the top count.
+func DailyLeaderboard(day time.Time, rating int, sid string, count int) []LeaderboardEntry {
+	date := DailyDate(day)
+	var entries []LeaderboardEntry
+	var sids []string
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT c.sessionId, c.hints, c.elapsed, c.completed FROM completions c "+
+				"JOIN dailies d ON c.puzzleId = d.puzzleId "+
+				"WHERE d.day = $1 AND d.rating = $2 AND d.published IS NOT NULL "+
+				"AND c.daily AND c.completed >= $3 AND c.completed < $4 "+
+				"ORDER BY c.completed, c.completionId",
+			date, rating, date, date.AddDate(0, 0, 1))
+		if err != nil {
+			return fmt.Errorf("Database failure loading leaderboard for %v: %v", date, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e LeaderboardEntry
+			var csid string
+			var hints int32
+			var elapsed pgx.NullInt64
+			if err := rows.Scan(&csid, &hints, &elapsed, &e.Completed); err != nil {
+				return fmt.Errorf("Database failure reading leaderboard for %v: %v", date, err)
+			}
+			e.Hints = int(hints)
+			e.Elapsed = time.Duration(elapsed.Int64) * time.Millisecond
+			entries, sids = append(entries, e), append(sids, csid)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return rankLeaderboard(entries, sids, sid, count)
+}
+
+// rankLeaderboard ranks completions, given in completion order
+// with the sessions that made them, keeping each session's first
+// completion.  Ties share a rank.  It returns the top count
+// entries, plus the given session's entry if it's further down.
+func rankLeaderboard(entries []LeaderboardEntry, sids []string, sid string, count int) []LeaderboardEntry {
+	seen := make(map[string]bool)
+	var ranked []LeaderboardEntry
+	for i, e := range entries {
+		if seen[sids[i]] {
+			continue
+		}
+		seen[sids[i]] = true
+		e.Player, e.Self = PlayerTag(sids[i]), sids[i] == sid
+		ranked = append(ranked, e)
+	}
+	before := func(a, b LeaderboardEntry) bool {
+		if a.Hints != b.Hints {
+			return a.Hints < b.Hints
+		}
+		if (a.Elapsed == 0) != (b.Elapsed == 0) {
+			return b.Elapsed == 0
+		}
+		return a.Elapsed < b.Elapsed
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return before(ranked[i], ranked[j]) })
+	var board []LeaderboardEntry
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+		if i > 0 && !before(ranked[i-1], ranked[i]) {
+			ranked[i].Rank = ranked[i-1].Rank
+		}
+		if i < count || ranked[i].Self {
+			board = append(board, ranked[i])
+		}
+	}
+	return board
+}
+
+// PlayerTag returns the public name of a session on leaderboards,
+// standings and brackets.
+func PlayerTag(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return "player-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,78 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"time"
+)
+
+/*
+
+scanned puzzles
+
+Puzzles scanned from print (see puzzle.ReviewGrid) are stored
+like any other puzzle and added to the scanning session under
+the next "scan-" name.  Scanning a puzzle the session already
+has just makes it active again.
+
+*/
+
+// AddScannedPuzzle stores a scanned puzzle, adds it to the
+// session if need be, and makes it the active puzzle with no
+// choices made.  The summary must describe a valid puzzle.
+func (s *Session) AddScannedPuzzle(summary *puzzle.Summary) {
+	p, err := puzzle.New(&puzzle.Summary{
+		Geometry: summary.Geometry, SideLength: summary.SideLength, Values: summary.Values,
+	})
+	if err != nil {
+		panic(fmt.Errorf("Invalid scanned puzzle: %v", err))
+	}
+	hash, err := p.Hash()
+	if err != nil {
+		panic(fmt.Errorf("Failed to hash scanned puzzle: %v", err))
+	}
+	pe := &puzzleEntry{
+		PuzzleId:   string(hash),
+		Geometry:   summary.Geometry,
+		SideLength: int32(summary.SideLength),
+		Values:     make([]int32, len(summary.Values)),
+	}
+	for i, v := range summary.Values {
+		pe.Values[i] = int32(v)
+	}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO puzzles (puzzleId, geometry, sideLength, valueList, created) "+
+				"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (puzzleId) DO NOTHING",
+			pe.PuzzleId, pe.Geometry, pe.SideLength, pe.Values, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database error saving scanned puzzle %q: %v", pe.PuzzleId, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	if s.findEntry(pe.PuzzleId) < 0 {
+		s.addEntry(pe.PuzzleId, s.nextPuzzleName("scan-"))
+	}
+	s.SelectPuzzle(pe.PuzzleId)
+	s.RemoveAllSteps()
+}
@@ -0,0 +1,355 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+
+lessons
+
+A lesson teaches one solving technique.  It has an explanation
+of the technique and a series of example puzzles, each with the
+goals a student must reach by using the technique: the squares
+it fills and the values that go in them.  Lessons are kept in
+the database next to the library, and are only read when a
+student asks for them, so they aren't cached.
+
+Starting a lesson example adds its puzzle to the student's
+session (under a name derived from the lesson) if it isn't
+already there, and then makes it the active puzzle with no
+choices made.
+
+*/
+
+// A Lesson is a stored lesson.
+type Lesson struct {
+	Name        string           `json:"name"`
+	Technique   string           `json:"technique"`
+	Title       string           `json:"title"`
+	Explanation string           `json:"explanation"`
+	Examples    []*LessonExample `json:"examples"`
+}
+
+// A LessonExample is one of a lesson's example puzzles.  When
+// adding a lesson, the example's Summary gives its puzzle; when
+// reading one, its PuzzleId does.
+type LessonExample struct {
+	PuzzleId string          `json:"puzzleId,omitempty"`
+	Summary  *puzzle.Summary `json:"summary,omitempty"`
+	Goals    []puzzle.Choice `json:"goals"` // the assignments the student must make
+}
+
+// lessonNameRegexp: lesson names go into URLs and puzzle names,
+// so they are lowercase words joined by hyphens.
+var lessonNameRegexp = regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$")
+
+// ValidLessonName: lesson names have to be lowercase words joined
+// by hyphens, and not too long.
+func ValidLessonName(name string) bool {
+	return len(name) <= maxSlotNameLength && lessonNameRegexp.MatchString(name)
+}
+
+// LessonPuzzleName returns the session name for the puzzle of a
+// lesson's example, given its 1-based position.
+func LessonPuzzleName(lesson string, example int) string {
+	return fmt.Sprintf("lesson-%s-%d", lesson, example)
+}
+
+// Accepts reports whether the puzzle meets the example's goals:
+// whether every goal square has been assigned its goal value.
+func (le *LessonExample) Accepts(p *puzzle.Puzzle) bool {
+	state, err := p.State()
+	if err != nil || len(state.Errors) > 0 {
+		return false
+	}
+	for _, goal := range le.Goals {
+		if goal.Index < 1 || goal.Index > len(state.Squares) ||
+			state.Squares[goal.Index-1].Aval != goal.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Lessons returns all the stored lessons, in name order.
+func Lessons() []*Lesson {
+	var lessons []*Lesson
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT lessonName, technique, title, explanation FROM lessons ORDER BY lessonName")
+		if err != nil {
+			return fmt.Errorf("Failed to list lessons: %v", err)
+		}
+		for rows.Next() {
+			l := &Lesson{}
+			if err := rows.Scan(&l.Name, &l.Technique, &l.Title, &l.Explanation); err != nil {
+				return fmt.Errorf("Failure reading lesson list: %v", err)
+			}
+			lessons = append(lessons, l)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, l := range lessons {
+			if err := l.databaseLoadExamples(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	pgExecute(body)
+	return lessons
+}
+
+// FindLesson returns the named lesson, or nil if there's no such
+// lesson.
+func FindLesson(name string) *Lesson {
+	name = strings.ToLower(name)
+	var l *Lesson
+	body := func(tx *pgx.Tx) error {
+		found := &Lesson{Name: name}
+		row := tx.QueryRow(
+			"SELECT technique, title, explanation FROM lessons WHERE lessonName = $1", name)
+		err := row.Scan(&found.Technique, &found.Title, &found.Explanation)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading lesson %q: %v", name, err)
+		}
+		if err := found.databaseLoadExamples(tx); err != nil {
+			return err
+		}
+		l = found
+		return nil
+	}
+	pgExecute(body)
+	return l
+}
+
+// databaseLoadExamples: load a lesson's examples, in order.
+func (l *Lesson) databaseLoadExamples(tx *pgx.Tx) error {
+	rows, err := tx.Query(
+		"SELECT puzzleId, goalPairs FROM lessonExamples "+
+			"WHERE lessonName = $1 ORDER BY position", l.Name)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch examples for lesson %q: %v", l.Name, err)
+	}
+	defer rows.Close()
+	l.Examples = nil
+	for rows.Next() {
+		le := &LessonExample{}
+		var pairs []int32
+		if err := rows.Scan(&le.PuzzleId, &pairs); err != nil {
+			return fmt.Errorf("Failure loading examples for lesson %q: %v", l.Name, err)
+		}
+		le.Goals = make([]puzzle.Choice, len(pairs)/2)
+		for i := range le.Goals {
+			le.Goals[i] = puzzle.Choice{Index: int(pairs[2*i]), Value: int(pairs[2*i+1])}
+		}
+		l.Examples = append(l.Examples, le)
+	}
+	return rows.Err()
+}
+
+// AddLesson stores a new lesson.  The name must be valid and not
+// already used, and each example must have a valid puzzle and at
+// least one goal, on an empty square, with a value that's
+// possible there.  It returns the lesson as stored.
+func AddLesson(l *Lesson) *Lesson {
+	name := strings.ToLower(l.Name)
+	if !ValidLessonName(name) {
+		panic(fmt.Errorf("Invalid lesson name: %q", l.Name))
+	}
+	if len(l.Examples) == 0 {
+		panic(fmt.Errorf("Lesson %q has no examples", name))
+	}
+	entries := make([]*puzzleEntry, len(l.Examples))
+	goals := make([][]int32, len(l.Examples))
+	for i, le := range l.Examples {
+		entries[i], goals[i] = makeLessonExample(name, i+1, le)
+	}
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"INSERT INTO lessons (lessonName, technique, title, explanation, created) "+
+				"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (lessonName) DO NOTHING",
+			name, l.Technique, l.Title, l.Explanation, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database error saving lesson %q: %v", name, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("There is already a lesson %q", name)
+		}
+		for i, pe := range entries {
+			_, err := tx.Exec(
+				"INSERT INTO puzzles (puzzleId, geometry, sideLength, valueList, created) "+
+					"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (puzzleId) DO NOTHING",
+				pe.PuzzleId, pe.Geometry, pe.SideLength, pe.Values, time.Now())
+			if err != nil {
+				return fmt.Errorf("Database error saving lesson %q example %d: %v", name, i+1, err)
+			}
+			_, err = tx.Exec(
+				"INSERT INTO lessonExamples (lessonName, position, puzzleId, goalPairs) "+
+					"VALUES ($1, $2, $3, $4)",
+				name, i+1, pe.PuzzleId, goals[i])
+			if err != nil {
+				return fmt.Errorf("Database error adding example %d to lesson %q: %v", i+1, name, err)
+			}
+		}
+		return nil
+	}
+	pgExecute(body)
+	return FindLesson(name)
+}
+
+// makeLessonExample checks a new lesson example, and returns its
+// puzzle entry and flattened goals.
+func makeLessonExample(name string, position int, le *LessonExample) (*puzzleEntry, []int32) {
+	if le.Summary == nil {
+		panic(fmt.Errorf("Lesson %q example %d has no puzzle", name, position))
+	}
+	p, err := puzzle.New(le.Summary)
+	if err != nil {
+		panic(fmt.Errorf("Invalid puzzle in lesson %q example %d: %v", name, position, err))
+	}
+	hash, err := p.Hash()
+	if err != nil {
+		panic(fmt.Errorf("Failed to hash lesson %q example %d: %v", name, position, err))
+	}
+	if len(le.Goals) == 0 {
+		panic(fmt.Errorf("Lesson %q example %d has no goals", name, position))
+	}
+	state, err := p.State()
+	if err != nil {
+		panic(fmt.Errorf("Failed to get state of lesson %q example %d: %v", name, position, err))
+	}
+	goals := make([]int32, 0, 2*len(le.Goals))
+	for _, goal := range le.Goals {
+		if goal.Index < 1 || goal.Index > len(state.Squares) {
+			panic(fmt.Errorf("Lesson %q example %d has a goal off the grid: %v", name, position, goal))
+		}
+		sq := state.Squares[goal.Index-1]
+		if sq.Aval != 0 || !possible(sq.Pvals, goal.Value) {
+			panic(fmt.Errorf("Lesson %q example %d has an impossible goal: %v", name, position, goal))
+		}
+		goals = append(goals, int32(goal.Index), int32(goal.Value))
+	}
+	pe := &puzzleEntry{
+		PuzzleId:   string(hash),
+		Geometry:   le.Summary.Geometry,
+		SideLength: int32(le.Summary.SideLength),
+		Values:     make([]int32, len(le.Summary.Values)),
+	}
+	for i, v := range le.Summary.Values {
+		pe.Values[i] = int32(v)
+	}
+	return pe, goals
+}
+
+// possible reports whether a value is among a square's possible
+// values.
+func possible(pvals []int, value int) bool {
+	for _, v := range pvals {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveLesson removes the named lesson.  Sessions that already
+// have its example puzzles keep them.  It returns whether there
+// was such a lesson.
+func RemoveLesson(name string) bool {
+	name = strings.ToLower(name)
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec("DELETE FROM lessons WHERE lessonName = $1", name)
+		if err != nil {
+			return fmt.Errorf("Database error removing lesson %q: %v", name, err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return removed
+}
+
+// StartLesson: make the puzzle of a lesson's example (given by
+// its 1-based position) the active puzzle, with no choices made,
+// adding it to the session first if need be.  Returns false (and
+// changes nothing) if the lesson has no such example.
+func (s *Session) StartLesson(l *Lesson, example int) bool {
+	if example < 1 || example > len(l.Examples) {
+		return false
+	}
+	pid := l.Examples[example-1].PuzzleId
+	if s.findEntry(pid) < 0 {
+		s.addEntry(pid, LessonPuzzleName(l.Name, example))
+	}
+	s.SelectPuzzle(pid)
+	s.RemoveAllSteps()
+	return true
+}
+
+// findEntry returns the index of the session's entry for a
+// puzzle, or -1 if the session doesn't have the puzzle.
+func (s *Session) findEntry(pid string) int {
+	for i, se := range s.entries {
+		if se.PuzzleId == pid {
+			return i
+		}
+	}
+	return -1
+}
+
+// addEntry adds a stored puzzle to the session under the given
+// name, with no choices made.  The puzzle doesn't become active.
+// If the session already has as many puzzles as it's allowed (see
+// SetSessionPuzzleLimit), this panics with a quota-exceeded
+// puzzle.Error instead.
+func (s *Session) addEntry(pid, name string) {
+	if max := int(sessionPuzzleLimit.Load()); max > 0 && len(s.entries) >= max {
+		panic(puzzle.QuotaError(puzzle.SessionPuzzlesLimit, max))
+	}
+	se := &sessionEntry{PuzzleId: pid, PuzzleName: name, LastView: time.Now()}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO sessionEntries "+
+				"(sessionId, puzzleId, puzzleName, choicePairs, lastView) "+
+				"VALUES ($1, $2, $3, $4, $5);",
+			s.sid, se.PuzzleId, se.PuzzleName, se.Choices, se.LastView)
+		if err != nil {
+			return fmt.Errorf("Database error adding puzzle %q to session %q: %v", name, s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	s.entries = append(s.entries, se)
+	s.cacheSaveEntries()
+}
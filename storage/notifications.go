@@ -0,0 +1,274 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"sort"
+	"time"
+)
+
+/*
+
+notification subscriptions
+
+Sessions subscribe to hear about topics (new puzzles of the day,
+assignments coming due, tournament rounds starting) over a
+channel (email, webhook, push) at an address on that channel.
+There's one subscription per topic and channel, so subscribing
+again just changes the address.  Which channels exist is up to
+the server; storage only keeps what sessions asked for.
+
+Assignment reminders and round start alerts are claimed the way
+round results are: marked as sent by whichever server gets to
+them first, so each goes out once.
+
+*/
+
+// Notification topics.
+const (
+	DailyTopic      = "daily"       // puzzles of the day are published
+	AssignmentTopic = "assignments" // an assignment is coming due
+	TournamentTopic = "tournaments" // a round of an entered tournament starts
+)
+
+// maxAddressLength is the longest address a subscription can have.
+const maxAddressLength = 200
+
+// ValidTopic: is this a topic sessions can subscribe to?
+func ValidTopic(topic string) bool {
+	return topic == DailyTopic || topic == AssignmentTopic || topic == TournamentTopic
+}
+
+// ValidSubscriptionAddress: addresses have to be non-empty and
+// not too long.  What else makes them valid depends on the channel.
+func ValidSubscriptionAddress(address string) bool {
+	return address != "" && len(address) <= maxAddressLength
+}
+
+// A Subscription is a session's request to hear about a topic.
+type Subscription struct {
+	Topic   string    `json:"topic"`
+	Channel string    `json:"channel"`
+	Address string    `json:"address"`
+	Created time.Time `json:"created"`
+}
+
+// A Recipient is where to send one subscriber a notification.
+type Recipient struct {
+	SessionId string
+	Channel   string
+	Address   string
+}
+
+// Subscribe subscribes the session to a topic over a channel,
+// replacing the address of any earlier subscription to both.
+func (s *Session) Subscribe(topic, channel, address string) *Subscription {
+	if !ValidTopic(topic) || channel == "" || !ValidSubscriptionAddress(address) {
+		panic(fmt.Errorf("Invalid subscription to %q over %q at %q", topic, channel, address))
+	}
+	sub := &Subscription{Topic: topic, Channel: channel, Address: address, Created: time.Now()}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO subscriptions (sessionId, topic, channel, address, created) "+
+				"VALUES ($1, $2, $3, $4, $5) "+
+				"ON CONFLICT (sessionId, topic, channel) "+
+				"DO UPDATE SET (address, created) = ($4, $5)",
+			s.sid, topic, channel, address, sub.Created)
+		if err != nil {
+			return fmt.Errorf("Database failure subscribing session %q to %q: %v", s.sid, topic, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return sub
+}
+
+// Unsubscribe removes the session's subscription to a topic over
+// a channel.  Returns false if there is no such subscription.
+func (s *Session) Unsubscribe(topic, channel string) bool {
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"DELETE FROM subscriptions WHERE sessionId = $1 AND topic = $2 AND channel = $3",
+			s.sid, topic, channel)
+		if err != nil {
+			return fmt.Errorf("Database failure unsubscribing session %q from %q: %v", s.sid, topic, err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return removed
+}
+
+// Subscriptions lists the session's subscriptions, by topic and
+// channel.
+func (s *Session) Subscriptions() []*Subscription {
+	subs := []*Subscription{}
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT topic, channel, address, created FROM subscriptions "+
+				"WHERE sessionId = $1 ORDER BY topic, channel",
+			s.sid)
+		if err != nil {
+			return fmt.Errorf("Database failure fetching subscriptions for session %q: %v", s.sid, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			sub := &Subscription{}
+			if err := rows.Scan(&sub.Topic, &sub.Channel, &sub.Address, &sub.Created); err != nil {
+				return fmt.Errorf("Database failure reading subscriptions for session %q: %v", s.sid, err)
+			}
+			subs = append(subs, sub)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return subs
+}
+
+// Subscribers returns where to notify every subscriber to a topic.
+func Subscribers(topic string) []Recipient {
+	return loadRecipients("", topic)
+}
+
+// ClassSubscribers returns where to notify the students of a class
+// who subscribed to assignment reminders.
+func ClassSubscribers(class string) []Recipient {
+	return loadRecipients(
+		"JOIN classStudents c ON s.sessionId = c.sessionId AND c.className = $2",
+		AssignmentTopic, class)
+}
+
+// TournamentSubscribers returns where to notify the entrants of a
+// tournament who subscribed to tournament alerts.
+func TournamentSubscribers(tournament string) []Recipient {
+	return loadRecipients(
+		"JOIN tournamentEntrants e ON s.sessionId = e.sessionId AND e.tournamentName = $2",
+		TournamentTopic, tournament)
+}
+
+// loadRecipients loads the subscribers to a topic (the first
+// argument) from the subscriptions joined as given.
+func loadRecipients(join string, args ...interface{}) []Recipient {
+	var rs []Recipient
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT s.sessionId, s.channel, s.address FROM subscriptions s "+join+
+				" WHERE s.topic = $1 ORDER BY s.sessionId, s.channel", args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading subscribers to %q: %v", args[0], err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r Recipient
+			if err := rows.Scan(&r.SessionId, &r.Channel, &r.Address); err != nil {
+				return fmt.Errorf("Database failure reading subscribers to %q: %v", args[0], err)
+			}
+			rs = append(rs, r)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return rs
+}
+
+// RemindAssignments marks the assignments coming due between now
+// and the given lead time later as reminded, and returns them,
+// soonest due first.  Each assignment is returned only once, even
+// with several servers calling.
+func RemindAssignments(now time.Time, lead time.Duration) []*Assignment {
+	type key struct{ class, name string }
+	var keys []key
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"UPDATE assignments SET reminderSent = $1 "+
+				"WHERE due > $1 AND due <= $2 AND reminderSent IS NULL "+
+				"RETURNING className, assignmentName",
+			now, now.Add(lead))
+		if err != nil {
+			return fmt.Errorf("Database failure claiming assignment reminders: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var k key
+			if err := rows.Scan(&k.class, &k.name); err != nil {
+				return fmt.Errorf("Database failure reading assignment reminders: %v", err)
+			}
+			keys = append(keys, k)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	var as []*Assignment
+	for _, k := range keys {
+		if a := FindAssignment(k.class, k.name); a != nil {
+			as = append(as, a)
+		}
+	}
+	sort.SliceStable(as, func(i, j int) bool { return as[i].Due.Before(as[j].Due) })
+	return as
+}
+
+// A StartedRound is a tournament round whose start has just been
+// announced.
+type StartedRound struct {
+	Tournament string
+	Round      *TournamentRound
+}
+
+// StartRounds marks the rounds that started by the given time,
+// and haven't ended or had their start announced, as announced,
+// and returns them with their puzzles, in order of their starts.
+// Each round is returned only once, even with several servers
+// calling.
+func StartRounds(now time.Time) []*StartedRound {
+	var started []*StartedRound
+	var pids, names []string
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"UPDATE tournamentRounds SET startSent = $1 "+
+				"WHERE starts <= $1 AND ends > $1 AND startSent IS NULL "+
+				"RETURNING tournamentName, round, puzzleId, puzzleName, starts, ends",
+			now)
+		if err != nil {
+			return fmt.Errorf("Database failure starting tournament rounds: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var round int32
+			var pid, name string
+			sr := &StartedRound{Round: &TournamentRound{}}
+			if err := rows.Scan(&sr.Tournament, &round, &pid, &name, &sr.Round.Starts, &sr.Round.Ends); err != nil {
+				return fmt.Errorf("Database failure reading started rounds: %v", err)
+			}
+			sr.Round.Round = int(round)
+			started, pids, names = append(started, sr), append(pids, pid), append(names, name)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	for i, sr := range started {
+		sr.Round.Info, sr.Round.Values = featuredPuzzle(pids[i], names[i])
+	}
+	sort.SliceStable(started, func(i, j int) bool { return started[i].Round.Starts.Before(started[j].Round.Starts) })
+	return started
+}
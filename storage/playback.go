@@ -0,0 +1,113 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"github.com/ancientHacker/susen.go/puzzle"
+	"reflect"
+	"time"
+)
+
+/*
+
+playback
+
+A solve can be reviewed move by move by replaying its move
+journal.  The playback starts with the puzzle's State and then
+has a frame for each move, timed from the first move.  Each
+frame has the squares that the move changed (along with all the
+puzzle's errors after it), so applying the frames in order to
+the starting State gives the puzzle as the player saw it after
+each move.  Frames are overlaid with the choice hinted, for a
+hint, and whether an assign was a mistake: either it put a wrong
+value in the square or it made the puzzle unsolvable.
+
+*/
+
+// A Playback is a timed replay of a puzzle's move journal.
+type Playback struct {
+	PuzzleId string           `json:"puzzleId"`
+	Start    *puzzle.Content  `json:"start"`
+	Frames   []*PlaybackFrame `json:"frames"`
+}
+
+// A PlaybackFrame is the effect of one move in a playback.
+type PlaybackFrame struct {
+	Kind    string          `json:"kind"`
+	Offset  time.Duration   `json:"offset"`
+	Choice  *puzzle.Choice  `json:"choice,omitempty"` // the choice assigned
+	Hint    *puzzle.Choice  `json:"hint,omitempty"`   // the choice hinted
+	Mistake bool            `json:"mistake"`
+	Diff    *puzzle.Content `json:"diff"`
+}
+
+// PlayMoves makes the playback of a move journal, given the
+// puzzle's starting state and (if known) its solution values.
+func PlayMoves(pid string, start *puzzle.Puzzle, solution []int, moves []Move) *Playback {
+	first, _ := start.State()
+	pb := &Playback{PuzzleId: pid, Start: first, Frames: []*PlaybackFrame{}}
+	prior := first
+	replayMoves(start, moves, nil, func(m Move, p *puzzle.Puzzle) {
+		state, _ := p.State()
+		f := &PlaybackFrame{
+			Kind:   m.Kind,
+			Offset: m.Made.Sub(moves[0].Made),
+			Diff:   diffContent(prior, state),
+		}
+		choice := m.Choice
+		switch m.Kind {
+		case AssignMove:
+			f.Choice = &choice
+			f.Mistake = m.Mistake
+			if i := choice.Index; i >= 1 && i <= len(solution) && solution[i-1] != choice.Value {
+				f.Mistake = true
+			}
+		case HintMove:
+			if choice.Index != 0 {
+				f.Hint = &choice
+			}
+		}
+		pb.Frames = append(pb.Frames, f)
+		prior = state
+	})
+	return pb
+}
+
+// diffContent returns the squares that changed from one state to
+// the next, along with the next state's errors.
+func diffContent(prior, next *puzzle.Content) *puzzle.Content {
+	diff := &puzzle.Content{Squares: []puzzle.Square{}, Errors: next.Errors}
+	for i, sq := range next.Squares {
+		if i >= len(prior.Squares) || !reflect.DeepEqual(sq, prior.Squares[i]) {
+			diff.Squares = append(diff.Squares, sq)
+		}
+	}
+	return diff
+}
+
+// Playback returns the playback of the active puzzle's move
+// journal.
+func (s *Session) Playback() *Playback {
+	start := loadPuzzleEntry(s.Info.PuzzleId).makePuzzle()
+	var solution []int
+	if sols, err := start.Solutions(); err == nil && len(sols) > 0 {
+		solution = sols[0].Values
+	}
+	return PlayMoves(s.Info.PuzzleId, start, solution, s.Moves())
+}
@@ -0,0 +1,333 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+
+practice
+
+A practice puzzle exercises one technique: it's a library puzzle
+advanced, by rounds of easy placements, to a point where the
+only easy placements left are ones that need the technique.
+Those placements are its key deductions.  The practice puzzle's
+givens are the library puzzle's values at that point, so it's
+stored as a puzzle of its own and added to the session.
+
+Each practice puzzle served to a session is recorded with its
+key deductions, so we can tell whether the student made one of
+them unaided or asked for a hint first.
+
+*/
+
+// practiceTechniques maps the names of the techniques that can
+// be practiced to the difficulty tier of their placements.
+var practiceTechniques = map[string]puzzle.DifficultyTier{
+	"naked-single":  puzzle.SingleTier,
+	"hidden-single": puzzle.BoundTier,
+}
+
+// maxPracticeRounds bounds the rounds of easy placements made
+// while looking for a practice puzzle.
+const maxPracticeRounds = 100
+
+// PracticeTechniques returns the names of the techniques that
+// can be practiced, in order.
+func PracticeTechniques() []string {
+	names := make([]string, 0, len(practiceTechniques))
+	for name := range practiceTechniques {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidTechnique reports whether the named technique can be
+// practiced.
+func ValidTechnique(name string) bool {
+	_, ok := practiceTechniques[name]
+	return ok
+}
+
+// A PracticeStatus tells how a practice puzzle is going.
+type PracticeStatus struct {
+	Technique string          `json:"technique"`
+	Found     bool            `json:"found"`  // a key deduction has been made
+	Hinted    bool            `json:"hinted"` // a hint came before any key deduction
+	Started   time.Time       `json:"started"`
+	keys      []puzzle.Choice // the key deductions
+}
+
+// A Hint is an easy placement for the student to make.
+type Hint struct {
+	Choice    puzzle.Choice `json:"choice"`
+	Technique string        `json:"technique"`
+}
+
+// easyPlacements returns the placements in the puzzle that can be
+// made with each practice technique, keyed by technique name.
+func easyPlacements(p *puzzle.Puzzle) map[string][]puzzle.Choice {
+	ds, err := p.Difficulties()
+	if err != nil {
+		return nil
+	}
+	state, err := p.State()
+	if err != nil {
+		return nil
+	}
+	placements := make(map[string][]puzzle.Choice)
+	for _, d := range ds {
+		sq := state.Squares[d.Index-1]
+		switch d.Tier {
+		case puzzle.SingleTier:
+			placements["naked-single"] = append(placements["naked-single"],
+				puzzle.Choice{Index: d.Index, Value: sq.Pvals[0]})
+		case puzzle.BoundTier:
+			placements["hidden-single"] = append(placements["hidden-single"],
+				puzzle.Choice{Index: d.Index, Value: sq.Bval})
+		}
+	}
+	return placements
+}
+
+// practiceState advances the puzzle by rounds of easy placements
+// until the only ones left need the technique.  It returns the
+// puzzle's values at that point and the key deductions, or nil
+// if it never gets to such a point.
+func practiceState(p *puzzle.Puzzle, technique string) ([]int, []puzzle.Choice) {
+	for round := 0; round < maxPracticeRounds; round++ {
+		placements := easyPlacements(p)
+		if len(placements) == 0 {
+			return nil, nil
+		}
+		if keys := placements[technique]; len(keys) > 0 && len(placements) == 1 {
+			summary, err := p.Summary()
+			if err != nil {
+				return nil, nil
+			}
+			return summary.Values, keys
+		}
+		for _, choices := range placements {
+			for _, choice := range choices {
+				if _, err := p.Assign(choice); err != nil {
+					return nil, nil
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// StartPractice: find a practice puzzle for the technique in the
+// library, trying the library puzzles in random order, and make
+// it the active puzzle with no choices made.  Returns false (and
+// changes nothing) if no library puzzle has a point that needs
+// the technique.
+func (s *Session) StartPractice(technique string, rng *rand.Rand) bool {
+	if !ValidTechnique(technique) {
+		panic(fmt.Errorf("Unknown practice technique: %q", technique))
+	}
+	infos := LibraryPuzzles()
+	for _, i := range rng.Perm(len(infos)) {
+		pe := loadPuzzleEntry(infos[i].PuzzleId)
+		values, keys := practiceState(pe.makePuzzle(), technique)
+		if values != nil {
+			s.startPractice(technique, pe, values, keys)
+			return true
+		}
+	}
+	return false
+}
+
+// startPractice: store a practice puzzle made from the given
+// library puzzle entry and values, add it to the session if need
+// be, and record it as served.
+func (s *Session) startPractice(technique string, lpe *puzzleEntry, values []int, keys []puzzle.Choice) {
+	summary := &puzzle.Summary{Geometry: lpe.Geometry, SideLength: int(lpe.SideLength), Values: values}
+	hash, err := summary.Hash()
+	if err != nil {
+		panic(fmt.Errorf("Failed to hash practice puzzle: %v", err))
+	}
+	pe := &puzzleEntry{
+		PuzzleId:   string(hash),
+		Geometry:   lpe.Geometry,
+		SideLength: lpe.SideLength,
+		Values:     make([]int32, len(values)),
+	}
+	for i, v := range values {
+		pe.Values[i] = int32(v)
+	}
+	pairs := make([]int32, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, int32(key.Index), int32(key.Value))
+	}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO puzzles (puzzleId, geometry, sideLength, valueList, created) "+
+				"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (puzzleId) DO NOTHING",
+			pe.PuzzleId, pe.Geometry, pe.SideLength, pe.Values, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database error saving practice puzzle %q: %v", pe.PuzzleId, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	if s.findEntry(pe.PuzzleId) < 0 {
+		s.addEntry(pe.PuzzleId, s.practicePuzzleName(technique))
+	}
+	body = func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO practiceAttempts (sessionId, puzzleId, technique, keyPairs, hinted, started) "+
+				"VALUES ($1, $2, $3, $4, false, $5) "+
+				"ON CONFLICT (sessionId, puzzleId) "+
+				"DO UPDATE SET (technique, keyPairs, hinted, started) = ($3, $4, false, $5)",
+			s.sid, pe.PuzzleId, technique, pairs, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure recording practice for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	s.SelectPuzzle(pe.PuzzleId)
+	s.RemoveAllSteps()
+}
+
+// practicePuzzleName returns a name for the next practice puzzle
+// for the technique in the session.
+func (s *Session) practicePuzzleName(technique string) string {
+	return s.nextPuzzleName("practice-" + technique + "-")
+}
+
+// nextPuzzleName returns the name, made from the given prefix and
+// a number, for the next puzzle of its kind in the session.
+func (s *Session) nextPuzzleName(prefix string) string {
+	count := 0
+	for _, se := range s.entries {
+		if strings.HasPrefix(se.PuzzleName, prefix) {
+			count++
+		}
+	}
+	return fmt.Sprintf("%s%d", prefix, count+1)
+}
+
+// Practice returns the status of the active puzzle as a practice
+// puzzle, or nil if it wasn't served for practice.
+func (s *Session) Practice() *PracticeStatus {
+	ps := &PracticeStatus{}
+	var pairs []int32
+	found := false
+	body := func(tx *pgx.Tx) error {
+		row := tx.QueryRow(
+			"SELECT technique, keyPairs, hinted, started FROM practiceAttempts "+
+				"WHERE sessionId = $1 AND puzzleId = $2",
+			s.sid, s.Info.PuzzleId)
+		err := row.Scan(&ps.Technique, &pairs, &ps.Hinted, &ps.Started)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading practice for session %q: %v", s.sid, err)
+		}
+		found = true
+		return nil
+	}
+	pgExecute(body)
+	if !found {
+		return nil
+	}
+	ps.keys = make([]puzzle.Choice, len(pairs)/2)
+	for i := range ps.keys {
+		ps.keys[i] = puzzle.Choice{Index: int(pairs[2*i]), Value: int(pairs[2*i+1])}
+		for _, choice := range s.Info.Choices {
+			if choice == ps.keys[i] {
+				ps.Found = true
+			}
+		}
+	}
+	return ps
+}
+
+// Hint returns an easy placement for the active puzzle, or nil
+// if there isn't one.  For a practice puzzle, the hint is one of
+// the key deductions not yet made and, if none has been made,
+// the practice is marked as hinted.  Hints given are journaled,
+// since they count against the score.
+func (s *Session) Hint() *Hint {
+	hint := s.findHint()
+	if hint != nil {
+		s.journalMove(Move{Kind: HintMove, Choice: hint.Choice, Made: time.Now()})
+	}
+	return hint
+}
+
+// findHint finds the hint to give for the active puzzle.
+func (s *Session) findHint() *Hint {
+	if ps := s.Practice(); ps != nil {
+		if !ps.Found && !ps.Hinted {
+			s.markHinted()
+		}
+		for _, key := range ps.keys {
+			if !s.assigned(key.Index) {
+				return &Hint{Choice: key, Technique: ps.Technique}
+			}
+		}
+	}
+	placements := easyPlacements(s.Puzzle)
+	for _, technique := range PracticeTechniques() {
+		if choices := placements[technique]; len(choices) > 0 {
+			return &Hint{Choice: choices[0], Technique: technique}
+		}
+	}
+	return nil
+}
+
+// assigned reports whether a choice has been made for the square
+// in the active puzzle.
+func (s *Session) assigned(index int) bool {
+	for _, choice := range s.Info.Choices {
+		if choice.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// markHinted: record that a hint was given for the active
+// practice puzzle before any key deduction was made.
+func (s *Session) markHinted() {
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"UPDATE practiceAttempts SET hinted = true WHERE sessionId = $1 AND puzzleId = $2",
+			s.sid, s.Info.PuzzleId)
+		if err != nil {
+			return fmt.Errorf("Database failure recording hint for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+}
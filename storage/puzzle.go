@@ -55,6 +55,7 @@ func (s *Session) AddStep(choice puzzle.Choice) {
 	// update the state of the session and the step cache
 	s.addStep()
 	s.Info = s.makePuzzleInfo(s.active)
+	s.journalMove(Move{Kind: AssignMove, Choice: choice, Mistake: s.assignIsMistake(), Made: se.LastView})
 }
 
 // RemoveStep: remove the last step and restore the prior step in
@@ -74,6 +75,7 @@ func (s *Session) RemoveStep() {
 	s.removeStep()
 	s.loadLastStep()
 	s.Info = s.makePuzzleInfo(s.active)
+	s.journalMove(Move{Kind: UndoMove, Made: se.LastView})
 }
 
 // RemoveAllSteps: remove all the steps from the current puzzle
@@ -92,6 +94,7 @@ func (s *Session) RemoveAllSteps() {
 	// update the state of the step cache
 	s.loadActivePuzzle()
 	s.Info = s.makePuzzleInfo(s.active)
+	s.journalMove(Move{Kind: ResetMove, Made: se.LastView})
 }
 
 /*
@@ -335,6 +338,7 @@ func (s *Session) loadLastStep() {
 	}
 	rdExecute(body)
 	s.Puzzle = s.unmarshalPuzzle(bytes)
+	s.attachAnnotations()
 }
 
 // addStep: add a new step to the cache
@@ -378,6 +382,7 @@ func (s *Session) constructActivePuzzle() {
 	// then create and insert the sequence of steps
 	choices := s.entries[s.active].Choices
 	s.Puzzle = loadPuzzleEntry(s.entries[s.active].PuzzleId).makePuzzle()
+	s.attachAnnotations()
 	s.addStep()
 	for j := 0; j < len(choices); j = j + 2 {
 		choice := puzzle.Choice{Index: int(choices[j]), Value: int(choices[j+1])}
@@ -387,6 +392,9 @@ func (s *Session) constructActivePuzzle() {
 		}
 		s.addStep()
 	}
+	if errs := s.Puzzle.Validate(); errs != nil {
+		panic(fmt.Errorf("Constructed puzzle fails validation: %v", errs))
+	}
 }
 
 // marshalPuzzle: serialize a puzzle as JSON
@@ -0,0 +1,289 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+
+replays
+
+A session that has completed its active puzzle can publish the
+solve to the replay library, under a title of its choosing, so
+others can study it.  Publishing takes a snapshot of the puzzle's
+move journal, along with the solve's score and time, so later
+play on the puzzle doesn't change the published replay; a
+session publishing the same puzzle again replaces its earlier
+replay.  Replays show their players by tag, not session, and can
+be browsed by puzzle, searched by title or puzzle name, and
+played back frame by frame like a session's own playback.
+
+*/
+
+// Replay library limits.
+const (
+	maxReplayTitleLength = 80
+	defaultReplayCount   = 20
+	maxReplayCount       = 100
+)
+
+// Replay orders.
+const (
+	RecentReplays = "recent" // newest first
+	BestReplays   = "best"   // highest score first
+)
+
+// A Replay is a published solve in the replay library.
+type Replay struct {
+	Id        int64         `json:"id"`
+	Title     string        `json:"title"`
+	PuzzleId  string        `json:"puzzleId"`
+	Puzzle    string        `json:"puzzle"` // the name it was solved under
+	Rating    int           `json:"rating"`
+	Player    string        `json:"player"`
+	Self      bool          `json:"self,omitempty"`
+	Total     int           `json:"total"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Moves     int           `json:"moves"`
+	Published time.Time     `json:"published"`
+}
+
+// A ReplayQuery selects replays from the library.  Empty fields
+// don't restrict the search.
+type ReplayQuery struct {
+	Puzzle    string // the puzzle's name, exactly
+	Text      string // found in the title or puzzle name, ignoring case
+	MinRating int
+	Order     string // RecentReplays (the default) or BestReplays
+	Count     int    // at most maxReplayCount, default defaultReplayCount
+	Offset    int
+}
+
+// ValidReplayTitle reports whether a replay title is acceptable:
+// non-blank, not too long, and printable.
+func ValidReplayTitle(title string) bool {
+	if strings.TrimSpace(title) == "" || utf8.RuneCountInString(title) > maxReplayTitleLength {
+		return false
+	}
+	for _, r := range title {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublishReplay publishes the session's solve of its active
+// puzzle, which must be completed, to the replay library.
+func (s *Session) PublishReplay(title string) (*Replay, error) {
+	title = strings.TrimSpace(title)
+	if !ValidReplayTitle(title) {
+		return nil, fmt.Errorf("Invalid replay title %q", title)
+	}
+	if s.Info.Remaining != 0 {
+		return nil, fmt.Errorf("Puzzle %q isn't completed", s.Info.Name)
+	}
+	var completed time.Time
+	var elapsed pgx.NullInt64
+	body := func(tx *pgx.Tx) error {
+		err := tx.QueryRow(
+			"SELECT completed, elapsed FROM completions WHERE sessionId = $1 AND puzzleId = $2 "+
+				"ORDER BY completed DESC LIMIT 1", s.sid, s.Info.PuzzleId).Scan(&completed, &elapsed)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading completion for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	if completed.IsZero() {
+		return nil, fmt.Errorf("Puzzle %q has no recorded completion", s.Info.Name)
+	}
+	pe := loadPuzzleEntry(s.Info.PuzzleId)
+	moves := s.Moves()
+	var sc *Score
+	if elapsed.Valid {
+		sc = ScoreTimed(puzzleRating(pe), countZeroes(pe.Values), moves, time.Duration(elapsed.Int64)*time.Millisecond)
+	} else {
+		sc = ScoreMoves(puzzleRating(pe), countZeroes(pe.Values), moves, completed)
+	}
+	rp := &Replay{
+		Title:     title,
+		PuzzleId:  s.Info.PuzzleId,
+		Puzzle:    s.Info.Name,
+		Rating:    sc.Rating,
+		Player:    PlayerTag(s.sid),
+		Self:      true,
+		Total:     sc.Total,
+		Elapsed:   sc.Elapsed,
+		Moves:     len(moves),
+		Published: time.Now(),
+	}
+	body = func(tx *pgx.Tx) error {
+		err := tx.QueryRow(
+			"INSERT INTO replays "+
+				"(sessionId, puzzleId, puzzleName, title, rating, total, elapsed, moves, published) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) "+
+				"ON CONFLICT (sessionId, puzzleId) DO UPDATE SET "+
+				"(puzzleName, title, rating, total, elapsed, moves, published) = "+
+				"(EXCLUDED.puzzleName, EXCLUDED.title, EXCLUDED.rating, EXCLUDED.total, "+
+				"EXCLUDED.elapsed, EXCLUDED.moves, EXCLUDED.published) "+
+				"RETURNING replayId",
+			s.sid, rp.PuzzleId, rp.Puzzle, rp.Title, rp.Rating, rp.Total,
+			int64(rp.Elapsed/time.Millisecond), moves, rp.Published).Scan(&rp.Id)
+		if err != nil {
+			return fmt.Errorf("Database failure publishing replay for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return rp, nil
+}
+
+// UnpublishReplay removes one of the session's own replays from
+// the library, reporting whether there was one to remove.
+func (s *Session) UnpublishReplay(id int64) bool {
+	return deleteReplays("WHERE replayId = $1 AND sessionId = $2", id, s.sid) > 0
+}
+
+// DeleteReplay removes a replay from the library, reporting
+// whether there was one to remove.
+func DeleteReplay(id int64) bool {
+	return deleteReplays("WHERE replayId = $1", id) > 0
+}
+
+// deleteReplays: delete the replays selected by a where clause,
+// returning how many were deleted.
+func deleteReplays(where string, args ...interface{}) int64 {
+	var count int64
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec("DELETE FROM replays "+where, args...)
+		if err != nil {
+			return fmt.Errorf("Database failure deleting replays: %v", err)
+		}
+		count = tag.RowsAffected()
+		return nil
+	}
+	pgExecute(body)
+	return count
+}
+
+// Replays returns the library replays that match a query, marking
+// those published by the given session as its own.
+func Replays(q ReplayQuery, sid string) []*Replay {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.Puzzle != "" {
+		where = append(where, "puzzleName = "+arg(q.Puzzle))
+	}
+	if q.Text != "" {
+		pattern := "%" + likeEscaper.Replace(q.Text) + "%"
+		p := arg(pattern)
+		where = append(where, "(title ILIKE "+p+" OR puzzleName ILIKE "+p+")")
+	}
+	if q.MinRating > 0 {
+		where = append(where, "rating >= "+arg(q.MinRating))
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = "WHERE " + strings.Join(where, " AND ")
+	}
+	order := "published DESC, replayId DESC"
+	if q.Order == BestReplays {
+		order = "total DESC, elapsed, replayId"
+	}
+	count := q.Count
+	if count <= 0 || count > maxReplayCount {
+		count = defaultReplayCount
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	clause += fmt.Sprintf(" ORDER BY %s LIMIT %d OFFSET %d", order, count, offset)
+	replays, _ := loadReplays(sid, clause, args...)
+	return replays
+}
+
+// likeEscaper escapes the LIKE wildcards in search text.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// FindReplay returns a library replay, and the playback of its
+// moves, marking it as the given session's own if it is.  Both
+// are nil if there's no such replay.
+func FindReplay(id int64, sid string) (*Replay, *Playback) {
+	replays, moves := loadReplays(sid, "WHERE replayId = $1", id)
+	if len(replays) == 0 {
+		return nil, nil
+	}
+	rp := replays[0]
+	start := loadPuzzleEntry(rp.PuzzleId).makePuzzle()
+	var solution []int
+	if sols, err := start.Solutions(); err == nil && len(sols) > 0 {
+		solution = sols[0].Values
+	}
+	return rp, PlayMoves(rp.PuzzleId, start, solution, moves[0])
+}
+
+// loadReplays: load the replays selected by a where (and order)
+// clause, along with their moves.
+func loadReplays(sid string, clause string, args ...interface{}) ([]*Replay, [][]Move) {
+	var replays []*Replay
+	var moves [][]Move
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT replayId, sessionId, puzzleId, puzzleName, title, rating, total, elapsed, "+
+				"moves, published FROM replays "+clause, args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading replays: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			rp := &Replay{}
+			var owner string
+			var rating, total int32
+			var elapsed int64
+			var ms []Move
+			if err := rows.Scan(&rp.Id, &owner, &rp.PuzzleId, &rp.Puzzle, &rp.Title,
+				&rating, &total, &elapsed, &ms, &rp.Published); err != nil {
+				return fmt.Errorf("Database failure reading replays: %v", err)
+			}
+			rp.Player, rp.Self = PlayerTag(owner), owner == sid && sid != ""
+			rp.Rating, rp.Total = int(rating), int(total)
+			rp.Elapsed, rp.Moves = time.Duration(elapsed)*time.Millisecond, len(ms)
+			replays, moves = append(replays, rp), append(moves, ms)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return replays, moves
+}
@@ -0,0 +1,267 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"time"
+)
+
+/*
+
+scoring
+
+Every move made on a session puzzle goes into its move journal:
+assigns (noting the ones that make the puzzle unsolvable), undos,
+resets, and hints.  The session's choices only say where the
+puzzle is now, because undone choices are forgotten, so it's the
+journal that a score is computed from.
+
+A score starts from a base for the puzzle's difficulty rating,
+adds a bonus for finishing under par time, and deducts for each
+hint, mistake, and undo.  When a puzzle is completed its score
+is recorded, keeping the best score the session has made on it.
+
+*/
+
+// Kinds of journaled moves.
+const (
+	AssignMove = "assign"
+	UndoMove   = "undo"
+	ResetMove  = "reset"
+	HintMove   = "hint"
+)
+
+// Scoring weights.  Par time for a puzzle is parPerSquare for
+// each empty square, times the puzzle's rating, and solving it
+// in no time at all earns a time bonus of half the base score.
+const (
+	pointsPerRating = 1000
+	parPerSquare    = 15 * time.Second
+	hintPenalty     = 100
+	mistakePenalty  = 50
+	undoPenalty     = 20
+)
+
+// A Move is an entry in a puzzle's move journal.  Only assigns
+// and hints have a choice: the one made or hinted.
+type Move struct {
+	Kind    string        `json:"kind"`
+	Choice  puzzle.Choice `json:"choice"`
+	Mistake bool          `json:"mistake"`
+	Made    time.Time     `json:"made"`
+}
+
+// A Score breaks down the score for a puzzle.  Resets count as
+// undos.
+type Score struct {
+	Rating     int           `json:"rating"`
+	Base       int           `json:"base"`
+	TimeBonus  int           `json:"timeBonus"`
+	Hints      int           `json:"hints"`
+	Mistakes   int           `json:"mistakes"`
+	Undos      int           `json:"undos"`
+	Deductions int           `json:"deductions"`
+	Total      int           `json:"total"`
+	Elapsed    time.Duration `json:"elapsed"`
+}
+
+// ScoreMoves scores a puzzle with the given rating and number of
+// empty squares from its move journal, taking the time from the
+// first move to completion as the time taken.  The total is
+// never negative.
+func ScoreMoves(rating, empty int, moves []Move, completed time.Time) *Score {
+	var elapsed time.Duration
+	if len(moves) > 0 {
+		elapsed = completed.Sub(moves[0].Made)
+	}
+	return ScoreTimed(rating, empty, moves, elapsed)
+}
+
+// ScoreTimed is like ScoreMoves, but takes the time taken from a
+// timer (see Timer) rather than from the moves.
+func ScoreTimed(rating, empty int, moves []Move, elapsed time.Duration) *Score {
+	sc := &Score{Rating: rating, Base: rating * pointsPerRating, Elapsed: elapsed}
+	for _, m := range moves {
+		switch m.Kind {
+		case AssignMove:
+			if m.Mistake {
+				sc.Mistakes++
+			}
+		case UndoMove, ResetMove:
+			sc.Undos++
+		case HintMove:
+			sc.Hints++
+		}
+	}
+	par := parPerSquare * time.Duration(empty*rating)
+	if sc.Elapsed < par {
+		sc.TimeBonus = int(int64(sc.Base/2) * int64(par-sc.Elapsed) / int64(par))
+	}
+	sc.Deductions = sc.Hints*hintPenalty + sc.Mistakes*mistakePenalty + sc.Undos*undoPenalty
+	if sc.Total = sc.Base + sc.TimeBonus - sc.Deductions; sc.Total < 0 {
+		sc.Total = 0
+	}
+	return sc
+}
+
+// journalMove: add a move on the active puzzle to its journal.
+func (s *Session) journalMove(m Move) {
+	var index, value interface{}
+	if m.Kind == AssignMove || m.Kind == HintMove {
+		index, value = m.Choice.Index, m.Choice.Value
+	}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO moveJournal "+
+				"(sessionId, puzzleId, kind, squareIndex, squareValue, mistake, made) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			s.sid, s.entries[s.active].PuzzleId, m.Kind, index, value, m.Mistake, m.Made)
+		if err != nil {
+			return fmt.Errorf("Database failure journaling %s for session %q: %v", m.Kind, s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	s.runTimer(m.Made)
+}
+
+// Moves returns the move journal of the active puzzle, in order.
+func (s *Session) Moves() []Move {
+	return loadMoves(s.sid, s.entries[s.active].PuzzleId, time.Time{}, time.Time{})
+}
+
+// loadMoves: load a session puzzle's move journal, in order,
+// keeping the moves made from the given start time up to and
+// including the given end time.  A zero end time means no end.
+func loadMoves(sid, pid string, from, to time.Time) []Move {
+	var moves []Move
+	body := func(tx *pgx.Tx) error {
+		query := "SELECT kind, squareIndex, squareValue, mistake, made FROM moveJournal " +
+			"WHERE sessionId = $1 AND puzzleId = $2 AND made >= $3 "
+		args := []interface{}{sid, pid, from}
+		if !to.IsZero() {
+			query += "AND made <= $4 "
+			args = append(args, to)
+		}
+		rows, err := tx.Query(query+"ORDER BY moveId", args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading moves for session %q: %v", sid, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m Move
+			var index, value pgx.NullInt32
+			if err := rows.Scan(&m.Kind, &index, &value, &m.Mistake, &m.Made); err != nil {
+				return fmt.Errorf("Database failure reading moves for session %q: %v", sid, err)
+			}
+			m.Choice = puzzle.Choice{Index: int(index.Int32), Value: int(value.Int32)}
+			moves = append(moves, m)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return moves
+}
+
+// Score returns the score of the active puzzle so far, as if it
+// were completed now.  The time taken is the timer's, if the
+// puzzle has one.
+func (s *Session) Score() *Score {
+	pe := loadPuzzleEntry(s.Info.PuzzleId)
+	if t := s.Timer(); t != nil {
+		return ScoreTimed(puzzleRating(pe), countZeroes(pe.Values), s.Moves(), t.Elapsed)
+	}
+	return ScoreMoves(puzzleRating(pe), countZeroes(pe.Values), s.Moves(), time.Now())
+}
+
+// RecordScore: score the active puzzle, which has just been
+// completed, and record the score if it's the best the session
+// has made on the puzzle.  The completion itself is always
+// recorded, for achievements.  The puzzle's timer is stopped,
+// and gives the time taken.  Returns the score.
+func (s *Session) RecordScore() *Score {
+	completed := time.Now()
+	pe := loadPuzzleEntry(s.Info.PuzzleId)
+	var sc *Score
+	if elapsed, ok := s.stopTimer(completed); ok {
+		sc = ScoreTimed(puzzleRating(pe), countZeroes(pe.Values), s.Moves(), elapsed)
+	} else {
+		sc = ScoreMoves(puzzleRating(pe), countZeroes(pe.Values), s.Moves(), completed)
+	}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO scores "+
+				"(sessionId, puzzleId, rating, base, timeBonus, deductions, total, completed) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) "+
+				"ON CONFLICT (sessionId, puzzleId) DO UPDATE SET "+
+				"(rating, base, timeBonus, deductions, total, completed) = "+
+				"(EXCLUDED.rating, EXCLUDED.base, EXCLUDED.timeBonus, "+
+				"EXCLUDED.deductions, EXCLUDED.total, EXCLUDED.completed) "+
+				"WHERE scores.total < EXCLUDED.total",
+			s.sid, s.Info.PuzzleId, sc.Rating, sc.Base, sc.TimeBonus, sc.Deductions, sc.Total, completed)
+		if err != nil {
+			return fmt.Errorf("Database failure recording score for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	s.recordCompletion(sc, completed)
+	return sc
+}
+
+// BestScore returns the total of the best score recorded for the
+// session on the active puzzle, and false if none is recorded.
+func (s *Session) BestScore() (int, bool) {
+	var total int
+	found := false
+	body := func(tx *pgx.Tx) error {
+		err := tx.QueryRow(
+			"SELECT total FROM scores WHERE sessionId = $1 AND puzzleId = $2",
+			s.sid, s.Info.PuzzleId).Scan(&total)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading score for session %q: %v", s.sid, err)
+		}
+		found = true
+		return nil
+	}
+	pgExecute(body)
+	return total, found
+}
+
+// puzzleRating returns the difficulty rating of a stored puzzle,
+// or 1 if the puzzle can't be rated.
+func puzzleRating(pe *puzzleEntry) int {
+	if sols, err := pe.makePuzzle().Solutions(); err == nil && len(sols) > 0 && sols[0].Rating > 0 {
+		return sols[0].Rating
+	}
+	return 1
+}
+
+// assignIsMistake reports whether the active puzzle, just after
+// an assign, has become unsolvable.
+func (s *Session) assignIsMistake() bool {
+	state, err := s.Puzzle.State()
+	return err == nil && len(state.Errors) > 0
+}
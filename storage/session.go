@@ -34,6 +34,7 @@ import (
 	"github.com/ancientHacker/susen.go/dbprep"
 	"github.com/ancientHacker/susen.go/puzzle"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -59,6 +60,18 @@ type Session struct {
 	active  int             // the index of the active entry
 }
 
+// sessionPuzzleLimit is the most puzzles a session can be given,
+// or 0 for no limit.
+var sessionPuzzleLimit atomic.Int64
+
+// SetSessionPuzzleLimit limits how many puzzles a session can
+// have; 0 means no limit.  Sessions that already have more keep
+// them, but are given no more.  New sessions still start with
+// all the library's puzzles.
+func SetSessionPuzzleLimit(max int) {
+	sessionPuzzleLimit.Store(int64(max))
+}
+
 // LoadSession: find a session given a session ID.  If there
 // isn't already a session with that ID, a standard "sample"
 // session is cloned and returned.
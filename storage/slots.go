@@ -0,0 +1,179 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"time"
+)
+
+/*
+
+save slots
+
+Players can save the state of the active puzzle under a name
+(say, "before I tried the risky branch") and restore it later.
+A slot is a snapshot of the choices made so far, so restoring
+it just replaces the active puzzle's choices and rebuilds the
+puzzle from them.  Slots are only kept in the database, since
+they are rarely read.
+
+*/
+
+// maxSlotNameLength is the longest name a save slot can have.
+const maxSlotNameLength = 50
+
+// A SaveSlot is a named snapshot of the choices made in a
+// session puzzle.
+type SaveSlot struct {
+	Name    string          // the player's name for the slot
+	Choices []puzzle.Choice // choices made when the slot was saved
+	Saved   time.Time       // when the slot was saved
+}
+
+// ValidSlotName: slot names have to be non-empty and not too long.
+func ValidSlotName(name string) bool {
+	return name != "" && len(name) <= maxSlotNameLength
+}
+
+// checkSlotName: panic on an invalid slot name.
+func checkSlotName(name string) {
+	if !ValidSlotName(name) {
+		panic(fmt.Errorf("Invalid save slot name: %q", name))
+	}
+}
+
+// SaveAs: save the current choices in the active puzzle under the
+// given name, replacing any slot already saved under that name.
+func (s *Session) SaveAs(name string) {
+	checkSlotName(name)
+	se := s.entries[s.active]
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO saveSlots (sessionId, puzzleId, slotName, choicePairs, saved) "+
+				"VALUES ($1, $2, $3, $4, $5) "+
+				"ON CONFLICT (sessionId, puzzleId, slotName) "+
+				"DO UPDATE SET (choicePairs, saved) = ($4, $5)",
+			s.sid, se.PuzzleId, name, se.Choices, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure saving slot %q for session %q: %v", name, s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+}
+
+// RestoreFrom: replace the choices in the active puzzle with the
+// ones saved under the given name, and rebuild the puzzle.
+// Returns false (and changes nothing) if there is no such slot.
+func (s *Session) RestoreFrom(name string) bool {
+	checkSlotName(name)
+	se := s.entries[s.active]
+	var choices []int32
+	found := false
+	body := func(tx *pgx.Tx) error {
+		row := tx.QueryRow(
+			"SELECT choicePairs FROM saveSlots "+
+				"WHERE sessionId = $1 AND puzzleId = $2 AND slotName = $3",
+			s.sid, se.PuzzleId, name)
+		err := row.Scan(&choices)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading slot %q for session %q: %v", name, s.sid, err)
+		}
+		found = true
+		return nil
+	}
+	pgExecute(body)
+	if !found {
+		return false
+	}
+	s.replaceChoices(choices)
+	return true
+}
+
+// replaceChoices: replace the choices in the active puzzle with
+// the given (flattened) ones, and rebuild the puzzle.
+func (s *Session) replaceChoices(choices []int32) {
+	// update the session entry, cache, and database
+	se := s.entries[s.active]
+	se.LastView = time.Now()
+	se.Choices = choices
+	s.cacheUpdateEntry(s.active)
+	s.databaseUpdateEntry(s.active)
+	// the cached steps are for the old choices, so rebuild them
+	s.constructActivePuzzle()
+	s.Info = s.makePuzzleInfo(s.active)
+}
+
+// DeleteSlot: remove the slot saved under the given name for the
+// active puzzle.  Returns false if there is no such slot.
+func (s *Session) DeleteSlot(name string) bool {
+	checkSlotName(name)
+	se := s.entries[s.active]
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"DELETE FROM saveSlots WHERE sessionId = $1 AND puzzleId = $2 AND slotName = $3",
+			s.sid, se.PuzzleId, name)
+		if err != nil {
+			return fmt.Errorf("Database failure deleting slot %q for session %q: %v", name, s.sid, err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return removed
+}
+
+// SaveSlots: list the slots saved for the active puzzle, oldest
+// first.
+func (s *Session) SaveSlots() []*SaveSlot {
+	se := s.entries[s.active]
+	var slots []*SaveSlot
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT slotName, choicePairs, saved FROM saveSlots "+
+				"WHERE sessionId = $1 AND puzzleId = $2 ORDER BY saved",
+			s.sid, se.PuzzleId)
+		if err != nil {
+			return fmt.Errorf("Failed to fetch slots for session %q: %v", s.sid, err)
+		}
+		for rows.Next() {
+			var name string
+			var pairs []int32
+			var saved time.Time
+			if err := rows.Scan(&name, &pairs, &saved); err != nil {
+				return fmt.Errorf("Failure loading slots for session %q: %v", s.sid, err)
+			}
+			slot := &SaveSlot{Name: name, Saved: saved, Choices: make([]puzzle.Choice, len(pairs)/2)}
+			for i := range slot.Choices {
+				slot.Choices[i] = puzzle.Choice{Index: int(pairs[2*i]), Value: int(pairs[2*i+1])}
+			}
+			slots = append(slots, slot)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return slots
+}
@@ -0,0 +1,199 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"sort"
+	"time"
+)
+
+/*
+
+player statistics
+
+A session's statistics, for its profile page, are gathered from
+what's recorded as it plays: the move journals say which puzzles
+it started and how often it asked for hints or took moves back,
+the completions say which it finished, how long each took, and
+on which days, and replaying the journals (as for the mistake
+analytics) says how well it used each solving technique.
+
+*/
+
+// Statistics summarize a session's play.  Undos count resets as
+// well as undos.  Ratings gives the completions of each
+// difficulty rating, easiest first.  Streak counts the days in a
+// row with a completion, and DailyStreak the days in a row
+// solving the puzzle of the day.
+type Statistics struct {
+	Started     int                        `json:"started"`
+	Completed   int                        `json:"completed"`
+	Hints       int                        `json:"hints"`
+	Undos       int                        `json:"undos"`
+	Ratings     []RatingTimes              `json:"ratings"`
+	Techniques  map[string]*TechniqueStats `json:"techniques"`
+	Streak      Streak                     `json:"streak"`
+	DailyStreak Streak                     `json:"dailyStreak"`
+}
+
+// RatingTimes gives the completions of one difficulty rating
+// and the average time they took.  Completions recorded without
+// their time aren't in the average.
+type RatingTimes struct {
+	Rating    int           `json:"rating"`
+	Completed int           `json:"completed"`
+	Average   time.Duration `json:"average"`
+}
+
+// TechniqueStats say how well a technique was used: how many
+// assigns it justified, and the fraction of those that were
+// right.
+type TechniqueStats struct {
+	Used        int     `json:"used"`
+	SuccessRate float64 `json:"successRate"`
+}
+
+// A Streak is a run of consecutive days.  The current streak
+// runs through today, or through yesterday if there's still time
+// today to keep it going.
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// CompletionStatistics fills in the statistics that come from a
+// session's completions, in time order, as of the given time.
+func CompletionStatistics(cs []Completion, now time.Time) *Statistics {
+	st := &Statistics{Completed: len(cs), Ratings: []RatingTimes{}}
+	byRating := make(map[int]*RatingTimes)
+	timed := make(map[int]int)
+	totals := make(map[int]time.Duration)
+	var days, dailyDays []int
+	for _, c := range cs {
+		rt := byRating[c.Rating]
+		if rt == nil {
+			rt = &RatingTimes{Rating: c.Rating}
+			byRating[c.Rating] = rt
+		}
+		rt.Completed++
+		if c.Elapsed > 0 {
+			timed[c.Rating]++
+			totals[c.Rating] += c.Elapsed
+		}
+		day := dayNumber(c.Completed.UTC())
+		days = append(days, day)
+		if c.Daily {
+			dailyDays = append(dailyDays, day)
+		}
+	}
+	for r, rt := range byRating {
+		if timed[r] > 0 {
+			rt.Average = totals[r] / time.Duration(timed[r])
+		}
+		st.Ratings = append(st.Ratings, *rt)
+	}
+	sort.Slice(st.Ratings, func(i, j int) bool { return st.Ratings[i].Rating < st.Ratings[j].Rating })
+	today := dayNumber(now.UTC())
+	st.Streak, st.DailyStreak = dayStreak(days, today), dayStreak(dailyDays, today)
+	return st
+}
+
+// dayStreak finds the streaks in a list of day numbers, in
+// order, as of the given day.
+func dayStreak(days []int, today int) Streak {
+	var s Streak
+	run, last := 0, -1
+	for _, day := range days {
+		switch day {
+		case last:
+			continue
+		case last + 1:
+			run++
+		default:
+			run = 1
+		}
+		last = day
+		if run > s.Longest {
+			s.Longest = run
+		}
+	}
+	if last == today || last == today-1 {
+		s.Current = run
+	}
+	return s
+}
+
+// techniqueStatistics turns mistake analytics into technique
+// success rates.  Techniques that were never used have no rate.
+func techniqueStatistics(ma *MistakeAnalytics) map[string]*TechniqueStats {
+	result := make(map[string]*TechniqueStats, len(ma.Justified))
+	for technique, used := range ma.Justified {
+		ts := &TechniqueStats{Used: used}
+		if used > 0 {
+			ts.SuccessRate = float64(used-ma.Missed[technique]) / float64(used)
+		}
+		result[technique] = ts
+	}
+	return result
+}
+
+// SessionStatistics gathers the statistics of a session's play.
+func SessionStatistics(sid string) *Statistics {
+	st := CompletionStatistics(Completions(sid), time.Now())
+	body := func(tx *pgx.Tx) error {
+		var started int64
+		err := tx.QueryRow(
+			"SELECT count(DISTINCT puzzleId) FROM moveJournal WHERE sessionId = $1", sid).Scan(&started)
+		if err != nil {
+			return fmt.Errorf("Database failure counting puzzles started by session %q: %v", sid, err)
+		}
+		st.Started = int(started)
+
+		rows, err := tx.Query(
+			"SELECT kind, count(*) FROM moveJournal WHERE sessionId = $1 GROUP BY kind", sid)
+		if err != nil {
+			return fmt.Errorf("Database failure counting moves for session %q: %v", sid, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var kind string
+			var count int64
+			if err := rows.Scan(&kind, &count); err != nil {
+				return fmt.Errorf("Database failure reading move counts for session %q: %v", sid, err)
+			}
+			switch kind {
+			case HintMove:
+				st.Hints += int(count)
+			case UndoMove, ResetMove:
+				st.Undos += int(count)
+			}
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	st.Techniques = techniqueStatistics(SessionMistakes(sid))
+	return st
+}
+
+// Statistics gathers the statistics of the session's play.
+func (s *Session) Statistics() *Statistics {
+	return SessionStatistics(s.sid)
+}
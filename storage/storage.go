@@ -50,6 +50,21 @@ func Connect() (cacheId, databaseId string, err error) {
 	return
 }
 
+// Ping checks that the cache and database connections are alive,
+// returning an error describing the first one that isn't.
+func Ping() error {
+	return catchPanic(func() {
+		rdExecute(func(tx redis.Conn) error {
+			_, err := tx.Do("PING")
+			return err
+		})
+		pgExecute(func(tx *pgx.Tx) error {
+			_, err := tx.Exec("SELECT 1")
+			return err
+		})
+	})
+}
+
 func Close() {
 	rdMutex.Lock()
 	defer rdMutex.Unlock()
@@ -19,9 +19,14 @@
 package storage
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/garyburd/redigo/redis"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
 	"github.com/ancientHacker/susen.go/dbprep"
 	"github.com/ancientHacker/susen.go/puzzle"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -92,6 +97,20 @@ func TestConnect(t *testing.T) {
 	Close()
 }
 
+func TestPing(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	if err := Ping(); err != nil {
+		t.Errorf("Ping of connected storage failed: %v", err)
+	}
+	Close()
+	if err := Ping(); err == nil {
+		t.Errorf("Ping of closed storage succeeded")
+	}
+}
+
 func TestSampleSession(t *testing.T) {
 	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
 	if _, _, err := Connect(); err != nil {
@@ -317,6 +336,1838 @@ func TestSelectPuzzle(t *testing.T) {
 	ts.SelectPuzzle("this is not an actual puzzle name or id!!")
 }
 
+func TestSaveSlots(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	td := testData[0]
+	ts := LoadSession("testSaveSlots")
+	ts.SelectPuzzle(td.name)
+	if slots := ts.SaveSlots(); len(slots) != 0 {
+		t.Fatalf("New session has save slots: %v", slots)
+	}
+	ts.SaveAs("start")
+	for _, c := range td.choices {
+		if _, err := ts.Puzzle.Assign(c); err != nil {
+			t.Fatalf("Failed to assign %v: %v", c, err)
+		}
+		ts.AddStep(c)
+	}
+	ts.SaveAs("risky")
+	slots := ts.SaveSlots()
+	if len(slots) != 2 || slots[0].Name != "start" || slots[1].Name != "risky" {
+		t.Fatalf("Save slots are %+v", slots)
+	}
+	if !reflect.DeepEqual(slots[1].Choices, td.choices) {
+		t.Errorf("Slot %q has choices %v, expected %v", slots[1].Name, slots[1].Choices, td.choices)
+	}
+
+	// restoring rebuilds the puzzle from the saved choices
+	if !ts.RestoreFrom("start") {
+		t.Fatalf("Couldn't restore from slot %q", "start")
+	}
+	if len(ts.Info.Choices) != 0 {
+		t.Errorf("Restored puzzle has choices %v", ts.Info.Choices)
+	}
+	ts = LoadSession("testSaveSlots")
+	if len(ts.Info.Choices) != 0 {
+		t.Errorf("Reloaded restored puzzle has choices %v", ts.Info.Choices)
+	}
+	if !ts.RestoreFrom("risky") {
+		t.Fatalf("Couldn't restore from slot %q", "risky")
+	}
+	if !reflect.DeepEqual(ts.Info.Choices, td.choices) {
+		t.Errorf("Restored puzzle has choices %v, expected %v", ts.Info.Choices, td.choices)
+	}
+
+	// slots are per-puzzle, and can be deleted
+	if ts.RestoreFrom("nonesuch") {
+		t.Errorf("Restored from a slot that doesn't exist")
+	}
+	ts.SelectPuzzle(testData[1].name)
+	if slots := ts.SaveSlots(); len(slots) != 0 {
+		t.Errorf("Other puzzle has save slots: %v", slots)
+	}
+	ts.SelectPuzzle(td.name)
+	if !ts.DeleteSlot("start") || ts.DeleteSlot("start") {
+		t.Errorf("Deleting slot %q didn't work exactly once", "start")
+	}
+	if slots := ts.SaveSlots(); len(slots) != 1 {
+		t.Errorf("After delete, save slots are %+v", slots)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Didn't panic on save to an empty slot name")
+		}
+	}()
+	ts.SaveAs("")
+}
+
+func TestLessons(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	// the built-in lessons use the first sample puzzle
+	lessons := Lessons()
+	if len(lessons) != 2 || lessons[0].Name != "hidden-singles" || lessons[1].Name != "naked-singles" {
+		t.Fatalf("Built-in lessons are %+v", lessons)
+	}
+	l := FindLesson("naked-singles")
+	if l == nil || len(l.Examples) != 1 || len(l.Examples[0].Goals) != 1 {
+		t.Fatalf("Found lesson %+v", l)
+	}
+	if FindLesson("nonesuch") != nil {
+		t.Errorf("Found a lesson that doesn't exist")
+	}
+
+	// starting an example of a sample puzzle selects the sample
+	ts := LoadSession("testLessons")
+	if ts.StartLesson(l, 2) {
+		t.Errorf("Started an example that doesn't exist")
+	}
+	if !ts.StartLesson(l, 1) || ts.Info.Name != sampleDefaultName || len(ts.Info.Choices) != 0 {
+		t.Fatalf("Started lesson puzzle is %+v", ts.Info)
+	}
+	goal := l.Examples[0].Goals[0]
+	if l.Examples[0].Accepts(ts.Puzzle) {
+		t.Errorf("Example accepted before its goal was reached")
+	}
+	if _, err := ts.Puzzle.Assign(goal); err != nil {
+		t.Fatalf("Failed to assign %v: %v", goal, err)
+	}
+	ts.AddStep(goal)
+	if !l.Examples[0].Accepts(ts.Puzzle) {
+		t.Errorf("Example not accepted after its goal was reached")
+	}
+
+	// starting an example of a new puzzle adds it to the session
+	sum := &puzzle.Summary{Geometry: puzzle.StandardGeometryName, SideLength: 4,
+		Values: []int{1, 0, 3, 0, 0, 3, 0, 1, 3, 0, 1, 0, 0, 1, 0, 3}}
+	added := AddLesson(&Lesson{Name: "Test-Lesson", Technique: "naked single", Title: "Test",
+		Examples: []*LessonExample{{Summary: sum, Goals: []puzzle.Choice{{Index: 2, Value: 2}}}}})
+	if added.Name != "test-lesson" || len(added.Examples) != 1 || added.Examples[0].PuzzleId == "" {
+		t.Fatalf("Added lesson is %+v", added)
+	}
+	ts = LoadSession("testLessons")
+	if !ts.StartLesson(added, 1) || ts.Info.Name != "lesson-test-lesson-1" {
+		t.Fatalf("Started lesson puzzle is %+v", ts.Info)
+	}
+	ts = LoadSession("testLessons")
+	if ts.Info.PuzzleId != added.Examples[0].PuzzleId {
+		t.Errorf("Reloaded session's active puzzle is %+v", ts.Info)
+	}
+	if !RemoveLesson("test-lesson") || RemoveLesson("test-lesson") {
+		t.Errorf("Removing lesson %q didn't work exactly once", "test-lesson")
+	}
+	if FindLesson("test-lesson") != nil {
+		t.Errorf("Found lesson %q after removal", "test-lesson")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Didn't panic on adding a lesson with an impossible goal")
+		}
+	}()
+	AddLesson(&Lesson{Name: "bad", Examples: []*LessonExample{
+		{Summary: sum, Goals: []puzzle.Choice{{Index: 1, Value: 2}}}}})
+}
+
+func TestPractice(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testPractice")
+	ts.SelectPuzzle(testData[0].name)
+	if ps := ts.Practice(); ps != nil {
+		t.Errorf("Sample puzzle has practice status %+v", ps)
+	}
+	if h := ts.Hint(); h == nil {
+		t.Errorf("No hint for sample puzzle")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, technique := range PracticeTechniques() {
+		if !ts.StartPractice(technique, rng) {
+			t.Fatalf("Couldn't start practicing %q", technique)
+		}
+		if !strings.HasPrefix(ts.Info.Name, "practice-"+technique+"-") || len(ts.Info.Choices) != 0 {
+			t.Errorf("Practice puzzle is %+v", ts.Info)
+		}
+		// only the technique's placements are easy
+		placements := easyPlacements(ts.Puzzle)
+		if len(placements) != 1 || len(placements[technique]) == 0 {
+			t.Errorf("Practice puzzle for %q has easy placements %v", technique, placements)
+		}
+		ps := ts.Practice()
+		if ps == nil || ps.Technique != technique || ps.Found || ps.Hinted {
+			t.Fatalf("Practice status at start is %+v", ps)
+		}
+
+		// make a key deduction unaided
+		key := ps.keys[0]
+		if _, err := ts.Puzzle.Assign(key); err != nil {
+			t.Fatalf("Failed to assign %v: %v", key, err)
+		}
+		ts.AddStep(key)
+		if ps := ts.Practice(); !ps.Found || ps.Hinted {
+			t.Errorf("Practice status after key deduction is %+v", ps)
+		}
+		if h := ts.Hint(); h != nil && h.Choice == key {
+			t.Errorf("Hint after key deduction is %+v", h)
+		}
+		if ps := ts.Practice(); ps.Hinted {
+			t.Errorf("Hint after key deduction marked practice as hinted")
+		}
+
+		// starting over and asking for a hint first
+		ts.RemoveAllSteps()
+		if h := ts.Hint(); h == nil || h.Technique != technique {
+			t.Errorf("Hint at start is %+v", h)
+		}
+		if ps := ts.Practice(); ps.Found || !ps.Hinted {
+			t.Errorf("Practice status after hint is %+v", ps)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Didn't panic on practicing an unknown technique")
+		}
+	}()
+	ts.StartPractice("x-wing", rng)
+}
+
+func TestScoreMoves(t *testing.T) {
+	start := time.Now()
+	moves := []Move{
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 1, Value: 2}, Made: start},
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 2, Value: 2}, Mistake: true, Made: start},
+		{Kind: UndoMove, Made: start},
+		{Kind: HintMove, Made: start},
+		{Kind: ResetMove, Made: start},
+	}
+	// solved in half of par time
+	par := parPerSquare * 2 * 40
+	sc := ScoreMoves(2, 40, moves, start.Add(par/2))
+	expect := &Score{
+		Rating:     2,
+		Base:       2 * pointsPerRating,
+		TimeBonus:  pointsPerRating / 2,
+		Hints:      1,
+		Mistakes:   1,
+		Undos:      2,
+		Deductions: hintPenalty + mistakePenalty + 2*undoPenalty,
+		Elapsed:    par / 2,
+	}
+	expect.Total = expect.Base + expect.TimeBonus - expect.Deductions
+	if !reflect.DeepEqual(sc, expect) {
+		t.Errorf("Score was %+v, expected %+v", sc, expect)
+	}
+	// a timer gives the same score for the same time
+	if sc := ScoreTimed(2, 40, moves, par/2); !reflect.DeepEqual(sc, expect) {
+		t.Errorf("Timed score was %+v, expected %+v", sc, expect)
+	}
+	// no bonus over par, and never below zero
+	if sc := ScoreMoves(1, 40, moves, start.Add(2*par)); sc.TimeBonus != 0 || sc.Total != sc.Base-sc.Deductions {
+		t.Errorf("Over-par score was %+v", sc)
+	}
+	for i := 0; i < pointsPerRating/hintPenalty; i++ {
+		moves = append(moves, Move{Kind: HintMove, Made: start})
+	}
+	if sc := ScoreMoves(1, 40, moves, start.Add(2*par)); sc.Total != 0 {
+		t.Errorf("Heavily hinted score was %+v", sc)
+	}
+}
+
+func TestScoring(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testScoring")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	if moves := ts.Moves(); len(moves) != 0 {
+		t.Errorf("Moves at start are %+v", moves)
+	}
+	good, bad := testData[0].choices[0], puzzle.Choice{Index: testData[0].choices[1].Index, Value: 9}
+	for _, c := range []puzzle.Choice{good, bad} {
+		if _, err := ts.Puzzle.Assign(c); err != nil {
+			t.Fatalf("Failed to assign %v: %v", c, err)
+		}
+		ts.AddStep(c)
+	}
+	ts.RemoveStep()
+	ts.Hint()
+	ts.RemoveAllSteps()
+
+	var kinds []string
+	for _, m := range ts.Moves() {
+		kinds = append(kinds, m.Kind)
+	}
+	expect := []string{AssignMove, AssignMove, UndoMove, HintMove, ResetMove}
+	if !reflect.DeepEqual(kinds, expect) {
+		t.Fatalf("Moves were %v, expected %v", kinds, expect)
+	}
+	if moves := ts.Moves(); moves[0].Choice != good || moves[0].Mistake || moves[1].Choice != bad || !moves[1].Mistake {
+		t.Errorf("Assign moves were %+v", moves[:2])
+	}
+	sc := ts.Score()
+	if sc.Hints != 1 || sc.Mistakes != 1 || sc.Undos != 2 || sc.Rating == 0 {
+		t.Errorf("Score is %+v", sc)
+	}
+
+	if _, found := ts.BestScore(); found {
+		t.Errorf("Found a best score before recording one")
+	}
+	sc = ts.RecordScore()
+	if best, found := ts.BestScore(); !found || best != sc.Total {
+		t.Errorf("Best score is %d (%v), expected %d", best, found, sc.Total)
+	}
+	// a worse score doesn't replace the best one
+	ts.Hint()
+	if worse := ts.RecordScore(); worse.Total >= sc.Total {
+		t.Errorf("Score after another hint is %+v", worse)
+	} else if best, _ := ts.BestScore(); best != sc.Total {
+		t.Errorf("Best score after a worse one is %d, expected %d", best, sc.Total)
+	}
+}
+
+func TestEvaluateBadges(t *testing.T) {
+	day := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	earnedNames := func(cs []Completion) (names []string) {
+		earned, available := EvaluateBadges(cs)
+		if len(earned)+len(available) != len(badges) {
+			t.Errorf("Badges earned %v and available %v don't add up", earned, available)
+		}
+		for _, b := range earned {
+			names = append(names, b.Name)
+		}
+		return
+	}
+
+	if names := earnedNames(nil); len(names) != 0 {
+		t.Errorf("No completions earned %v", names)
+	}
+	cs := []Completion{
+		{SideLength: 6, Rating: 1, Hints: 2, Completed: day},
+		{SideLength: 9, Rating: 3, Hints: 1, Completed: day.Add(time.Hour)},
+	}
+	if names := earnedNames(cs); !reflect.DeepEqual(names, []string{"first-9x9", "beyond-singles"}) {
+		t.Errorf("Hinted completions earned %v", names)
+	}
+	if earned, _ := EvaluateBadges(cs); earned[0].Earned != cs[1].Completed {
+		t.Errorf("First 9x9 earned at %v, expected %v", earned[0].Earned, cs[1].Completed)
+	}
+
+	// a broken streak doesn't count, and neither do repeats
+	var dailies []Completion
+	for _, d := range []int{0, 1, 2, 4, 5, 5, 6, 7, 8, 9, 10} {
+		dailies = append(dailies, Completion{SideLength: 6, Rating: 1, Hints: 1, Daily: true,
+			Completed: day.AddDate(0, 0, d)})
+	}
+	if names := earnedNames(dailies[:len(dailies)-1]); len(names) != 0 {
+		t.Errorf("Six-day streak earned %v", names)
+	}
+	if names := earnedNames(dailies); !reflect.DeepEqual(names, []string{"daily-streak"}) {
+		t.Errorf("Seven-day streak earned %v", names)
+	}
+}
+
+func TestBadges(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testBadges")
+	ts.SelectPuzzle(testData[0].name)
+	if earned, available := ts.Badges(); len(earned) != 0 || len(available) != len(badges) {
+		t.Errorf("Badges at start are %v, %v", earned, available)
+	}
+	ts.RecordScore()
+	if cs := Completions("testBadges"); len(cs) != 1 || cs[0].PuzzleId != ts.Info.PuzzleId || cs[0].SideLength != 9 {
+		t.Errorf("Completions are %+v", cs)
+	}
+	earned, _ := ts.Badges()
+	var names []string
+	for _, b := range earned {
+		names = append(names, b.Name)
+	}
+	if len(names) < 2 || names[0] != "first-9x9" || names[1] != "no-hints" {
+		t.Errorf("Earned badges are %v", names)
+	}
+}
+
+// a small puzzle with a unique solution, for replaying journals
+var (
+	replayValues = []int{
+		1, 0, 3, 0,
+		0, 3, 0, 1,
+		3, 0, 1, 0,
+		2, 1, 0, 3,
+	}
+	replaySolution = []int{
+		1, 2, 3, 4,
+		4, 3, 2, 1,
+		3, 4, 1, 2,
+		2, 1, 4, 3,
+	}
+)
+
+func replayPuzzle(t *testing.T) *puzzle.Puzzle {
+	start, err := puzzle.New(&puzzle.Summary{
+		Geometry:   puzzle.StandardGeometryName,
+		SideLength: 4,
+		Values:     replayValues,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create puzzle: %v", err)
+	}
+	return start
+}
+
+func TestAnalyzeMoves(t *testing.T) {
+	start, solution := replayPuzzle(t), replaySolution
+	moves := []Move{
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 2, Value: 4}}, // misses a hidden single
+		{Kind: UndoMove},
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 4, Value: 2}}, // a wrong guess
+		{Kind: HintMove},
+		{Kind: ResetMove},
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 4, Value: 4}}, // a right guess
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 5, Value: 4}}, // a naked single
+	}
+	ma := AnalyzeMoves("P", start, solution, moves)
+	expect := &MistakeAnalytics{
+		Assigns:   4,
+		Mistakes:  2,
+		Guesses:   2,
+		Justified: map[string]int{"naked-single": 1, "hidden-single": 1},
+		Missed:    map[string]int{"naked-single": 0, "hidden-single": 1},
+		Cells: []*CellStats{
+			{PuzzleId: "P", Index: 4, Mistakes: 1, Guesses: 2},
+			{PuzzleId: "P", Index: 2, Mistakes: 1},
+		},
+	}
+	if !reflect.DeepEqual(ma, expect) {
+		t.Errorf("Analytics were %+v, expected %+v", ma, expect)
+	}
+	if state, _ := start.State(); state.Squares[1].Aval != 0 {
+		t.Errorf("Analysis changed the starting puzzle")
+	}
+
+	ma.Cells = append(ma.Cells, &CellStats{PuzzleId: "P", Index: 2, Guesses: 2})
+	ma.mergeCells()
+	ma.sortCells()
+	if len(ma.Cells) != 2 || ma.Cells[0].Index != 2 || ma.Cells[0].Guesses != 2 || ma.Cells[0].Mistakes != 1 {
+		t.Errorf("Merged cells were %+v, %+v", ma.Cells[0], ma.Cells[1])
+	}
+}
+
+func TestPlayMoves(t *testing.T) {
+	start := replayPuzzle(t)
+	t0 := time.Now()
+	moves := []Move{
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 5, Value: 4}, Made: t0},
+		{Kind: HintMove, Choice: puzzle.Choice{Index: 2, Value: 2}, Made: t0.Add(time.Second)},
+		{Kind: AssignMove, Choice: puzzle.Choice{Index: 4, Value: 2}, Made: t0.Add(3 * time.Second)},
+		{Kind: UndoMove, Made: t0.Add(4 * time.Second)},
+		{Kind: HintMove, Made: t0.Add(5 * time.Second)},
+	}
+	pb := PlayMoves("P", start, replaySolution, moves)
+	if pb.PuzzleId != "P" || len(pb.Frames) != len(moves) {
+		t.Fatalf("Playback has %d frames: %+v", len(pb.Frames), pb)
+	}
+	for i, f := range pb.Frames {
+		if f.Kind != moves[i].Kind || f.Offset != moves[i].Made.Sub(t0) {
+			t.Errorf("Frame %d is %+v", i, f)
+		}
+	}
+	if f := pb.Frames[0]; f.Choice == nil || *f.Choice != moves[0].Choice || f.Mistake || f.Hint != nil {
+		t.Errorf("Naked single frame is %+v", f)
+	}
+	if f := pb.Frames[1]; f.Hint == nil || *f.Hint != moves[1].Choice || len(f.Diff.Squares) != 0 {
+		t.Errorf("Hint frame is %+v", f)
+	}
+	if f := pb.Frames[2]; !f.Mistake || len(f.Diff.Squares) == 0 {
+		t.Errorf("Wrong assign frame is %+v", f)
+	}
+	if f := pb.Frames[4]; f.Hint != nil {
+		t.Errorf("Hint without a choice has overlay %+v", f.Hint)
+	}
+
+	// applying the diffs to the start gives the puzzle after the moves
+	squares := append([]puzzle.Square(nil), pb.Start.Squares...)
+	for _, f := range pb.Frames {
+		for _, sq := range f.Diff.Squares {
+			squares[sq.Index-1] = sq
+		}
+	}
+	expect := replayPuzzle(t)
+	if _, err := expect.Assign(moves[0].Choice); err != nil {
+		t.Fatalf("Failed to assign %v: %v", moves[0].Choice, err)
+	}
+	if state, _ := expect.State(); !reflect.DeepEqual(squares, state.Squares) {
+		t.Errorf("Played back squares were %+v, expected %+v", squares, state.Squares)
+	}
+}
+
+func TestMistakes(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testMistakes")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	bad := puzzle.Choice{Index: testData[0].choices[1].Index, Value: 9}
+	for _, c := range []puzzle.Choice{testData[0].choices[0], bad} {
+		if _, err := ts.Puzzle.Assign(c); err != nil {
+			t.Fatalf("Failed to assign %v: %v", c, err)
+		}
+		ts.AddStep(c)
+	}
+	if x := ts.ExplainError(); x == nil || x.Position != 2 || x.Move.Index != bad.Index {
+		t.Errorf("Mistake explanation is %+v", x)
+	}
+	ma := SessionMistakes("testMistakes")
+	if ma.Assigns != 2 || ma.Mistakes != 1 || len(ma.Cells) == 0 || ma.Cells[0].Index != bad.Index {
+		t.Errorf("Session analytics are %+v", ma)
+	}
+	if pa := PuzzleMistakes(ts.Info.PuzzleId); pa.Assigns < ma.Assigns || pa.Mistakes < ma.Mistakes {
+		t.Errorf("Puzzle analytics %+v don't include session analytics %+v", pa, ma)
+	}
+	if pa := PuzzleMistakes("no-such-puzzle"); pa.Assigns != 0 || len(pa.Cells) != 0 {
+		t.Errorf("Unknown puzzle has analytics %+v", pa)
+	}
+}
+
+func TestClassrooms(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	token := AddTeacher("test-teacher")
+	if token == "" || AddTeacher("test-teacher") != "" {
+		t.Fatalf("Adding a teacher twice gave tokens %q and another", token)
+	}
+	if teacher := FindTeacher(token); teacher != "test-teacher" {
+		t.Errorf("Token found teacher %q", teacher)
+	}
+	if teacher := FindTeacher("wrong"); teacher != "" {
+		t.Errorf("Wrong token found teacher %q", teacher)
+	}
+	if !AddClass("test-teacher", "test-class", "Test Class") || AddClass("test-teacher", "test-class", "Again") {
+		t.Errorf("Adding a class twice didn't fail")
+	}
+
+	ann, bob := LoadSession("testClassAnn"), LoadSession("testClassBob")
+	if !ann.JoinClass("test-class", "ann") || !bob.JoinClass("test-class", "bob") {
+		t.Fatalf("Failed to join class")
+	}
+	if bob.JoinClass("test-class", "ann") || bob.JoinClass("no-class", "bob") {
+		t.Errorf("Joined as a taken name or an unknown class")
+	}
+	if !ann.JoinClass("test-class", "ann") {
+		t.Errorf("Failed to rejoin class")
+	}
+	classes := TeacherClasses("test-teacher")
+	if len(classes) != 1 || !reflect.DeepEqual(classes[0].Students, []string{"ann", "bob"}) {
+		t.Errorf("Teacher classes are %+v", classes)
+	}
+
+	ann.SelectPuzzle(testData[0].name)
+	ann.RemoveAllSteps()
+	c := testData[0].choices[0]
+	if _, err := ann.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ann.AddStep(c)
+	ann.Hint()
+	progress := ClassProgress(FindClass("test-class"))
+	if len(progress) != 2 || progress[0].Student != "ann" || progress[1].Student != "bob" {
+		t.Fatalf("Class progress is %+v", progress)
+	}
+	if p := progress[0]; p.Choices != 1 || p.Hints != 1 || p.Values[c.Index-1] != c.Value || p.Stuck <= 0 {
+		t.Errorf("Ann's progress is %+v", p)
+	}
+	if s := StudentSession("test-class", "carl"); s != nil {
+		t.Errorf("Found a session for an unknown student")
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	AddTeacher("test-assigner")
+	AddClass("test-assigner", "test-assigned", "Assigned Class")
+	ann := LoadSession("testAssignedAnn")
+	ann.JoinClass("test-assigned", "ann")
+	var pids []string
+	for _, td := range testData[:2] {
+		ann.SelectPuzzle(td.name)
+		pids = append(pids, ann.Info.PuzzleId)
+	}
+	a := &Assignment{Class: "test-assigned", Name: "week-1", Title: "Week 1",
+		Due: time.Now().Add(time.Hour).Truncate(time.Second), Puzzles: pids}
+	if !AddAssignment(a) || AddAssignment(a) {
+		t.Fatalf("Adding an assignment twice didn't fail")
+	}
+	if found := FindAssignment("test-assigned", "week-1"); found == nil ||
+		!found.Due.Equal(a.Due) || !reflect.DeepEqual(found.Puzzles, pids) {
+		t.Errorf("Found assignment %+v, expected %+v", found, a)
+	}
+	if as := ClassAssignments("test-assigned"); len(as) != 1 {
+		t.Errorf("Class assignments are %+v", as)
+	}
+
+	statuses := ann.Assignments()
+	if len(statuses) != 1 || statuses[0].Name != "week-1" || statuses[0].Completed[0] != nil {
+		t.Fatalf("Assignments at start are %+v", statuses)
+	}
+	if ann.StartAssignment(a, 3) || !ann.StartAssignment(a, 1) || ann.Info.PuzzleId != pids[0] {
+		t.Errorf("Starting assignment puzzles went wrong: active puzzle is %q", ann.Info.PuzzleId)
+	}
+	ann.RecordScore()
+	if statuses := ann.Assignments(); statuses[0].Completed[0] == nil || statuses[0].Completed[1] != nil {
+		t.Errorf("Completions after the first puzzle are %v", statuses[0].Completed)
+	}
+	results := AssignmentResults(a)
+	if len(results) != 2 {
+		t.Fatalf("Results are %+v", results)
+	}
+	if r := results[0]; r.Student != "ann" || r.Position != 1 || r.Completed == nil || !r.OnTime || r.Score == nil {
+		t.Errorf("First result is %+v", r)
+	}
+	if r := results[1]; r.Position != 2 || r.Completed != nil || r.OnTime || r.Score != nil {
+		t.Errorf("Second result is %+v", r)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	observe := func(bound int, attempts int, seconds ...float64) *PuzzleDifficulty {
+		return &PuzzleDifficulty{
+			PuzzleId: fmt.Sprintf("bound-%d", bound),
+			Measure:  &puzzle.RatingMeasure{SideLength: 9, Bound: bound},
+			Attempts: attempts,
+			Seconds:  seconds,
+		}
+	}
+	// puzzles with 2 and 3 bound squares are harder than the
+	// default bands rate them
+	pds := []*PuzzleDifficulty{
+		observe(0, 3, 100, 100, 100),
+		observe(1, 3, 110, 110, 110),
+		observe(2, 3, 300, 300, 300),
+		observe(3, 4, 310, 310, 310),
+		observe(4, 3, 200, 200, 200),
+		observe(6, 3, 210, 210, 210),
+		observe(8, 3, 220, 220, 220),
+		observe(9, 1),
+	}
+	if f := pds[3].FailureRate(); f != 0.25 {
+		t.Errorf("Failure rate is %v, expected 0.25", f)
+	}
+	if e := pds[7].effort(); !math.IsInf(e, 1) {
+		t.Errorf("Unsolved puzzle effort is %v", e)
+	}
+
+	c := Calibrate(puzzle.DefaultRatingBands, pds)
+	if c.Puzzles != 7 || c.Current != puzzle.DefaultRatingBands {
+		t.Errorf("Calibration observed %d puzzles with bands %+v", c.Puzzles, c.Current)
+	}
+	expect := puzzle.RatingBands{BoundFraction: 0.25, WideChoice: 2, FiveStarChoices: 3}
+	if c.Proposed != expect || c.ProposedAgreement <= c.Agreement {
+		t.Errorf("Proposed %+v (agreement %v over %v), expected %+v",
+			c.Proposed, c.ProposedAgreement, c.Agreement, expect)
+	}
+	if len(c.Ratings) != 2 || c.Ratings[0].Puzzles != 4 || c.Ratings[1].Puzzles != 3 ||
+		c.Ratings[0].Solves != 12 || c.Ratings[0].Attempts != 13 {
+		t.Errorf("Rating stats are %+v", c.Ratings)
+	}
+
+	// calibrating the proposal proposes it again
+	if again := Calibrate(c.Proposed, pds); again.Proposed != c.Proposed {
+		t.Errorf("Recalibration proposed %+v", again.Proposed)
+	}
+	// too few puzzles propose the current bands
+	if few := Calibrate(puzzle.DefaultRatingBands, pds[:4]); few.Proposed != puzzle.DefaultRatingBands {
+		t.Errorf("Calibration of %d puzzles proposed %+v", few.Puzzles, few.Proposed)
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+	defer ApplyRatingBands(puzzle.DefaultRatingBands, 0)
+
+	ts := LoadSession("testCalibration")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	c := testData[0].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+	var found *PuzzleDifficulty
+	for _, pd := range PuzzleDifficulties() {
+		if pd.PuzzleId == ts.Info.PuzzleId {
+			found = pd
+		}
+	}
+	if found == nil || found.Attempts < 1 || found.Measure == nil {
+		t.Errorf("Attempted puzzle difficulty is %+v", found)
+	}
+	if cal := CurrentCalibration(); cal.Current != puzzle.CurrentRatingBands() {
+		t.Errorf("Calibration current bands are %+v", cal.Current)
+	}
+
+	bands := puzzle.RatingBands{BoundFraction: 1, WideChoice: 3, FiveStarChoices: 4}
+	if err := ApplyRatingBands(puzzle.RatingBands{BoundFraction: -1}, 0); err == nil {
+		t.Errorf("Applied invalid bands")
+	}
+	if err := ApplyRatingBands(bands, 7); err != nil {
+		t.Fatalf("Failed to apply bands: %v", err)
+	}
+	puzzle.SetRatingBands(puzzle.DefaultRatingBands)
+	if restored := RestoreRatingBands(); restored != bands {
+		t.Errorf("Restored bands %+v, expected %+v", restored, bands)
+	}
+}
+
+func TestTimerClock(t *testing.T) {
+	start := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time { return start.Add(time.Duration(secs) * time.Second) }
+	tm := &Timer{Started: start}
+	if e := tm.elapsedAt(at(10)); e != 0 {
+		t.Errorf("Unstarted timer elapsed %v", e)
+	}
+	tm.resume(start)
+	tm.resume(at(5))
+	if e := tm.elapsedAt(at(10)); e != 10*time.Second {
+		t.Errorf("Running timer elapsed %v, expected 10s", e)
+	}
+	tm.pause(at(10))
+	tm.pause(at(15))
+	if e := tm.elapsedAt(at(3600)); e != 10*time.Second || tm.Running {
+		t.Errorf("Paused timer elapsed %v (running %v), expected 10s", e, tm.Running)
+	}
+	tm.resume(at(20))
+	if e := tm.elapsedAt(at(25)); e != 15*time.Second {
+		t.Errorf("Resumed timer elapsed %v, expected 15s", e)
+	}
+	// clocks never run backward
+	if e := tm.elapsedAt(at(0)); e != 10*time.Second {
+		t.Errorf("Timer elapsed %v before it was resumed", e)
+	}
+}
+
+func TestTimers(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testTimers")
+	ts.SelectPuzzle(testData[1].name)
+	if tm := ts.PauseTimer(); tm != nil && tm.Running {
+		t.Errorf("Paused timer is %+v", tm)
+	}
+	c := testData[1].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+	tm := ts.Timer()
+	if tm == nil || !tm.Running {
+		t.Fatalf("Timer after a move is %+v", tm)
+	}
+	paused := ts.PauseTimer()
+	if paused == nil || paused.Running || paused.Elapsed < tm.Elapsed {
+		t.Fatalf("Paused timer is %+v", paused)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// the timer survives reloading the session
+	ts = LoadSession("testTimers")
+	if tm := ts.Timer(); tm == nil || tm.Running ||
+		tm.Elapsed.Truncate(time.Millisecond) != paused.Elapsed.Truncate(time.Millisecond) {
+		t.Errorf("Reloaded paused timer is %+v, expected %+v", tm, paused)
+	}
+	if tm := ts.ResumeTimer(); tm == nil || !tm.Running {
+		t.Errorf("Resumed timer is %+v", tm)
+	}
+	ts.PauseTimer()
+	ts.RemoveStep()
+	if tm := ts.Timer(); tm == nil || !tm.Running {
+		t.Errorf("Timer after a move while paused is %+v", tm)
+	}
+	if sc := ts.Score(); sc.Elapsed < paused.Elapsed {
+		t.Errorf("Score elapsed %v is less than timer's %v", sc.Elapsed, paused.Elapsed)
+	}
+}
+
+func TestCompletionStatistics(t *testing.T) {
+	day := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	on := func(days int, rating int, elapsed time.Duration, daily bool) Completion {
+		return Completion{Rating: rating, Elapsed: elapsed, Daily: daily, Completed: day.AddDate(0, 0, days)}
+	}
+	cs := []Completion{
+		on(0, 1, time.Minute, true),
+		on(1, 1, 3*time.Minute, true),
+		on(1, 3, 0, false),
+		on(2, 3, 10*time.Minute, false),
+		on(5, 1, 0, true),
+		on(6, 2, 4*time.Minute, false),
+	}
+	st := CompletionStatistics(cs, day.AddDate(0, 0, 7))
+	expect := []RatingTimes{
+		{Rating: 1, Completed: 3, Average: 2 * time.Minute},
+		{Rating: 2, Completed: 1, Average: 4 * time.Minute},
+		{Rating: 3, Completed: 2, Average: 10 * time.Minute},
+	}
+	if st.Completed != 6 || !reflect.DeepEqual(st.Ratings, expect) {
+		t.Errorf("Completion statistics are %+v, expected ratings %+v", st, expect)
+	}
+	if st.Streak != (Streak{Current: 2, Longest: 3}) || st.DailyStreak != (Streak{Current: 0, Longest: 2}) {
+		t.Errorf("Streaks are %+v and %+v", st.Streak, st.DailyStreak)
+	}
+	// a day without a completion ends the current streak
+	if st := CompletionStatistics(cs, day.AddDate(0, 0, 8)); st.Streak.Current != 0 {
+		t.Errorf("Streak after a day off is %+v", st.Streak)
+	}
+	if st := CompletionStatistics(nil, day); st.Completed != 0 || len(st.Ratings) != 0 || st.Streak != (Streak{}) {
+		t.Errorf("Statistics without completions are %+v", st)
+	}
+
+	ma := newMistakeAnalytics()
+	ma.Justified["naked-single"], ma.Missed["naked-single"] = 4, 1
+	ts := techniqueStatistics(ma)
+	if ns := ts["naked-single"]; ns == nil || ns.Used != 4 || ns.SuccessRate != 0.75 {
+		t.Errorf("Naked single stats are %+v", ns)
+	}
+	if hs := ts["hidden-single"]; hs == nil || hs.Used != 0 || hs.SuccessRate != 0 {
+		t.Errorf("Unused hidden single stats are %+v", hs)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testStatistics")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	before := ts.Statistics()
+	c := testData[0].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+	ts.Hint()
+	ts.RemoveStep()
+	ts.RecordScore()
+	st := ts.Statistics()
+	if st.Started < 1 || st.Completed != before.Completed+1 ||
+		st.Hints != before.Hints+1 || st.Undos != before.Undos+1 {
+		t.Errorf("Statistics went from %+v to %+v", before, st)
+	}
+	if st.Streak.Current < 1 || len(st.Ratings) == 0 || len(st.Techniques) != len(PracticeTechniques()) {
+		t.Errorf("Statistics are %+v", st)
+	}
+}
+
+func TestRankLeaderboard(t *testing.T) {
+	day := time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int, hints int, elapsed time.Duration) LeaderboardEntry {
+		return LeaderboardEntry{Hints: hints, Elapsed: elapsed, Completed: day.Add(time.Duration(minutes) * time.Minute)}
+	}
+	entries := []LeaderboardEntry{
+		at(1, 1, time.Minute),
+		at(2, 0, 5*time.Minute),
+		at(3, 0, 0),
+		at(4, 0, 2*time.Minute),
+		at(5, 0, 1*time.Minute), // a repeat, which doesn't count
+		at(6, 0, 5*time.Minute),
+	}
+	sids := []string{"a", "b", "c", "d", "d", "e"}
+	board := rankLeaderboard(entries, sids, "a", 3)
+	var ranks []int
+	var hints []int
+	for _, e := range board {
+		ranks, hints = append(ranks, e.Rank), append(hints, e.Hints)
+	}
+	// d, then b and e tied, then c (untimed), then a (hinted)
+	if !reflect.DeepEqual(ranks, []int{1, 2, 2, 5}) || !reflect.DeepEqual(hints, []int{0, 0, 0, 1}) {
+		t.Errorf("Leaderboard ranks are %v with hints %v", ranks, hints)
+	}
+	if board[0].Player != PlayerTag("d") || board[0].Elapsed != 2*time.Minute || !board[3].Self {
+		t.Errorf("Leaderboard is %+v", board)
+	}
+	if board[1].Player == board[2].Player {
+		t.Errorf("Different sessions have the same player tag %q", board[1].Player)
+	}
+	if board := rankLeaderboard(entries, sids, "d", 3); len(board) != 3 || !board[0].Self {
+		t.Errorf("Leaderboard with self on top is %+v", board)
+	}
+}
+
+func TestRankRoundResults(t *testing.T) {
+	at := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	results := []RoundResult{
+		{Score: &Score{Total: 900}, Completed: at},
+		{Score: &Score{Total: 1200}, Completed: at.Add(time.Minute)},
+		{Score: &Score{Total: 900}, Completed: at.Add(2 * time.Minute)},
+	}
+	ranked := rankRoundResults(results, []string{"a", "b", "c"}, "c")
+	if len(ranked) != 3 || ranked[0].Player != PlayerTag("b") || ranked[0].Rank != 1 {
+		t.Fatalf("Ranked results are %+v", ranked)
+	}
+	if ranked[1].Player != PlayerTag("a") || ranked[1].Rank != 2 || ranked[2].Rank != 2 || !ranked[2].Self {
+		t.Errorf("Tied results are %+v, %+v", ranked[1], ranked[2])
+	}
+}
+
+func TestRankStandings(t *testing.T) {
+	totals := []map[string]int{{"a": 500, "b": 800}, {"a": 700, "c": 400}}
+	standings := rankStandings([]string{"a", "b", "c", "d"}, totals, "d")
+	expected := []Standing{
+		{Rank: 1, Player: PlayerTag("a"), Total: 1200, Rounds: []int{500, 700}},
+		{Rank: 2, Player: PlayerTag("b"), Total: 800, Rounds: []int{800, 0}},
+		{Rank: 3, Player: PlayerTag("c"), Total: 400, Rounds: []int{0, 400}},
+		{Rank: 4, Player: PlayerTag("d"), Self: true, Total: 0, Rounds: []int{0, 0}},
+	}
+	if !reflect.DeepEqual(standings, expected) {
+		t.Errorf("Standings are %+v, expected %+v", standings, expected)
+	}
+	if standings := rankStandings([]string{"x", "y"}, nil, ""); standings[0].Rank != 1 || standings[1].Rank != 1 {
+		t.Errorf("Standings before any round are %+v", standings)
+	}
+}
+
+func TestDrawBracket(t *testing.T) {
+	at := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	entrants := []string{"a", "b", "c", "d", "e"}
+	outcomes := []roundOutcome{
+		{
+			totals:    map[string]int{"a": 500, "b": 900, "c": 700, "d": 700, "e": 400},
+			completed: map[string]time.Time{"b": at, "c": at.Add(time.Minute), "d": at, "e": at},
+			ended:     true,
+		},
+		{totals: map[string]int{"c": 300}, completed: map[string]time.Time{"c": at}},
+	}
+	bracket := drawBracket(entrants, outcomes, "c")
+	expected := []BracketRound{
+		{Round: 1, Matches: []Match{
+			{Players: [2]string{PlayerTag("a"), ""}, Totals: [2]int{500, 0}, Winner: PlayerTag("a")},
+			{Players: [2]string{PlayerTag("b"), PlayerTag("e")}, Totals: [2]int{900, 400}, Winner: PlayerTag("b")},
+			{Players: [2]string{PlayerTag("c"), PlayerTag("d")}, Totals: [2]int{700, 700}, Winner: PlayerTag("d"), Self: true},
+		}},
+		{Round: 2, Matches: []Match{
+			{Players: [2]string{PlayerTag("a"), ""}, Totals: [2]int{0, 0}},
+			{Players: [2]string{PlayerTag("b"), PlayerTag("d")}, Totals: [2]int{0, 0}},
+		}},
+	}
+	if !reflect.DeepEqual(bracket, expected) {
+		t.Errorf("Bracket is %+v, expected %+v", bracket, expected)
+	}
+	outcomes[1].ended = true
+	outcomes = append(outcomes, roundOutcome{ended: true}, roundOutcome{ended: true})
+	bracket = drawBracket(entrants, outcomes, "")
+	if len(bracket) != 3 || len(bracket[2].Matches) != 1 || bracket[2].Matches[0].Winner != PlayerTag("a") {
+		t.Errorf("Finished bracket is %+v", bracket)
+	}
+	if bracket := drawBracket([]string{"x"}, outcomes, ""); len(bracket) != 0 {
+		t.Errorf("Bracket with one entrant is %+v", bracket)
+	}
+}
+
+func TestDailies(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	now := time.Now()
+	today := DailyDate(now)
+	set := DailyPuzzles(now, 1)
+	if len(set) == 0 {
+		t.Fatalf("No puzzles of the day")
+	}
+	for i, d := range set {
+		if !d.Date.Equal(today) || d.Rating < 1 || d.Rating > 5 || (i > 0 && d.Rating <= set[i-1].Rating) {
+			t.Errorf("Puzzle of the day %d is %+v", i, d)
+		}
+	}
+	if fresh := PublishDailies(now); len(fresh) != 0 {
+		t.Errorf("Published %d puzzles a second time", len(fresh))
+	}
+	if !IsDailyPuzzle(now, set[0].Info.PuzzleId) {
+		t.Errorf("Puzzle %q isn't a puzzle of the day", set[0].Info.Name)
+	}
+	archive := DailyArchive(now.AddDate(0, 0, 1), 1)
+	if len(archive) != len(set) || archive[0].Info.PuzzleId != set[0].Info.PuzzleId {
+		t.Errorf("Archive is %+v, expected %+v", archive, set)
+	}
+
+	// queue a puzzle far enough ahead that no one will publish it
+	future := now.AddDate(0, 0, 1000)
+	d, err := QueueDaily(future, testData[0].name)
+	if err != nil {
+		t.Fatalf("Failed to queue %q: %v", testData[0].name, err)
+	}
+	defer UnqueueDaily(future, d.Rating)
+	found := false
+	for _, q := range QueuedDailies() {
+		found = found || (q.Date.Equal(DailyDate(future)) && q.Info.Name == testData[0].name)
+	}
+	if !found {
+		t.Errorf("Queued puzzle isn't in the queue")
+	}
+	found = false
+	for _, p := range DailyPuzzles(future, 1) {
+		found = found || (p.Rating == d.Rating && p.Info.Name == testData[0].name)
+	}
+	if !found {
+		t.Errorf("Queued puzzle isn't in the preview")
+	}
+	if _, err := QueueDaily(now, testData[0].name); err == nil {
+		t.Errorf("Queued a puzzle for a published day")
+	}
+	if _, err := QueueDaily(future, "no-such-puzzle"); err == nil {
+		t.Errorf("Queued a puzzle that isn't in the library")
+	}
+	if !UnqueueDaily(future, d.Rating) || UnqueueDaily(future, d.Rating) {
+		t.Errorf("Unqueueing didn't remove the queued puzzle exactly once")
+	}
+
+	// completing a puzzle of the day puts the session on its leaderboard
+	ts := LoadSession("testDailies")
+	ts.SelectPuzzle(set[0].Info.Name)
+	ts.RecordScore()
+	board := DailyLeaderboard(now, set[0].Rating, "testDailies", 20)
+	found = false
+	for _, e := range board {
+		found = found || e.Self
+	}
+	if !found {
+		t.Errorf("Session isn't on the leaderboard %+v", board)
+	}
+}
+
+func TestTournaments(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	name := "test-tournament"
+	DeleteTournament(name)
+	defer DeleteTournament(name)
+	now := time.Now()
+	specs := []RoundSpec{
+		{Puzzle: testData[0].name, Starts: now.Add(-time.Hour), Ends: now.Add(time.Hour)},
+		{Puzzle: testData[1].name, Starts: now.Add(2 * time.Hour), Ends: now.Add(3 * time.Hour)},
+	}
+	tm, err := CreateTournament(name, specs)
+	if err != nil {
+		t.Fatalf("Failed to create tournament: %v", err)
+	}
+	if len(tm.Rounds) != 2 || tm.Rounds[0].Info == nil || tm.Rounds[0].Info.Name != testData[0].name {
+		t.Fatalf("Tournament is %+v", tm)
+	}
+	if tm.Rounds[1].Info != nil || tm.Rounds[1].Values != nil {
+		t.Errorf("Round that hasn't started shows its puzzle: %+v", tm.Rounds[1])
+	}
+	for _, bad := range [][]RoundSpec{
+		nil,
+		{{Puzzle: testData[0].name, Starts: now, Ends: now}},
+		{specs[1], specs[0]},
+		{{Puzzle: "no-such-puzzle", Starts: now, Ends: now.Add(time.Hour)}},
+	} {
+		if _, err := CreateTournament("test-bad-tournament", bad); err == nil {
+			DeleteTournament("test-bad-tournament")
+			t.Errorf("Created a tournament with rounds %+v", bad)
+		}
+	}
+	if _, err := CreateTournament(name, specs); err == nil {
+		t.Errorf("Created a tournament twice")
+	}
+	if _, err := CreateTournament("Bad Name", specs); err == nil {
+		t.Errorf("Created a tournament with a bad name")
+	}
+
+	// an entrant completing the round's puzzle gets a result
+	ts := LoadSession("testTournament")
+	if !ts.EnterTournament(name) || !ts.EnterTournament(name) || ts.EnterTournament("no-such-tournament") {
+		t.Errorf("Entering tournaments gave the wrong results")
+	}
+	if tm = FindTournament(name, now); tm == nil || tm.Entrants != 1 {
+		t.Errorf("Tournament after entering is %+v", tm)
+	}
+	ts.SelectPuzzle(testData[0].name)
+	ts.RecordScore()
+	results, ok := RoundResults(name, 1, "testTournament")
+	if !ok || len(results) != 1 || !results[0].Self || results[0].Rank != 1 || results[0].Score == nil {
+		t.Fatalf("Round results are %+v (%v)", results, ok)
+	}
+	if results, ok := RoundResults(name, 2, "testTournament"); !ok || len(results) != 0 {
+		t.Errorf("Results of a round that hasn't started are %+v (%v)", results, ok)
+	}
+	if _, ok := RoundResults(name, 3, ""); ok {
+		t.Errorf("Found results for a missing round")
+	}
+	standings, ok := TournamentStandings(name, "testTournament", now)
+	if !ok || len(standings) != 1 || !standings[0].Self || standings[0].Total != results[0].Score.Total ||
+		len(standings[0].Rounds) != 1 {
+		t.Errorf("Standings are %+v (%v)", standings, ok)
+	}
+	if bracket, ok := TournamentBracket(name, "testTournament", now); !ok || len(bracket) != 0 {
+		t.Errorf("Bracket with one entrant is %+v (%v)", bracket, ok)
+	}
+
+	// the round's results are announced once it ends, and only once
+	announced := func(at time.Time) bool {
+		for _, f := range FinishRounds(at) {
+			if f.Tournament == name {
+				return f.Round.Round == 1 && len(f.Results) == 1 && f.Round.Info != nil
+			}
+		}
+		return false
+	}
+	if announced(now) || !announced(now.Add(90*time.Minute)) || announced(now.Add(90*time.Minute)) {
+		t.Errorf("Round wasn't announced exactly once, when it ended")
+	}
+	if !DeleteTournament(name) || DeleteTournament(name) {
+		t.Errorf("Deleting didn't remove the tournament exactly once")
+	}
+}
+
+func TestValidReplayTitle(t *testing.T) {
+	for title, ok := range map[string]bool{
+		"A tidy solve":          true,
+		"":                      false,
+		"   ":                   false,
+		"bad\ttitle":            false,
+		strings.Repeat("x", 80): true,
+		strings.Repeat("x", 81): false,
+		"Ünïcödé is fine":       true,
+	} {
+		if ValidReplayTitle(title) != ok {
+			t.Errorf("ValidReplayTitle(%q) is %v", title, !ok)
+		}
+	}
+}
+
+func TestReplays(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testReplays")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	if _, err := ts.PublishReplay("Not done yet"); err == nil {
+		t.Errorf("Published a replay of an incomplete puzzle")
+	}
+	sols, err := ts.Puzzle.Solutions()
+	if err != nil || len(sols) == 0 {
+		t.Fatalf("Couldn't solve %q: %v", testData[0].name, err)
+	}
+	start := loadPuzzleEntry(ts.Info.PuzzleId).Values
+	for i, v := range sols[0].Values {
+		if start[i] != 0 {
+			continue
+		}
+		c := puzzle.Choice{Index: i + 1, Value: v}
+		if _, err := ts.Puzzle.Assign(c); err != nil {
+			t.Fatalf("Failed to assign %v: %v", c, err)
+		}
+		ts.AddStep(c)
+	}
+	if ts.Info.Remaining != 0 {
+		t.Fatalf("Solved puzzle has %d remaining", ts.Info.Remaining)
+	}
+	if _, err := ts.PublishReplay("Not recorded yet"); err == nil {
+		t.Errorf("Published a replay with no recorded completion")
+	}
+	sc := ts.RecordScore()
+	if _, err := ts.PublishReplay("\x00"); err == nil {
+		t.Errorf("Published a replay with a bad title")
+	}
+	rp, err := ts.PublishReplay("  A 100% clean solve  ")
+	if err != nil {
+		t.Fatalf("Failed to publish replay: %v", err)
+	}
+	if rp.Title != "A 100% clean solve" || rp.Total != sc.Total || rp.Puzzle != testData[0].name ||
+		rp.Moves != len(ts.Moves()) || !rp.Self {
+		t.Errorf("Published replay is %+v (score %+v)", rp, sc)
+	}
+	again, err := ts.PublishReplay("Retitled")
+	if err != nil || again.Id != rp.Id {
+		t.Errorf("Republishing gave %+v (%v), not a replacement for %d", again, err, rp.Id)
+	}
+
+	// browse and search
+	found := func(q ReplayQuery, sid string) *Replay {
+		for _, r := range Replays(q, sid) {
+			if r.Id == rp.Id {
+				return r
+			}
+		}
+		return nil
+	}
+	if r := found(ReplayQuery{Puzzle: testData[0].name}, "testReplays"); r == nil || r.Title != "Retitled" || !r.Self {
+		t.Errorf("Browsing by puzzle found %+v", r)
+	}
+	if r := found(ReplayQuery{Text: "RETITLE", Order: BestReplays}, ""); r == nil || r.Self {
+		t.Errorf("Searching by title found %+v", r)
+	}
+	if r := found(ReplayQuery{Text: "%"}, ""); r != nil {
+		t.Errorf("Search text wildcard matched %+v", r)
+	}
+	if r := found(ReplayQuery{Puzzle: testData[1].name}, ""); r != nil {
+		t.Errorf("Browsing another puzzle found %+v", r)
+	}
+	if r := found(ReplayQuery{MinRating: rp.Rating + 1}, ""); r != nil {
+		t.Errorf("Browsing harder puzzles found %+v", r)
+	}
+
+	// playback
+	r, pb := FindReplay(rp.Id, "")
+	if r == nil || pb == nil || len(pb.Frames) != r.Moves || pb.PuzzleId != ts.Info.PuzzleId || r.Self {
+		t.Errorf("Replay %d is %+v with playback %+v", rp.Id, r, pb)
+	}
+	if r, pb := FindReplay(-1, ""); r != nil || pb != nil {
+		t.Errorf("Found a missing replay: %+v", r)
+	}
+
+	// removal
+	other := LoadSession("testReplaysOther")
+	if other.UnpublishReplay(rp.Id) {
+		t.Errorf("Another session unpublished the replay")
+	}
+	if !ts.UnpublishReplay(rp.Id) || ts.UnpublishReplay(rp.Id) {
+		t.Errorf("Unpublishing gave the wrong results")
+	}
+	if rp, err = ts.PublishReplay("Back again"); err != nil {
+		t.Fatalf("Failed to republish replay: %v", err)
+	}
+	if !DeleteReplay(rp.Id) || DeleteReplay(rp.Id) {
+		t.Errorf("Deleting gave the wrong results")
+	}
+}
+
+func TestScannedPuzzles(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	// a library puzzle with one more square filled in
+	ts := LoadSession("testScannedPuzzles")
+	ts.SelectPuzzle(testData[0].name)
+	pe := loadPuzzleEntry(ts.Info.PuzzleId)
+	summary := &puzzle.Summary{Geometry: pe.Geometry, SideLength: int(pe.SideLength)}
+	for _, v := range pe.Values {
+		summary.Values = append(summary.Values, int(v))
+	}
+	c := testData[0].choices[0]
+	summary.Values[c.Index-1] = c.Value
+	entries := len(ts.entries)
+	ts.AddScannedPuzzle(summary)
+	if ts.Info.Name != "scan-1" || ts.Info.PuzzleId == pe.PuzzleId || len(ts.entries) != entries+1 ||
+		ts.Info.Remaining != countZeroes(pe.Values)-1 {
+		t.Errorf("Scanned puzzle info is %+v", ts.Info)
+	}
+	ts.SelectPuzzle(testData[0].name)
+	ts.AddScannedPuzzle(summary)
+	if ts.Info.Name != "scan-1" || len(ts.entries) != entries+1 {
+		t.Errorf("Rescanned puzzle info is %+v", ts.Info)
+	}
+	if ts = LoadSession("testScannedPuzzles"); ts.Info.Name != "scan-1" {
+		t.Errorf("Reloaded session's active puzzle is %q", ts.Info.Name)
+	}
+
+	// a session at its limit gets no more puzzles
+	SetSessionPuzzleLimit(len(ts.entries))
+	defer SetSessionPuzzleLimit(0)
+	c = testData[0].choices[1]
+	summary.Values[c.Index-1] = c.Value
+	func() {
+		defer func() {
+			err, ok := recover().(puzzle.Error)
+			if !ok || err.Condition != puzzle.QuotaExceededCondition {
+				t.Errorf("Scanning past the limit gave %v", err)
+			}
+		}()
+		ts.AddScannedPuzzle(summary)
+	}()
+	if len(ts.entries) != entries+1 || ts.Info.Name != "scan-1" {
+		t.Errorf("Session past its limit has %d entries, active %q", len(ts.entries), ts.Info.Name)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	start := time.Now().Add(-time.Minute)
+	target := fmt.Sprintf("testAuditLog-%d", time.Now().UnixNano())
+	first := RecordAudit("admin", "test.add", target, "192.0.2.1", map[string]interface{}{"count": 3})
+	second := RecordAudit("teacher:test", "test.remove", target, "192.0.2.2", nil)
+	if first.Id == 0 || second.Id <= first.Id || first.Occurred.IsZero() {
+		t.Fatalf("Recorded entries have ids %d and %d, time %v", first.Id, second.Id, first.Occurred)
+	}
+
+	entries := AuditLog(AuditQuery{Target: target})
+	if len(entries) != 2 || entries[0].Id != second.Id || entries[1].Id != first.Id {
+		t.Fatalf("Audit log for %s is %+v", target, entries)
+	}
+	if e := entries[1]; e.Actor != "admin" || e.Address != "192.0.2.1" || e.Details["count"] != float64(3) {
+		t.Errorf("First entry is %+v", e)
+	}
+	if entries[0].Details != nil {
+		t.Errorf("Entry without details has details %v", entries[0].Details)
+	}
+	if es := AuditLog(AuditQuery{Target: target, Action: "test."}); len(es) != 2 {
+		t.Errorf("Action prefix query found %d entries", len(es))
+	}
+	if es := AuditLog(AuditQuery{Target: target, Action: "test.add"}); len(es) != 1 || es[0].Id != first.Id {
+		t.Errorf("Action query found %+v", es)
+	}
+	if es := AuditLog(AuditQuery{Target: target, Actor: "teacher:test"}); len(es) != 1 || es[0].Id != second.Id {
+		t.Errorf("Actor query found %+v", es)
+	}
+	if es := AuditLog(AuditQuery{Target: target, Since: start, Count: 1, Offset: 1}); len(es) != 1 || es[0].Id != first.Id {
+		t.Errorf("Paged query found %+v", es)
+	}
+	if es := AuditLog(AuditQuery{Target: target, Until: start}); len(es) != 0 {
+		t.Errorf("Query before the entries found %+v", es)
+	}
+
+	// the log can't be changed or trimmed
+	pgExecute(func(tx *pgx.Tx) error {
+		if _, err := tx.Exec("UPDATE auditLog SET actor = 'mallory' WHERE target = $1", target); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM auditLog WHERE target = $1", target)
+		return err
+	})
+	entries = AuditLog(AuditQuery{Target: target})
+	if len(entries) != 2 || entries[1].Actor != "admin" {
+		t.Errorf("Audit log changed to %+v", entries)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	AddTeacher("test-annotator")
+	ts := LoadSession("testAnnotations")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	for _, a := range ts.Puzzle.Annotations() {
+		ts.RemoveAnnotation(a.Id, "")
+		ts.RemoveAnnotation(a.Id, "test-annotator")
+	}
+
+	mine, err := ts.Annotate(puzzle.Annotation{Square: 1, Text: "start here"}, "")
+	if err != nil || mine.Id == 0 || mine.Author == "" || mine.Author == "test-annotator" {
+		t.Fatalf("Player annotation is %+v, %v", mine, err)
+	}
+	row := puzzle.GroupID{Gtype: puzzle.GtypeRow, Index: 1}
+	theirs, err := ts.Annotate(puzzle.Annotation{Group: &row, Text: "check this row"}, "test-annotator")
+	if err != nil || theirs.Author != "test-annotator" {
+		t.Fatalf("Teacher annotation is %+v, %v", theirs, err)
+	}
+	if _, err := ts.Annotate(puzzle.Annotation{Square: 1000, Text: "off the puzzle"}, ""); err == nil {
+		t.Errorf("Annotation off the puzzle was accepted")
+	}
+
+	// notes survive moves, undo, and reloading
+	c := testData[0].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+	ts.RemoveStep()
+	if notes := ts.Puzzle.Annotations(); len(notes) != 2 || notes[0].Id != mine.Id || notes[1].Id != theirs.Id {
+		t.Errorf("Annotations after undo are %+v", notes)
+	}
+	ts = LoadSession("testAnnotations")
+	notes := ts.Puzzle.Annotations()
+	if len(notes) != 2 || notes[0].Text != "start here" || notes[1].Group == nil || *notes[1].Group != row {
+		t.Errorf("Reloaded annotations are %+v", notes)
+	}
+	if summary, _ := ts.Puzzle.Summary(); len(summary.Annotations) != 2 {
+		t.Errorf("Summary annotations are %+v", summary.Annotations)
+	}
+
+	// each side removes only its own notes
+	if ts.RemoveAnnotation(theirs.Id, "") || ts.RemoveAnnotation(mine.Id, "test-annotator") {
+		t.Errorf("Removed someone else's annotation")
+	}
+	if !ts.RemoveAnnotation(mine.Id, "") || !ts.RemoveAnnotation(theirs.Id, "test-annotator") {
+		t.Errorf("Failed to remove own annotations")
+	}
+	if notes := LoadSession("testAnnotations").Puzzle.Annotations(); len(notes) != 0 {
+		t.Errorf("Annotations after removal are %+v", notes)
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testBookmarks")
+	for _, b := range ts.Bookmarks() {
+		ts.RemoveBookmark(b.Id)
+	}
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+
+	// a library puzzle, and a position in progress
+	lib := ts.BookmarkPuzzle(strings.ToUpper(testData[1].name), "")
+	if lib == nil || lib.Label != testData[1].name || lib.Choices != nil {
+		t.Fatalf("Library bookmark is %+v", lib)
+	}
+	if b := ts.BookmarkPuzzle("no-such-puzzle", ""); b != nil {
+		t.Errorf("Bookmarked an unknown puzzle: %+v", b)
+	}
+	c := testData[0].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+	pos := ts.BookmarkPosition("one in")
+	if pos.Label != "one in" || pos.Name != testData[0].name || !reflect.DeepEqual(pos.Choices, []puzzle.Choice{c}) {
+		t.Errorf("Position bookmark is %+v", pos)
+	}
+	bookmarks := LoadSession("testBookmarks").Bookmarks()
+	if len(bookmarks) != 2 || bookmarks[0].Id != lib.Id || bookmarks[1].Id != pos.Id ||
+		!reflect.DeepEqual(bookmarks[1].Choices, pos.Choices) {
+		t.Errorf("Bookmarks are %+v", bookmarks)
+	}
+
+	// opening a position restores its choices
+	ts.RemoveAllSteps()
+	if !ts.OpenBookmark(pos.Id) || !reflect.DeepEqual(ts.Info.Choices, []puzzle.Choice{c}) {
+		t.Errorf("Opened position has choices %v", ts.Info.Choices)
+	}
+	if !ts.OpenBookmark(lib.Id) || ts.Info.PuzzleId != lib.PuzzleId {
+		t.Errorf("Opened library bookmark to puzzle %q", ts.Info.Name)
+	}
+	if ts.OpenBookmark(-1) || LoadSession("testOtherBookmarks").OpenBookmark(pos.Id) {
+		t.Errorf("Opened a missing or someone else's bookmark")
+	}
+
+	// only the session's own bookmarks can be removed
+	if LoadSession("testOtherBookmarks").RemoveBookmark(pos.Id) {
+		t.Errorf("Removed another session's bookmark")
+	}
+	if !ts.RemoveBookmark(pos.Id) || ts.RemoveBookmark(pos.Id) {
+		t.Errorf("Removing a bookmark twice didn't fail")
+	}
+	if bookmarks := ts.Bookmarks(); len(bookmarks) != 1 || bookmarks[0].Id != lib.Id {
+		t.Errorf("Bookmarks after removal are %+v", bookmarks)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testSubscriptions")
+	for _, sub := range ts.Subscriptions() {
+		ts.Unsubscribe(sub.Topic, sub.Channel)
+	}
+	ts.Subscribe(DailyTopic, "email", "old@example.com")
+	ts.Subscribe(DailyTopic, "email", "ann@example.com")
+	ts.Subscribe(AssignmentTopic, "push", "token")
+	ts.Subscribe(TournamentTopic, "push", "token")
+	subs := ts.Subscriptions()
+	if len(subs) != 3 || subs[0].Topic != AssignmentTopic || subs[1].Address != "ann@example.com" {
+		t.Errorf("Subscriptions are %+v", subs)
+	}
+	found := false
+	for _, r := range Subscribers(DailyTopic) {
+		if r.SessionId == "testSubscriptions" {
+			found = r.Channel == "email" && r.Address == "ann@example.com"
+		}
+	}
+	if !found {
+		t.Errorf("Session isn't a daily subscriber")
+	}
+	if !ts.Unsubscribe(DailyTopic, "email") || ts.Unsubscribe(DailyTopic, "email") {
+		t.Errorf("Unsubscribing twice didn't fail")
+	}
+
+	// assignment reminders go to the class's subscribers, once
+	AddTeacher("test-notifier")
+	AddClass("test-notifier", "test-notified", "Notified Class")
+	ts.JoinClass("test-notified", "ann")
+	ts.SelectPuzzle(testData[0].name)
+	now := time.Now()
+	a := &Assignment{Class: "test-notified", Name: fmt.Sprintf("due-%d", now.UnixNano()), Title: "Due Soon",
+		Due: now.Add(time.Hour), Puzzles: []string{ts.Info.PuzzleId}}
+	AddAssignment(a)
+	later := &Assignment{Class: "test-notified", Name: a.Name + "-later", Title: "Due Later",
+		Due: now.Add(48 * time.Hour), Puzzles: a.Puzzles}
+	AddAssignment(later)
+	reminded := func(as []*Assignment, name string) bool {
+		for _, a := range as {
+			if a.Class == "test-notified" && a.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	as := RemindAssignments(now, 24*time.Hour)
+	if !reminded(as, a.Name) || reminded(as, later.Name) {
+		t.Errorf("First reminders are %+v", as)
+	}
+	if as := RemindAssignments(now, 24*time.Hour); reminded(as, a.Name) {
+		t.Errorf("Reminded of %q twice", a.Name)
+	}
+	if rs := ClassSubscribers("test-notified"); len(rs) != 1 || rs[0].Address != "token" {
+		t.Errorf("Class subscribers are %+v", rs)
+	}
+
+	// round start alerts go to the entrants' subscribers, once
+	name := "test-notified-tournament"
+	DeleteTournament(name)
+	defer DeleteTournament(name)
+	if _, err := CreateTournament(name, []RoundSpec{
+		{Puzzle: testData[0].name, Starts: now.Add(-time.Minute), Ends: now.Add(time.Hour)},
+		{Puzzle: testData[1].name, Starts: now.Add(2 * time.Hour), Ends: now.Add(3 * time.Hour)},
+	}); err != nil {
+		t.Fatalf("Failed to create tournament: %v", err)
+	}
+	if rs := TournamentSubscribers(name); len(rs) != 0 {
+		t.Errorf("Subscribers before entering are %+v", rs)
+	}
+	ts.EnterTournament(name)
+	if rs := TournamentSubscribers(name); len(rs) != 1 || rs[0].SessionId != "testSubscriptions" {
+		t.Errorf("Tournament subscribers are %+v", rs)
+	}
+	started := func(srs []*StartedRound) (rounds []int) {
+		for _, sr := range srs {
+			if sr.Tournament == name {
+				rounds = append(rounds, sr.Round.Round)
+				if sr.Round.Info == nil || sr.Round.Info.Name != testData[0].name {
+					t.Errorf("Started round is %+v", sr.Round)
+				}
+			}
+		}
+		return
+	}
+	if rounds := started(StartRounds(now)); len(rounds) != 1 || rounds[0] != 1 {
+		t.Errorf("Started rounds are %v", rounds)
+	}
+	if rounds := started(StartRounds(now)); len(rounds) != 0 {
+		t.Errorf("Started rounds again: %v", rounds)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	// every table in the schema is backed up
+	var tables []string
+	pgExecute(func(tx *pgx.Tx) error {
+		rows, err := tx.Query("SELECT table_name FROM information_schema.tables " +
+			"WHERE table_schema = 'public' AND table_name <> 'schema_migrations'")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			tables = append(tables, name)
+		}
+		return rows.Err()
+	})
+	for _, table := range tables {
+		found := false
+		for _, bt := range backupTables {
+			found = found || strings.EqualFold(table, bt)
+		}
+		if !found {
+			t.Errorf("Table %q isn't backed up", table)
+		}
+	}
+
+	ts := LoadSession("testBackup")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	c := testData[0].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+
+	b := MakeBackup()
+	if b.Format != BackupFormat || b.Schema == 0 || len(b.Tables) != len(backupTables) {
+		t.Fatalf("Backup has format %d, schema %d, and %d tables", b.Format, b.Schema, len(b.Tables))
+	}
+	encoded, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("Failed to encode backup: %v", err)
+	}
+	var decoded Backup
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode backup: %v", err)
+	}
+	total := 0
+	for _, bt := range b.Tables {
+		total += len(bt.Rows)
+	}
+	if count, err := RestoreBackup(&decoded); err != nil || count != total {
+		t.Fatalf("Restore gave %d rows (%v), expected %d", count, err, total)
+	}
+	again := MakeBackup()
+	for i, bt := range again.Tables {
+		if len(bt.Rows) != len(b.Tables[i].Rows) {
+			t.Errorf("Table %s has %d rows after restore, expected %d", bt.Name, len(bt.Rows), len(b.Tables[i].Rows))
+		}
+	}
+	ts = LoadSession("testBackup")
+	if ts.Info.Name != testData[0].name || len(ts.Info.Choices) != 1 {
+		t.Errorf("Restored session is on %q with choices %v", ts.Info.Name, ts.Info.Choices)
+	}
+
+	bad := decoded
+	bad.Format = BackupFormat + 1
+	if _, err := RestoreBackup(&bad); err == nil {
+		t.Errorf("Restored a backup with format %d", bad.Format)
+	}
+	bad = decoded
+	bad.Schema++
+	if _, err := RestoreBackup(&bad); err == nil {
+		t.Errorf("Restored a backup with schema %d", bad.Schema)
+	}
+	bad = decoded
+	bad.Tables = append([]BackupTable{{Name: "noSuchTable"}}, decoded.Tables...)
+	if _, err := RestoreBackup(&bad); err == nil {
+		t.Errorf("Restored a backup with an unknown table")
+	}
+}
+
+func TestUpgradeStep(t *testing.T) {
+	original := []int32{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	legacy := []byte(`{"geometry":"square","sidelen":4,"values":[1,2,0,0,0,0,0,0,0,0,0,0,0,0,0,0]}`)
+	upgraded, changed, err := upgradeStep(legacy, original)
+	if err != nil || !changed {
+		t.Fatalf("Upgrade of legacy step gave %v, %v", changed, err)
+	}
+	var summary puzzle.Summary
+	if err := json.Unmarshal(upgraded, &summary); err != nil {
+		t.Fatalf("Upgraded step doesn't decode: %v", err)
+	}
+	if !reflect.DeepEqual(summary.Entered, []int{2}) {
+		t.Errorf("Upgraded step has entered squares %v, expected [2]", summary.Entered)
+	}
+	if again, changed, err := upgradeStep(upgraded, original); err != nil || changed || string(again) != string(upgraded) {
+		t.Errorf("Upgrade of current step gave %s, %v, %v", again, changed, err)
+	}
+	for _, bad := range []string{
+		`not json`,
+		`{"geometry":"square","sidelen":4,"values":[1,2,0]}`,
+		`{"geometry":"square","sidelen":4,"schema":99}`,
+	} {
+		if _, _, err := upgradeStep([]byte(bad), original); err == nil {
+			t.Errorf("Upgrade of %s succeeded", bad)
+		}
+	}
+}
+
+func TestUpgradeSummaries(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	ts := LoadSession("testUpgrade")
+	ts.SelectPuzzle(testData[0].name)
+	ts.RemoveAllSteps()
+	c := testData[0].choices[0]
+	if _, err := ts.Puzzle.Assign(c); err != nil {
+		t.Fatalf("Failed to assign %v: %v", c, err)
+	}
+	ts.AddStep(c)
+
+	// make the last step look like it came from an old release
+	var last []byte
+	rdExecute(func(tx redis.Conn) (err error) {
+		last, err = redis.Bytes(tx.Do("LINDEX", ts.stepsKey(), -1))
+		return
+	})
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(last, &fields); err != nil {
+		t.Fatalf("Cached step doesn't decode: %v", err)
+	}
+	delete(fields, "schema")
+	delete(fields, "entered")
+	legacy, _ := json.Marshal(fields)
+	bogus := "SID:testUpgrade:PID:bogus:Steps"
+	rdExecute(func(tx redis.Conn) error {
+		if _, err := tx.Do("LSET", ts.stepsKey(), -1, legacy); err != nil {
+			return err
+		}
+		_, err := tx.Do("RPUSH", bogus, "not json")
+		return err
+	})
+
+	report := UpgradeSummaries()
+	if report.Upgraded < 1 || report.Dropped < 1 || report.Steps < 3 {
+		t.Errorf("Upgrade report is %+v", report)
+	}
+	var exists int
+	rdExecute(func(tx redis.Conn) (err error) {
+		if last, err = redis.Bytes(tx.Do("LINDEX", ts.stepsKey(), -1)); err != nil {
+			return
+		}
+		exists, err = redis.Int(tx.Do("EXISTS", bogus))
+		return
+	})
+	if schema, err := puzzle.SummaryJSONSchema(last); err != nil || schema != puzzle.SummarySchema {
+		t.Errorf("Upgraded step has schema %d, %v", schema, err)
+	}
+	var summary puzzle.Summary
+	if err := json.Unmarshal(last, &summary); err != nil || !reflect.DeepEqual(summary.Entered, []int{c.Index}) {
+		t.Errorf("Upgraded step has entered squares %v (%v), expected [%d]", summary.Entered, err, c.Index)
+	}
+	if exists != 0 {
+		t.Errorf("Unreadable step list wasn't dropped")
+	}
+	if again := UpgradeSummaries(); again.Upgraded != 0 {
+		t.Errorf("Second upgrade report is %+v", again)
+	}
+}
+
+func TestLessonNames(t *testing.T) {
+	for _, name := range []string{"naked-singles", "x-wing", "a"} {
+		if !ValidLessonName(name) {
+			t.Errorf("Rejected valid lesson name %q", name)
+		}
+	}
+	for _, name := range []string{"", "Upper", "trailing-", "two--dashes", "white space"} {
+		if ValidLessonName(name) {
+			t.Errorf("Accepted invalid lesson name %q", name)
+		}
+	}
+	if name := LessonPuzzleName("x-wing", 2); name != "lesson-x-wing-2" {
+		t.Errorf("Lesson puzzle name is %q", name)
+	}
+}
+
+func TestValidateSession(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	if _, ok := ValidateSession("testValidateSessionMissing"); ok {
+		t.Errorf("Validated a session that doesn't exist")
+	}
+	td := testData[0]
+	ts := LoadSession("testValidateSession")
+	ts.SelectPuzzle(td.name)
+	ts.RemoveAllSteps()
+	for _, c := range td.choices {
+		if _, err := ts.Puzzle.Assign(c); err != nil {
+			t.Fatalf("Failed to assign %v: %v", c, err)
+		}
+		ts.AddStep(c)
+	}
+	errs, ok := ValidateSession("testValidateSession")
+	if !ok {
+		t.Fatalf("Couldn't find session to validate")
+	}
+	if errs != nil {
+		t.Errorf("Session puzzle fails validation: %v", errs)
+	}
+}
+
+func TestSessionMemStats(t *testing.T) {
+	os.Setenv("DBPREP_PATH", filepath.Join("..", "dbprep"))
+	if _, _, err := Connect(); err != nil {
+		t.Fatalf("Couldn't connect to storage: %v", err)
+	}
+	defer Close()
+
+	if _, ok := SessionMemStats("testSessionMemStatsMissing"); ok {
+		t.Errorf("Measured a session that doesn't exist")
+	}
+	td := testData[0]
+	ts := LoadSession("testSessionMemStats")
+	ts.SelectPuzzle(td.name)
+	ts.RemoveAllSteps()
+	ms, ok := SessionMemStats("testSessionMemStats")
+	if !ok {
+		t.Fatalf("Couldn't find session to measure")
+	}
+	if expected, _ := ts.Puzzle.MemStats(); ms.Pvals != expected.Pvals || ms.Groups != expected.Groups {
+		t.Errorf("Session puzzle stats are %+v, expected %+v", *ms, *expected)
+	}
+}
+
 /*
 
 multiple, concurrent threads
@@ -0,0 +1,180 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"time"
+)
+
+/*
+
+timers
+
+Each session puzzle has a clock kept by the server, so it
+survives restarts and can't be fooled by the client's clock.
+The clock starts with the first move made on the puzzle, can be
+paused and resumed, and stops when the puzzle is completed.
+Any move made while it's paused resumes it.  Scores take their
+time from the clock, so time spent paused doesn't count.
+
+*/
+
+// A Timer is the clock on a session puzzle.  Elapsed is the
+// running time, not counting pauses, as of when the timer was
+// loaded.
+type Timer struct {
+	Started     time.Time     `json:"started"`
+	Running     bool          `json:"running"`
+	Elapsed     time.Duration `json:"elapsed"`
+	resumed     time.Time
+	accumulated time.Duration
+}
+
+// elapsedAt returns the running time as of the given time.
+func (t *Timer) elapsedAt(now time.Time) time.Duration {
+	if t.Running && now.After(t.resumed) {
+		return t.accumulated + now.Sub(t.resumed)
+	}
+	return t.accumulated
+}
+
+// pause stops the clock at the given time.
+func (t *Timer) pause(now time.Time) {
+	if t.Running {
+		t.accumulated = t.elapsedAt(now)
+		t.Running = false
+	}
+}
+
+// resume starts the clock again at the given time.
+func (t *Timer) resume(now time.Time) {
+	if !t.Running {
+		t.resumed = now
+		t.Running = true
+	}
+}
+
+// Timer returns the active puzzle's timer, or nil if no move has
+// been made on it.
+func (s *Session) Timer() *Timer {
+	var t *Timer
+	body := func(tx *pgx.Tx) (err error) {
+		t, err = s.loadTimer(tx, false)
+		return
+	}
+	pgExecute(body)
+	if t != nil {
+		t.Elapsed = t.elapsedAt(time.Now())
+	}
+	return t
+}
+
+// PauseTimer pauses the active puzzle's timer, returning it, or
+// nil if no move has been made on the puzzle.
+func (s *Session) PauseTimer() *Timer {
+	return s.updateTimer(time.Now(), false, (*Timer).pause)
+}
+
+// ResumeTimer resumes the active puzzle's timer, returning it, or
+// nil if no move has been made on the puzzle.
+func (s *Session) ResumeTimer() *Timer {
+	return s.updateTimer(time.Now(), false, (*Timer).resume)
+}
+
+// runTimer: start or resume the active puzzle's timer, because a
+// move was made at the given time.
+func (s *Session) runTimer(now time.Time) {
+	s.updateTimer(now, true, (*Timer).resume)
+}
+
+// stopTimer: pause the active puzzle's timer at the given time,
+// when the puzzle was completed, and return the time it ran.
+// With no timer, it returns false.
+func (s *Session) stopTimer(now time.Time) (time.Duration, bool) {
+	t := s.updateTimer(now, false, (*Timer).pause)
+	if t == nil {
+		return 0, false
+	}
+	return t.Elapsed, true
+}
+
+// updateTimer: load the active puzzle's timer, change it as of
+// the given time, and save it, all in one transaction.  If there
+// is no timer, one is started at the given time if create is
+// true, and otherwise nothing happens and the result is nil.
+func (s *Session) updateTimer(now time.Time, create bool, change func(*Timer, time.Time)) *Timer {
+	var t *Timer
+	body := func(tx *pgx.Tx) error {
+		var err error
+		if t, err = s.loadTimer(tx, true); err != nil {
+			return err
+		}
+		if t == nil {
+			if !create {
+				return nil
+			}
+			t = &Timer{Started: now}
+		}
+		change(t, now)
+		var resumed interface{}
+		if t.Running {
+			resumed = t.resumed
+		}
+		_, err = tx.Exec(
+			"INSERT INTO timers (sessionId, puzzleId, started, resumed, accumulated) "+
+				"VALUES ($1, $2, $3, $4, $5) "+
+				"ON CONFLICT (sessionId, puzzleId) DO UPDATE SET "+
+				"(resumed, accumulated) = (EXCLUDED.resumed, EXCLUDED.accumulated)",
+			s.sid, s.entries[s.active].PuzzleId, t.Started, resumed,
+			int64(t.accumulated/time.Millisecond))
+		if err != nil {
+			return fmt.Errorf("Database failure saving timer for session %q: %v", s.sid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	if t != nil {
+		t.Elapsed = t.elapsedAt(now)
+	}
+	return t
+}
+
+// loadTimer: load the active puzzle's timer in a transaction,
+// locking it for update if asked.  It's nil if there isn't one.
+func (s *Session) loadTimer(tx *pgx.Tx, lock bool) (*Timer, error) {
+	query := "SELECT started, resumed, accumulated FROM timers WHERE sessionId = $1 AND puzzleId = $2"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	t := &Timer{}
+	var resumed pgx.NullTime
+	var accumulated int64
+	err := tx.QueryRow(query, s.sid, s.entries[s.active].PuzzleId).Scan(&t.Started, &resumed, &accumulated)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Database failure loading timer for session %q: %v", s.sid, err)
+	}
+	t.resumed, t.Running = resumed.Time, resumed.Valid
+	t.accumulated = time.Duration(accumulated) * time.Millisecond
+	return t, nil
+}
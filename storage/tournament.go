@@ -0,0 +1,640 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"sort"
+	"time"
+)
+
+/*
+
+tournaments
+
+A tournament is a series of rounds.  Each round features one
+library puzzle between its start and end times, and every
+entrant plays that same puzzle over that same period: the puzzle
+isn't shown until the round starts, and only completions made
+during the round count.  An entrant's result in a round is
+scored from the moves in their journal made during the round,
+timed from the start of the round, so entrants who start late
+are charged for the delay.  The standings add up the entrants'
+round totals.
+
+The bracket is a knockout draw over the same rounds.  Entrants
+are seeded in order of entry, and in each round the best
+remaining seed meets the worst, the second best the second
+worst, and so on, with the best seed getting a bye if there's an
+odd number.  A match goes to the player with the higher round
+total, then to the earlier finisher, then to the better seed.
+Winners keep their seeds for the next round, and the bracket is
+over when one player is left.
+
+When a round ends its results are announced, once, by whichever
+server gets to it first.
+
+*/
+
+// A Tournament is a named series of rounds.
+type Tournament struct {
+	Name     string
+	Created  time.Time
+	Entrants int
+	Rounds   []*TournamentRound
+}
+
+// A TournamentRound is one round of a tournament.  Its puzzle
+// (Info and Values) is only filled in once the round has started.
+type TournamentRound struct {
+	Round  int // numbered from 1
+	Starts time.Time
+	Ends   time.Time
+	Info   *PuzzleInfo
+	Values []int
+}
+
+// A RoundSpec describes a round of a tournament being created.
+type RoundSpec struct {
+	Puzzle string    `json:"puzzle"` // the library puzzle's name
+	Starts time.Time `json:"starts"`
+	Ends   time.Time `json:"ends"`
+}
+
+// A RoundResult is one entrant's place in a round.
+type RoundResult struct {
+	Rank      int       `json:"rank"`
+	Player    string    `json:"player"`
+	Self      bool      `json:"self,omitempty"`
+	Score     *Score    `json:"score"`
+	Completed time.Time `json:"completed"`
+}
+
+// A Standing is one entrant's place in a tournament.  Rounds the
+// entrant didn't complete count zero.
+type Standing struct {
+	Rank   int    `json:"rank"`
+	Player string `json:"player"`
+	Self   bool   `json:"self,omitempty"`
+	Total  int    `json:"total"`
+	Rounds []int  `json:"rounds"` // the entrant's total in each round so far
+}
+
+// A Match is a pairing of two players in a round of a bracket.
+// The second player is empty for a bye.  The winner is only
+// filled in once the round has ended.
+type Match struct {
+	Players [2]string `json:"players"`
+	Totals  [2]int    `json:"totals"`
+	Winner  string    `json:"winner,omitempty"`
+	Self    bool      `json:"self,omitempty"` // whether the marked session is playing
+}
+
+// A BracketRound is the matches of one round of a bracket.
+type BracketRound struct {
+	Round   int     `json:"round"`
+	Matches []Match `json:"matches"`
+}
+
+// A FinishedRound is a round whose results have just been
+// announced.
+type FinishedRound struct {
+	Tournament string
+	Round      *TournamentRound
+	Results    []RoundResult
+}
+
+// ValidTournamentName: tournament names go into URLs, so they
+// follow the same rules as lesson names.
+func ValidTournamentName(name string) bool {
+	return ValidLessonName(name)
+}
+
+// CreateTournament creates a tournament with the given rounds,
+// which have to be in order and not overlap.  It's an error if
+// there's already a tournament with the name.
+func CreateTournament(name string, specs []RoundSpec) (*Tournament, error) {
+	if !ValidTournamentName(name) {
+		return nil, fmt.Errorf("Invalid tournament name %q", name)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("Tournament %q has no rounds", name)
+	}
+	infos := make([]*PuzzleInfo, len(specs))
+	for i, spec := range specs {
+		if !spec.Ends.After(spec.Starts) {
+			return nil, fmt.Errorf("Round %d of %q ends before it starts", i+1, name)
+		}
+		if i > 0 && spec.Starts.Before(specs[i-1].Ends) {
+			return nil, fmt.Errorf("Round %d of %q starts before round %d ends", i+1, name, i)
+		}
+		if infos[i] = findLibraryPuzzle(spec.Puzzle); infos[i] == nil {
+			return nil, fmt.Errorf("There is no library puzzle named %q", spec.Puzzle)
+		}
+	}
+	var created bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec(
+			"INSERT INTO tournaments (tournamentName, created) VALUES ($1, $2) "+
+				"ON CONFLICT (tournamentName) DO NOTHING",
+			name, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure creating tournament %q: %v", name, err)
+		}
+		if created = tag.RowsAffected() > 0; !created {
+			return nil
+		}
+		for i, spec := range specs {
+			_, err := tx.Exec(
+				"INSERT INTO tournamentRounds (tournamentName, round, puzzleId, puzzleName, starts, ends) "+
+					"VALUES ($1, $2, $3, $4, $5, $6)",
+				name, i+1, infos[i].PuzzleId, infos[i].Name, spec.Starts, spec.Ends)
+			if err != nil {
+				return fmt.Errorf("Database failure adding round %d to %q: %v", i+1, name, err)
+			}
+		}
+		return nil
+	}
+	pgExecute(body)
+	if !created {
+		return nil, fmt.Errorf("There is already a tournament named %q", name)
+	}
+	return FindTournament(name, time.Now()), nil
+}
+
+// DeleteTournament removes the named tournament, with its rounds
+// and entrants, reporting whether there was one.
+func DeleteTournament(name string) bool {
+	var removed bool
+	body := func(tx *pgx.Tx) error {
+		tag, err := tx.Exec("DELETE FROM tournaments WHERE tournamentName = $1", name)
+		if err != nil {
+			return fmt.Errorf("Database failure deleting tournament %q: %v", name, err)
+		}
+		removed = tag.RowsAffected() > 0
+		return nil
+	}
+	pgExecute(body)
+	return removed
+}
+
+// FindTournament returns the named tournament as of the given
+// time, or nil if there's none.
+func FindTournament(name string, now time.Time) *Tournament {
+	ts := loadTournaments(now, "WHERE t.tournamentName = $1", name)
+	if len(ts) == 0 {
+		return nil
+	}
+	return ts[0]
+}
+
+// Tournaments returns all the tournaments as of the given time,
+// newest first.
+func Tournaments(now time.Time) []*Tournament {
+	return loadTournaments(now, "")
+}
+
+// loadTournaments: load the tournaments selected by a where
+// clause, newest first, showing the puzzles of the rounds that
+// have started by the given time.
+func loadTournaments(now time.Time, where string, args ...interface{}) []*Tournament {
+	var ts []*Tournament
+	type roundRow struct {
+		t    *Tournament
+		r    *TournamentRound
+		pid  string
+		name string
+	}
+	var rows []roundRow
+	body := func(tx *pgx.Tx) error {
+		rs, err := tx.Query(
+			"SELECT t.tournamentName, t.created, "+
+				"(SELECT count(*) FROM tournamentEntrants e WHERE e.tournamentName = t.tournamentName) "+
+				"FROM tournaments t "+where+" ORDER BY t.created DESC, t.tournamentName", args...)
+		if err != nil {
+			return fmt.Errorf("Database failure loading tournaments: %v", err)
+		}
+		byName := make(map[string]*Tournament)
+		for rs.Next() {
+			t := &Tournament{}
+			var entrants int64
+			if err := rs.Scan(&t.Name, &t.Created, &entrants); err != nil {
+				rs.Close()
+				return fmt.Errorf("Database failure reading tournaments: %v", err)
+			}
+			t.Entrants = int(entrants)
+			ts, byName[t.Name] = append(ts, t), t
+		}
+		if err := rs.Err(); err != nil {
+			return fmt.Errorf("Database failure reading tournaments: %v", err)
+		}
+		rs, err = tx.Query(
+			"SELECT tournamentName, round, puzzleId, puzzleName, starts, ends " +
+				"FROM tournamentRounds ORDER BY tournamentName, round")
+		if err != nil {
+			return fmt.Errorf("Database failure loading tournament rounds: %v", err)
+		}
+		defer rs.Close()
+		for rs.Next() {
+			var name string
+			var round int32
+			row := roundRow{r: &TournamentRound{}}
+			if err := rs.Scan(&name, &round, &row.pid, &row.name, &row.r.Starts, &row.r.Ends); err != nil {
+				return fmt.Errorf("Database failure reading tournament rounds: %v", err)
+			}
+			if row.t = byName[name]; row.t != nil {
+				row.r.Round = int(round)
+				rows = append(rows, row)
+			}
+		}
+		return rs.Err()
+	}
+	pgExecute(body)
+	for _, row := range rows {
+		if !now.Before(row.r.Starts) {
+			row.r.Info, row.r.Values = featuredPuzzle(row.pid, row.name)
+		}
+		row.t.Rounds = append(row.t.Rounds, row.r)
+	}
+	return ts
+}
+
+// EnterTournament enters the session in the named tournament,
+// reporting whether there is such a tournament that hasn't yet
+// finished.  Entering more than once is harmless.
+func (s *Session) EnterTournament(name string) bool {
+	t := FindTournament(name, time.Now())
+	if t == nil || !time.Now().Before(t.Rounds[len(t.Rounds)-1].Ends) {
+		return false
+	}
+	body := func(tx *pgx.Tx) error {
+		_, err := tx.Exec(
+			"INSERT INTO tournamentEntrants (tournamentName, sessionId, entered) VALUES ($1, $2, $3) "+
+				"ON CONFLICT (tournamentName, sessionId) DO NOTHING",
+			name, s.sid, time.Now())
+		if err != nil {
+			return fmt.Errorf("Database failure entering session %q in %q: %v", s.sid, name, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return true
+}
+
+// RoundResults returns the results so far of a round of the
+// named tournament, best first, marking the given session's
+// result.  Returns false if there's no such round.
+func RoundResults(name string, round int, sid string) ([]RoundResult, bool) {
+	var pid string
+	var starts, ends time.Time
+	found := false
+	body := func(tx *pgx.Tx) error {
+		err := tx.QueryRow(
+			"SELECT puzzleId, starts, ends FROM tournamentRounds WHERE tournamentName = $1 AND round = $2",
+			name, round).Scan(&pid, &starts, &ends)
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Database failure loading round %d of %q: %v", round, name, err)
+		}
+		found = true
+		return nil
+	}
+	pgExecute(body)
+	if !found {
+		return nil, false
+	}
+	results, sids := roundScores(name, pid, starts, ends)
+	return rankRoundResults(results, sids, sid), true
+}
+
+// roundScores: score each entrant's first completion of a round's
+// puzzle during the round, in completion order, returning the
+// results with the sessions that made them.
+func roundScores(name, pid string, starts, ends time.Time) ([]RoundResult, []string) {
+	var results []RoundResult
+	var sids []string
+	var ratings []int
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT DISTINCT ON (c.sessionId) c.sessionId, c.rating, c.completed FROM completions c "+
+				"JOIN tournamentEntrants e ON e.sessionId = c.sessionId AND e.tournamentName = $1 "+
+				"WHERE c.puzzleId = $2 AND c.completed >= $3 AND c.completed < $4 "+
+				"ORDER BY c.sessionId, c.completed",
+			name, pid, starts, ends)
+		if err != nil {
+			return fmt.Errorf("Database failure loading results for %q: %v", name, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var csid string
+			var rating int32
+			var r RoundResult
+			if err := rows.Scan(&csid, &rating, &r.Completed); err != nil {
+				return fmt.Errorf("Database failure reading results for %q: %v", name, err)
+			}
+			results, sids, ratings = append(results, r), append(sids, csid), append(ratings, int(rating))
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	if len(results) == 0 {
+		return nil, nil
+	}
+	empty := countZeroes(loadPuzzleEntry(pid).Values)
+	moves := loadRoundMoves(name, pid, starts, ends)
+	for i := range results {
+		var made []Move
+		for _, m := range moves[sids[i]] {
+			if !m.Made.After(results[i].Completed) {
+				made = append(made, m)
+			}
+		}
+		results[i].Score = ScoreTimed(ratings[i], empty, made, results[i].Completed.Sub(starts))
+	}
+	return results, sids
+}
+
+// loadRoundMoves: load the moves the entrants of a tournament made
+// on a round's puzzle during the round, by session, in order.
+func loadRoundMoves(name, pid string, starts, ends time.Time) map[string][]Move {
+	moves := make(map[string][]Move)
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT m.sessionId, m.kind, m.squareIndex, m.squareValue, m.mistake, m.made FROM moveJournal m "+
+				"JOIN tournamentEntrants e ON e.sessionId = m.sessionId AND e.tournamentName = $1 "+
+				"WHERE m.puzzleId = $2 AND m.made >= $3 AND m.made < $4 "+
+				"ORDER BY m.sessionId, m.moveId",
+			name, pid, starts, ends)
+		if err != nil {
+			return fmt.Errorf("Database failure loading moves for %q: %v", name, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var msid string
+			var m Move
+			var index, value pgx.NullInt32
+			if err := rows.Scan(&msid, &m.Kind, &index, &value, &m.Mistake, &m.Made); err != nil {
+				return fmt.Errorf("Database failure reading moves for %q: %v", name, err)
+			}
+			m.Choice = puzzle.Choice{Index: int(index.Int32), Value: int(value.Int32)}
+			moves[msid] = append(moves[msid], m)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return moves
+}
+
+// rankRoundResults ranks round results, with the sessions that
+// made them, by score total and then by completion time.  Equal
+// totals share a rank.
+func rankRoundResults(results []RoundResult, sids []string, sid string) []RoundResult {
+	ranked := make([]RoundResult, len(results))
+	for i, r := range results {
+		r.Player, r.Self = PlayerTag(sids[i]), sids[i] == sid
+		ranked[i] = r
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score.Total != ranked[j].Score.Total {
+			return ranked[i].Score.Total > ranked[j].Score.Total
+		}
+		return ranked[i].Completed.Before(ranked[j].Completed)
+	})
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+		if i > 0 && ranked[i].Score.Total == ranked[i-1].Score.Total {
+			ranked[i].Rank = ranked[i-1].Rank
+		}
+	}
+	return ranked
+}
+
+// TournamentStandings returns the standings in the named
+// tournament as of the given time, marking the given session's.
+// Every entrant is included, and every round that has started
+// counts.  Returns false if there's no such tournament.
+func TournamentStandings(name, sid string, now time.Time) ([]Standing, bool) {
+	t := FindTournament(name, now)
+	if t == nil {
+		return nil, false
+	}
+	var totals []map[string]int
+	for _, o := range roundOutcomes(t, now) {
+		totals = append(totals, o.totals)
+	}
+	return rankStandings(loadEntrants(name), totals, sid), true
+}
+
+// TournamentBracket returns the bracket of the named tournament
+// as of the given time, marking the given session's matches.
+// There's a bracket round for every tournament round that has
+// started, until the bracket is over.  Returns false if there's
+// no such tournament.
+func TournamentBracket(name, sid string, now time.Time) ([]BracketRound, bool) {
+	t := FindTournament(name, now)
+	if t == nil {
+		return nil, false
+	}
+	return drawBracket(loadEntrants(name), roundOutcomes(t, now), sid), true
+}
+
+// loadEntrants: load the sessions entered in a tournament, in
+// order of entry.
+func loadEntrants(name string) []string {
+	var entrants []string
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"SELECT sessionId FROM tournamentEntrants WHERE tournamentName = $1 ORDER BY entered, sessionId", name)
+		if err != nil {
+			return fmt.Errorf("Database failure loading entrants of %q: %v", name, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var esid string
+			if err := rows.Scan(&esid); err != nil {
+				return fmt.Errorf("Database failure reading entrants of %q: %v", name, err)
+			}
+			entrants = append(entrants, esid)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	return entrants
+}
+
+// A roundOutcome is how the entrants did in a round: their
+// totals and completion times, by session, and whether the round
+// is over.
+type roundOutcome struct {
+	totals    map[string]int
+	completed map[string]time.Time
+	ended     bool
+}
+
+// roundOutcomes: score the rounds of a tournament that have
+// started by the given time.
+func roundOutcomes(t *Tournament, now time.Time) []roundOutcome {
+	var outcomes []roundOutcome
+	for _, r := range t.Rounds {
+		if r.Info == nil {
+			break
+		}
+		results, sids := roundScores(t.Name, r.Info.PuzzleId, r.Starts, r.Ends)
+		o := roundOutcome{
+			totals:    make(map[string]int, len(results)),
+			completed: make(map[string]time.Time, len(results)),
+			ended:     !now.Before(r.Ends),
+		}
+		for i, result := range results {
+			o.totals[sids[i]], o.completed[sids[i]] = result.Score.Total, result.Completed
+		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes
+}
+
+// drawBracket draws the bracket for entrants, given in order of
+// entry, from the outcomes of the rounds so far, following the
+// rules at the top of this file.
+func drawBracket(entrants []string, outcomes []roundOutcome, sid string) []BracketRound {
+	seeds := make([]int, len(entrants)) // remaining players, by seed
+	for i := range seeds {
+		seeds[i] = i
+	}
+	var bracket []BracketRound
+	for round, o := range outcomes {
+		if len(seeds) < 2 {
+			break
+		}
+		br := BracketRound{Round: round + 1}
+		var winners []int
+		// pair matches seed a with seed b, or gives a a bye if b < 0
+		pair := func(a, b int) {
+			m := Match{
+				Players: [2]string{PlayerTag(entrants[a]), ""},
+				Totals:  [2]int{o.totals[entrants[a]], 0},
+				Self:    entrants[a] == sid,
+			}
+			winner := a
+			if b >= 0 {
+				m.Players[1], m.Totals[1] = PlayerTag(entrants[b]), o.totals[entrants[b]]
+				m.Self = m.Self || entrants[b] == sid
+				if beats(o, entrants[b], entrants[a]) {
+					winner = b
+				}
+			}
+			if o.ended {
+				m.Winner = PlayerTag(entrants[winner])
+			}
+			br.Matches = append(br.Matches, m)
+			winners = append(winners, winner)
+		}
+		first, last := 0, len(seeds)-1
+		if len(seeds)%2 == 1 {
+			pair(seeds[0], -1)
+			first++
+		}
+		for ; first < last; first, last = first+1, last-1 {
+			pair(seeds[first], seeds[last])
+		}
+		bracket = append(bracket, br)
+		if !o.ended {
+			break
+		}
+		sort.Ints(winners)
+		seeds = winners
+	}
+	return bracket
+}
+
+// beats: whether session a beat session b, the better seed, in a
+// round.
+func beats(o roundOutcome, a, b string) bool {
+	if o.totals[a] != o.totals[b] {
+		return o.totals[a] > o.totals[b]
+	}
+	ca, aok := o.completed[a]
+	cb, bok := o.completed[b]
+	return aok && (!bok || ca.Before(cb))
+}
+
+// rankStandings ranks entrants, given in order of entry, by the
+// sum of their totals in each round.  Equal sums share a rank.
+func rankStandings(entrants []string, totals []map[string]int, sid string) []Standing {
+	standings := make([]Standing, len(entrants))
+	for i, esid := range entrants {
+		st := Standing{Player: PlayerTag(esid), Self: esid == sid, Rounds: make([]int, len(totals))}
+		for j, round := range totals {
+			st.Rounds[j] = round[esid]
+			st.Total += round[esid]
+		}
+		standings[i] = st
+	}
+	sort.SliceStable(standings, func(i, j int) bool { return standings[i].Total > standings[j].Total })
+	for i := range standings {
+		standings[i].Rank = i + 1
+		if i > 0 && standings[i].Total == standings[i-1].Total {
+			standings[i].Rank = standings[i-1].Rank
+		}
+	}
+	return standings
+}
+
+// FinishRounds marks the rounds that ended by the given time and
+// haven't had their results announced as announced, and returns
+// them with their results, in order of their ends.  Each round is
+// returned only once, even with several servers calling.
+func FinishRounds(now time.Time) []*FinishedRound {
+	var finished []*FinishedRound
+	var pids, names []string
+	body := func(tx *pgx.Tx) error {
+		rows, err := tx.Query(
+			"UPDATE tournamentRounds SET resultsSent = $1 "+
+				"WHERE ends <= $1 AND resultsSent IS NULL "+
+				"RETURNING tournamentName, round, puzzleId, puzzleName, starts, ends",
+			now)
+		if err != nil {
+			return fmt.Errorf("Database failure finishing tournament rounds: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var round int32
+			var pid, name string
+			f := &FinishedRound{Round: &TournamentRound{}}
+			if err := rows.Scan(&f.Tournament, &round, &pid, &name, &f.Round.Starts, &f.Round.Ends); err != nil {
+				return fmt.Errorf("Database failure reading finished rounds: %v", err)
+			}
+			f.Round.Round = int(round)
+			finished, pids, names = append(finished, f), append(pids, pid), append(names, name)
+		}
+		return rows.Err()
+	}
+	pgExecute(body)
+	for i, f := range finished {
+		f.Round.Info, f.Round.Values = featuredPuzzle(pids[i], names[i])
+		results, sids := roundScores(f.Tournament, pids[i], f.Round.Starts, f.Round.Ends)
+		f.Results = rankRoundResults(results, sids, "")
+	}
+	sort.SliceStable(finished, func(i, j int) bool { return finished[i].Round.Ends.Before(finished[j].Round.Ends) })
+	return finished
+}
@@ -0,0 +1,176 @@
+// susen.go - a web-based Sudoku game and teaching tool.
+// Copyright (C) 2015-2016 Daniel C. Brotsky.
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, write to the Free Software Foundation, Inc.,
+// 51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+// Licensed under the LGPL v3.  See the LICENSE file for details
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/garyburd/redigo/redis"
+	"github.com/ancientHacker/susen.go/Godeps/_workspace/src/github.com/jackc/pgx"
+	"github.com/ancientHacker/susen.go/puzzle"
+	"strings"
+)
+
+/*
+
+summary upgrades
+
+The step cache holds puzzle summaries written by whatever release
+was running when the steps were taken.  Older summaries still
+load, because the puzzle package converts them as they're
+decoded, but a summary written before entered squares were
+recorded hands the player's moves to the puzzle as givens, and
+only the puzzle entry knows which values were the original
+clues.  So UpgradeSummaries rewrites every cached step at the
+current schema, taking the entered squares from the puzzle entry
+when the summary doesn't have them.  Step lists that can't be
+upgraded are dropped; their sessions rebuild them from the
+session entries the next time they're loaded.
+
+*/
+
+// An UpgradeReport counts what UpgradeSummaries did.
+type UpgradeReport struct {
+	Lists    int `json:"lists"`    // step lists examined
+	Steps    int `json:"steps"`    // summaries examined
+	Upgraded int `json:"upgraded"` // summaries rewritten at the current schema
+	Dropped  int `json:"dropped"`  // lists dropped because they couldn't be upgraded
+	Busy     int `json:"busy"`     // lists skipped because they changed while upgrading
+}
+
+// UpgradeSummaries rewrites all the cached step summaries from
+// older schemas at the current one.  Running it again is
+// harmless: current summaries are left alone.
+func UpgradeSummaries() UpgradeReport {
+	var keys []string
+	body := func(tx redis.Conn) (err error) {
+		keys, err = redis.Strings(tx.Do("KEYS", "SID:*:PID:*:Steps"))
+		if err != nil {
+			err = fmt.Errorf("Cache failure listing step lists: %v", err)
+		}
+		return
+	}
+	rdExecute(body)
+	var report UpgradeReport
+	originals := make(map[string][]int32)
+	for _, key := range keys {
+		report.Lists++
+		pid := strings.TrimSuffix(key[strings.LastIndex(key, ":PID:")+len(":PID:"):], ":Steps")
+		original, ok := originals[pid]
+		if !ok {
+			original = originalValues(pid)
+			originals[pid] = original
+		}
+		body := func(tx redis.Conn) error {
+			if _, err := tx.Do("WATCH", key); err != nil {
+				return fmt.Errorf("Cache failure watching %q: %v", key, err)
+			}
+			steps, err := redis.ByteSlices(tx.Do("LRANGE", key, 0, -1))
+			if err != nil {
+				return fmt.Errorf("Cache failure reading %q: %v", key, err)
+			}
+			report.Steps += len(steps)
+			args, count := redis.Args{}.Add(key), 0
+			for _, step := range steps {
+				upgraded, changed, err := upgradeStep(step, original)
+				if err != nil {
+					args, count = nil, 0
+					break
+				}
+				if changed {
+					count++
+				}
+				args = args.Add(upgraded)
+			}
+			if args != nil && count == 0 {
+				_, err := tx.Do("UNWATCH")
+				return err
+			}
+			tx.Send("MULTI")
+			tx.Send("DEL", key)
+			if args != nil {
+				tx.Send("RPUSH", args...)
+			}
+			reply, err := tx.Do("EXEC")
+			if err != nil {
+				return fmt.Errorf("Cache failure rewriting %q: %v", key, err)
+			}
+			switch {
+			case reply == nil:
+				report.Busy++
+			case args == nil:
+				report.Dropped++
+			default:
+				report.Upgraded += count
+			}
+			return nil
+		}
+		rdExecute(body)
+	}
+	return report
+}
+
+// originalValues: the values of a stored puzzle entry, or nil if
+// there is no such entry.
+func originalValues(pid string) []int32 {
+	var values []int32
+	body := func(tx *pgx.Tx) error {
+		row := tx.QueryRow("SELECT valueList FROM puzzles WHERE puzzleId = $1", pid)
+		if err := row.Scan(&values); err != nil && err != pgx.ErrNoRows {
+			return fmt.Errorf("Database failure looking up puzzle %q: %v", pid, err)
+		}
+		return nil
+	}
+	pgExecute(body)
+	return values
+}
+
+// upgradeStep: convert a cached summary to the current schema,
+// reporting whether it needed converting.  The original values
+// of its puzzle, if known, tell which squares the player
+// entered.  Returns an error if the upgraded summary doesn't
+// make a puzzle.
+func upgradeStep(step []byte, original []int32) ([]byte, bool, error) {
+	schema, err := puzzle.SummaryJSONSchema(step)
+	if err != nil {
+		return nil, false, err
+	}
+	if schema == puzzle.SummarySchema {
+		return step, false, nil
+	}
+	var summary puzzle.Summary
+	if err := json.Unmarshal(step, &summary); err != nil {
+		return nil, false, err
+	}
+	if summary.Entered == nil && len(original) == len(summary.Values) {
+		for i, v := range summary.Values {
+			if v != 0 && original[i] == 0 {
+				summary.Entered = append(summary.Entered, i+1)
+			}
+		}
+	}
+	if _, err := puzzle.New(&summary); err != nil {
+		return nil, false, err
+	}
+	upgraded, err := json.Marshal(&summary)
+	if err != nil {
+		return nil, false, err
+	}
+	return upgraded, true, nil
+}